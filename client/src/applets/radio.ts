@@ -12,6 +12,8 @@ import {
   removeRadioStation,
   renameRadioStation,
   updateRadioStation,
+  reorderRadioStationList,
+  setRadioFavorites,
   setRadioPlayback,
   setRadioPlaylists,
   setRadioListeners,
@@ -20,6 +22,7 @@ import {
   removeRadioPlaylist,
   updatePlaylistTracks,
   updateRadioPlaybackForStation,
+  syncRadioPosition,
   updateRadioListeners,
   updateRadioStatusForStation,
   tunedStationId,
@@ -54,6 +57,7 @@ registerReadyHandler((data) => {
     setRadioPlayback(mapped);
   }
   setRadioListeners(data.radio_listeners || {});
+  setRadioFavorites(data.radio_favorites || []);
   // Derive initial radio_status from radio_playback
   {
     const pb = data.radio_playback || {};
@@ -80,7 +84,7 @@ registerReadyHandler((data) => {
 
 // Event handlers
 registerEventHandler("radio_station_create", (d) => {
-  addRadioStation({ ...d, manager_ids: d.manager_ids || [], playback_mode: d.playback_mode || "play_all", public_controls: d.public_controls || false });
+  addRadioStation({ ...d, manager_ids: d.manager_ids || [], playback_mode: d.playback_mode || "play_all", public_controls: d.public_controls || false, default_volume: d.default_volume ?? 100, intro_track_id: d.intro_track_id ?? null });
 });
 
 registerEventHandler("radio_station_delete", (d) => {
@@ -91,8 +95,16 @@ registerEventHandler("radio_station_rename", (d) => {
   renameRadioStation(d.id, d.name);
 });
 
+registerEventHandler("radio_favorites", (d) => {
+  setRadioFavorites(d.station_ids || []);
+});
+
+registerEventHandler("radio_station_reorder", (d) => {
+  reorderRadioStationList(d.station_ids || []);
+});
+
 registerEventHandler("radio_station_update", (d) => {
-  updateRadioStation(d.id, d.name, d.manager_ids || [], d.playback_mode, d.public_controls);
+  updateRadioStation(d.id, d.name, d.manager_ids || [], d.playback_mode, d.public_controls, d.default_volume, d.intro_track_id);
 });
 
 registerEventHandler("radio_playback", (d) => {
@@ -103,6 +115,10 @@ registerEventHandler("radio_playback", (d) => {
   }
 });
 
+registerEventHandler("radio_position", (d) => {
+  syncRadioPosition(d.station_id, d.track_index, d.position, d.updated_at);
+});
+
 registerEventHandler("radio_playlist_created", (d) => {
   addRadioPlaylist(d);
 });
@@ -0,0 +1,79 @@
+import { onCleanup, onMount } from "solid-js";
+
+export type CaptchaConfig = { provider: string; site_key: string };
+
+// The token the server's "test" provider accepts (development only).
+const TEST_TOKEN = "test-captcha-pass";
+
+const scripts: Record<string, { src: string; global: string }> = {
+  hcaptcha: { src: "https://js.hcaptcha.com/1/api.js?render=explicit", global: "hcaptcha" },
+  turnstile: { src: "https://challenges.cloudflare.com/turnstile/v0/api.js?render=explicit", global: "turnstile" },
+};
+
+function loadScript(src: string, global: string): Promise<any> {
+  const w = window as any;
+  if (w[global]) return Promise.resolve(w[global]);
+  return new Promise((resolve, reject) => {
+    const el = document.createElement("script");
+    el.src = src;
+    el.async = true;
+    el.onload = () => resolve(w[global]);
+    el.onerror = () => reject(new Error("captcha script failed to load"));
+    document.head.appendChild(el);
+  });
+}
+
+interface CaptchaProps {
+  config: CaptchaConfig;
+  onToken: (token: string) => void;
+  // Receives a function that resets the widget; tokens are single-use.
+  ref?: (reset: () => void) => void;
+}
+
+// Renders the configured registration CAPTCHA and reports its token.
+export default function Captcha(props: CaptchaProps) {
+  let container!: HTMLDivElement;
+  let api: any;
+  let widgetId: any;
+
+  onMount(async () => {
+    if (props.config.provider === "test") {
+      props.ref?.(() => props.onToken(""));
+      return;
+    }
+    const script = scripts[props.config.provider];
+    if (!script) return;
+    try {
+      api = await loadScript(script.src, script.global);
+      widgetId = api.render(container, {
+        sitekey: props.config.site_key,
+        theme: "dark",
+        callback: (token: string) => props.onToken(token),
+        "expired-callback": () => props.onToken(""),
+      });
+      props.ref?.(() => {
+        api.reset(widgetId);
+        props.onToken("");
+      });
+    } catch {
+      // Registration will fail with a clear server error
+    }
+  });
+
+  onCleanup(() => {
+    if (api && widgetId !== undefined) api.remove?.(widgetId);
+  });
+
+  return (
+    <div style={{ "margin-bottom": "16px" }}>
+      {props.config.provider === "test" ? (
+        <label style={{ display: "flex", "align-items": "center", gap: "6px", color: "var(--text-muted)", "font-size": "12px" }}>
+          <input type="checkbox" onChange={(e) => props.onToken(e.currentTarget.checked ? TEST_TOKEN : "")} />
+          i am not a robot (test captcha)
+        </label>
+      ) : (
+        <div ref={container} />
+      )}
+    </div>
+  );
+}
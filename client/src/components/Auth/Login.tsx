@@ -1,6 +1,7 @@
 import { createSignal, onMount, Show } from "solid-js";
 import { isTauri } from "../../lib/devices";
 import { t } from "../../stores/theme";
+import Captcha, { type CaptchaConfig } from "./Captcha";
 
 interface LoginProps {
   onLogin: (token: string, username: string) => void;
@@ -12,6 +13,7 @@ function Login(props: LoginProps) {
   const [password, setPassword] = createSignal("");
   const [confirmPassword, setConfirmPassword] = createSignal("");
   const [knockMessage, setKnockMessage] = createSignal("");
+  const [remember, setRemember] = createSignal(true);
   const [isRegister, setIsRegister] = createSignal(false);
   const [error, setError] = createSignal("");
   const [loading, setLoading] = createSignal(false);
@@ -36,6 +38,9 @@ function Login(props: LoginProps) {
   const [serverUrl, setServerUrl] = createSignal("");
   const [serverError, setServerError] = createSignal("");
   const [serverLoading, setServerLoading] = createSignal(false);
+  const [captchaConfig, setCaptchaConfig] = createSignal<CaptchaConfig | null>(null);
+  const [captchaToken, setCaptchaToken] = createSignal("");
+  let resetCaptcha: (() => void) | undefined;
 
   onMount(async () => {
     try {
@@ -45,6 +50,37 @@ function Login(props: LoginProps) {
     } catch { /* ignore */ }
   });
 
+  onMount(async () => {
+    try {
+      const res = await fetch("/api/v1/server/info");
+      const data = await res.json();
+      if (data.captcha) setCaptchaConfig(data.captcha);
+    } catch { /* ignore */ }
+  });
+
+  // Emailed login links land on /magic-link?token=...; trade the token for
+  // a session and drop it from the address bar.
+  onMount(async () => {
+    if (window.location.pathname !== "/magic-link") return;
+    const token = new URLSearchParams(window.location.search).get("token");
+    window.history.replaceState(null, "", "/");
+    if (!token) return;
+    setLoading(true);
+    try {
+      const res = await fetch(`/api/v1/auth/magic-link/consume?token=${encodeURIComponent(token)}`);
+      const data = await res.json();
+      if (!res.ok) {
+        setError(data.error || "Login link is invalid or expired");
+        return;
+      }
+      props.onLogin(data.token, data.user.username);
+    } catch {
+      setError("Failed to connect to server");
+    } finally {
+      setLoading(false);
+    }
+  });
+
   const connectToServer = async () => {
     let url = serverUrl().trim();
     if (!url) return;
@@ -81,7 +117,7 @@ function Login(props: LoginProps) {
       : "/api/v1/auth/login";
 
     try {
-      const body: Record<string, string> = { username: username() };
+      const body: Record<string, string | boolean> = { username: username() };
       if (password()) {
         body.password = password();
       }
@@ -91,6 +127,12 @@ function Login(props: LoginProps) {
       if (isRegister() && knockMessage()) {
         body.knock_message = knockMessage();
       }
+      if (isRegister() && captchaConfig()) {
+        body.captcha_token = captchaToken();
+      }
+      if (!isRegister()) {
+        body.remember = remember();
+      }
 
       const res = await fetch(endpoint, {
         method: "POST",
@@ -103,6 +145,7 @@ function Login(props: LoginProps) {
       if (data.pending_verification) {
         const vEmail = isRegister() ? email() : username();
         setVerificationEmail(vEmail);
+        setVerificationError(data.email_error || "");
         setPendingVerification(true);
         return;
       }
@@ -114,6 +157,7 @@ function Login(props: LoginProps) {
 
       if (!res.ok) {
         setError(data.error || "Something went wrong");
+        if (isRegister()) resetCaptcha?.();
         return;
       }
 
@@ -970,6 +1014,29 @@ function Login(props: LoginProps) {
             </div>
           </Show>
 
+          <Show when={!isRegister()}>
+            <label
+              style={{
+                display: "flex",
+                "align-items": "center",
+                gap: "6px",
+                "margin-bottom": "16px",
+                color: "var(--text-muted)",
+                "font-size": "11px",
+                "text-transform": "uppercase",
+                "letter-spacing": "1px",
+                cursor: "pointer",
+              }}
+            >
+              <input
+                type="checkbox"
+                checked={remember()}
+                onChange={(e) => setRemember(e.currentTarget.checked)}
+              />
+              remember me
+            </label>
+          </Show>
+
           <Show when={isRegister()}>
             <div style={{ "margin-bottom": "24px" }}>
               <label
@@ -1007,6 +1074,10 @@ function Login(props: LoginProps) {
             </div>
           </Show>
 
+          <Show when={isRegister() ? captchaConfig() : null}>
+            {(cfg) => <Captcha config={cfg()} onToken={setCaptchaToken} ref={(reset) => (resetCaptcha = reset)} />}
+          </Show>
+
           <button
             type="submit"
             disabled={loading()}
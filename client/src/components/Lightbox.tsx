@@ -1,5 +1,5 @@
 import { Show, onCleanup, createSignal } from "solid-js";
-import { lightboxUrl, closeLightbox } from "../stores/lightbox";
+import { lightboxUrl, lightboxDownloadUrl, closeLightbox } from "../stores/lightbox";
 
 export default function Lightbox() {
   const [scale, setScale] = createSignal(1);
@@ -119,6 +119,25 @@ export default function Lightbox() {
             "transform-origin": "center center",
           }}
         />
+        <Show when={lightboxDownloadUrl()}>
+          <a
+            href={lightboxDownloadUrl()!}
+            download
+            onClick={(e) => e.stopPropagation()}
+            style={{
+              position: "absolute",
+              bottom: "16px",
+              right: "16px",
+              padding: "3px 8px",
+              "font-size": "11px",
+              color: "var(--text-secondary)",
+              border: "1px solid var(--border-gold)",
+              "background-color": "var(--bg-secondary)",
+            }}
+          >
+            [download]
+          </a>
+        </Show>
       </div>
     </Show>
   );
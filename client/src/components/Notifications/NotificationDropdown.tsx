@@ -1,8 +1,9 @@
 import { For, Show, onMount, onCleanup } from "solid-js";
-import { notifications, unreadCount, markRead, markAllRead, type Notification } from "../../stores/notifications";
+import { notifications, unreadCount, markRead, markAllRead, clearNotificationList, type Notification } from "../../stores/notifications";
 import { setSelectedChannelId } from "../../stores/channels";
 import { setScrollToMessageId } from "../../stores/messages";
 import { send } from "../../lib/ws";
+import { clearNotifications } from "../../lib/api";
 import { lookupUsername } from "../../stores/users";
 import { isMobile } from "../../stores/responsive";
 import { setSettingsOpen, setSettingsTab } from "../../stores/settings";
@@ -75,6 +76,11 @@ export default function NotificationDropdown(props: NotificationDropdownProps) {
     send("mark_all_notifications_read", {});
   };
 
+  const handleClearAll = () => {
+    clearNotificationList();
+    clearNotifications().catch((err) => console.error("[notifications] clear failed:", err));
+  };
+
   return (
     <div
       ref={dropdownRef}
@@ -129,18 +135,32 @@ export default function NotificationDropdown(props: NotificationDropdownProps) {
             {t("notifications")}
           </span>
         </div>
-        <Show when={unreadCount() > 0}>
-          <button
-            onClick={handleMarkAllRead}
-            style={{
-              "font-size": "11px",
-              color: "var(--cyan)",
-              padding: "2px 6px",
-            }}
-          >
-            [mark all read]
-          </button>
-        </Show>
+        <div style={{ display: "flex", "align-items": "center" }}>
+          <Show when={unreadCount() > 0}>
+            <button
+              onClick={handleMarkAllRead}
+              style={{
+                "font-size": "11px",
+                color: "var(--cyan)",
+                padding: "2px 6px",
+              }}
+            >
+              [mark all read]
+            </button>
+          </Show>
+          <Show when={notifications().length > 0}>
+            <button
+              onClick={handleClearAll}
+              style={{
+                "font-size": "11px",
+                color: "var(--text-muted)",
+                padding: "2px 6px",
+              }}
+            >
+              [clear all]
+            </button>
+          </Show>
+        </div>
       </div>
 
       {/* Notification list */}
@@ -189,7 +209,11 @@ export default function NotificationDropdown(props: NotificationDropdownProps) {
                   >
                     <span style={{ color: "var(--cyan)" }}>@{notif.data.author_username}</span>{" "}
                     <span style={{ color: "var(--text-muted)" }}>
-                      mentioned you in{" "}
+                      {notif.type === "reply"
+                        ? "replied to you in"
+                        : notif.type === "thread_reply"
+                          ? "replied in a thread in"
+                          : "mentioned you in"}{" "}
                     </span>
                     <span style={{ color: "var(--accent)" }}>#{notif.data.channel_name}</span>
                   </div>
@@ -221,6 +245,20 @@ export default function NotificationDropdown(props: NotificationDropdownProps) {
                     is requesting access
                   </span>
                 </div>
+                <Show when={notif.data.knock_message}>
+                  <div
+                    style={{
+                      "font-size": "11px",
+                      color: "var(--text-muted)",
+                      "margin-top": "2px",
+                      "font-style": "italic",
+                      "white-space": "pre-wrap",
+                      "word-break": "break-word",
+                    }}
+                  >
+                    {notif.data.knock_message}
+                  </div>
+                </Show>
               </Show>
               <div
                 style={{
@@ -14,7 +14,7 @@ import {
 } from "../../stores/radio";
 import { currentUser } from "../../stores/auth";
 import { lookupUsername, allUsers } from "../../stores/users";
-import { uploadRadioTrack, deleteRadioTrack } from "../../lib/api";
+import { uploadRadioTrack } from "../../lib/api";
 import { isMobile } from "../../stores/responsive";
 import Waveform from "./Waveform";
 
@@ -60,6 +60,8 @@ export default function RadioPlayer() {
 
   const stationId = () => tunedStationId();
   const station = () => radioStations().find((s) => s.id === stationId());
+  // Listeners hear the station at the volume its managers chose
+  const stationGain = () => (station()?.default_volume ?? 100) / 100;
   const pb = (): RadioPlayback | null => {
     const sid = stationId();
     return sid ? getStationPlayback(sid) : null;
@@ -142,7 +144,7 @@ export default function RadioPlayer() {
       analyser.fftSize = 256;
       analyser.smoothingTimeConstant = 0.7;
       gainNode = audioCtx.createGain();
-      gainNode.gain.value = locallyMuted() ? 0 : 1;
+      gainNode.gain.value = locallyMuted() ? 0 : stationGain();
       sourceNode = audioCtx.createMediaElementSource(audioRef);
       sourceNode.connect(analyser);
       analyser.connect(gainNode);
@@ -150,11 +152,12 @@ export default function RadioPlayer() {
     } catch {}
   };
 
-  const toggleMute = () => {
-    const muted = !locallyMuted();
-    setLocallyMuted(muted);
-    if (gainNode) gainNode.gain.value = muted ? 0 : 1;
-  };
+  const toggleMute = () => setLocallyMuted(!locallyMuted());
+
+  createEffect(() => {
+    const gain = locallyMuted() ? 0 : stationGain();
+    if (gainNode) gainNode.gain.value = gain;
+  });
 
   // --- Progress tracking + EQ render ---
   const NUM_BARS = 24;
@@ -327,10 +330,12 @@ export default function RadioPlayer() {
     }
   });
 
+  // Every listener reports the end; the server advances on the first
+  // report for the current track and drops the rest
   const handleEnded = () => {
     const sid = stationId();
     if (sid) {
-      send("radio_track_ended", { station_id: sid });
+      send("radio_track_ended", { station_id: sid, track_index: pb()?.track_index });
     }
   };
 
@@ -430,11 +435,12 @@ export default function RadioPlayer() {
         const count = files.length > 1 ? ` (${i + 1}/${files.length})` : "";
         try {
           setUploadStatus(`Processing ${file.name}${count}`);
-          const result = await uploadRadioTrack(playlistId, file, (phase) => {
+          const result = await uploadRadioTrack(playlistId, file, (phase, percent) => {
             if (phase === "processing") {
               setUploadStatus(`Processing ${file.name}${count}`);
             } else {
-              setUploadStatus(`Uploading ${file.name}${count}`);
+              const pct = percent !== undefined ? ` ${percent}%` : "";
+              setUploadStatus(`Uploading ${file.name}${count}${pct}`);
             }
           });
           updatePlaylistTracks(playlistId, [
@@ -464,19 +470,10 @@ export default function RadioPlayer() {
     input.click();
   };
 
-  const handleDeleteTrack = async (playlistId: string, trackId: string) => {
-    try {
-      await deleteRadioTrack(trackId);
-      const playlist = radioPlaylists().find((p) => p.id === playlistId);
-      if (playlist) {
-        updatePlaylistTracks(
-          playlistId,
-          playlist.tracks.filter((t) => t.id !== trackId)
-        );
-      }
-    } catch (e) {
-      console.error("Delete track failed:", e);
-    }
+  // The server re-broadcasts radio_playlist_tracks and moves any station
+  // that was playing the track on to the next one.
+  const handleDeleteTrack = (trackId: string) => {
+    send("delete_radio_track", { track_id: trackId });
   };
 
   const canManageStation = () => {
@@ -486,8 +483,9 @@ export default function RadioPlayer() {
     return user.is_admin || s.manager_ids?.includes(user.id);
   };
 
+  // Managers always; everyone else (tuned in here) only with public controls
   const canControlPlayback = () => {
-    return !!station() && !!currentUser();
+    return canManageStation() || (!!currentUser() && !!station()?.public_controls);
   };
 
   const handleStartStation = () => {
@@ -768,7 +766,7 @@ export default function RadioPlayer() {
           <Show when={pb()}>
             <div style={{ padding: "8px 10px", "border-bottom": "1px solid rgba(201,168,76,0.15)" }}>
               <div style={{ "font-size": "12px", color: "var(--text-primary)", "font-weight": "600" }}>
-                {pb()!.track?.filename || "Unknown track"}
+                {pb()!.intro ? "Intro: " : ""}{pb()!.track?.filename || "Unknown track"}
               </div>
               <div style={{ "font-size": "10px", color: "var(--text-muted)", "margin-top": "2px" }}>
                 DJ: {djName()}
@@ -951,7 +949,7 @@ export default function RadioPlayer() {
                     onToggle={() => togglePlaylist(playlist.id)}
                     onPlay={() => handlePlayOnStation(playlist.id)}
                     onUpload={() => handleUploadTrack(playlist.id)}
-                    onDeleteTrack={(trackId) => handleDeleteTrack(playlist.id, trackId)}
+                    onDeleteTrack={(trackId) => handleDeleteTrack(trackId)}
                     onDelete={() => handleDeletePlaylist(playlist.id)}
                     uploading={uploading()}
                   />
@@ -1165,10 +1163,10 @@ function PlaylistSection(props: {
 }
 
 function StationManageMenu(props: {
-  station: { id: string; name: string; manager_ids?: string[]; playback_mode?: string; public_controls?: boolean };
+  station: { id: string; name: string; manager_ids?: string[]; playback_mode?: string; public_controls?: boolean; default_volume?: number; intro_track_id?: string | null };
   onClose: () => void;
 }) {
-  const [mode, setMode] = createSignal<"main" | "rename" | "managers" | "playback" | "confirmDelete">("main");
+  const [mode, setMode] = createSignal<"main" | "rename" | "managers" | "playback" | "volume" | "intro" | "confirmDelete">("main");
   const [renameValue, setRenameValue] = createSignal(props.station.name);
   const [confirmValue, setConfirmValue] = createSignal("");
   let menuRef: HTMLDivElement | undefined;
@@ -1218,6 +1216,12 @@ function StationManageMenu(props: {
   const managerUsers = () =>
     allUsers().filter((u) => managerIds().includes(u.id));
 
+  // The server takes an intro from the station's playlists or our own
+  const introCandidates = () =>
+    radioPlaylists()
+      .filter((p) => p.station_id === props.station.id || p.user_id === currentUser()?.id)
+      .flatMap((p) => p.tracks || []);
+
   return (
     <div
       ref={menuRef}
@@ -1252,6 +1256,22 @@ function StationManageMenu(props: {
         >
           Playback Mode
         </button>
+        <button
+          onClick={() => setMode("volume")}
+          style={manageMenuItemStyle}
+          onMouseOver={(e) => (e.currentTarget.style.backgroundColor = "var(--accent-glow)")}
+          onMouseOut={(e) => (e.currentTarget.style.backgroundColor = "transparent")}
+        >
+          Default Volume [{props.station.default_volume ?? 100}%]
+        </button>
+        <button
+          onClick={() => setMode("intro")}
+          style={manageMenuItemStyle}
+          onMouseOver={(e) => (e.currentTarget.style.backgroundColor = "var(--accent-glow)")}
+          onMouseOut={(e) => (e.currentTarget.style.backgroundColor = "transparent")}
+        >
+          Intro {props.station.intro_track_id ? "[ON]" : "[OFF]"}
+        </button>
         <button
           onClick={() => {
             send("set_radio_station_public_controls", {
@@ -1445,6 +1465,99 @@ function StationManageMenu(props: {
         </div>
       </Show>
 
+      <Show when={mode() === "volume"}>
+        <div style={{ padding: "8px" }}>
+          <div style={{
+            "font-size": "10px",
+            "text-transform": "uppercase",
+            "letter-spacing": "1px",
+            color: "var(--text-muted)",
+            "margin-bottom": "6px",
+          }}>
+            Default Volume
+          </div>
+          <div style={{ display: "flex", "align-items": "center", gap: "6px" }}>
+            <input
+              type="range"
+              min="0"
+              max="100"
+              step="5"
+              value={props.station.default_volume ?? 100}
+              onChange={(e) => {
+                send("set_radio_station_volume", {
+                  station_id: props.station.id,
+                  volume: parseInt(e.currentTarget.value, 10),
+                });
+              }}
+              style={{ flex: "1" }}
+            />
+            <span style={{ "font-size": "11px", color: "var(--text-secondary)", width: "32px" }}>
+              {props.station.default_volume ?? 100}%
+            </span>
+          </div>
+          <div style={{ "margin-top": "8px" }}>
+            <button
+              onClick={() => setMode("main")}
+              style={{ ...manageActionBtnStyle, color: "var(--text-muted)", border: "1px solid var(--text-muted)" }}
+            >
+              [back]
+            </button>
+          </div>
+        </div>
+      </Show>
+
+      <Show when={mode() === "intro"}>
+        <div style={{ padding: "8px" }}>
+          <div style={{
+            "font-size": "10px",
+            "text-transform": "uppercase",
+            "letter-spacing": "1px",
+            color: "var(--text-muted)",
+            "margin-bottom": "6px",
+          }}>
+            Intro
+          </div>
+          <div style={{ "font-size": "10px", color: "var(--text-muted)", "margin-bottom": "4px" }}>
+            Plays once before the first track when the station starts
+          </div>
+          <div style={{ "max-height": "160px", "overflow-y": "auto" }}>
+            <For each={[null, ...introCandidates()]}>
+              {(track) => (
+                <label style={{
+                  display: "flex",
+                  "align-items": "center",
+                  gap: "6px",
+                  padding: "3px 0",
+                  cursor: "pointer",
+                  "font-size": "11px",
+                  color: "var(--text-secondary)",
+                }}>
+                  <input
+                    type="radio"
+                    name="intro_track"
+                    checked={(props.station.intro_track_id ?? null) === (track?.id ?? null)}
+                    onChange={() => {
+                      send("set_radio_station_intro", { station_id: props.station.id, track_id: track?.id ?? null });
+                    }}
+                  />
+                  <span style={{ overflow: "hidden", "text-overflow": "ellipsis", "white-space": "nowrap" }}>
+                    {track ? track.filename : "None"}
+                  </span>
+                </label>
+              )}
+            </For>
+          </div>
+          <div style={{ "margin-top": "8px" }}>
+            <button
+              onClick={() => setMode("main")}
+              style={{ ...manageActionBtnStyle, color: "var(--text-muted)", border: "1px solid var(--text-muted)" }}
+            >
+              [back]
+            </button>
+          </div>
+        </div>
+      </Show>
+
       <Show when={mode() === "confirmDelete"}>
         <div style={{ padding: "8px" }}>
           <div style={{ color: "var(--text-secondary)", "margin-bottom": "8px", "line-height": "1.4", "font-size": "11px" }}>
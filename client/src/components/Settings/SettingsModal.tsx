@@ -10,7 +10,7 @@ import {
 import { microphones, speakers, enumerateDevices, desktopInputs, desktopOutputs, setDesktopDefaultDevice, isDesktop, isTauri } from "../../lib/devices";
 import { applyMasterVolume, setSpeaker } from "../../lib/audio";
 import { muteChannelMic, unmuteChannelMic } from "../../lib/webrtc";
-import { getAudioDevices, setAudioDevice, getUsers, deleteUser, setUserAdmin, setUserPassword, changePassword, updateEmail, approveUser, getEmailSettings, saveEmailSettings, sendTestEmail, getWebhookKeys, createWebhookKey, deleteWebhookKey, WebhookKey } from "../../lib/api";
+import { getAudioDevices, setAudioDevice, getUsers, deleteUser, setUserAdmin, setUserPassword, changePassword, updateEmail, getMentionEmail, setMentionEmail, approveUser, rejectUser, getEmailSettings, saveEmailSettings, sendTestEmail, getWebhookKeys, createWebhookKey, deleteWebhookKey, WebhookKey } from "../../lib/api";
 import { currentUser, setUser } from "../../stores/auth";
 import { allUsers, removeAllUser } from "../../stores/users";
 import { isMobile } from "../../stores/responsive";
@@ -20,6 +20,7 @@ import {
 } from "../../stores/updateChecker";
 import { theme, setTheme, themes, t, ThemeId } from "../../stores/theme";
 import { deletedChannels } from "../../stores/channels";
+import { voiceEndpoints } from "../../stores/voice";
 import { send } from "../../lib/ws";
 import { APPLETS, isAppletEnabled, toggleApplet } from "../../stores/applets";
 import { enabledFeatures } from "../../stores/strudel";
@@ -72,6 +73,7 @@ export default function SettingsModal() {
   const [accountEmail, setAccountEmail] = createSignal(currentUser()?.email || "");
   const [emailError, setEmailError] = createSignal("");
   const [emailSuccess, setEmailSuccess] = createSignal("");
+  const [mentionEmail, setMentionEmailState] = createSignal(true);
   let testStream: MediaStream | null = null;
   let testCtx: AudioContext | null = null;
   let testInterval: number | null = null;
@@ -141,8 +143,10 @@ export default function SettingsModal() {
   };
 
   const handleRejectUser = async (id: string) => {
+    const reason = prompt("Reason (optional, emailed to the applicant):");
+    if (reason === null) return;
     try {
-      await deleteUser(id);
+      await rejectUser(id, reason);
       setAdminUsers((prev) => prev.filter((u) => u.id !== id));
     } catch {
       // Error
@@ -440,6 +444,9 @@ export default function SettingsModal() {
       setAccountEmail(currentUser()?.email || "");
       setEmailError("");
       setEmailSuccess("");
+      getMentionEmail()
+        .then((res) => setMentionEmailState(res.enabled))
+        .catch(() => {});
     }
   });
 
@@ -785,6 +792,37 @@ export default function SettingsModal() {
                   [save email]
                 </button>
 
+                <label
+                  style={{
+                    display: "flex",
+                    "align-items": "center",
+                    gap: "8px",
+                    padding: "10px 0 0",
+                    "font-size": "12px",
+                    color: "var(--text-primary)",
+                    cursor: "pointer",
+                  }}
+                >
+                  <input
+                    type="checkbox"
+                    checked={mentionEmail()}
+                    onChange={async (e) => {
+                      const enabled = e.currentTarget.checked;
+                      try {
+                        const res = await setMentionEmail(enabled);
+                        setMentionEmailState(res.enabled);
+                      } catch {
+                        setMentionEmailState(!enabled);
+                      }
+                    }}
+                    style={{ "accent-color": "var(--accent)" }}
+                  />
+                  Email me about mentions while I'm offline
+                </label>
+                <div style={{ color: "var(--text-muted)", "font-size": "11px", "margin-top": "4px" }}>
+                  Needs a verified email. Mute a channel from its header to stop emails from it.
+                </div>
+
                 <div style={{ height: "20px" }} />
                 <div style={sectionHeaderStyle}>Password</div>
 
@@ -1141,6 +1179,26 @@ export default function SettingsModal() {
                   })()}
                 </Show>
 
+                {/* Voice endpoint (only when the server offers more than one) */}
+                <Show when={voiceEndpoints().length > 1}>
+                  <label style={{ ...labelStyle, "margin-top": "16px" }}>
+                    Voice Endpoint
+                  </label>
+                  <select
+                    value={voiceEndpoints().includes(settings().voiceEndpoint) ? settings().voiceEndpoint : ""}
+                    onChange={(e) => updateSettings({ voiceEndpoint: e.currentTarget.value })}
+                    style={selectStyle}
+                  >
+                    <option value="">Server default</option>
+                    <For each={voiceEndpoints().filter((r) => r !== "default")}>
+                      {(endpoint) => <option value={endpoint}>{endpoint}</option>}
+                    </For>
+                  </select>
+                  <div style={{ "font-size": "11px", color: "var(--text-muted)", "margin-top": "4px" }}>
+                    The server address your calls connect to. Used when you start a call; joining one that's running uses its endpoint.
+                  </div>
+                </Show>
+
                 {/* Mic Test */}
                 <div style={{ "margin-top": "20px" }}>
                   <button
@@ -1,6 +1,7 @@
 import { createSignal, For, Show } from "solid-js";
-import { radioStations, radioStatus, setTunedStationId, getStationListeners } from "../../stores/radio";
+import { radioStations, radioStatus, radioFavorites, setTunedStationId, getStationListeners } from "../../stores/radio";
 import { lookupUsername } from "../../stores/users";
+import { currentUser } from "../../stores/auth";
 import { send } from "../../lib/ws";
 import { isMobile, setSidebarOpen } from "../../stores/responsive";
 
@@ -16,6 +17,27 @@ export default function RadioSidebar() {
     setCreating(false);
   };
 
+  // Favorites float to the top, otherwise server order is kept
+  const sortedStations = () => {
+    const favs = new Set(radioFavorites());
+    return [...radioStations()].sort((a, b) => Number(favs.has(b.id)) - Number(favs.has(a.id)));
+  };
+
+  const toggleFavorite = (stationId: string) => {
+    const op = radioFavorites().includes(stationId) ? "unfavorite_station" : "favorite_station";
+    send(op, { station_id: stationId });
+  };
+
+  // Admins nudge a station one slot up or down
+  const moveStation = (stationId: string, delta: number) => {
+    const ids = radioStations().map((s) => s.id);
+    const from = ids.indexOf(stationId);
+    const to = from + delta;
+    if (from < 0 || to < 0 || to >= ids.length) return;
+    [ids[from], ids[to]] = [ids[to], ids[from]];
+    send("reorder_radio_stations", { station_ids: ids });
+  };
+
   return (
     <>
       <div
@@ -71,7 +93,7 @@ export default function RadioSidebar() {
         </div>
       </Show>
 
-      <For each={radioStations()}>
+      <For each={sortedStations()}>
         {(station) => {
           const status = () => radioStatus()[station.id];
           const isActive = () => !!status();
@@ -80,6 +102,7 @@ export default function RadioSidebar() {
             return s ? lookupUsername(s.user_id) || "DJ" : null;
           };
           const listenerCount = () => getStationListeners(station.id).length;
+          const isFavorite = () => radioFavorites().includes(station.id);
 
           return (
             <div
@@ -122,6 +145,30 @@ export default function RadioSidebar() {
                   </div>
                 </Show>
               </div>
+              <span
+                title={isFavorite() ? "Remove from favorites" : "Add to favorites"}
+                onClick={(e) => { e.stopPropagation(); toggleFavorite(station.id); }}
+                style={{
+                  "flex-shrink": "0",
+                  "margin-left": "4px",
+                  "font-size": "10px",
+                  color: isFavorite() ? "var(--accent)" : "var(--text-muted)",
+                }}
+              >
+                {isFavorite() ? "\u2605" : "\u2606"}
+              </span>
+              <Show when={currentUser()?.is_admin}>
+                <span style={{ "flex-shrink": "0", "margin-left": "4px", "font-size": "9px", color: "var(--text-muted)" }}>
+                  <span
+                    title="Move up"
+                    onClick={(e) => { e.stopPropagation(); moveStation(station.id, -1); }}
+                  >{"\u25B2"}</span>
+                  <span
+                    title="Move down"
+                    onClick={(e) => { e.stopPropagation(); moveStation(station.id, 1); }}
+                  >{"\u25BC"}</span>
+                </span>
+              </Show>
               <Show when={listenerCount() > 0}>
                 <span
                   style={{
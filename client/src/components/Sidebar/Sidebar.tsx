@@ -8,7 +8,7 @@ import {
   setWatchingScreenShare,
 } from "../../stores/voice";
 import { subscribeScreenShare } from "../../lib/screenshare";
-import { onlineUsers, allUsers } from "../../stores/users";
+import { onlineUsers, onlineCount, allUsers, myStatus, setMyStatus } from "../../stores/users";
 import { currentUser } from "../../stores/auth";
 import { joinVoice } from "../../lib/webrtc";
 import { setSettingsOpen, setSettingsTab } from "../../stores/settings";
@@ -21,6 +21,7 @@ import CreateChannel from "./CreateChannel";
 import VoiceControls from "../VoiceChannel/VoiceControls";
 import NotificationDropdown from "../Notifications/NotificationDropdown";
 import { t } from "../../stores/theme";
+import { serverBranding } from "../../stores/server";
 import { setUIMode } from "../../stores/mode";
 import { setViewingPattern } from "../../stores/strudel";
 import { getSidebarApplets } from "../../lib/appletComponents";
@@ -101,7 +102,32 @@ export default function Sidebar(props: SidebarProps) {
           gap: "6px",
           "font-size": "12px",
           color: "var(--text-muted)",
+          "min-width": "0",
         }}>
+          <Show when={serverBranding()}>
+            {(b) => (
+              <span
+                title={b().server_name}
+                style={{
+                  display: "flex",
+                  "align-items": "center",
+                  gap: "6px",
+                  "min-width": "0",
+                  color: "var(--text-primary)",
+                  "font-weight": "600",
+                }}
+              >
+                <Show when={b().icon_url}>
+                  {(url) => (
+                    <img src={url()} alt="" style={{ width: "18px", height: "18px", "object-fit": "cover", "flex-shrink": "0" }} />
+                  )}
+                </Show>
+                <span style={{ overflow: "hidden", "text-overflow": "ellipsis", "white-space": "nowrap" }}>
+                  {b().server_name}
+                </span>
+              </span>
+            )}
+          </Show>
           <span style={{
             width: "7px",
             height: "7px",
@@ -116,7 +142,7 @@ export default function Sidebar(props: SidebarProps) {
           {connState() === "connected" ? (
             <span>
               <span style={{ color: "var(--text-secondary)" }}>
-                {onlineUsers().length + 1} {t("online")}
+                {onlineCount()} {t("online")}
               </span>
               {ping() !== null && (
                 <span style={{
@@ -329,7 +355,15 @@ export default function Sidebar(props: SidebarProps) {
                 gap: "6px",
               }}
             >
-              <span style={{ color: "var(--success)", "font-size": "8px" }}>{"\u25CF"}</span>
+              <span
+                onClick={() => setMyStatus(myStatus() === "dnd" ? "online" : "dnd")}
+                title={myStatus() === "dnd" ? "Do not disturb (click to go online)" : "Online (click for do not disturb)"}
+                style={{
+                  color: myStatus() === "dnd" ? "var(--danger)" : "var(--success)",
+                  "font-size": "8px",
+                  cursor: "pointer",
+                }}
+              >{"\u25CF"}</span>
               {currentUser()!.username}
               <span style={{ "font-size": "10px", color: "var(--text-muted)" }}>(you)</span>
             </div>
@@ -359,7 +393,7 @@ export default function Sidebar(props: SidebarProps) {
                   }}
                 >
                   <span style={{
-                    color: isSharing() ? "var(--accent)" : "var(--success)",
+                    color: isSharing() ? "var(--accent)" : user.status === "dnd" ? "var(--danger)" : "var(--success)",
                     "font-size": isSharing() ? "10px" : "8px",
                   }}>
                     {isSharing() ? "\uD83D\uDDA5" : "\u25CF"}
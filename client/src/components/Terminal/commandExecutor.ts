@@ -318,6 +318,22 @@ export function executeCommand(name: string, args: string, ctx: CommandContext):
       return true;
     }
 
+    case "voice-kick": {
+      const username = args.trim();
+      if (!username) {
+        ctx.setStatus("Usage: /voice-kick <user>");
+        return true;
+      }
+      const user = onlineUsers().find((u) => u.username.toLowerCase() === username.toLowerCase());
+      if (user) {
+        send("voice_kick", { user_id: user.id });
+        ctx.setStatus(`Removed ${user.username} from voice`);
+      } else {
+        ctx.setStatus(`User "${username}" not found or offline`);
+      }
+      return true;
+    }
+
     case "server-mute": {
       const username = args.trim();
       if (!username) {
@@ -41,6 +41,7 @@ export const commands: CommandDef[] = [
   { name: "screen", description: "Toggle screen sharing", category: "voice" },
   { name: "watch", description: "Watch a user's screen share", category: "voice", args: "<user>" },
   { name: "volume", description: "Set per-user volume", category: "voice", args: "<user> <0-200>" },
+  { name: "voice-kick", description: "Remove a user from voice (channel manager)", category: "voice", args: "<user>" },
 
   // Settings
   { name: "settings", description: "Open settings", category: "settings" },
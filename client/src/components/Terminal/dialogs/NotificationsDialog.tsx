@@ -106,13 +106,22 @@ export default function NotificationsDialog(props: NotificationsDialogProps) {
                     )}
                   </span>
                 )}
+                {n.type === "reply" && (
+                  <span>
+                    <span style={{ color: "var(--cyan)" }}>@{n.data.author_username}</span>
+                    {" replied to you"}
+                    {n.data.channel_name && (
+                      <span style={{ color: "var(--text-muted)" }}> in #{n.data.channel_name}</span>
+                    )}
+                  </span>
+                )}
                 {n.type === "admin_knock" && (
                   <span>
                     <span style={{ color: "var(--accent)" }}>{n.data.username}</span>
                     {" is requesting access"}
                   </span>
                 )}
-                {n.type !== "mention" && n.type !== "admin_knock" && (
+                {n.type !== "mention" && n.type !== "reply" && n.type !== "admin_knock" && (
                   <span>{n.type}: {JSON.stringify(n.data)}</span>
                 )}
               </span>
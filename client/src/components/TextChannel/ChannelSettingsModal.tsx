@@ -9,6 +9,9 @@ import {
   getAccessRequests,
   approveAccessRequest,
   denyAccessRequest,
+  getChannelWebhooks,
+  createChannelWebhook,
+  deleteChannelWebhook,
 } from "../../lib/api";
 import { channels, setChannelSettingsId } from "../../stores/channels";
 import { send } from "../../lib/ws";
@@ -26,11 +29,18 @@ export default function ChannelSettingsModal(props: ChannelSettingsModalProps) {
   const [channelName, setChannelName] = createSignal("");
   const [channelDesc, setChannelDesc] = createSignal("");
   const [channelVis, setChannelVis] = createSignal("public");
+  const [announcement, setAnnouncement] = createSignal(false);
+  const [allowAttachments, setAllowAttachments] = createSignal(true);
+  const [allowLinks, setAllowLinks] = createSignal(true);
   const [addUsername, setAddUsername] = createSignal("");
   const [saving, setSaving] = createSignal(false);
   const [error, setError] = createSignal("");
   const [confirmDeleteValue, setConfirmDeleteValue] = createSignal("");
-  const [activeSection, setActiveSection] = createSignal<"general" | "members" | "requests">("general");
+  const [webhooks, setWebhooks] = createSignal<any[]>([]);
+  const [webhookName, setWebhookName] = createSignal("");
+  // URL of a just-created webhook; the token is only shown once
+  const [newWebhookURL, setNewWebhookURL] = createSignal("");
+  const [activeSection, setActiveSection] = createSignal<"general" | "members" | "requests" | "webhooks">("general");
 
   createEffect(() => {
     if (props.open) {
@@ -39,11 +49,16 @@ export default function ChannelSettingsModal(props: ChannelSettingsModalProps) {
         setChannelName(ch.name);
         setChannelDesc(ch.description || "");
         setChannelVis(ch.visibility);
+        setAnnouncement(!!ch.announcement);
+        setAllowAttachments(ch.allow_attachments !== false);
+        setAllowLinks(ch.allow_links !== false);
       }
       setError("");
       setActiveSection("general");
       getChannelMembers(props.channelId).then(setMembers).catch(() => {});
       getAccessRequests(props.channelId).then(setRequests).catch(() => {});
+      setNewWebhookURL("");
+      getChannelWebhooks(props.channelId).then(setWebhooks).catch(() => {});
     }
   });
 
@@ -55,7 +70,16 @@ export default function ChannelSettingsModal(props: ChannelSettingsModalProps) {
         name: channelName(),
         description: channelDesc(),
         visibility: channelVis(),
+        announcement: announcement(),
       });
+      const ch = channels().find(c => c.id === props.channelId);
+      if (ch && (allowAttachments() !== (ch.allow_attachments !== false) || allowLinks() !== (ch.allow_links !== false))) {
+        send("set_channel_restrictions", {
+          channel_id: props.channelId,
+          allow_attachments: allowAttachments(),
+          allow_links: allowLinks(),
+        });
+      }
     } catch (e: any) {
       setError(e.message || "Failed to save");
     } finally {
@@ -119,6 +143,29 @@ export default function ChannelSettingsModal(props: ChannelSettingsModalProps) {
     }
   };
 
+  const handleCreateWebhook = async () => {
+    const name = webhookName().trim();
+    if (!name) return;
+    setError("");
+    try {
+      const hook = await createChannelWebhook(props.channelId, name);
+      setWebhookName("");
+      setNewWebhookURL(`${window.location.origin}/api/v1/webhooks/${hook.id}/${hook.token}`);
+      setWebhooks(prev => [hook, ...prev]);
+    } catch (e: any) {
+      setError(e.message || "Failed to create webhook");
+    }
+  };
+
+  const handleDeleteWebhook = async (webhookId: string) => {
+    try {
+      await deleteChannelWebhook(props.channelId, webhookId);
+      setWebhooks(prev => prev.filter(w => w.id !== webhookId));
+    } catch (e: any) {
+      setError(e.message || "Failed to revoke webhook");
+    }
+  };
+
   const sectionHeaderStyle = {
     "font-family": "var(--font-display)",
     "font-size": "11px",
@@ -242,6 +289,9 @@ export default function ChannelSettingsModal(props: ChannelSettingsModalProps) {
                 <span style={{ color: "var(--accent)", "margin-left": "4px" }}>({requests().length})</span>
               </Show>
             </button>
+            <button style={tabStyle(activeSection() === "webhooks")} onClick={() => setActiveSection("webhooks")}>
+              Webhooks
+            </button>
           </div>
 
           {/* Content */}
@@ -295,6 +345,52 @@ export default function ChannelSettingsModal(props: ChannelSettingsModalProps) {
                 </select>
               </div>
 
+              <div style={{ "margin-bottom": "16px" }}>
+                <label style={{
+                  display: "flex",
+                  "align-items": "center",
+                  gap: "6px",
+                  "font-size": "11px",
+                  color: "var(--text-muted)",
+                  cursor: "pointer",
+                }}>
+                  <input
+                    type="checkbox"
+                    checked={announcement()}
+                    onChange={(e) => setAnnouncement(e.currentTarget.checked)}
+                    style={{ cursor: "pointer" }}
+                  />
+                  Announcement channel (only managers post, everyone can react)
+                </label>
+              </div>
+
+              <div style={{ "margin-bottom": "16px" }}>
+                <For each={[
+                  { label: "Allow attachments", get: allowAttachments, set: setAllowAttachments },
+                  { label: "Allow links", get: allowLinks, set: setAllowLinks },
+                ]}>
+                  {(opt) => (
+                    <label style={{
+                      display: "flex",
+                      "align-items": "center",
+                      gap: "6px",
+                      "font-size": "11px",
+                      color: "var(--text-muted)",
+                      cursor: "pointer",
+                      "margin-bottom": "4px",
+                    }}>
+                      <input
+                        type="checkbox"
+                        checked={opt.get()}
+                        onChange={(e) => opt.set(e.currentTarget.checked)}
+                        style={{ cursor: "pointer" }}
+                      />
+                      {opt.label}
+                    </label>
+                  )}
+                </For>
+              </div>
+
               <button
                 onClick={handleSave}
                 disabled={saving()}
@@ -515,6 +611,75 @@ export default function ChannelSettingsModal(props: ChannelSettingsModalProps) {
                 )}
               </For>
             </Show>
+
+            {/* Webhooks Section */}
+            <Show when={activeSection() === "webhooks"}>
+              <div style={sectionHeaderStyle}>Incoming Webhooks</div>
+              <div style={{ "font-size": "11px", color: "var(--text-muted)", "margin-bottom": "8px" }}>
+                POST {"{"}"content": "...", "username": "optional"{"}"} to a webhook URL to post here.
+              </div>
+
+              <div style={{ display: "flex", gap: "8px", "margin-bottom": "12px" }}>
+                <input
+                  type="text"
+                  placeholder="Webhook name..."
+                  value={webhookName()}
+                  onInput={(e) => setWebhookName(e.currentTarget.value)}
+                  onKeyDown={(e) => { if (e.key === "Enter") handleCreateWebhook(); }}
+                  style={{ ...inputStyle, flex: "1" }}
+                />
+                <button onClick={handleCreateWebhook} style={actionBtnStyle}>
+                  [create]
+                </button>
+              </div>
+
+              <Show when={newWebhookURL()}>
+                <div style={{ "font-size": "11px", color: "var(--text-muted)", "margin-bottom": "4px" }}>
+                  Copy this URL now; it won't be shown again.
+                </div>
+                <input
+                  type="text"
+                  readOnly
+                  value={newWebhookURL()}
+                  onFocus={(e) => e.currentTarget.select()}
+                  style={{ ...inputStyle, "margin-bottom": "12px" }}
+                />
+              </Show>
+
+              <For each={webhooks()} fallback={
+                <div style={{ "font-size": "12px", color: "var(--text-muted)" }}>No webhooks</div>
+              }>
+                {(hook) => (
+                  <div style={{
+                    display: "flex",
+                    "align-items": "center",
+                    gap: "8px",
+                    padding: "6px 0",
+                    "border-bottom": "1px solid rgba(201, 168, 76, 0.1)",
+                    "font-size": "12px",
+                  }}>
+                    <span style={{ flex: "1", color: "var(--text-primary)" }}>
+                      {hook.name}
+                    </span>
+                    <span style={{ "font-size": "10px", color: "var(--text-muted)" }}>
+                      {new Date(hook.created_at).toLocaleDateString()}
+                    </span>
+                    <button
+                      onClick={() => handleDeleteWebhook(hook.id)}
+                      style={{
+                        "font-size": "10px",
+                        color: "var(--danger)",
+                        background: "none",
+                        border: "none",
+                        cursor: "pointer",
+                      }}
+                    >
+                      [revoke]
+                    </button>
+                  </div>
+                )}
+              </For>
+            </Show>
           </div>
         </div>
       </div>
@@ -1,5 +1,6 @@
-import { onMount, onCleanup } from "solid-js";
+import { createSignal, onMount, onCleanup } from "solid-js";
 import { send } from "../../lib/ws";
+import { getClientConfig } from "../../lib/api";
 
 const EMOJI_LIST = [
   "👍", "👎", "❤️", "😂", "😮", "😢", "🔥", "🎉", "👀", "🙏",
@@ -13,6 +14,11 @@ interface EmojiPickerProps {
 
 export default function EmojiPicker(props: EmojiPickerProps) {
   let ref: HTMLDivElement | undefined;
+  // A server with allowed_reactions set only accepts those
+  const [emojiList, setEmojiList] = createSignal(EMOJI_LIST);
+  getClientConfig().then((cfg) => {
+    if (cfg?.allowed_reactions?.length) setEmojiList(cfg.allowed_reactions);
+  });
 
   const handleClickOutside = (e: MouseEvent) => {
     if (ref && !ref.contains(e.target as Node)) {
@@ -53,7 +59,7 @@ export default function EmojiPicker(props: EmojiPickerProps) {
         gap: "2px",
         "box-shadow": "0 2px 8px rgba(0,0,0,0.4)",
       }}>
-      {EMOJI_LIST.map((emoji) => (
+      {emojiList().map((emoji) => (
         <button
           onClick={(e) => {
             e.stopPropagation();
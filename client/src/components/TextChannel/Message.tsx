@@ -6,7 +6,7 @@ import { lookupUsername, onlineUsers, allUsers } from "../../stores/users";
 import { send } from "../../lib/ws";
 import { isMobile } from "../../stores/responsive";
 import { openLightbox } from "../../stores/lightbox";
-import { starMessage, unstarMessage } from "../../lib/api";
+import { starMessage, unstarMessage, getReplyChain } from "../../lib/api";
 import ReactionBar from "./ReactionBar";
 import ThreadIndicator from "./ThreadIndicator";
 import EmojiPicker from "./EmojiPicker";
@@ -43,10 +43,34 @@ function usernameColor(userId: string): string {
   return USERNAME_COLORS[Math.abs(hash) % USERNAME_COLORS.length];
 }
 
+// Hidden until clicked; used for ||spoiler|| text
+function Spoiler(props: { children: any }) {
+  const [revealed, setRevealed] = createSignal(false);
+  return (
+    <span
+      onClick={(e) => {
+        if (revealed()) return;
+        e.stopPropagation();
+        setRevealed(true);
+      }}
+      title={revealed() ? undefined : "Spoiler — click to reveal"}
+      style={{
+        "background-color": revealed() ? "var(--bg-tertiary)" : "var(--text-muted)",
+        color: revealed() ? "inherit" : "transparent",
+        cursor: revealed() ? "auto" : "pointer",
+        padding: "0 2px",
+        "user-select": revealed() ? "auto" : "none",
+      }}
+    >
+      {props.children}
+    </span>
+  );
+}
+
 // Render content with mention highlighting and clickable links
 function renderMarkdownLine(text: string): any {
-  // Process inline markdown: **bold**, *italic*, mentions, URLs
-  const tokenRe = /\*\*(.+?)\*\*|\*(.+?)\*|`(.+?)`|<@([0-9a-fA-F-]{36})>|(https?:\/\/[^\s<>"'`]+)|(\/[\w\-\/]+\.md)/g;
+  // Process inline markdown: ||spoiler||, **bold**, *italic*, mentions, URLs
+  const tokenRe = /\|\|(.+?)\|\||\*\*(.+?)\*\*|\*(.+?)\*|`(.+?)`|<@([0-9a-fA-F-]{36})>|(https?:\/\/[^\s<>"'`|]+)|(\/[\w\-\/]+\.md)/g;
   const result: any[] = [];
   let lastIndex = 0;
   let m: RegExpExecArray | null;
@@ -57,25 +81,28 @@ function renderMarkdownLine(text: string): any {
     }
 
     if (m[1]) {
-      // **bold**
-      result.push(<span style={{ "font-weight": "600", color: "var(--text-primary)" }}>{m[1]}</span>);
+      // ||spoiler||
+      result.push(<Spoiler>{renderMarkdownLine(m[1])}</Spoiler>);
     } else if (m[2]) {
-      // *italic*
-      result.push(<span style={{ "font-style": "italic" }}>{m[2]}</span>);
+      // **bold**
+      result.push(<span style={{ "font-weight": "600", color: "var(--text-primary)" }}>{m[2]}</span>);
     } else if (m[3]) {
-      // `code`
-      result.push(<code style={{ "background-color": "var(--bg-tertiary)", padding: "1px 4px", "font-size": "11px" }}>{m[3]}</code>);
+      // *italic*
+      result.push(<span style={{ "font-style": "italic" }}>{m[3]}</span>);
     } else if (m[4]) {
+      // `code`
+      result.push(<code style={{ "background-color": "var(--bg-tertiary)", padding: "1px 4px", "font-size": "11px" }}>{m[4]}</code>);
+    } else if (m[5]) {
       // Mention
-      const name = lookupUsername(m[4]) || "unknown";
+      const name = lookupUsername(m[5]) || "unknown";
       result.push(
         <span style={{ "background-color": "var(--mention-bg)", color: "var(--mention-text)", padding: "0 3px" }}>
           @{name}
         </span>
       );
-    } else if (m[5]) {
+    } else if (m[6]) {
       // URL
-      let url = m[5];
+      let url = m[6];
       let trailing = "";
       while (url.length > 1 && /[.,;:!?)>\]]+$/.test(url)) {
         trailing = url[url.length - 1] + trailing;
@@ -87,9 +114,9 @@ function renderMarkdownLine(text: string): any {
           {url}
         </a>
       );
-    } else if (m[6]) {
+    } else if (m[7]) {
       // Document path link
-      const docPath = m[6];
+      const docPath = m[7];
       result.push(
         <span
           onClick={(e) => {
@@ -118,7 +145,7 @@ function renderMarkdownLine(text: string): any {
   return result.length > 0 ? result : text;
 }
 
-function renderContent(content: string): any {
+export function renderContent(content: string): any {
   const lines = content.split("\n");
   const result: any[] = [];
 
@@ -239,6 +266,14 @@ export default function MessageItem(props: MessageProps) {
     send("delete_message", { message_id: props.message.id });
   };
 
+  // Admins can remove a message outright, attachments included, instead of
+  // leaving a tombstone
+  const handlePurge = () => {
+    if (confirm("Permanently delete this message and its attachments? Replies will lose their quote.")) {
+      send("delete_message", { message_id: props.message.id, purge: true });
+    }
+  };
+
   const isOwn = () => currentUser()?.id === props.message.author.id;
 
   const canDelete = () => {
@@ -332,6 +367,20 @@ export default function MessageItem(props: MessageProps) {
               );
             }
           }}
+          onMouseEnter={(e) => {
+            // Show the whole reply chain as a tooltip, fetched once
+            const el = e.currentTarget;
+            if (el.dataset.chainLoaded) return;
+            el.dataset.chainLoaded = "1";
+            getReplyChain(props.message.id)
+              .then((res) => {
+                if (res.chain.length < 2) return;
+                el.title = res.chain
+                  .map((c) => (c.deleted ? "[message was deleted]" : `${c.author.username}: ${c.content ?? "[attachment]"}`))
+                  .join("\n") + (res.complete ? "" : "\n...");
+              })
+              .catch(() => {});
+          }}
           style={{
             display: "flex",
             "align-items": "baseline",
@@ -430,23 +479,38 @@ export default function MessageItem(props: MessageProps) {
       <Show when={props.message.attachments.length > 0}>
         <div style={{ "padding-left": "7ch", "margin-top": "2px", display: "flex", "flex-wrap": "wrap", gap: "4px" }}>
           <For each={props.message.attachments}>
-            {(att) => (
-              <img
-                src={att.thumb_url || att.url}
-                alt={att.filename}
-                onClick={(e) => {
-                  e.stopPropagation();
-                  openLightbox(att.url);
-                }}
-                style={{
-                  "max-width": "400px",
-                  "max-height": "300px",
-                  "border-radius": "2px",
-                  border: "1px solid var(--border-gold)",
-                  cursor: "pointer",
-                }}
-              />
-            )}
+            {(att) => {
+              const [hidden, setHidden] = createSignal(!!att.spoiler);
+              return (
+                <img
+                  src={att.thumb_url || att.url}
+                  alt={att.filename}
+                  title={
+                    hidden()
+                      ? "Spoiler — click to reveal"
+                      : att.download_count !== undefined
+                        ? `${att.filename} — ${att.download_count} download${att.download_count === 1 ? "" : "s"}`
+                        : undefined
+                  }
+                  onClick={(e) => {
+                    e.stopPropagation();
+                    if (hidden()) {
+                      setHidden(false);
+                      return;
+                    }
+                    openLightbox(att.url, att.download_url);
+                  }}
+                  style={{
+                    "max-width": "400px",
+                    "max-height": "300px",
+                    "border-radius": "2px",
+                    border: "1px solid var(--border-gold)",
+                    cursor: "pointer",
+                    filter: hidden() ? "blur(24px)" : undefined,
+                  }}
+                />
+              );
+            }}
           </For>
         </div>
       </Show>
@@ -670,6 +734,19 @@ export default function MessageItem(props: MessageProps) {
               [del]
             </button>
           </Show>
+          <Show when={currentUser()?.is_admin}>
+            <button
+              onClick={handlePurge}
+              title="Purge (no tombstone)"
+              style={{
+                padding: "2px 6px",
+                "font-size": "11px",
+                color: "var(--danger)",
+              }}
+            >
+              [purge]
+            </button>
+          </Show>
         </div>
       </Show>
     </div>
@@ -16,6 +16,7 @@ interface MessageInputProps {
 type PendingAttachment = {
   id: string;
   previewUrl: string;
+  spoiler?: boolean;
 };
 
 export default function MessageInput(props: MessageInputProps) {
@@ -156,6 +157,10 @@ export default function MessageInput(props: MessageInputProps) {
       content: content || null,
       reply_to_id: replyingTo()?.id || null,
       attachment_ids: atts.map((a) => a.id),
+      spoiler_attachment_ids: atts.filter((a) => a.spoiler).map((a) => a.id),
+      // Lets the server drop a duplicate if this send is retried.
+      // randomUUID needs a secure context, so fall back on plain http.
+      nonce: crypto.randomUUID?.() ?? `${Date.now().toString(36)}-${Math.random().toString(36).slice(2)}`,
     });
 
     // Cleanup preview URLs
@@ -237,6 +242,10 @@ export default function MessageInput(props: MessageInputProps) {
     setAttachments((prev) => prev.filter((a) => a.id !== id));
   };
 
+  const toggleSpoiler = (id: string) => {
+    setAttachments((prev) => prev.map((a) => (a.id === id ? { ...a, spoiler: !a.spoiler } : a)));
+  };
+
   const handleDrop = (e: DragEvent) => {
     e.preventDefault();
     setDragActive(false);
@@ -368,8 +377,26 @@ export default function MessageInput(props: MessageInputProps) {
                     "border-radius": "2px",
                     border: "1px solid var(--border-gold)",
                     display: "block",
+                    filter: att.spoiler ? "blur(8px)" : undefined,
                   }}
                 />
+                <button
+                  onClick={() => toggleSpoiler(att.id)}
+                  title="Mark as spoiler"
+                  style={{
+                    position: "absolute",
+                    bottom: "2px",
+                    left: "2px",
+                    "font-size": "9px",
+                    padding: "0 3px",
+                    "background-color": "var(--bg-primary)",
+                    color: att.spoiler ? "var(--accent)" : "var(--text-muted)",
+                    border: "1px solid var(--border-gold)",
+                    cursor: "pointer",
+                  }}
+                >
+                  {att.spoiler ? "[spoiler]" : "[show]"}
+                </button>
                 <button
                   onClick={() => removeAttachment(att.id)}
                   style={{
@@ -107,10 +107,8 @@ export default function MessageList(props: MessageListProps) {
     setLoading(true);
     try {
       const msgs = await getMessagesAround(channelId, messageId);
-      // API returns newest first, reverse for display
-      const reversed = [...msgs].reverse();
-      mergeKnownUsers(reversed.map((m: any) => m.author));
-      setMessages(channelId, reversed);
+      mergeKnownUsers(msgs.map((m: any) => m.author));
+      setMessages(channelId, msgs);
       setHasMore(true); // There may be more messages above/below
       // Wait for DOM to update, then scroll
       requestAnimationFrame(() => scrollAndHighlight(messageId));
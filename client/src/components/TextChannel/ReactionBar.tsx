@@ -1,7 +1,24 @@
-import { For } from "solid-js";
+import { For, createSignal } from "solid-js";
 import type { Message } from "../../stores/messages";
 import { currentUser } from "../../stores/auth";
 import { send } from "../../lib/ws";
+import { getReactionUsers } from "../../lib/api";
+
+// How many names the hover tooltip spells out before "and N others"
+const TOOLTIP_NAMES = 3;
+
+function reactorsLabel(names: string[], count: number, emoji: string): string {
+  const others = count - names.length;
+  let who: string;
+  if (others > 0) {
+    who = `${names.join(", ")} and ${others} other${others === 1 ? "" : "s"}`;
+  } else if (names.length > 1) {
+    who = `${names.slice(0, -1).join(", ")} and ${names[names.length - 1]}`;
+  } else {
+    who = names[0] ?? "";
+  }
+  return `${who} reacted with ${emoji}`;
+}
 
 interface ReactionBarProps {
   message: Message;
@@ -29,8 +46,22 @@ export default function ReactionBar(props: ReactionBarProps) {
               ? reaction.user_ids.includes(currentUser()!.id)
               : false;
 
+          // Names load on first hover and again once the count has moved
+          const [title, setTitle] = createSignal("");
+          let loadedCount = -1;
+          const loadTitle = () => {
+            const count = reaction.count;
+            if (count === loadedCount) return;
+            loadedCount = count;
+            getReactionUsers(props.message.id, reaction.emoji, TOOLTIP_NAMES)
+              .then((res) => setTitle(reactorsLabel(res.users.map((u) => u.username), res.count, reaction.emoji)))
+              .catch(() => { loadedCount = -1; });
+          };
+
           return (
             <button
+              title={title()}
+              onMouseEnter={loadTitle}
               onClick={(e) => { e.stopPropagation(); toggleReaction(reaction.emoji); }}
               style={{
                 display: "inline-flex",
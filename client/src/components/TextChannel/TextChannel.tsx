@@ -1,4 +1,4 @@
-import { Show, onMount, onCleanup, createSignal } from "solid-js";
+import { Show, onMount, onCleanup, createSignal, createEffect } from "solid-js";
 import { channels, channelSettingsId, setChannelSettingsId } from "../../stores/channels";
 import { currentUser } from "../../stores/auth";
 import { currentVoiceChannelId } from "../../stores/voice";
@@ -6,7 +6,7 @@ import { leaveVoice } from "../../lib/webrtc";
 import { isMobile, setSidebarOpen } from "../../stores/responsive";
 import { send } from "../../lib/ws";
 import { threadPanelOpen, setThreadPanelOpen, setThreadPanelTab } from "../../stores/messages";
-import { requestChannelAccess } from "../../lib/api";
+import { requestChannelAccess, getChannelMute, setChannelMute } from "../../lib/api";
 import MessageList from "./MessageList";
 import MessageInput from "./MessageInput";
 import ThreadPanel from "./ThreadPanel";
@@ -18,8 +18,33 @@ interface TextChannelProps {
 
 export default function TextChannel(props: TextChannelProps) {
   const channel = () => channels().find((c) => c.id === props.channelId);
+  // Announcement channels only take messages from managers and admins
+  const canPost = () => {
+    const ch = channel();
+    const user = currentUser();
+    if (!ch?.announcement) return true;
+    return !!user && (user.is_admin || ch.manager_ids.includes(user.id));
+  };
   const [accessRequested, setAccessRequested] = createSignal(false);
   const [accessError, setAccessError] = createSignal("");
+  const [muted, setMuted] = createSignal(false);
+
+  createEffect(() => {
+    const id = props.channelId;
+    setMuted(false);
+    getChannelMute(id)
+      .then((res) => { if (id === props.channelId) setMuted(res.muted); })
+      .catch(() => {});
+  });
+
+  const toggleMute = async () => {
+    try {
+      const res = await setChannelMute(props.channelId, !muted());
+      setMuted(res.muted);
+    } catch {
+      // Leave the toggle as it was
+    }
+  };
   let glitchRef: HTMLSpanElement | undefined;
   let glitchTimer: number | undefined;
 
@@ -101,6 +126,15 @@ export default function TextChannel(props: TextChannelProps) {
               [disconnect]
             </button>
           </Show>
+          <Show when={channel()?.visibility === "public" || channel()?.is_member}>
+            <button
+              onClick={toggleMute}
+              title={muted() ? "Muted: no mention emails from this channel" : "Mute mention emails from this channel"}
+              style={{ color: muted() ? "var(--accent)" : "var(--text-muted)", background: "none", border: "none", cursor: "pointer", "font-size": "12px" }}
+            >
+              {muted() ? "[muted]" : "[mute]"}
+            </button>
+          </Show>
           <button
             onClick={() => { setThreadPanelTab("docs"); setThreadPanelOpen(true); }}
             style={{ color: "var(--text-muted)", background: "none", border: "none", cursor: "pointer", "font-size": "12px" }}
@@ -140,7 +174,13 @@ export default function TextChannel(props: TextChannelProps) {
         <div style={{ display: "flex", flex: "1", overflow: "hidden" }}>
           <div style={{ flex: "1", display: "flex", "flex-direction": "column", overflow: "hidden" }}>
             <MessageList channelId={props.channelId} />
-            <MessageInput channelId={props.channelId} channelName={channel()?.name || ""} />
+            <Show when={canPost()} fallback={
+              <div style={{ padding: "8px 12px", "font-size": "11px", color: "var(--text-muted)", "border-top": "1px solid var(--border-gold)" }}>
+                Only channel managers can post here
+              </div>
+            }>
+              <MessageInput channelId={props.channelId} channelName={channel()?.name || ""} />
+            </Show>
           </div>
           <ThreadPanel channelId={props.channelId} channelName={channel()?.name || ""} send={(op, data) => send(op, data)} />
         </div>
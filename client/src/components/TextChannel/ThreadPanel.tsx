@@ -8,7 +8,7 @@ import {
   openThread,
   setScrollToMessageId,
 } from "../../stores/messages";
-import { getThreadMessages, getChannelThreads, getStarredMessages, starMessage, unstarMessage, listDocs, getDoc, putDoc, deleteDoc } from "../../lib/api";
+import { getThreadMessages, getChannelThreads, getStarredMessages, getMentions, starMessage, unstarMessage, listDocs, getDoc, putDoc, deleteDoc } from "../../lib/api";
 import { channels, setSelectedChannelId } from "../../stores/channels";
 import { lookupUsername, onlineUsers, allUsers } from "../../stores/users";
 import { currentUser } from "../../stores/auth";
@@ -55,6 +55,8 @@ export default function ThreadPanel(props: { channelId: string; channelName: str
   const [loading, setLoading] = createSignal(false);
   const [alsoSendToChannel, setAlsoSendToChannel] = createSignal(false);
   const [starredIds, setStarredIds] = createSignal<Set<string>>(new Set());
+  const [mentionMessages, setMentionMessages] = createSignal<any[]>([]);
+  const [mentionsHasMore, setMentionsHasMore] = createSignal(false);
   const [channelThreads, setChannelThreads] = createSignal<any[]>([]);
   const [panelWidth, setPanelWidth] = createSignal(400);
   const [docsList, setDocsList] = createSignal<any[]>([]);
@@ -186,6 +188,26 @@ export default function ThreadPanel(props: { channelId: string; channelName: str
     }
   });
 
+  // Fetch mentions when Mentions tab opens
+  createEffect(() => {
+    if (threadPanelTab() === "mentions" && threadPanelOpen()) {
+      getMentions()
+        .then((msgs) => {
+          setMentionMessages(msgs);
+          setMentionsHasMore(msgs.length === 50);
+        })
+        .catch(() => {});
+    }
+  });
+
+  const loadMoreMentions = async () => {
+    const msgs = mentionMessages();
+    if (msgs.length === 0) return;
+    const older = await getMentions(msgs[msgs.length - 1].id);
+    setMentionMessages([...msgs, ...older]);
+    setMentionsHasMore(older.length === 50);
+  };
+
   // Fetch channel threads when Threads tab opens
   createEffect(() => {
     if (threadPanelTab() === "threads" && threadPanelOpen()) {
@@ -317,6 +339,36 @@ export default function ThreadPanel(props: { channelId: string; channelName: str
     localStorage.removeItem("docEditMode");
   };
 
+  // Open a starred or mentioned message where it lives
+  const jumpToMessage = (msg: any) => {
+    // Switch to the correct channel first
+    if (msg.channel_id) {
+      setSelectedChannelId(msg.channel_id);
+    }
+
+    if (msg.thread_id) {
+      // Message is in a thread — open thread and scroll to this message
+      const rootId = msg.thread_id;
+      openThread(rootId);
+      // Highlight the specific message after thread loads
+      setTimeout(() => {
+        const el = document.querySelector(`[data-message-id="${msg.id}"]`);
+        if (el) {
+          el.scrollIntoView({ behavior: "smooth", block: "center" });
+          el.animate(
+            [{ backgroundColor: "rgba(201,168,76,0.15)" }, { backgroundColor: "transparent" }],
+            { duration: 1500 }
+          );
+        }
+      }, 500);
+    } else {
+      // Standalone message — scroll to it in main feed
+      setThreadPanelOpen(false);
+      // Give time for channel switch to render
+      setTimeout(() => setScrollToMessageId(msg.id), 300);
+    }
+  };
+
   const toggleStar = async (messageId: string) => {
     if (starredIds().has(messageId)) {
       await unstarMessage(messageId);
@@ -424,6 +476,25 @@ export default function ThreadPanel(props: { channelId: string; channelName: str
             >
               Starred
             </button>
+            <button
+              onClick={() => setThreadPanelTab("mentions")}
+              style={{
+                "font-family": "var(--font-display)",
+                "font-size": "11px",
+                "letter-spacing": "1px",
+                "text-transform": "uppercase",
+                color: threadPanelTab() === "mentions" ? "var(--accent)" : "var(--text-muted)",
+                background: "none",
+                border: "none",
+                "border-bottom-width": "2px",
+                "border-bottom-style": "solid",
+                "border-bottom-color": threadPanelTab() === "mentions" ? "var(--accent)" : "transparent",
+                padding: "4px 0",
+                cursor: "pointer",
+              }}
+            >
+              Mentions
+            </button>
             <button
               onClick={() => setThreadPanelTab("docs")}
               style={{
@@ -711,36 +782,7 @@ export default function ThreadPanel(props: { channelId: string; channelName: str
                   padding: "8px 0",
                   cursor: "pointer",
                 }}>
-                  <div
-                    onClick={() => {
-                      // Switch to the correct channel first
-                      if (msg.channel_id) {
-                        setSelectedChannelId(msg.channel_id);
-                      }
-
-                      if (msg.thread_id) {
-                        // Message is in a thread — open thread and scroll to this message
-                        const rootId = msg.thread_id;
-                        openThread(rootId);
-                        // Highlight the specific message after thread loads
-                        setTimeout(() => {
-                          const el = document.querySelector(`[data-message-id="${msg.id}"]`);
-                          if (el) {
-                            el.scrollIntoView({ behavior: "smooth", block: "center" });
-                            el.animate(
-                              [{ backgroundColor: "rgba(201,168,76,0.15)" }, { backgroundColor: "transparent" }],
-                              { duration: 1500 }
-                            );
-                          }
-                        }, 500);
-                      } else {
-                        // Standalone message — scroll to it in main feed
-                        setThreadPanelOpen(false);
-                        // Give time for channel switch to render
-                        setTimeout(() => setScrollToMessageId(msg.id), 300);
-                      }
-                    }}
-                  >
+                  <div onClick={() => jumpToMessage(msg)}>
                     <div style={{ display: "flex", "justify-content": "space-between", "align-items": "center" }}>
                       <span style={{ "font-size": "12px", color: "var(--text-primary)" }}>
                         {msg.author_username || "unknown"}
@@ -778,6 +820,61 @@ export default function ThreadPanel(props: { channelId: string; channelName: str
           </div>
         </Show>
 
+        {/* Mentions tab — messages mentioning me, across channels */}
+        <Show when={threadPanelTab() === "mentions"}>
+          <div style={{ flex: "1", overflow: "auto", padding: "8px 12px" }}>
+            <Show when={mentionMessages().length === 0}>
+              <div style={{ color: "var(--text-muted)", "font-size": "11px", "font-style": "italic", padding: "12px 0" }}>
+                No mentions.
+              </div>
+            </Show>
+            <For each={mentionMessages()}>
+              {(msg) => (
+                <div
+                  onClick={() => jumpToMessage(msg)}
+                  style={{
+                    "border-bottom": "1px solid rgba(201,168,76,0.1)",
+                    padding: "8px 0",
+                    cursor: "pointer",
+                  }}
+                >
+                  <div style={{ display: "flex", "justify-content": "space-between", "align-items": "center" }}>
+                    <span style={{ "font-size": "12px", color: "var(--text-primary)" }}>
+                      {msg.author?.username || "unknown"}
+                    </span>
+                    <span style={{ "font-size": "10px", color: "var(--text-muted)" }}>
+                      #{msg.channel_name} · {new Date(msg.created_at).toLocaleDateString()}
+                    </span>
+                  </div>
+                  <div style={{ "font-size": "11px", color: "var(--text-secondary)", "margin-top": "2px" }}>
+                    {msg.content ? stripMentions(msg.content).slice(0, 100) + (msg.content.length > 100 ? "..." : "") : "[attachment]"}
+                  </div>
+                  <Show when={msg.thread_id}>
+                    <div style={{ "font-size": "10px", color: "var(--cyan)", "margin-top": "2px" }}>
+                      In thread
+                    </div>
+                  </Show>
+                </div>
+              )}
+            </For>
+            <Show when={mentionsHasMore()}>
+              <button
+                onClick={loadMoreMentions}
+                style={{
+                  "font-size": "11px",
+                  color: "var(--accent)",
+                  background: "none",
+                  border: "none",
+                  padding: "8px 0",
+                  cursor: "pointer",
+                }}
+              >
+                [load more]
+              </button>
+            </Show>
+          </div>
+        </Show>
+
         {/* Docs tab */}
         <Show when={threadPanelTab() === "docs"}>
           <div style={{ flex: "1", overflow: "auto", padding: "8px 12px", display: "flex", "flex-direction": "column" }}>
@@ -5,6 +5,7 @@ import { onlineUsers } from "../../stores/users";
 import { currentUser } from "../../stores/auth";
 import { isMobile, setSidebarOpen } from "../../stores/responsive";
 import VoiceUser from "./VoiceUser";
+import VoiceChat from "./VoiceChat";
 import { joinVoice, leaveVoice } from "../../lib/webrtc";
 
 interface VoiceChannelProps {
@@ -15,6 +16,11 @@ export default function VoiceChannel(props: VoiceChannelProps) {
   const channel = () => channels().find((c) => c.id === props.channelId);
   const usersInChannel = () => getUsersInVoiceChannel(props.channelId);
   const isConnected = () => currentVoiceChannelId() === props.channelId;
+  const canManage = () => {
+    const ch = channel();
+    const user = currentUser();
+    return !!ch && !!user && (user.is_admin || ch.manager_ids.includes(user.id));
+  };
   let glitchRef: HTMLSpanElement | undefined;
   let glitchTimer: number | undefined;
 
@@ -161,6 +167,7 @@ export default function VoiceChannel(props: VoiceChannelProps) {
                   <VoiceUser
                     username={user()!.username}
                     voiceState={vs}
+                    canManage={canManage()}
                   />
                 </Show>
               );
@@ -230,6 +237,9 @@ export default function VoiceChannel(props: VoiceChannelProps) {
           );
         }}
       </Show>
+
+      {/* In-call text chat */}
+      <VoiceChat channelId={props.channelId} />
     </div>
   );
 }
@@ -0,0 +1,108 @@
+import { createSignal, createEffect, onCleanup, For, Show } from "solid-js";
+import { messagesByChannel } from "../../stores/messages";
+import { getUsernameById } from "../../stores/users";
+import { send } from "../../lib/ws";
+import { getTypingUsers, onTypingChange } from "../../lib/events";
+import { renderContent } from "../TextChannel/Message";
+
+interface VoiceChatProps {
+  channelId: string;
+}
+
+// In-call text chat for a voice channel. Messages are ordinary channel
+// messages; ready seeds the recent tail and message_create appends.
+export default function VoiceChat(props: VoiceChatProps) {
+  const [draft, setDraft] = createSignal("");
+  const messages = () => (messagesByChannel()[props.channelId] || []).filter((m) => !m.deleted);
+  let listRef: HTMLDivElement | undefined;
+  let typingTimeout: number | null = null;
+
+  // Who's typing in the call. Typing state is per channel, and the call's
+  // typing_start arrives whichever channel is selected.
+  const [typing, setTyping] = createSignal<string[]>([]);
+  onCleanup(onTypingChange(() => setTyping(getTypingUsers(props.channelId))));
+  createEffect(() => setTyping(getTypingUsers(props.channelId)));
+
+  createEffect(() => {
+    messages().length;
+    if (listRef) listRef.scrollTop = listRef.scrollHeight;
+  });
+
+  const submit = () => {
+    const content = draft().trim();
+    if (!content) return;
+    send("send_message", { channel_id: props.channelId, content });
+    setDraft("");
+  };
+
+  return (
+    <div
+      style={{
+        "border-top": "1px solid var(--border-gold)",
+        display: "flex",
+        "flex-direction": "column",
+        "max-height": "40%",
+        "min-height": "120px",
+      }}
+    >
+      <div
+        ref={listRef}
+        style={{
+          flex: "1",
+          overflow: "auto",
+          padding: "8px 16px",
+          "font-size": "12px",
+        }}
+      >
+        <Show
+          when={messages().length > 0}
+          fallback={<div style={{ color: "var(--text-muted)" }}>// no messages in this call yet</div>}
+        >
+          <For each={messages()}>
+            {(msg) => (
+              <div style={{ padding: "1px 0", "word-break": "break-word" }}>
+                <span style={{ color: "var(--accent)", "font-weight": "600", "margin-right": "6px" }}>
+                  {msg.author.username}
+                </span>
+                <span style={{ color: "var(--text-secondary)" }}>
+                  {msg.content ? renderContent(msg.content) : ""}
+                </span>
+              </div>
+            )}
+          </For>
+        </Show>
+      </div>
+      <Show when={typing().length > 0}>
+        <div style={{ padding: "0 16px 4px", "font-size": "11px", color: "var(--text-muted)" }}>
+          {typing().map(getUsernameById).join(", ")} typing...
+        </div>
+      </Show>
+      <input
+        value={draft()}
+        onInput={(e) => setDraft(e.currentTarget.value)}
+        onKeyDown={(e) => {
+          if (e.key === "Enter" && !e.shiftKey) {
+            e.preventDefault();
+            submit();
+            return;
+          }
+          if (!typingTimeout) {
+            send("typing_start", { channel_id: props.channelId });
+            typingTimeout = window.setTimeout(() => {
+              typingTimeout = null;
+            }, 3000);
+          }
+        }}
+        placeholder="message the call..."
+        style={{
+          margin: "0 16px 8px",
+          padding: "6px 8px",
+          "font-size": "12px",
+          "background-color": "var(--bg-primary)",
+          border: "1px solid var(--border-gold)",
+          color: "var(--text-primary)",
+        }}
+      />
+    </div>
+  );
+}
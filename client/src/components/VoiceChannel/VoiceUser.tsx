@@ -1,10 +1,12 @@
 import type { VoiceState } from "../../stores/voice";
 import { getAudioSourceForUser } from "../../stores/voice";
 import { isMobile } from "../../stores/responsive";
+import { send } from "../../lib/ws";
 
 interface VoiceUserProps {
   username: string;
   voiceState: VoiceState;
+  canManage?: boolean;
 }
 
 export default function VoiceUser(props: VoiceUserProps) {
@@ -13,6 +15,15 @@ export default function VoiceUser(props: VoiceUserProps) {
     props.voiceState.self_mute || props.voiceState.server_mute;
   const isDeafened = () => props.voiceState.self_deafen;
   const sharedAudio = () => getAudioSourceForUser(props.voiceState.user_id);
+  const isPriority = () => !!props.voiceState.priority_speaker;
+
+  // Granting priority takes it from whoever held it; an empty user_id clears it
+  const togglePriority = () => {
+    send("voice_priority_speaker", {
+      channel_id: props.voiceState.channel_id,
+      user_id: isPriority() ? "" : props.voiceState.user_id,
+    });
+  };
 
   return (
     <div
@@ -64,6 +75,11 @@ export default function VoiceUser(props: VoiceUserProps) {
           </span>
         )}
         {isDeafened() && <span style={{ color: "var(--danger)" }} title="Deafened">[DEAF]</span>}
+        {isPriority() && (
+          <span style={{ color: "var(--accent)" }} title="Priority speaker">
+            [♛]
+          </span>
+        )}
         {sharedAudio() && (
           <span
             style={{ color: "var(--accent)" }}
@@ -73,6 +89,23 @@ export default function VoiceUser(props: VoiceUserProps) {
           </span>
         )}
       </div>
+
+      {props.canManage && (
+        <button
+          onClick={togglePriority}
+          title={isPriority() ? "Remove priority speaker" : "Make priority speaker"}
+          style={{
+            "font-size": "10px",
+            color: "var(--text-muted)",
+            background: "none",
+            border: "none",
+            cursor: "pointer",
+            padding: "0",
+          }}
+        >
+          {isPriority() ? "[unprioritize]" : "[prioritize]"}
+        </button>
+      )}
     </div>
   );
 }
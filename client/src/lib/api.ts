@@ -26,6 +26,52 @@ async function request(path: string, opts: RequestInit = {}) {
   return res.json();
 }
 
+export type ClientConfig = {
+  registration_mode: "open" | "approval" | "closed";
+  email_verification: boolean;
+  allowed_reactions: string[]; // empty allows any emoji
+  features: { email: boolean; magic_links: boolean; voice: boolean; captcha: boolean };
+  limits: {
+    max_message_length: number;
+    max_edit_length: number;
+    max_upload_bytes: number;
+    max_mentions: number;
+    max_reaction_emojis: number;
+    max_reactions_per_user: number;
+    max_ws_message_bytes: number;
+  };
+};
+
+// Fetched once per page load; null if the server predates /config.
+let clientConfig: Promise<ClientConfig | null> | null = null;
+
+export function getClientConfig(): Promise<ClientConfig | null> {
+  if (!clientConfig) {
+    clientConfig = fetch(`${BASE}/config`)
+      .then((res) => (res.ok ? res.json() : null))
+      .catch(() => null);
+  }
+  return clientConfig;
+}
+
+export type ICEServersResponse = {
+  ice_servers: RTCIceServer[];
+  ttl: number; // seconds the TURN credentials stay valid
+};
+
+export function getICEServers(): Promise<ICEServersResponse> {
+  return request("/voice/ice-servers");
+}
+
+export interface ServerBrandingResponse {
+  server_name: string;
+  icon_url: string | null;
+}
+
+export function getServerInfo(): Promise<ServerBrandingResponse> {
+  return request("/server/info");
+}
+
 export function getChannels() {
   return request("/channels");
 }
@@ -36,9 +82,9 @@ export function getMessages(channelId: string, before?: string) {
   return request(`/channels/${channelId}/messages?${params}`);
 }
 
-export function getMessagesAround(channelId: string, messageId: string) {
-  const params = new URLSearchParams({ limit: "50", around: messageId });
-  return request(`/channels/${channelId}/messages?${params}`);
+// The target message with up to limit/2 on each side, oldest first.
+export function getMessagesAround(channelId: string, messageId: string, limit = 50) {
+  return request(`/channels/${channelId}/messages/around/${messageId}?limit=${limit}`);
 }
 
 export function getAudioDevices(): Promise<{
@@ -72,6 +118,16 @@ export function getUsers(): Promise<
   return request("/admin/users");
 }
 
+export function getMembers(after?: string, limit = 100): Promise<{
+  users: { id: string; username: string; avatar_url: string | null; is_admin: boolean }[];
+  total: number;
+  next: string | null;
+}> {
+  const params = new URLSearchParams({ limit: String(limit) });
+  if (after) params.set("after", after);
+  return request(`/users?${params}`);
+}
+
 export function deleteUser(id: string) {
   return request(`/admin/users/${id}`, { method: "DELETE" });
 }
@@ -80,6 +136,13 @@ export function approveUser(id: string) {
   return request(`/admin/users/${id}/approve`, { method: "POST" });
 }
 
+export function rejectUser(id: string, reason?: string) {
+  return request(`/admin/users/${id}/reject`, {
+    method: "POST",
+    body: JSON.stringify({ reason: reason || "" }),
+  });
+}
+
 export function setUserAdmin(id: string, isAdmin: boolean) {
   return request(`/admin/users/${id}/admin`, {
     method: "POST",
@@ -108,7 +171,24 @@ export function updateEmail(email: string) {
   });
 }
 
+export function getMentionEmail(): Promise<{ enabled: boolean }> {
+  return request("/auth/mention-email");
+}
+
+export function setMentionEmail(enabled: boolean): Promise<{ enabled: boolean }> {
+  return request("/auth/mention-email", {
+    method: "POST",
+    body: JSON.stringify({ enabled }),
+  });
+}
+
 export async function uploadFile(file: File) {
+  // Fail fast rather than sending a file the server will refuse
+  const cfg = await getClientConfig();
+  if (cfg && file.size > cfg.limits.max_upload_bytes) {
+    const mb = Math.floor(cfg.limits.max_upload_bytes / (1024 * 1024));
+    throw new Error(`file is larger than the ${mb} MB upload limit`);
+  }
   const form = new FormData();
   form.append("file", file);
   const token = getToken();
@@ -164,35 +244,42 @@ function getAudioDuration(file: File): Promise<number> {
 export async function uploadRadioTrack(
   playlistId: string,
   file: File,
-  onStatus?: (phase: "processing" | "uploading") => void,
+  onStatus?: (phase: "processing" | "uploading", percent?: number) => void,
 ) {
   onStatus?.("processing");
   const [duration, peaks] = await Promise.all([
     getAudioDuration(file),
-    computePeaksFromFile(file).catch(() => null),
+    computePeaksFromFile(file, 200).catch(() => null),
   ]);
-  onStatus?.("uploading");
+  onStatus?.("uploading", 0);
   const form = new FormData();
   form.append("file", file);
   form.append("duration", duration.toString());
   if (peaks) {
     form.append("waveform", serializePeaks(peaks));
   }
+  // XHR rather than fetch for upload progress. Anything the browser
+  // couldn't compute, the server fills in after responding and announces
+  // with radio_playlist_tracks.
   const token = getToken();
-  const res = await fetch(`${BASE}/radio/playlists/${playlistId}/tracks`, {
-    method: "POST",
-    headers: { Authorization: `Bearer ${token}` },
-    body: form,
+  return new Promise<any>((resolve, reject) => {
+    const xhr = new XMLHttpRequest();
+    xhr.open("POST", `${BASE}/radio/playlists/${playlistId}/tracks`);
+    xhr.setRequestHeader("Authorization", `Bearer ${token}`);
+    xhr.responseType = "json";
+    xhr.upload.onprogress = (e) => {
+      if (e.lengthComputable) onStatus?.("uploading", Math.round((e.loaded / e.total) * 100));
+    };
+    xhr.onload = () => {
+      if (xhr.status >= 200 && xhr.status < 300) {
+        resolve(xhr.response);
+      } else {
+        reject(new Error(xhr.response?.error || "upload failed"));
+      }
+    };
+    xhr.onerror = () => reject(new Error("upload failed"));
+    xhr.send(form);
   });
-  if (!res.ok) {
-    const data = await res.json().catch(() => ({ error: "upload failed" }));
-    throw new Error(data.error);
-  }
-  return res.json();
-}
-
-export async function deleteRadioTrack(trackId: string) {
-  return request(`/radio/tracks/${trackId}`, { method: "DELETE" });
 }
 
 export function getEmailSettings(): Promise<{
@@ -297,7 +384,50 @@ export function getStarredMessages(): Promise<any[]> {
   return request("/stars");
 }
 
-export function updateChannelSettings(channelId: string, data: { name?: string; description?: string; visibility?: string }) {
+export function getMentions(before?: string): Promise<any[]> {
+  const params = new URLSearchParams({ limit: "50" });
+  if (before) params.set("before", before);
+  return request(`/mentions?${params}`);
+}
+
+// Reply ancestors of a message, nearest first.
+export function getReplyChain(messageId: string, depth = 5): Promise<{
+  message_id: string;
+  chain: { id: string; author: { id: string; username: string }; content: string | null; deleted: boolean }[];
+  complete: boolean;
+}> {
+  return request(`/messages/${messageId}/context?depth=${depth}`);
+}
+
+// Who reacted to a message with emoji, earliest first; pass next back as
+// after for the following page.
+export function getReactionUsers(messageId: string, emoji: string, limit = 50, after?: string): Promise<{
+  message_id: string;
+  emoji: string;
+  count: number;
+  users: { id: string; username: string; avatar_url: string | null }[];
+  next: string | null;
+}> {
+  const params = new URLSearchParams({ limit: String(limit) });
+  if (after) params.set("after", after);
+  return request(`/messages/${messageId}/reactions/${encodeURIComponent(emoji)}?${params}`);
+}
+
+export function getNotifications(before?: string): Promise<any[]> {
+  const params = new URLSearchParams({ limit: "50" });
+  if (before) params.set("before", before);
+  return request(`/notifications?${params}`);
+}
+
+export function clearNotifications(): Promise<{ deleted: number }> {
+  return request("/notifications", { method: "DELETE" });
+}
+
+export function deleteNotification(id: string) {
+  return request(`/notifications/${id}`, { method: "DELETE" });
+}
+
+export function updateChannelSettings(channelId: string, data: { name?: string; description?: string; visibility?: string; announcement?: boolean }) {
   return request(`/channels/${channelId}/settings`, { method: "PATCH", body: JSON.stringify(data) });
 }
 
@@ -321,6 +451,15 @@ export function requestChannelAccess(channelId: string) {
   return request(`/channels/${channelId}/request-access`, { method: "POST" });
 }
 
+// Muted channels still notify in-app but send no mention emails
+export function getChannelMute(channelId: string): Promise<{ muted: boolean }> {
+  return request(`/channels/${channelId}/mute`);
+}
+
+export function setChannelMute(channelId: string, muted: boolean): Promise<{ muted: boolean }> {
+  return request(`/channels/${channelId}/mute`, { method: muted ? "PUT" : "DELETE" });
+}
+
 export function getAccessRequests(channelId: string): Promise<any[]> {
   return request(`/channels/${channelId}/access-requests`);
 }
@@ -333,6 +472,18 @@ export function denyAccessRequest(channelId: string, requestId: string) {
   return request(`/channels/${channelId}/access-requests/${requestId}/deny`, { method: "POST" });
 }
 
+export function getChannelWebhooks(channelId: string): Promise<any[]> {
+  return request(`/channels/${channelId}/webhooks`);
+}
+
+export function createChannelWebhook(channelId: string, name: string): Promise<any> {
+  return request(`/channels/${channelId}/webhooks`, { method: "POST", body: JSON.stringify({ name }) });
+}
+
+export function deleteChannelWebhook(channelId: string, webhookId: string) {
+  return request(`/channels/${channelId}/webhooks/${webhookId}`, { method: "DELETE" });
+}
+
 export function listDocs(channelId: string, prefix?: string): Promise<any[]> {
   const params = new URLSearchParams();
   if (prefix) params.set("prefix", prefix);
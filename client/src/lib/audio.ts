@@ -8,10 +8,22 @@ type UserAudioNode = {
   analyser: AnalyserNode;
   volume: number; // 0.0 - 2.0
   localMuted: boolean;
+  userId: string; // "" when the stream isn't tagged with a user
 };
 
 let audioContext: AudioContext | null = null;
 const userNodes = new Map<string, UserAudioNode>();
+// While the priority speaker talks (voice_ducking), everyone else plays
+// at duckGain
+let duckingUserId: string | null = null;
+let duckGain = 1;
+let incomingMuted = false; // deafened
+
+function effectiveVolume(node: UserAudioNode): number {
+  if (node.localMuted || incomingMuted) return 0;
+  const gain = duckingUserId && node.userId !== duckingUserId ? duckGain : 1;
+  return Math.min(node.volume * gain, 1.0);
+}
 
 function getAudioContext(): AudioContext {
   if (!audioContext) {
@@ -20,7 +32,7 @@ function getAudioContext(): AudioContext {
   return audioContext;
 }
 
-export function setupAudioPipeline(stream: MediaStream, trackId: string) {
+export function setupAudioPipeline(stream: MediaStream, trackId: string, userId = "") {
   // Clean up existing node for this track (renegotiation sends ontrack again)
   const existing = userNodes.get(trackId);
   if (existing) {
@@ -60,13 +72,16 @@ export function setupAudioPipeline(stream: MediaStream, trackId: string) {
   source.connect(analyser);
   // Do NOT connect analyser to destination — <audio> element handles playback
 
-  userNodes.set(trackId, {
+  const node: UserAudioNode = {
     audio,
     source,
     analyser,
     volume: s.masterVolume,
     localMuted: false,
-  });
+    userId,
+  };
+  audio.volume = effectiveVolume(node);
+  userNodes.set(trackId, node);
 }
 
 export function cleanupTrack(trackId: string) {
@@ -87,38 +102,53 @@ export function cleanupAudioPipeline() {
     node.analyser.disconnect();
   });
   userNodes.clear();
+  duckingUserId = null;
+  duckGain = 1;
+  incomingMuted = false;
 }
 
 export function setUserVolume(trackId: string, volume: number) {
   const node = userNodes.get(trackId);
   if (!node) return;
   node.volume = volume;
-  if (!node.localMuted) {
-    node.audio.volume = Math.min(volume, 1.0);
-  }
+  node.audio.volume = effectiveVolume(node);
 }
 
 export function setUserLocalMute(trackId: string, muted: boolean) {
   const node = userNodes.get(trackId);
   if (!node) return;
   node.localMuted = muted;
-  node.audio.volume = muted ? 0 : Math.min(node.volume, 1.0);
+  node.audio.volume = effectiveVolume(node);
 }
 
 export function setAllIncomingGain(multiplier: number) {
+  incomingMuted = multiplier === 0;
   userNodes.forEach((node) => {
-    if (!node.localMuted) {
-      node.audio.volume = multiplier === 0 ? 0 : Math.min(node.volume, 1.0);
-    }
+    node.audio.volume = effectiveVolume(node);
+  });
+}
+
+// Attenuate everyone but userId to gain, or restore them when active is
+// false. The SFU forwards Opus untouched, so ducking happens here.
+export function setDucking(userId: string, active: boolean, gain: number) {
+  if (active) {
+    duckingUserId = userId;
+    duckGain = gain;
+  } else if (duckingUserId === userId) {
+    duckingUserId = null;
+    duckGain = 1;
+  } else {
+    return;
+  }
+  userNodes.forEach((node) => {
+    node.audio.volume = effectiveVolume(node);
   });
 }
 
 export function applyMasterVolume(volume: number) {
   userNodes.forEach((node) => {
     node.volume = volume;
-    if (!node.localMuted) {
-      node.audio.volume = Math.min(volume, 1.0);
-    }
+    node.audio.volume = effectiveVolume(node);
   });
 }
 
@@ -1,4 +1,4 @@
-import { onMessage, send, type WSMessage } from "./ws";
+import { onMessage, send, deferReconnect, type WSMessage } from "./ws";
 import { setUser, currentUser } from "../stores/auth";
 import {
   setChannelList,
@@ -12,13 +12,16 @@ import {
   selectedChannelId,
   setUnreadCounts,
   incrementUnread,
+  sendViewChannel,
 } from "../stores/channels";
 import {
   addMessage,
+  setMessages,
   updateMessage,
   deleteMessage,
   addReaction,
   removeReaction,
+  applyReactionUpdate,
   setMessageUnfurls,
   addThreadMessage,
   updateThreadSummary,
@@ -26,10 +29,15 @@ import {
 import {
   setOnlineUserList,
   setAllUserList,
+  loadRemainingUsers,
   addOnlineUser,
   removeOnlineUser,
   addAllUser,
+  updateUser,
   mergeKnownUsers,
+  myStatus,
+  setUserStatus,
+  setOnlineCount,
 } from "../stores/users";
 import {
   setVoiceStateList,
@@ -44,18 +52,22 @@ import {
   setAudioSourceList,
   addAudioSource,
   removeAudioSource,
+  setVoiceAudio,
+  setVoiceEndpoints,
 } from "../stores/voice";
-import { setNotificationList, addNotification } from "../stores/notifications";
+import { setNotificationList, addNotification, removeNotifications, clearNotificationList } from "../stores/notifications";
 import {
   setEnabledFeatures,
   toggleFeature,
 } from "../stores/strudel";
 import { handleWebRTCOffer, handleWebRTCICE, joinVoice, resetVoiceState } from "./webrtc";
-import { handleScreenOffer, handleScreenICE, unsubscribeScreenShare, resetScreenShareState } from "./screenshare";
+import { setDucking } from "./audio";
+import { handleScreenOffer, handleScreenICE, handleScreenShareQuality, unsubscribeScreenShare, resetScreenShareState } from "./screenshare";
 import { playJoinSound, playLeaveSound } from "./sounds";
 import { isDesktop } from "./devices";
 import { dispatchReady, dispatchEvent } from "./appletRegistry";
 import { showMentionNotification } from "./browserNotify";
+import { setServerBranding, loadServerBranding } from "../stores/server";
 
 // Ensure all applets register before events are dispatched
 import "../applets";
@@ -182,19 +194,42 @@ export function initEventHandlers() {
   // Set up desktop voice event listeners (Rust → Frontend)
   initDesktopVoiceEvents();
 
+  document.addEventListener("visibilitychange", sendViewChannel);
+
   return onMessage((msg: WSMessage) => {
     switch (msg.op) {
       case "ready":
         setUser(msg.d.user);
         setChannelList(msg.d.channels);
         setOnlineUserList(msg.d.online_users);
+        setOnlineCount(msg.d.online_count ?? msg.d.online_users.length + 1);
         setAllUserList(msg.d.all_users || []);
+        loadRemainingUsers(msg.d.users_next || null);
+        if (myStatus() !== "online") send("set_status", { status: myStatus() });
+        sendViewChannel();
         mergeKnownUsers([msg.d.user]);
         setVoiceStateList(msg.d.voice_states || []);
         setNotificationList(msg.d.notifications || []);
         setScreenShares(msg.d.screen_shares || []);
         setAudioSourceList(msg.d.audio_sources || []);
+        if (msg.d.voice_audio) setVoiceAudio(msg.d.voice_audio);
+        setVoiceEndpoints(msg.d.voice_endpoints ?? []);
         setDeletedChannels(msg.d.deleted_channels || []);
+        loadServerBranding();
+        // Recent in-call chat per voice channel
+        for (const [channelId, msgs] of Object.entries(msg.d.voice_chat || {})) {
+          setMessages(
+            channelId,
+            (msgs as any[]).map((m) => ({
+              ...m,
+              reactions: m.reactions || [],
+              mentions: m.mentions || [],
+              attachments: m.attachments || [],
+              edited_at: m.edited_at || null,
+              thread_id: m.thread_id || null,
+            })),
+          );
+        }
         if (msg.d.unread_counts) {
           setUnreadCounts(msg.d.unread_counts);
         }
@@ -244,7 +279,8 @@ export function initEventHandlers() {
           msg.d.id,
           msg.d.channel_id,
           msg.d.content,
-          msg.d.edited_at
+          msg.d.edited_at,
+          msg.d.entities
         );
         break;
 
@@ -264,6 +300,10 @@ export function initEventHandlers() {
         removeReaction(msg.d.message_id, msg.d.user_id, msg.d.emoji);
         break;
 
+      case "reaction_update":
+        applyReactionUpdate(msg.d.message_id, msg.d.emoji, msg.d.count, msg.d.added_by, msg.d.removed_by);
+        break;
+
       case "typing_start": {
         const { channel_id, user_id } = msg.d;
         if (!typingState[channel_id]) typingState[channel_id] = {};
@@ -302,14 +342,32 @@ export function initEventHandlers() {
         addOnlineUser(msg.d.user);
         break;
 
+      case "users_online_bulk":
+        for (const u of msg.d.users) addOnlineUser(u);
+        break;
+
       case "user_offline":
         removeOnlineUser(msg.d.user_id);
         break;
 
+      case "online_count":
+        setOnlineCount(msg.d.count);
+        break;
+
+      case "presence_update":
+        setUserStatus(msg.d.user_id, msg.d.status);
+        break;
+
       case "user_approved":
         addAllUser(msg.d.user);
         break;
 
+      // Our own change arrives too, just before the server drops this
+      // connection so the reconnect's ready carries the new permissions
+      case "user_update":
+        updateUser(msg.d.user);
+        break;
+
       case "voice_state_update": {
         const myId = currentUser()?.id;
         const myChannel = currentVoiceChannelId();
@@ -327,6 +385,38 @@ export function initEventHandlers() {
         break;
       }
 
+      case "voice_ducking":
+        // The priority speaker started or stopped talking
+        setDucking(msg.d.user_id, msg.d.active, msg.d.gain);
+        break;
+
+      case "voice_kicked":
+        // A channel manager removed us from voice; the WS stays up
+        console.log("[voice] Kicked from voice channel", msg.d.channel_id);
+        resetScreenShareState();
+        resetVoiceState();
+        break;
+
+      case "voice_idle_disconnect":
+        // Muted (or alone) and silent past the server's idle timeout
+        console.log("[voice] Disconnected for inactivity from", msg.d.channel_id);
+        resetScreenShareState();
+        resetVoiceState();
+        break;
+
+      case "server_shutdown": {
+        // Hang up locally before the server drops our peer, but keep the
+        // channel so ready rejoins it once the server is back
+        const channelId = currentVoiceChannelId();
+        resetScreenShareState();
+        resetVoiceState();
+        if (channelId) sessionStorage.setItem("voice_channel", channelId);
+        setVoiceStateList([]);
+        setScreenShares([]);
+        deferReconnect(msg.d?.reconnect_after_seconds ?? 5);
+        break;
+      }
+
       case "voice_taken_over":
         // Another device took over voice — reset local voice and screen share
         // state without sending messages to server (server already handled it)
@@ -374,13 +464,28 @@ export function initEventHandlers() {
         handleScreenICE(msg.d.candidate, msg.d.role);
         break;
 
+      case "server_update":
+        setServerBranding({ server_name: msg.d.server_name, icon_url: msg.d.icon_url ?? null });
+        break;
+
+      case "screen_share_quality":
+        if (msg.d.user_id === currentUser()?.id) {
+          handleScreenShareQuality(msg.d.max_bitrate, msg.d.scale_down);
+        }
+        break;
+
       case "screen_share_error":
         console.error("[screen] Share rejected:", msg.d.error);
         break;
 
+      case "error":
+        console.warn(`[ws] ${msg.d.op} rejected (${msg.d.code}): ${msg.d.message}`);
+        break;
+
       case "notification_create":
         addNotification(msg.d);
-        if (msg.d.type === "mention") {
+        // Silent when we're in do-not-disturb: keep the row, skip the popup
+        if ((msg.d.type === "mention" || msg.d.type === "reply") && !msg.d.silent) {
           showMentionNotification(
             msg.d.data.author_username,
             msg.d.data.channel_name,
@@ -390,6 +495,11 @@ export function initEventHandlers() {
         }
         break;
 
+      case "notifications_deleted":
+        if (msg.d.all) clearNotificationList();
+        else removeNotifications(msg.d.ids || []);
+        break;
+
       case "feature_toggled":
         toggleFeature(msg.d.feature, msg.d.enabled);
         break;
@@ -0,0 +1,65 @@
+// STUN/TURN servers for browser peer connections, from the server so the
+// browser relays through the same TURN as the SFU. TURN credentials are
+// short-lived, so the list is refetched before it expires.
+
+import { getICEServers } from "./api";
+
+// Used until the first fetch succeeds, or if the server can't be reached
+const fallbackServers: RTCIceServer[] = [{ urls: "stun:stun.l.google.com:19302" }];
+
+// Fraction of the credential lifetime after which the list is refetched
+const refreshAt = 0.8;
+// Wait before trying again after a failed fetch
+const retryMs = 30_000;
+
+let servers: RTCIceServer[] = fallbackServers;
+let refreshDue = 0;
+let inflight: Promise<RTCIceServer[]> | null = null;
+let lifetimeMs = 0;
+
+/** Fetch the ICE servers unless the cached list is still fresh. */
+export function loadIceServers(): Promise<RTCIceServer[]> {
+  if (Date.now() < refreshDue) return Promise.resolve(servers);
+  if (!inflight) {
+    inflight = getICEServers()
+      .then((res) => {
+        servers = res.ice_servers.length > 0 ? res.ice_servers : fallbackServers;
+        lifetimeMs = res.ttl * 1000;
+        refreshDue = Date.now() + lifetimeMs * refreshAt;
+        return servers;
+      })
+      .catch((err) => {
+        console.warn("[ice] Failed to fetch ICE servers, using last known:", err);
+        refreshDue = Date.now() + retryMs;
+        return servers;
+      })
+      .finally(() => {
+        inflight = null;
+      });
+  }
+  return inflight;
+}
+
+/** The last fetched ICE servers, for creating a peer connection synchronously. */
+export function iceServers(): RTCIceServer[] {
+  return servers;
+}
+
+/**
+ * Keep pc's TURN credentials valid for as long as it is open by refetching
+ * them before they expire. Stops once pc is closed.
+ */
+export function keepIceServersFresh(pc: RTCPeerConnection) {
+  if (lifetimeMs <= 0) return;
+  window.setTimeout(async () => {
+    if (pc.signalingState === "closed") return;
+    const fresh = await loadIceServers();
+    if (pc.signalingState === "closed") return;
+    try {
+      pc.setConfiguration({ ...pc.getConfiguration(), iceServers: fresh });
+    } catch (err) {
+      console.warn("[ice] Failed to apply refreshed ICE servers:", err);
+    }
+    keepIceServersFresh(pc);
+  }, Math.max(1000, refreshDue - Date.now()));
+}
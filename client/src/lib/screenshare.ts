@@ -8,11 +8,15 @@ import {
   watchingScreenShare,
 } from "../stores/voice";
 import { isDesktop, tauriInvoke } from "./devices";
+import { iceServers, keepIceServersFresh, loadIceServers } from "./ice";
 
 let screenPC: RTCPeerConnection | null = null;
 let screenStream: MediaStream | null = null;
 let previewStream: MediaStream | null = null;
 let isPresenting = false;
+// Sender settings from screen_share_quality. The SFU caps bitrate with REMB
+// but forwards frames as they come, so only the presenter can scale down.
+let qualityProfile: { maxBitrate: number; scaleDown: number } | null = null;
 
 export function getIsPresenting() {
   return isPresenting;
@@ -65,6 +69,9 @@ export async function startScreenShare() {
     };
   }
 
+  // After getDisplayMedia, which needs the click's user activation
+  await loadIceServers();
+
   isPresenting = true;
   // Clone stream for preview so display and WebRTC encoder don't contend for frames
   previewStream = screenStream.clone();
@@ -75,6 +82,7 @@ export async function startScreenShare() {
 export function stopScreenShare() {
   if (!isPresenting) return;
   isPresenting = false;
+  qualityProfile = null;
 
   // Send WS stop BEFORE closing the peer connection to avoid race
   // where SFU sees PC disconnect and cleans up before the WS message arrives
@@ -108,7 +116,9 @@ export function stopScreenShare() {
   }
 }
 
-export function subscribeScreenShare(channelId: string) {
+export async function subscribeScreenShare(channelId: string) {
+  // The SFU's offer follows the subscribe; have the relays ready for it
+  await loadIceServers();
   send("screen_share_subscribe", { channel_id: channelId });
 }
 
@@ -140,9 +150,8 @@ export async function handleScreenOffer(sdp: string, role?: string) {
 
   // Browser: create RTCPeerConnection
   if (!screenPC) {
-    screenPC = new RTCPeerConnection({
-      iceServers: [{ urls: "stun:stun.l.google.com:19302" }],
-    });
+    screenPC = new RTCPeerConnection({ iceServers: iceServers() });
+    keepIceServersFresh(screenPC);
 
     screenPC.onicecandidate = (event) => {
       if (event.candidate) {
@@ -162,17 +171,7 @@ export async function handleScreenOffer(sdp: string, role?: string) {
       screenStream.getTracks().forEach((track) => {
         const sender = screenPC!.addTrack(track, screenStream!);
         if (track.kind === "video") {
-          // Set max bitrate for sharp screen content
-          try {
-            const params = sender.getParameters();
-            if (!params.encodings || params.encodings.length === 0) {
-              params.encodings = [{}];
-            }
-            params.encodings[0].maxBitrate = 6_000_000; // 6 Mbps
-            sender.setParameters(params);
-          } catch (e) {
-            console.warn("[screen] setParameters failed:", e);
-          }
+          applyScreenQuality(sender);
         }
       });
 
@@ -206,6 +205,30 @@ export async function handleScreenOffer(sdp: string, role?: string) {
   });
 }
 
+/** Apply the server's quality preset to our video sender, if presenting. */
+export function handleScreenShareQuality(maxBitrate: number, scaleDown: number) {
+  qualityProfile = { maxBitrate, scaleDown };
+  const sender = screenPC?.getSenders().find((s) => s.track?.kind === "video");
+  if (isPresenting && sender) applyScreenQuality(sender);
+}
+
+function applyScreenQuality(sender: RTCRtpSender) {
+  try {
+    const params = sender.getParameters();
+    if (!params.encodings || params.encodings.length === 0) {
+      params.encodings = [{}];
+    }
+    // Until the server says otherwise, 6 Mbps for sharp screen content
+    params.encodings[0].maxBitrate = qualityProfile?.maxBitrate ?? 6_000_000;
+    params.encodings[0].scaleResolutionDownBy = qualityProfile?.scaleDown ?? 1;
+    sender.setParameters(params).catch((e) => {
+      console.warn("[screen] setParameters failed:", e);
+    });
+  } catch (e) {
+    console.warn("[screen] setParameters failed:", e);
+  }
+}
+
 export function handleScreenICE(candidate: RTCIceCandidateInit, role?: string) {
   if (isDesktop && isPresenting) {
     // Desktop presenter: forward ICE to Rust
@@ -234,6 +257,7 @@ export function handleScreenICE(candidate: RTCIceCandidateInit, role?: string) {
 export function resetScreenShareState() {
   if (!isPresenting) return;
   isPresenting = false;
+  qualityProfile = null;
 
   if (isDesktop) {
     setDesktopPresenting(false);
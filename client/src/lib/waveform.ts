@@ -36,13 +36,14 @@ export async function computePeaksFromFile(
   return computePeaksFromBuffer(buf, numBars);
 }
 
+// Stored waveforms are 0-100 ints, the format the server computes
 export function serializePeaks(peaks: Float32Array): string {
-  const arr = Array.from(peaks, (v) => Math.round(v * 100) / 100);
+  const arr = Array.from(peaks, (v) => Math.round(v * 100));
   return JSON.stringify(arr);
 }
 
 export function deserializePeaks(json: string): Float32Array {
-  return new Float32Array(JSON.parse(json));
+  return new Float32Array(JSON.parse(json).map((v: number) => v / 100));
 }
 
 async function computePeaksFromBuffer(
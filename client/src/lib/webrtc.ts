@@ -1,10 +1,11 @@
 import { send } from "./ws";
-import { setJoinedVoiceChannel, setVoiceStats } from "../stores/voice";
+import { setJoinedVoiceChannel, setVoiceStats, voiceAudio, voiceEndpoints } from "../stores/voice";
 import { setupAudioPipeline, cleanupAudioPipeline, cleanupTrack, setAllIncomingGain } from "./audio";
 import { startSpeakingDetection, stopSpeakingDetection, isDesktop, tauriInvoke } from "./devices";
 import { playJoinSound, playLeaveSound } from "./sounds";
 import { settings } from "../stores/settings";
 import { attachPendingShareIfAny, resetAudioShareState } from "./audioShare";
+import { iceServers, keepIceServersFresh, loadIceServers } from "./ice";
 
 let peerConnection: RTCPeerConnection | null = null;
 let localStream: MediaStream | null = null;
@@ -80,6 +81,16 @@ function stopStatsPolling() {
   setVoiceStats(null);
 }
 
+// The preferred endpoint only counts if this server still offers it, and
+// only when the call isn't already running somewhere.
+function joinVoicePayload(channelId: string) {
+  const endpoint = settings().voiceEndpoint;
+  if (endpoint && voiceEndpoints().includes(endpoint)) {
+    return { channel_id: channelId, endpoint };
+  }
+  return { channel_id: channelId };
+}
+
 export async function joinVoice(channelId: string) {
   // Leave current voice first
   if (peerConnection || desktopVoiceActive) {
@@ -106,7 +117,7 @@ export async function joinVoice(channelId: string) {
     sessionStorage.setItem("voice_channel", channelId);
     playJoinSound();
     setJoinedVoiceChannel(channelId);
-    send("join_voice", { channel_id: channelId });
+    send("join_voice", joinVoicePayload(channelId));
     return;
   }
 
@@ -154,10 +165,13 @@ export async function joinVoice(channelId: string) {
   // Start speaking detection on local stream
   startSpeakingDetection(localStream);
 
+  // The SFU's offer follows join_voice; have the relays ready for it
+  await loadIceServers();
+
   sessionStorage.setItem("voice_channel", channelId);
   playJoinSound();
   setJoinedVoiceChannel(channelId);
-  send("join_voice", { channel_id: channelId });
+  send("join_voice", joinVoicePayload(channelId));
 }
 
 export function leaveVoice() {
@@ -222,25 +236,23 @@ export async function handleWebRTCOffer(sdp: string) {
   // Create new peer connection if needed
   if (!peerConnection) {
     try {
-      peerConnection = new RTCPeerConnection({
-        iceServers: [{ urls: "stun:stun.l.google.com:19302" }],
-      });
+      peerConnection = new RTCPeerConnection({ iceServers: iceServers() });
     } catch (err) {
       console.error("[voice] Failed to create RTCPeerConnection:", err);
       return;
     }
     console.log("[voice] PeerConnection created");
+    keepIceServersFresh(peerConnection);
 
-    // Add local audio track with 128kbps bitrate
+    // Add local audio track, capped at the server's voice bitrate
     localStream.getAudioTracks().forEach((track) => {
       console.log("[voice] Adding local track:", track.label, "enabled:", track.enabled);
       const sender = peerConnection!.addTrack(track, localStream!);
-      // Set max bitrate to 128kbps
       const params = sender.getParameters();
       if (!params.encodings || params.encodings.length === 0) {
         params.encodings = [{}];
       }
-      params.encodings[0].maxBitrate = 128000;
+      params.encodings[0].maxBitrate = voiceAudio().bitrate;
       sender.setParameters(params).catch(() => {});
     });
 
@@ -256,7 +268,9 @@ export async function handleWebRTCOffer(sdp: string) {
         console.log("[voice] ontrack: no streams, creating MediaStream from track");
         stream = new MediaStream([track]);
       }
-      setupAudioPipeline(stream, track.id);
+      // The SFU tags mic streams with the sender's user ID, so ducking
+      // can spare the priority speaker
+      setupAudioPipeline(stream, track.id, stream.id);
 
       // Clean up when the remote track ends (peer left / renegotiation replaced it)
       track.onended = () => {
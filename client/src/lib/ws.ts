@@ -88,6 +88,12 @@ function scheduleReconnect(token: string) {
   }, reconnectDelay);
 }
 
+// deferReconnect makes the next reconnect attempt wait at least seconds,
+// used when the server announces it is shutting down.
+export function deferReconnect(seconds: number) {
+  reconnectDelay = Math.max(reconnectDelay, seconds * 1000);
+}
+
 export function disconnectWS() {
   intentionalDisconnect = true;
   if (reconnectTimer) {
@@ -7,6 +7,7 @@ export type User = {
   email?: string | null;
   is_admin: boolean;
   has_password?: boolean;
+  status?: string;
 };
 
 const [currentUser, setCurrentUser] = createSignal<User | null>(null);
@@ -1,4 +1,5 @@
 import { createSignal } from "solid-js";
+import { send } from "../lib/ws";
 
 export type Channel = {
   id: string;
@@ -10,6 +11,9 @@ export type Channel = {
   is_member: boolean;
   role: string | null;
   manager_ids: string[];
+  announcement?: boolean; // only managers and admins can post
+  allow_attachments?: boolean; // messages with attachments refused when false
+  allow_links?: boolean; // messages with links refused when false
 };
 
 const [channels, setChannels] = createSignal<Channel[]>([]);
@@ -26,6 +30,14 @@ function setSelectedChannelId(id: string | null) {
   } else {
     localStorage.removeItem("selectedChannelId");
   }
+  sendViewChannel();
+}
+
+// Tell the server which channel we're looking at so typing indicators
+// are only sent to viewers. A hidden tab views nothing.
+export function sendViewChannel() {
+  const id = document.hidden ? null : selectedChannelId();
+  send("view_channel", { channel_id: id || "" });
 }
 
 const [channelSettingsId, setChannelSettingsId] = createSignal<string | null>(null);
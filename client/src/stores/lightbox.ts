@@ -1,13 +1,17 @@
 import { createSignal } from "solid-js";
 
 const [lightboxUrl, setLightboxUrl] = createSignal<string | null>(null);
+// Link that saves the image under its original filename, if there is one
+const [lightboxDownloadUrl, setLightboxDownloadUrl] = createSignal<string | null>(null);
 
-export function openLightbox(url: string) {
+export function openLightbox(url: string, downloadUrl?: string) {
   setLightboxUrl(url);
+  setLightboxDownloadUrl(downloadUrl ?? null);
 }
 
 export function closeLightbox() {
   setLightboxUrl(null);
+  setLightboxDownloadUrl(null);
 }
 
-export { lightboxUrl };
+export { lightboxUrl, lightboxDownloadUrl };
@@ -8,6 +8,9 @@ export type Attachment = {
   mime_type: string;
   width: number | null;
   height: number | null;
+  spoiler?: boolean;
+  download_url?: string; // serves the file under its original filename
+  download_count?: number; // only on your own messages
 };
 
 export type ReactionGroup = {
@@ -23,6 +26,15 @@ export type ReplyTo = {
   deleted?: boolean;
 };
 
+// Server-parsed span of content. start/end are UTF-8 byte offsets.
+export type MessageEntity = {
+  type: "mention" | "url" | "code" | "code_block" | "spoiler";
+  start: number;
+  end: number;
+  user_id?: string;
+  url?: string;
+};
+
 export type Unfurl = {
   url: string;
   site_name: string;
@@ -45,6 +57,7 @@ export type Message = {
   attachments: Attachment[];
   reactions: ReactionGroup[];
   mentions: string[];
+  entities?: MessageEntity[];
   unfurls?: Unfurl[];
   created_at: string;
   edited_at: string | null;
@@ -64,7 +77,7 @@ export { messagesByChannel, replyingTo, setReplyingTo, scrollToMessageId, setScr
 const [threadPanelOpen, _setThreadPanelOpen] = createSignal(localStorage.getItem("panelOpen") === "true");
 const [activeThreadId, _setActiveThreadId] = createSignal<string | null>(localStorage.getItem("activeThreadId"));
 const [threadMessages, setThreadMessages] = createSignal<Message[]>([]);
-const [threadPanelTab, _setThreadPanelTab] = createSignal<"thread" | "threads" | "starred" | "docs">(
+const [threadPanelTab, _setThreadPanelTab] = createSignal<"thread" | "threads" | "starred" | "mentions" | "docs">(
   (localStorage.getItem("panelTab") as any) || "thread"
 );
 
@@ -77,7 +90,7 @@ function setActiveThreadId(v: string | null) {
   if (v) localStorage.setItem("activeThreadId", v);
   else localStorage.removeItem("activeThreadId");
 }
-function setThreadPanelTab(v: "thread" | "threads" | "starred" | "docs") {
+function setThreadPanelTab(v: "thread" | "threads" | "starred" | "mentions" | "docs") {
   _setThreadPanelTab(v);
   localStorage.setItem("panelTab", v);
 }
@@ -131,22 +144,25 @@ export function prependMessages(channelId: string, msgs: Message[]) {
 }
 
 export function addMessage(msg: Message) {
-  setMessagesByChannel((prev) => ({
-    ...prev,
-    [msg.channel_id]: [...(prev[msg.channel_id] || []), msg],
-  }));
+  setMessagesByChannel((prev) => {
+    const existing = prev[msg.channel_id] || [];
+    // A nonce resend echoes a message we may already have
+    if (existing.some((m) => m.id === msg.id)) return prev;
+    return { ...prev, [msg.channel_id]: [...existing, msg] };
+  });
 }
 
 export function updateMessage(
   id: string,
   channelId: string,
   content: string,
-  editedAt: string
+  editedAt: string,
+  entities?: MessageEntity[]
 ) {
   setMessagesByChannel((prev) => ({
     ...prev,
     [channelId]: (prev[channelId] || []).map((m) =>
-      m.id === id ? { ...m, content, edited_at: editedAt } : m
+      m.id === id ? { ...m, content, entities, edited_at: editedAt } : m
     ),
   }));
 }
@@ -156,7 +172,7 @@ export function deleteMessage(id: string, channelId: string, threadId?: string |
     ...prev,
     [channelId]: (prev[channelId] || []).map((m) =>
       m.id === id
-        ? { ...m, deleted: true, content: null, attachments: [], reactions: [], unfurls: [] }
+        ? { ...m, deleted: true, content: null, entities: [], attachments: [], reactions: [], unfurls: [] }
         : m
     ),
   }));
@@ -276,6 +292,35 @@ export function removeReaction(
   });
 }
 
+// applyReactionUpdate applies a merged reaction_update: the server's count
+// for the emoji plus who added and removed it during the burst.
+export function applyReactionUpdate(
+  messageId: string,
+  emoji: string,
+  count: number,
+  addedBy: string[],
+  removedBy: string[]
+) {
+  setMessagesByChannel((prev) => {
+    const updated: Record<string, Message[]> = {};
+    for (const [chId, msgs] of Object.entries(prev)) {
+      updated[chId] = msgs.map((m) => {
+        if (m.id !== messageId) return m;
+        const existing = m.reactions.find((r) => r.emoji === emoji);
+        const userIds = (existing?.user_ids ?? []).filter(
+          (id) => !removedBy.includes(id) && !addedBy.includes(id)
+        );
+        const next = { emoji, count, user_ids: [...userIds, ...addedBy] };
+        const reactions = existing
+          ? m.reactions.map((r) => (r.emoji === emoji ? next : r))
+          : [...m.reactions, next];
+        return { ...m, reactions: reactions.filter((r) => r.count > 0) };
+      });
+    }
+    return updated;
+  });
+}
+
 export function setMessageUnfurls(
   messageId: string,
   channelId: string,
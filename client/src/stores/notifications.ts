@@ -33,3 +33,11 @@ export function markRead(id: string) {
 export function markAllRead() {
   setNotifications((prev) => prev.map((n) => ({ ...n, read: true })));
 }
+
+export function removeNotifications(ids: string[]) {
+  setNotifications((prev) => prev.filter((n) => !ids.includes(n.id)));
+}
+
+export function clearNotificationList() {
+  setNotifications([]);
+}
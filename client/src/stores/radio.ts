@@ -7,6 +7,8 @@ export type RadioStation = {
   position: number;
   playback_mode: string;
   public_controls: boolean;
+  default_volume: number;
+  intro_track_id: string | null;
   manager_ids: string[];
 };
 
@@ -36,6 +38,8 @@ export type RadioPlayback = {
   position: number;
   updated_at: number;
   user_id: string;
+  // track is the station intro, playing ahead of track 0
+  intro?: boolean;
 };
 
 export type RadioStatus = {
@@ -50,6 +54,8 @@ const [radioPlayback, setRadioPlayback] = createSignal<Record<string, RadioPlayb
 const [radioPlaylists, setRadioPlaylists] = createSignal<RadioPlaylist[]>([]);
 const [radioListeners, setRadioListeners] = createSignal<Record<string, string[]>>({});
 const [radioStatus, setRadioStatus] = createSignal<Record<string, RadioStatus>>({});
+// Our own favorite station IDs (private, never broadcast)
+const [radioFavorites, setRadioFavorites] = createSignal<string[]>([]);
 const [tunedStationId, _setTunedStationId] = createSignal<string | null>(
   sessionStorage.getItem("radio_station")
 );
@@ -73,6 +79,8 @@ export {
   setRadioListeners,
   radioStatus,
   setRadioStatus,
+  radioFavorites,
+  setRadioFavorites,
   tunedStationId,
   setTunedStationId,
 };
@@ -89,19 +97,30 @@ export function removeRadioStation(stationId: string) {
   }
 }
 
+export function reorderRadioStationList(ids: string[]) {
+  setRadioStations((prev) => {
+    const order = new Map(ids.map((id, i) => [id, i]));
+    return prev
+      .map((s) => (order.has(s.id) ? { ...s, position: order.get(s.id)! } : s))
+      .sort((a, b) => a.position - b.position);
+  });
+}
+
 export function renameRadioStation(stationId: string, name: string) {
   setRadioStations((prev) =>
     prev.map((s) => (s.id === stationId ? { ...s, name } : s))
   );
 }
 
-export function updateRadioStation(stationId: string, name: string, managerIds: string[], playbackMode?: string, publicControls?: boolean) {
+export function updateRadioStation(stationId: string, name: string, managerIds: string[], playbackMode?: string, publicControls?: boolean, defaultVolume?: number, introTrackId?: string | null) {
   setRadioStations((prev) =>
     prev.map((s) => {
       if (s.id !== stationId) return s;
       const updated = { ...s, name, manager_ids: managerIds };
       if (playbackMode !== undefined) updated.playback_mode = playbackMode;
       if (publicControls !== undefined) updated.public_controls = publicControls;
+      if (defaultVolume !== undefined) updated.default_volume = defaultVolume;
+      if (introTrackId !== undefined) updated.intro_track_id = introTrackId;
       return updated;
     })
   );
@@ -133,6 +152,16 @@ export function updateRadioPlaybackForStation(stationId: string, pb: RadioPlayba
   });
 }
 
+// Applies a radio_position sync. Ignored if it's for a different track
+// than we have (a radio_playback for the change is on its way).
+export function syncRadioPosition(stationId: string, trackIndex: number, position: number, updatedAt: number) {
+  setRadioPlayback((prev) => {
+    const pb = prev[stationId];
+    if (!pb || !pb.playing || pb.track_index !== trackIndex) return prev;
+    return { ...prev, [stationId]: { ...pb, position, updated_at: updatedAt } };
+  });
+}
+
 export function getStationPlayback(stationId: string): RadioPlayback | null {
   return radioPlayback()[stationId] || null;
 }
@@ -0,0 +1,17 @@
+import { createSignal } from "solid-js";
+import { getServerInfo, type ServerBrandingResponse } from "../lib/api";
+
+// Admin-set server name and icon; null until the first load
+const [serverBranding, setServerBranding] = createSignal<ServerBrandingResponse | null>(null);
+
+export { serverBranding, setServerBranding };
+
+// Fetched on every ready so a change made while disconnected shows up
+// after the reconnect; server_update events keep it current after that.
+export async function loadServerBranding() {
+  try {
+    setServerBranding(await getServerInfo());
+  } catch {
+    // Keep whatever was shown last
+  }
+}
@@ -6,6 +6,7 @@ export type AppSettings = {
   inputDeviceId: string; // "" = default
   outputDeviceId: string; // "" = default
   browserNotifications: boolean;
+  voiceEndpoint: string; // "" = server default
 };
 
 const defaults: AppSettings = {
@@ -14,6 +15,7 @@ const defaults: AppSettings = {
   inputDeviceId: "",
   outputDeviceId: "",
   browserNotifications: false,
+  voiceEndpoint: "",
 };
 
 function loadSettings(): AppSettings {
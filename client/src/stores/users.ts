@@ -1,14 +1,37 @@
 import { createSignal } from "solid-js";
 import type { User } from "./auth";
+import { getMembers } from "../lib/api";
+import { send } from "../lib/ws";
 
 const [onlineUsers, setOnlineUsers] = createSignal<User[]>([]);
 const [allUsers, setAllUsers] = createSignal<User[]>([]);
 
+// Number of users online, ourselves included, as the server counts them.
+const [onlineCount, setOnlineCount] = createSignal(0);
+
 // Accumulates every user we've ever seen — never shrinks.
 // Used for mention rendering so offline users still resolve.
 const [knownUsers, setKnownUsers] = createSignal<Map<string, User>>(new Map());
 
-export { onlineUsers, allUsers, knownUsers };
+// Our own presence status. The server forgets it when our last
+// connection drops, so it's kept locally and re-sent on every ready.
+const [myStatus, _setMyStatus] = createSignal<string>(
+  localStorage.getItem("presence_status") || "online",
+);
+
+export { onlineUsers, allUsers, knownUsers, myStatus, onlineCount, setOnlineCount };
+
+export function setMyStatus(status: string) {
+  _setMyStatus(status);
+  localStorage.setItem("presence_status", status);
+  send("set_status", { status });
+}
+
+export function setUserStatus(userId: string, status: string) {
+  setOnlineUsers((prev) =>
+    prev.map((u) => (u.id === userId ? { ...u, status } : u)),
+  );
+}
 
 export function setOnlineUserList(users: User[]) {
   setOnlineUsers(users);
@@ -20,6 +43,25 @@ export function setAllUserList(users: User[]) {
   mergeKnownUsers(users);
 }
 
+// Pages in the rest of the member list after ready, which only carries
+// the first page. Starts from the cursor ready handed us.
+export async function loadRemainingUsers(after: string | null) {
+  while (after) {
+    try {
+      const page = await getMembers(after);
+      setAllUsers((prev) => {
+        const seen = new Set(prev.map((u) => u.id));
+        return [...prev, ...page.users.filter((u) => !seen.has(u.id))];
+      });
+      mergeKnownUsers(page.users);
+      after = page.next;
+    } catch (e) {
+      console.error("Failed to load member list:", e);
+      return;
+    }
+  }
+}
+
 export function addOnlineUser(user: User) {
   setOnlineUsers((prev) => {
     if (prev.find((u) => u.id === user.id)) return prev;
@@ -45,6 +87,15 @@ export function addAllUser(user: User) {
   mergeKnownUsers([user]);
 }
 
+// Applies a user_update (an admin changed the user's flags) to the lists
+// we hold.
+export function updateUser(user: User) {
+  const apply = (prev: User[]) =>
+    prev.map((u) => (u.id === user.id ? { ...u, is_admin: user.is_admin } : u));
+  setOnlineUsers(apply);
+  setAllUsers(apply);
+}
+
 export function removeAllUser(userId: string) {
   setAllUsers((prev) => prev.filter((u) => u.id !== userId));
 }
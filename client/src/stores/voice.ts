@@ -7,6 +7,7 @@ export type VoiceState = {
   self_deafen: boolean;
   server_mute: boolean;
   speaking: boolean;
+  priority_speaker?: boolean;
 };
 
 export type VoiceStats = {
@@ -42,9 +43,20 @@ const [localScreenStream, setLocalScreenStream] = createSignal<MediaStream | nul
 const [desktopPresenting, setDesktopPresenting] = createSignal(false);
 const [desktopPreviewUrl, setDesktopPreviewUrl] = createSignal<string | null>(null);
 const [audioSources, setAudioSources] = createSignal<AudioSource[]>([]);
+// Server's voice Opus settings, from ready. The mic encoder is capped to
+// this bitrate.
+export type VoiceAudio = { bitrate: number; fec: boolean };
+const [voiceAudio, setVoiceAudio] = createSignal<VoiceAudio>({ bitrate: 128000, fec: true });
+// Public IPs (SFU endpoints) the server takes voice on, from ready. A call
+// runs on the endpoint of whoever started it.
+const [voiceEndpoints, setVoiceEndpoints] = createSignal<string[]>([]);
 
 export {
   voiceStates,
+  voiceAudio,
+  setVoiceAudio,
+  voiceEndpoints,
+  setVoiceEndpoints,
   currentVoiceChannelId,
   selfMute,
   selfDeafen,
@@ -2,22 +2,32 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
 
+	"github.com/kalman/voicechat/captcha"
 	"github.com/kalman/voicechat/crypto"
 	"github.com/kalman/voicechat/db"
 	"github.com/kalman/voicechat/email"
 	"github.com/kalman/voicechat/ws"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// maxAllowedReactions caps the allowed_reactions setting.
+const maxAllowedReactions = 100
+
 type AdminHandler struct {
 	DB           *db.DB
 	Hub          *ws.Hub
 	EmailService *email.EmailService
+	Captcha      *captcha.Service
 	EncKey       []byte
+	Passwords    *crypto.PasswordHasher
+	// DevMode allows the test CAPTCHA provider, which passes a fixed token
+	DevMode bool
 }
 
 type adminUserPayload struct {
@@ -33,17 +43,48 @@ type adminUserPayload struct {
 	CreatedAt     string  `json:"created_at"`
 }
 
+// userStatusFilters are the ?status= values ListUsers accepts.
+var userStatusFilters = map[string]func(u *db.User) bool{
+	"pending":  func(u *db.User) bool { return !u.Approved },
+	"verified": func(u *db.User) bool { return u.EmailVerifiedAt != nil },
+	"approved": func(u *db.User) bool { return u.Approved },
+}
+
+// ListUsers returns every user, or with ?status=pending|verified|approved
+// only those matching. When email verification is on, pending users who
+// haven't verified yet are listed last, after the ones ready to approve.
 func (h *AdminHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
 		return
 	}
 
-	users, err := h.DB.GetAllUsers()
+	var keep func(u *db.User) bool
+	if status := r.URL.Query().Get("status"); status != "" {
+		if keep = userStatusFilters[status]; keep == nil {
+			writeError(w, http.StatusBadRequest, "status must be pending, verified or approved")
+			return
+		}
+	}
+
+	all, err := h.DB.GetAllUsers()
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal error")
 		return
 	}
+	users := all[:0]
+	for i := range all {
+		if keep == nil || keep(&all[i]) {
+			users = append(users, all[i])
+		}
+	}
+
+	if verificationEnabled, _ := h.EmailService.IsVerificationEnabled(); verificationEnabled {
+		awaitingEmail := func(u *db.User) bool { return !u.Approved && u.EmailVerifiedAt == nil }
+		sort.SliceStable(users, func(i, j int) bool {
+			return !awaitingEmail(&users[i]) && awaitingEmail(&users[j])
+		})
+	}
 
 	payloads := make([]adminUserPayload, len(users))
 	for i, u := range users {
@@ -96,6 +137,76 @@ func (h *AdminHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
 
+// RejectUser turns away a pending applicant: the account is deleted, any
+// open connection is kicked, and the applicant is emailed (with the
+// optional reason) if they gave an address. Established members are
+// removed with DeleteUser instead.
+func (h *AdminHandler) RejectUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	user := UserFromContext(r.Context())
+
+	// Extract user ID from path: /api/v1/admin/users/{id}/reject
+	path := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/users/")
+	targetID := strings.TrimSuffix(path, "/reject")
+	if targetID == "" {
+		writeError(w, http.StatusBadRequest, "user id required")
+		return
+	}
+
+	var body struct {
+		Reason string `json:"reason"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+	}
+	body.Reason = strings.TrimSpace(body.Reason)
+	if len(body.Reason) > 500 {
+		writeError(w, http.StatusBadRequest, "reason must be 500 characters or less")
+		return
+	}
+
+	target, err := h.DB.GetUserByID(targetID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if target == nil {
+		writeError(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if target.Approved {
+		writeError(w, http.StatusBadRequest, "user is already approved; delete them instead")
+		return
+	}
+
+	if err := h.DB.DeleteUser(targetID); err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	log.Printf("AUDIT: admin %s rejected pending user %s (%s)", user.ID, targetID, target.Username)
+
+	// Kick the user's WS connection
+	h.Hub.DisconnectUser(targetID)
+
+	emailed := false
+	if target.Email != nil && *target.Email != "" {
+		if err := h.EmailService.SendRejectionEmail(*target.Email, "Le Faux Pain", body.Reason); err != nil {
+			log.Printf("send rejection email to %s: %v", *target.Email, err)
+		} else {
+			emailed = true
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"status": "rejected", "emailed": emailed})
+}
+
 func (h *AdminHandler) SetAdmin(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -131,6 +242,10 @@ func (h *AdminHandler) SetAdmin(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Printf("AUDIT: admin %s changed admin status of user %s to %v", user.ID, targetID, body.IsAdmin)
 
+	if target, _ := h.DB.GetUserByID(targetID); target != nil {
+		h.Hub.RefreshUser(target)
+	}
+
 	writeJSON(w, http.StatusOK, map[string]any{"status": "updated", "is_admin": body.IsAdmin})
 }
 
@@ -158,13 +273,12 @@ func (h *AdminHandler) SetPassword(w http.ResponseWriter, r *http.Request) {
 
 	var passwordHash *string
 	if body.Password != "" {
-		hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+		hash, err := h.Passwords.Hash(body.Password)
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, "internal error")
 			return
 		}
-		s := string(hash)
-		passwordHash = &s
+		passwordHash = &hash
 	}
 
 	if err := h.DB.SetPassword(targetID, passwordHash); err != nil {
@@ -208,6 +322,7 @@ func (h *AdminHandler) ApproveUser(w http.ResponseWriter, r *http.Request) {
 			},
 		})
 		h.Hub.BroadcastAll(msg)
+		h.Hub.RefreshUser(approvedUser)
 
 		// Send approval notification email
 		if approvedUser.Email != nil && *approvedUser.Email != "" {
@@ -220,6 +335,16 @@ func (h *AdminHandler) ApproveUser(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "approved"})
 }
 
+// Stats reports server health counters that aren't for the public health
+// check.
+func (h *AdminHandler) Stats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"lagging_disconnects": h.Hub.LaggingDisconnects()})
+}
+
 func (h *AdminHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -228,8 +353,27 @@ func (h *AdminHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
 
 	enabled, _ := h.DB.GetSetting("email_verification_enabled")
 
+	registrationMode, _ := h.DB.GetRegistrationMode()
+	serverName, _ := h.DB.GetSetting("server_name")
+	passwordPolicy, _ := h.DB.GetPasswordPolicy()
+	retentionDays, _ := h.DB.GetRetentionDays()
+	allowedReactions, _ := h.DB.GetAllowedReactions()
+
 	result := map[string]any{
 		"email_verification_enabled": enabled == "true",
+		"registration_mode":          registrationMode,
+		"server_name":                serverName,
+		"password_policy":            passwordPolicy,
+		"retention_days":             retentionDays,
+		"allowed_reactions":          allowedReactions,
+	}
+
+	if cc, err := h.Captcha.Config(); err == nil && cc != nil {
+		result["captcha_config"] = map[string]string{
+			"provider":      cc.Provider,
+			"site_key":      cc.SiteKey,
+			"secret_masked": maskSecret(cc.Secret),
+		}
 	}
 
 	// Decrypt provider config if it exists
@@ -324,12 +468,142 @@ func (h *AdminHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		EmailVerificationEnabled *bool                 `json:"email_verification_enabled"`
 		EmailProviderConfig      *email.ProviderConfig `json:"email_provider_config"`
+		RegistrationMode         *string               `json:"registration_mode"`
+		ServerName               *string               `json:"server_name"`
+		PasswordPolicy           *db.PasswordPolicy    `json:"password_policy"`
+		RetentionDays            *int                  `json:"retention_days"`
+		// AllowedReactions limits add_reaction to these emoji; [] lifts it.
+		AllowedReactions *[]string `json:"allowed_reactions"`
+		// CaptchaConfig with an empty provider turns CAPTCHA off.
+		CaptchaConfig *captcha.Config `json:"captcha_config"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
+	if req.RegistrationMode != nil {
+		switch *req.RegistrationMode {
+		case db.RegistrationOpen, db.RegistrationApproval, db.RegistrationClosed:
+		default:
+			writeError(w, http.StatusBadRequest, "registration_mode must be open, approval, or closed")
+			return
+		}
+		if err := h.DB.SetSetting("registration_mode", *req.RegistrationMode); err != nil {
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		user := UserFromContext(r.Context())
+		log.Printf("AUDIT: admin %s set registration mode to %s", user.ID, *req.RegistrationMode)
+	}
+
+	if req.PasswordPolicy != nil {
+		if req.PasswordPolicy.MinLength < 1 || req.PasswordPolicy.MinLength > db.MaxPasswordLength {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("password_policy.min_length must be between 1 and %d", db.MaxPasswordLength))
+			return
+		}
+		if err := h.DB.SetPasswordPolicy(*req.PasswordPolicy); err != nil {
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		user := UserFromContext(r.Context())
+		log.Printf("AUDIT: admin %s updated password policy to %+v", user.ID, *req.PasswordPolicy)
+	}
+
+	if req.RetentionDays != nil {
+		if *req.RetentionDays < 0 {
+			writeError(w, http.StatusBadRequest, "retention_days must be 0 (keep forever) or a positive number of days")
+			return
+		}
+		if err := h.DB.SetSetting("retention_days", strconv.Itoa(*req.RetentionDays)); err != nil {
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		user := UserFromContext(r.Context())
+		log.Printf("AUDIT: admin %s set message retention to %d days", user.ID, *req.RetentionDays)
+	}
+
+	if req.AllowedReactions != nil {
+		if len(*req.AllowedReactions) > maxAllowedReactions {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("allowed_reactions may list at most %d emoji", maxAllowedReactions))
+			return
+		}
+		var emoji []string
+		for _, e := range *req.AllowedReactions {
+			if !ws.IsValidEmoji(e) {
+				writeError(w, http.StatusBadRequest, fmt.Sprintf("allowed_reactions: %q is not a single emoji", e))
+				return
+			}
+			dup := false
+			for _, seen := range emoji {
+				dup = dup || ws.SameEmoji(seen, e)
+			}
+			if !dup {
+				emoji = append(emoji, e)
+			}
+		}
+		if err := h.DB.SetAllowedReactions(emoji); err != nil {
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		user := UserFromContext(r.Context())
+		log.Printf("AUDIT: admin %s set allowed reactions to %v", user.ID, emoji)
+	}
+
+	if req.CaptchaConfig != nil {
+		cc := req.CaptchaConfig
+		user := UserFromContext(r.Context())
+		if cc.Provider == "" {
+			if err := h.Captcha.SetConfig(nil); err != nil {
+				writeError(w, http.StatusInternalServerError, "internal error")
+				return
+			}
+			log.Printf("AUDIT: admin %s disabled registration captcha", user.ID)
+		} else {
+			if !captcha.ValidProvider(cc.Provider) {
+				writeError(w, http.StatusBadRequest, "captcha_config.provider must be hcaptcha, turnstile, test, or empty to disable")
+				return
+			}
+			if cc.Provider == captcha.ProviderTest && !h.DevMode {
+				writeError(w, http.StatusBadRequest, "captcha_config.provider test is only available with --dev")
+				return
+			}
+			// Keep the stored secret when the form sends it back masked
+			if existing, _ := h.Captcha.Config(); existing != nil && existing.Provider == cc.Provider &&
+				(cc.Secret == "" || strings.HasPrefix(cc.Secret, "\u2022")) {
+				cc.Secret = existing.Secret
+			}
+			if cc.Provider != captcha.ProviderTest && (cc.SiteKey == "" || cc.Secret == "") {
+				writeError(w, http.StatusBadRequest, "captcha_config needs site_key and secret")
+				return
+			}
+			if err := h.Captcha.SetConfig(cc); err != nil {
+				writeError(w, http.StatusInternalServerError, "internal error")
+				return
+			}
+			log.Printf("AUDIT: admin %s enabled registration captcha (%s)", user.ID, cc.Provider)
+		}
+	}
+
+	if req.ServerName != nil {
+		name := strings.TrimSpace(*req.ServerName)
+		if len([]rune(name)) > 64 {
+			writeError(w, http.StatusBadRequest, "server name must be 64 characters or less")
+			return
+		}
+		var err error
+		if name == "" {
+			err = h.DB.DeleteSetting("server_name")
+		} else {
+			err = h.DB.SetSetting("server_name", name)
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		broadcastServerUpdate(h.DB, h.Hub)
+	}
+
 	// Save provider config if provided
 	if req.EmailProviderConfig != nil {
 		newCfg := req.EmailProviderConfig
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/kalman/voicechat/db"
+)
+
+type AttachmentHandler struct {
+	DB        *db.DB
+	DataDir   string
+	Downloads *DownloadCounter
+}
+
+// Download serves /api/v1/attachments/{id}/download: the file under its
+// original filename, as a download. Like /uploads/ it needs no token, so
+// it works as a plain link; the attachment ID is as hard to guess as the
+// storage path. Only attachments on a message are served.
+func (h *AttachmentHandler) Download(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/attachments/"), "/download")
+	a, err := h.DB.GetAttachmentByID(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if a == nil || a.MessageID == nil {
+		writeError(w, http.StatusNotFound, "attachment not found")
+		return
+	}
+
+	f, err := os.Open(filepath.Join(h.DataDir, a.Path))
+	if err != nil {
+		writeError(w, http.StatusNotFound, "attachment not found")
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	contentType := a.MimeType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": a.Filename})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+
+	rec := &statusRecorder{ResponseWriter: w}
+	http.ServeContent(rec, r, "", info.ModTime(), f)
+	h.Downloads.count(r, rec.status, a.Path)
+}
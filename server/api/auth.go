@@ -2,6 +2,7 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net"
 	"net/http"
@@ -10,6 +11,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/kalman/voicechat/captcha"
+	"github.com/kalman/voicechat/crypto"
 	"github.com/kalman/voicechat/db"
 	"github.com/kalman/voicechat/email"
 	"github.com/kalman/voicechat/ws"
@@ -18,12 +21,23 @@ import (
 
 var usernameRegex = regexp.MustCompile(`^[a-zA-Z0-9_]{1,32}$`)
 
+// ValidUsername reports whether username is one registration would accept.
+func ValidUsername(username string) bool {
+	return usernameRegex.MatchString(username)
+}
+
 var emailRegex = regexp.MustCompile(`^[^@\s]+@[^@\s]+\.[^@\s]+$`)
 
 type AuthHandler struct {
 	DB           *db.DB
 	Hub          *ws.Hub
 	EmailService *email.EmailService
+	Captcha      *captcha.Service
+	PublicURL    string // base for emailed login links; magic links are off when empty
+	Passwords    *crypto.PasswordHasher
+	// FirstUserAdmin makes the first registration on an empty server an
+	// approved admin that can register even while registration is closed.
+	FirstUserAdmin bool
 }
 
 type authRequest struct {
@@ -31,11 +45,18 @@ type authRequest struct {
 	Password     *string `json:"password"`
 	Email        *string `json:"email"`
 	KnockMessage *string `json:"knock_message"`
+	// CaptchaToken is the widget response; required on Register when a
+	// CAPTCHA provider is configured.
+	CaptchaToken string `json:"captcha_token"`
+	// Remember asks Login for a long-lived token. Omitted means true so
+	// older clients keep their 30-day sessions.
+	Remember *bool `json:"remember"`
 }
 
 type authResponse struct {
-	User  *userPayload `json:"user"`
-	Token string       `json:"token"`
+	User      *userPayload `json:"user"`
+	Token     string       `json:"token"`
+	ExpiresAt string       `json:"expires_at"` // RFC 3339; clients should re-auth before this
 }
 
 type userPayload struct {
@@ -76,6 +97,35 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	registrationMode, err := h.DB.GetRegistrationMode()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	userCount, err := h.DB.UserCount()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	isFirstUser := h.FirstUserAdmin && userCount == 0
+
+	// The first user can always register so a fresh server can be set up
+	if registrationMode == db.RegistrationClosed && !isFirstUser {
+		writeError(w, http.StatusForbidden, "registration is closed")
+		return
+	}
+
+	if err := h.Captcha.Verify(req.CaptchaToken, clientIP(r)); err != nil {
+		if errors.Is(err, captcha.ErrFailed) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf("captcha verify: %v", err)
+		writeError(w, http.StatusBadGateway, "captcha provider unavailable")
+		return
+	}
+
 	if verificationEnabled {
 		// All three fields required when verification is enabled
 		if req.Username == "" {
@@ -106,6 +156,15 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	password := ""
+	if req.Password != nil {
+		password = *req.Password
+	}
+	if msg := validatePassword(h.DB, password); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
+
 	// Check if username already taken (case-insensitive)
 	existing, err := h.DB.GetUserByUsername(req.Username)
 	if err != nil {
@@ -136,28 +195,19 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 	// Hash password if provided
 	var passwordHash *string
 	if req.Password != nil && *req.Password != "" {
-		if len(*req.Password) > 72 {
-			writeError(w, http.StatusBadRequest, "password must be 72 characters or less")
-			return
-		}
-		hash, err := bcrypt.GenerateFromPassword([]byte(*req.Password), bcrypt.DefaultCost)
+		hash, err := h.Passwords.Hash(*req.Password)
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, "internal error")
 			return
 		}
-		s := string(hash)
-		passwordHash = &s
+		passwordHash = &hash
 	}
 
-	// First user is admin and auto-approved; others need approval
-	userCount, err := h.DB.UserCount()
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "internal error")
-		return
-	}
-	isFirstUser := userCount == 0
+	// First user is admin and auto-approved. Others are approved
+	// immediately in open mode, unless they still have to verify their
+	// email — Verify approves them once that's done.
 	isAdmin := isFirstUser
-	approved := isFirstUser
+	approved := isFirstUser || (registrationMode == db.RegistrationOpen && !verificationEnabled)
 
 	// Capture registration IP
 	clientIP := r.Header.Get("X-Real-IP")
@@ -177,34 +227,45 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 
 	// If email verification is enabled and user is not first user, send verification code
 	if verificationEnabled && !isFirstUser && emailPtr != nil {
+		resp := map[string]any{"pending_verification": true}
 		if err := h.EmailService.GenerateAndSendCode(userID, *emailPtr); err != nil {
 			log.Printf("generate verification code: %v", err)
+			// The account exists either way; the user fixes the problem
+			// and resends from the verification screen
+			if msg, _, ok := deliveryFailure(err); ok {
+				resp["email_error"] = msg
+			}
 		}
-		writeJSON(w, http.StatusAccepted, map[string]bool{"pending_verification": true})
+		writeJSON(w, http.StatusAccepted, resp)
 		return
 	}
 
 	if !approved {
 		// Notify all online admins about the pending user
-		h.notifyAdminsPendingUser(userID, req.Username)
+		h.notifyAdminsPendingUser(userID, req.Username, req.KnockMessage)
 		writeJSON(w, http.StatusAccepted, map[string]bool{"pending": true})
 		return
 	}
 
 	token := uuid.New().String()
-	if err := h.DB.CreateToken(token, userID); err != nil {
+	expiresAt, err := h.DB.CreateToken(token, userID, db.RememberTokenTTL)
+	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal error")
 		return
 	}
 
 	user, _ := h.DB.GetUserByID(userID)
+	if !isFirstUser {
+		h.broadcastUserApproved(user)
+	}
 	writeJSON(w, http.StatusCreated, authResponse{
-		User:  newUserPayload(user),
-		Token: token,
+		User:      newUserPayload(user),
+		Token:     token,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
 	})
 }
 
-func (h *AuthHandler) notifyAdminsPendingUser(userID, username string) {
+func (h *AuthHandler) notifyAdminsPendingUser(userID, username string, knockMessage *string) {
 	admins, err := h.DB.GetAdminUsers()
 	if err != nil {
 		log.Printf("get admin users for notification: %v", err)
@@ -215,6 +276,9 @@ func (h *AuthHandler) notifyAdminsPendingUser(userID, username string) {
 		"subject_user_id": userID,
 		"username":        username,
 	}
+	if knockMessage != nil && *knockMessage != "" {
+		notifData["knock_message"] = *knockMessage
+	}
 	dataJSON, _ := json.Marshal(notifData)
 	for _, admin := range admins {
 		notifID := uuid.New().String()
@@ -269,18 +333,31 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		if req.Password != nil {
 			password = *req.Password
 		}
-		if err := bcrypt.CompareHashAndPassword([]byte(*user.PasswordHash), []byte(password)); err != nil {
+		if !h.Passwords.Verify(*user.PasswordHash, password) {
 			writeError(w, http.StatusUnauthorized, "invalid credentials")
 			return
 		}
+		// Best effort: a failed rehash leaves the old hash, which still works
+		if h.Passwords.NeedsRehash(*user.PasswordHash) {
+			if hash, err := h.Passwords.Hash(password); err != nil {
+				log.Printf("rehash password for %s: %v", user.ID, err)
+			} else if err := h.DB.SetPassword(user.ID, &hash); err != nil {
+				log.Printf("rehash password for %s: %v", user.ID, err)
+			}
+		}
 	}
 
 	// Check email verification status — only block unapproved users mid-verification
 	verificationEnabled, _ := h.EmailService.IsVerificationEnabled()
 	if verificationEnabled && !user.Approved && user.Email != nil && user.EmailVerifiedAt == nil {
 		// Send a verification code so the user can proceed
-		_ = h.EmailService.GenerateAndSendCode(user.ID, *user.Email)
-		writeJSON(w, http.StatusForbidden, map[string]any{"error": "please verify your email", "pending_verification": true})
+		resp := map[string]any{"error": "please verify your email", "pending_verification": true}
+		if err := h.EmailService.GenerateAndSendCode(user.ID, *user.Email); err != nil {
+			if msg, _, ok := deliveryFailure(err); ok {
+				resp["email_error"] = msg
+			}
+		}
+		writeJSON(w, http.StatusForbidden, resp)
 		return
 	}
 
@@ -289,15 +366,22 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	ttl := db.RememberTokenTTL
+	if req.Remember != nil && !*req.Remember {
+		ttl = db.SessionTokenTTL
+	}
+
 	token := uuid.New().String()
-	if err := h.DB.CreateToken(token, user.ID); err != nil {
+	expiresAt, err := h.DB.CreateToken(token, user.ID, ttl)
+	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal error")
 		return
 	}
 
 	writeJSON(w, http.StatusOK, authResponse{
-		User:  newUserPayload(user),
-		Token: token,
+		User:      newUserPayload(user),
+		Token:     token,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
 	})
 }
 
@@ -324,7 +408,7 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 
 	// If user has an existing password, verify current_password
 	if user.PasswordHash != nil {
-		if err := bcrypt.CompareHashAndPassword([]byte(*user.PasswordHash), []byte(req.CurrentPassword)); err != nil {
+		if !h.Passwords.Verify(*user.PasswordHash, req.CurrentPassword) {
 			writeError(w, http.StatusUnauthorized, "current password is incorrect")
 			return
 		}
@@ -332,18 +416,17 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 
 	// Set or remove password
 	var passwordHash *string
+	if msg := validatePassword(h.DB, req.NewPassword); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
+		return
+	}
 	if req.NewPassword != "" {
-		if len(req.NewPassword) > 72 {
-			writeError(w, http.StatusBadRequest, "password must be 72 characters or less")
-			return
-		}
-		hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+		hash, err := h.Passwords.Hash(req.NewPassword)
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, "internal error")
 			return
 		}
-		s := string(hash)
-		passwordHash = &s
+		passwordHash = &hash
 	}
 
 	if err := h.DB.SetPassword(user.ID, passwordHash); err != nil {
@@ -357,6 +440,83 @@ func (h *AuthHandler) ChangePassword(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]any{"status": "updated", "has_password": passwordHash != nil})
 }
 
+// EmailDigest gets (GET) or sets (POST {enabled}) the user's opt-in to the
+// daily digest of missed mentions.
+func (h *AuthHandler) EmailDigest(w http.ResponseWriter, r *http.Request) {
+	user := UserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if req.Enabled && (user.Email == nil || *user.Email == "") {
+			writeError(w, http.StatusBadRequest, "set an email address first")
+			return
+		}
+		if err := h.DB.SetEmailDigestEnabled(user.ID, req.Enabled); err != nil {
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	enabled, err := h.DB.GetEmailDigestEnabled(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"enabled": enabled})
+}
+
+// MentionEmail gets (GET) or sets (POST {enabled}) whether the user is
+// emailed about mentions while they're offline. On by default; it only
+// takes effect once their email is verified.
+func (h *AuthHandler) MentionEmail(w http.ResponseWriter, r *http.Request) {
+	user := UserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var req struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid request body")
+			return
+		}
+		if err := h.DB.SetMentionEmailEnabled(user.ID, req.Enabled); err != nil {
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	enabled, err := h.DB.GetMentionEmailEnabled(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"enabled": enabled})
+}
+
 func (h *AuthHandler) UpdateEmail(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -488,12 +648,39 @@ func (h *AuthHandler) Verify(w http.ResponseWriter, r *http.Request) {
 	}
 	h.DB.InvalidateVerificationCode(vc.ID)
 
+	// Open registration: verified users are let straight in
+	if mode, _ := h.DB.GetRegistrationMode(); mode == db.RegistrationOpen && !user.Approved {
+		if err := h.DB.ApproveUser(user.ID); err != nil {
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		h.broadcastUserApproved(user)
+		writeJSON(w, http.StatusOK, map[string]any{"status": "verified", "pending_approval": false})
+		return
+	}
+
 	// Notify admins about pending user
-	h.notifyAdminsPendingUser(user.ID, user.Username)
+	h.notifyAdminsPendingUser(user.ID, user.Username, user.KnockMessage)
 
 	writeJSON(w, http.StatusOK, map[string]any{"status": "verified", "pending_approval": true})
 }
 
+// broadcastUserApproved tells connected clients about a newly admitted
+// member, as AdminHandler.ApproveUser does for manual approvals.
+func (h *AuthHandler) broadcastUserApproved(user *db.User) {
+	if user == nil {
+		return
+	}
+	msg, _ := ws.NewMessage("user_approved", ws.UserOnlineData{
+		User: ws.UserPayload{
+			ID:       user.ID,
+			Username: user.Username,
+			IsAdmin:  user.IsAdmin,
+		},
+	})
+	h.Hub.BroadcastAll(msg)
+}
+
 func (h *AuthHandler) ResendCode(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -536,6 +723,10 @@ func (h *AuthHandler) ResendCode(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := h.EmailService.GenerateAndSendCode(user.ID, *user.Email); err != nil {
+		if msg, status, ok := deliveryFailure(err); ok {
+			writeError(w, status, msg)
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "internal error")
 		return
 	}
@@ -543,6 +734,21 @@ func (h *AuthHandler) ResendCode(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
 }
 
+// deliveryFailure turns a verification email that didn't go out into the
+// message and status to show the user: a bounced address is theirs to fix
+// (422), anything else is the provider's (502). ok is false for other
+// errors.
+func deliveryFailure(err error) (string, int, bool) {
+	var delivery *email.DeliveryError
+	if !errors.As(err, &delivery) {
+		return "", 0, false
+	}
+	if delivery.Bounced() {
+		return "email delivery failed, check the address", http.StatusUnprocessableEntity, true
+	}
+	return "email delivery failed, try again later", http.StatusBadGateway, true
+}
+
 func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -590,6 +796,107 @@ func (h *AuthHandler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
 }
 
+// RequestMagicLink emails a one-time login link to an approved,
+// email-verified user. Always returns 200 so it can't be used to probe
+// which addresses have accounts.
+func (h *AuthHandler) RequestMagicLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	if h.PublicURL == "" {
+		writeError(w, http.StatusBadRequest, "magic link login is not configured on this server")
+		return
+	}
+	cfg, err := h.EmailService.GetProviderConfig()
+	if err != nil || cfg == nil {
+		writeError(w, http.StatusBadRequest, "email is not configured on this server")
+		return
+	}
+
+	user, err := h.DB.GetUserByEmail(strings.TrimSpace(req.Email))
+	if err != nil || user == nil || user.Email == nil || !user.Approved || user.EmailVerifiedAt == nil {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+		return
+	}
+
+	// Rate limit: max 3 links per hour
+	count, err := h.DB.CountRecentMagicLinks(user.ID, time.Now().Add(-1*time.Hour))
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if count >= 3 {
+		// Still return 200 to not leak info
+		writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+		return
+	}
+
+	if err := h.EmailService.GenerateAndSendMagicLink(user.ID, *user.Email, h.PublicURL); err != nil {
+		log.Printf("generate magic link: %v", err)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]string{"status": "sent"})
+}
+
+// ConsumeMagicLink exchanges a magic-link token for a session token. Each
+// token works once, within 15 minutes of being issued.
+func (h *AuthHandler) ConsumeMagicLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		writeError(w, http.StatusBadRequest, "token is required")
+		return
+	}
+
+	userID, err := h.DB.ConsumeMagicLink(token)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if userID == "" {
+		writeError(w, http.StatusBadRequest, "invalid or expired link, please request a new one")
+		return
+	}
+
+	// Re-check: the account may have been suspended since the link was sent
+	user, err := h.DB.GetUserByID(userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if user == nil || !user.Approved || user.EmailVerifiedAt == nil {
+		writeError(w, http.StatusBadRequest, "invalid or expired link, please request a new one")
+		return
+	}
+
+	sessionToken := uuid.New().String()
+	expiresAt, err := h.DB.CreateToken(sessionToken, user.ID, db.RememberTokenTTL)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, authResponse{
+		User:      newUserPayload(user),
+		Token:     sessionToken,
+		ExpiresAt: expiresAt.Format(time.RFC3339),
+	})
+}
+
 func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -610,8 +917,8 @@ func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "new password is required")
 		return
 	}
-	if len(req.NewPassword) > 72 {
-		writeError(w, http.StatusBadRequest, "password must be 72 characters or less")
+	if msg := validatePassword(h.DB, req.NewPassword); msg != "" {
+		writeError(w, http.StatusBadRequest, msg)
 		return
 	}
 
@@ -659,13 +966,12 @@ func (h *AuthHandler) ResetPassword(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Success: hash new password, update, invalidate code
-	hash, err := bcrypt.GenerateFromPassword([]byte(req.NewPassword), bcrypt.DefaultCost)
+	hash, err := h.Passwords.Hash(req.NewPassword)
 	if err != nil {
 		writeError(w, http.StatusInternalServerError, "internal error")
 		return
 	}
-	s := string(hash)
-	if err := h.DB.SetPassword(user.ID, &s); err != nil {
+	if err := h.DB.SetPassword(user.ID, &hash); err != nil {
 		writeError(w, http.StatusInternalServerError, "internal error")
 		return
 	}
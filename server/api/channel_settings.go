@@ -52,6 +52,8 @@ func (h *ChannelSettingsHandler) UpdateSettings(w http.ResponseWriter, r *http.R
 		Name        string `json:"name"`
 		Description string `json:"description"`
 		Visibility  string `json:"visibility"`
+		// Announcement is left unchanged when omitted
+		Announcement *bool `json:"announcement"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		writeError(w, http.StatusBadRequest, "invalid JSON")
@@ -84,13 +86,17 @@ func (h *ChannelSettingsHandler) UpdateSettings(w http.ResponseWriter, r *http.R
 	if description == "" && ch.Description != nil {
 		description = *ch.Description
 	}
+	announcement := ch.Announcement
+	if body.Announcement != nil {
+		announcement = *body.Announcement
+	}
 
-	if err := h.DB.UpdateChannelSettings(channelID, name, description, visibility); err != nil {
+	if err := h.DB.UpdateChannelSettings(channelID, name, description, visibility, announcement); err != nil {
 		log.Printf("update channel settings: %v", err)
 		writeError(w, http.StatusInternalServerError, "internal error")
 		return
 	}
-	log.Printf("AUDIT: user %s (%s) updated channel %s settings: visibility=%s", user.ID, user.Username, channelID, visibility)
+	log.Printf("AUDIT: user %s (%s) updated channel %s settings: visibility=%s announcement=%t", user.ID, user.Username, channelID, visibility, announcement)
 
 	// Broadcast channel_update to all clients
 	managerIDs, _ := h.DB.GetChannelManagers(channelID)
@@ -98,11 +104,12 @@ func (h *ChannelSettingsHandler) UpdateSettings(w http.ResponseWriter, r *http.R
 		managerIDs = []string{}
 	}
 	broadcast, _ := ws.NewMessage("channel_update", map[string]any{
-		"id":          channelID,
-		"name":        name,
-		"manager_ids": managerIDs,
-		"visibility":  visibility,
-		"description": description,
+		"id":           channelID,
+		"name":         name,
+		"manager_ids":  managerIDs,
+		"visibility":   visibility,
+		"description":  description,
+		"announcement": announcement,
 	})
 	h.Hub.BroadcastAll(broadcast)
 
@@ -374,6 +381,57 @@ func (h *ChannelSettingsHandler) HandleAccessRequests(w http.ResponseWriter, r *
 	}
 }
 
+// HandleMute handles GET/PUT/DELETE /api/v1/channels/{id}/mute: whether
+// the caller has muted the channel. Muted channels' mentions still notify
+// in-app but are left out of offline mention emails.
+func (h *ChannelSettingsHandler) HandleMute(w http.ResponseWriter, r *http.Request) {
+	user := UserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) != 6 {
+		writeError(w, http.StatusBadRequest, "invalid path")
+		return
+	}
+	channelID := parts[4]
+
+	if ch, err := h.DB.GetChannelByID(channelID); err != nil || ch == nil {
+		writeError(w, http.StatusNotFound, "channel not found")
+		return
+	}
+	if canAccess, _ := h.DB.CanAccessChannel(channelID, user.ID, user.IsAdmin); !canAccess {
+		writeError(w, http.StatusForbidden, "not a member of this channel")
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		if err := h.DB.MuteChannel(user.ID, channelID); err != nil {
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+	case http.MethodDelete:
+		if err := h.DB.UnmuteChannel(user.ID, channelID); err != nil {
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	muted, err := h.DB.IsChannelMuted(user.ID, channelID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"muted": muted})
+}
+
 func (h *ChannelSettingsHandler) canManageChannel(user *db.User, channelID string) bool {
 	if user.IsAdmin {
 		return true
@@ -0,0 +1,105 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kalman/voicechat/db"
+)
+
+// downloadFlushInterval is how often buffered download counts are written.
+const downloadFlushInterval = 10 * time.Second
+
+// DownloadCounter tallies attachment fetches in memory and writes them to
+// attachments.download_count in batches, so serving a file never waits on
+// the database.
+type DownloadCounter struct {
+	DB *db.DB
+
+	mu      sync.Mutex
+	pending map[string]int64 // attachment path → fetches since last flush
+	stop    chan struct{}
+	done    chan struct{}
+}
+
+func NewDownloadCounter(database *db.DB) *DownloadCounter {
+	c := &DownloadCounter{
+		DB:      database,
+		pending: make(map[string]int64),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go c.run()
+	return c
+}
+
+// Wrap counts successful full fetches served by next. Paths are relative
+// to the uploads directory, as stored in attachments.path minus the
+// "uploads/" prefix. Range requests for anything but the first byte are
+// continuations of a fetch already counted.
+func (c *DownloadCounter) Wrap(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+		c.count(r, rec.status, filepath.Join("uploads", filepath.FromSlash(strings.TrimPrefix(r.URL.Path, "/"))))
+	})
+}
+
+// count tallies a fetch of the attachment at path (as stored in
+// attachments.path) if it was a full fetch or the start of one.
+func (c *DownloadCounter) count(r *http.Request, status int, path string) {
+	if r.Method != http.MethodGet {
+		return
+	}
+	switch status {
+	case http.StatusOK, 0:
+	case http.StatusPartialContent:
+		if !strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") {
+			return
+		}
+	default:
+		return
+	}
+	c.mu.Lock()
+	c.pending[path]++
+	c.mu.Unlock()
+}
+
+// Close writes any buffered counts and stops the flush loop.
+func (c *DownloadCounter) Close() {
+	close(c.stop)
+	<-c.done
+}
+
+func (c *DownloadCounter) run() {
+	defer close(c.done)
+	ticker := time.NewTicker(downloadFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.flush()
+		case <-c.stop:
+			c.flush()
+			return
+		}
+	}
+}
+
+func (c *DownloadCounter) flush() {
+	c.mu.Lock()
+	batch := c.pending
+	c.pending = make(map[string]int64)
+	c.mu.Unlock()
+
+	if len(batch) == 0 {
+		return
+	}
+	if err := c.DB.AddAttachmentDownloads(batch); err != nil {
+		log.Printf("flush download counts: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"archive/zip"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kalman/voicechat/db"
+	"github.com/kalman/voicechat/storage"
+)
+
+type ExportHandler struct {
+	DB    *db.DB
+	Store *storage.FileStore
+}
+
+// Export streams a zip backup containing a snapshot of the database and,
+// with ?files=true, every uploaded file. The snapshot is taken with
+// VACUUM INTO so it is consistent even while the server is live.
+func (h *ExportHandler) Export(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	user := UserFromContext(r.Context())
+	includeFiles := r.URL.Query().Get("files") == "true"
+
+	tmpDir, err := os.MkdirTemp("", "voicechat-export-")
+	if err != nil {
+		log.Printf("export: create temp dir: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	snapshotPath := filepath.Join(tmpDir, "voicechat.db")
+	if err := h.DB.SnapshotTo(snapshotPath); err != nil {
+		if errors.Is(err, db.ErrSnapshotUnsupported) {
+			writeError(w, http.StatusNotImplemented, "export is not available on a Postgres database; back it up with pg_dump")
+			return
+		}
+		log.Printf("export: snapshot db: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	log.Printf("AUDIT: admin %s exported server data (files=%v)", user.ID, includeFiles)
+
+	filename := fmt.Sprintf("voicechat-backup-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.WriteHeader(http.StatusOK)
+
+	// Headers are sent; from here on failures can only be logged and the
+	// truncated zip will fail to open on the client.
+	zw := zip.NewWriter(w)
+	if err := addSnapshotToZip(zw, snapshotPath); err != nil {
+		log.Printf("export: write db: %v", err)
+		return
+	}
+	if includeFiles {
+		if err := h.Store.WriteZip(zw); err != nil {
+			log.Printf("export: write files: %v", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		log.Printf("export: finish zip: %v", err)
+	}
+}
+
+func addSnapshotToZip(zw *zip.Writer, path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	zf, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     "voicechat.db",
+		Method:   zip.Deflate,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(zf, f)
+	return err
+}
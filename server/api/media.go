@@ -62,6 +62,13 @@ func (h *MediaHandler) Upload(w http.ResponseWriter, r *http.Request) {
 	relPath, err := h.Store.StoreVideo(file, mimeType)
 	if err != nil {
 		log.Printf("media upload store error: %v", err)
+		if rejectInfected(w, user, header.Filename, err) {
+			return
+		}
+		if storage.IsDiskFull(err) {
+			writeError(w, http.StatusInsufficientStorage, "server storage is full")
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to store file")
 		return
 	}
@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/kalman/voicechat/db"
+)
+
+type MentionsHandler struct {
+	DB *db.DB
+}
+
+type mentionResponse struct {
+	ID          string        `json:"id"`
+	ChannelID   string        `json:"channel_id"`
+	ChannelName string        `json:"channel_name"`
+	Author      authorPayload `json:"author"`
+	Content     *string       `json:"content"`
+	ReplyToID   *string       `json:"reply_to_id"`
+	ThreadID    *string       `json:"thread_id"`
+	CreatedAt   string        `json:"created_at"`
+	EditedAt    *string       `json:"edited_at"`
+}
+
+// List returns messages mentioning the caller, newest first. Paginate
+// with ?before=<messageID>; ?limit defaults to 50 (max 100).
+func (h *MentionsHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	user := UserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 && n <= 100 {
+			limit = n
+		}
+	}
+	var before *string
+	if b := r.URL.Query().Get("before"); b != "" {
+		before = &b
+	}
+
+	msgs, err := h.DB.GetMentionsForUser(user.ID, user.IsAdmin, limit, before)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get mentions")
+		return
+	}
+
+	result := make([]mentionResponse, len(msgs))
+	for i, m := range msgs {
+		authorID := ""
+		if m.AuthorID != nil {
+			authorID = *m.AuthorID
+		}
+		result[i] = mentionResponse{
+			ID:          m.ID,
+			ChannelID:   m.ChannelID,
+			ChannelName: m.ChannelName,
+			Author:      authorPayload{ID: authorID, Username: m.AuthorUsername, AvatarURL: m.AuthorAvatarURL},
+			Content:     m.Content,
+			ReplyToID:   m.ReplyToID,
+			ThreadID:    m.ThreadID,
+			CreatedAt:   m.CreatedAt,
+			EditedAt:    m.EditedAt,
+		}
+	}
+	writeJSON(w, http.StatusOK, result)
+}
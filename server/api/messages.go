@@ -1,11 +1,14 @@
 package api
 
 import (
+	"fmt"
+	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
 	"github.com/kalman/voicechat/db"
+	"github.com/kalman/voicechat/ws"
 )
 
 type MessageHandler struct {
@@ -34,6 +37,7 @@ type messageResponse struct {
 	Attachments   []attachPayload        `json:"attachments"`
 	Reactions     []db.ReactionGroup     `json:"reactions"`
 	Mentions      []string               `json:"mentions"`
+	Entities      []ws.MessageEntity     `json:"entities"`
 	Unfurls       []unfurlPayload        `json:"unfurls"`
 	ThreadID      *string                `json:"thread_id"`
 	ThreadSummary *threadSummaryPayload  `json:"thread_summary,omitempty"`
@@ -64,6 +68,18 @@ type attachPayload struct {
 	MimeType string  `json:"mime_type"`
 	Width    *int    `json:"width"`
 	Height   *int    `json:"height"`
+	Spoiler  bool    `json:"spoiler"`
+	// DownloadURL serves the file as a download under its original name;
+	// URL is for inline display.
+	DownloadURL string `json:"download_url"`
+	// DownloadCount is only included for the message's author.
+	DownloadCount *int64 `json:"download_count,omitempty"`
+}
+
+// isAuthor reports whether user wrote the message; some attachment details
+// are only shown to the author.
+func isAuthor(user *db.User, authorID *string) bool {
+	return user != nil && authorID != nil && *authorID == user.ID
 }
 
 func (h *MessageHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
@@ -89,6 +105,14 @@ func (h *MessageHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	// ?include_deleted=true — admins see the original content of
+	// soft-deleted messages for moderation
+	includeDeleted := r.URL.Query().Get("include_deleted") == "true"
+	if includeDeleted && (user == nil || !user.IsAdmin) {
+		writeError(w, http.StatusForbidden, "admin only")
+		return
+	}
+
 	limit := 50
 	if l := r.URL.Query().Get("limit"); l != "" {
 		if n, err := strconv.Atoi(l); err == nil && n > 0 && n <= 100 {
@@ -96,13 +120,30 @@ func (h *MessageHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// ?around=<messageID> — fetch messages around a target
-	if around := r.URL.Query().Get("around"); around != "" {
+	// ?around=<messageID> — fetch messages around a target, newest first.
+	// /messages/around/{messageID} is the same window, oldest first, and
+	// 404s when the target isn't in the channel.
+	around := r.URL.Query().Get("around")
+	ascending := false
+	if len(parts) == 8 && parts[6] == "around" && parts[7] != "" {
+		around = parts[7]
+		ascending = true
+	}
+	if around != "" {
 		messages, err := h.DB.GetMessagesAround(channelID, around, limit)
 		if err != nil {
 			writeError(w, http.StatusInternalServerError, "internal error")
 			return
 		}
+		if ascending {
+			if len(messages) == 0 {
+				writeError(w, http.StatusNotFound, "message not found")
+				return
+			}
+			for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+				messages[i], messages[j] = messages[j], messages[i]
+			}
+		}
 		// Batch fetch unfurls
 		msgIDs := make([]string, len(messages))
 		for i, m := range messages {
@@ -141,11 +182,17 @@ func (h *MessageHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 						ID: a.ID, Filename: a.Filename,
 						URL: "/" + strings.ReplaceAll(a.Path, "\\", "/"),
 						MimeType: a.MimeType, Width: a.Width, Height: a.Height,
+						Spoiler: a.Spoiler,
 					}
 					if a.ThumbPath != nil {
 						t := "/" + strings.ReplaceAll(*a.ThumbPath, "\\", "/")
 						ap.ThumbURL = &t
 					}
+					ap.DownloadURL = "/api/v1/attachments/" + a.ID + "/download"
+					if isAuthor(user, m.AuthorID) {
+						n := a.DownloadCount
+						ap.DownloadCount = &n
+					}
 					attachPayloads[j] = ap
 				}
 				reactions, _ = h.DB.GetReactionsByMessage(m.ID)
@@ -202,13 +249,17 @@ func (h *MessageHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 				Author:        authorPayload{ID: authorID, Username: m.AuthorUsername, AvatarURL: m.AuthorAvatarURL},
 				Content:       m.Content, ReplyTo: reply,
 				Attachments:   attachPayloads, Reactions: reactions,
-				Mentions:      mentions, Unfurls: msgUnfurls,
+				Mentions:      mentions, Entities: ws.ParseEntities(m.Content),
+				Unfurls:       msgUnfurls,
 				ThreadID:      m.ThreadID, ThreadSummary: tSummary,
 				CreatedAt:     m.CreatedAt, EditedAt: m.EditedAt,
 				Deleted:       deleted,
 				IsStarred:     starredSet[m.ID],
 			}
 		}
+		if includeDeleted {
+			h.fillDeletedContent(result)
+		}
 		writeJSON(w, http.StatusOK, result)
 		return
 	}
@@ -267,11 +318,17 @@ func (h *MessageHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 					MimeType: a.MimeType,
 					Width:    a.Width,
 					Height:   a.Height,
+					Spoiler:  a.Spoiler,
 				}
 				if a.ThumbPath != nil {
 					t := "/" + strings.ReplaceAll(*a.ThumbPath, "\\", "/")
 					ap.ThumbURL = &t
 				}
+				ap.DownloadURL = "/api/v1/attachments/" + a.ID + "/download"
+				if isAuthor(user, m.AuthorID) {
+					n := a.DownloadCount
+					ap.DownloadCount = &n
+				}
 				attachPayloads[j] = ap
 			}
 
@@ -347,6 +404,7 @@ func (h *MessageHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 			Attachments:   attachPayloads,
 			Reactions:     reactions,
 			Mentions:      mentions,
+			Entities:      ws.ParseEntities(m.Content),
 			Unfurls:       msgUnfurls,
 			ThreadID:      m.ThreadID,
 			ThreadSummary: tSummary,
@@ -357,9 +415,36 @@ func (h *MessageHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if includeDeleted {
+		h.fillDeletedContent(result)
+	}
 	writeJSON(w, http.StatusOK, result)
 }
 
+// fillDeletedContent restores the original content on tombstoned messages.
+// Callers must have checked the requester is an admin.
+func (h *MessageHandler) fillDeletedContent(result []messageResponse) {
+	var deletedIDs []string
+	for _, m := range result {
+		if m.Deleted {
+			deletedIDs = append(deletedIDs, m.ID)
+		}
+	}
+	if len(deletedIDs) == 0 {
+		return
+	}
+	contents, err := h.DB.GetDeletedContent(deletedIDs)
+	if err != nil {
+		log.Printf("get deleted content: %v", err)
+		return
+	}
+	for i := range result {
+		if c, ok := contents[result[i].ID]; ok {
+			result[i].Content = &c
+		}
+	}
+}
+
 func (h *MessageHandler) GetThreadHistory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
@@ -423,11 +508,17 @@ func (h *MessageHandler) GetThreadHistory(w http.ResponseWriter, r *http.Request
 					ID: a.ID, Filename: a.Filename,
 					URL: "/" + strings.ReplaceAll(a.Path, "\\", "/"),
 					MimeType: a.MimeType, Width: a.Width, Height: a.Height,
+					Spoiler: a.Spoiler,
 				}
 				if a.ThumbPath != nil {
 					t := "/" + strings.ReplaceAll(*a.ThumbPath, "\\", "/")
 					ap.ThumbURL = &t
 				}
+				ap.DownloadURL = "/api/v1/attachments/" + a.ID + "/download"
+				if isAuthor(user, m.AuthorID) {
+					n := a.DownloadCount
+					ap.DownloadCount = &n
+				}
 				attachPayloads[j] = ap
 			}
 			reactions, _ = h.DB.GetReactionsByMessage(m.ID)
@@ -480,6 +571,7 @@ func (h *MessageHandler) GetThreadHistory(w http.ResponseWriter, r *http.Request
 			Attachments: attachPayloads,
 			Reactions:   reactions,
 			Mentions:    mentions,
+			Entities:    ws.ParseEntities(m.Content),
 			ThreadID:    m.ThreadID,
 			CreatedAt:   m.CreatedAt,
 			EditedAt:    m.EditedAt,
@@ -539,3 +631,156 @@ func buildUnfurlPayloads(unfurls []db.URLUnfurl) []unfurlPayload {
 	}
 	return result
 }
+
+// Reply chain depth bounds for GetReplyChain.
+const (
+	defaultReplyChainDepth = 5
+	maxReplyChainDepth     = 50
+)
+
+type replyChainPayload struct {
+	replyPayload
+	ChannelID string  `json:"channel_id"`
+	ReplyToID *string `json:"reply_to_id"`
+	CreatedAt string  `json:"created_at"`
+}
+
+// GetReplyChain handles GET /api/v1/messages/{id}/context?depth=N: the
+// message's reply ancestors, nearest first, for rendering a reply thread
+// preview.
+func (h *MessageHandler) GetReplyChain(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// /api/v1/messages/{id}/context
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) != 6 || parts[4] == "" {
+		writeError(w, http.StatusBadRequest, "invalid path")
+		return
+	}
+	messageID := parts[4]
+
+	depth := defaultReplyChainDepth
+	if v := r.URL.Query().Get("depth"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxReplyChainDepth {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("depth must be between 1 and %d", maxReplyChainDepth))
+			return
+		}
+		depth = n
+	}
+
+	msg, err := h.DB.GetMessageByID(messageID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if msg == nil {
+		writeError(w, http.StatusNotFound, "message not found")
+		return
+	}
+	user := UserFromContext(r.Context())
+	if canAccess, _ := h.DB.CanAccessChannel(msg.ChannelID, user.ID, user.IsAdmin); !canAccess {
+		writeError(w, http.StatusForbidden, "not a member of this channel")
+		return
+	}
+
+	chain, complete, err := h.DB.GetReplyChain(messageID, depth)
+	if err != nil {
+		log.Printf("get reply chain: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]replyChainPayload, len(chain))
+	for i, e := range chain {
+		authorID := ""
+		if e.AuthorID != nil {
+			authorID = *e.AuthorID
+		}
+		out[i] = replyChainPayload{
+			replyPayload: replyPayload{
+				ID:      e.ID,
+				Author:  authorPayload{ID: authorID, Username: e.AuthorUsername, AvatarURL: e.AuthorAvatarURL},
+				Content: e.Content,
+				Deleted: e.DeletedAt != nil,
+			},
+			ChannelID: e.ChannelID,
+			ReplyToID: e.ReplyToID,
+			CreatedAt: e.CreatedAt,
+		}
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"message_id": messageID,
+		"chain":      out,
+		"complete":   complete,
+	})
+}
+
+// GetReactionUsers handles GET /api/v1/messages/{id}/reactions/{emoji}:
+// who reacted with emoji, earliest first, in pages of ?limit= (default 50,
+// max 100). next is the cursor for ?after= when more remain. The emoji
+// segment is URL-encoded.
+func (h *MessageHandler) GetReactionUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	// /api/v1/messages/{id}/reactions/{emoji}
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) != 7 || parts[4] == "" || parts[6] == "" {
+		writeError(w, http.StatusBadRequest, "invalid path")
+		return
+	}
+	messageID, emoji := parts[4], parts[6]
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 && n <= 100 {
+			limit = n
+		}
+	}
+
+	msg, err := h.DB.GetMessageByID(messageID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if msg == nil {
+		writeError(w, http.StatusNotFound, "message not found")
+		return
+	}
+	user := UserFromContext(r.Context())
+	if canAccess, _ := h.DB.CanAccessChannel(msg.ChannelID, user.ID, user.IsAdmin); !canAccess {
+		writeError(w, http.StatusForbidden, "not a member of this channel")
+		return
+	}
+
+	count, err := h.DB.CountEmojiReactions(messageID, emoji)
+	if err != nil {
+		log.Printf("count reactions: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	// One extra row tells whether another page follows
+	users, err := h.DB.GetReactionUsers(messageID, emoji, limit+1, r.URL.Query().Get("after"))
+	if err != nil {
+		log.Printf("get reaction users: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	var next *string
+	if len(users) > limit {
+		users = users[:limit]
+		next = &users[limit-1].ID
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"message_id": messageID,
+		"emoji":      emoji,
+		"count":      count,
+		"users":      users,
+		"next":       next,
+	})
+}
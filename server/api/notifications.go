@@ -0,0 +1,120 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/kalman/voicechat/db"
+	"github.com/kalman/voicechat/ws"
+)
+
+type NotificationsHandler struct {
+	DB  *db.DB
+	Hub *ws.Hub
+}
+
+// List returns the caller's notifications, read and unread, newest first.
+// Paginate with ?before=<notificationID>; ?limit defaults to 50 (max 100).
+// X-Unread-Count carries the caller's total unread count.
+func (h *NotificationsHandler) List(w http.ResponseWriter, r *http.Request) {
+	user := UserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	limit := 50
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 && n <= 100 {
+			limit = n
+		}
+	}
+	var before *string
+	if b := r.URL.Query().Get("before"); b != "" {
+		before = &b
+	}
+
+	notifs, err := h.DB.GetNotifications(user.ID, limit, before)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get notifications")
+		return
+	}
+	unread, err := h.DB.CountUnreadNotifications(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to get notifications")
+		return
+	}
+
+	result := make([]ws.NotificationPayload, len(notifs))
+	for i, n := range notifs {
+		result[i] = ws.NotificationPayload{
+			ID:        n.ID,
+			Type:      n.Type,
+			Data:      n.Data,
+			Read:      n.Read,
+			CreatedAt: n.CreatedAt,
+		}
+	}
+	w.Header().Set("X-Unread-Count", strconv.Itoa(unread))
+	writeJSON(w, http.StatusOK, result)
+}
+
+// ClearAll deletes every notification the caller has.
+func (h *NotificationsHandler) ClearAll(w http.ResponseWriter, r *http.Request) {
+	user := UserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	n, err := h.DB.DeleteAllNotifications(user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to clear notifications")
+		return
+	}
+	h.notifyDeleted(user.ID, ws.NotificationsDeletedPayload{All: true})
+	writeJSON(w, http.StatusOK, map[string]int{"deleted": n})
+}
+
+// Delete removes one notification: DELETE /api/v1/notifications/{id}.
+func (h *NotificationsHandler) Delete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	user := UserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/notifications/")
+	if id == "" || strings.Contains(id, "/") {
+		writeError(w, http.StatusBadRequest, "missing notification ID")
+		return
+	}
+
+	found, err := h.DB.DeleteNotification(id, user.ID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to delete notification")
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "notification not found")
+		return
+	}
+	h.notifyDeleted(user.ID, ws.NotificationsDeletedPayload{IDs: []string{id}})
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+// notifyDeleted keeps the user's other open clients in sync.
+func (h *NotificationsHandler) notifyDeleted(userID string, payload ws.NotificationsDeletedPayload) {
+	if h.Hub == nil {
+		return
+	}
+	msg, err := ws.NewMessage("notifications_deleted", payload)
+	if err != nil {
+		return
+	}
+	h.Hub.SendTo(userID, msg)
+}
@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/kalman/voicechat/crypto"
+	"github.com/kalman/voicechat/db"
+	"github.com/kalman/voicechat/webhook"
+)
+
+type OutgoingWebhookHandler struct {
+	DB         *db.DB
+	Dispatcher *webhook.Dispatcher
+	EncKey     []byte
+}
+
+// outgoingWebhookCreated is the create response; the secret is only ever
+// returned here.
+type outgoingWebhookCreated struct {
+	db.OutgoingWebhook
+	Secret string `json:"secret"`
+}
+
+// Handle dispatches /api/v1/admin/outgoing-webhooks (GET list, POST
+// create), /api/v1/admin/outgoing-webhooks/{id} (DELETE) and
+// /api/v1/admin/outgoing-webhooks/{id}/failures (GET dead letters).
+func (h *OutgoingWebhookHandler) Handle(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 64*1024) // 64KB
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/outgoing-webhooks"), "/")
+	parts := strings.Split(rest, "/")
+
+	switch {
+	case rest == "" && r.Method == http.MethodGet:
+		h.list(w)
+	case rest == "" && r.Method == http.MethodPost:
+		h.create(w, r)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		h.delete(w, r, parts[0])
+	case len(parts) == 2 && parts[1] == "failures" && r.Method == http.MethodGet:
+		h.failures(w, parts[0])
+	case rest == "" || len(parts) <= 2:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (h *OutgoingWebhookHandler) list(w http.ResponseWriter) {
+	hooks, err := h.DB.ListOutgoingWebhooks()
+	if err != nil {
+		log.Printf("list outgoing webhooks: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, hooks)
+}
+
+func (h *OutgoingWebhookHandler) create(w http.ResponseWriter, r *http.Request) {
+	user := UserFromContext(r.Context())
+
+	var req struct {
+		Name   string   `json:"name"`
+		URL    string   `json:"url"`
+		Events []string `json:"events"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Name) > 64 {
+		writeError(w, http.StatusBadRequest, "name must be 1-64 characters")
+		return
+	}
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		writeError(w, http.StatusBadRequest, "url must be an absolute http(s) URL")
+		return
+	}
+	if len(req.Events) == 0 {
+		writeError(w, http.StatusBadRequest, "events must list at least one of: "+strings.Join(webhook.SupportedEvents, ", "))
+		return
+	}
+	seen := map[string]bool{}
+	var events []string
+	for _, e := range req.Events {
+		if !webhook.IsSupportedEvent(e) {
+			writeError(w, http.StatusBadRequest, "unsupported event "+e+"; must be one of: "+strings.Join(webhook.SupportedEvents, ", "))
+			return
+		}
+		if !seen[e] {
+			seen[e] = true
+			events = append(events, e)
+		}
+	}
+
+	secret, err := webhook.GenerateSecret()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	secretEnc, err := crypto.Encrypt(h.EncKey, secret)
+	if err != nil {
+		log.Printf("encrypt webhook secret: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	hook, err := h.DB.CreateOutgoingWebhook(uuid.New().String(), req.Name, req.URL, secretEnc, events, user.ID)
+	if err != nil {
+		log.Printf("create outgoing webhook: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if err := h.Dispatcher.Reload(); err != nil {
+		log.Printf("reload outgoing webhooks: %v", err)
+	}
+	log.Printf("AUDIT: admin %s created outgoing webhook %s (%s) for %s", user.ID, hook.ID, hook.Name, strings.Join(events, ","))
+	writeJSON(w, http.StatusCreated, outgoingWebhookCreated{OutgoingWebhook: *hook, Secret: secret})
+}
+
+func (h *OutgoingWebhookHandler) delete(w http.ResponseWriter, r *http.Request, id string) {
+	found, err := h.DB.DeleteOutgoingWebhook(id)
+	if err != nil {
+		log.Printf("delete outgoing webhook: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if !found {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+	if err := h.Dispatcher.Reload(); err != nil {
+		log.Printf("reload outgoing webhooks: %v", err)
+	}
+	if user := UserFromContext(r.Context()); user != nil {
+		log.Printf("AUDIT: admin %s deleted outgoing webhook %s", user.ID, id)
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+}
+
+func (h *OutgoingWebhookHandler) failures(w http.ResponseWriter, id string) {
+	hook, err := h.DB.GetOutgoingWebhook(id)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if hook == nil {
+		writeError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+	failures, err := h.DB.GetOutgoingWebhookFailures(id, 0)
+	if err != nil {
+		log.Printf("get webhook failures: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	writeJSON(w, http.StatusOK, failures)
+}
@@ -0,0 +1,66 @@
+package api
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/kalman/voicechat/db"
+)
+
+// checkPassword returns a message listing every rule in policy that
+// password fails, or "" if it passes. An empty password means "no
+// password" and is only rejected when the policy requires one.
+func checkPassword(policy db.PasswordPolicy, password string) string {
+	if password == "" {
+		if policy.RequirePassword {
+			return "password is required"
+		}
+		return ""
+	}
+	if len(password) > db.MaxPasswordLength {
+		return fmt.Sprintf("password must be %d characters or less", db.MaxPasswordLength)
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	var unmet []string
+	if n := len([]rune(password)); n < policy.MinLength {
+		unmet = append(unmet, fmt.Sprintf("be at least %d characters", policy.MinLength))
+	}
+	if policy.RequireMixedCase && !(hasUpper && hasLower) {
+		unmet = append(unmet, "contain both uppercase and lowercase letters")
+	}
+	if policy.RequireDigit && !hasDigit {
+		unmet = append(unmet, "contain a digit")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		unmet = append(unmet, "contain a symbol")
+	}
+	if len(unmet) == 0 {
+		return ""
+	}
+	return "password must " + strings.Join(unmet, ", ")
+}
+
+// validatePassword checks password against the server's current policy.
+func validatePassword(database *db.DB, password string) string {
+	policy, err := database.GetPasswordPolicy()
+	if err != nil {
+		// A corrupt setting shouldn't lock everyone out; the defaults still apply
+		policy = db.PasswordPolicy{MinLength: db.DefaultPasswordMinLength}
+	}
+	return checkPassword(policy, password)
+}
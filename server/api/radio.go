@@ -16,6 +16,12 @@ type RadioHandler struct {
 	DB    *db.DB
 	Store *storage.FileStore
 	Hub   *ws.Hub
+
+	// Transcode is the codec uploads are re-encoded to ("opus" or "aac"),
+	// or "" to store them as uploaded
+	Transcode        string
+	TranscodeBitrate int  // bits/s
+	KeepOriginals    bool // keep the untouched upload beside a transcode
 }
 
 type radioTrackResponse struct {
@@ -86,6 +92,13 @@ func (h *RadioHandler) UploadTrack(w http.ResponseWriter, r *http.Request) {
 	relPath, err := h.Store.StoreAudio(file, mimeType)
 	if err != nil {
 		log.Printf("radio track upload store error: %v", err)
+		if rejectInfected(w, user, header.Filename, err) {
+			return
+		}
+		if storage.IsDiskFull(err) {
+			writeError(w, http.StatusInsufficientStorage, "server storage is full")
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to store file")
 		return
 	}
@@ -94,10 +107,10 @@ func (h *RadioHandler) UploadTrack(w http.ResponseWriter, r *http.Request) {
 	if d := r.FormValue("duration"); d != "" {
 		duration, _ = strconv.ParseFloat(d, 64)
 	}
-	// Server-side fallback: parse duration from file if client didn't provide it
-	if duration <= 0 {
-		duration = h.Store.GetAudioDuration(relPath, mimeType)
-	}
+
+	// Re-encoding can take minutes; the track is served as uploaded until
+	// the worker swaps in the transcode
+	transcode := h.Transcode != "" && storage.NeedsTranscode(mimeType, h.Transcode)
 
 	var waveform *string
 	if wf := r.FormValue("waveform"); wf != "" {
@@ -105,6 +118,10 @@ func (h *RadioHandler) UploadTrack(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusBadRequest, "waveform data too large")
 			return
 		}
+		if !storage.ValidWaveform(wf) {
+			writeError(w, http.StatusBadRequest, "waveform must be up to 200 ints in 0-100")
+			return
+		}
 		waveform = &wf
 	}
 
@@ -126,6 +143,12 @@ func (h *RadioHandler) UploadTrack(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// The transcode and whatever the client couldn't supply are done after
+	// responding, then announced with radio_playlist_tracks
+	if transcode || duration <= 0 || waveform == nil {
+		go h.analyzeTrack(*track, transcode, duration <= 0, waveform == nil)
+	}
+
 	url := "/" + strings.ReplaceAll(relPath, "\\", "/")
 	writeJSON(w, http.StatusOK, radioTrackResponse{
 		ID:        trackID,
@@ -139,6 +162,134 @@ func (h *RadioHandler) UploadTrack(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// trackAnalysis bounds how many uploads are parsed or run through ffmpeg
+// at once.
+var trackAnalysis = make(chan struct{}, 2)
+
+// analyzeTrack re-encodes a new track and/or fills in its duration and
+// waveform from its file, and broadcasts the playlist once anything is
+// saved. Nothing is broadcast if nothing changed or the track is gone.
+func (h *RadioHandler) analyzeTrack(track db.RadioTrack, transcode, needDuration, needWaveform bool) {
+	trackAnalysis <- struct{}{}
+	defer func() { <-trackAnalysis }()
+
+	changed := false
+	if transcode {
+		newPath, newMIME, newSize, err := h.Store.TranscodeAudio(track.Path, h.Transcode, h.TranscodeBitrate)
+		if err != nil {
+			// Keep the upload as it came; it may still play in most browsers
+			log.Printf("radio track transcode %s: %v", track.Filename, err)
+		} else {
+			var originalPath *string
+			if h.KeepOriginals {
+				kept := track.Path
+				originalPath = &kept
+			}
+			exists, err := h.DB.SetTrackFile(track.ID, newPath, newMIME, newSize, originalPath)
+			if err != nil || !exists {
+				if err != nil {
+					log.Printf("radio track %s file: %v", track.ID, err)
+				}
+				if inUse, err := h.DB.FileInUse(newPath); err == nil && !inUse {
+					h.Store.RemoveFile(newPath)
+				}
+				return
+			}
+			// Identical uploads share one file; keep any another row uses
+			if !h.KeepOriginals {
+				if inUse, err := h.DB.FileInUse(track.Path); err == nil && !inUse {
+					h.Store.RemoveFile(track.Path)
+				}
+			}
+			track.Path, track.MimeType = newPath, newMIME
+			// The encoder may pad or trim; time the file listeners will get
+			needDuration = true
+			changed = true
+		}
+	}
+	if needDuration {
+		if d := h.Store.GetAudioDuration(track.Path, track.MimeType); d > 0 {
+			if err := h.DB.SetTrackDuration(track.ID, d); err != nil {
+				log.Printf("radio track %s duration: %v", track.ID, err)
+			} else {
+				changed = true
+			}
+		}
+	}
+	if needWaveform {
+		if wf := h.Store.GetWaveform(track.Path, track.MimeType); wf != nil {
+			if err := h.DB.SetTrackWaveform(track.ID, wf); err != nil {
+				log.Printf("radio track %s waveform: %v", track.ID, err)
+			} else {
+				changed = true
+			}
+		}
+	}
+	if !changed {
+		return
+	}
+	if _, err := h.DB.GetTrackByID(track.ID); err != nil {
+		return // deleted while we worked
+	}
+	h.Hub.BroadcastPlaylistTracks(track.PlaylistID)
+}
+
+// RegenerateWaveform handles POST /api/v1/radio/tracks/{track_id}/waveform:
+// recomputes the track's peaks from its file, for tracks uploaded without
+// one. Allowed for the playlist owner and admins.
+func (h *RadioHandler) RegenerateWaveform(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	user := UserFromContext(r.Context())
+
+	// Expected: ["", "api", "v1", "radio", "tracks", "{id}", "waveform"]
+	parts := strings.Split(r.URL.Path, "/")
+	if len(parts) != 7 {
+		writeError(w, http.StatusBadRequest, "missing track id")
+		return
+	}
+	trackID := parts[5]
+
+	track, err := h.DB.GetTrackByID(trackID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "track not found")
+		return
+	}
+	if !user.IsAdmin {
+		playlist, err := h.DB.GetPlaylistByID(track.PlaylistID)
+		if err != nil || playlist.UserID != user.ID {
+			writeError(w, http.StatusForbidden, "not your track")
+			return
+		}
+	}
+
+	waveform := h.Store.GetWaveform(track.Path, track.MimeType)
+	if waveform == nil {
+		writeError(w, http.StatusUnprocessableEntity, "cannot decode this track")
+		return
+	}
+	if err := h.DB.SetTrackWaveform(trackID, waveform); err != nil {
+		log.Printf("regenerate waveform: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to save waveform")
+		return
+	}
+	h.Hub.BroadcastPlaylistTracks(track.PlaylistID)
+
+	writeJSON(w, http.StatusOK, radioTrackResponse{
+		ID:        track.ID,
+		Filename:  track.Filename,
+		URL:       "/" + strings.ReplaceAll(track.Path, "\\", "/"),
+		MimeType:  track.MimeType,
+		SizeBytes: track.SizeBytes,
+		Duration:  track.Duration,
+		Position:  track.Position,
+		Waveform:  waveform,
+	})
+}
+
 // DeleteTrack handles DELETE /api/v1/radio/tracks/{track_id}
 func (h *RadioHandler) DeleteTrack(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodDelete {
@@ -169,9 +320,7 @@ func (h *RadioHandler) DeleteTrack(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	h.Store.RemoveFile(track.Path)
-
-	if err := h.DB.DeleteRadioTrack(trackID); err != nil {
+	if err := h.Hub.DeleteRadioTrack(track); err != nil {
 		writeError(w, http.StatusInternalServerError, "failed to delete track")
 		return
 	}
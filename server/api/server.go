@@ -0,0 +1,202 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/kalman/voicechat/captcha"
+	"github.com/kalman/voicechat/db"
+	"github.com/kalman/voicechat/email"
+	"github.com/kalman/voicechat/storage"
+	"github.com/kalman/voicechat/ws"
+)
+
+// defaultServerName is shown until an admin sets server_name.
+const defaultServerName = "Le Faux Pain"
+
+const maxServerIconSize = 2 * 1024 * 1024
+
+type ServerHandler struct {
+	DB            *db.DB
+	Hub           *ws.Hub
+	Store         *storage.FileStore
+	EmailService  *email.EmailService
+	Captcha       *captcha.Service
+	MaxUploadSize int64
+	PublicURL     string // magic links are off when empty
+}
+
+// serverBranding returns the admin-set name and icon, as sent in
+// /server/info and server_update events.
+func serverBranding(database *db.DB) map[string]any {
+	name, _ := database.GetSetting("server_name")
+	if name == "" {
+		name = defaultServerName
+	}
+	var iconURL *string
+	if icon, _ := database.GetSetting("server_icon"); icon != "" {
+		u := "/" + strings.ReplaceAll(icon, "\\", "/")
+		iconURL = &u
+	}
+	return map[string]any{
+		"server_name": name,
+		"icon_url":    iconURL,
+	}
+}
+
+// broadcastServerUpdate pushes the current branding to every client so
+// the name and icon refresh without a reload.
+func broadcastServerUpdate(database *db.DB, hub *ws.Hub) {
+	msg, _ := ws.NewMessage("server_update", serverBranding(database))
+	hub.BroadcastAll(msg)
+}
+
+// Info returns public, unauthenticated server details the login/signup
+// page needs before the user has an account.
+func (h *ServerHandler) Info(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	registrationMode, err := h.DB.GetRegistrationMode()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	emailRequired, _ := h.EmailService.IsVerificationEnabled()
+	passwordPolicy, _ := h.DB.GetPasswordPolicy()
+
+	info := serverBranding(h.DB)
+	info["registration_mode"] = registrationMode
+	info["email_required"] = emailRequired
+	info["password_policy"] = passwordPolicy
+	// Public half of the CAPTCHA config, for rendering the widget; null
+	// when registration doesn't need one.
+	info["captcha"] = nil
+	if cc, err := h.Captcha.Config(); err == nil && cc != nil {
+		info["captcha"] = map[string]string{"provider": cc.Provider, "site_key": cc.SiteKey}
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// ClientConfig returns, unauthenticated, the features and limits a client
+// needs to shape its UI: nothing here is secret, and it's all enforced
+// server-side regardless.
+func (h *ServerHandler) ClientConfig(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	registrationMode, err := h.DB.GetRegistrationMode()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	verification, _ := h.EmailService.IsVerificationEnabled()
+	providerConfig, _ := h.EmailService.GetProviderConfig()
+	emailEnabled := providerConfig != nil && providerConfig.Provider != ""
+	captchaConfig, _ := h.Captcha.Config()
+	allowedReactions, _ := h.DB.GetAllowedReactions()
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"registration_mode":  registrationMode,
+		"email_verification": verification,
+		"allowed_reactions":  allowedReactions,
+		"features": map[string]bool{
+			"email":       emailEnabled,
+			"magic_links": emailEnabled && h.PublicURL != "",
+			"voice":       h.Hub.SFU != nil,
+			"captcha":     captchaConfig != nil,
+		},
+		"limits": map[string]any{
+			"max_message_length":     ws.MaxMessageLength,
+			"max_edit_length":        ws.MaxEditLength,
+			"max_upload_bytes":       h.MaxUploadSize,
+			"max_mentions":           h.Hub.MaxMentions,
+			"max_reaction_emojis":    h.Hub.MaxReactionEmojis,
+			"max_reactions_per_user": h.Hub.MaxReactionsPerUser,
+			"max_ws_message_bytes":   h.Hub.MaxMessageBytes,
+		},
+	})
+}
+
+// Icon sets (POST, multipart "file") or clears (DELETE) the server icon.
+func (h *ServerHandler) Icon(w http.ResponseWriter, r *http.Request) {
+	user := UserFromContext(r.Context())
+
+	switch r.Method {
+	case http.MethodPost:
+		r.Body = http.MaxBytesReader(w, r.Body, maxServerIconSize)
+		if err := r.ParseMultipartForm(maxServerIconSize); err != nil {
+			writeError(w, http.StatusBadRequest, "file too large")
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "missing file")
+			return
+		}
+		defer file.Close()
+
+		mimeType, err := storage.DetectMIME(file)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "cannot read file")
+			return
+		}
+		if !h.Store.IsAllowedMIME(mimeType) {
+			writeError(w, http.StatusBadRequest, "icon must be an image")
+			return
+		}
+		stored, err := h.Store.Store(file, mimeType)
+		if err != nil {
+			log.Printf("store server icon: %v", err)
+			if rejectInfected(w, user, header.Filename, err) {
+				return
+			}
+			if storage.IsDiskFull(err) {
+				writeError(w, http.StatusInsufficientStorage, "server storage is full")
+				return
+			}
+			writeError(w, http.StatusInternalServerError, "failed to store file")
+			return
+		}
+		old, _ := h.DB.GetSetting("server_icon")
+		if err := h.DB.SetSetting("server_icon", stored.Path); err != nil {
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		h.removeOldIcon(old)
+		log.Printf("AUDIT: admin %s updated server icon", user.ID)
+	case http.MethodDelete:
+		old, _ := h.DB.GetSetting("server_icon")
+		if err := h.DB.DeleteSetting("server_icon"); err != nil {
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		h.removeOldIcon(old)
+		log.Printf("AUDIT: admin %s removed server icon", user.ID)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	broadcastServerUpdate(h.DB, h.Hub)
+	writeJSON(w, http.StatusOK, serverBranding(h.DB))
+}
+
+// removeOldIcon deletes a replaced icon's file unless it is the new icon
+// or an upload elsewhere shares it.
+func (h *ServerHandler) removeOldIcon(relPath string) {
+	if relPath == "" {
+		return
+	}
+	if inUse, err := h.DB.FileInUse(relPath); err != nil || inUse {
+		return
+	}
+	if err := h.Store.RemoveFile(relPath); err != nil {
+		log.Printf("remove old server icon %s: %v", relPath, err)
+	}
+}
@@ -1,6 +1,7 @@
 package api
 
 import (
+	"log"
 	"net/http"
 	"strings"
 
@@ -23,6 +24,7 @@ type uploadResponse struct {
 	MimeType string  `json:"mime_type"`
 	Width    *int    `json:"width"`
 	Height   *int    `json:"height"`
+	Spoiler  bool    `json:"spoiler"`
 }
 
 func (h *UploadHandler) Upload(w http.ResponseWriter, r *http.Request) {
@@ -62,6 +64,14 @@ func (h *UploadHandler) Upload(w http.ResponseWriter, r *http.Request) {
 
 	stored, err := h.Store.Store(file, mimeType)
 	if err != nil {
+		log.Printf("upload store error: %v", err)
+		if rejectInfected(w, user, header.Filename, err) {
+			return
+		}
+		if storage.IsDiskFull(err) {
+			writeError(w, http.StatusInsufficientStorage, "server storage is full")
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to store file")
 		return
 	}
@@ -74,6 +84,7 @@ func (h *UploadHandler) Upload(w http.ResponseWriter, r *http.Request) {
 		SizeBytes:  header.Size,
 		MimeType:   mimeType,
 		UploadedBy: &user.ID,
+		Spoiler:    r.FormValue("spoiler") == "true" || r.FormValue("spoiler") == "1",
 	}
 	if stored.Width > 0 {
 		w2 := stored.Width
@@ -97,6 +108,7 @@ func (h *UploadHandler) Upload(w http.ResponseWriter, r *http.Request) {
 		MimeType: mimeType,
 		Width:    att.Width,
 		Height:   att.Height,
+		Spoiler:  att.Spoiler,
 	}
 	if att.ThumbPath != nil {
 		t := "/" + strings.ReplaceAll(*att.ThumbPath, "\\", "/")
@@ -105,3 +117,16 @@ func (h *UploadHandler) Upload(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, resp)
 }
+
+// rejectInfected answers an upload clamd flagged with 400 and logs the
+// detection, reporting whether it did. Other store errors are left to the
+// caller.
+func rejectInfected(w http.ResponseWriter, user *db.User, filename string, err error) bool {
+	sig, ok := storage.IsInfected(err)
+	if !ok {
+		return false
+	}
+	log.Printf("AUDIT: rejected upload %q from user %s (%s): %s", filename, user.ID, user.Username, sig)
+	writeError(w, http.StatusBadRequest, "file rejected by virus scan")
+	return true
+}
@@ -0,0 +1,131 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/kalman/voicechat/db"
+	"github.com/kalman/voicechat/ws"
+)
+
+// maxUsersPageSize caps how many members one page of the member list returns.
+const maxUsersPageSize = 200
+
+// maxUserSearchResults caps one user search (mention autocomplete).
+const maxUserSearchResults = 20
+
+type UserHandler struct {
+	DB  *db.DB
+	Hub *ws.Hub
+}
+
+type memberPayload struct {
+	ID        string  `json:"id"`
+	Username  string  `json:"username"`
+	AvatarURL *string `json:"avatar_url"`
+	IsAdmin   bool    `json:"is_admin"`
+}
+
+// List returns one page of approved members in registration order. Pass the
+// returned next cursor as ?after= to fetch the following page; next is null
+// on the last page.
+func (h *UserHandler) List(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	limit := 100
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 && n <= maxUsersPageSize {
+			limit = n
+		}
+	}
+
+	var after *string
+	if a := r.URL.Query().Get("after"); a != "" {
+		after = &a
+	}
+
+	// Fetch one extra row to know whether another page follows
+	users, err := h.DB.ListApprovedUsers(limit+1, after)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	total, err := h.DB.CountApprovedUsers()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	var next *string
+	if len(users) > limit {
+		users = users[:limit]
+		next = &users[limit-1].ID
+	}
+
+	payloads := make([]memberPayload, len(users))
+	for i, u := range users {
+		payloads[i] = memberPayload{
+			ID:        u.ID,
+			Username:  u.Username,
+			AvatarURL: u.AvatarURL,
+			IsAdmin:   u.IsAdmin,
+		}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"users": payloads,
+		"total": total,
+		"next":  next,
+	})
+}
+
+type userSearchPayload struct {
+	memberPayload
+	Online bool `json:"online"`
+}
+
+// Search returns approved members whose username starts with ?q=
+// (case-insensitive), online ones first, then alphabetical. ?limit=
+// defaults to 10, capped at maxUserSearchResults. It backs @-mention
+// autocomplete so clients don't need the whole member list.
+func (h *UserHandler) Search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	limit := 10
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 {
+			limit = min(n, maxUserSearchResults)
+		}
+	}
+
+	online := h.Hub.OnlineUserIDs()
+	users, err := h.DB.SearchApprovedUsers(r.URL.Query().Get("q"), online, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+
+	onlineSet := make(map[string]bool, len(online))
+	for _, id := range online {
+		onlineSet[id] = true
+	}
+	payloads := make([]userSearchPayload, len(users))
+	for i, u := range users {
+		payloads[i] = userSearchPayload{
+			memberPayload: memberPayload{
+				ID:        u.ID,
+				Username:  u.Username,
+				AvatarURL: u.AvatarURL,
+				IsAdmin:   u.IsAdmin,
+			},
+			Online: onlineSet[u.ID],
+		}
+	}
+	writeJSON(w, http.StatusOK, payloads)
+}
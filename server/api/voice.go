@@ -0,0 +1,28 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/kalman/voicechat/config"
+)
+
+type VoiceHandler struct {
+	Config *config.Config
+}
+
+// ICEServers returns the STUN/TURN servers browsers should use for voice
+// and screen share, matching the ones the SFU itself uses. TURN
+// credentials are short-lived and scoped to the requesting user when a
+// TURN secret is configured, so clients should fetch this before joining.
+func (h *VoiceHandler) ICEServers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	user := UserFromContext(r.Context())
+	writeJSON(w, http.StatusOK, map[string]any{
+		"ice_servers": h.Config.ICEServers(user.ID),
+		"ttl":         h.Config.TURNCredTTL,
+	})
+}
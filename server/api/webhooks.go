@@ -14,6 +14,8 @@ import (
 type WebhookHandler struct {
 	DB  *db.DB
 	Hub *ws.Hub
+	// ChannelRL limits posts per channel webhook, keyed by webhook ID
+	ChannelRL *IPRateLimiter
 }
 
 type incomingWebhookRequest struct {
@@ -96,7 +98,7 @@ func (h *WebhookHandler) Incoming(w http.ResponseWriter, r *http.Request) {
 	// Create message
 	msgID := uuid.New().String()
 	content := req.Content
-	msg, err := h.DB.CreateMessage(msgID, ch.ID, botUser.ID, &content, nil)
+	msg, err := h.DB.CreateMessage(msgID, ch.ID, botUser.ID, &content, nil, nil)
 	if err != nil {
 		log.Printf("create webhook message: %v", err)
 		writeError(w, http.StatusInternalServerError, "failed to create message")
@@ -114,6 +116,7 @@ func (h *WebhookHandler) Incoming(w http.ResponseWriter, r *http.Request) {
 		Content:     msg.Content,
 		Attachments: []ws.AttachmentPayload{},
 		Mentions:    []string{},
+		Entities:    ws.ParseEntities(msg.Content),
 		CreatedAt:   msg.CreatedAt,
 	})
 	h.Hub.BroadcastAll(broadcast)
@@ -200,3 +203,201 @@ func (h *WebhookHandler) AdminDeleteKey(w http.ResponseWriter, r *http.Request)
 
 	writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
 }
+
+// HandleChannelWebhooks dispatches /api/v1/channels/{id}/webhooks (GET
+// list, POST create) and /api/v1/channels/{id}/webhooks/{webhookID}
+// (DELETE revoke). Channel managers and admins only.
+func (h *WebhookHandler) HandleChannelWebhooks(w http.ResponseWriter, r *http.Request) {
+	r.Body = http.MaxBytesReader(w, r.Body, 64*1024) // 64KB
+
+	user := UserFromContext(r.Context())
+	if user == nil {
+		writeError(w, http.StatusUnauthorized, "unauthorized")
+		return
+	}
+
+	// /api/v1/channels/{id}/webhooks[/{webhookID}]
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) < 5 || parts[4] != "webhooks" {
+		http.NotFound(w, r)
+		return
+	}
+	channelID := parts[3]
+
+	ch, err := h.DB.GetChannelByID(channelID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "channel not found")
+		return
+	}
+	if !user.IsAdmin {
+		isManager, err := h.DB.IsChannelManager(channelID, user.ID)
+		if err != nil || !isManager {
+			writeError(w, http.StatusForbidden, "must be channel manager or admin")
+			return
+		}
+	}
+
+	if len(parts) == 6 {
+		if r.Method != http.MethodDelete {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		found, err := h.DB.DeleteIncomingWebhook(parts[5], channelID)
+		if err != nil {
+			log.Printf("delete incoming webhook: %v", err)
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		if !found {
+			writeError(w, http.StatusNotFound, "webhook not found")
+			return
+		}
+		log.Printf("AUDIT: user %s (%s) revoked webhook %s in channel %s", user.ID, user.Username, parts[5], channelID)
+		writeJSON(w, http.StatusOK, map[string]string{"status": "deleted"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		hooks, err := h.DB.ListIncomingWebhooks(channelID)
+		if err != nil {
+			log.Printf("list incoming webhooks: %v", err)
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		writeJSON(w, http.StatusOK, hooks)
+	case http.MethodPost:
+		if ch.Type != "text" {
+			writeError(w, http.StatusBadRequest, "channel is not a text channel")
+			return
+		}
+		var req struct {
+			Name string `json:"name"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid JSON body")
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" || len(req.Name) > 32 {
+			writeError(w, http.StatusBadRequest, "name must be 1-32 characters")
+			return
+		}
+		hook, err := h.DB.CreateIncomingWebhook(channelID, req.Name, user.ID)
+		if err != nil {
+			log.Printf("create incoming webhook: %v", err)
+			writeError(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+		log.Printf("AUDIT: user %s (%s) created webhook %s in channel %s", user.ID, user.Username, hook.ID, channelID)
+		writeJSON(w, http.StatusCreated, hook)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+type channelWebhookRequest struct {
+	Content  string `json:"content"`
+	Username string `json:"username"`
+}
+
+// PostChannelWebhook handles POST /api/v1/webhooks/{id}/{token}: the token
+// is the credential, so no other auth is needed. The message is authored
+// by the bot user but shown under the webhook's name, or username if given.
+func (h *WebhookHandler) PostChannelWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, 1024*1024) // 1MB
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/api/v1/webhooks/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	hook, err := h.DB.ValidateIncomingWebhook(parts[0], parts[1])
+	if err != nil {
+		log.Printf("validate incoming webhook: %v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if hook == nil {
+		writeError(w, http.StatusUnauthorized, "invalid webhook")
+		return
+	}
+	if h.ChannelRL != nil && !h.ChannelRL.Allow(hook.ID) {
+		writeError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return
+	}
+
+	var req channelWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+	if req.Content == "" {
+		writeError(w, http.StatusBadRequest, "content is required")
+		return
+	}
+	if len(req.Content) > 4000 {
+		writeError(w, http.StatusBadRequest, "content exceeds 4000 character limit")
+		return
+	}
+	name := hook.Name
+	if u := strings.TrimSpace(req.Username); u != "" {
+		if len(u) > 32 {
+			writeError(w, http.StatusBadRequest, "username must be at most 32 characters")
+			return
+		}
+		name = u
+	}
+
+	ch, err := h.DB.GetChannelByID(hook.ChannelID)
+	if err != nil {
+		writeError(w, http.StatusNotFound, "channel not found")
+		return
+	}
+
+	botUser, err := h.DB.GetBotUser()
+	if err != nil || botUser == nil {
+		log.Printf("get bot user: %v", err)
+		writeError(w, http.StatusInternalServerError, "bot user not found")
+		return
+	}
+
+	content := req.Content
+	msg, err := h.DB.CreateWebhookMessage(uuid.New().String(), ch.ID, botUser.ID, name, &content)
+	if err != nil {
+		log.Printf("create webhook message: %v", err)
+		writeError(w, http.StatusInternalServerError, "failed to create message")
+		return
+	}
+
+	broadcast, _ := ws.NewMessage("message_create", ws.MessageCreatePayload{
+		ID:        msg.ID,
+		ChannelID: msg.ChannelID,
+		Author: ws.UserPayload{
+			ID:       botUser.ID,
+			Username: name,
+		},
+		Content:     msg.Content,
+		Attachments: []ws.AttachmentPayload{},
+		Mentions:    []string{},
+		Entities:    ws.ParseEntities(msg.Content),
+		CreatedAt:   msg.CreatedAt,
+	})
+	if ch.Visibility != "public" {
+		h.Hub.BroadcastToMembers(broadcast, ch.ID)
+	} else {
+		h.Hub.BroadcastAll(broadcast)
+	}
+
+	writeJSON(w, http.StatusCreated, map[string]string{
+		"id":         msg.ID,
+		"channel_id": ch.ID,
+		"created_at": msg.CreatedAt,
+	})
+}
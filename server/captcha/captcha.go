@@ -0,0 +1,154 @@
+// Package captcha verifies registration CAPTCHA tokens against hCaptcha or
+// Cloudflare Turnstile.
+package captcha
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/kalman/voicechat/crypto"
+	"github.com/kalman/voicechat/db"
+)
+
+// Providers.
+const (
+	ProviderHCaptcha  = "hcaptcha"
+	ProviderTurnstile = "turnstile"
+	// ProviderTest accepts only the token TestToken, for development and
+	// the validation suite.
+	ProviderTest = "test"
+)
+
+// TestToken is the one token ProviderTest accepts.
+const TestToken = "test-captcha-pass"
+
+var verifyURLs = map[string]string{
+	ProviderHCaptcha:  "https://api.hcaptcha.com/siteverify",
+	ProviderTurnstile: "https://challenges.cloudflare.com/turnstile/v0/siteverify",
+}
+
+// settingKey holds the encrypted Config JSON.
+const settingKey = "captcha_config"
+
+// ErrFailed means the provider rejected the token.
+var ErrFailed = errors.New("captcha verification failed")
+
+// Config is the admin-set CAPTCHA configuration. SiteKey is public; Secret
+// never leaves the server.
+type Config struct {
+	Provider string `json:"provider"`
+	SiteKey  string `json:"site_key"`
+	Secret   string `json:"secret,omitempty"`
+}
+
+// ValidProvider reports whether p is a supported provider.
+func ValidProvider(p string) bool {
+	_, ok := verifyURLs[p]
+	return ok || p == ProviderTest
+}
+
+type Service struct {
+	db     *db.DB
+	encKey []byte
+	client *http.Client
+}
+
+func NewService(database *db.DB, encKey []byte) *Service {
+	return &Service{
+		db:     database,
+		encKey: encKey,
+		client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Config returns the stored configuration, or nil when CAPTCHA is off.
+func (s *Service) Config() (*Config, error) {
+	encrypted, err := s.db.GetSetting(settingKey)
+	if err != nil {
+		return nil, fmt.Errorf("get captcha config: %w", err)
+	}
+	if encrypted == "" {
+		return nil, nil
+	}
+	decrypted, err := crypto.Decrypt(s.encKey, encrypted)
+	if err != nil {
+		return nil, fmt.Errorf("decrypt captcha config: %w", err)
+	}
+	var cfg Config
+	if err := json.Unmarshal([]byte(decrypted), &cfg); err != nil {
+		return nil, fmt.Errorf("parse captcha config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// SetConfig stores cfg, or turns CAPTCHA off when cfg is nil.
+func (s *Service) SetConfig(cfg *Config) error {
+	if cfg == nil {
+		return s.db.DeleteSetting(settingKey)
+	}
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return fmt.Errorf("marshal captcha config: %w", err)
+	}
+	encrypted, err := crypto.Encrypt(s.encKey, string(raw))
+	if err != nil {
+		return fmt.Errorf("encrypt captcha config: %w", err)
+	}
+	return s.db.SetSetting(settingKey, encrypted)
+}
+
+// Verify checks token with the configured provider. It returns nil when
+// CAPTCHA is off, ErrFailed when the token is missing or rejected, and any
+// other error when the provider couldn't be reached.
+func (s *Service) Verify(token, remoteIP string) error {
+	cfg, err := s.Config()
+	if err != nil {
+		return err
+	}
+	if cfg == nil {
+		return nil
+	}
+	if token == "" {
+		return ErrFailed
+	}
+	if cfg.Provider == ProviderTest {
+		if token != TestToken {
+			return ErrFailed
+		}
+		return nil
+	}
+	verifyURL, ok := verifyURLs[cfg.Provider]
+	if !ok {
+		return fmt.Errorf("unknown captcha provider: %s", cfg.Provider)
+	}
+
+	form := url.Values{"secret": {cfg.Secret}, "response": {token}, "sitekey": {cfg.SiteKey}}
+	if remoteIP != "" {
+		form.Set("remoteip", remoteIP)
+	}
+	resp, err := s.client.Post(verifyURL, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("captcha siteverify: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("captcha siteverify returned %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Success    bool     `json:"success"`
+		ErrorCodes []string `json:"error-codes"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("parse captcha siteverify: %w", err)
+	}
+	if !result.Success {
+		return ErrFailed
+	}
+	return nil
+}
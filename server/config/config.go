@@ -1,21 +1,86 @@
 package config
 
 import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// ICEServer is a STUN or TURN entry. The same list configures the SFU's
+// peer connections and is handed to browsers for their RTCPeerConnection,
+// so JSON tags follow the RTCIceServer dictionary.
+type ICEServer struct {
+	URLs       []string `json:"urls"`
+	Username   string   `json:"username,omitempty"`
+	Credential string   `json:"credential,omitempty"`
+}
+
 type Config struct {
-	Port          int
-	DataDir       string
-	MaxUploadSize int64
-	DevMode       bool
-	PublicIP      string
-	STUNServer    string
-	RemoteURL     string // Desktop-only: connect to remote server instead of starting local one
+	Port                int
+	DataDir             string
+	DataDirMode         string // Octal permissions for directories created under DataDir; files get them without execute bits
+	DatabaseURL         string // Postgres URL; empty uses SQLite in DataDir
+	MaxUploadSize       int64
+	ClamdAddr           string // clamd (host:port or Unix socket path) uploads are scanned with; empty disables scanning
+	DevMode             bool
+	CheckDB             bool // Report the database schema version and exit
+	PublicIP            string
+	SFUEndpoints        string // Extra public IPs of this host for voice: comma-separated name=ip pairs
+	NAT1To1IPs          string // Comma-separated external or external/local IPs the default SFU node advertises; replaces PublicIP
+	NATCandidateType    string // How NAT 1:1 IPs are advertised: host (replacing local addresses) or srflx (beside them)
+	ICEUDPPortMin       int    // Lowest UDP port SFU ICE agents bind; 0 with ICEUDPPortMax leaves it to the OS
+	ICEUDPPortMax       int    // Highest UDP port SFU ICE agents bind
+	PublicURL           string // Origin users reach the web client at, e.g. https://chat.example.com; used for emailed links
+	AllowedOrigins      string // Comma-separated extra origins (scheme://host[:port]) trusted for the API and WebSocket
+	STUNServer          string
+	TURNURLs            string // Comma-separated turn:/turns: URLs
+	TURNUsername        string
+	TURNCredential      string
+	TURNSecret          string // coturn static-auth-secret; when set, credentials are minted per request
+	TURNCredTTL         int    // Lifetime of minted TURN credentials, in seconds
+	ICERestartGrace     int    // Seconds a disconnected voice peer gets to recover via ICE restart; 0 disables
+	VoiceIdleTimeout    int    // Seconds a muted/deafened or lone, silent voice peer stays before removal; 0 disables
+	VoiceBitrate        int    // Target Opus bitrate for voice, in bits/s
+	VoiceFEC            bool   // Ask voice senders for Opus in-band FEC
+	WSPingInterval      int    // Seconds between server WebSocket pings; 0 disables the heartbeat
+	WSPingTimeout       int    // Seconds to wait for a pong before dropping the connection
+	RadioSyncInterval   int    // Seconds between radio_position syncs to listeners; 0 disables
+	RadioTranscode      string // Codec radio uploads are re-encoded to with ffmpeg: opus, aac, or off
+	RadioTranscodeRate  int    // Target bitrate for radio transcodes, in bits/s
+	RadioKeepOriginals  bool   // Keep the untouched upload beside a transcoded radio track
+	ShutdownReconnect   int    // Seconds clients are told to wait before reconnecting after a shutdown
+	MaxReactionEmojis   int    // Distinct emoji allowed on one message
+	MaxReactionsPerUser int    // Reactions one user may leave on one message
+	MaxMentions         int    // Distinct users one message may mention; 0 is unlimited
+	ReactionBurstMs     int    // Milliseconds reaction changes to one emoji are merged before broadcast; 0 disables
+	OnlineBurstMs       int    // Milliseconds after a user_online in which arrivals past OnlineBurstSize are batched; 0 disables
+	OnlineBurstSize     int    // user_online events sent individually per burst window before batching
+	WSMaxMessageBytes   int    // Largest inbound WebSocket message accepted
+	WSMaxConnsPerIP     int    // Open WebSocket connections allowed per client IP; 0 is unlimited
+	WSMaxConns          int    // Open WebSocket connections allowed in total; 0 is unlimited
+	PasswordHash        string // Algorithm for new password hashes: bcrypt or argon2id
+	BcryptCost          int    // bcrypt work factor for new hashes; lower-cost hashes are upgraded on login
+	AdminUsername       string // Admin account created at startup if no user has this name; empty seeds none
+	AdminPassword       string // Password for a seeded AdminUsername
+	FirstUserAdmin      bool   // The first account registered on an empty server becomes an approved admin
+	NotificationDays    int    // Read notifications older than this many days are pruned; 0 keeps them
+	MaxNotifications    int    // Newest notifications kept per user; 0 is unlimited
+	MentionEmailMinutes int    // Minutes between offline-mention emails to one user; 0 disables them
+	OrphanCleanupMins   int    // Minutes between sweeps for attachments never attached to a message; 0 disables
+	OrphanGraceMins     int    // Minutes an unsent upload is kept before the sweep may delete it
+	AccessLog           string // HTTP access log level: off, error, info or debug
+	RemoteURL           string // Desktop-only: connect to remote server instead of starting local one
 }
 
 func Parse() *Config {
@@ -23,17 +88,247 @@ func Parse() *Config {
 
 	flag.IntVar(&cfg.Port, "port", envInt("PORT", 8080), "HTTP server port")
 	flag.StringVar(&cfg.DataDir, "data-dir", envStr("DATA_DIR", "./data"), "Data directory path")
+	flag.StringVar(&cfg.DataDirMode, "data-dir-mode", envStr("DATA_DIR_MODE", "0755"), "Octal permissions for directories created in the data dir; stored files get the same without execute bits (e.g. 0750)")
+	flag.StringVar(&cfg.DatabaseURL, "database-url", envStr("DATABASE_URL", ""), "Postgres database URL (default: SQLite in data-dir)")
 	flag.Int64Var(&cfg.MaxUploadSize, "max-upload-size", envInt64("MAX_UPLOAD_SIZE", 10485760), "Max upload size in bytes")
+	flag.StringVar(&cfg.ClamdAddr, "clamd-addr", envStr("CLAMD_ADDR", ""), "ClamAV clamd address (host:port or Unix socket path) to scan uploads with; uploads fail if it can't be reached (empty disables)")
 	flag.BoolVar(&cfg.DevMode, "dev", false, "Enable dev mode (proxy frontend to Vite)")
+	flag.BoolVar(&cfg.CheckDB, "check-db", false, "Print the database schema version against the one this binary expects, then exit")
 	flag.StringVar(&cfg.PublicIP, "public-ip", envStr("PUBLIC_IP", ""), "Public IP for SFU NAT traversal")
+	flag.StringVar(&cfg.SFUEndpoints, "sfu-endpoints", envStr("SFU_ENDPOINTS", ""), "Extra public IPs of this host for voice, as name=ip pairs, comma-separated (e.g. isp2=203.0.113.5)")
+	flag.StringVar(&cfg.NAT1To1IPs, "nat-1to1-ips", envStr("NAT_1TO1_IPS", ""), "Comma-separated 1:1 NAT mapping for the SFU: one external IP, or external/local pairs (e.g. 203.0.113.5/10.0.0.5); replaces --public-ip")
+	flag.StringVar(&cfg.NATCandidateType, "nat-candidate-type", envStr("NAT_CANDIDATE_TYPE", "host"), "Advertise NAT 1:1 IPs as host candidates (replacing local addresses) or srflx (beside them)")
+	flag.IntVar(&cfg.ICEUDPPortMin, "ice-udp-port-min", envInt("ICE_UDP_PORT_MIN", 0), "Lowest UDP port for SFU media (0 with --ice-udp-port-max 0 lets the OS pick)")
+	flag.IntVar(&cfg.ICEUDPPortMax, "ice-udp-port-max", envInt("ICE_UDP_PORT_MAX", 0), "Highest UDP port for SFU media")
+	flag.StringVar(&cfg.PublicURL, "public-url", envStr("PUBLIC_URL", ""), "Public base URL of the web client, used in emailed login links")
+	flag.StringVar(&cfg.AllowedOrigins, "allowed-origins", envStr("ALLOWED_ORIGINS", ""), "Comma-separated origins allowed to use the API and WebSocket cross-origin (e.g. https://app.example.com), or * for any; defaults to * in dev mode")
 	flag.StringVar(&cfg.STUNServer, "stun-server", envStr("STUN_SERVER", "stun:stun.l.google.com:19302"), "STUN server address")
+	flag.StringVar(&cfg.TURNURLs, "turn-urls", envStr("TURN_URLS", ""), "Comma-separated TURN server URLs (e.g. turn:turn.example.com:3478?transport=udp)")
+	flag.StringVar(&cfg.TURNUsername, "turn-username", envStr("TURN_USERNAME", ""), "TURN username")
+	flag.StringVar(&cfg.TURNCredential, "turn-credential", envStr("TURN_CREDENTIAL", ""), "TURN credential")
+	flag.StringVar(&cfg.TURNSecret, "turn-secret", envStr("TURN_SECRET", ""), "TURN REST API shared secret (coturn static-auth-secret); overrides turn-username/turn-credential")
+	flag.IntVar(&cfg.TURNCredTTL, "turn-cred-ttl", envInt("TURN_CRED_TTL", 300), "Lifetime of generated TURN credentials in seconds")
+	flag.IntVar(&cfg.ICERestartGrace, "ice-restart-grace", envInt("ICE_RESTART_GRACE", 15), "Seconds to wait for a voice peer to recover via ICE restart before dropping it (0 disables)")
+	flag.IntVar(&cfg.VoiceIdleTimeout, "voice-idle-timeout", envInt("VOICE_IDLE_TIMEOUT", 0), "Seconds a self-muted/deafened or lone voice user may stay silent before being removed from voice (0 disables)")
+	flag.IntVar(&cfg.VoiceBitrate, "voice-bitrate", envInt("VOICE_BITRATE", 128000), "Target Opus bitrate for voice in bits/s (6000-510000)")
+	flag.BoolVar(&cfg.VoiceFEC, "voice-fec", envBool("VOICE_FEC", true), "Enable Opus in-band FEC for voice")
+	flag.IntVar(&cfg.WSPingInterval, "ws-ping-interval", envInt("WS_PING_INTERVAL", 30), "Seconds between WebSocket heartbeat pings (0 disables)")
+	flag.IntVar(&cfg.WSPingTimeout, "ws-ping-timeout", envInt("WS_PING_TIMEOUT", 10), "Seconds to wait for a WebSocket pong before closing the connection")
+	flag.IntVar(&cfg.RadioSyncInterval, "radio-sync-interval", envInt("RADIO_SYNC_INTERVAL", 5), "Seconds between radio position syncs to listeners of playing stations (0 disables)")
+	flag.StringVar(&cfg.RadioTranscode, "radio-transcode", envStr("RADIO_TRANSCODE", "off"), "Re-encode radio uploads with ffmpeg to opus or aac (off stores them as uploaded)")
+	flag.IntVar(&cfg.RadioTranscodeRate, "radio-transcode-bitrate", envInt("RADIO_TRANSCODE_BITRATE", 128000), "Target bitrate for radio transcodes in bits/s (32000-320000)")
+	flag.BoolVar(&cfg.RadioKeepOriginals, "radio-keep-originals", envBool("RADIO_KEEP_ORIGINALS", false), "Keep the original upload on disk beside a transcoded radio track")
+	flag.IntVar(&cfg.ShutdownReconnect, "shutdown-reconnect-after", envInt("SHUTDOWN_RECONNECT_AFTER", 5), "Seconds clients wait before reconnecting after a server shutdown")
+	flag.IntVar(&cfg.MaxReactionEmojis, "max-reaction-emojis", envInt("MAX_REACTION_EMOJIS", 20), "Max distinct emoji reactions per message")
+	flag.IntVar(&cfg.MaxReactionsPerUser, "max-reactions-per-user", envInt("MAX_REACTIONS_PER_USER", 10), "Max reactions one user can add to a message")
+	flag.IntVar(&cfg.WSMaxMessageBytes, "ws-max-message-bytes", envInt("WS_MAX_MESSAGE_BYTES", 32768), "Largest inbound WebSocket message in bytes; larger ones get a message_too_large error")
+	flag.IntVar(&cfg.WSMaxConnsPerIP, "ws-max-conns-per-ip", envInt("WS_MAX_CONNS_PER_IP", 20), "Max open WebSocket connections per client IP (0 is unlimited; loopback exempt in dev mode)")
+	flag.IntVar(&cfg.WSMaxConns, "ws-max-conns", envInt("WS_MAX_CONNS", 5000), "Max open WebSocket connections in total (0 is unlimited)")
+	flag.StringVar(&cfg.PasswordHash, "password-hash", envStr("PASSWORD_HASH", "bcrypt"), "Password hash algorithm for new and upgraded hashes: bcrypt or argon2id")
+	flag.IntVar(&cfg.BcryptCost, "bcrypt-cost", envInt("BCRYPT_COST", 10), "bcrypt cost for new password hashes (4-31)")
+	flag.StringVar(&cfg.AdminUsername, "admin-username", envStr("ADMIN_USERNAME", ""), "Create this admin account at startup unless a user by that name exists (needs --admin-password)")
+	flag.StringVar(&cfg.AdminPassword, "admin-password", envStr("ADMIN_PASSWORD", ""), "Password for --admin-username; prefer the ADMIN_PASSWORD env var")
+	flag.BoolVar(&cfg.FirstUserAdmin, "first-user-admin", envBool("FIRST_USER_ADMIN", true), "Make the first account registered on an empty server an admin, and let it register while registration is closed")
+	flag.IntVar(&cfg.MaxMentions, "max-mentions", envInt("MAX_MENTIONS", 20), "Max distinct users one message can mention (0 is unlimited)")
+	flag.IntVar(&cfg.ReactionBurstMs, "reaction-burst-ms", envInt("REACTION_BURST_MS", 300), "Milliseconds to merge rapid reaction changes to one emoji into a single reaction_update (0 disables)")
+	flag.IntVar(&cfg.OnlineBurstMs, "online-burst-ms", envInt("ONLINE_BURST_MS", 1000), "Milliseconds window in which user_online arrivals beyond --online-burst-size are sent as one users_online_bulk (0 disables)")
+	flag.IntVar(&cfg.OnlineBurstSize, "online-burst-size", envInt("ONLINE_BURST_SIZE", 10), "user_online events sent individually per window before batching")
+	flag.IntVar(&cfg.NotificationDays, "notification-retention-days", envInt("NOTIFICATION_RETENTION_DAYS", 30), "Delete read notifications older than this many days (0 keeps them)")
+	flag.IntVar(&cfg.MaxNotifications, "max-notifications", envInt("MAX_NOTIFICATIONS", 500), "Max notifications kept per user, oldest pruned first (0 is unlimited)")
+	flag.IntVar(&cfg.MentionEmailMinutes, "mention-email-minutes", envInt("MENTION_EMAIL_MINUTES", 15), "Min minutes between emails of mentions to an offline user, batched (0 disables)")
+	flag.IntVar(&cfg.OrphanCleanupMins, "orphan-cleanup-minutes", envInt("ORPHAN_CLEANUP_MINUTES", 10), "Minutes between sweeps deleting uploads that never made it onto a message (0 disables)")
+	flag.IntVar(&cfg.OrphanGraceMins, "orphan-grace-minutes", envInt("ORPHAN_GRACE_MINUTES", 60), "Minutes an upload may go unsent before the orphan sweep deletes it")
+	flag.StringVar(&cfg.AccessLog, "access-log", envStr("ACCESS_LOG", "info"), "HTTP access log level: off, error (API 4xx/5xx), info (all API requests) or debug (also static files and /ws)")
 	flag.StringVar(&cfg.RemoteURL, "url", "", "Desktop mode: connect to remote server URL (skips local server)")
 	flag.Parse()
 
 	return cfg
 }
 
+// ICEServers returns the configured STUN server followed by the TURN
+// relay (if any). When a TURN secret is configured, the TURN entry carries
+// credentials minted for userID that expire after TURNCredTTL.
+func (c *Config) ICEServers(userID string) []ICEServer {
+	servers := []ICEServer{}
+	if c.STUNServer != "" {
+		servers = append(servers, ICEServer{URLs: []string{c.STUNServer}})
+	}
+	var turnURLs []string
+	for _, u := range strings.Split(c.TURNURLs, ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			turnURLs = append(turnURLs, u)
+		}
+	}
+	if len(turnURLs) > 0 {
+		username, credential := c.TURNUsername, c.TURNCredential
+		if c.TURNSecret != "" {
+			ttl := time.Duration(c.TURNCredTTL) * time.Second
+			username, credential = TURNRESTCredentials(c.TURNSecret, userID, time.Now().Add(ttl))
+		}
+		servers = append(servers, ICEServer{
+			URLs:       turnURLs,
+			Username:   username,
+			Credential: credential,
+		})
+	}
+	return servers
+}
+
+// SFUEndpoint is another public IP this host takes voice traffic on. Rooms
+// placed on it advertise PublicIP in their host candidates instead of
+// --public-ip; the media is still handled by this process.
+type SFUEndpoint struct {
+	Name     string
+	PublicIP string
+}
+
+var endpointNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+
+// SFUEndpointList parses SFUEndpoints. Endpoint names are lowercase letters,
+// digits and dashes; "default" is taken by the --public-ip node.
+func (c *Config) SFUEndpointList() ([]SFUEndpoint, error) {
+	var endpoints []SFUEndpoint
+	seen := map[string]bool{"default": true}
+	for _, pair := range strings.Split(c.SFUEndpoints, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+		name, ip, ok := strings.Cut(pair, "=")
+		name, ip = strings.TrimSpace(name), strings.TrimSpace(ip)
+		if !ok || !endpointNameRegex.MatchString(name) {
+			return nil, fmt.Errorf("invalid endpoint in %q (want name=ip, name of a-z, 0-9 and -)", pair)
+		}
+		if net.ParseIP(ip) == nil {
+			return nil, fmt.Errorf("invalid IP for endpoint %s: %q", name, ip)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("endpoint %s listed twice (or reserved)", name)
+		}
+		seen[name] = true
+		endpoints = append(endpoints, SFUEndpoint{Name: name, PublicIP: ip})
+	}
+	return endpoints, nil
+}
+
+// NAT1To1IPList parses NAT1To1IPs. Per IP family it takes either one
+// bare external IP, which stands in for every local address, or
+// external/local pairs.
+func (c *Config) NAT1To1IPList() ([]string, error) {
+	var ips []string
+	sole := map[bool]bool{}   // IPv4? -> a bare external IP was given
+	paired := map[bool]bool{} // IPv4? -> external/local pairs were given
+	for _, entry := range strings.Split(c.NAT1To1IPs, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		ext, local, isPair := strings.Cut(entry, "/")
+		extIP := net.ParseIP(ext)
+		if extIP == nil {
+			return nil, fmt.Errorf("invalid external IP in %q", entry)
+		}
+		v4 := extIP.To4() != nil
+		if isPair {
+			localIP := net.ParseIP(local)
+			if localIP == nil || (localIP.To4() != nil) != v4 {
+				return nil, fmt.Errorf("invalid local IP in %q (want external/local of one IP family)", entry)
+			}
+			paired[v4] = true
+		} else {
+			if sole[v4] {
+				return nil, fmt.Errorf("more than one bare IP of a family in %q; map each local IP with external/local", c.NAT1To1IPs)
+			}
+			sole[v4] = true
+		}
+		if sole[v4] && paired[v4] {
+			return nil, fmt.Errorf("%q mixes a bare IP with external/local pairs of the same family", c.NAT1To1IPs)
+		}
+		ips = append(ips, entry)
+	}
+	return ips, nil
+}
+
+// ICEPortRange validates ICEUDPPortMin and ICEUDPPortMax. Both zero means
+// no range.
+func (c *Config) ICEPortRange() (uint16, uint16, error) {
+	lo, hi := c.ICEUDPPortMin, c.ICEUDPPortMax
+	if lo == 0 && hi == 0 {
+		return 0, 0, nil
+	}
+	if lo < 1 || hi > 65535 || lo > hi {
+		return 0, 0, fmt.Errorf("invalid UDP port range %d-%d (want 1 <= min <= max <= 65535, or both 0)", lo, hi)
+	}
+	return uint16(lo), uint16(hi), nil
+}
+
+// TrustedOrigins returns the configured cross-origin allowlist, normalized
+// to lowercase scheme://host[:port] with no trailing slash. "*" trusts
+// every origin, and is the default in dev mode so frontends served from
+// other ports work without configuration.
+func (c *Config) TrustedOrigins() []string {
+	if c.AllowedOrigins == "" && c.DevMode {
+		return []string{"*"}
+	}
+	var origins []string
+	for _, o := range strings.Split(c.AllowedOrigins, ",") {
+		if o = strings.TrimRight(strings.TrimSpace(o), "/"); o != "" {
+			origins = append(origins, strings.ToLower(o))
+		}
+	}
+	return origins
+}
+
+// OriginAllowed reports whether r may be served given its Origin header.
+// Requests without an Origin (non-browser clients) and same-origin
+// requests are always allowed; anything else must be in trusted.
+func OriginAllowed(r *http.Request, trusted []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	origin = strings.ToLower(u.Scheme + "://" + u.Host)
+	for _, t := range trusted {
+		if t == origin || t == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// TURNRESTCredentials implements the TURN REST API scheme understood by
+// coturn's use-auth-secret mode: the username is "<expiry unix>:<userID>"
+// and the credential is base64(HMAC-SHA1(secret, username)).
+func TURNRESTCredentials(secret, userID string, expiresAt time.Time) (username, credential string) {
+	username = fmt.Sprintf("%d:%s", expiresAt.Unix(), userID)
+	mac := hmac.New(sha1.New, []byte(secret))
+	mac.Write([]byte(username))
+	return username, base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// DirPerm parses DataDirMode. The owner must keep full access, since the
+// server itself writes there.
+func (c *Config) DirPerm() (os.FileMode, error) {
+	mode, err := strconv.ParseUint(c.DataDirMode, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid data dir mode %q (want octal, e.g. 0750)", c.DataDirMode)
+	}
+	if mode&0700 != 0700 {
+		return 0, fmt.Errorf("data dir mode %q must give the owner rwx", c.DataDirMode)
+	}
+	return os.FileMode(mode), nil
+}
+
 func (c *Config) EnsureDataDir() error {
+	mode, err := c.DirPerm()
+	if err != nil {
+		return err
+	}
 	dirs := []string{
 		c.DataDir,
 		filepath.Join(c.DataDir, "uploads"),
@@ -41,7 +336,7 @@ func (c *Config) EnsureDataDir() error {
 		filepath.Join(c.DataDir, "avatars"),
 	}
 	for _, dir := range dirs {
-		if err := os.MkdirAll(dir, 0755); err != nil {
+		if err := os.MkdirAll(dir, mode); err != nil {
 			return fmt.Errorf("create directory %s: %w", dir, err)
 		}
 	}
@@ -64,6 +359,15 @@ func envInt(key string, fallback int) int {
 	return fallback
 }
 
+func envBool(key string, fallback bool) bool {
+	if v := os.Getenv(key); v != "" {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
+
 func envInt64(key string, fallback int64) int64 {
 	if v := os.Getenv(key); v != "" {
 		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
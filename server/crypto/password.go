@@ -0,0 +1,128 @@
+package crypto
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms for PasswordHasher.
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// argon2id parameters for new hashes. Hashes record their own
+// parameters, so changing these only affects hashes made afterwards (and
+// rehashes on login).
+const (
+	argon2Time    = 3
+	argon2Memory  = 64 * 1024 // KiB
+	argon2Threads = 2
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// PasswordHasher hashes new passwords with the configured algorithm and
+// verifies stored hashes of either kind. The algorithm is recognised from
+// the hash's own prefix ("$2a$"/"$2b$" for bcrypt, "$argon2id$" for
+// argon2id), so switching algorithm leaves existing passwords working.
+type PasswordHasher struct {
+	algorithm  string
+	bcryptCost int
+}
+
+// NewPasswordHasher returns a hasher producing algorithm hashes, using
+// bcryptCost when that's bcrypt. bcryptCost is checked either way, since
+// verification codes are bcrypt-hashed at the same cost.
+func NewPasswordHasher(algorithm string, bcryptCost int) (*PasswordHasher, error) {
+	if algorithm != AlgorithmBcrypt && algorithm != AlgorithmArgon2id {
+		return nil, fmt.Errorf("unknown password hash algorithm %q (want bcrypt or argon2id)", algorithm)
+	}
+	if bcryptCost < bcrypt.MinCost || bcryptCost > bcrypt.MaxCost {
+		return nil, fmt.Errorf("bcrypt cost %d out of range %d-%d", bcryptCost, bcrypt.MinCost, bcrypt.MaxCost)
+	}
+	return &PasswordHasher{algorithm: algorithm, bcryptCost: bcryptCost}, nil
+}
+
+// Hash returns a new hash of password.
+func (p *PasswordHasher) Hash(password string) (string, error) {
+	if p.algorithm == AlgorithmArgon2id {
+		salt := make([]byte, argon2SaltLen)
+		if _, err := rand.Read(salt); err != nil {
+			return "", fmt.Errorf("generate salt: %w", err)
+		}
+		key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+		return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+			base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), p.bcryptCost)
+	if err != nil {
+		return "", fmt.Errorf("hash password: %w", err)
+	}
+	return string(hash), nil
+}
+
+// Verify reports whether password matches hash.
+func (p *PasswordHasher) Verify(hash, password string) bool {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		params, salt, key, err := parseArgon2id(hash)
+		if err != nil {
+			return false
+		}
+		got := argon2.IDKey([]byte(password), salt, params.time, params.memory, params.threads, uint32(len(key)))
+		return subtle.ConstantTimeCompare(got, key) == 1
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NeedsRehash reports whether hash was made with a different algorithm or
+// weaker settings than new hashes get. Call it after a successful Verify.
+func (p *PasswordHasher) NeedsRehash(hash string) bool {
+	if p.algorithm == AlgorithmArgon2id {
+		params, _, _, err := parseArgon2id(hash)
+		return err != nil || params != (argon2Params{argon2Time, argon2Memory, argon2Threads})
+	}
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < p.bcryptCost
+}
+
+type argon2Params struct {
+	time    uint32
+	memory  uint32
+	threads uint8
+}
+
+// parseArgon2id splits a "$argon2id$v=19$m=…,t=…,p=…$salt$key" hash.
+func parseArgon2id(hash string) (argon2Params, []byte, []byte, error) {
+	var params argon2Params
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return params, nil, nil, fmt.Errorf("malformed argon2id hash")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2 version %q", parts[2])
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.time, &params.threads); err != nil {
+		return params, nil, nil, fmt.Errorf("malformed argon2id parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("malformed argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, fmt.Errorf("malformed argon2id key")
+	}
+	return params, salt, key, nil
+}
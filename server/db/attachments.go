@@ -1,6 +1,10 @@
 package db
 
-import "fmt"
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
 
 type Attachment struct {
 	ID         string  `json:"id"`
@@ -13,14 +17,19 @@ type Attachment struct {
 	Width      *int    `json:"width"`
 	Height     *int    `json:"height"`
 	UploadedBy *string `json:"uploaded_by"`
-	CreatedAt  string  `json:"created_at"`
+	Spoiler    bool    `json:"spoiler"`
+	// DownloadCount is how many times the file has been fetched. Uploads
+	// are deduplicated by content, so attachments sharing a file share
+	// the count.
+	DownloadCount int64  `json:"download_count"`
+	CreatedAt     string `json:"created_at"`
 }
 
 func (d *DB) CreateAttachment(a *Attachment) error {
 	_, err := d.Exec(
-		`INSERT INTO attachments (id, message_id, filename, path, thumb_path, size_bytes, mime_type, width, height, uploaded_by)
-		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		a.ID, a.MessageID, a.Filename, a.Path, a.ThumbPath, a.SizeBytes, a.MimeType, a.Width, a.Height, a.UploadedBy,
+		`INSERT INTO attachments (id, message_id, filename, path, thumb_path, size_bytes, mime_type, width, height, uploaded_by, spoiler)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		a.ID, a.MessageID, a.Filename, a.Path, a.ThumbPath, a.SizeBytes, a.MimeType, a.Width, a.Height, a.UploadedBy, a.Spoiler,
 	)
 	if err != nil {
 		return fmt.Errorf("create attachment: %w", err)
@@ -28,11 +37,14 @@ func (d *DB) CreateAttachment(a *Attachment) error {
 	return nil
 }
 
+// LinkAttachmentsToMessage attaches uploads to a message, recording each
+// one's index in attachmentIDs as its position so they display in the
+// order the sender arranged them.
 func (d *DB) LinkAttachmentsToMessage(messageID string, attachmentIDs []string, uploaderID string) error {
-	for _, aid := range attachmentIDs {
+	for i, aid := range attachmentIDs {
 		_, err := d.Exec(
-			`UPDATE attachments SET message_id = ? WHERE id = ? AND message_id IS NULL AND (uploaded_by = ? OR uploaded_by IS NULL)`,
-			messageID, aid, uploaderID,
+			`UPDATE attachments SET message_id = ?, position = ? WHERE id = ? AND message_id IS NULL AND (uploaded_by = ? OR uploaded_by IS NULL)`,
+			messageID, i, aid, uploaderID,
 		)
 		if err != nil {
 			return fmt.Errorf("link attachment %s: %w", aid, err)
@@ -41,10 +53,48 @@ func (d *DB) LinkAttachmentsToMessage(messageID string, attachmentIDs []string,
 	return nil
 }
 
+// MarkAttachmentsSpoiler flags a message's attachments as spoilers. IDs not
+// linked to messageID are ignored.
+func (d *DB) MarkAttachmentsSpoiler(messageID string, attachmentIDs []string) error {
+	for _, aid := range attachmentIDs {
+		if _, err := d.Exec(
+			`UPDATE attachments SET spoiler = TRUE WHERE id = ? AND message_id = ?`, aid, messageID,
+		); err != nil {
+			return fmt.Errorf("mark attachment %s spoiler: %w", aid, err)
+		}
+	}
+	return nil
+}
+
+// AddAttachmentDownloads adds counts (keyed by attachment path) to
+// download_count in one transaction.
+func (d *DB) AddAttachmentDownloads(counts map[string]int64) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin download counts: %w", err)
+	}
+	for path, n := range counts {
+		if _, err := tx.Exec(
+			`UPDATE attachments SET download_count = download_count + ? WHERE path = ?`, n, path,
+		); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("add downloads for %s: %w", path, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit download counts: %w", err)
+	}
+	return nil
+}
+
+// GetAttachmentsByMessage returns a message's attachments in the order they
+// were sent. Rows linked before positions were recorded come last, oldest
+// first.
 func (d *DB) GetAttachmentsByMessage(messageID string) ([]Attachment, error) {
 	rows, err := d.Query(
-		`SELECT id, message_id, filename, path, thumb_path, size_bytes, mime_type, width, height, created_at
-		 FROM attachments WHERE message_id = ?`, messageID,
+		`SELECT id, message_id, filename, path, thumb_path, size_bytes, mime_type, width, height, spoiler, download_count, created_at
+		 FROM attachments WHERE message_id = ?
+		 ORDER BY position IS NULL, position, created_at, rowid`, messageID,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("get attachments: %w", err)
@@ -55,7 +105,7 @@ func (d *DB) GetAttachmentsByMessage(messageID string) ([]Attachment, error) {
 	for rows.Next() {
 		var a Attachment
 		if err := rows.Scan(&a.ID, &a.MessageID, &a.Filename, &a.Path, &a.ThumbPath,
-			&a.SizeBytes, &a.MimeType, &a.Width, &a.Height, &a.CreatedAt); err != nil {
+			&a.SizeBytes, &a.MimeType, &a.Width, &a.Height, &a.Spoiler, &a.DownloadCount, &a.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan attachment: %w", err)
 		}
 		attachments = append(attachments, a)
@@ -66,13 +116,80 @@ func (d *DB) GetAttachmentsByMessage(messageID string) ([]Attachment, error) {
 	return attachments, rows.Err()
 }
 
-func (d *DB) CleanupOrphanedAttachments() ([]Attachment, error) {
+// GetAttachmentsByMessages is GetAttachmentsByMessage for several messages
+// at once, keyed by message ID, each in send order.
+func (d *DB) GetAttachmentsByMessages(messageIDs []string) (map[string][]Attachment, error) {
+	result := make(map[string][]Attachment)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	placeholders := make([]string, len(messageIDs))
+	args := make([]any, len(messageIDs))
+	for i, id := range messageIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	query := fmt.Sprintf(
+		`SELECT id, message_id, filename, path, thumb_path, size_bytes, mime_type, width, height, spoiler, download_count, created_at
+		 FROM attachments WHERE message_id IN (%s)
+		 ORDER BY message_id, position IS NULL, position, created_at, rowid`,
+		strings.Join(placeholders, ","),
+	)
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get attachments by messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.MessageID, &a.Filename, &a.Path, &a.ThumbPath,
+			&a.SizeBytes, &a.MimeType, &a.Width, &a.Height, &a.Spoiler, &a.DownloadCount, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan attachment: %w", err)
+		}
+		if a.MessageID != nil {
+			result[*a.MessageID] = append(result[*a.MessageID], a)
+		}
+	}
+	return result, rows.Err()
+}
+
+// GetAttachmentByID returns the attachment, or nil if there is none.
+func (d *DB) GetAttachmentByID(id string) (*Attachment, error) {
+	var a Attachment
+	err := d.QueryRow(
+		`SELECT id, message_id, filename, path, thumb_path, size_bytes, mime_type, width, height, spoiler, download_count, created_at
+		 FROM attachments WHERE id = ?`, id,
+	).Scan(&a.ID, &a.MessageID, &a.Filename, &a.Path, &a.ThumbPath,
+		&a.SizeBytes, &a.MimeType, &a.Width, &a.Height, &a.Spoiler, &a.DownloadCount, &a.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get attachment: %w", err)
+	}
+	return &a, nil
+}
+
+// CleanupOrphanedAttachments deletes attachments that aren't on a message
+// and were uploaded more than graceMinutes ago, returning them so the
+// caller can remove their files. The grace period keeps uploads that are
+// still waiting for send_message from being reaped mid-compose.
+func (d *DB) CleanupOrphanedAttachments(graceMinutes int) ([]Attachment, error) {
+	if graceMinutes < 0 {
+		graceMinutes = 0
+	}
 	rows, err := d.Query(
-		`SELECT id, path, thumb_path FROM attachments
-		 WHERE message_id IS NULL AND created_at < datetime('now', '-1 hour')`,
+		`DELETE FROM attachments
+		 WHERE message_id IS NULL AND created_at < datetime('now', ?)
+		 RETURNING id, path, thumb_path`,
+		fmt.Sprintf("-%d minutes", graceMinutes),
 	)
 	if err != nil {
-		return nil, fmt.Errorf("query orphans: %w", err)
+		return nil, fmt.Errorf("delete orphans: %w", err)
 	}
 	defer rows.Close()
 
@@ -87,13 +204,5 @@ func (d *DB) CleanupOrphanedAttachments() ([]Attachment, error) {
 	if err := rows.Err(); err != nil {
 		return nil, err
 	}
-
-	_, err = d.Exec(
-		`DELETE FROM attachments WHERE message_id IS NULL AND created_at < datetime('now', '-1 hour')`,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("delete orphans: %w", err)
-	}
-
 	return orphans, nil
 }
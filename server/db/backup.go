@@ -0,0 +1,26 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrSnapshotUnsupported is returned by SnapshotTo on Postgres, whose
+// backups are taken with pg_dump.
+var ErrSnapshotUnsupported = errors.New("database snapshots need SQLite; back up Postgres with pg_dump")
+
+// SnapshotTo writes a consistent copy of the database to path using
+// VACUUM INTO. The target must not already exist.
+func (d *DB) SnapshotTo(path string) error {
+	if d.dialect == dialectPostgres {
+		return ErrSnapshotUnsupported
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("snapshot target %s already exists", path)
+	}
+	if _, err := d.Exec(`VACUUM INTO ?`, path); err != nil {
+		return fmt.Errorf("vacuum into: %w", err)
+	}
+	return nil
+}
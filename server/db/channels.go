@@ -57,7 +57,7 @@ func (d *DB) CreateChannel(id, name, chType, createdBy string) (*Channel, error)
 	}
 
 	cb := createdBy
-	return &Channel{ID: id, Name: name, Type: chType, Position: pos, Visibility: "public", CreatedBy: &cb}, nil
+	return &Channel{ID: id, Name: name, Type: chType, Position: pos, Visibility: "public", AllowAttachments: true, AllowLinks: true, CreatedBy: &cb}, nil
 }
 
 func (d *DB) DeleteChannel(id string) error {
@@ -97,7 +97,7 @@ func (d *DB) RestoreChannel(id string) error {
 }
 
 func (d *DB) GetDeletedChannels() ([]Channel, error) {
-	rows, err := d.Query(`SELECT id, name, type, position, visibility, description, created_by, deleted_at, created_at FROM channels WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`)
+	rows, err := d.Query(`SELECT id, name, type, position, visibility, description, announcement, allow_attachments, allow_links, created_by, deleted_at, created_at FROM channels WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC`)
 	if err != nil {
 		return nil, fmt.Errorf("get deleted channels: %w", err)
 	}
@@ -106,7 +106,7 @@ func (d *DB) GetDeletedChannels() ([]Channel, error) {
 	var channels []Channel
 	for rows.Next() {
 		var c Channel
-		if err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.Position, &c.Visibility, &c.Description, &c.CreatedBy, &c.DeletedAt, &c.CreatedAt); err != nil {
+		if err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.Position, &c.Visibility, &c.Description, &c.Announcement, &c.AllowAttachments, &c.AllowLinks, &c.CreatedBy, &c.DeletedAt, &c.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan deleted channel: %w", err)
 		}
 		channels = append(channels, c)
@@ -166,8 +166,8 @@ func (d *DB) SeedDefaultChannels() error {
 func (d *DB) GetChannelByID(id string) (*Channel, error) {
 	c := &Channel{}
 	err := d.QueryRow(
-		`SELECT id, name, type, position, visibility, description, created_by, created_at FROM channels WHERE id = ? AND deleted_at IS NULL`, id,
-	).Scan(&c.ID, &c.Name, &c.Type, &c.Position, &c.Visibility, &c.Description, &c.CreatedBy, &c.CreatedAt)
+		`SELECT id, name, type, position, visibility, description, announcement, allow_attachments, allow_links, created_by, created_at FROM channels WHERE id = ? AND deleted_at IS NULL`, id,
+	).Scan(&c.ID, &c.Name, &c.Type, &c.Position, &c.Visibility, &c.Description, &c.Announcement, &c.AllowAttachments, &c.AllowLinks, &c.CreatedBy, &c.CreatedAt)
 	if err != nil {
 		return nil, fmt.Errorf("get channel: %w", err)
 	}
@@ -356,7 +356,7 @@ func (d *DB) GetChannelsForUser(userID string, isAdmin bool) ([]ChannelWithMembe
 
 	if isAdmin {
 		rows, err = d.Query(
-			`SELECT c.id, c.name, c.type, c.position, c.visibility, c.description, c.created_by, c.created_at,
+			`SELECT c.id, c.name, c.type, c.position, c.visibility, c.description, c.announcement, c.allow_attachments, c.allow_links, c.created_by, c.created_at,
 			        CASE WHEN cm.user_id IS NOT NULL THEN 1 ELSE 0 END AS is_member,
 			        COALESCE(cm.role, '') AS role
 			 FROM channels c
@@ -366,7 +366,7 @@ func (d *DB) GetChannelsForUser(userID string, isAdmin bool) ([]ChannelWithMembe
 		)
 	} else {
 		rows, err = d.Query(
-			`SELECT c.id, c.name, c.type, c.position, c.visibility, c.description, c.created_by, c.created_at,
+			`SELECT c.id, c.name, c.type, c.position, c.visibility, c.description, c.announcement, c.allow_attachments, c.allow_links, c.created_by, c.created_at,
 			        CASE WHEN cm.user_id IS NOT NULL THEN 1 ELSE 0 END AS is_member,
 			        COALESCE(cm.role, '') AS role
 			 FROM channels c
@@ -385,7 +385,7 @@ func (d *DB) GetChannelsForUser(userID string, isAdmin bool) ([]ChannelWithMembe
 	for rows.Next() {
 		var cwm ChannelWithMembership
 		var isMember int
-		if err := rows.Scan(&cwm.ID, &cwm.Name, &cwm.Type, &cwm.Position, &cwm.Visibility, &cwm.Description, &cwm.CreatedBy, &cwm.CreatedAt, &isMember, &cwm.Role); err != nil {
+		if err := rows.Scan(&cwm.ID, &cwm.Name, &cwm.Type, &cwm.Position, &cwm.Visibility, &cwm.Description, &cwm.Announcement, &cwm.AllowAttachments, &cwm.AllowLinks, &cwm.CreatedBy, &cwm.CreatedAt, &isMember, &cwm.Role); err != nil {
 			return nil, fmt.Errorf("scan channel for user: %w", err)
 		}
 		cwm.IsMember = isMember == 1
@@ -494,10 +494,10 @@ func (d *DB) HasPendingRequest(channelID, userID string) (bool, error) {
 	return count > 0, nil
 }
 
-func (d *DB) UpdateChannelSettings(channelID, name, description, visibility string) error {
+func (d *DB) UpdateChannelSettings(channelID, name, description, visibility string, announcement bool) error {
 	_, err := d.Exec(
-		`UPDATE channels SET name = ?, description = ?, visibility = ? WHERE id = ?`,
-		name, description, visibility, channelID,
+		`UPDATE channels SET name = ?, description = ?, visibility = ?, announcement = ? WHERE id = ?`,
+		name, description, visibility, announcement, channelID,
 	)
 	if err != nil {
 		return fmt.Errorf("update channel settings: %w", err)
@@ -505,6 +505,19 @@ func (d *DB) UpdateChannelSettings(channelID, name, description, visibility stri
 	return nil
 }
 
+// UpdateChannelRestrictions sets whether messages in the channel may carry
+// attachments and links.
+func (d *DB) UpdateChannelRestrictions(channelID string, allowAttachments, allowLinks bool) error {
+	_, err := d.Exec(
+		`UPDATE channels SET allow_attachments = ?, allow_links = ? WHERE id = ?`,
+		allowAttachments, allowLinks, channelID,
+	)
+	if err != nil {
+		return fmt.Errorf("update channel restrictions: %w", err)
+	}
+	return nil
+}
+
 // Backward-compatible manager functions (delegate to channel_members)
 
 func (d *DB) AddChannelManager(channelID, userID string) error {
@@ -582,7 +595,7 @@ func (d *DB) GetUnreadCounts(userID string) (map[string]int, error) {
 			OR m.created_at > (SELECT created_at FROM messages WHERE id = rs.last_read_msg_id)
 		  )
 		GROUP BY m.channel_id
-		HAVING unread > 0
+		HAVING COUNT(*) > 0
 	`, userID)
 	if err != nil {
 		return nil, fmt.Errorf("get unread counts: %w", err)
@@ -4,12 +4,17 @@ import (
 	"database/sql"
 	"fmt"
 	"path/filepath"
+	"sync"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	_ "modernc.org/sqlite"
 )
 
 type DB struct {
 	*sql.DB
+	dialect dialect
+	rebound sync.Map // SQLite query -> its Postgres rewrite
 }
 
 func Open(dataDir string) (*DB, error) {
@@ -34,7 +39,7 @@ func Open(dataDir string) (*DB, error) {
 		}
 	}
 
-	d := &DB{sqlDB}
+	d := &DB{DB: sqlDB}
 	if err := d.migrate(); err != nil {
 		sqlDB.Close()
 		return nil, fmt.Errorf("run migrations: %w", err)
@@ -42,3 +47,40 @@ func Open(dataDir string) (*DB, error) {
 
 	return d, nil
 }
+
+// OpenPostgres connects to the Postgres database at url (a postgres://
+// URL or key=value DSN) and migrates it. Several servers may share one
+// database; migrations take a lock so only one of them applies each.
+func OpenPostgres(url string) (*DB, error) {
+	sqlDB, err := openPostgres(url)
+	if err != nil {
+		return nil, err
+	}
+	if err := sqlDB.Ping(); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("connect to database: %w", err)
+	}
+
+	d := &DB{DB: sqlDB, dialect: dialectPostgres}
+	if err := d.migratePostgres(); err != nil {
+		sqlDB.Close()
+		return nil, fmt.Errorf("run migrations: %w", err)
+	}
+
+	return d, nil
+}
+
+func openPostgres(url string) (*sql.DB, error) {
+	cfg, err := pgx.ParseConfig(url)
+	if err != nil {
+		return nil, fmt.Errorf("parse database url: %w", err)
+	}
+	// Timestamps are stored and compared as UTC wall time, like SQLite's
+	// datetime('now')
+	cfg.RuntimeParams["timezone"] = "UTC"
+	// Send arguments as literals so Postgres infers their types from
+	// context, as SQLite does; the extended protocol can't type a bare
+	// "? IS NULL" or a string bound to an interval
+	cfg.DefaultQueryExecMode = pgx.QueryExecModeSimpleProtocol
+	return stdlib.OpenDB(*cfg), nil
+}
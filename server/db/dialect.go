@@ -0,0 +1,119 @@
+package db
+
+import (
+	"database/sql"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// The queries in this package are written for SQLite. On Postgres each one
+// is rewritten once, on first use, and the result cached: placeholders
+// become $n, SQLite's date, JSON and case-folding functions map to their
+// Postgres equivalents, and INSERT OR IGNORE becomes ON CONFLICT DO NOTHING.
+// Anything the rewrite can't express is kept portable in the query itself.
+
+type dialect int
+
+const (
+	dialectSQLite dialect = iota
+	dialectPostgres
+)
+
+var pgRewrites = []struct {
+	re   *regexp.Regexp
+	repl string
+}{
+	{regexp.MustCompile(`datetime\('now'\)`), `LOCALTIMESTAMP(0)`},
+	{regexp.MustCompile(`datetime\('now', \?\)`), `(LOCALTIMESTAMP(0) + CAST(? AS interval))`},
+	{regexp.MustCompile(`datetime\('now', '([^']*)'\)`), `(LOCALTIMESTAMP(0) + INTERVAL '$1')`},
+	{regexp.MustCompile(`([\w.]+) COLLATE NOCASE = \?`), `lower($1) = lower(?)`},
+	{regexp.MustCompile(`([\w.]+) COLLATE NOCASE`), `lower($1)`},
+	{regexp.MustCompile(`json_extract\(([\w.]+), '\$\.(\w+)'\)`), `(CAST($1 AS json) ->> '$2')`},
+	{regexp.MustCompile(`json_each\(\?\)`), `json_array_elements_text(CAST(? AS json))`},
+	// SQLite's LIKE ignores ASCII case
+	{regexp.MustCompile(`\bLIKE\b`), `ILIKE`},
+}
+
+var insertOrIgnore = regexp.MustCompile(`INSERT OR IGNORE INTO`)
+
+// toPostgres rewrites one SQLite statement into the Postgres dialect.
+func toPostgres(query string) string {
+	ignore := insertOrIgnore.MatchString(query)
+	if ignore {
+		query = insertOrIgnore.ReplaceAllString(query, "INSERT INTO")
+	}
+	for _, r := range pgRewrites {
+		query = r.re.ReplaceAllString(query, r.repl)
+	}
+	if ignore {
+		query = strings.TrimRight(query, " \t\n;") + " ON CONFLICT DO NOTHING"
+	}
+
+	// Number the placeholders, skipping any ? inside string literals
+	var b strings.Builder
+	n, quoted := 0, false
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'':
+			quoted = !quoted
+		case c == '?' && !quoted:
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func (d *DB) rebind(query string) string {
+	if d.dialect != dialectPostgres {
+		return query
+	}
+	if q, ok := d.rebound.Load(query); ok {
+		return q.(string)
+	}
+	q := toPostgres(query)
+	d.rebound.Store(query, q)
+	return q
+}
+
+func (d *DB) Exec(query string, args ...any) (sql.Result, error) {
+	return d.DB.Exec(d.rebind(query), args...)
+}
+
+func (d *DB) Query(query string, args ...any) (*sql.Rows, error) {
+	return d.DB.Query(d.rebind(query), args...)
+}
+
+func (d *DB) QueryRow(query string, args ...any) *sql.Row {
+	return d.DB.QueryRow(d.rebind(query), args...)
+}
+
+func (d *DB) Begin() (*Tx, error) {
+	tx, err := d.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx, d: d}, nil
+}
+
+// Tx is a transaction whose statements are rewritten like the DB's.
+type Tx struct {
+	*sql.Tx
+	d *DB
+}
+
+func (t *Tx) Exec(query string, args ...any) (sql.Result, error) {
+	return t.Tx.Exec(t.d.rebind(query), args...)
+}
+
+func (t *Tx) Query(query string, args ...any) (*sql.Rows, error) {
+	return t.Tx.Query(t.d.rebind(query), args...)
+}
+
+func (t *Tx) QueryRow(query string, args ...any) *sql.Row {
+	return t.Tx.QueryRow(t.d.rebind(query), args...)
+}
@@ -0,0 +1,124 @@
+package db
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DigestRecipient is a user due a missed-mentions digest.
+type DigestRecipient struct {
+	UserID       string
+	Email        string
+	LastDigestAt *string
+}
+
+// DigestMention is one unread mention included in a digest.
+type DigestMention struct {
+	AuthorUsername string `json:"author_username"`
+	ChannelName    string `json:"channel_name"`
+	ContentPreview string `json:"content_preview"`
+	CreatedAt      string `json:"created_at"`
+}
+
+func (d *DB) SetEmailDigestEnabled(userID string, enabled bool) error {
+	_, err := d.Exec(`UPDATE users SET email_digest_enabled = ? WHERE id = ?`, enabled, userID)
+	if err != nil {
+		return fmt.Errorf("set email digest enabled: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetEmailDigestEnabled(userID string) (bool, error) {
+	var enabled bool
+	err := d.QueryRow(`SELECT email_digest_enabled FROM users WHERE id = ?`, userID).Scan(&enabled)
+	if err != nil {
+		return false, fmt.Errorf("get email digest enabled: %w", err)
+	}
+	return enabled, nil
+}
+
+// SetLastSeen records that these users' last connections have closed.
+func (d *DB) SetLastSeen(userIDs []string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	placeholders := make([]string, len(userIDs))
+	args := make([]any, len(userIDs))
+	for i, id := range userIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+	_, err := d.Exec(`UPDATE users SET last_seen_at = datetime('now') WHERE id IN (`+strings.Join(placeholders, ",")+`)`, args...)
+	if err != nil {
+		return fmt.Errorf("set last seen: %w", err)
+	}
+	return nil
+}
+
+// GetDigestRecipients returns opted-in users with an email who haven't had
+// a digest in the last day and haven't been seen in the last few hours.
+// Callers must still skip users who are currently online.
+func (d *DB) GetDigestRecipients() ([]DigestRecipient, error) {
+	rows, err := d.Query(
+		`SELECT id, email, last_digest_at FROM users
+		 WHERE email_digest_enabled = TRUE AND approved = TRUE
+		 AND email IS NOT NULL AND email != ''
+		 AND (last_digest_at IS NULL OR last_digest_at < datetime('now', '-1 day'))
+		 AND (last_seen_at IS NULL OR last_seen_at < datetime('now', '-6 hours'))`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get digest recipients: %w", err)
+	}
+	defer rows.Close()
+
+	var recipients []DigestRecipient
+	for rows.Next() {
+		var r DigestRecipient
+		if err := rows.Scan(&r.UserID, &r.Email, &r.LastDigestAt); err != nil {
+			return nil, fmt.Errorf("scan digest recipient: %w", err)
+		}
+		recipients = append(recipients, r)
+	}
+	return recipients, rows.Err()
+}
+
+// GetUnreadMentionsSince returns up to limit unread mention notifications
+// for a user created after since (all unread ones when since is nil),
+// oldest first.
+func (d *DB) GetUnreadMentionsSince(userID string, since *string, limit int) ([]DigestMention, error) {
+	rows, err := d.Query(
+		`SELECT data, created_at FROM notifications
+		 WHERE user_id = ? AND type = 'mention' AND read = FALSE
+		 AND (? IS NULL OR created_at > ?)
+		 ORDER BY created_at ASC
+		 LIMIT ?`,
+		userID, since, since, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get unread mentions: %w", err)
+	}
+	defer rows.Close()
+
+	var mentions []DigestMention
+	for rows.Next() {
+		var dataStr string
+		var m DigestMention
+		if err := rows.Scan(&dataStr, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan unread mention: %w", err)
+		}
+		if err := json.Unmarshal([]byte(dataStr), &m); err != nil {
+			continue
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
+
+func (d *DB) SetDigestSent(userID string) error {
+	_, err := d.Exec(`UPDATE users SET last_digest_at = datetime('now') WHERE id = ?`, userID)
+	if err != nil {
+		return fmt.Errorf("set digest sent: %w", err)
+	}
+	return nil
+}
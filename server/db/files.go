@@ -0,0 +1,22 @@
+package db
+
+import "fmt"
+
+// FileInUse reports whether any row still stores relPath: an attachment
+// or its thumbnail, a media item, a radio track or its kept original, or
+// the server icon. Identical uploads share one file, so it must not be
+// removed while anything points at it.
+func (d *DB) FileInUse(relPath string) (bool, error) {
+	var inUse bool
+	err := d.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM attachments WHERE path = ? OR thumb_path = ?)
+		     OR EXISTS(SELECT 1 FROM media WHERE path = ?)
+		     OR EXISTS(SELECT 1 FROM radio_tracks WHERE path = ? OR original_path = ?)
+		     OR EXISTS(SELECT 1 FROM settings WHERE key = 'server_icon' AND value = ?)`,
+		relPath, relPath, relPath, relPath, relPath, relPath,
+	).Scan(&inUse)
+	if err != nil {
+		return false, fmt.Errorf("file in use: %w", err)
+	}
+	return inUse, nil
+}
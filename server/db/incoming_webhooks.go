@@ -0,0 +1,114 @@
+package db
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/google/uuid"
+)
+
+// IncomingWebhook lets an external service post into one channel through
+// POST /api/v1/webhooks/{id}/{token}. Only a hash of the token is stored.
+type IncomingWebhook struct {
+	ID        string  `json:"id"`
+	ChannelID string  `json:"channel_id"`
+	Name      string  `json:"name"`
+	CreatedBy *string `json:"created_by"`
+	CreatedAt string  `json:"created_at"`
+}
+
+// IncomingWebhookCreated is returned once, on creation, with the token.
+type IncomingWebhookCreated struct {
+	IncomingWebhook
+	Token string `json:"token"`
+}
+
+func (d *DB) CreateIncomingWebhook(channelID, name, createdBy string) (*IncomingWebhookCreated, error) {
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, fmt.Errorf("generate webhook token: %w", err)
+	}
+	token := hex.EncodeToString(tokenBytes)
+	id := uuid.New().String()
+
+	if _, err := d.Exec(
+		`INSERT INTO incoming_webhooks (id, channel_id, token_hash, name, created_by) VALUES (?, ?, ?, ?, ?)`,
+		id, channelID, hashKey(token), name, createdBy,
+	); err != nil {
+		return nil, fmt.Errorf("create incoming webhook: %w", err)
+	}
+	wh, err := d.GetIncomingWebhook(id)
+	if err != nil {
+		return nil, err
+	}
+	return &IncomingWebhookCreated{IncomingWebhook: *wh, Token: token}, nil
+}
+
+func (d *DB) GetIncomingWebhook(id string) (*IncomingWebhook, error) {
+	wh, _, err := d.getIncomingWebhook(id)
+	return wh, err
+}
+
+// ValidateIncomingWebhook returns the webhook if token matches it, nil
+// otherwise.
+func (d *DB) ValidateIncomingWebhook(id, token string) (*IncomingWebhook, error) {
+	wh, tokenHash, err := d.getIncomingWebhook(id)
+	if err != nil || wh == nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(hashKey(token)), []byte(tokenHash)) != 1 {
+		return nil, nil
+	}
+	return wh, nil
+}
+
+func (d *DB) getIncomingWebhook(id string) (*IncomingWebhook, string, error) {
+	wh := &IncomingWebhook{}
+	var tokenHash string
+	err := d.QueryRow(
+		`SELECT id, channel_id, name, created_by, created_at, token_hash FROM incoming_webhooks WHERE id = ?`, id,
+	).Scan(&wh.ID, &wh.ChannelID, &wh.Name, &wh.CreatedBy, &wh.CreatedAt, &tokenHash)
+	if err == sql.ErrNoRows {
+		return nil, "", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("get incoming webhook: %w", err)
+	}
+	return wh, tokenHash, nil
+}
+
+// ListIncomingWebhooks returns a channel's webhooks, newest first.
+func (d *DB) ListIncomingWebhooks(channelID string) ([]IncomingWebhook, error) {
+	rows, err := d.Query(
+		`SELECT id, channel_id, name, created_by, created_at FROM incoming_webhooks
+		 WHERE channel_id = ? ORDER BY created_at DESC, rowid DESC`, channelID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list incoming webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	hooks := []IncomingWebhook{}
+	for rows.Next() {
+		var wh IncomingWebhook
+		if err := rows.Scan(&wh.ID, &wh.ChannelID, &wh.Name, &wh.CreatedBy, &wh.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan incoming webhook: %w", err)
+		}
+		hooks = append(hooks, wh)
+	}
+	return hooks, rows.Err()
+}
+
+// DeleteIncomingWebhook revokes a channel's webhook. Returns false if it
+// doesn't exist in that channel.
+func (d *DB) DeleteIncomingWebhook(id, channelID string) (bool, error) {
+	result, err := d.Exec(`DELETE FROM incoming_webhooks WHERE id = ? AND channel_id = ?`, id, channelID)
+	if err != nil {
+		return false, fmt.Errorf("delete incoming webhook: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
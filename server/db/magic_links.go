@@ -0,0 +1,64 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// CreateMagicLink stores a one-time login token for userID. Only the
+// SHA-256 of the token is kept, like webhook keys.
+func (d *DB) CreateMagicLink(id, userID, token string, expiresAt time.Time) error {
+	_, err := d.Exec(
+		`INSERT INTO magic_links (id, user_id, token_hash, expires_at) VALUES (?, ?, ?, ?)`,
+		id, userID, hashKey(token), expiresAt.UTC().Format("2006-01-02 15:04:05"),
+	)
+	if err != nil {
+		return fmt.Errorf("create magic link: %w", err)
+	}
+	return nil
+}
+
+// ConsumeMagicLink marks an unused, unexpired token as used and returns
+// its user ID, or "" if the token is unknown, expired, or already used.
+// The single UPDATE makes the token strictly one-time even under
+// concurrent requests.
+func (d *DB) ConsumeMagicLink(token string) (string, error) {
+	var userID string
+	err := d.QueryRow(
+		`UPDATE magic_links SET used_at = datetime('now')
+		 WHERE token_hash = ? AND used_at IS NULL AND expires_at > datetime('now')
+		 RETURNING user_id`,
+		hashKey(token),
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("consume magic link: %w", err)
+	}
+	return userID, nil
+}
+
+func (d *DB) CountRecentMagicLinks(userID string, since time.Time) (int, error) {
+	var count int
+	err := d.QueryRow(
+		`SELECT COUNT(*) FROM magic_links WHERE user_id = ? AND created_at > ?`,
+		userID, since.UTC().Format("2006-01-02 15:04:05"),
+	).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count recent magic links: %w", err)
+	}
+	return count, nil
+}
+
+// CleanupExpiredMagicLinks removes tokens that expired more than a day ago.
+// Recent ones are kept so CountRecentMagicLinks still rate-limits.
+func (d *DB) CleanupExpiredMagicLinks() (int, error) {
+	res, err := d.Exec(`DELETE FROM magic_links WHERE expires_at < datetime('now', '-1 day')`)
+	if err != nil {
+		return 0, fmt.Errorf("cleanup magic links: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return int(n), nil
+}
@@ -0,0 +1,109 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+func (d *DB) SetMentionEmailEnabled(userID string, enabled bool) error {
+	_, err := d.Exec(`UPDATE users SET mention_email_enabled = ? WHERE id = ?`, enabled, userID)
+	if err != nil {
+		return fmt.Errorf("set mention email enabled: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) GetMentionEmailEnabled(userID string) (bool, error) {
+	var enabled bool
+	err := d.QueryRow(`SELECT mention_email_enabled FROM users WHERE id = ?`, userID).Scan(&enabled)
+	if err != nil {
+		return false, fmt.Errorf("get mention email enabled: %w", err)
+	}
+	return enabled, nil
+}
+
+// GetMentionEmailAddress returns the address to email userID's offline
+// mentions to: a verified email on an approved account that hasn't opted
+// out. Returns "" if there is none.
+func (d *DB) GetMentionEmailAddress(userID string) (string, error) {
+	var addr string
+	err := d.QueryRow(
+		`SELECT email FROM users
+		 WHERE id = ? AND approved = TRUE AND mention_email_enabled = TRUE
+		 AND email IS NOT NULL AND email != '' AND email_verified_at IS NOT NULL`,
+		userID,
+	).Scan(&addr)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("get mention email address: %w", err)
+	}
+	return addr, nil
+}
+
+// GetUnemailedMentions returns up to limit unread mention notifications
+// for userID created since their last mention email, oldest first.
+// Mentions in channels the user has muted are left out.
+func (d *DB) GetUnemailedMentions(userID string, limit int) ([]DigestMention, error) {
+	rows, err := d.Query(
+		`SELECT n.data, n.created_at FROM notifications n
+		 JOIN users u ON u.id = n.user_id
+		 WHERE n.user_id = ? AND n.type = 'mention' AND n.read = FALSE
+		 AND (u.last_mention_email_at IS NULL OR n.created_at > u.last_mention_email_at)
+		 AND NOT EXISTS (
+			SELECT 1 FROM channel_mutes cm
+			WHERE cm.user_id = n.user_id AND cm.channel_id = json_extract(n.data, '$.channel_id')
+		 )
+		 ORDER BY n.created_at ASC, n.rowid ASC
+		 LIMIT ?`,
+		userID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get unemailed mentions: %w", err)
+	}
+	defer rows.Close()
+
+	var mentions []DigestMention
+	for rows.Next() {
+		var dataStr string
+		var m DigestMention
+		if err := rows.Scan(&dataStr, &m.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan unemailed mention: %w", err)
+		}
+		if err := json.Unmarshal([]byte(dataStr), &m); err != nil {
+			continue
+		}
+		mentions = append(mentions, m)
+	}
+	return mentions, rows.Err()
+}
+
+// MuteChannel mutes channelID for userID. Muting twice is a no-op.
+func (d *DB) MuteChannel(userID, channelID string) error {
+	_, err := d.Exec(`INSERT OR IGNORE INTO channel_mutes (user_id, channel_id) VALUES (?, ?)`, userID, channelID)
+	if err != nil {
+		return fmt.Errorf("mute channel: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) UnmuteChannel(userID, channelID string) error {
+	_, err := d.Exec(`DELETE FROM channel_mutes WHERE user_id = ? AND channel_id = ?`, userID, channelID)
+	if err != nil {
+		return fmt.Errorf("unmute channel: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) IsChannelMuted(userID, channelID string) (bool, error) {
+	var muted bool
+	err := d.QueryRow(
+		`SELECT EXISTS(SELECT 1 FROM channel_mutes WHERE user_id = ? AND channel_id = ?)`, userID, channelID,
+	).Scan(&muted)
+	if err != nil {
+		return false, fmt.Errorf("check channel muted: %w", err)
+	}
+	return muted, nil
+}
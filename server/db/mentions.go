@@ -1,6 +1,9 @@
 package db
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 func (d *DB) CreateMentions(messageID string, userIDs []string) error {
 	for _, uid := range userIDs {
@@ -35,3 +38,95 @@ func (d *DB) GetMentionsByMessage(messageID string) ([]string, error) {
 	}
 	return userIDs, rows.Err()
 }
+
+// GetMentionsByMessages is GetMentionsByMessage for several messages at
+// once, keyed by message ID.
+func (d *DB) GetMentionsByMessages(messageIDs []string) (map[string][]string, error) {
+	result := make(map[string][]string)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	placeholders := make([]string, len(messageIDs))
+	args := make([]any, len(messageIDs))
+	for i, id := range messageIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	query := fmt.Sprintf(
+		`SELECT message_id, user_id FROM mentions WHERE message_id IN (%s)`,
+		strings.Join(placeholders, ","),
+	)
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get mentions by messages: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mid, uid string
+		if err := rows.Scan(&mid, &uid); err != nil {
+			return nil, fmt.Errorf("scan mention: %w", err)
+		}
+		result[mid] = append(result[mid], uid)
+	}
+	return result, rows.Err()
+}
+
+// MentionedMessage is a message that mentions a user, with the channel
+// it was posted in.
+type MentionedMessage struct {
+	MessageWithAuthor
+	ChannelName string `json:"channel_name"`
+}
+
+// GetMentionsForUser returns messages mentioning userID, newest first.
+// Deleted messages, deleted channels and channels the user can no longer
+// read are skipped. before is an optional message ID cursor.
+func (d *DB) GetMentionsForUser(userID string, isAdmin bool, limit int, before *string) ([]MentionedMessage, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	query := `SELECT m.id, m.channel_id, m.author_id, m.content, m.reply_to_id, m.thread_id, m.created_at, m.edited_at, m.deleted_at,
+	                 COALESCE(m.author_name, u.username, 'Deleted User'), u.avatar_path, c.name
+	          FROM mentions mn
+	          JOIN messages m ON m.id = mn.message_id
+	          JOIN channels c ON c.id = m.channel_id
+	          LEFT JOIN users u ON u.id = m.author_id
+	          WHERE mn.user_id = ? AND m.deleted_at IS NULL AND c.deleted_at IS NULL
+	          AND (? OR c.visibility = 'public'
+	               OR EXISTS (SELECT 1 FROM channel_members cm WHERE cm.channel_id = c.id AND cm.user_id = mn.user_id))`
+	args := []any{userID, isAdmin}
+	if before != nil {
+		// rowid breaks ties between messages posted in the same second
+		query += ` AND (m.created_at, m.rowid) < (SELECT created_at, rowid FROM messages WHERE id = ?)`
+		args = append(args, *before)
+	}
+	query += ` ORDER BY m.created_at DESC, m.rowid DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get mentions for user: %w", err)
+	}
+	defer rows.Close()
+
+	var msgs []MentionedMessage
+	for rows.Next() {
+		var m MentionedMessage
+		if err := rows.Scan(
+			&m.ID, &m.ChannelID, &m.AuthorID, &m.Content, &m.ReplyToID, &m.ThreadID,
+			&m.CreatedAt, &m.EditedAt, &m.DeletedAt, &m.AuthorUsername, &m.AuthorAvatarURL,
+			&m.ChannelName,
+		); err != nil {
+			return nil, fmt.Errorf("scan mentioned message: %w", err)
+		}
+		msgs = append(msgs, m)
+	}
+	if msgs == nil {
+		msgs = []MentionedMessage{}
+	}
+	return msgs, rows.Err()
+}
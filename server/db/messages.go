@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"strings"
 )
@@ -33,10 +34,12 @@ type ReplyContext struct {
 	DeletedAt       *string `json:"deleted_at"`
 }
 
-func (d *DB) CreateMessage(id, channelID, authorID string, content *string, replyToID *string) (*Message, error) {
+// CreateMessage inserts a message. nonce is the sender's optional
+// idempotency key; it is unique per channel and author.
+func (d *DB) CreateMessage(id, channelID, authorID string, content *string, replyToID *string, nonce *string) (*Message, error) {
 	_, err := d.Exec(
-		`INSERT INTO messages (id, channel_id, author_id, content, reply_to_id) VALUES (?, ?, ?, ?, ?)`,
-		id, channelID, authorID, content, replyToID,
+		`INSERT INTO messages (id, channel_id, author_id, content, reply_to_id, nonce) VALUES (?, ?, ?, ?, ?, ?)`,
+		id, channelID, authorID, content, replyToID, nonce,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("create message: %w", err)
@@ -45,6 +48,20 @@ func (d *DB) CreateMessage(id, channelID, authorID string, content *string, repl
 	return d.GetMessageByID(id)
 }
 
+// CreateWebhookMessage inserts a message posted through an incoming
+// webhook. authorName is shown instead of the author's username.
+func (d *DB) CreateWebhookMessage(id, channelID, authorID, authorName string, content *string) (*Message, error) {
+	_, err := d.Exec(
+		`INSERT INTO messages (id, channel_id, author_id, author_name, content) VALUES (?, ?, ?, ?, ?)`,
+		id, channelID, authorID, authorName, content,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create webhook message: %w", err)
+	}
+
+	return d.GetMessageByID(id)
+}
+
 func (d *DB) GetMessageByID(id string) (*Message, error) {
 	m := &Message{}
 	err := d.QueryRow(
@@ -60,6 +77,23 @@ func (d *DB) GetMessageByID(id string) (*Message, error) {
 	return m, nil
 }
 
+// GetMessageByNonce finds a message the author already sent with this
+// nonce, or returns nil.
+func (d *DB) GetMessageByNonce(channelID, authorID, nonce string) (*Message, error) {
+	m := &Message{}
+	err := d.QueryRow(
+		`SELECT id, channel_id, author_id, content, reply_to_id, thread_id, created_at, edited_at, deleted_at
+		 FROM messages WHERE channel_id = ? AND author_id = ? AND nonce = ?`, channelID, authorID, nonce,
+	).Scan(&m.ID, &m.ChannelID, &m.AuthorID, &m.Content, &m.ReplyToID, &m.ThreadID, &m.CreatedAt, &m.EditedAt, &m.DeletedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get message by nonce: %w", err)
+	}
+	return m, nil
+}
+
 func (d *DB) GetMessages(channelID string, limit int, before *string) ([]MessageWithAuthor, error) {
 	if limit <= 0 || limit > 100 {
 		limit = 50
@@ -71,7 +105,7 @@ func (d *DB) GetMessages(channelID string, limit int, before *string) ([]Message
 	if before != nil {
 		rows, err = d.Query(
 			`SELECT m.id, m.channel_id, m.author_id, m.content, m.reply_to_id, m.thread_id, m.created_at, m.edited_at, m.deleted_at,
-			        COALESCE(u.username, 'Deleted User'), u.avatar_path
+			        COALESCE(m.author_name, u.username, 'Deleted User'), u.avatar_path
 			 FROM messages m
 			 LEFT JOIN users u ON u.id = m.author_id
 			 WHERE m.channel_id = ? AND m.created_at < (SELECT created_at FROM messages WHERE id = ?)
@@ -83,7 +117,7 @@ func (d *DB) GetMessages(channelID string, limit int, before *string) ([]Message
 	} else {
 		rows, err = d.Query(
 			`SELECT m.id, m.channel_id, m.author_id, m.content, m.reply_to_id, m.thread_id, m.created_at, m.edited_at, m.deleted_at,
-			        COALESCE(u.username, 'Deleted User'), u.avatar_path
+			        COALESCE(m.author_name, u.username, 'Deleted User'), u.avatar_path
 			 FROM messages m
 			 LEFT JOIN users u ON u.id = m.author_id
 			 WHERE m.channel_id = ?
@@ -115,33 +149,113 @@ func (d *DB) GetMessages(channelID string, limit int, before *string) ([]Message
 	return messages, rows.Err()
 }
 
+// GetMessagesAround returns the target top-level message with up to
+// limit/2 messages on each side, newest first to match GetMessages. It is
+// empty when the target isn't a top-level message in the channel.
 func (d *DB) GetMessagesAround(channelID string, messageID string, limit int) ([]MessageWithAuthor, error) {
 	if limit <= 0 || limit > 100 {
 		limit = 50
 	}
 	half := limit / 2
 
-	rows, err := d.Query(
-		`SELECT m.id, m.channel_id, m.author_id, m.content, m.reply_to_id, m.thread_id, m.created_at, m.edited_at, m.deleted_at,
-		        COALESCE(u.username, 'Deleted User'), u.avatar_path
+	var rowid int64
+	err := d.QueryRow(
+		`SELECT rowid FROM messages
+		 WHERE id = ? AND channel_id = ? AND (thread_id IS NULL OR thread_id = id)`,
+		messageID, channelID,
+	).Scan(&rowid)
+	if err == sql.ErrNoRows {
+		return []MessageWithAuthor{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get messages around: %w", err)
+	}
+
+	const cols = `SELECT m.id, m.channel_id, m.author_id, m.content, m.reply_to_id, m.thread_id, m.created_at, m.edited_at, m.deleted_at,
+		        COALESCE(m.author_name, u.username, 'Deleted User'), u.avatar_path
 		 FROM messages m
 		 LEFT JOIN users u ON u.id = m.author_id
-		 WHERE m.channel_id = ? AND (
-		   m.created_at < (SELECT created_at FROM messages WHERE id = ?)
-		   OR m.id = ?
-		   OR m.created_at > (SELECT created_at FROM messages WHERE id = ?)
-		 )
-		 AND (m.thread_id IS NULL OR m.thread_id = m.id)
-		 ORDER BY m.created_at ASC`,
-		channelID, messageID, messageID, messageID,
-	)
+		 WHERE m.channel_id = ? AND (m.thread_id IS NULL OR m.thread_id = m.id)`
+
+	// Target and newer, oldest first. created_at is compared in SQL: the
+	// driver hands it back reformatted, so it can't round-trip as a param.
+	after, err := d.scanMessages(cols+`
+		 AND (m.created_at, m.rowid) >= ((SELECT created_at FROM messages WHERE rowid = ?), ?)
+		 ORDER BY m.created_at ASC, m.rowid ASC LIMIT ?`,
+		channelID, rowid, rowid, half+1)
 	if err != nil {
 		return nil, fmt.Errorf("get messages around: %w", err)
 	}
+	// Older, newest first
+	before, err := d.scanMessages(cols+`
+		 AND (m.created_at, m.rowid) < ((SELECT created_at FROM messages WHERE rowid = ?), ?)
+		 ORDER BY m.created_at DESC, m.rowid DESC LIMIT ?`,
+		channelID, rowid, rowid, half)
+	if err != nil {
+		return nil, fmt.Errorf("get messages around: %w", err)
+	}
+
+	result := make([]MessageWithAuthor, 0, len(after)+len(before))
+	for i := len(after) - 1; i >= 0; i-- {
+		result = append(result, after[i])
+	}
+	return append(result, before...), nil
+}
+
+// GetRecentMessagesByChannels returns up to limit of the newest live
+// top-level messages in each channel, keyed by channel ID, newest first as
+// GetMessages returns them. Channels without messages are absent.
+func (d *DB) GetRecentMessagesByChannels(channelIDs []string, limit int) (map[string][]MessageWithAuthor, error) {
+	result := make(map[string][]MessageWithAuthor)
+	if len(channelIDs) == 0 {
+		return result, nil
+	}
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	placeholders := make([]string, len(channelIDs))
+	args := make([]any, 0, len(channelIDs)+1)
+	for i, id := range channelIDs {
+		placeholders[i] = "?"
+		args = append(args, id)
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(
+		`SELECT id, channel_id, author_id, content, reply_to_id, thread_id, created_at, edited_at, deleted_at, author, avatar_path
+		 FROM (
+		     SELECT m.id, m.channel_id, m.author_id, m.content, m.reply_to_id, m.thread_id, m.created_at, m.edited_at, m.deleted_at,
+		            COALESCE(m.author_name, u.username, 'Deleted User') AS author, u.avatar_path,
+		            ROW_NUMBER() OVER (PARTITION BY m.channel_id ORDER BY m.created_at DESC, m.rowid DESC) AS rn
+		     FROM messages m
+		     LEFT JOIN users u ON u.id = m.author_id
+		     WHERE m.channel_id IN (%s) AND m.deleted_at IS NULL
+		     AND (m.thread_id IS NULL OR m.thread_id = m.id)
+		 ) recent
+		 WHERE rn <= ?
+		 ORDER BY channel_id, rn`,
+		strings.Join(placeholders, ","),
+	)
+
+	msgs, err := d.scanMessages(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get recent messages by channels: %w", err)
+	}
+	for _, m := range msgs {
+		result[m.ChannelID] = append(result[m.ChannelID], m)
+	}
+	return result, nil
+}
+
+func (d *DB) scanMessages(query string, args ...any) ([]MessageWithAuthor, error) {
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
 	defer rows.Close()
 
-	var all []MessageWithAuthor
-	targetIdx := -1
+	var messages []MessageWithAuthor
 	for rows.Next() {
 		var m MessageWithAuthor
 		if err := rows.Scan(
@@ -150,35 +264,9 @@ func (d *DB) GetMessagesAround(channelID string, messageID string, limit int) ([
 		); err != nil {
 			return nil, fmt.Errorf("scan message: %w", err)
 		}
-		if m.ID == messageID {
-			targetIdx = len(all)
-		}
-		all = append(all, m)
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-
-	if targetIdx == -1 {
-		return []MessageWithAuthor{}, nil
-	}
-
-	// Window around the target
-	start := targetIdx - half
-	if start < 0 {
-		start = 0
-	}
-	end := targetIdx + half + 1
-	if end > len(all) {
-		end = len(all)
-	}
-
-	// Return in DESC order (newest first) to match GetMessages convention
-	result := all[start:end]
-	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
-		result[i], result[j] = result[j], result[i]
+		messages = append(messages, m)
 	}
-	return result, nil
+	return messages, rows.Err()
 }
 
 func (d *DB) EditMessage(id, content string) error {
@@ -191,7 +279,7 @@ func (d *DB) EditMessage(id, content string) error {
 
 func (d *DB) DeleteMessage(id string) error {
 	_, err := d.Exec(
-		`UPDATE messages SET content = NULL, deleted_at = datetime('now') WHERE id = ? AND deleted_at IS NULL`,
+		`UPDATE messages SET deleted_content = content, content = NULL, deleted_at = datetime('now') WHERE id = ? AND deleted_at IS NULL`,
 		id,
 	)
 	if err != nil {
@@ -203,10 +291,126 @@ func (d *DB) DeleteMessage(id string) error {
 	return nil
 }
 
+// PurgedMessage is what PurgeMessage removed beyond the message row: the
+// attachments, whose files the caller removes, and the notifications
+// quoting the message, by user.
+type PurgedMessage struct {
+	Attachments   []Attachment
+	Notifications map[string][]string // user ID → notification IDs
+}
+
+// PurgeMessage hard-deletes a message, its attachment rows and the
+// notifications about it. Reactions, mentions and unfurls cascade, and
+// replies lose their reply_to. A purged thread root hands its thread to
+// the earliest reply, which becomes the root, so the rest don't fall back
+// into the channel.
+func (d *DB) PurgeMessage(id string) (*PurgedMessage, error) {
+	tx, err := d.Begin()
+	if err != nil {
+		return nil, fmt.Errorf("begin purge message: %w", err)
+	}
+	defer tx.Rollback()
+
+	var newRoot string
+	err = tx.QueryRow(
+		`SELECT id FROM messages WHERE thread_id = ? AND id != ? ORDER BY created_at ASC, rowid ASC LIMIT 1`, id, id,
+	).Scan(&newRoot)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("find purged thread's next root: %w", err)
+	}
+	if newRoot != "" {
+		if _, err := tx.Exec(`UPDATE messages SET thread_id = ? WHERE thread_id = ? AND id != ?`, newRoot, id, id); err != nil {
+			return nil, fmt.Errorf("re-root purged thread: %w", err)
+		}
+	}
+
+	rows, err := tx.Query(`SELECT id, path, thumb_path FROM attachments WHERE message_id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("query purged attachments: %w", err)
+	}
+	var attachments []Attachment
+	for rows.Next() {
+		var a Attachment
+		if err := rows.Scan(&a.ID, &a.Path, &a.ThumbPath); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan purged attachment: %w", err)
+		}
+		attachments = append(attachments, a)
+	}
+	rows.Close()
+
+	notifications := make(map[string][]string)
+	rows, err = tx.Query(`SELECT id, user_id FROM notifications WHERE json_extract(data, '$.message_id') = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("query purged notifications: %w", err)
+	}
+	for rows.Next() {
+		var notifID, userID string
+		if err := rows.Scan(&notifID, &userID); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("scan purged notification: %w", err)
+		}
+		notifications[userID] = append(notifications[userID], notifID)
+	}
+	rows.Close()
+	if _, err := tx.Exec(`DELETE FROM notifications WHERE json_extract(data, '$.message_id') = ?`, id); err != nil {
+		return nil, fmt.Errorf("delete purged notifications: %w", err)
+	}
+
+	if _, err := tx.Exec(`DELETE FROM attachments WHERE message_id = ?`, id); err != nil {
+		return nil, fmt.Errorf("delete purged attachments: %w", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM messages WHERE id = ?`, id); err != nil {
+		return nil, fmt.Errorf("delete purged message: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("commit purge message: %w", err)
+	}
+	return &PurgedMessage{Attachments: attachments, Notifications: notifications}, nil
+}
+
+// GetDeletedContent returns the original content of soft-deleted messages,
+// keyed by message ID. For admin moderation only — never expose this to
+// regular users.
+func (d *DB) GetDeletedContent(messageIDs []string) (map[string]string, error) {
+	result := make(map[string]string)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	placeholders := make([]string, len(messageIDs))
+	args := make([]any, len(messageIDs))
+	for i, id := range messageIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	query := fmt.Sprintf(
+		`SELECT id, deleted_content FROM messages
+		 WHERE id IN (%s) AND deleted_at IS NOT NULL AND deleted_content IS NOT NULL`,
+		strings.Join(placeholders, ","),
+	)
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get deleted content: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, content string
+		if err := rows.Scan(&id, &content); err != nil {
+			return nil, fmt.Errorf("scan deleted content: %w", err)
+		}
+		result[id] = content
+	}
+	return result, rows.Err()
+}
+
 func (d *DB) GetReplyContext(messageID string) (*ReplyContext, error) {
 	rc := &ReplyContext{}
 	err := d.QueryRow(
-		`SELECT m.id, m.author_id, COALESCE(u.username, 'Deleted User'), u.avatar_path, m.content, m.deleted_at
+		`SELECT m.id, m.author_id, COALESCE(m.author_name, u.username, 'Deleted User'), u.avatar_path, m.content, m.deleted_at
 		 FROM messages m
 		 LEFT JOIN users u ON u.id = m.author_id
 		 WHERE m.id = ?`, messageID,
@@ -217,12 +421,122 @@ func (d *DB) GetReplyContext(messageID string) (*ReplyContext, error) {
 	if err != nil {
 		return nil, fmt.Errorf("get reply context: %w", err)
 	}
-	// Truncate content to 100 chars
+	trimReplyContent(rc)
+	return rc, nil
+}
+
+// GetReplyContexts is GetReplyContext for several targets at once, keyed
+// by message ID. Targets that no longer exist are absent.
+func (d *DB) GetReplyContexts(messageIDs []string) (map[string]*ReplyContext, error) {
+	result := make(map[string]*ReplyContext)
+	if len(messageIDs) == 0 {
+		return result, nil
+	}
+
+	placeholders := make([]string, len(messageIDs))
+	args := make([]any, len(messageIDs))
+	for i, id := range messageIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	query := fmt.Sprintf(
+		`SELECT m.id, m.author_id, COALESCE(m.author_name, u.username, 'Deleted User'), u.avatar_path, m.content, m.deleted_at
+		 FROM messages m
+		 LEFT JOIN users u ON u.id = m.author_id
+		 WHERE m.id IN (%s)`,
+		strings.Join(placeholders, ","),
+	)
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get reply contexts: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		rc := &ReplyContext{}
+		if err := rows.Scan(&rc.ID, &rc.AuthorID, &rc.AuthorUsername, &rc.AuthorAvatarURL, &rc.Content, &rc.DeletedAt); err != nil {
+			return nil, fmt.Errorf("scan reply context: %w", err)
+		}
+		trimReplyContent(rc)
+		result[rc.ID] = rc
+	}
+	return result, rows.Err()
+}
+
+// trimReplyContent nulls a deleted target's content and truncates a live
+// one's to 100 chars.
+func trimReplyContent(rc *ReplyContext) {
+	if rc.DeletedAt != nil {
+		rc.Content = nil
+		return
+	}
 	if rc.Content != nil && len(*rc.Content) > 100 {
 		truncated := (*rc.Content)[:100] + "..."
 		rc.Content = &truncated
 	}
-	return rc, nil
+}
+
+// ReplyChainEntry is one ancestor in a reply chain.
+type ReplyChainEntry struct {
+	ReplyContext
+	ChannelID string  `json:"channel_id"`
+	ReplyToID *string `json:"reply_to_id"`
+	CreatedAt string  `json:"created_at"`
+}
+
+// GetReplyChain follows reply_to_id up from messageID, returning at most
+// depth ancestors, nearest first. The walk stops after a deleted parent
+// (which is included, marked deleted), at a missing one, at a parent in
+// another channel, or if it comes back to a message it has seen. complete is
+// true when the chain reached a message that isn't a reply.
+func (d *DB) GetReplyChain(messageID string, depth int) (chain []ReplyChainEntry, complete bool, err error) {
+	chain = []ReplyChainEntry{}
+	start, err := d.GetMessageByID(messageID)
+	if err != nil || start == nil {
+		return chain, false, err
+	}
+
+	seen := map[string]bool{start.ID: true}
+	next := start.ReplyToID
+	for next != nil {
+		if len(chain) == depth || seen[*next] {
+			return chain, false, nil
+		}
+		seen[*next] = true
+
+		var e ReplyChainEntry
+		err := d.QueryRow(
+			`SELECT m.id, m.author_id, COALESCE(m.author_name, u.username, 'Deleted User'), u.avatar_path, m.content, m.deleted_at,
+			        m.channel_id, m.reply_to_id, m.created_at
+			 FROM messages m
+			 LEFT JOIN users u ON u.id = m.author_id
+			 WHERE m.id = ?`, *next,
+		).Scan(&e.ID, &e.AuthorID, &e.AuthorUsername, &e.AuthorAvatarURL, &e.Content, &e.DeletedAt,
+			&e.ChannelID, &e.ReplyToID, &e.CreatedAt)
+		if err == sql.ErrNoRows {
+			return chain, false, nil
+		}
+		if err != nil {
+			return nil, false, fmt.Errorf("get reply chain: %w", err)
+		}
+		if e.ChannelID != start.ChannelID {
+			return chain, false, nil
+		}
+		if e.DeletedAt != nil {
+			e.Content = nil
+			chain = append(chain, e)
+			return chain, false, nil
+		}
+		if e.Content != nil && len(*e.Content) > 100 {
+			truncated := (*e.Content)[:100] + "..."
+			e.Content = &truncated
+		}
+		chain = append(chain, e)
+		next = e.ReplyToID
+	}
+	return chain, true, nil
 }
 
 func (d *DB) SetThreadID(messageID string, threadID string) error {
@@ -293,13 +607,13 @@ func (d *DB) GetThreadSummaries(threadIDs []string) (map[string]ThreadSummary, e
 
 	query := fmt.Sprintf(`
 		SELECT m.thread_id, COUNT(*) - 1 as reply_count, MAX(m.created_at) as last_reply_at,
-			COALESCE((SELECT u.username FROM messages m2 JOIN users u ON m2.author_id = u.id
+			COALESCE((SELECT COALESCE(m2.author_name, u.username) FROM messages m2 JOIN users u ON m2.author_id = u.id
 				WHERE m2.thread_id = m.thread_id AND m2.deleted_at IS NULL
 				ORDER BY m2.created_at DESC LIMIT 1), '') as last_reply_author
 		FROM messages m
 		WHERE m.thread_id IN (%s) AND m.deleted_at IS NULL
 		GROUP BY m.thread_id
-		HAVING reply_count > 0
+		HAVING COUNT(*) > 1
 	`, strings.Join(placeholders, ","))
 
 	rows, err := d.Query(query, args...)
@@ -359,10 +673,10 @@ func (d *DB) GetChannelThreads(channelID string) ([]ThreadListItem, error) {
 			root.id,
 			root.content,
 			root.author_id,
-			COALESCE(u.username, '') as author_username,
+			COALESCE(root.author_name, u.username, '') as author_username,
 			COUNT(reply.id) - 1 as reply_count,
 			MAX(reply.created_at) as last_reply_at,
-			COALESCE((SELECT u2.username FROM messages m2 JOIN users u2 ON m2.author_id = u2.id
+			COALESCE((SELECT COALESCE(m2.author_name, u2.username) FROM messages m2 JOIN users u2 ON m2.author_id = u2.id
 				WHERE m2.thread_id = root.id AND m2.deleted_at IS NULL
 				ORDER BY m2.created_at DESC LIMIT 1), '') as last_reply_author,
 			root.created_at
@@ -370,7 +684,7 @@ func (d *DB) GetChannelThreads(channelID string) ([]ThreadListItem, error) {
 		JOIN messages reply ON reply.thread_id = root.id AND reply.deleted_at IS NULL
 		LEFT JOIN users u ON root.author_id = u.id
 		WHERE root.channel_id = ? AND root.thread_id = root.id AND root.deleted_at IS NULL
-		GROUP BY root.id
+		GROUP BY root.id, u.username
 		ORDER BY last_reply_at DESC
 	`, channelID)
 	if err != nil {
@@ -1,6 +1,13 @@
 package db
 
-import "fmt"
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
 
 var migrations = []string{
 	// Version 1: Initial schema
@@ -371,6 +378,143 @@ var migrations = []string{
 		ON channels(position) WHERE deleted_at IS NULL;
 
 	DROP TABLE IF EXISTS channel_reads;`,
+
+	// Version 29: Preserve content of soft-deleted messages for admin moderation
+	`ALTER TABLE messages ADD COLUMN deleted_content TEXT;`,
+
+	// Version 30: Opt-in daily digest of missed mentions
+	`ALTER TABLE users ADD COLUMN email_digest_enabled BOOLEAN NOT NULL DEFAULT FALSE;
+	ALTER TABLE users ADD COLUMN last_digest_at DATETIME;
+	ALTER TABLE users ADD COLUMN last_seen_at DATETIME;`,
+
+	// Version 31: One-time magic-link login tokens
+	`CREATE TABLE magic_links (
+		id         TEXT PRIMARY KEY,
+		user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		token_hash TEXT NOT NULL UNIQUE,
+		expires_at DATETIME NOT NULL,
+		used_at    DATETIME,
+		created_at DATETIME DEFAULT (datetime('now'))
+	);
+	CREATE INDEX idx_magic_links_user ON magic_links(user_id, created_at);`,
+
+	// Version 32: Client nonces so a resent send_message isn't stored twice
+	`ALTER TABLE messages ADD COLUMN nonce TEXT;
+	CREATE UNIQUE INDEX idx_messages_nonce ON messages(channel_id, author_id, nonce) WHERE nonce IS NOT NULL;`,
+
+	// Version 33: Per-user favorite radio stations
+	`CREATE TABLE radio_favorites (
+		user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		station_id TEXT NOT NULL REFERENCES radio_stations(id) ON DELETE CASCADE,
+		created_at DATETIME DEFAULT (datetime('now')),
+		PRIMARY KEY (user_id, station_id)
+	);`,
+
+	// Version 34: Per-channel incoming webhooks; author_name overrides the
+	// author's username on messages they post
+	`CREATE TABLE incoming_webhooks (
+		id         TEXT PRIMARY KEY,
+		channel_id TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+		token_hash TEXT NOT NULL,
+		name       TEXT NOT NULL,
+		created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		created_at DATETIME DEFAULT (datetime('now'))
+	);
+	CREATE INDEX idx_incoming_webhooks_channel ON incoming_webhooks(channel_id);
+	ALTER TABLE messages ADD COLUMN author_name TEXT;`,
+
+	// Version 35: Outgoing event webhooks and their dead-letter log
+	`CREATE TABLE outgoing_webhooks (
+		id         TEXT PRIMARY KEY,
+		name       TEXT NOT NULL,
+		url        TEXT NOT NULL,
+		secret_enc TEXT NOT NULL,
+		events     TEXT NOT NULL,
+		created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+		created_at DATETIME DEFAULT (datetime('now'))
+	);
+	CREATE TABLE outgoing_webhook_failures (
+		id         INTEGER PRIMARY KEY AUTOINCREMENT,
+		webhook_id TEXT NOT NULL REFERENCES outgoing_webhooks(id) ON DELETE CASCADE,
+		event      TEXT NOT NULL,
+		payload    TEXT NOT NULL,
+		error      TEXT NOT NULL,
+		attempts   INTEGER NOT NULL,
+		created_at DATETIME DEFAULT (datetime('now'))
+	);
+	CREATE INDEX idx_outgoing_webhook_failures ON outgoing_webhook_failures(webhook_id, id);`,
+
+	// Version 36: Spoiler flag on attachments
+	`ALTER TABLE attachments ADD COLUMN spoiler INTEGER NOT NULL DEFAULT 0;`,
+
+	// Version 37: Attachment download counts
+	`ALTER TABLE attachments ADD COLUMN download_count INTEGER NOT NULL DEFAULT 0;`,
+
+	// Version 38: Mention email opt-out and per-user channel mutes
+	`ALTER TABLE users ADD COLUMN mention_email_enabled BOOLEAN NOT NULL DEFAULT TRUE;
+	CREATE TABLE channel_mutes (
+		user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		channel_id TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+		created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (user_id, channel_id)
+	);`,
+
+	// Version 39: Attachment order within a message
+	`ALTER TABLE attachments ADD COLUMN position INTEGER;`,
+	// Version 40: Announcement channels (only managers and admins post)
+	`ALTER TABLE channels ADD COLUMN announcement BOOLEAN NOT NULL DEFAULT FALSE;`,
+	// Version 41: Untouched upload kept beside a transcoded radio track
+	`ALTER TABLE radio_tracks ADD COLUMN original_path TEXT;`,
+	// Version 42: Per-station listener volume and intro jingle
+	`ALTER TABLE radio_stations ADD COLUMN default_volume INTEGER NOT NULL DEFAULT 100;
+	ALTER TABLE radio_stations ADD COLUMN intro_track_id TEXT REFERENCES radio_tracks(id) ON DELETE SET NULL;`,
+	// Version 43: Per-channel posting restrictions
+	`ALTER TABLE channels ADD COLUMN allow_attachments BOOLEAN NOT NULL DEFAULT TRUE;
+	ALTER TABLE channels ADD COLUMN allow_links BOOLEAN NOT NULL DEFAULT TRUE;`,
+	// Version 44: Verification code issuance log, kept when the code is replaced
+	`CREATE TABLE IF NOT EXISTS verification_code_events (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		created_at DATETIME NOT NULL DEFAULT (datetime('now'))
+	);
+	CREATE INDEX idx_verification_code_events_user ON verification_code_events(user_id, created_at);`,
+	// Version 45: Browser-computed radio waveforms from 0..1 floats to 0-100 ints
+	`UPDATE radio_tracks SET waveform = (
+		SELECT json_group_array(CAST(round(value * 100) AS INTEGER)) FROM json_each(radio_tracks.waveform)
+	) WHERE json_valid(waveform) AND json_type(waveform) = 'array' AND waveform LIKE '%.%';`,
+}
+
+// SchemaVersion is the schema version this binary migrates databases to.
+func SchemaVersion() int {
+	return len(migrations)
+}
+
+// CheckSchema reports the schema version of the database in dataDir and
+// the version this binary expects, without migrating or creating
+// anything. A missing database reports version 0.
+func CheckSchema(dataDir string) (current, target int, err error) {
+	dbPath := filepath.Join(dataDir, "voicechat.db")
+	if _, err := os.Stat(dbPath); errors.Is(err, fs.ErrNotExist) {
+		return 0, len(migrations), nil
+	}
+	sqlDB, err := sql.Open("sqlite", "file:"+dbPath+"?mode=ro")
+	if err != nil {
+		return 0, 0, fmt.Errorf("open database: %w", err)
+	}
+	defer sqlDB.Close()
+
+	var hasTable int
+	err = sqlDB.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_version'`).Scan(&hasTable)
+	if err != nil {
+		return 0, 0, fmt.Errorf("read schema: %w", err)
+	}
+	if hasTable == 0 {
+		return 0, len(migrations), nil
+	}
+	if err := sqlDB.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&current); err != nil {
+		return 0, 0, fmt.Errorf("get schema version: %w", err)
+	}
+	return current, len(migrations), nil
 }
 
 func (d *DB) migrate() error {
@@ -386,6 +530,12 @@ func (d *DB) migrate() error {
 		return fmt.Errorf("get schema version: %w", err)
 	}
 
+	// A newer binary already migrated this database. Its tables may not
+	// match what this one reads and writes, so don't touch it.
+	if currentVersion > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this server supports (%d); run the newer server or restore a backup from before the upgrade", currentVersion, len(migrations))
+	}
+
 	for i := currentVersion; i < len(migrations); i++ {
 		version := i + 1
 
@@ -0,0 +1,436 @@
+package db
+
+import (
+	"fmt"
+)
+
+// A new Postgres database is created directly at pgBaselineVersion, with
+// the schema SQLite has after that many migrations. Every later migration
+// appended to migrations needs its Postgres counterpart appended here.
+const pgBaselineVersion = 44
+
+const pgBaseline = `
+CREATE TABLE users (
+	id                    TEXT PRIMARY KEY,
+	username              TEXT NOT NULL UNIQUE,
+	password_hash         TEXT,
+	is_admin              BOOLEAN NOT NULL DEFAULT FALSE,
+	avatar_path           TEXT,
+	created_at            TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	approved              BOOLEAN NOT NULL DEFAULT TRUE,
+	knock_message         TEXT,
+	email                 TEXT,
+	email_verified_at     TIMESTAMP(0),
+	register_ip           TEXT,
+	last_mention_email_at TIMESTAMP(0),
+	email_digest_enabled  BOOLEAN NOT NULL DEFAULT FALSE,
+	last_digest_at        TIMESTAMP(0),
+	last_seen_at          TIMESTAMP(0),
+	mention_email_enabled BOOLEAN NOT NULL DEFAULT TRUE
+);
+CREATE UNIQUE INDEX idx_users_email_nocase ON users(lower(email)) WHERE email IS NOT NULL;
+
+CREATE TABLE tokens (
+	token      TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	expires_at TIMESTAMP(0)
+);
+CREATE INDEX idx_tokens_user ON tokens(user_id);
+CREATE INDEX idx_tokens_expires ON tokens(expires_at);
+
+CREATE TABLE channels (
+	id                TEXT PRIMARY KEY,
+	name              TEXT NOT NULL,
+	type              TEXT NOT NULL CHECK(type IN ('voice', 'text')),
+	position          INTEGER NOT NULL,
+	created_at        TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	created_by        TEXT REFERENCES users(id) ON DELETE SET NULL,
+	deleted_at        TIMESTAMP(0),
+	visibility        TEXT NOT NULL DEFAULT 'public',
+	description       TEXT,
+	announcement      BOOLEAN NOT NULL DEFAULT FALSE,
+	allow_attachments BOOLEAN NOT NULL DEFAULT TRUE,
+	allow_links       BOOLEAN NOT NULL DEFAULT TRUE
+);
+CREATE INDEX idx_channels_not_deleted ON channels(position) WHERE deleted_at IS NULL;
+
+-- rowid stands in for SQLite's implicit rowid, which orders rows created
+-- in the same second
+CREATE TABLE messages (
+	rowid           BIGSERIAL UNIQUE,
+	id              TEXT PRIMARY KEY,
+	channel_id      TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+	author_id       TEXT REFERENCES users(id) ON DELETE SET NULL,
+	content         TEXT CHECK(content IS NULL OR length(content) <= 32000),
+	reply_to_id     TEXT REFERENCES messages(id) ON DELETE SET NULL,
+	thread_id       TEXT REFERENCES messages(id) ON DELETE SET NULL,
+	created_at      TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	edited_at       TIMESTAMP(0),
+	deleted_at      TIMESTAMP(0),
+	deleted_content TEXT,
+	nonce           TEXT,
+	author_name     TEXT
+);
+CREATE INDEX idx_messages_channel_time ON messages(channel_id, created_at DESC);
+CREATE INDEX idx_messages_thread ON messages(thread_id, created_at ASC);
+CREATE INDEX idx_messages_channel_not_deleted ON messages(channel_id, created_at DESC) WHERE deleted_at IS NULL;
+CREATE UNIQUE INDEX idx_messages_nonce ON messages(channel_id, author_id, nonce) WHERE nonce IS NOT NULL;
+
+CREATE TABLE reactions (
+	message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	emoji      TEXT NOT NULL,
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	PRIMARY KEY (message_id, user_id, emoji)
+);
+CREATE INDEX idx_reactions_message ON reactions(message_id);
+
+CREATE TABLE attachments (
+	rowid          BIGSERIAL,
+	id             TEXT PRIMARY KEY,
+	message_id     TEXT REFERENCES messages(id) ON DELETE CASCADE,
+	filename       TEXT NOT NULL,
+	path           TEXT NOT NULL,
+	thumb_path     TEXT,
+	size_bytes     BIGINT NOT NULL,
+	mime_type      TEXT NOT NULL,
+	width          INTEGER,
+	height         INTEGER,
+	created_at     TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	uploaded_by    TEXT REFERENCES users(id) ON DELETE SET NULL,
+	spoiler        BOOLEAN NOT NULL DEFAULT FALSE,
+	download_count INTEGER NOT NULL DEFAULT 0,
+	position       INTEGER
+);
+CREATE INDEX idx_attachments_message ON attachments(message_id);
+CREATE INDEX idx_attachments_orphan ON attachments(message_id, created_at) WHERE message_id IS NULL;
+
+CREATE TABLE mentions (
+	message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (message_id, user_id)
+);
+CREATE INDEX idx_mentions_user ON mentions(user_id);
+
+CREATE TABLE notifications (
+	rowid      BIGSERIAL,
+	id         TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	type       TEXT NOT NULL,
+	data       TEXT NOT NULL DEFAULT '{}',
+	read       BOOLEAN NOT NULL DEFAULT FALSE,
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0)
+);
+CREATE INDEX idx_notifications_user ON notifications(user_id, read, created_at DESC);
+
+CREATE TABLE media (
+	id          TEXT PRIMARY KEY,
+	filename    TEXT NOT NULL,
+	path        TEXT NOT NULL,
+	mime_type   TEXT NOT NULL,
+	size_bytes  BIGINT NOT NULL,
+	uploaded_by TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at  TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0)
+);
+
+CREATE TABLE channel_managers (
+	channel_id TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (channel_id, user_id)
+);
+CREATE INDEX idx_channel_managers_user ON channel_managers(user_id);
+
+CREATE TABLE radio_stations (
+	id              TEXT PRIMARY KEY,
+	name            TEXT NOT NULL,
+	created_by      TEXT REFERENCES users(id) ON DELETE SET NULL,
+	position        INTEGER NOT NULL,
+	created_at      TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	playback_mode   TEXT NOT NULL DEFAULT 'play_all',
+	public_controls BOOLEAN NOT NULL DEFAULT FALSE,
+	default_volume  INTEGER NOT NULL DEFAULT 100
+);
+
+CREATE TABLE radio_playlists (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	station_id TEXT REFERENCES radio_stations(id) ON DELETE CASCADE
+);
+
+CREATE TABLE radio_tracks (
+	id            TEXT PRIMARY KEY,
+	playlist_id   TEXT NOT NULL REFERENCES radio_playlists(id) ON DELETE CASCADE,
+	filename      TEXT NOT NULL,
+	path          TEXT NOT NULL,
+	mime_type     TEXT NOT NULL,
+	size_bytes    BIGINT NOT NULL,
+	duration      DOUBLE PRECISION,
+	position      INTEGER NOT NULL,
+	created_at    TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	waveform      TEXT,
+	original_path TEXT
+);
+CREATE INDEX idx_radio_tracks_playlist ON radio_tracks(playlist_id, position);
+
+ALTER TABLE radio_stations ADD COLUMN intro_track_id TEXT REFERENCES radio_tracks(id) ON DELETE SET NULL;
+
+CREATE TABLE radio_station_managers (
+	station_id TEXT NOT NULL REFERENCES radio_stations(id) ON DELETE CASCADE,
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	PRIMARY KEY (station_id, user_id)
+);
+CREATE INDEX idx_radio_station_managers_user ON radio_station_managers(user_id);
+
+CREATE TABLE radio_favorites (
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	station_id TEXT NOT NULL REFERENCES radio_stations(id) ON DELETE CASCADE,
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	PRIMARY KEY (user_id, station_id)
+);
+
+CREATE TABLE verification_codes (
+	id         TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	code_hash  TEXT NOT NULL,
+	expires_at TIMESTAMP(0) NOT NULL,
+	attempts   INTEGER NOT NULL DEFAULT 0,
+	created_at TIMESTAMP(0) NOT NULL DEFAULT LOCALTIMESTAMP(0)
+);
+CREATE UNIQUE INDEX idx_verification_codes_user ON verification_codes(user_id);
+
+CREATE TABLE verification_code_events (
+	id         BIGSERIAL PRIMARY KEY,
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	created_at TIMESTAMP(0) NOT NULL DEFAULT LOCALTIMESTAMP(0)
+);
+CREATE INDEX idx_verification_code_events_user ON verification_code_events(user_id, created_at);
+
+CREATE TABLE settings (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+
+CREATE TABLE url_unfurls (
+	id           TEXT PRIMARY KEY,
+	message_id   TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	url          TEXT NOT NULL,
+	site_name    TEXT,
+	title        TEXT,
+	description  TEXT,
+	image_url    TEXT,
+	fetch_status TEXT NOT NULL DEFAULT 'pending',
+	fetched_at   TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0)
+);
+CREATE INDEX idx_url_unfurls_message ON url_unfurls(message_id);
+
+CREATE TABLE strudel_patterns (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	code       TEXT NOT NULL DEFAULT '',
+	owner_id   TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	visibility TEXT NOT NULL DEFAULT 'private',
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	updated_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0)
+);
+CREATE INDEX idx_strudel_patterns_owner ON strudel_patterns(owner_id);
+
+CREATE TABLE webhook_keys (
+	id         TEXT PRIMARY KEY,
+	key_hash   TEXT UNIQUE NOT NULL,
+	key_prefix TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0)
+);
+
+CREATE TABLE starred_messages (
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	message_id TEXT NOT NULL REFERENCES messages(id) ON DELETE CASCADE,
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	PRIMARY KEY (user_id, message_id)
+);
+CREATE INDEX idx_starred_user ON starred_messages(user_id, created_at DESC);
+
+CREATE TABLE channel_members (
+	channel_id TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	role       TEXT NOT NULL DEFAULT 'member' CHECK(role IN ('owner', 'member')),
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	PRIMARY KEY (channel_id, user_id)
+);
+CREATE INDEX idx_channel_members_user ON channel_members(user_id);
+
+CREATE TABLE channel_access_requests (
+	id         TEXT PRIMARY KEY,
+	channel_id TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	status     TEXT NOT NULL DEFAULT 'pending' CHECK(status IN ('pending', 'approved', 'denied')),
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	UNIQUE(channel_id, user_id)
+);
+CREATE INDEX idx_channel_requests_channel ON channel_access_requests(channel_id, status);
+
+CREATE TABLE channel_read_state (
+	channel_id       TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+	user_id          TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	last_read_msg_id TEXT,
+	PRIMARY KEY (channel_id, user_id)
+);
+
+CREATE TABLE channel_mutes (
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	channel_id TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+	created_at TIMESTAMP(0) NOT NULL DEFAULT LOCALTIMESTAMP(0),
+	PRIMARY KEY (user_id, channel_id)
+);
+
+CREATE TABLE documents (
+	id         TEXT PRIMARY KEY,
+	channel_id TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+	path       TEXT NOT NULL,
+	content    TEXT NOT NULL DEFAULT '',
+	created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+	updated_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	updated_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0),
+	UNIQUE(channel_id, path)
+);
+CREATE INDEX idx_documents_channel ON documents(channel_id);
+
+CREATE TABLE magic_links (
+	id         TEXT PRIMARY KEY,
+	user_id    TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+	token_hash TEXT NOT NULL UNIQUE,
+	expires_at TIMESTAMP(0) NOT NULL,
+	used_at    TIMESTAMP(0),
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0)
+);
+CREATE INDEX idx_magic_links_user ON magic_links(user_id, created_at);
+
+CREATE TABLE incoming_webhooks (
+	rowid      BIGSERIAL,
+	id         TEXT PRIMARY KEY,
+	channel_id TEXT NOT NULL REFERENCES channels(id) ON DELETE CASCADE,
+	token_hash TEXT NOT NULL,
+	name       TEXT NOT NULL,
+	created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0)
+);
+CREATE INDEX idx_incoming_webhooks_channel ON incoming_webhooks(channel_id);
+
+CREATE TABLE outgoing_webhooks (
+	rowid      BIGSERIAL,
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	url        TEXT NOT NULL,
+	secret_enc TEXT NOT NULL,
+	events     TEXT NOT NULL,
+	created_by TEXT REFERENCES users(id) ON DELETE SET NULL,
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0)
+);
+CREATE TABLE outgoing_webhook_failures (
+	id         BIGSERIAL PRIMARY KEY,
+	webhook_id TEXT NOT NULL REFERENCES outgoing_webhooks(id) ON DELETE CASCADE,
+	event      TEXT NOT NULL,
+	payload    TEXT NOT NULL,
+	error      TEXT NOT NULL,
+	attempts   INTEGER NOT NULL,
+	created_at TIMESTAMP(0) DEFAULT LOCALTIMESTAMP(0)
+);
+CREATE INDEX idx_outgoing_webhook_failures ON outgoing_webhook_failures(webhook_id, id);
+`
+
+var pgMigrations = []string{
+	// Version 45 onwards, matching migrations[44:]
+	`UPDATE radio_tracks SET waveform = (
+		SELECT json_agg(round(e.value::numeric * 100)::int ORDER BY e.n)::text
+		FROM json_array_elements_text(waveform::json) WITH ORDINALITY AS e(value, n)
+	) WHERE waveform ~ '^\[[0-9., eE+-]*\]$' AND waveform LIKE '%.%';`,
+}
+
+// pgMigrationLock is the advisory lock key servers sharing a database
+// take while migrating it.
+const pgMigrationLock = 0x766f696365 // "voice"
+
+func (d *DB) migratePostgres() error {
+	if pgBaselineVersion+len(pgMigrations) != len(migrations) {
+		return fmt.Errorf("postgres migrations reach version %d but the schema is at %d", pgBaselineVersion+len(pgMigrations), len(migrations))
+	}
+
+	// One transaction for the lot: DDL is transactional in Postgres, and
+	// the lock makes other servers starting at the same time wait here
+	// and then find nothing left to do.
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin migrations: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(?)`, pgMigrationLock); err != nil {
+		return fmt.Errorf("lock migrations: %w", err)
+	}
+	if _, err := tx.Exec(`CREATE TABLE IF NOT EXISTS schema_version (version INTEGER PRIMARY KEY)`); err != nil {
+		return fmt.Errorf("create schema_version: %w", err)
+	}
+
+	var currentVersion int
+	if err := tx.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&currentVersion); err != nil {
+		return fmt.Errorf("get schema version: %w", err)
+	}
+	if currentVersion > len(migrations) {
+		return fmt.Errorf("database schema version %d is newer than this server supports (%d); run the newer server or restore a backup from before the upgrade", currentVersion, len(migrations))
+	}
+
+	// The schema is already Postgres SQL, so it goes to the driver as is
+	if currentVersion == 0 {
+		if _, err := tx.Tx.Exec(pgBaseline); err != nil {
+			return fmt.Errorf("create schema: %w", err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES (?)`, pgBaselineVersion); err != nil {
+			return fmt.Errorf("record schema: %w", err)
+		}
+		currentVersion = pgBaselineVersion
+	}
+	if currentVersion < pgBaselineVersion {
+		return fmt.Errorf("database schema version %d predates the Postgres baseline (%d)", currentVersion, pgBaselineVersion)
+	}
+
+	for i := currentVersion - pgBaselineVersion; i < len(pgMigrations); i++ {
+		version := pgBaselineVersion + i + 1
+		if _, err := tx.Tx.Exec(pgMigrations[i]); err != nil {
+			return fmt.Errorf("run migration %d: %w", version, err)
+		}
+		if _, err := tx.Exec(`INSERT INTO schema_version (version) VALUES (?)`, version); err != nil {
+			return fmt.Errorf("record migration %d: %w", version, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit migrations: %w", err)
+	}
+	return nil
+}
+
+// CheckPostgresSchema is CheckSchema for the Postgres database at url.
+func CheckPostgresSchema(url string) (current, target int, err error) {
+	sqlDB, err := openPostgres(url)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer sqlDB.Close()
+
+	var hasTable int
+	err = sqlDB.QueryRow(`SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = current_schema() AND table_name = 'schema_version'`).Scan(&hasTable)
+	if err != nil {
+		return 0, 0, fmt.Errorf("read schema: %w", err)
+	}
+	if hasTable == 0 {
+		return 0, len(migrations), nil
+	}
+	if err := sqlDB.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&current); err != nil {
+		return 0, 0, fmt.Errorf("get schema version: %w", err)
+	}
+	return current, len(migrations), nil
+}
@@ -70,8 +70,16 @@ func (d *DB) MarkNotificationRead(id, userID string) error {
 	return err
 }
 
-func (d *DB) CleanupOldReadNotifications() (int, error) {
-	result, err := d.Exec(`DELETE FROM notifications WHERE read = TRUE AND created_at < datetime('now', '-30 days')`)
+// CleanupOldReadNotifications deletes read notifications older than days.
+// days <= 0 keeps them.
+func (d *DB) CleanupOldReadNotifications(days int) (int, error) {
+	if days <= 0 {
+		return 0, nil
+	}
+	result, err := d.Exec(
+		`DELETE FROM notifications WHERE read = TRUE AND created_at < datetime('now', ?)`,
+		fmt.Sprintf("-%d days", days),
+	)
 	if err != nil {
 		return 0, fmt.Errorf("cleanup old notifications: %w", err)
 	}
@@ -79,6 +87,28 @@ func (d *DB) CleanupOldReadNotifications() (int, error) {
 	return int(n), nil
 }
 
+// CapNotificationsPerUser trims every user down to their newest max
+// notifications, read or not. max <= 0 disables the cap.
+func (d *DB) CapNotificationsPerUser(max int) (int, error) {
+	if max <= 0 {
+		return 0, nil
+	}
+	result, err := d.Exec(
+		`DELETE FROM notifications WHERE rowid IN (
+		   SELECT rowid FROM (
+		     SELECT rowid, ROW_NUMBER() OVER (PARTITION BY user_id ORDER BY created_at DESC, rowid DESC) AS rn
+		     FROM notifications
+		   ) ranked WHERE rn > ?
+		 )`,
+		max,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("cap notifications: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
+
 func (d *DB) MarkAllNotificationsRead(userID string) error {
 	_, err := d.Exec(
 		`UPDATE notifications SET read = TRUE WHERE user_id = ? AND read = FALSE`,
@@ -86,3 +116,73 @@ func (d *DB) MarkAllNotificationsRead(userID string) error {
 	)
 	return err
 }
+
+// GetNotifications returns a page of the user's notifications, read or
+// not, newest first. before is an optional notification ID cursor.
+func (d *DB) GetNotifications(userID string, limit int, before *string) ([]Notification, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 50
+	}
+
+	query := `SELECT id, user_id, type, data, read, created_at FROM notifications WHERE user_id = ?`
+	args := []any{userID}
+	if before != nil {
+		// rowid breaks ties between notifications created in the same second
+		query += ` AND (created_at, rowid) < (SELECT created_at, rowid FROM notifications WHERE id = ?)`
+		args = append(args, *before)
+	}
+	query += ` ORDER BY created_at DESC, rowid DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get notifications: %w", err)
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		var dataStr string
+		if err := rows.Scan(&n.ID, &n.UserID, &n.Type, &dataStr, &n.Read, &n.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan notification: %w", err)
+		}
+		n.Data = json.RawMessage(dataStr)
+		notifications = append(notifications, n)
+	}
+	if notifications == nil {
+		notifications = []Notification{}
+	}
+	return notifications, rows.Err()
+}
+
+func (d *DB) CountUnreadNotifications(userID string) (int, error) {
+	var n int
+	err := d.QueryRow(`SELECT COUNT(*) FROM notifications WHERE user_id = ? AND read = FALSE`, userID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count unread notifications: %w", err)
+	}
+	return n, nil
+}
+
+// DeleteNotification removes one of the user's notifications. Returns
+// false if it doesn't exist or belongs to someone else.
+func (d *DB) DeleteNotification(id, userID string) (bool, error) {
+	result, err := d.Exec(`DELETE FROM notifications WHERE id = ? AND user_id = ?`, id, userID)
+	if err != nil {
+		return false, fmt.Errorf("delete notification: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// DeleteAllNotifications clears the user's notifications and returns how
+// many were removed.
+func (d *DB) DeleteAllNotifications(userID string) (int, error) {
+	result, err := d.Exec(`DELETE FROM notifications WHERE user_id = ?`, userID)
+	if err != nil {
+		return 0, fmt.Errorf("delete all notifications: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return int(n), nil
+}
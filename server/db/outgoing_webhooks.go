@@ -0,0 +1,140 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+// outgoingFailureKeep is how many dead-letter rows are kept per webhook.
+const outgoingFailureKeep = 100
+
+// OutgoingWebhook is an admin-registered endpoint that receives the
+// server events listed in Events. SecretEnc is the HMAC signing secret,
+// encrypted with the server key.
+type OutgoingWebhook struct {
+	ID        string   `json:"id"`
+	Name      string   `json:"name"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	CreatedBy *string  `json:"created_by"`
+	CreatedAt string   `json:"created_at"`
+	SecretEnc string   `json:"-"`
+}
+
+// OutgoingWebhookFailure is a delivery that exhausted its retries.
+type OutgoingWebhookFailure struct {
+	ID        int64  `json:"id"`
+	WebhookID string `json:"webhook_id"`
+	Event     string `json:"event"`
+	Payload   string `json:"payload"`
+	Error     string `json:"error"`
+	Attempts  int    `json:"attempts"`
+	CreatedAt string `json:"created_at"`
+}
+
+func (d *DB) CreateOutgoingWebhook(id, name, url, secretEnc string, events []string, createdBy string) (*OutgoingWebhook, error) {
+	if _, err := d.Exec(
+		`INSERT INTO outgoing_webhooks (id, name, url, secret_enc, events, created_by) VALUES (?, ?, ?, ?, ?, ?)`,
+		id, name, url, secretEnc, strings.Join(events, ","), createdBy,
+	); err != nil {
+		return nil, fmt.Errorf("create outgoing webhook: %w", err)
+	}
+	return d.GetOutgoingWebhook(id)
+}
+
+func (d *DB) GetOutgoingWebhook(id string) (*OutgoingWebhook, error) {
+	wh := &OutgoingWebhook{}
+	var events string
+	err := d.QueryRow(
+		`SELECT id, name, url, secret_enc, events, created_by, created_at FROM outgoing_webhooks WHERE id = ?`, id,
+	).Scan(&wh.ID, &wh.Name, &wh.URL, &wh.SecretEnc, &events, &wh.CreatedBy, &wh.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get outgoing webhook: %w", err)
+	}
+	wh.Events = strings.Split(events, ",")
+	return wh, nil
+}
+
+// ListOutgoingWebhooks returns every outgoing webhook, newest first.
+func (d *DB) ListOutgoingWebhooks() ([]OutgoingWebhook, error) {
+	rows, err := d.Query(
+		`SELECT id, name, url, secret_enc, events, created_by, created_at
+		 FROM outgoing_webhooks ORDER BY created_at DESC, rowid DESC`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list outgoing webhooks: %w", err)
+	}
+	defer rows.Close()
+
+	hooks := []OutgoingWebhook{}
+	for rows.Next() {
+		var wh OutgoingWebhook
+		var events string
+		if err := rows.Scan(&wh.ID, &wh.Name, &wh.URL, &wh.SecretEnc, &events, &wh.CreatedBy, &wh.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan outgoing webhook: %w", err)
+		}
+		wh.Events = strings.Split(events, ",")
+		hooks = append(hooks, wh)
+	}
+	return hooks, rows.Err()
+}
+
+func (d *DB) DeleteOutgoingWebhook(id string) (bool, error) {
+	result, err := d.Exec(`DELETE FROM outgoing_webhooks WHERE id = ?`, id)
+	if err != nil {
+		return false, fmt.Errorf("delete outgoing webhook: %w", err)
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// RecordOutgoingWebhookFailure dead-letters a delivery and trims the
+// webhook's log to its newest outgoingFailureKeep entries.
+func (d *DB) RecordOutgoingWebhookFailure(webhookID, event, payload, errMsg string, attempts int) error {
+	if _, err := d.Exec(
+		`INSERT INTO outgoing_webhook_failures (webhook_id, event, payload, error, attempts) VALUES (?, ?, ?, ?, ?)`,
+		webhookID, event, payload, errMsg, attempts,
+	); err != nil {
+		return fmt.Errorf("record webhook failure: %w", err)
+	}
+	if _, err := d.Exec(
+		`DELETE FROM outgoing_webhook_failures WHERE webhook_id = ? AND id NOT IN (
+		   SELECT id FROM outgoing_webhook_failures WHERE webhook_id = ? ORDER BY id DESC LIMIT ?
+		 )`,
+		webhookID, webhookID, outgoingFailureKeep,
+	); err != nil {
+		return fmt.Errorf("trim webhook failures: %w", err)
+	}
+	return nil
+}
+
+// GetOutgoingWebhookFailures returns a webhook's dead-lettered deliveries,
+// newest first.
+func (d *DB) GetOutgoingWebhookFailures(webhookID string, limit int) ([]OutgoingWebhookFailure, error) {
+	if limit <= 0 || limit > outgoingFailureKeep {
+		limit = outgoingFailureKeep
+	}
+	rows, err := d.Query(
+		`SELECT id, webhook_id, event, payload, error, attempts, created_at
+		 FROM outgoing_webhook_failures WHERE webhook_id = ? ORDER BY id DESC LIMIT ?`,
+		webhookID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("get webhook failures: %w", err)
+	}
+	defer rows.Close()
+
+	failures := []OutgoingWebhookFailure{}
+	for rows.Next() {
+		var f OutgoingWebhookFailure
+		if err := rows.Scan(&f.ID, &f.WebhookID, &f.Event, &f.Payload, &f.Error, &f.Attempts, &f.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan webhook failure: %w", err)
+		}
+		failures = append(failures, f)
+	}
+	return failures, rows.Err()
+}
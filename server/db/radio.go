@@ -9,6 +9,8 @@ type RadioStation struct {
 	Position       int     `json:"position"`
 	PlaybackMode   string  `json:"playback_mode"`
 	PublicControls bool    `json:"public_controls"`
+	DefaultVolume  int     `json:"default_volume"`
+	IntroTrackID   *string `json:"intro_track_id"`
 	CreatedAt      string  `json:"created_at"`
 }
 
@@ -31,6 +33,9 @@ type RadioTrack struct {
 	Position   int     `json:"position"`
 	Waveform   *string `json:"waveform"`
 	CreatedAt  string  `json:"created_at"`
+	// OriginalPath is the upload as received when Path is a transcode of
+	// it and originals are kept
+	OriginalPath *string `json:"original_path,omitempty"`
 }
 
 // --- Station CRUD ---
@@ -74,7 +79,7 @@ func (d *DB) CreateRadioStation(id, name, createdBy string) (*RadioStation, erro
 		return nil, fmt.Errorf("commit create radio station: %w", err)
 	}
 
-	return &RadioStation{ID: id, Name: name, CreatedBy: &createdBy, Position: pos}, nil
+	return &RadioStation{ID: id, Name: name, CreatedBy: &createdBy, Position: pos, DefaultVolume: 100}, nil
 }
 
 func (d *DB) DeleteRadioStation(id string) error {
@@ -83,7 +88,7 @@ func (d *DB) DeleteRadioStation(id string) error {
 }
 
 func (d *DB) GetAllRadioStations() ([]RadioStation, error) {
-	rows, err := d.Query(`SELECT id, name, created_by, position, playback_mode, public_controls, created_at FROM radio_stations ORDER BY position`)
+	rows, err := d.Query(`SELECT id, name, created_by, position, playback_mode, public_controls, default_volume, intro_track_id, created_at FROM radio_stations ORDER BY position`)
 	if err != nil {
 		return nil, fmt.Errorf("get radio stations: %w", err)
 	}
@@ -92,7 +97,7 @@ func (d *DB) GetAllRadioStations() ([]RadioStation, error) {
 	var stations []RadioStation
 	for rows.Next() {
 		var s RadioStation
-		if err := rows.Scan(&s.ID, &s.Name, &s.CreatedBy, &s.Position, &s.PlaybackMode, &s.PublicControls, &s.CreatedAt); err != nil {
+		if err := rows.Scan(&s.ID, &s.Name, &s.CreatedBy, &s.Position, &s.PlaybackMode, &s.PublicControls, &s.DefaultVolume, &s.IntroTrackID, &s.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan radio station: %w", err)
 		}
 		stations = append(stations, s)
@@ -106,8 +111,8 @@ func (d *DB) GetAllRadioStations() ([]RadioStation, error) {
 func (d *DB) GetRadioStationByID(id string) (*RadioStation, error) {
 	var s RadioStation
 	err := d.QueryRow(
-		`SELECT id, name, created_by, position, playback_mode, public_controls, created_at FROM radio_stations WHERE id = ?`, id,
-	).Scan(&s.ID, &s.Name, &s.CreatedBy, &s.Position, &s.PlaybackMode, &s.PublicControls, &s.CreatedAt)
+		`SELECT id, name, created_by, position, playback_mode, public_controls, default_volume, intro_track_id, created_at FROM radio_stations WHERE id = ?`, id,
+	).Scan(&s.ID, &s.Name, &s.CreatedBy, &s.Position, &s.PlaybackMode, &s.PublicControls, &s.DefaultVolume, &s.IntroTrackID, &s.CreatedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -129,6 +134,32 @@ func (d *DB) UpdateRadioStationPublicControls(id string, enabled bool) error {
 	return err
 }
 
+func (d *DB) UpdateRadioStationDefaultVolume(id string, volume int) error {
+	_, err := d.Exec(`UPDATE radio_stations SET default_volume = ? WHERE id = ?`, volume, id)
+	return err
+}
+
+// UpdateRadioStationIntro sets the track played before the first playlist
+// track when the station starts; nil clears it.
+func (d *DB) UpdateRadioStationIntro(id string, trackID *string) error {
+	_, err := d.Exec(`UPDATE radio_stations SET intro_track_id = ? WHERE id = ?`, trackID, id)
+	return err
+}
+
+func (d *DB) ReorderRadioStations(ids []string) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin reorder stations: %w", err)
+	}
+	for i, id := range ids {
+		if _, err := tx.Exec(`UPDATE radio_stations SET position = ? WHERE id = ?`, i, id); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("reorder station %s: %w", id, err)
+		}
+	}
+	return tx.Commit()
+}
+
 func (d *DB) GetPlaylistsByStation(stationID string) ([]RadioPlaylist, error) {
 	rows, err := d.Query(
 		`SELECT id, name, user_id, station_id, created_at FROM radio_playlists WHERE station_id = ? ORDER BY created_at`,
@@ -245,12 +276,42 @@ func (d *DB) CreateRadioTrack(t *RadioTrack) error {
 	t.Position = pos
 
 	_, err = d.Exec(
-		`INSERT INTO radio_tracks (id, playlist_id, filename, path, mime_type, size_bytes, duration, position, waveform) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
-		t.ID, t.PlaylistID, t.Filename, t.Path, t.MimeType, t.SizeBytes, t.Duration, t.Position, t.Waveform,
+		`INSERT INTO radio_tracks (id, playlist_id, filename, path, mime_type, size_bytes, duration, position, waveform, original_path) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		t.ID, t.PlaylistID, t.Filename, t.Path, t.MimeType, t.SizeBytes, t.Duration, t.Position, t.Waveform, t.OriginalPath,
 	)
 	return err
 }
 
+// SetTrackWaveform replaces a track's waveform peaks.
+func (d *DB) SetTrackWaveform(id string, waveform *string) error {
+	if _, err := d.Exec(`UPDATE radio_tracks SET waveform = ? WHERE id = ?`, waveform, id); err != nil {
+		return fmt.Errorf("set track waveform: %w", err)
+	}
+	return nil
+}
+
+// SetTrackDuration replaces a track's duration in seconds.
+func (d *DB) SetTrackDuration(id string, duration float64) error {
+	if _, err := d.Exec(`UPDATE radio_tracks SET duration = ? WHERE id = ?`, duration, id); err != nil {
+		return fmt.Errorf("set track duration: %w", err)
+	}
+	return nil
+}
+
+// SetTrackFile points a track at a transcoded file, keeping originalPath
+// (nil for none) beside it. Reports false if the track no longer exists.
+func (d *DB) SetTrackFile(id, path, mimeType string, sizeBytes int64, originalPath *string) (bool, error) {
+	res, err := d.Exec(
+		`UPDATE radio_tracks SET path = ?, mime_type = ?, size_bytes = ?, original_path = ? WHERE id = ?`,
+		path, mimeType, sizeBytes, originalPath, id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("set track file: %w", err)
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
 func (d *DB) DeleteRadioTrack(id string) error {
 	_, err := d.Exec(`DELETE FROM radio_tracks WHERE id = ?`, id)
 	return err
@@ -258,7 +319,7 @@ func (d *DB) DeleteRadioTrack(id string) error {
 
 func (d *DB) GetTracksByPlaylist(playlistID string) ([]RadioTrack, error) {
 	rows, err := d.Query(
-		`SELECT id, playlist_id, filename, path, mime_type, size_bytes, duration, position, waveform, created_at FROM radio_tracks WHERE playlist_id = ? ORDER BY position`,
+		`SELECT id, playlist_id, filename, path, mime_type, size_bytes, duration, position, waveform, created_at, original_path FROM radio_tracks WHERE playlist_id = ? ORDER BY position`,
 		playlistID,
 	)
 	if err != nil {
@@ -269,7 +330,7 @@ func (d *DB) GetTracksByPlaylist(playlistID string) ([]RadioTrack, error) {
 	var tracks []RadioTrack
 	for rows.Next() {
 		var t RadioTrack
-		if err := rows.Scan(&t.ID, &t.PlaylistID, &t.Filename, &t.Path, &t.MimeType, &t.SizeBytes, &t.Duration, &t.Position, &t.Waveform, &t.CreatedAt); err != nil {
+		if err := rows.Scan(&t.ID, &t.PlaylistID, &t.Filename, &t.Path, &t.MimeType, &t.SizeBytes, &t.Duration, &t.Position, &t.Waveform, &t.CreatedAt, &t.OriginalPath); err != nil {
 			return nil, fmt.Errorf("scan track: %w", err)
 		}
 		tracks = append(tracks, t)
@@ -283,8 +344,8 @@ func (d *DB) GetTracksByPlaylist(playlistID string) ([]RadioTrack, error) {
 func (d *DB) GetTrackByID(id string) (*RadioTrack, error) {
 	var t RadioTrack
 	err := d.QueryRow(
-		`SELECT id, playlist_id, filename, path, mime_type, size_bytes, duration, position, waveform, created_at FROM radio_tracks WHERE id = ?`, id,
-	).Scan(&t.ID, &t.PlaylistID, &t.Filename, &t.Path, &t.MimeType, &t.SizeBytes, &t.Duration, &t.Position, &t.Waveform, &t.CreatedAt)
+		`SELECT id, playlist_id, filename, path, mime_type, size_bytes, duration, position, waveform, created_at, original_path FROM radio_tracks WHERE id = ?`, id,
+	).Scan(&t.ID, &t.PlaylistID, &t.Filename, &t.Path, &t.MimeType, &t.SizeBytes, &t.Duration, &t.Position, &t.Waveform, &t.CreatedAt, &t.OriginalPath)
 	if err != nil {
 		return nil, err
 	}
@@ -379,3 +440,46 @@ func (d *DB) GetAllRadioStationManagers() (map[string][]string, error) {
 	}
 	return result, rows.Err()
 }
+
+// --- Radio favorites ---
+
+func (d *DB) AddRadioFavorite(userID, stationID string) error {
+	_, err := d.Exec(
+		`INSERT OR IGNORE INTO radio_favorites (user_id, station_id) VALUES (?, ?)`,
+		userID, stationID,
+	)
+	if err != nil {
+		return fmt.Errorf("add radio favorite: %w", err)
+	}
+	return nil
+}
+
+func (d *DB) RemoveRadioFavorite(userID, stationID string) error {
+	_, err := d.Exec(
+		`DELETE FROM radio_favorites WHERE user_id = ? AND station_id = ?`,
+		userID, stationID,
+	)
+	if err != nil {
+		return fmt.Errorf("remove radio favorite: %w", err)
+	}
+	return nil
+}
+
+// GetRadioFavorites returns the user's favorite station IDs, oldest first.
+func (d *DB) GetRadioFavorites(userID string) ([]string, error) {
+	rows, err := d.Query(`SELECT station_id FROM radio_favorites WHERE user_id = ? ORDER BY created_at, station_id`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("get radio favorites: %w", err)
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan radio favorite: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -25,6 +25,51 @@ func (d *DB) AddReaction(messageID, userID, emoji string) error {
 	return nil
 }
 
+// CountDistinctReactions returns how many different emoji have been used
+// to react to a message.
+func (d *DB) CountDistinctReactions(messageID string) (int, error) {
+	var n int
+	err := d.QueryRow(`SELECT COUNT(DISTINCT emoji) FROM reactions WHERE message_id = ?`, messageID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count distinct reactions: %w", err)
+	}
+	return n, nil
+}
+
+// CountUserReactions returns how many reactions a user has on a message.
+func (d *DB) CountUserReactions(messageID, userID string) (int, error) {
+	var n int
+	err := d.QueryRow(`SELECT COUNT(*) FROM reactions WHERE message_id = ? AND user_id = ?`, messageID, userID).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count user reactions: %w", err)
+	}
+	return n, nil
+}
+
+// HasReaction reports whether anyone has reacted to a message with emoji,
+// and whether userID specifically has.
+func (d *DB) HasReaction(messageID, userID, emoji string) (exists bool, mine bool, err error) {
+	err = d.QueryRow(
+		`SELECT COUNT(*) > 0, COALESCE(SUM(CASE WHEN user_id = ? THEN 1 ELSE 0 END), 0) > 0 FROM reactions WHERE message_id = ? AND emoji = ?`,
+		userID, messageID, emoji,
+	).Scan(&exists, &mine)
+	if err != nil {
+		return false, false, fmt.Errorf("has reaction: %w", err)
+	}
+	return exists, mine, nil
+}
+
+// CountEmojiReactions returns how many users reacted to a message with
+// emoji.
+func (d *DB) CountEmojiReactions(messageID, emoji string) (int, error) {
+	var n int
+	err := d.QueryRow(`SELECT COUNT(*) FROM reactions WHERE message_id = ? AND emoji = ?`, messageID, emoji).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("count emoji reactions: %w", err)
+	}
+	return n, nil
+}
+
 func (d *DB) RemoveReaction(messageID, userID, emoji string) error {
 	_, err := d.Exec(
 		`DELETE FROM reactions WHERE message_id = ? AND user_id = ? AND emoji = ?`,
@@ -69,3 +114,43 @@ func (d *DB) GetReactionsByMessage(messageID string) ([]ReactionGroup, error) {
 	}
 	return result, rows.Err()
 }
+
+// ReactionUser is one user who reacted to a message with a given emoji.
+type ReactionUser struct {
+	ID        string  `json:"id"`
+	Username  string  `json:"username"`
+	AvatarURL *string `json:"avatar_url"`
+}
+
+// GetReactionUsers returns up to limit users who reacted to a message with
+// emoji, earliest reaction first. With afterUserID set, the list resumes
+// after that user's reaction.
+func (d *DB) GetReactionUsers(messageID, emoji string, limit int, afterUserID string) ([]ReactionUser, error) {
+	query := `SELECT u.id, u.username, u.avatar_path FROM reactions r
+		JOIN users u ON u.id = r.user_id
+		WHERE r.message_id = ? AND r.emoji = ?`
+	args := []any{messageID, emoji}
+	if afterUserID != "" {
+		query += ` AND (r.created_at, r.user_id) > (
+			SELECT created_at, user_id FROM reactions WHERE message_id = ? AND emoji = ? AND user_id = ?)`
+		args = append(args, messageID, emoji, afterUserID)
+	}
+	query += ` ORDER BY r.created_at, r.user_id LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := d.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("get reaction users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []ReactionUser{}
+	for rows.Next() {
+		var u ReactionUser
+		if err := rows.Scan(&u.ID, &u.Username, &u.AvatarURL); err != nil {
+			return nil, fmt.Errorf("scan reaction user: %w", err)
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
@@ -0,0 +1,103 @@
+package db
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// retentionBatchSize bounds how many messages one purge statement deletes,
+// so a first run against years of history doesn't hold the write lock for
+// long.
+const retentionBatchSize = 500
+
+// GetRetentionDays returns the server-wide message retention period in
+// days. 0 (the default) keeps history forever.
+func (d *DB) GetRetentionDays() (int, error) {
+	v, err := d.GetSetting("retention_days")
+	if err != nil {
+		return 0, err
+	}
+	if v == "" {
+		return 0, nil
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 0 {
+		return 0, fmt.Errorf("invalid retention_days %q", v)
+	}
+	return days, nil
+}
+
+// PurgeExpiredMessages hard-deletes messages older than days. Attachments
+// are unlinked first so the orphan cleanup removes their files; reactions,
+// mentions and unfurls cascade. Thread roots that still have a reply
+// inside the window are kept so the thread doesn't fall apart. Returns the
+// number of messages deleted.
+func (d *DB) PurgeExpiredMessages(days int) (int64, error) {
+	if days <= 0 {
+		return 0, nil
+	}
+	cutoff := fmt.Sprintf("-%d days", days)
+
+	var total int64
+	for {
+		tx, err := d.Begin()
+		if err != nil {
+			return total, fmt.Errorf("begin purge: %w", err)
+		}
+
+		rows, err := tx.Query(
+			`SELECT m.id FROM messages m
+			 WHERE m.created_at < datetime('now', ?)
+			 AND NOT EXISTS (
+			   SELECT 1 FROM messages r
+			   WHERE r.thread_id = m.id AND r.id != m.id AND r.created_at >= datetime('now', ?)
+			 )
+			 LIMIT ?`,
+			cutoff, cutoff, retentionBatchSize,
+		)
+		if err != nil {
+			tx.Rollback()
+			return total, fmt.Errorf("query expired messages: %w", err)
+		}
+		var ids []any
+		for rows.Next() {
+			var id string
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				tx.Rollback()
+				return total, fmt.Errorf("scan expired message: %w", err)
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if len(ids) == 0 {
+			tx.Rollback()
+			return total, nil
+		}
+
+		placeholders := make([]string, len(ids))
+		for i := range ids {
+			placeholders[i] = "?"
+		}
+		in := fmt.Sprintf("(%s)", strings.Join(placeholders, ","))
+
+		if _, err := tx.Exec(`UPDATE attachments SET message_id = NULL WHERE message_id IN `+in, ids...); err != nil {
+			tx.Rollback()
+			return total, fmt.Errorf("unlink expired attachments: %w", err)
+		}
+		res, err := tx.Exec(`DELETE FROM messages WHERE id IN `+in, ids...)
+		if err != nil {
+			tx.Rollback()
+			return total, fmt.Errorf("delete expired messages: %w", err)
+		}
+		if err := tx.Commit(); err != nil {
+			return total, fmt.Errorf("commit purge: %w", err)
+		}
+		n, _ := res.RowsAffected()
+		total += n
+		if len(ids) < retentionBatchSize {
+			return total, nil
+		}
+	}
+}
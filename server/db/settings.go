@@ -2,6 +2,7 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
 )
 
@@ -35,3 +36,95 @@ func (d *DB) DeleteSetting(key string) error {
 	}
 	return nil
 }
+
+// Registration modes, stored under the "registration_mode" setting.
+const (
+	RegistrationOpen     = "open"     // new users are approved immediately
+	RegistrationApproval = "approval" // new users wait for an admin (default)
+	RegistrationClosed   = "closed"   // new registrations are rejected
+)
+
+// GetRegistrationMode returns the configured registration mode, falling
+// back to RegistrationApproval when unset or unrecognized.
+func (d *DB) GetRegistrationMode() (string, error) {
+	mode, err := d.GetSetting("registration_mode")
+	if err != nil {
+		return "", err
+	}
+	switch mode {
+	case RegistrationOpen, RegistrationClosed:
+		return mode, nil
+	default:
+		return RegistrationApproval, nil
+	}
+}
+
+// PasswordPolicy is the password strength policy, stored as JSON under the
+// "password_policy" setting. An empty password is only accepted (for
+// passwordless accounts) when RequirePassword is off.
+type PasswordPolicy struct {
+	MinLength        int  `json:"min_length"`
+	RequirePassword  bool `json:"require_password"`
+	RequireMixedCase bool `json:"require_mixed_case"`
+	RequireDigit     bool `json:"require_digit"`
+	RequireSymbol    bool `json:"require_symbol"`
+}
+
+// Password length bounds. bcrypt ignores anything past 72 bytes.
+const (
+	DefaultPasswordMinLength = 4
+	MaxPasswordLength        = 72
+)
+
+// GetPasswordPolicy returns the configured password policy, falling back
+// to a DefaultPasswordMinLength minimum with no complexity rules.
+func (d *DB) GetPasswordPolicy() (PasswordPolicy, error) {
+	policy := PasswordPolicy{MinLength: DefaultPasswordMinLength}
+	raw, err := d.GetSetting("password_policy")
+	if err != nil {
+		return policy, err
+	}
+	if raw == "" {
+		return policy, nil
+	}
+	if err := json.Unmarshal([]byte(raw), &policy); err != nil {
+		return PasswordPolicy{MinLength: DefaultPasswordMinLength}, fmt.Errorf("parse password policy: %w", err)
+	}
+	return policy, nil
+}
+
+func (d *DB) SetPasswordPolicy(policy PasswordPolicy) error {
+	raw, err := json.Marshal(policy)
+	if err != nil {
+		return fmt.Errorf("marshal password policy: %w", err)
+	}
+	return d.SetSetting("password_policy", string(raw))
+}
+
+// GetAllowedReactions returns the emoji reactions are limited to, stored
+// as a JSON array under "allowed_reactions". Empty (the default) allows
+// any emoji.
+func (d *DB) GetAllowedReactions() ([]string, error) {
+	raw, err := d.GetSetting("allowed_reactions")
+	if err != nil || raw == "" {
+		return []string{}, err
+	}
+	var emoji []string
+	if err := json.Unmarshal([]byte(raw), &emoji); err != nil {
+		return []string{}, fmt.Errorf("parse allowed reactions: %w", err)
+	}
+	return emoji, nil
+}
+
+// SetAllowedReactions replaces the reaction allowlist; an empty list
+// removes the restriction.
+func (d *DB) SetAllowedReactions(emoji []string) error {
+	if len(emoji) == 0 {
+		return d.DeleteSetting("allowed_reactions")
+	}
+	raw, err := json.Marshal(emoji)
+	if err != nil {
+		return fmt.Errorf("marshal allowed reactions: %w", err)
+	}
+	return d.SetSetting("allowed_reactions", string(raw))
+}
@@ -88,7 +88,7 @@ func (d *DB) GetStarredMessages(userID string) ([]StarredMessage, error) {
 		`SELECT m.id, m.channel_id, m.author_id, m.content, m.reply_to_id, m.thread_id,
 				m.created_at, m.edited_at, m.deleted_at,
 				s.created_at as starred_at,
-				COALESCE(u.username, '') as author_username
+				COALESCE(m.author_name, u.username, '') as author_username
 		 FROM starred_messages s
 		 JOIN messages m ON s.message_id = m.id
 		 LEFT JOIN users u ON m.author_id = u.id
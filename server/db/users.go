@@ -2,7 +2,10 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"strings"
+	"time"
 )
 
 type User struct {
@@ -27,9 +30,15 @@ type Channel struct {
 	Position    int     `json:"position"`
 	Visibility  string  `json:"visibility"`
 	Description *string `json:"description"`
-	CreatedBy   *string `json:"created_by"`
-	DeletedAt   *string `json:"deleted_at"`
-	CreatedAt   string  `json:"created_at"`
+	// Announcement channels take messages only from managers and admins
+	Announcement bool `json:"announcement"`
+	// Posting restrictions: messages with attachments or links are refused
+	// when the flag is off
+	AllowAttachments bool    `json:"allow_attachments"`
+	AllowLinks       bool    `json:"allow_links"`
+	CreatedBy        *string `json:"created_by"`
+	DeletedAt        *string `json:"deleted_at"`
+	CreatedAt        string  `json:"created_at"`
 }
 
 func (d *DB) CreateUser(id, username string, passwordHash *string, email *string, isAdmin, approved bool, knockMessage *string, registerIP *string) error {
@@ -82,15 +91,25 @@ func (d *DB) UserCount() (int, error) {
 	return count, nil
 }
 
-func (d *DB) CreateToken(token, userID string) error {
+// Session token lifetimes. Login issues a short one unless the user asks
+// to be remembered; registration and magic links always issue a long one.
+const (
+	SessionTokenTTL  = 24 * time.Hour
+	RememberTokenTTL = 30 * 24 * time.Hour
+)
+
+// CreateToken stores a session token valid for ttl and returns when it
+// expires.
+func (d *DB) CreateToken(token, userID string, ttl time.Duration) (time.Time, error) {
+	expiresAt := time.Now().Add(ttl).UTC().Truncate(time.Second)
 	_, err := d.Exec(
-		`INSERT INTO tokens (token, user_id, expires_at) VALUES (?, ?, datetime('now', '+30 days'))`,
-		token, userID,
+		`INSERT INTO tokens (token, user_id, expires_at) VALUES (?, ?, ?)`,
+		token, userID, expiresAt.Format("2006-01-02 15:04:05"),
 	)
 	if err != nil {
-		return fmt.Errorf("create token: %w", err)
+		return time.Time{}, fmt.Errorf("create token: %w", err)
 	}
-	return nil
+	return expiresAt, nil
 }
 
 func (d *DB) DeleteTokensByUserID(userID string) error {
@@ -140,6 +159,92 @@ func (d *DB) GetAllUsers() ([]User, error) {
 	return users, rows.Err()
 }
 
+// ListApprovedUsers returns up to limit approved users in registration
+// order, starting after the user with ID after (nil for the first page).
+func (d *DB) ListApprovedUsers(limit int, after *string) ([]User, error) {
+	var rows *sql.Rows
+	var err error
+
+	if after != nil {
+		rows, err = d.Query(
+			`SELECT id, username, is_admin, avatar_path, created_at FROM users
+			 WHERE approved = TRUE
+			 AND (created_at, id) > (SELECT created_at, id FROM users WHERE id = ?)
+			 ORDER BY created_at, id
+			 LIMIT ?`,
+			*after, limit,
+		)
+	} else {
+		rows, err = d.Query(
+			`SELECT id, username, is_admin, avatar_path, created_at FROM users
+			 WHERE approved = TRUE
+			 ORDER BY created_at, id
+			 LIMIT ?`,
+			limit,
+		)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("list approved users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.IsAdmin, &u.AvatarPath, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		u.Approved = true
+		users = append(users, u)
+	}
+	if users == nil {
+		users = []User{}
+	}
+	return users, rows.Err()
+}
+
+// SearchApprovedUsers returns up to limit approved users whose username
+// starts with prefix (case-insensitive), users in firstIDs before the
+// rest, each group in alphabetical order.
+func (d *DB) SearchApprovedUsers(prefix string, firstIDs []string, limit int) ([]User, error) {
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+	first, err := json.Marshal(firstIDs)
+	if err != nil {
+		return nil, fmt.Errorf("search users: %w", err)
+	}
+	rows, err := d.Query(
+		`SELECT id, username, is_admin, avatar_path, created_at FROM users
+		 WHERE approved = TRUE AND username LIKE ? ESCAPE '\'
+		 ORDER BY id IN (SELECT value FROM json_each(?)) DESC, username COLLATE NOCASE, id
+		 LIMIT ?`,
+		escaped+"%", string(first), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("search users: %w", err)
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.IsAdmin, &u.AvatarPath, &u.CreatedAt); err != nil {
+			return nil, fmt.Errorf("scan user: %w", err)
+		}
+		u.Approved = true
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+func (d *DB) CountApprovedUsers() (int, error) {
+	var count int
+	err := d.QueryRow(`SELECT COUNT(*) FROM users WHERE approved = TRUE`).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("count approved users: %w", err)
+	}
+	return count, nil
+}
+
 func (d *DB) GetAdminUsers() ([]User, error) {
 	rows, err := d.Query(`SELECT id, username, password_hash, is_admin, avatar_path, approved, knock_message, email, email_verified_at, created_at FROM users WHERE is_admin = TRUE AND approved = TRUE`)
 	if err != nil {
@@ -249,16 +354,22 @@ func (d *DB) SetEmailVerified(userID string) error {
 	return nil
 }
 
-func (d *DB) CanSendMentionEmail(userID string) (bool, error) {
-	var canSend bool
-	err := d.QueryRow(
-		`SELECT (last_mention_email_at IS NULL OR last_mention_email_at < datetime('now', '-3 days')) FROM users WHERE id = ?`,
-		userID,
-	).Scan(&canSend)
-	if err != nil {
-		return false, fmt.Errorf("check mention email cooldown: %w", err)
-	}
-	return canSend, nil
+// MentionEmailWait returns how long until userID may be sent another
+// mention email, given at most one per interval. Zero means now.
+func (d *DB) MentionEmailWait(userID string, interval time.Duration) (time.Duration, error) {
+	var last sql.NullTime
+	err := d.QueryRow(`SELECT last_mention_email_at FROM users WHERE id = ?`, userID).Scan(&last)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, fmt.Errorf("check mention email cooldown: %w", err)
+	}
+	if !last.Valid {
+		return 0, nil
+	}
+	wait := time.Until(last.Time.Add(interval)).Truncate(time.Second)
+	if wait < 0 {
+		return 0, nil
+	}
+	return wait, nil
 }
 
 func (d *DB) SetMentionEmailSent(userID string) error {
@@ -279,7 +390,7 @@ func (d *DB) AdvancePendingVerificationUsers() (int, error) {
 }
 
 func (d *DB) GetAllChannels() ([]Channel, error) {
-	rows, err := d.Query(`SELECT id, name, type, position, visibility, description, created_by, created_at FROM channels WHERE deleted_at IS NULL ORDER BY position`)
+	rows, err := d.Query(`SELECT id, name, type, position, visibility, description, announcement, allow_attachments, allow_links, created_by, created_at FROM channels WHERE deleted_at IS NULL ORDER BY position`)
 	if err != nil {
 		return nil, fmt.Errorf("get channels: %w", err)
 	}
@@ -288,7 +399,7 @@ func (d *DB) GetAllChannels() ([]Channel, error) {
 	var channels []Channel
 	for rows.Next() {
 		var c Channel
-		if err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.Position, &c.Visibility, &c.Description, &c.CreatedBy, &c.CreatedAt); err != nil {
+		if err := rows.Scan(&c.ID, &c.Name, &c.Type, &c.Position, &c.Visibility, &c.Description, &c.Announcement, &c.AllowAttachments, &c.AllowLinks, &c.CreatedBy, &c.CreatedAt); err != nil {
 			return nil, fmt.Errorf("scan channel: %w", err)
 		}
 		channels = append(channels, c)
@@ -15,18 +15,38 @@ type VerificationCode struct {
 	CreatedAt string
 }
 
+// CreateVerificationCode replaces userID's code and logs the issuance in
+// verification_code_events, which CountRecentVerificationCodes reads.
+// Events older than a day are dropped on the way.
 func (d *DB) CreateVerificationCode(id, userID, codeHash string, expiresAt time.Time) error {
+	tx, err := d.Begin()
+	if err != nil {
+		return fmt.Errorf("begin create verification code: %w", err)
+	}
+	defer tx.Rollback()
+
 	// Delete existing codes for this user (one active code per user)
-	if _, err := d.Exec(`DELETE FROM verification_codes WHERE user_id = ?`, userID); err != nil {
+	if _, err := tx.Exec(`DELETE FROM verification_codes WHERE user_id = ?`, userID); err != nil {
 		return fmt.Errorf("delete old verification codes: %w", err)
 	}
-	_, err := d.Exec(
+	_, err = tx.Exec(
 		`INSERT INTO verification_codes (id, user_id, code_hash, expires_at) VALUES (?, ?, ?, ?)`,
 		id, userID, codeHash, expiresAt.UTC().Format("2006-01-02 15:04:05"),
 	)
 	if err != nil {
 		return fmt.Errorf("create verification code: %w", err)
 	}
+	if _, err := tx.Exec(
+		`DELETE FROM verification_code_events WHERE user_id = ? AND created_at < datetime('now', '-1 day')`, userID,
+	); err != nil {
+		return fmt.Errorf("prune verification code events: %w", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO verification_code_events (user_id) VALUES (?)`, userID); err != nil {
+		return fmt.Errorf("log verification code: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit verification code: %w", err)
+	}
 	return nil
 }
 
@@ -62,10 +82,12 @@ func (d *DB) InvalidateVerificationCode(id string) error {
 	return nil
 }
 
+// CountRecentVerificationCodes counts the codes issued to userID since
+// then, including ones a later code has replaced.
 func (d *DB) CountRecentVerificationCodes(userID string, since time.Time) (int, error) {
 	var count int
 	err := d.QueryRow(
-		`SELECT COUNT(*) FROM verification_codes WHERE user_id = ? AND created_at >= ?`,
+		`SELECT COUNT(*) FROM verification_code_events WHERE user_id = ? AND created_at >= ?`,
 		userID, since.UTC().Format("2006-01-02 15:04:05"),
 	).Scan(&count)
 	if err != nil {
@@ -105,8 +105,8 @@ func (d *DB) DeleteWebhookKey(id string) error {
 func (d *DB) GetChannelByName(name string) (*Channel, error) {
 	c := &Channel{}
 	err := d.QueryRow(
-		`SELECT id, name, type, position, visibility, description, created_by, created_at FROM channels WHERE LOWER(name) = LOWER(?) AND deleted_at IS NULL`, name,
-	).Scan(&c.ID, &c.Name, &c.Type, &c.Position, &c.Visibility, &c.Description, &c.CreatedBy, &c.CreatedAt)
+		`SELECT id, name, type, position, visibility, description, announcement, allow_attachments, allow_links, created_by, created_at FROM channels WHERE LOWER(name) = LOWER(?) AND deleted_at IS NULL`, name,
+	).Scan(&c.ID, &c.Name, &c.Type, &c.Position, &c.Visibility, &c.Description, &c.Announcement, &c.AllowAttachments, &c.AllowLinks, &c.CreatedBy, &c.CreatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -129,7 +129,7 @@ func (d *DB) GetBotUser() (*User, error) {
 	// Lazily create bot user — not in migration to avoid interfering with
 	// the "first registered user is admin" logic (which counts all users).
 	_, err = d.Exec(
-		`INSERT OR IGNORE INTO users (id, username, password_hash, is_admin, approved, created_at) VALUES (?, ?, NULL, 0, 1, datetime('now'))`,
+		`INSERT OR IGNORE INTO users (id, username, password_hash, is_admin, approved, created_at) VALUES (?, ?, NULL, FALSE, TRUE, datetime('now'))`,
 		BotUserID, "KindlyQR_bot",
 	)
 	if err != nil {
@@ -0,0 +1,62 @@
+package email
+
+import (
+	"errors"
+	"log"
+	"net/textproto"
+	"time"
+)
+
+// ErrBadAddress marks a hard bounce: the recipient's mail server refused
+// the address itself, so neither a retry nor a resend will get through.
+var ErrBadAddress = errors.New("recipient address rejected")
+
+// sendRetryDelays are the waits between verification email attempts. A
+// send is tried once more after each.
+var sendRetryDelays = []time.Duration{time.Second, 2 * time.Second}
+
+// DeliveryError is returned when a verification email couldn't be sent,
+// after retrying if the failure looked transient. The code it carried is
+// still stored, so a resend works once the problem is fixed.
+type DeliveryError struct {
+	Err error
+}
+
+func (e *DeliveryError) Error() string {
+	return "email delivery failed: " + e.Err.Error()
+}
+
+func (e *DeliveryError) Unwrap() error {
+	return e.Err
+}
+
+// Bounced reports whether the address was refused, as opposed to the
+// provider being unreachable or failing.
+func (e *DeliveryError) Bounced() bool {
+	return errors.Is(e.Err, ErrBadAddress)
+}
+
+// permanent reports whether a send error will recur however often the
+// send is retried: a hard bounce, or any other 5xx SMTP reply.
+func permanent(err error) bool {
+	if errors.Is(err, ErrBadAddress) {
+		return true
+	}
+	var reply *textproto.Error
+	return errors.As(err, &reply) && reply.Code >= 500
+}
+
+// sendWithRetry calls send until it succeeds, fails permanently or runs
+// out of sendRetryDelays.
+func sendWithRetry(send func() error) error {
+	err := send()
+	for _, delay := range sendRetryDelays {
+		if err == nil || permanent(err) {
+			return err
+		}
+		log.Printf("send email failed, retrying in %v: %v", delay, err)
+		time.Sleep(delay)
+		err = send()
+	}
+	return err
+}
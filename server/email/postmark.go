@@ -5,6 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+
+	"github.com/kalman/voicechat/db"
 )
 
 type PostmarkProvider struct {
@@ -93,6 +95,46 @@ func (p *PostmarkProvider) SendPasswordResetEmail(to, code, appName string) erro
 	return nil
 }
 
+func (p *PostmarkProvider) SendMagicLinkEmail(to, link, appName string) error {
+	from := p.FromEmail
+	if p.FromName != "" {
+		from = fmt.Sprintf("%s <%s>", p.FromName, p.FromEmail)
+	}
+
+	payload := map[string]string{
+		"From":     from,
+		"To":       to,
+		"Subject":  fmt.Sprintf("%s — Your login link", appName),
+		"HtmlBody": MagicLinkEmailHTML(link, appName),
+		"TextBody": MagicLinkEmailText(link, appName),
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal postmark payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", "https://api.postmarkapp.com/email", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create postmark request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Postmark-Server-Token", p.APIKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("postmark request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("postmark returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
 func (p *PostmarkProvider) SendApprovalEmail(to, appName string) error {
 	from := p.FromEmail
 	if p.FromName != "" {
@@ -133,7 +175,87 @@ func (p *PostmarkProvider) SendApprovalEmail(to, appName string) error {
 	return nil
 }
 
-func (p *PostmarkProvider) SendMentionEmail(to, appName, authorUsername, channelName, contentPreview string) error {
+func (p *PostmarkProvider) SendRejectionEmail(to, appName, reason string) error {
+	from := p.FromEmail
+	if p.FromName != "" {
+		from = fmt.Sprintf("%s <%s>", p.FromName, p.FromEmail)
+	}
+
+	payload := map[string]string{
+		"From":     from,
+		"To":       to,
+		"Subject":  fmt.Sprintf("%s — Your request to join", appName),
+		"HtmlBody": RejectionEmailHTML(appName, reason),
+		"TextBody": RejectionEmailText(appName, reason),
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal postmark payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", "https://api.postmarkapp.com/email", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create postmark request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Postmark-Server-Token", p.APIKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("postmark request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("postmark returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (p *PostmarkProvider) SendMentionEmail(to, appName string, mentions []db.DigestMention) error {
+	from := p.FromEmail
+	if p.FromName != "" {
+		from = fmt.Sprintf("%s <%s>", p.FromName, p.FromEmail)
+	}
+
+	payload := map[string]string{
+		"From":     from,
+		"To":       to,
+		"Subject":  MentionEmailSubject(appName, mentions),
+		"HtmlBody": MentionEmailHTML(appName, mentions),
+		"TextBody": MentionEmailText(appName, mentions),
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("marshal postmark payload: %w", err)
+	}
+
+	req, err := http.NewRequest("POST", "https://api.postmarkapp.com/email", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create postmark request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("X-Postmark-Server-Token", p.APIKey)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("postmark request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("postmark returned status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (p *PostmarkProvider) SendDigestEmail(to, appName string, mentions []db.DigestMention) error {
 	from := p.FromEmail
 	if p.FromName != "" {
 		from = fmt.Sprintf("%s <%s>", p.FromName, p.FromEmail)
@@ -142,9 +264,9 @@ func (p *PostmarkProvider) SendMentionEmail(to, appName, authorUsername, channel
 	payload := map[string]string{
 		"From":     from,
 		"To":       to,
-		"Subject":  fmt.Sprintf("%s — %s mentioned you in #%s", appName, authorUsername, channelName),
-		"HtmlBody": MentionEmailHTML(appName, authorUsername, channelName, contentPreview),
-		"TextBody": MentionEmailText(appName, authorUsername, channelName, contentPreview),
+		"Subject":  fmt.Sprintf("%s — You have %d unread mention(s)", appName, len(mentions)),
+		"HtmlBody": DigestEmailHTML(appName, mentions),
+		"TextBody": DigestEmailText(appName, mentions),
 	}
 
 	body, err := json.Marshal(payload)
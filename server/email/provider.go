@@ -2,10 +2,12 @@ package email
 
 import (
 	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"log"
 	"math/big"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,9 +20,12 @@ import (
 type Provider interface {
 	SendVerificationEmail(to, code, appName string) error
 	SendPasswordResetEmail(to, code, appName string) error
+	SendMagicLinkEmail(to, link, appName string) error
 	SendTestEmail(to, appName string) error
 	SendApprovalEmail(to, appName string) error
-	SendMentionEmail(to, appName, authorUsername, channelName, contentPreview string) error
+	SendRejectionEmail(to, appName, reason string) error
+	SendMentionEmail(to, appName string, mentions []db.DigestMention) error
+	SendDigestEmail(to, appName string, mentions []db.DigestMention) error
 }
 
 type ProviderConfig struct {
@@ -36,19 +41,35 @@ type ProviderConfig struct {
 }
 
 type EmailService struct {
-	mu      sync.RWMutex
-	codes   map[string]string // email -> latest plain code (for dev test endpoint)
-	db      *db.DB
-	encKey  []byte
-	devMode bool
+	mu       sync.RWMutex
+	codes    map[string]string               // email -> latest plain code (for dev test endpoint)
+	links    map[string]string               // email -> latest plain magic-link token (for dev test endpoint)
+	mentions map[string][][]db.DigestMention // email -> mention emails sent (for dev test endpoint)
+	db       *db.DB
+	encKey   []byte
+	devMode  bool
+
+	// CodeHashCost is the bcrypt cost for verification and reset codes.
+	CodeHashCost int
+
+	// MentionEmailInterval is the least time between two offline-mention
+	// emails to one user. Zero disables them.
+	MentionEmailInterval time.Duration
+	mentionMu            sync.Mutex
+	mentionTimers        map[string]*time.Timer // userID -> pending mention email
 }
 
 func NewEmailService(database *db.DB, encKey []byte, devMode bool) *EmailService {
 	return &EmailService{
-		codes:   make(map[string]string),
-		db:      database,
-		encKey:  encKey,
-		devMode: devMode,
+		codes:                make(map[string]string),
+		links:                make(map[string]string),
+		mentions:             make(map[string][][]db.DigestMention),
+		db:                   database,
+		encKey:               encKey,
+		devMode:              devMode,
+		CodeHashCost:         bcrypt.DefaultCost,
+		MentionEmailInterval: 15 * time.Minute,
+		mentionTimers:        make(map[string]*time.Timer),
 	}
 }
 
@@ -95,13 +116,16 @@ func (s *EmailService) GetProvider() (Provider, error) {
 	}
 }
 
+// GenerateAndSendCode stores a fresh verification code for userID and
+// emails it, retrying transient send failures. A send that still fails
+// returns a *DeliveryError; the code is kept either way.
 func (s *EmailService) GenerateAndSendCode(userID, email string) error {
 	code, err := generateCode()
 	if err != nil {
 		return fmt.Errorf("generate code: %w", err)
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), s.CodeHashCost)
 	if err != nil {
 		return fmt.Errorf("hash code: %w", err)
 	}
@@ -124,9 +148,12 @@ func (s *EmailService) GenerateAndSendCode(userID, email string) error {
 		return nil // user created, code stored — provider failure is non-fatal
 	}
 
-	if err := provider.SendVerificationEmail(email, code, "Le Faux Pain"); err != nil {
-		log.Printf("send verification email error: %v", err)
-		// Non-fatal — user can resend
+	err = sendWithRetry(func() error {
+		return provider.SendVerificationEmail(email, code, "Le Faux Pain")
+	})
+	if err != nil {
+		log.Printf("send verification email to %s: %v", email, err)
+		return &DeliveryError{Err: err}
 	}
 
 	return nil
@@ -138,7 +165,7 @@ func (s *EmailService) GenerateAndSendResetCode(userID, email string) error {
 		return fmt.Errorf("generate code: %w", err)
 	}
 
-	hash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	hash, err := bcrypt.GenerateFromPassword([]byte(code), s.CodeHashCost)
 	if err != nil {
 		return fmt.Errorf("hash code: %w", err)
 	}
@@ -168,6 +195,46 @@ func (s *EmailService) GenerateAndSendResetCode(userID, email string) error {
 	return nil
 }
 
+// GenerateAndSendMagicLink emails a one-time login link for userID.
+// baseURL is the server's public origin; the link opens the client at
+// /magic-link, which exchanges the token for a session.
+func (s *EmailService) GenerateAndSendMagicLink(userID, email, baseURL string) error {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Errorf("generate token: %w", err)
+	}
+	token := hex.EncodeToString(buf)
+
+	expiresAt := time.Now().Add(15 * time.Minute)
+	if err := s.db.CreateMagicLink(uuid.New().String(), userID, token, expiresAt); err != nil {
+		return fmt.Errorf("store magic link: %w", err)
+	}
+
+	// Store plain token in memory for dev test endpoint
+	s.mu.Lock()
+	s.links[email] = token
+	s.mu.Unlock()
+
+	provider, err := s.GetProvider()
+	if err != nil {
+		log.Printf("email provider error (magic link still stored): %v", err)
+		return nil
+	}
+
+	link := strings.TrimRight(baseURL, "/") + "/magic-link?token=" + token
+	if err := provider.SendMagicLinkEmail(email, link, "Le Faux Pain"); err != nil {
+		log.Printf("send magic link email error: %v", err)
+	}
+
+	return nil
+}
+
+func (s *EmailService) GetTestMagicLinkToken(email string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.links[email]
+}
+
 func (s *EmailService) GetTestCode(email string) string {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -219,12 +286,155 @@ func (s *EmailService) SendApprovalEmail(to, appName string) error {
 	return provider.SendApprovalEmail(to, appName)
 }
 
-func (s *EmailService) SendMentionEmail(to, appName, authorUsername, channelName, contentPreview string) error {
+func (s *EmailService) SendRejectionEmail(to, appName, reason string) error {
+	provider, err := s.GetProvider()
+	if err != nil {
+		return err
+	}
+	return provider.SendRejectionEmail(to, appName, reason)
+}
+
+func (s *EmailService) SendMentionEmail(to, appName string, mentions []db.DigestMention) error {
 	provider, err := s.GetProvider()
 	if err != nil {
 		return err
 	}
-	return provider.SendMentionEmail(to, appName, authorUsername, channelName, contentPreview)
+	return provider.SendMentionEmail(to, appName, mentions)
+}
+
+func (s *EmailService) SendDigestEmail(to, appName string, mentions []db.DigestMention) error {
+	provider, err := s.GetProvider()
+	if err != nil {
+		return err
+	}
+	return provider.SendDigestEmail(to, appName, mentions)
+}
+
+// maxDigestMentions caps how many mentions are listed in one digest.
+const maxDigestMentions = 20
+
+// SendMentionDigests emails each opted-in, offline user a summary of the
+// mentions they haven't read since their last digest. isOnline reports
+// whether a user currently has a live connection. Returns the number of
+// digests sent.
+func (s *EmailService) SendMentionDigests(appName string, isOnline func(userID string) bool) (int, error) {
+	if _, err := s.GetProvider(); err != nil {
+		return 0, nil // email not configured
+	}
+
+	recipients, err := s.db.GetDigestRecipients()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, r := range recipients {
+		if isOnline(r.UserID) {
+			continue
+		}
+		mentions, err := s.db.GetUnreadMentionsSince(r.UserID, r.LastDigestAt, maxDigestMentions)
+		if err != nil {
+			log.Printf("digest: get mentions for %s: %v", r.UserID, err)
+			continue
+		}
+		if len(mentions) == 0 {
+			continue
+		}
+		if err := s.SendDigestEmail(r.Email, appName, mentions); err != nil {
+			log.Printf("digest: send to %s: %v", r.Email, err)
+			continue
+		}
+		if err := s.db.SetDigestSent(r.UserID); err != nil {
+			log.Printf("digest: set sent for %s: %v", r.UserID, err)
+		}
+		sent++
+	}
+	return sent, nil
+}
+
+// mentionEmailSettle is the least time a queued mention email waits, so a
+// burst of mentions lands in one email.
+const mentionEmailSettle = 5 * time.Second
+
+// QueueMentionEmail schedules an email of userID's unread mentions, sent
+// if they are still offline when it comes due. Each user gets at most one
+// per MentionEmailInterval; mentions made meanwhile join the pending one.
+// isOnline reports whether a user currently has a live connection.
+func (s *EmailService) QueueMentionEmail(userID string, isOnline func(userID string) bool) {
+	if s.MentionEmailInterval <= 0 {
+		return
+	}
+	if _, err := s.GetProvider(); err != nil {
+		return // email not configured
+	}
+	if addr, err := s.db.GetMentionEmailAddress(userID); err != nil || addr == "" {
+		return
+	}
+
+	s.mentionMu.Lock()
+	defer s.mentionMu.Unlock()
+	if _, pending := s.mentionTimers[userID]; pending {
+		return
+	}
+	wait, err := s.db.MentionEmailWait(userID, s.MentionEmailInterval)
+	if err != nil {
+		log.Printf("mention email: %v", err)
+		return
+	}
+	if wait < mentionEmailSettle {
+		wait = mentionEmailSettle
+	}
+	s.mentionTimers[userID] = time.AfterFunc(wait, func() {
+		s.sendQueuedMentionEmail(userID, isOnline)
+	})
+}
+
+func (s *EmailService) sendQueuedMentionEmail(userID string, isOnline func(userID string) bool) {
+	s.mentionMu.Lock()
+	delete(s.mentionTimers, userID)
+	s.mentionMu.Unlock()
+
+	if isOnline(userID) {
+		return
+	}
+	// Re-checked: the user may have opted out or lost their email since
+	addr, err := s.db.GetMentionEmailAddress(userID)
+	if err != nil || addr == "" {
+		return
+	}
+	mentions, err := s.db.GetUnemailedMentions(userID, maxDigestMentions)
+	if err != nil {
+		log.Printf("mention email: get mentions for %s: %v", userID, err)
+		return
+	}
+	if len(mentions) == 0 {
+		return // read, or all in muted channels
+	}
+	if err := s.SendMentionEmail(addr, "Le Faux Pain", mentions); err != nil {
+		log.Printf("send mention email to %s: %v", addr, err)
+		return
+	}
+	if err := s.db.SetMentionEmailSent(userID); err != nil {
+		log.Printf("set mention email sent for %s: %v", userID, err)
+	}
+
+	if s.devMode {
+		s.mu.Lock()
+		s.mentions[addr] = append(s.mentions[addr], mentions)
+		s.mu.Unlock()
+	}
+}
+
+// GetTestMentionEmails returns the mention emails sent to email, oldest
+// first. Only recorded in dev mode.
+func (s *EmailService) GetTestMentionEmails(email string) [][]db.DigestMention {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	sent := s.mentions[email]
+	if sent == nil {
+		return [][]db.DigestMention{}
+	}
+	return sent
 }
 
 func generateCode() (string, error) {
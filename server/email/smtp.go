@@ -2,9 +2,13 @@ package email
 
 import (
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"net/smtp"
+	"net/textproto"
 	"strings"
+
+	"github.com/kalman/voicechat/db"
 )
 
 type SMTPProvider struct {
@@ -67,6 +71,11 @@ func (p *SMTPProvider) sendEmail(to, subject, htmlBody, textBody string) error {
 		return fmt.Errorf("MAIL FROM: %w", err)
 	}
 	if err := client.Rcpt(to); err != nil {
+		// A 5xx here is the recipient's server refusing the address
+		var reply *textproto.Error
+		if errors.As(err, &reply) && reply.Code >= 500 {
+			return fmt.Errorf("RCPT TO: %w: %w", ErrBadAddress, err)
+		}
 		return fmt.Errorf("RCPT TO: %w", err)
 	}
 	w, err := client.Data()
@@ -93,14 +102,28 @@ func (p *SMTPProvider) SendPasswordResetEmail(to, code, appName string) error {
 	return p.sendEmail(to, subject, PasswordResetEmailHTML(code, appName), PasswordResetEmailText(code, appName))
 }
 
+func (p *SMTPProvider) SendRejectionEmail(to, appName, reason string) error {
+	subject := fmt.Sprintf("%s — Your request to join", appName)
+	return p.sendEmail(to, subject, RejectionEmailHTML(appName, reason), RejectionEmailText(appName, reason))
+}
+
+func (p *SMTPProvider) SendMagicLinkEmail(to, link, appName string) error {
+	subject := fmt.Sprintf("%s — Your login link", appName)
+	return p.sendEmail(to, subject, MagicLinkEmailHTML(link, appName), MagicLinkEmailText(link, appName))
+}
+
 func (p *SMTPProvider) SendApprovalEmail(to, appName string) error {
 	subject := fmt.Sprintf("%s — Your account has been approved", appName)
 	return p.sendEmail(to, subject, ApprovalEmailHTML(appName), ApprovalEmailText(appName))
 }
 
-func (p *SMTPProvider) SendMentionEmail(to, appName, authorUsername, channelName, contentPreview string) error {
-	subject := fmt.Sprintf("%s — %s mentioned you in #%s", appName, authorUsername, channelName)
-	return p.sendEmail(to, subject, MentionEmailHTML(appName, authorUsername, channelName, contentPreview), MentionEmailText(appName, authorUsername, channelName, contentPreview))
+func (p *SMTPProvider) SendMentionEmail(to, appName string, mentions []db.DigestMention) error {
+	return p.sendEmail(to, MentionEmailSubject(appName, mentions), MentionEmailHTML(appName, mentions), MentionEmailText(appName, mentions))
+}
+
+func (p *SMTPProvider) SendDigestEmail(to, appName string, mentions []db.DigestMention) error {
+	subject := fmt.Sprintf("%s — You have %d unread mention(s)", appName, len(mentions))
+	return p.sendEmail(to, subject, DigestEmailHTML(appName, mentions), DigestEmailText(appName, mentions))
 }
 
 func (p *SMTPProvider) SendTestEmail(to, appName string) error {
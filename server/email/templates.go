@@ -1,6 +1,12 @@
 package email
 
-import "fmt"
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/kalman/voicechat/db"
+)
 
 func VerificationEmailHTML(code, appName string) string {
 	return fmt.Sprintf(`<!DOCTYPE html>
@@ -50,6 +56,35 @@ This code expires in 15 minutes.
 If you didn't request a password reset, you can ignore this email.`, appName, code)
 }
 
+func MagicLinkEmailHTML(link, appName string) string {
+	escaped := html.EscapeString(link)
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"></head>
+<body style="font-family: sans-serif; max-width: 480px; margin: 0 auto; padding: 20px;">
+  <h2>%s</h2>
+  <p>Click the button below to log in:</p>
+  <p style="text-align: center; padding: 16px;"><a href="%s" style="display: inline-block; padding: 12px 24px; background: #333; color: #fff; text-decoration: none; border-radius: 8px;">Log in</a></p>
+  <p>Or paste this link into your browser:</p>
+  <p style="word-break: break-all; color: #555;">%s</p>
+  <p>This link expires in 15 minutes and can only be used once.</p>
+  <p style="color: #888; font-size: 12px;">If you didn't request a login link, you can ignore this email.</p>
+</body>
+</html>`, appName, escaped, escaped)
+}
+
+func MagicLinkEmailText(link, appName string) string {
+	return fmt.Sprintf(`%s
+
+Log in with this link:
+
+%s
+
+This link expires in 15 minutes and can only be used once.
+
+If you didn't request a login link, you can ignore this email.`, appName, link)
+}
+
 func TestEmailHTML(appName string) string {
 	return fmt.Sprintf(`<!DOCTYPE html>
 <html>
@@ -90,25 +125,98 @@ Your account has been approved! You can now log in.
 If you didn't create an account, you can ignore this email.`, appName)
 }
 
-func MentionEmailHTML(appName, authorUsername, channelName, contentPreview string) string {
+func RejectionEmailHTML(appName, reason string) string {
+	reasonBlock := ""
+	if reason != "" {
+		reasonBlock = fmt.Sprintf(`  <p>The admin left this note:</p>
+  <p style="padding: 12px; background: #f4f4f4; border-radius: 8px; color: #333; white-space: pre-wrap;">%s</p>
+`, html.EscapeString(reason))
+	}
 	return fmt.Sprintf(`<!DOCTYPE html>
 <html>
 <head><meta charset="utf-8"></head>
 <body style="font-family: sans-serif; max-width: 480px; margin: 0 auto; padding: 20px;">
   <h2>%s</h2>
-  <p><strong>%s</strong> mentioned you in <strong>#%s</strong>:</p>
+  <p>Your request to join was not approved, and your pending account has been removed.</p>
+%s  <p style="color: #888; font-size: 12px;">If you didn't create an account, you can ignore this email.</p>
+</body>
+</html>`, appName, reasonBlock)
+}
+
+func RejectionEmailText(appName, reason string) string {
+	reasonBlock := ""
+	if reason != "" {
+		reasonBlock = fmt.Sprintf("The admin left this note:\n\n%s\n\n", reason)
+	}
+	return fmt.Sprintf(`%s
+
+Your request to join was not approved, and your pending account has been removed.
+
+%sIf you didn't create an account, you can ignore this email.`, appName, reasonBlock)
+}
+
+// MentionEmailSubject names the author and channel for a single mention
+// and counts them otherwise.
+func MentionEmailSubject(appName string, mentions []db.DigestMention) string {
+	if len(mentions) == 1 {
+		return fmt.Sprintf("%s — %s mentioned you in #%s", appName, mentions[0].AuthorUsername, mentions[0].ChannelName)
+	}
+	return fmt.Sprintf("%s — You were mentioned %d times", appName, len(mentions))
+}
+
+func MentionEmailHTML(appName string, mentions []db.DigestMention) string {
+	var items strings.Builder
+	for _, m := range mentions {
+		fmt.Fprintf(&items, `  <p><strong>%s</strong> mentioned you in <strong>#%s</strong>:</p>
   <p style="padding: 12px; background: #f4f4f4; border-radius: 8px; color: #333;">%s</p>
-  <p style="color: #888; font-size: 12px;">Log in to see the full conversation.</p>
+`, html.EscapeString(m.AuthorUsername), html.EscapeString(m.ChannelName), html.EscapeString(m.ContentPreview))
+	}
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"></head>
+<body style="font-family: sans-serif; max-width: 480px; margin: 0 auto; padding: 20px;">
+  <h2>%s</h2>
+%s  <p style="color: #888; font-size: 12px;">Log in to see the full conversation. You can turn off these emails in your account settings, or mute a channel to stop emails from it.</p>
 </body>
-</html>`, appName, authorUsername, channelName, contentPreview)
+</html>`, appName, items.String())
 }
 
-func MentionEmailText(appName, authorUsername, channelName, contentPreview string) string {
+func MentionEmailText(appName string, mentions []db.DigestMention) string {
+	var items strings.Builder
+	for _, m := range mentions {
+		fmt.Fprintf(&items, "%s mentioned you in #%s:\n%s\n\n", m.AuthorUsername, m.ChannelName, m.ContentPreview)
+	}
 	return fmt.Sprintf(`%s
 
-%s mentioned you in #%s:
+%sLog in to see the full conversation. You can turn off these emails in your account settings, or mute a channel to stop emails from it.`, appName, items.String())
+}
 
-%s
+func DigestEmailHTML(appName string, mentions []db.DigestMention) string {
+	var items strings.Builder
+	for _, m := range mentions {
+		fmt.Fprintf(&items, `  <p><strong>%s</strong> in <strong>#%s</strong>:</p>
+  <p style="padding: 12px; background: #f4f4f4; border-radius: 8px; color: #333;">%s</p>
+`, html.EscapeString(m.AuthorUsername), html.EscapeString(m.ChannelName), html.EscapeString(m.ContentPreview))
+	}
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"></head>
+<body style="font-family: sans-serif; max-width: 480px; margin: 0 auto; padding: 20px;">
+  <h2>%s</h2>
+  <p>You were mentioned %d time(s) while you were away:</p>
+%s  <p style="color: #888; font-size: 12px;">Log in to see the full conversations. You can turn off this digest in your account settings.</p>
+</body>
+</html>`, appName, len(mentions), items.String())
+}
+
+func DigestEmailText(appName string, mentions []db.DigestMention) string {
+	var items strings.Builder
+	for _, m := range mentions {
+		fmt.Fprintf(&items, "%s in #%s:\n%s\n\n", m.AuthorUsername, m.ChannelName, m.ContentPreview)
+	}
+	return fmt.Sprintf(`%s
+
+You were mentioned %d time(s) while you were away:
 
-Log in to see the full conversation.`, appName, authorUsername, channelName, contentPreview)
+%sLog in to see the full conversations. You can turn off this digest in your account settings.`, appName, len(mentions), items.String())
 }
@@ -1,5 +1,7 @@
 package email
 
+import "github.com/kalman/voicechat/db"
+
 type TestProvider struct{}
 
 func (p *TestProvider) SendVerificationEmail(to, code, appName string) error {
@@ -10,11 +12,23 @@ func (p *TestProvider) SendPasswordResetEmail(to, code, appName string) error {
 	return nil
 }
 
+func (p *TestProvider) SendMagicLinkEmail(to, link, appName string) error {
+	return nil
+}
+
+func (p *TestProvider) SendRejectionEmail(to, appName, reason string) error {
+	return nil
+}
+
 func (p *TestProvider) SendApprovalEmail(to, appName string) error {
 	return nil
 }
 
-func (p *TestProvider) SendMentionEmail(to, appName, authorUsername, channelName, contentPreview string) error {
+func (p *TestProvider) SendMentionEmail(to, appName string, mentions []db.DigestMention) error {
+	return nil
+}
+
+func (p *TestProvider) SendDigestEmail(to, appName string, mentions []db.DigestMention) error {
 	return nil
 }
 
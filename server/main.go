@@ -6,10 +6,12 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"os/exec"
 	"os/signal"
 	"syscall"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/kalman/voicechat/api"
 	"github.com/kalman/voicechat/config"
 	appcrypto "github.com/kalman/voicechat/crypto"
@@ -17,7 +19,9 @@ import (
 	"github.com/kalman/voicechat/email"
 	"github.com/kalman/voicechat/sfu"
 	"github.com/kalman/voicechat/storage"
+	"github.com/kalman/voicechat/webhook"
 	"github.com/kalman/voicechat/ws"
+	"github.com/pion/webrtc/v4"
 )
 
 func main() {
@@ -30,11 +34,71 @@ func main() {
 		return
 	}
 
+	if !api.ValidAccessLogLevel(cfg.AccessLog) {
+		log.Fatalf("Invalid --access-log %q (want off, error, info or debug)", cfg.AccessLog)
+	}
+	sfuEndpoints, err := cfg.SFUEndpointList()
+	if err != nil {
+		log.Fatalf("Invalid --sfu-endpoints: %v", err)
+	}
+	natIPs, err := cfg.NAT1To1IPList()
+	if err != nil {
+		log.Fatalf("Invalid --nat-1to1-ips: %v", err)
+	}
+	if len(natIPs) > 0 && cfg.PublicIP != "" {
+		log.Fatalf("Set --public-ip or --nat-1to1-ips, not both")
+	}
+	if cfg.NATCandidateType != "host" && cfg.NATCandidateType != "srflx" {
+		log.Fatalf("Invalid --nat-candidate-type %q (want host or srflx)", cfg.NATCandidateType)
+	}
+	icePortMin, icePortMax, err := cfg.ICEPortRange()
+	if err != nil {
+		log.Fatalf("Invalid --ice-udp-port-min/--ice-udp-port-max: %v", err)
+	}
+	switch {
+	case cfg.RadioTranscode == "off" || cfg.RadioTranscode == "":
+		cfg.RadioTranscode = ""
+	case !storage.ValidTranscodeCodec(cfg.RadioTranscode):
+		log.Fatalf("Invalid --radio-transcode %q (want opus, aac or off)", cfg.RadioTranscode)
+	case cfg.RadioTranscodeRate < 32000 || cfg.RadioTranscodeRate > 320000:
+		log.Fatalf("Invalid --radio-transcode-bitrate %d (want 32000-320000)", cfg.RadioTranscodeRate)
+	default:
+		if _, err := exec.LookPath("ffmpeg"); err != nil {
+			log.Printf("--radio-transcode=%s needs ffmpeg on PATH; radio uploads will be stored as uploaded", cfg.RadioTranscode)
+			cfg.RadioTranscode = ""
+		}
+	}
+	dirMode, err := cfg.DirPerm()
+	if err != nil {
+		log.Fatalf("Invalid --data-dir-mode: %v", err)
+	}
+	passwords, err := appcrypto.NewPasswordHasher(cfg.PasswordHash, cfg.BcryptCost)
+	if err != nil {
+		log.Fatalf("Invalid password hashing config: %v", err)
+	}
+	if cfg.AdminUsername != "" {
+		if !api.ValidUsername(cfg.AdminUsername) {
+			log.Fatalf("Invalid --admin-username %q (want 1-32 letters, digits or underscores)", cfg.AdminUsername)
+		}
+		if cfg.AdminPassword == "" {
+			log.Fatalf("--admin-username needs --admin-password (or ADMIN_PASSWORD)")
+		}
+	}
+
+	if cfg.CheckDB {
+		os.Exit(checkDB(cfg))
+	}
+
 	if err := cfg.EnsureDataDir(); err != nil {
 		log.Fatalf("Failed to create data directories: %v", err)
 	}
 
-	database, err := db.Open(cfg.DataDir)
+	var database *db.DB
+	if cfg.DatabaseURL != "" {
+		database, err = db.OpenPostgres(cfg.DatabaseURL)
+	} else {
+		database, err = db.Open(cfg.DataDir)
+	}
 	if err != nil {
 		log.Fatalf("Failed to open database: %v", err)
 	}
@@ -43,6 +107,11 @@ func main() {
 	if err := database.SeedDefaultChannels(); err != nil {
 		log.Fatalf("Failed to seed default channels: %v", err)
 	}
+	if cfg.AdminUsername != "" {
+		if err := seedAdmin(database, passwords, cfg.AdminUsername, cfg.AdminPassword); err != nil {
+			log.Fatalf("Failed to seed admin: %v", err)
+		}
+	}
 
 	encKey, err := appcrypto.LoadOrCreateKey(cfg.DataDir)
 	if err != nil {
@@ -50,12 +119,81 @@ func main() {
 	}
 
 	emailSvc := email.NewEmailService(database, encKey, cfg.DevMode)
+	emailSvc.MentionEmailInterval = time.Duration(cfg.MentionEmailMinutes) * time.Minute
+	emailSvc.CodeHashCost = cfg.BcryptCost
 
 	store := storage.NewFileStore(cfg.DataDir)
+	store.DirMode = dirMode
+	store.Clamd = cfg.ClamdAddr
+	if err := store.ClearTemp(); err != nil {
+		log.Printf("clear upload temp files: %v", err)
+	}
 
-	sfuInstance := sfu.New(cfg.STUNServer, cfg.PublicIP)
+	sfuICEServers := func() []webrtc.ICEServer {
+		var servers []webrtc.ICEServer
+		for _, s := range cfg.ICEServers("sfu") {
+			servers = append(servers, webrtc.ICEServer{
+				URLs:       s.URLs,
+				Username:   s.Username,
+				Credential: s.Credential,
+			})
+		}
+		return servers
+	}
+	newSFUNode := func(natIPs []string) *sfu.SFU {
+		network := sfu.Network{
+			NAT1To1IPs: natIPs,
+			NATSrflx:   cfg.NATCandidateType == "srflx",
+			PortMin:    icePortMin,
+			PortMax:    icePortMax,
+		}
+		node := sfu.New(sfuICEServers(), network, sfu.VoiceAudio{
+			Bitrate: cfg.VoiceBitrate,
+			FEC:     cfg.VoiceFEC,
+		})
+		node.ICERestartGrace = time.Duration(cfg.ICERestartGrace) * time.Second
+		node.IdleTimeout = time.Duration(cfg.VoiceIdleTimeout) * time.Second
+		go node.RunIdleSweep()
+		if cfg.TURNSecret != "" {
+			// Minted TURN credentials expire; refresh them per peer connection
+			node.ICEServers = sfuICEServers
+		}
+		return node
+	}
+	if len(natIPs) == 0 && cfg.PublicIP != "" {
+		natIPs = []string{cfg.PublicIP}
+	}
+	if icePortMax != 0 {
+		log.Printf("SFU media on UDP ports %d-%d", icePortMin, icePortMax)
+	}
+	sfuInstance := sfu.NewRegistry(newSFUNode(natIPs))
+	for _, r := range sfuEndpoints {
+		sfuInstance.Register(r.Name, newSFUNode([]string{r.PublicIP}))
+		log.Printf("SFU endpoint %s advertising %s", r.Name, r.PublicIP)
+	}
 
 	hub := ws.NewHub(database, sfuInstance, emailSvc, cfg.DevMode)
+	hub.Store = store
+	hub.TrustedOrigins = cfg.TrustedOrigins()
+	for _, o := range hub.TrustedOrigins {
+		if o == "*" && !cfg.DevMode {
+			log.Printf("WARNING: --allowed-origins=* trusts every website with the API and WebSocket")
+		}
+	}
+	hub.PingInterval = time.Duration(cfg.WSPingInterval) * time.Second
+	hub.PingTimeout = time.Duration(cfg.WSPingTimeout) * time.Second
+	hub.RadioSyncInterval = time.Duration(cfg.RadioSyncInterval) * time.Second
+	hub.MaxReactionEmojis = cfg.MaxReactionEmojis
+	hub.MaxReactionsPerUser = cfg.MaxReactionsPerUser
+	hub.MaxMentions = cfg.MaxMentions
+	if cfg.WSMaxMessageBytes > 0 {
+		hub.MaxMessageBytes = int64(cfg.WSMaxMessageBytes)
+	}
+	hub.MaxConnsPerIP = cfg.WSMaxConnsPerIP
+	hub.MaxConns = cfg.WSMaxConns
+	hub.ReactionBurstWindow = time.Duration(cfg.ReactionBurstMs) * time.Millisecond
+	hub.OnlineBurstWindow = time.Duration(cfg.OnlineBurstMs) * time.Millisecond
+	hub.OnlineBurstSize = cfg.OnlineBurstSize
 
 	// Wire SFU signaling back through the hub
 	sfuInstance.Signal = func(userID string, op string, data any) {
@@ -63,10 +201,10 @@ func main() {
 		if err != nil {
 			return
 		}
-		// Voice WebRTC signals go only to the voice-owning connection;
+		// Voice WebRTC signals and ducking go only to the voice-owning connection;
 		// screen share signals go to all connections for the user.
 		switch op {
-		case "webrtc_offer", "webrtc_ice":
+		case "webrtc_offer", "webrtc_ice", "voice_ducking":
 			hub.SendToVoiceClient(userID, msg)
 		default:
 			hub.SendTo(userID, msg)
@@ -113,31 +251,50 @@ func main() {
 		hub.BroadcastAll(msg)
 	}
 
+	// Outgoing webhooks see everything the hub broadcasts
+	outgoing := webhook.NewDispatcher(database, encKey)
+	if err := outgoing.Reload(); err != nil {
+		log.Printf("load outgoing webhooks: %v", err)
+	}
+	hub.OnBroadcast = outgoing.Publish
+
+	downloads := api.NewDownloadCounter(database)
+
 	go hub.Run()
 
-	// Orphaned attachment cleanup every 10 minutes
-	go func() {
-		ticker := time.NewTicker(10 * time.Minute)
-		defer ticker.Stop()
-		for range ticker.C {
-			orphans, err := database.CleanupOrphanedAttachments()
-			if err != nil {
-				log.Printf("orphan cleanup error: %v", err)
-				continue
-			}
-			for _, o := range orphans {
-				store.RemoveFile(o.Path)
-				if o.ThumbPath != nil {
-					store.RemoveFile(*o.ThumbPath)
+	// Orphaned attachment cleanup: uploads that never made it onto a
+	// message (or whose message was deleted), once past the grace period
+	if cfg.OrphanCleanupMins > 0 {
+		go func() {
+			ticker := time.NewTicker(time.Duration(cfg.OrphanCleanupMins) * time.Minute)
+			defer ticker.Stop()
+			for range ticker.C {
+				orphans, err := database.CleanupOrphanedAttachments(cfg.OrphanGraceMins)
+				if err != nil {
+					log.Printf("orphan cleanup error: %v", err)
+					continue
+				}
+				// Identical uploads share one file; keep any another row uses
+				for _, o := range orphans {
+					if inUse, err := database.FileInUse(o.Path); err == nil && !inUse {
+						store.RemoveFile(o.Path)
+					}
+					if o.ThumbPath != nil {
+						if inUse, err := database.FileInUse(*o.ThumbPath); err == nil && !inUse {
+							store.RemoveFile(*o.ThumbPath)
+						}
+					}
+				}
+				if len(orphans) > 0 {
+					log.Printf("cleaned up %d orphaned attachments", len(orphans))
 				}
 			}
-			if len(orphans) > 0 {
-				log.Printf("cleaned up %d orphaned attachments", len(orphans))
-			}
-		}
-	}()
+		}()
+	}
 
-	// Periodic DB cleanup: expired verification codes + old read notifications (every hour)
+	// Periodic DB cleanup: expired verification codes, old read notifications,
+	// notifications over the per-user cap, and messages past the retention
+	// period (every hour)
 	go func() {
 		ticker := time.NewTicker(1 * time.Hour)
 		defer ticker.Stop()
@@ -147,11 +304,43 @@ func main() {
 			} else if n > 0 {
 				log.Printf("cleaned up %d expired verification codes", n)
 			}
-			if n, err := database.CleanupOldReadNotifications(); err != nil {
+			if n, err := database.CleanupOldReadNotifications(cfg.NotificationDays); err != nil {
 				log.Printf("notification cleanup error: %v", err)
 			} else if n > 0 {
 				log.Printf("cleaned up %d old read notifications", n)
 			}
+			if n, err := database.CapNotificationsPerUser(cfg.MaxNotifications); err != nil {
+				log.Printf("notification cap error: %v", err)
+			} else if n > 0 {
+				log.Printf("trimmed %d notifications over the per-user cap", n)
+			}
+			if n, err := database.CleanupExpiredMagicLinks(); err != nil {
+				log.Printf("magic link cleanup error: %v", err)
+			} else if n > 0 {
+				log.Printf("cleaned up %d expired magic links", n)
+			}
+			if days, err := database.GetRetentionDays(); err != nil {
+				log.Printf("retention setting error: %v", err)
+			} else if n, err := database.PurgeExpiredMessages(days); err != nil {
+				log.Printf("message retention error: %v", err)
+			} else if n > 0 {
+				log.Printf("purged %d messages older than %d days", n, days)
+			}
+		}
+	}()
+
+	// Daily missed-mention digests (checked hourly; each user gets at most
+	// one per day)
+	go func() {
+		ticker := time.NewTicker(1 * time.Hour)
+		defer ticker.Stop()
+		for range ticker.C {
+			n, err := emailSvc.SendMentionDigests("Le Faux Pain", hub.IsUserOnline)
+			if err != nil {
+				log.Printf("mention digest error: %v", err)
+			} else if n > 0 {
+				log.Printf("sent %d mention digests", n)
+			}
 		}
 	}()
 
@@ -160,7 +349,7 @@ func main() {
 		log.Fatalf("Failed to load static files: %v", err)
 	}
 
-	router := api.NewRouter(cfg, database, hub, store, staticFS, emailSvc, encKey)
+	router := api.NewRouter(cfg, database, hub, store, staticFS, emailSvc, encKey, outgoing, downloads, passwords)
 
 	addr := fmt.Sprintf(":%d", cfg.Port)
 	server := &http.Server{
@@ -172,10 +361,20 @@ func main() {
 
 	shutdown := func() {
 		log.Println("Shutting down...")
-		hub.Shutdown()
+		// Warn clients first so they hang up voice themselves and schedule
+		// a reconnect, then drain SFU peers and close sockets cleanly
+		hub.NotifyShutdown(cfg.ShutdownReconnect)
 		ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
 		defer cancel()
-		if err := server.Shutdown(ctx); err != nil {
+		if err := sfuInstance.Shutdown(ctx); err != nil {
+			log.Printf("SFU shutdown: %v", err)
+		}
+		hub.Shutdown()
+		outgoing.Close()
+		err := server.Shutdown(ctx)
+		// Flush download counts only once in-flight requests are done
+		downloads.Close()
+		if err != nil {
 			log.Fatalf("Server shutdown error: %v", err)
 		}
 		log.Println("Server stopped")
@@ -207,3 +406,54 @@ func main() {
 		shutdown()
 	}
 }
+
+// checkDB prints the database's schema version against the one this
+// binary expects and returns the exit code: 0 if this binary can run on
+// it (pending migrations apply at startup), 1 if the database is newer or
+// can't be read.
+func checkDB(cfg *config.Config) int {
+	var current, target int
+	var err error
+	if cfg.DatabaseURL != "" {
+		current, target, err = db.CheckPostgresSchema(cfg.DatabaseURL)
+	} else {
+		current, target, err = db.CheckSchema(cfg.DataDir)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "check-db: %v\n", err)
+		return 1
+	}
+	fmt.Printf("database schema version: %d\nserver schema version:   %d\n", current, target)
+	switch {
+	case current > target:
+		fmt.Println("status: database is newer than this server; upgrade the server or restore a backup")
+		return 1
+	case current < target:
+		fmt.Printf("status: %d migration(s) will run at startup\n", target-current)
+	default:
+		fmt.Println("status: up to date")
+	}
+	return 0
+}
+
+// seedAdmin creates an approved admin named username unless a user by
+// that name (any case) already exists, which is left as it is, so it is
+// safe on every startup.
+func seedAdmin(database *db.DB, passwords *appcrypto.PasswordHasher, username, password string) error {
+	existing, err := database.GetUserByUsername(username)
+	if err != nil {
+		return err
+	}
+	if existing != nil {
+		return nil
+	}
+	hash, err := passwords.Hash(password)
+	if err != nil {
+		return fmt.Errorf("hash password: %w", err)
+	}
+	if err := database.CreateUser(uuid.New().String(), username, &hash, nil, true, true, nil, nil); err != nil {
+		return err
+	}
+	log.Printf("Seeded admin account %s", username)
+	return nil
+}
@@ -0,0 +1,55 @@
+package sfu
+
+import (
+	"log"
+	"time"
+)
+
+// RunIdleSweep removes idle voice peers (see IdleTimeout) until the
+// process exits. It returns at once if IdleTimeout is zero. Each removal
+// goes through Room.RemovePeer, so OnPeerRemoved broadcasts the leave as
+// for any other disconnect; the user first gets voice_idle_disconnect so
+// the client can tell why.
+func (s *SFU) RunIdleSweep() {
+	if s.IdleTimeout <= 0 {
+		return
+	}
+	// Remove peers within a quarter of the timeout of going idle
+	interval := s.IdleTimeout / 4
+	if interval < time.Second {
+		interval = time.Second
+	}
+	if interval > 30*time.Second {
+		interval = 30 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for now := range ticker.C {
+		s.sweepIdle(now)
+	}
+}
+
+func (s *SFU) sweepIdle(now time.Time) {
+	s.mu.RLock()
+	rooms := make([]*Room, 0, len(s.rooms))
+	for _, room := range s.rooms {
+		rooms = append(rooms, room)
+	}
+	s.mu.RUnlock()
+
+	for _, room := range rooms {
+		for _, userID := range room.idlePeers(now, s.IdleTimeout) {
+			// Presenting counts as activity
+			if s.GetUserScreenRoom(userID) != nil {
+				continue
+			}
+			log.Printf("sfu: removing idle voice peer %s from room %s", userID, room.ChannelID)
+			if s.Signal != nil {
+				s.Signal(userID, "voice_idle_disconnect", map[string]string{
+					"channel_id": room.ChannelID,
+				})
+			}
+			room.RemovePeer(userID)
+		}
+	}
+}
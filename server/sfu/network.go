@@ -0,0 +1,41 @@
+package sfu
+
+import (
+	"log"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// Network is how a node's ICE agents bind and what addresses they
+// advertise. The zero value binds any free port and advertises local
+// addresses as they are.
+type Network struct {
+	// NAT1To1IPs are advertised for a host behind 1:1 NAT: one external IP
+	// per family, or external/local pairs.
+	NAT1To1IPs []string
+	// NATSrflx advertises NAT1To1IPs as server reflexive candidates beside
+	// the host ones, instead of rewriting the host candidates.
+	NATSrflx bool
+	// PortMin and PortMax bound the UDP ports ICE listens on. Every peer
+	// connection takes at least one port per local address, so the range
+	// caps concurrent voice and screen-share peers.
+	PortMin, PortMax uint16
+}
+
+// settingEngine applies n to a fresh SettingEngine.
+func (n Network) settingEngine() webrtc.SettingEngine {
+	se := webrtc.SettingEngine{}
+	if len(n.NAT1To1IPs) > 0 {
+		candidateType := webrtc.ICECandidateTypeHost
+		if n.NATSrflx {
+			candidateType = webrtc.ICECandidateTypeSrflx
+		}
+		se.SetNAT1To1IPs(n.NAT1To1IPs, candidateType)
+	}
+	if n.PortMax != 0 {
+		if err := se.SetEphemeralUDPPortRange(n.PortMin, n.PortMax); err != nil {
+			log.Printf("sfu: UDP port range %d-%d: %v", n.PortMin, n.PortMax, err)
+		}
+	}
+	return se
+}
@@ -2,6 +2,7 @@ package sfu
 
 import (
 	"sync"
+	"time"
 
 	"github.com/pion/webrtc/v4"
 )
@@ -13,6 +14,7 @@ type VoiceState struct {
 	SelfDeafen bool   `json:"self_deafen"`
 	ServerMute bool   `json:"server_mute"`
 	Speaking   bool   `json:"speaking"`
+	Priority   bool   `json:"priority_speaker"`
 }
 
 type Peer struct {
@@ -24,6 +26,11 @@ type Peer struct {
 	localTrack         *webrtc.TrackLocalStaticRTP
 	room               *Room
 	needsRenegotiation bool
+	needsICERestart    bool
+
+	// iceRestartTimer is armed while an ICE restart is in flight and
+	// removes the peer if it has not reconnected when it fires.
+	iceRestartTimer *time.Timer
 
 	// Audio share state. A user may publish at most one additional
 	// audio source ("share") alongside the mic. shareSourceID and
@@ -42,6 +49,16 @@ type Peer struct {
 	SelfDeafen bool
 	ServerMute bool
 	Speaking   bool
+
+	// PrioritySpeaker marks the peer whose speech ducks everyone else
+	// in the room. At most one peer per room holds it; see
+	// Room.SetPrioritySpeaker.
+	PrioritySpeaker bool
+
+	// lastActive is when the peer joined, last changed mute, deafen or
+	// speaking state, or last saw someone join or leave its room. The
+	// idle sweep measures from it.
+	lastActive time.Time
 }
 
 // ShareSource is a snapshot of an active audio share for inclusion in
@@ -73,18 +90,21 @@ func (p *Peer) VoiceState() VoiceState {
 		SelfDeafen: p.SelfDeafen,
 		ServerMute: p.ServerMute,
 		Speaking:   p.Speaking,
+		Priority:   p.PrioritySpeaker,
 	}
 }
 
 func (p *Peer) SetSelfMute(muted bool) {
 	p.mu.Lock()
 	p.SelfMute = muted
+	p.lastActive = time.Now()
 	p.mu.Unlock()
 }
 
 func (p *Peer) SetSelfDeafen(deafened bool) {
 	p.mu.Lock()
 	p.SelfDeafen = deafened
+	p.lastActive = time.Now()
 	p.mu.Unlock()
 }
 
@@ -97,5 +117,27 @@ func (p *Peer) SetServerMute(muted bool) {
 func (p *Peer) SetSpeaking(speaking bool) {
 	p.mu.Lock()
 	p.Speaking = speaking
+	p.lastActive = time.Now()
+	p.mu.Unlock()
+}
+
+func (p *Peer) touch(now time.Time) {
+	p.mu.Lock()
+	p.lastActive = now
 	p.mu.Unlock()
 }
+
+// idle reports whether the peer has been muted or deafened (or alone in
+// its room) and silent for at least timeout. A peer sharing audio is never
+// idle.
+func (p *Peer) idle(now time.Time, timeout time.Duration, alone bool) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.Speaking || p.shareSourceID != "" {
+		return false
+	}
+	if !p.SelfMute && !p.SelfDeafen && !alone {
+		return false
+	}
+	return now.Sub(p.lastActive) >= timeout
+}
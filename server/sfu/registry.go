@@ -0,0 +1,250 @@
+package sfu
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// DefaultEndpoint names the node every server has: the one built from
+// --public-ip.
+const DefaultEndpoint = "default"
+
+// Registry routes voice and screen share across SFU nodes keyed by
+// endpoint name. A channel's room lives on one node at a time, whichever
+// node its first joiner was routed to, so everyone in a call shares it.
+// Lookups by user or channel search every node, so callers don't need to
+// know where a room ended up.
+//
+// Nodes all run in this process. An endpoint is one of this host's public
+// IPs, advertised in the node's host candidates, so users of a multi-homed
+// server can pick the network path that suits them; it is not a remote
+// SFU.
+type Registry struct {
+	mu        sync.RWMutex
+	nodes     map[string]*SFU
+	endpoints []string // registration order; endpoints[0] is DefaultEndpoint
+
+	// Callbacks fired by any node.
+	Signal               SignalFunc
+	OnPeerRemoved        PeerRemovedFunc
+	OnScreenShareStopped ScreenShareStoppedFunc
+	OnShareEnded         ShareEndedFunc
+}
+
+// NewRegistry returns a registry holding defaultNode as DefaultEndpoint.
+func NewRegistry(defaultNode *SFU) *Registry {
+	r := &Registry{nodes: make(map[string]*SFU)}
+	r.Register(DefaultEndpoint, defaultNode)
+	return r
+}
+
+// Register adds node under endpoint, replacing its callbacks with ones that
+// forward to the registry's.
+func (r *Registry) Register(endpoint string, node *SFU) {
+	node.Signal = func(userID, op string, data any) {
+		if r.Signal != nil {
+			r.Signal(userID, op, data)
+		}
+	}
+	node.OnPeerRemoved = func(userID string) {
+		if r.OnPeerRemoved != nil {
+			r.OnPeerRemoved(userID)
+		}
+	}
+	node.OnScreenShareStopped = func(presenterID, channelID string) {
+		if r.OnScreenShareStopped != nil {
+			r.OnScreenShareStopped(presenterID, channelID)
+		}
+	}
+	node.OnShareEnded = func(userID, sourceID string) {
+		if r.OnShareEnded != nil {
+			r.OnShareEnded(userID, sourceID)
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, exists := r.nodes[endpoint]; !exists {
+		r.endpoints = append(r.endpoints, endpoint)
+	}
+	r.nodes[endpoint] = node
+}
+
+// Endpoints returns the registered endpoints, DefaultEndpoint first.
+func (r *Registry) Endpoints() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return append([]string(nil), r.endpoints...)
+}
+
+// Node returns the node for endpoint, or nil if there is none.
+func (r *Registry) Node(endpoint string) *SFU {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.nodes[endpoint]
+}
+
+func (r *Registry) each() []*SFU {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	nodes := make([]*SFU, 0, len(r.endpoints))
+	for _, endpoint := range r.endpoints {
+		nodes = append(nodes, r.nodes[endpoint])
+	}
+	return nodes
+}
+
+// VoiceAudio reports the default node's voice Opus settings. Every node
+// is built with the same ones.
+func (r *Registry) VoiceAudio() VoiceAudio {
+	return r.Node(DefaultEndpoint).VoiceAudio()
+}
+
+// GetOrCreateRoom returns channelID's room. If the channel has no live
+// room it is created on the node for endpoint, or on the default node when
+// endpoint is empty or unknown. Returns the endpoint the room is on.
+func (r *Registry) GetOrCreateRoom(channelID, endpoint string) (*Room, string) {
+	// Held across lookup and create so two first joiners can't open
+	// rooms for one channel on different nodes
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, name := range r.endpoints {
+		if room := r.nodes[name].GetRoom(channelID); room != nil {
+			return room, name
+		}
+	}
+	if _, ok := r.nodes[endpoint]; !ok {
+		endpoint = DefaultEndpoint
+	}
+	return r.nodes[endpoint].GetOrCreateRoom(channelID), endpoint
+}
+
+// RoomEndpoint returns the endpoint hosting channelID's live room, or "" if
+// there is none.
+func (r *Registry) RoomEndpoint(channelID string) string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, name := range r.endpoints {
+		if r.nodes[name].GetRoom(channelID) != nil {
+			return name
+		}
+	}
+	return ""
+}
+
+func (r *Registry) GetRoom(channelID string) *Room {
+	for _, node := range r.each() {
+		if room := node.GetRoom(channelID); room != nil {
+			return room
+		}
+	}
+	return nil
+}
+
+// GetUserRoom returns the room a user is currently in, or nil
+func (r *Registry) GetUserRoom(userID string) *Room {
+	for _, node := range r.each() {
+		if room := node.GetUserRoom(userID); room != nil {
+			return room
+		}
+	}
+	return nil
+}
+
+// StartScreenShare starts a share on the node hosting channelID's voice
+// room, so presenter and viewers stay on the node they're talking on.
+func (r *Registry) StartScreenShare(channelID, presenterID, quality string) (*ScreenRoom, error) {
+	node := r.Node(r.RoomEndpoint(channelID))
+	if node == nil {
+		node = r.Node(DefaultEndpoint)
+	}
+	for _, other := range r.each() {
+		if other != node && other.GetScreenRoom(channelID) != nil {
+			return nil, errors.New("screen share already active in channel " + channelID)
+		}
+	}
+	return node.StartScreenShare(channelID, presenterID, quality)
+}
+
+func (r *Registry) StopScreenShare(channelID string) {
+	for _, node := range r.each() {
+		node.StopScreenShare(channelID)
+	}
+}
+
+func (r *Registry) GetScreenRoom(channelID string) *ScreenRoom {
+	for _, node := range r.each() {
+		if sr := node.GetScreenRoom(channelID); sr != nil {
+			return sr
+		}
+	}
+	return nil
+}
+
+func (r *Registry) GetUserScreenRoom(userID string) *ScreenRoom {
+	for _, node := range r.each() {
+		if sr := node.GetUserScreenRoom(userID); sr != nil {
+			return sr
+		}
+	}
+	return nil
+}
+
+func (r *Registry) ScreenShares() []ScreenShareState {
+	states := []ScreenShareState{}
+	for _, node := range r.each() {
+		states = append(states, node.ScreenShares()...)
+	}
+	return states
+}
+
+// HandleScreenAnswer and HandleScreenICE are offered to every node; only
+// the one holding the user's screen session acts on them.
+func (r *Registry) HandleScreenAnswer(userID string, sdp string, role string) {
+	for _, node := range r.each() {
+		node.HandleScreenAnswer(userID, sdp, role)
+	}
+}
+
+func (r *Registry) HandleScreenICE(userID string, candidate webrtc.ICECandidateInit, role string) {
+	for _, node := range r.each() {
+		node.HandleScreenICE(userID, candidate, role)
+	}
+}
+
+// VoiceStates returns all current voice states across all nodes
+func (r *Registry) VoiceStates() []VoiceState {
+	var states []VoiceState
+	for _, node := range r.each() {
+		states = append(states, node.VoiceStates()...)
+	}
+	return states
+}
+
+func (r *Registry) ActiveShares() []ShareSource {
+	var shares []ShareSource
+	for _, node := range r.each() {
+		shares = append(shares, node.ActiveShares()...)
+	}
+	return shares
+}
+
+// Shutdown shuts every node down concurrently, returning the first error.
+func (r *Registry) Shutdown(ctx context.Context) error {
+	nodes := r.each()
+	errs := make(chan error, len(nodes))
+	for _, node := range nodes {
+		go func(node *SFU) { errs <- node.Shutdown(ctx) }(node)
+	}
+	var first error
+	for range nodes {
+		if err := <-errs; err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/pion/webrtc/v4"
 )
@@ -24,16 +25,17 @@ func newRoom(channelID string, sfu *SFU) *Room {
 }
 
 func (r *Room) AddPeer(userID string) (*Peer, error) {
-	pc, err := r.sfu.api.NewPeerConnection(r.sfu.config)
+	pc, err := r.sfu.api.NewPeerConnection(r.sfu.peerConfig())
 	if err != nil {
 		return nil, err
 	}
 
 	peer := &Peer{
-		UserID:    userID,
-		ChannelID: r.ChannelID,
-		pc:        pc,
-		room:      r,
+		UserID:     userID,
+		ChannelID:  r.ChannelID,
+		pc:         pc,
+		room:       r,
+		lastActive: time.Now(),
 	}
 
 	// Add a transceiver for the peer to send audio
@@ -62,8 +64,10 @@ func (r *Room) AddPeer(userID string) (*Peer, error) {
 		log.Printf("sfu: room %s got track from %s (share=%v sourceID=%q)", r.ChannelID, userID, isShare, sourceID)
 
 		// Use a stream ID that encodes the source so receivers can
-		// correlate ontrack events with voice_audio_source_added events.
-		streamID := track.StreamID()
+		// correlate ontrack events with voice_audio_source_added events:
+		// the sender's user ID for their mic (clients duck by it), or
+		// share:<source> for an audio share.
+		streamID := userID
 		if isShare {
 			streamID = "share:" + sourceID
 		}
@@ -127,8 +131,20 @@ func (r *Room) AddPeer(userID string) (*Peer, error) {
 
 	pc.OnConnectionStateChange(func(state webrtc.PeerConnectionState) {
 		log.Printf("sfu: room %s peer %s state: %s", r.ChannelID, userID, state)
-		if state == webrtc.PeerConnectionStateFailed ||
-			state == webrtc.PeerConnectionStateClosed {
+		switch state {
+		case webrtc.PeerConnectionStateConnected:
+			r.cancelICERestart(peer)
+		case webrtc.PeerConnectionStateDisconnected:
+			// Usually a network change (Wi-Fi ↔ cellular, roaming).
+			// Try to recover before dropping the peer.
+			r.restartICE(peer)
+		case webrtc.PeerConnectionStateFailed:
+			// A restart in flight gets the rest of its grace period;
+			// the timer removes the peer if it never reconnects.
+			if !r.iceRestartPending(peer) {
+				r.RemovePeer(userID)
+			}
+		case webrtc.PeerConnectionStateClosed:
 			r.RemovePeer(userID)
 		}
 	})
@@ -182,6 +198,7 @@ func (r *Room) AddPeer(userID string) (*Peer, error) {
 	}
 
 	r.mu.Lock()
+	r.touchPeers()
 	r.peers[userID] = peer
 	r.mu.Unlock()
 
@@ -208,9 +225,19 @@ func (r *Room) RemovePeer(userID string) {
 	// PC OnConnectionStateChange).
 	peer.mu.Lock()
 	endedShareID := peer.shareSourceID
+	wasDucking := peer.PrioritySpeaker && peer.Speaking
+	if peer.iceRestartTimer != nil {
+		peer.iceRestartTimer.Stop()
+		peer.iceRestartTimer = nil
+	}
 	peer.mu.Unlock()
 	delete(r.peers, userID)
 	empty := len(r.peers) == 0
+	remaining := make([]string, 0, len(r.peers))
+	for uid := range r.peers {
+		remaining = append(remaining, uid)
+	}
+	r.touchPeers()
 	r.mu.Unlock()
 
 	// Fire share-ended and peer-removed callbacks first. Receivers
@@ -221,6 +248,18 @@ func (r *Room) RemovePeer(userID string) {
 	if r.sfu.OnPeerRemoved != nil {
 		r.sfu.OnPeerRemoved(userID)
 	}
+	// A priority speaker who leaves mid-sentence never reports
+	// speaking=false, so lift the duck for everyone still here.
+	if wasDucking && r.sfu.Signal != nil {
+		for _, uid := range remaining {
+			r.sfu.Signal(uid, "voice_ducking", map[string]any{
+				"channel_id": r.ChannelID,
+				"user_id":    userID,
+				"active":     false,
+				"gain":       DuckGain,
+			})
+		}
+	}
 
 	// Close the PC asynchronously. A never-answered PC can block on
 	// ICE/DTLS timeout — we don't want that to stall the hub run loop
@@ -269,19 +308,34 @@ func (r *Room) addTrackToOthers(fromUserID string, track *webrtc.TrackLocalStati
 }
 
 func (r *Room) renegotiatePeer(peer *Peer) {
+	r.sendOffer(peer, false)
+}
+
+// sendOffer creates a fresh offer for peer and signals it. iceRestart
+// asks for new ICE credentials so the client gathers candidates on its
+// current network.
+func (r *Room) sendOffer(peer *Peer, iceRestart bool) {
 	// Only renegotiate when signaling state is stable.
 	// If not stable, mark the peer so HandleAnswer triggers renegotiation later.
 	peer.mu.Lock()
 	if peer.pc.SignalingState() != webrtc.SignalingStateStable {
 		peer.needsRenegotiation = true
+		if iceRestart {
+			peer.needsICERestart = true
+		}
 		peer.mu.Unlock()
 		log.Printf("sfu: deferring renegotiation for %s (state=%s)", peer.UserID, peer.pc.SignalingState())
 		return
 	}
 	peer.needsRenegotiation = false
+	peer.needsICERestart = false
 	peer.mu.Unlock()
 
-	offer, err := peer.pc.CreateOffer(nil)
+	var opts *webrtc.OfferOptions
+	if iceRestart {
+		opts = &webrtc.OfferOptions{ICERestart: true}
+	}
+	offer, err := peer.pc.CreateOffer(opts)
 	if err != nil {
 		log.Printf("sfu: renegotiate offer: %v", err)
 		return
@@ -291,13 +345,70 @@ func (r *Room) renegotiatePeer(peer *Peer) {
 		return
 	}
 	if r.sfu.Signal != nil {
-		log.Printf("sfu: sent renegotiation offer to %s", peer.UserID)
+		if iceRestart {
+			log.Printf("sfu: sent ICE restart offer to %s", peer.UserID)
+		} else {
+			log.Printf("sfu: sent renegotiation offer to %s", peer.UserID)
+		}
 		r.sfu.Signal(peer.UserID, "webrtc_offer", map[string]string{
 			"sdp": offer.SDP,
 		})
 	}
 }
 
+// restartICE starts an ICE restart for a peer whose connection went to
+// disconnected and arms a timer that removes the peer if it has not
+// reconnected within SFU.ICERestartGrace. With no grace configured the
+// peer is left to pion's own failed timeout, as before.
+func (r *Room) restartICE(peer *Peer) {
+	grace := r.sfu.ICERestartGrace
+	if grace <= 0 {
+		return
+	}
+
+	peer.mu.Lock()
+	if peer.iceRestartTimer != nil {
+		// Already restarting; let the running grace period play out.
+		peer.mu.Unlock()
+		return
+	}
+	peer.iceRestartTimer = time.AfterFunc(grace, func() {
+		r.mu.RLock()
+		current := r.peers[peer.UserID]
+		r.mu.RUnlock()
+		if current != peer {
+			return
+		}
+		if peer.pc.ConnectionState() == webrtc.PeerConnectionStateConnected {
+			r.cancelICERestart(peer)
+			return
+		}
+		log.Printf("sfu: ICE restart for %s did not recover within %s", peer.UserID, grace)
+		r.RemovePeer(peer.UserID)
+	})
+	peer.mu.Unlock()
+
+	log.Printf("sfu: peer %s disconnected, attempting ICE restart", peer.UserID)
+	r.sendOffer(peer, true)
+}
+
+// cancelICERestart stops a pending ICE restart grace timer, if any.
+func (r *Room) cancelICERestart(peer *Peer) {
+	peer.mu.Lock()
+	defer peer.mu.Unlock()
+	if peer.iceRestartTimer != nil {
+		peer.iceRestartTimer.Stop()
+		peer.iceRestartTimer = nil
+		log.Printf("sfu: peer %s reconnected", peer.UserID)
+	}
+}
+
+func (r *Room) iceRestartPending(peer *Peer) bool {
+	peer.mu.RLock()
+	defer peer.mu.RUnlock()
+	return peer.iceRestartTimer != nil
+}
+
 func (r *Room) HandleAnswer(userID string, sdp string) {
 	r.mu.RLock()
 	peer, ok := r.peers[userID]
@@ -322,12 +433,14 @@ func (r *Room) HandleAnswer(userID string, sdp string) {
 	// trigger it now that signaling state is back to stable.
 	peer.mu.Lock()
 	needsRenego := peer.needsRenegotiation
+	needsRestart := peer.needsICERestart
 	peer.needsRenegotiation = false
+	peer.needsICERestart = false
 	peer.mu.Unlock()
 
 	if needsRenego {
 		log.Printf("sfu: running deferred renegotiation for %s", userID)
-		r.renegotiatePeer(peer)
+		r.sendOffer(peer, needsRestart)
 	}
 }
 
@@ -344,6 +457,29 @@ func (r *Room) HandleICE(userID string, candidate webrtc.ICECandidateInit) {
 	}
 }
 
+// touchPeers restarts every peer's idle clock, so someone left alone gets
+// the full timeout from then. Caller holds r.mu.
+func (r *Room) touchPeers() {
+	now := time.Now()
+	for _, p := range r.peers {
+		p.touch(now)
+	}
+}
+
+// idlePeers returns the users in the room that have been idle for timeout.
+func (r *Room) idlePeers(now time.Time, timeout time.Duration) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	alone := len(r.peers) == 1
+	var ids []string
+	for id, p := range r.peers {
+		if p.idle(now, timeout, alone) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
 func (r *Room) PeerCount() int {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -485,3 +621,54 @@ func (r *Room) ActiveShares() []ShareSource {
 	}
 	return out
 }
+
+// DuckGain is the playback gain receivers apply to every other peer in
+// the room while the priority speaker is talking. The SFU forwards Opus
+// RTP untouched (no decode/re-encode), so attenuation is carried out by
+// the receiving clients based on voice_ducking events.
+const DuckGain = 0.3
+
+// SetPrioritySpeaker grants priority to userID and revokes it from every
+// other peer in the room. An empty userID clears priority for the room.
+// Returns the voice states of every peer whose flag changed so the hub
+// can broadcast them.
+func (r *Room) SetPrioritySpeaker(userID string) ([]VoiceState, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if userID != "" {
+		if _, ok := r.peers[userID]; !ok {
+			return nil, fmt.Errorf("user %s not in room %s", userID, r.ChannelID)
+		}
+	}
+
+	var changed []VoiceState
+	for uid, p := range r.peers {
+		want := uid == userID
+		p.mu.Lock()
+		if p.PrioritySpeaker != want {
+			p.PrioritySpeaker = want
+			p.mu.Unlock()
+			changed = append(changed, p.VoiceState())
+			continue
+		}
+		p.mu.Unlock()
+	}
+	return changed, nil
+}
+
+// Ducking reports whether the room's priority speaker is currently
+// talking, and who that speaker is.
+func (r *Room) Ducking() (userID string, active bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for uid, p := range r.peers {
+		p.mu.RLock()
+		priority, speaking := p.PrioritySpeaker, p.Speaking
+		p.mu.RUnlock()
+		if priority {
+			return uid, speaking
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,103 @@
+package sfu
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/pion/rtcp"
+)
+
+// Screen share quality presets. The SFU forwards the presenter's video
+// without transcoding, so it can't rescale frames itself. Instead it caps
+// the presenter's send bitrate with REMB feedback, and tells the presenter
+// which downscale factor to apply to its sender (see ScreenQualityProfile).
+const (
+	ScreenQualityLow    = "low"
+	ScreenQualityMedium = "medium"
+	ScreenQualityHigh   = "high"
+)
+
+// DefaultScreenQuality is used when the presenter doesn't ask for one.
+const DefaultScreenQuality = ScreenQualityHigh
+
+type ScreenQualityProfile struct {
+	MaxBitrate uint64  `json:"max_bitrate"` // bits per second
+	ScaleDown  float64 `json:"scale_down"`  // RTCRtpEncodingParameters.scaleResolutionDownBy
+}
+
+var screenQualityProfiles = map[string]ScreenQualityProfile{
+	ScreenQualityLow:    {MaxBitrate: 500_000, ScaleDown: 2},
+	ScreenQualityMedium: {MaxBitrate: 1_500_000, ScaleDown: 1.5},
+	ScreenQualityHigh:   {MaxBitrate: 4_000_000, ScaleDown: 1},
+}
+
+// rembInterval is how often the bitrate cap is re-sent. Browsers treat
+// REMB as a live estimate, so a single packet would soon be overridden
+// by their own bandwidth estimation.
+const rembInterval = time.Second
+
+// ScreenQuality returns the profile for a named quality preset.
+func ScreenQuality(name string) (ScreenQualityProfile, bool) {
+	p, ok := screenQualityProfiles[name]
+	return p, ok
+}
+
+// Quality returns the room's current quality preset.
+func (sr *ScreenRoom) Quality() string {
+	sr.mu.RLock()
+	defer sr.mu.RUnlock()
+	return sr.quality
+}
+
+// SetQuality switches the room to a different quality preset and
+// immediately applies the new bitrate cap to the presenter.
+func (sr *ScreenRoom) SetQuality(name string) error {
+	if _, ok := screenQualityProfiles[name]; !ok {
+		return fmt.Errorf("unknown screen share quality %q", name)
+	}
+	sr.mu.Lock()
+	sr.quality = name
+	sr.mu.Unlock()
+
+	sr.sendBitrateCap()
+	return nil
+}
+
+// sendBitrateCap sends a REMB to the presenter limiting its video bitrate
+// to the current profile's maximum.
+func (sr *ScreenRoom) sendBitrateCap() {
+	sr.mu.RLock()
+	pc := sr.presenterPC
+	ssrc := sr.videoSSRC
+	profile := screenQualityProfiles[sr.quality]
+	sr.mu.RUnlock()
+
+	if pc == nil || ssrc == 0 {
+		return
+	}
+
+	if err := pc.WriteRTCP([]rtcp.Packet{
+		&rtcp.ReceiverEstimatedMaximumBitrate{
+			Bitrate: float32(profile.MaxBitrate),
+			SSRCs:   []uint32{ssrc},
+		},
+	}); err != nil {
+		log.Printf("sfu/screen: send REMB to presenter: %v", err)
+	}
+}
+
+// capBitrateLoop re-sends the bitrate cap until the room stops.
+func (sr *ScreenRoom) capBitrateLoop() {
+	ticker := time.NewTicker(rembInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		sr.mu.RLock()
+		stopped := sr.stopped
+		sr.mu.RUnlock()
+		if stopped {
+			return
+		}
+		sr.sendBitrateCap()
+	}
+}
@@ -19,6 +19,8 @@ type ScreenRoom struct {
 	audioTrack  *webrtc.TrackLocalStaticRTP
 	videoSSRC   uint32 // presenter's video track SSRC for PLI requests
 	viewers     map[string]*ScreenViewer
+	quality     string    // see screen_quality.go
+	capOnce     sync.Once // starts capBitrateLoop for the first video track
 	stopped     bool
 }
 
@@ -29,17 +31,18 @@ type ScreenViewer struct {
 	needsRenegotiation bool
 }
 
-func newScreenRoom(channelID, presenterID string, sfu *SFU) *ScreenRoom {
+func newScreenRoom(channelID, presenterID, quality string, sfu *SFU) *ScreenRoom {
 	return &ScreenRoom{
 		ChannelID:   channelID,
 		PresenterID: presenterID,
 		sfu:         sfu,
 		viewers:     make(map[string]*ScreenViewer),
+		quality:     quality,
 	}
 }
 
 func (sr *ScreenRoom) SetupPresenter() error {
-	pc, err := sr.sfu.screenAPI.NewPeerConnection(sr.sfu.config)
+	pc, err := sr.sfu.screenAPI.NewPeerConnection(sr.sfu.peerConfig())
 	if err != nil {
 		return fmt.Errorf("create presenter PC: %w", err)
 	}
@@ -85,6 +88,12 @@ func (sr *ScreenRoom) SetupPresenter() error {
 		// Add this track to existing viewers
 		sr.addTrackToViewers(localTrack)
 
+		if track.Kind() == webrtc.RTPCodecTypeVideo {
+			// A renegotiated video track reuses the loop, which reads
+			// the current SSRC each tick
+			sr.capOnce.Do(func() { go sr.capBitrateLoop() })
+		}
+
 		// Forward RTP packets
 		go func() {
 			buf := make([]byte, 1500)
@@ -146,7 +155,7 @@ func (sr *ScreenRoom) SetupPresenter() error {
 }
 
 func (sr *ScreenRoom) AddViewer(userID string) error {
-	pc, err := sr.sfu.screenAPI.NewPeerConnection(sr.sfu.config)
+	pc, err := sr.sfu.screenAPI.NewPeerConnection(sr.sfu.peerConfig())
 	if err != nil {
 		return fmt.Errorf("create viewer PC: %w", err)
 	}
@@ -1,9 +1,11 @@
 package sfu
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"sync"
+	"time"
 
 	"github.com/pion/interceptor"
 	"github.com/pion/interceptor/pkg/nack"
@@ -19,22 +21,67 @@ type ShareEndedFunc func(userID string, sourceID string)
 type ScreenShareState struct {
 	UserID    string `json:"user_id"`
 	ChannelID string `json:"channel_id"`
+	Quality   string `json:"quality"`
 }
 
+// VoiceAudio is the Opus configuration offered to voice peers. It goes
+// into the SDP fmtp line of every voice offer and is sent to clients in
+// ready so browsers can cap their encoder to match.
+type VoiceAudio struct {
+	Bitrate int  `json:"bitrate"` // Target average bitrate, bits/s
+	FEC     bool `json:"fec"`     // In-band forward error correction
+}
+
+// Opus supports 6–510 kbit/s.
+const (
+	minOpusBitrate = 6000
+	maxOpusBitrate = 510000
+)
+
 type SFU struct {
 	mu            sync.RWMutex
 	rooms         map[string]*Room       // channelID → room
 	screenRooms   map[string]*ScreenRoom // channelID → screen room
 	config        webrtc.Configuration
 	api           *webrtc.API
+	voiceAudio    VoiceAudio
 	screenAPI     *webrtc.API
+	// ICEServers, if set, is called for every new peer connection and
+	// overrides the static list passed to New. Used when TURN credentials
+	// are short-lived and must be minted fresh.
+	ICEServers func() []webrtc.ICEServer
+	// ICERestartGrace is how long a voice peer whose connection drops to
+	// disconnected gets to recover via ICE restart before it is removed.
+	// Zero disables the restart; the peer is removed once pion reports
+	// failed.
+	ICERestartGrace time.Duration
+	// IdleTimeout removes voice peers that have been self-muted or
+	// deafened, or alone in their room, and silent this long. Zero
+	// disables it. Read by RunIdleSweep.
+	IdleTimeout time.Duration
+
 	Signal               SignalFunc
 	OnPeerRemoved        PeerRemovedFunc
 	OnScreenShareStopped ScreenShareStoppedFunc
 	OnShareEnded         ShareEndedFunc
 }
 
-func New(stunServer string, publicIP string) *SFU {
+// New builds the SFU. iceServers (STUN and/or TURN) are used for every
+// voice and screen-share peer connection, which bind and advertise as
+// network says; audio sets the voice Opus bitrate and FEC, with the
+// bitrate clamped to what Opus supports.
+func New(iceServers []webrtc.ICEServer, network Network, audio VoiceAudio) *SFU {
+	if audio.Bitrate < minOpusBitrate {
+		audio.Bitrate = minOpusBitrate
+	}
+	if audio.Bitrate > maxOpusBitrate {
+		audio.Bitrate = maxOpusBitrate
+	}
+	fec := 0
+	if audio.FEC {
+		fec = 1
+	}
+
 	// Media engine: Opus only (for voice)
 	me := &webrtc.MediaEngine{}
 	if err := me.RegisterCodec(webrtc.RTPCodecParameters{
@@ -42,7 +89,7 @@ func New(stunServer string, publicIP string) *SFU {
 			MimeType:    webrtc.MimeTypeOpus,
 			ClockRate:   48000,
 			Channels:    2,
-			SDPFmtpLine: "minptime=10;useinbandfec=1;usedtx=1;maxaveragebitrate=128000",
+			SDPFmtpLine: fmt.Sprintf("minptime=10;useinbandfec=%d;usedtx=1;maxaveragebitrate=%d", fec, audio.Bitrate),
 		},
 		PayloadType: 111,
 	}, webrtc.RTPCodecTypeAudio); err != nil {
@@ -56,10 +103,7 @@ func New(stunServer string, publicIP string) *SFU {
 	generator, _ := nack.NewGeneratorInterceptor()
 	ir.Add(generator)
 
-	se := webrtc.SettingEngine{}
-	if publicIP != "" {
-		se.SetNAT1To1IPs([]string{publicIP}, webrtc.ICECandidateTypeHost)
-	}
+	se := network.settingEngine()
 
 	api := webrtc.NewAPI(
 		webrtc.WithMediaEngine(me),
@@ -112,10 +156,7 @@ func New(stunServer string, publicIP string) *SFU {
 		log.Printf("sfu: register screen interceptors: %v", err)
 	}
 
-	screenSE := webrtc.SettingEngine{}
-	if publicIP != "" {
-		screenSE.SetNAT1To1IPs([]string{publicIP}, webrtc.ICECandidateTypeHost)
-	}
+	screenSE := network.settingEngine()
 
 	screenAPI := webrtc.NewAPI(
 		webrtc.WithMediaEngine(screenME),
@@ -123,11 +164,8 @@ func New(stunServer string, publicIP string) *SFU {
 		webrtc.WithSettingEngine(screenSE),
 	)
 
-	iceServers := []webrtc.ICEServer{}
-	if stunServer != "" {
-		iceServers = append(iceServers, webrtc.ICEServer{
-			URLs: []string{stunServer},
-		})
+	if iceServers == nil {
+		iceServers = []webrtc.ICEServer{}
 	}
 
 	return &SFU{
@@ -136,11 +174,17 @@ func New(stunServer string, publicIP string) *SFU {
 		config: webrtc.Configuration{
 			ICEServers: iceServers,
 		},
-		api:       api,
-		screenAPI: screenAPI,
+		api:        api,
+		screenAPI:  screenAPI,
+		voiceAudio: audio,
 	}
 }
 
+// VoiceAudio reports the effective voice Opus settings.
+func (s *SFU) VoiceAudio() VoiceAudio {
+	return s.voiceAudio
+}
+
 func (s *SFU) GetOrCreateRoom(channelID string) *Room {
 	s.mu.Lock()
 	defer s.mu.Unlock()
@@ -166,6 +210,71 @@ func (s *SFU) RemoveRoom(channelID string) {
 	delete(s.rooms, channelID)
 }
 
+// peerConfig returns the configuration for a new peer connection.
+func (s *SFU) peerConfig() webrtc.Configuration {
+	if s.ICEServers == nil {
+		return s.config
+	}
+	cfg := s.config
+	cfg.ICEServers = s.ICEServers()
+	return cfg
+}
+
+// Shutdown tears down every voice room and screen-share room, closing all
+// peer connections. It does not fire OnPeerRemoved/OnScreenShareStopped —
+// the server is going away, so there is nobody left to notify. Returns
+// ctx.Err() if the peer connections haven't all closed before ctx is done.
+func (s *SFU) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	rooms := s.rooms
+	screenRooms := s.screenRooms
+	s.rooms = make(map[string]*Room)
+	s.screenRooms = make(map[string]*ScreenRoom)
+	s.mu.Unlock()
+
+	var pcs []*webrtc.PeerConnection
+	for _, room := range rooms {
+		room.mu.Lock()
+		for _, peer := range room.peers {
+			pcs = append(pcs, peer.pc)
+		}
+		room.peers = make(map[string]*Peer)
+		room.mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	for _, sr := range screenRooms {
+		wg.Add(1)
+		go func(sr *ScreenRoom) {
+			defer wg.Done()
+			sr.Stop()
+		}(sr)
+	}
+	// Close concurrently — a never-answered PC can block on ICE/DTLS
+	// timeout and we don't want one of those to hold up the rest.
+	for _, pc := range pcs {
+		wg.Add(1)
+		go func(pc *webrtc.PeerConnection) {
+			defer wg.Done()
+			pc.Close()
+		}(pc)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Printf("SFU: closed %d peer connections, %d screen shares", len(pcs), len(screenRooms))
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // GetUserRoom returns the room a user is currently in, or nil
 func (s *SFU) GetUserRoom(userID string) *Room {
 	s.mu.RLock()
@@ -183,13 +292,20 @@ func (s *SFU) GetUserRoom(userID string) *Room {
 
 // Screen share methods
 
-func (s *SFU) StartScreenShare(channelID, presenterID string) (*ScreenRoom, error) {
+func (s *SFU) StartScreenShare(channelID, presenterID, quality string) (*ScreenRoom, error) {
+	if quality == "" {
+		quality = DefaultScreenQuality
+	}
+	if _, ok := screenQualityProfiles[quality]; !ok {
+		return nil, fmt.Errorf("unknown screen share quality %q", quality)
+	}
+
 	s.mu.Lock()
 	if _, exists := s.screenRooms[channelID]; exists {
 		s.mu.Unlock()
 		return nil, fmt.Errorf("screen share already active in channel %s", channelID)
 	}
-	sr := newScreenRoom(channelID, presenterID, s)
+	sr := newScreenRoom(channelID, presenterID, quality, s)
 	s.screenRooms[channelID] = sr
 	s.mu.Unlock()
 
@@ -246,6 +362,7 @@ func (s *SFU) ScreenShares() []ScreenShareState {
 		states = append(states, ScreenShareState{
 			UserID:    sr.PresenterID,
 			ChannelID: sr.ChannelID,
+			Quality:   sr.Quality(),
 		})
 	}
 	return states
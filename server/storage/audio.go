@@ -1,6 +1,7 @@
 package storage
 
 import (
+	"bufio"
 	"encoding/binary"
 	"io"
 	"os"
@@ -8,7 +9,8 @@ import (
 )
 
 // GetAudioDuration returns the duration in seconds for an audio file.
-// Supports MP3, WAV, OGG (Vorbis/Opus), FLAC, and M4A/AAC/MP4 natively.
+// Supports MP3, WAV, OGG (Vorbis/Opus), FLAC, M4A/AAC/MP4 and raw ADTS
+// AAC natively.
 // Returns 0 for unsupported formats or on parse error.
 func (fs *FileStore) GetAudioDuration(relPath, mimeType string) float64 {
 	absPath := filepath.Join(fs.DataDir, relPath)
@@ -23,11 +25,18 @@ func (fs *FileStore) GetAudioDuration(relPath, mimeType string) float64 {
 		return mp3Duration(f)
 	case "audio/wav":
 		return wavDuration(f)
-	case "audio/ogg":
+	case "audio/ogg", "audio/opus":
 		return oggDuration(f)
 	case "audio/flac":
 		return flacDuration(f)
-	case "audio/mp4", "audio/x-m4a", "audio/aac":
+	case "audio/aac":
+		// Raw ADTS, or AAC stored in an MP4 container
+		if d := adtsDuration(f); d > 0 {
+			return d
+		}
+		f.Seek(0, io.SeekStart)
+		return mp4Duration(f)
+	case "audio/mp4", "audio/x-m4a":
 		return mp4Duration(f)
 	default:
 		return 0
@@ -396,6 +405,57 @@ func flacDuration(r io.ReadSeeker) float64 {
 	return float64(totalSamples) / float64(sampleRate)
 }
 
+var adtsSampleRates = [16]int{
+	96000, 88200, 64000, 48000, 44100, 32000, 24000, 22050,
+	16000, 12000, 11025, 8000, 7350, 0, 0, 0,
+}
+
+// isADTSHeader reports whether b starts with an ADTS frame header: the
+// 12-bit sync word with layer 0, which sets it apart from MPEG audio.
+func isADTSHeader(b []byte) bool {
+	return len(b) >= 7 && b[0] == 0xFF && b[1]&0xF6 == 0xF0
+}
+
+// adtsDuration counts the frames of a raw ADTS AAC stream. Each frame
+// header gives its length and number of 1024-sample blocks. Stops at the
+// first byte that isn't a frame header, so trailing tags are ignored.
+func adtsDuration(r io.Reader) float64 {
+	br := bufio.NewReaderSize(r, 64*1024)
+
+	// Skip an ID3v2 tag if present
+	if head, err := br.Peek(10); err == nil && string(head[0:3]) == "ID3" {
+		tagSize := int(head[6])<<21 | int(head[7])<<14 | int(head[8])<<7 | int(head[9])
+		if _, err := br.Discard(10 + tagSize); err != nil {
+			return 0
+		}
+	}
+
+	var samples int64
+	sampleRate := 0
+	for {
+		h, err := br.Peek(7)
+		if err != nil || !isADTSHeader(h) {
+			break
+		}
+		rate := adtsSampleRates[(h[2]>>2)&0x0F]
+		frameLen := int(h[3]&0x03)<<11 | int(h[4])<<3 | int(h[5])>>5
+		if rate == 0 || frameLen < 7 {
+			break
+		}
+		if sampleRate == 0 {
+			sampleRate = rate
+		}
+		samples += int64(h[6]&0x03+1) * 1024
+		if _, err := br.Discard(frameLen); err != nil {
+			break
+		}
+	}
+	if sampleRate == 0 {
+		return 0
+	}
+	return float64(samples) / float64(sampleRate)
+}
+
 // mp4Duration parses an MP4/M4A container to find the duration from the mvhd atom.
 func mp4Duration(r io.ReadSeeker) float64 {
 	fileSize, _ := r.Seek(0, io.SeekEnd)
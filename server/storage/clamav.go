@@ -0,0 +1,99 @@
+package storage
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// clamdTimeout bounds one scan, connecting included; clamd reads the whole
+// stream before it answers.
+const clamdTimeout = 2 * time.Minute
+
+// clamdChunk is the INSTREAM chunk size. clamd's StreamMaxLength still
+// caps the total.
+const clamdChunk = 64 * 1024
+
+// InfectedError is returned when clamd flags an upload. The file is not
+// stored.
+type InfectedError struct {
+	Signature string
+}
+
+func (e *InfectedError) Error() string {
+	return "malware detected: " + e.Signature
+}
+
+// IsInfected reports whether err is a clamd detection, returning the
+// signature name.
+func IsInfected(err error) (string, bool) {
+	var infected *InfectedError
+	if errors.As(err, &infected) {
+		return infected.Signature, true
+	}
+	return "", false
+}
+
+// scanClamd streams r to the clamd at addr, a host:port or a Unix socket
+// path, with INSTREAM. It returns an *InfectedError on a detection and
+// another error if clamd can't be reached or doesn't give a verdict.
+func scanClamd(addr string, r io.Reader) error {
+	network := "tcp"
+	if strings.HasPrefix(addr, "/") {
+		network = "unix"
+	}
+	conn, err := net.DialTimeout(network, addr, clamdTimeout)
+	if err != nil {
+		return fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(clamdTimeout))
+
+	w := bufio.NewWriterSize(conn, clamdChunk+4)
+	if _, err := w.WriteString("zINSTREAM\x00"); err != nil {
+		return fmt.Errorf("clamd: %w", err)
+	}
+	buf := make([]byte, clamdChunk)
+	var size [4]byte
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(size[:], uint32(n))
+			w.Write(size[:])
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				// clamd hangs up once a stream passes StreamMaxLength;
+				// its reply says so
+				break
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("read upload for scan: %w", err)
+		}
+	}
+	binary.BigEndian.PutUint32(size[:], 0)
+	w.Write(size[:])
+	w.Flush()
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return fmt.Errorf("clamd: read reply: %w", err)
+	}
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	switch {
+	case strings.HasSuffix(reply, " FOUND"):
+		sig := strings.TrimSuffix(reply, " FOUND")
+		sig = strings.TrimPrefix(sig, "stream: ")
+		return &InfectedError{Signature: sig}
+	case strings.HasSuffix(reply, ": OK"):
+		return nil
+	}
+	return fmt.Errorf("clamd: %s", reply)
+}
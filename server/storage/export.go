@@ -0,0 +1,69 @@
+package storage
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// exportDirs are the data-dir subdirectories holding user content.
+var exportDirs = []string{"uploads", "thumbs", "avatars"}
+
+// WriteZip adds every stored file under the content directories to zw,
+// preserving their data-dir-relative paths. Files are streamed one at a
+// time so memory use doesn't grow with the size of the store.
+func (fs *FileStore) WriteZip(zw *zip.Writer) error {
+	for _, dir := range exportDirs {
+		root := filepath.Join(fs.DataDir, dir)
+		err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return err
+			}
+			if d.IsDir() || !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(fs.DataDir, path)
+			if err != nil {
+				return err
+			}
+			return addFileToZip(zw, path, filepath.ToSlash(rel))
+		})
+		if err != nil {
+			return fmt.Errorf("export %s: %w", dir, err)
+		}
+	}
+	return nil
+}
+
+func addFileToZip(zw *zip.Writer, absPath, name string) error {
+	f, err := os.Open(absPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	hdr, err := zip.FileInfoHeader(info)
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	// Uploads are mostly already-compressed media; storing avoids
+	// burning CPU for no gain.
+	hdr.Method = zip.Store
+
+	w, err := zw.CreateHeader(hdr)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
@@ -1,7 +1,9 @@
 package storage
 
 import (
+	"bytes"
 	"crypto/sha256"
+	"errors"
 	"fmt"
 	"image"
 	_ "image/gif"
@@ -13,6 +15,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
 
 	_ "golang.org/x/image/webp"
 )
@@ -32,6 +35,7 @@ var videoMIME = map[string]string{
 var audioMIME = map[string]string{
 	"audio/mpeg": ".mp3",
 	"audio/ogg":  ".ogg",
+	"audio/opus": ".opus",
 	"audio/wav":  ".wav",
 	"audio/flac": ".flac",
 	"audio/mp4":  ".m4a",
@@ -41,6 +45,8 @@ var audioMIME = map[string]string{
 
 type FileStore struct {
 	DataDir string
+	DirMode os.FileMode // Mode for directories the store creates; files get it without execute bits
+	Clamd   string      // clamd address (host:port or socket path) uploads are scanned with; empty disables scanning
 }
 
 type StoredFile struct {
@@ -51,62 +57,136 @@ type StoredFile struct {
 }
 
 func NewFileStore(dataDir string) *FileStore {
-	return &FileStore{DataDir: dataDir}
+	return &FileStore{DataDir: dataDir, DirMode: 0755}
 }
 
-func (fs *FileStore) IsAllowedMIME(mime string) bool {
-	_, ok := allowedMIME[mime]
-	return ok
+// IsDiskFull reports whether err came from the data directory's disk or
+// quota running out.
+func IsDiskFull(err error) bool {
+	return errors.Is(err, syscall.ENOSPC) || errors.Is(err, syscall.EDQUOT)
 }
 
-func (fs *FileStore) Store(file multipart.File, mimeType string) (*StoredFile, error) {
-	ext, ok := allowedMIME[mimeType]
-	if !ok {
-		return nil, fmt.Errorf("unsupported MIME type: %s", mimeType)
-	}
+// ClearTemp removes write-in-progress files left under tmp/ by a crash.
+func (fs *FileStore) ClearTemp() error {
+	return os.RemoveAll(filepath.Join(fs.DataDir, "tmp"))
+}
 
-	// Read file into temp to compute hash
-	tmpFile, err := os.CreateTemp("", "upload-*")
+// createTemp opens a new file under tmp/ in the data dir, so the final
+// rename stays on one filesystem and is atomic.
+func (fs *FileStore) createTemp(pattern string) (*os.File, error) {
+	dir := filepath.Join(fs.DataDir, "tmp")
+	if err := os.MkdirAll(dir, fs.DirMode); err != nil {
+		return nil, fmt.Errorf("create temp dir: %w", err)
+	}
+	f, err := os.CreateTemp(dir, pattern)
 	if err != nil {
 		return nil, fmt.Errorf("create temp: %w", err)
 	}
-	defer os.Remove(tmpFile.Name())
-	defer tmpFile.Close()
+	return f, nil
+}
 
+// commitTemp syncs and closes tmp, then renames it to absPath. tmp is
+// removed on any error, so a failed write never leaves a partial file
+// where a database row could point at it.
+func (fs *FileStore) commitTemp(tmp *os.File, absPath string) error {
+	err := tmp.Sync()
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), fs.DirMode&^0111)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), absPath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("write file: %w", err)
+	}
+	return nil
+}
+
+// saveUpload copies file to uploads/ab/cd/<sha256><ext>, returning the
+// data-dir-relative path. Content already stored under that hash is kept
+// as is (dedup).
+func (fs *FileStore) saveUpload(file io.Reader, ext string) (string, error) {
+	tmp, err := fs.createTemp("upload-*")
+	if err != nil {
+		return "", err
+	}
 	hasher := sha256.New()
-	if _, err := io.Copy(io.MultiWriter(tmpFile, hasher), file); err != nil {
-		return nil, fmt.Errorf("copy file: %w", err)
+	if _, err := io.Copy(io.MultiWriter(tmp, hasher), file); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("copy file: %w", err)
+	}
+	if fs.Clamd != "" {
+		// Fail closed: an upload clamd couldn't vouch for isn't kept
+		if err := scanTemp(fs.Clamd, tmp); err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+			return "", err
+		}
 	}
+	return fs.placeUpload(tmp, fmt.Sprintf("%x", hasher.Sum(nil)), ext)
+}
 
-	hash := fmt.Sprintf("%x", hasher.Sum(nil))
+// scanTemp runs tmp's content past clamd.
+func scanTemp(addr string, tmp *os.File) error {
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("rewind upload for scan: %w", err)
+	}
+	return scanClamd(addr, tmp)
+}
 
+// placeUpload moves tmp, whose content hashes to hash, to its
+// content-addressed path, or drops it if that content is already stored.
+func (fs *FileStore) placeUpload(tmp *os.File, hash, ext string) (string, error) {
 	// Hash-based path: uploads/ab/cd/<hash>.ext
 	relDir := filepath.Join("uploads", hash[:2], hash[2:4])
-	absDir := filepath.Join(fs.DataDir, relDir)
-	if err := os.MkdirAll(absDir, 0755); err != nil {
-		return nil, fmt.Errorf("create upload dir: %w", err)
-	}
-
 	relPath := filepath.Join(relDir, hash+ext)
 	absPath := filepath.Join(fs.DataDir, relPath)
 
-	// Copy temp to final location (skip if exists = dedup)
-	if _, err := os.Stat(absPath); os.IsNotExist(err) {
-		tmpFile.Seek(0, 0)
-		dst, err := os.Create(absPath)
-		if err != nil {
-			return nil, fmt.Errorf("create file: %w", err)
-		}
-		if _, err := io.Copy(dst, tmpFile); err != nil {
-			dst.Close()
-			return nil, fmt.Errorf("write file: %w", err)
-		}
-		dst.Close()
+	if _, err := os.Stat(absPath); err == nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return relPath, nil
+	}
+	if err := os.MkdirAll(filepath.Join(fs.DataDir, relDir), fs.DirMode); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("create upload dir: %w", err)
+	}
+	if err := fs.commitTemp(tmp, absPath); err != nil {
+		return "", err
+	}
+	return relPath, nil
+}
+
+func (fs *FileStore) IsAllowedMIME(mime string) bool {
+	_, ok := allowedMIME[mime]
+	return ok
+}
+
+func (fs *FileStore) Store(file multipart.File, mimeType string) (*StoredFile, error) {
+	ext, ok := allowedMIME[mimeType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported MIME type: %s", mimeType)
 	}
 
+	relPath, err := fs.saveUpload(file, ext)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := os.Open(filepath.Join(fs.DataDir, relPath))
+	if err != nil {
+		return nil, fmt.Errorf("open stored file: %w", err)
+	}
+	defer stored.Close()
+	hash := strings.TrimSuffix(filepath.Base(relPath), ext)
+
 	// Get image dimensions
-	tmpFile.Seek(0, 0)
-	imgCfg, _, err := image.DecodeConfig(tmpFile)
+	imgCfg, _, err := image.DecodeConfig(stored)
 	width, height := 0, 0
 	if err == nil {
 		width = imgCfg.Width
@@ -121,9 +201,9 @@ func (fs *FileStore) Store(file multipart.File, mimeType string) (*StoredFile, e
 	thumbAbsPath := filepath.Join(fs.DataDir, thumbRelPath)
 
 	if _, err := os.Stat(thumbAbsPath); os.IsNotExist(err) {
-		if err := os.MkdirAll(thumbAbsDir, 0755); err == nil {
-			tmpFile.Seek(0, 0)
-			if err := generateThumbnail(tmpFile, thumbAbsPath, 400); err != nil {
+		if err := os.MkdirAll(thumbAbsDir, fs.DirMode); err == nil {
+			stored.Seek(0, 0)
+			if err := fs.generateThumbnail(stored, thumbAbsPath, 400); err != nil {
 				// Non-fatal — just no thumbnail
 				thumbRelPath = ""
 			}
@@ -141,7 +221,7 @@ func (fs *FileStore) Store(file multipart.File, mimeType string) (*StoredFile, e
 	return result, nil
 }
 
-func generateThumbnail(r io.ReadSeeker, destPath string, maxWidth int) error {
+func (fs *FileStore) generateThumbnail(r io.ReadSeeker, destPath string, maxWidth int) error {
 	img, _, err := image.Decode(r)
 	if err != nil {
 		return err
@@ -168,13 +248,16 @@ func generateThumbnail(r io.ReadSeeker, destPath string, maxWidth int) error {
 		}
 	}
 
-	f, err := os.Create(destPath)
+	f, err := fs.createTemp("thumb-*")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
-
-	return jpeg.Encode(f, thumb, &jpeg.Options{Quality: 80})
+	if err := jpeg.Encode(f, thumb, &jpeg.Options{Quality: 80}); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	return fs.commitTemp(f, destPath)
 }
 
 func DetectMIME(file multipart.File) (string, error) {
@@ -187,8 +270,15 @@ func DetectMIME(file multipart.File) (string, error) {
 		return "", err
 	}
 	ct := http.DetectContentType(buf[:n])
-	ct = strings.Split(ct, ";")[0]
-	return strings.TrimSpace(ct), nil
+	ct = strings.TrimSpace(strings.Split(ct, ";")[0])
+	// Bare Opus and raw ADTS AAC, which the sniffer doesn't name
+	switch {
+	case ct == "application/ogg" && bytes.Contains(buf[:n], []byte("OpusHead")):
+		ct = "audio/opus"
+	case ct == "application/octet-stream" && isADTSHeader(buf[:n]):
+		ct = "audio/aac"
+	}
+	return ct, nil
 }
 
 func (fs *FileStore) IsVideoMIME(mime string) bool {
@@ -203,43 +293,7 @@ func (fs *FileStore) StoreVideo(file multipart.File, mimeType string) (string, e
 		return "", fmt.Errorf("unsupported video MIME type: %s", mimeType)
 	}
 
-	tmpFile, err := os.CreateTemp("", "video-*")
-	if err != nil {
-		return "", fmt.Errorf("create temp: %w", err)
-	}
-	defer os.Remove(tmpFile.Name())
-	defer tmpFile.Close()
-
-	hasher := sha256.New()
-	if _, err := io.Copy(io.MultiWriter(tmpFile, hasher), file); err != nil {
-		return "", fmt.Errorf("copy file: %w", err)
-	}
-
-	hash := fmt.Sprintf("%x", hasher.Sum(nil))
-
-	relDir := filepath.Join("uploads", hash[:2], hash[2:4])
-	absDir := filepath.Join(fs.DataDir, relDir)
-	if err := os.MkdirAll(absDir, 0755); err != nil {
-		return "", fmt.Errorf("create upload dir: %w", err)
-	}
-
-	relPath := filepath.Join(relDir, hash+ext)
-	absPath := filepath.Join(fs.DataDir, relPath)
-
-	if _, err := os.Stat(absPath); os.IsNotExist(err) {
-		tmpFile.Seek(0, 0)
-		dst, err := os.Create(absPath)
-		if err != nil {
-			return "", fmt.Errorf("create file: %w", err)
-		}
-		if _, err := io.Copy(dst, tmpFile); err != nil {
-			dst.Close()
-			return "", fmt.Errorf("write file: %w", err)
-		}
-		dst.Close()
-	}
-
-	return relPath, nil
+	return fs.saveUpload(file, ext)
 }
 
 func (fs *FileStore) IsAudioMIME(mime string) bool {
@@ -254,43 +308,7 @@ func (fs *FileStore) StoreAudio(file multipart.File, mimeType string) (string, e
 		return "", fmt.Errorf("unsupported audio MIME type: %s", mimeType)
 	}
 
-	tmpFile, err := os.CreateTemp("", "audio-*")
-	if err != nil {
-		return "", fmt.Errorf("create temp: %w", err)
-	}
-	defer os.Remove(tmpFile.Name())
-	defer tmpFile.Close()
-
-	hasher := sha256.New()
-	if _, err := io.Copy(io.MultiWriter(tmpFile, hasher), file); err != nil {
-		return "", fmt.Errorf("copy file: %w", err)
-	}
-
-	hash := fmt.Sprintf("%x", hasher.Sum(nil))
-
-	relDir := filepath.Join("uploads", hash[:2], hash[2:4])
-	absDir := filepath.Join(fs.DataDir, relDir)
-	if err := os.MkdirAll(absDir, 0755); err != nil {
-		return "", fmt.Errorf("create upload dir: %w", err)
-	}
-
-	relPath := filepath.Join(relDir, hash+ext)
-	absPath := filepath.Join(fs.DataDir, relPath)
-
-	if _, err := os.Stat(absPath); os.IsNotExist(err) {
-		tmpFile.Seek(0, 0)
-		dst, err := os.Create(absPath)
-		if err != nil {
-			return "", fmt.Errorf("create file: %w", err)
-		}
-		if _, err := io.Copy(dst, tmpFile); err != nil {
-			dst.Close()
-			return "", fmt.Errorf("write file: %w", err)
-		}
-		dst.Close()
-	}
-
-	return relPath, nil
+	return fs.saveUpload(file, ext)
 }
 
 func (fs *FileStore) RemoveFile(relPath string) error {
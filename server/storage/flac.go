@@ -0,0 +1,382 @@
+package storage
+
+import (
+	"bufio"
+	"io"
+	"math"
+)
+
+// flacBlockPeaks decodes a FLAC stream (fixed and LPC subframes, all
+// stereo decorrelation modes), taking the loudest channel of each sample.
+// Decoding stops at the first frame it can't parse, so trailing tags or a
+// truncated file still yield the frames before them. Returns nil if the
+// stream info is missing or no frame decodes. Checksums aren't verified.
+func flacBlockPeaks(r io.Reader) []float64 {
+	br := &bitReader{r: bufio.NewReaderSize(r, 64*1024)}
+	if br.bits(32) != 0x664C6143 { // "fLaC"
+		return nil
+	}
+
+	var sampleRate, bps int
+	for {
+		last := br.bits(1) == 1
+		blockType := br.bits(7)
+		length := int(br.bits(24))
+		if br.err != nil {
+			return nil
+		}
+		if blockType == 0 && length >= 34 { // STREAMINFO
+			br.bits(32) // min/max block size
+			br.bits(48) // min/max frame size
+			sampleRate = int(br.bits(20))
+			br.bits(3) // channels, repeated in every frame header
+			bps = int(br.bits(5)) + 1
+			br.bits(36) // total samples; the MD5 is skipped with the rest
+			length -= 18
+		}
+		if _, err := br.r.Discard(length); err != nil {
+			return nil
+		}
+		if last {
+			break
+		}
+	}
+	if sampleRate == 0 {
+		return nil
+	}
+
+	peaks := newBlockPeaks(sampleRate)
+	var chans [][]int64
+	decoded := false
+	for {
+		blockSize, channelMode, frameBPS, ok := flacFrameHeader(br, bps)
+		if !ok {
+			break
+		}
+		channels := channelMode + 1
+		if channelMode >= 8 {
+			channels = 2
+		}
+		for len(chans) < channels {
+			chans = append(chans, nil)
+		}
+		bad := false
+		for ch := 0; ch < channels && !bad; ch++ {
+			if cap(chans[ch]) < blockSize {
+				chans[ch] = make([]int64, blockSize)
+			}
+			chans[ch] = chans[ch][:blockSize]
+			sbps := frameBPS
+			// The side channel carries one extra bit
+			if (channelMode == 8 && ch == 1) || (channelMode == 9 && ch == 0) || (channelMode == 10 && ch == 1) {
+				sbps++
+			}
+			bad = !flacSubframe(br, chans[ch], sbps)
+		}
+		if bad {
+			break
+		}
+		br.align()
+		br.bits(16) // CRC-16
+		if br.err != nil {
+			break
+		}
+
+		flacDecorrelate(chans[:channels], channelMode)
+		scale := math.Ldexp(1, frameBPS-1)
+		for i := 0; i < blockSize; i++ {
+			var loudest int64
+			for ch := 0; ch < channels; ch++ {
+				v := chans[ch][i]
+				if v < 0 {
+					v = -v
+				}
+				if v > loudest {
+					loudest = v
+				}
+			}
+			peaks.add(float64(loudest) / scale)
+		}
+		decoded = true
+	}
+	if !decoded {
+		return nil
+	}
+	return peaks.done()
+}
+
+// flacFrameHeader parses a frame header, returning the block size, the
+// channel assignment (0-7 independent channels minus one, 8 left/side,
+// 9 side/right, 10 mid/side) and the sample size. ok is false at the end
+// of the stream or on anything that isn't a valid header.
+func flacFrameHeader(br *bitReader, streamBPS int) (blockSize, channelMode, bps int, ok bool) {
+	if br.bits(14) != 0x3FFE {
+		return 0, 0, 0, false
+	}
+	br.bits(2) // reserved, blocking strategy
+	sizeCode := br.bits(4)
+	rateCode := br.bits(4)
+	channelMode = int(br.bits(4))
+	bpsCode := br.bits(3)
+	br.bits(1) // reserved
+
+	// Frame or sample number, UTF-8 style: the leading ones of the first
+	// byte count the continuation bytes
+	first := br.bits(8)
+	for mask := uint64(0x80); first&mask != 0 && mask > 1; mask >>= 1 {
+		if mask != 0x80 {
+			br.bits(8)
+		}
+	}
+
+	switch {
+	case sizeCode == 1:
+		blockSize = 192
+	case sizeCode >= 2 && sizeCode <= 5:
+		blockSize = 576 << (sizeCode - 2)
+	case sizeCode == 6:
+		blockSize = int(br.bits(8)) + 1
+	case sizeCode == 7:
+		blockSize = int(br.bits(16)) + 1
+	case sizeCode >= 8:
+		blockSize = 256 << (sizeCode - 8)
+	default:
+		return 0, 0, 0, false
+	}
+	switch rateCode {
+	case 12:
+		br.bits(8)
+	case 13, 14:
+		br.bits(16)
+	case 15:
+		return 0, 0, 0, false
+	}
+	switch bpsCode {
+	case 0:
+		bps = streamBPS
+	case 1:
+		bps = 8
+	case 2:
+		bps = 12
+	case 4:
+		bps = 16
+	case 5:
+		bps = 20
+	case 6:
+		bps = 24
+	case 7:
+		bps = 32
+	default:
+		return 0, 0, 0, false
+	}
+	br.bits(8) // CRC-8
+
+	if br.err != nil || channelMode > 10 || bps < 4 {
+		return 0, 0, 0, false
+	}
+	return blockSize, channelMode, bps, true
+}
+
+// flacSubframe decodes one channel's subframe into out.
+func flacSubframe(br *bitReader, out []int64, bps int) bool {
+	br.bits(1) // padding
+	kind := int(br.bits(6))
+	if br.bits(1) == 1 {
+		wasted := int(br.unary()) + 1
+		bps -= wasted
+		defer func() {
+			for i := range out {
+				out[i] <<= wasted
+			}
+		}()
+	}
+	if bps <= 0 || br.err != nil {
+		return false
+	}
+
+	switch {
+	case kind == 0: // CONSTANT
+		v := br.signed(bps)
+		for i := range out {
+			out[i] = v
+		}
+	case kind == 1: // VERBATIM
+		for i := range out {
+			out[i] = br.signed(bps)
+		}
+	case kind >= 8 && kind <= 12: // FIXED
+		order := kind - 8
+		if order > len(out) {
+			return false
+		}
+		for i := 0; i < order; i++ {
+			out[i] = br.signed(bps)
+		}
+		if !flacResidual(br, out, order) {
+			return false
+		}
+		for i := order; i < len(out); i++ {
+			switch order {
+			case 1:
+				out[i] += out[i-1]
+			case 2:
+				out[i] += 2*out[i-1] - out[i-2]
+			case 3:
+				out[i] += 3*out[i-1] - 3*out[i-2] + out[i-3]
+			case 4:
+				out[i] += 4*out[i-1] - 6*out[i-2] + 4*out[i-3] - out[i-4]
+			}
+		}
+	case kind >= 32: // LPC
+		order := kind - 31
+		if order > len(out) {
+			return false
+		}
+		for i := 0; i < order; i++ {
+			out[i] = br.signed(bps)
+		}
+		precision := int(br.bits(4)) + 1
+		if precision == 16 {
+			return false
+		}
+		shift := br.signed(5)
+		if shift < 0 {
+			return false
+		}
+		coefs := make([]int64, order)
+		for i := range coefs {
+			coefs[i] = br.signed(precision)
+		}
+		if !flacResidual(br, out, order) {
+			return false
+		}
+		for i := order; i < len(out); i++ {
+			var sum int64
+			for j, c := range coefs {
+				sum += c * out[i-j-1]
+			}
+			out[i] += sum >> shift
+		}
+	default:
+		return false
+	}
+	return br.err == nil
+}
+
+// flacResidual reads Rice-coded residuals into out[order:].
+func flacResidual(br *bitReader, out []int64, order int) bool {
+	method := br.bits(2)
+	if method > 1 {
+		return false
+	}
+	paramBits, escape := uint(4), uint64(15)
+	if method == 1 {
+		paramBits, escape = 5, 31
+	}
+	partitionOrder := br.bits(4)
+	partitions := 1 << partitionOrder
+	perPartition := len(out) >> partitionOrder
+	if perPartition<<partitionOrder != len(out) || perPartition < order {
+		return false
+	}
+
+	i := order
+	for p := 0; p < partitions; p++ {
+		n := perPartition
+		if p == 0 {
+			n -= order
+		}
+		param := br.bits(paramBits)
+		if param == escape {
+			raw := int(br.bits(5))
+			for ; n > 0; n-- {
+				if raw == 0 {
+					out[i] = 0
+				} else {
+					out[i] = br.signed(raw)
+				}
+				i++
+			}
+		} else {
+			for ; n > 0; n-- {
+				v := br.unary()<<param | br.bits(uint(param))
+				out[i] = int64(v>>1) ^ -int64(v&1)
+				i++
+			}
+		}
+		if br.err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// flacDecorrelate undoes stereo decorrelation in place.
+func flacDecorrelate(chans [][]int64, channelMode int) {
+	if len(chans) != 2 {
+		return
+	}
+	a, b := chans[0], chans[1]
+	for i := range a {
+		switch channelMode {
+		case 8: // left, side
+			b[i] = a[i] - b[i]
+		case 9: // side, right
+			a[i] += b[i]
+		case 10: // mid, side
+			mid := a[i]<<1 | (b[i] & 1)
+			a[i] = (mid + b[i]) >> 1
+			b[i] = (mid - b[i]) >> 1
+		}
+	}
+}
+
+// bitReader reads big-endian bit fields. After the first read error every
+// read returns 0 and err stays set.
+type bitReader struct {
+	r   *bufio.Reader
+	buf uint64
+	n   uint // unread bits at the bottom of buf
+	err error
+}
+
+// bits reads n <= 56 bits.
+func (b *bitReader) bits(n uint) uint64 {
+	for b.n < n {
+		if b.err != nil {
+			return 0
+		}
+		c, err := b.r.ReadByte()
+		if err != nil {
+			b.err = err
+			return 0
+		}
+		b.buf = b.buf<<8 | uint64(c)
+		b.n += 8
+	}
+	b.n -= n
+	return b.buf >> b.n & (1<<n - 1)
+}
+
+// signed reads an n-bit two's complement value.
+func (b *bitReader) signed(n int) int64 {
+	v := int64(b.bits(uint(n)))
+	return v << (64 - n) >> (64 - n)
+}
+
+// unary counts zero bits up to the next one bit.
+func (b *bitReader) unary() uint64 {
+	var zeros uint64
+	for b.bits(1) == 0 {
+		if b.err != nil {
+			return 0
+		}
+		zeros++
+	}
+	return zeros
+}
+
+// align drops the rest of a partly read byte.
+func (b *bitReader) align() {
+	b.n -= b.n % 8
+}
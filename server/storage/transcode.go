@@ -0,0 +1,111 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// transcodeTimeout bounds one ffmpeg transcode; hour-long mixes take a
+// while even at many times realtime.
+const transcodeTimeout = 20 * time.Minute
+
+// transcodeFormat is how one --radio-transcode codec is encoded and stored.
+type transcodeFormat struct {
+	encoder  string   // ffmpeg audio encoder
+	muxer    string   // ffmpeg output format
+	mimeType string   // stored MIME type; its audioMIME extension names the file
+	already  []string // upload MIME types already in this codec
+}
+
+var transcodeFormats = map[string]transcodeFormat{
+	"opus": {"libopus", "ogg", "audio/opus", []string{"audio/opus"}},
+	"aac":  {"aac", "ipod", "audio/mp4", []string{"audio/mp4", "audio/x-m4a", "audio/aac"}},
+}
+
+// ValidTranscodeCodec reports whether codec is one TranscodeAudio can
+// produce.
+func ValidTranscodeCodec(codec string) bool {
+	_, ok := transcodeFormats[codec]
+	return ok
+}
+
+// NeedsTranscode reports whether an upload of mimeType should be
+// re-encoded to codec. Re-encoding a file already in the codec would only
+// lose quality.
+func NeedsTranscode(mimeType, codec string) bool {
+	format, ok := transcodeFormats[codec]
+	if !ok {
+		return false
+	}
+	for _, m := range format.already {
+		if m == mimeType {
+			return false
+		}
+	}
+	return true
+}
+
+// TranscodeAudio re-encodes the stored audio file at relPath to codec at
+// bitrate bits/s with ffmpeg, dropping any cover art, and stores the
+// result content-addressed like an upload. The original is left in place.
+// Returns the new file's data-dir-relative path, MIME type and size.
+func (fs *FileStore) TranscodeAudio(relPath, codec string, bitrate int) (string, string, int64, error) {
+	format, ok := transcodeFormats[codec]
+	if !ok {
+		return "", "", 0, fmt.Errorf("unsupported transcode codec: %s", codec)
+	}
+	bin, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return "", "", 0, fmt.Errorf("transcode: %w", err)
+	}
+
+	tmp, err := fs.createTemp("transcode-*")
+	if err != nil {
+		return "", "", 0, err
+	}
+	fail := func(err error) (string, string, int64, error) {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", "", 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), transcodeTimeout)
+	defer cancel()
+
+	args := []string{"-v", "error", "-nostdin", "-i", filepath.Join(fs.DataDir, relPath),
+		"-map", "0:a:0", "-vn", "-c:a", format.encoder, "-b:a", strconv.Itoa(bitrate)}
+	if format.muxer == "ipod" {
+		args = append(args, "-movflags", "+faststart")
+	}
+	args = append(args, "-f", format.muxer, "-y", tmp.Name())
+	cmd := exec.CommandContext(ctx, bin, args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fail(fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String())))
+	}
+
+	// ffmpeg rewrote the file behind our handle; hash what it left there
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, tmp)
+	if err != nil {
+		return fail(fmt.Errorf("read transcoded file: %w", err))
+	}
+	if size == 0 {
+		return fail(fmt.Errorf("ffmpeg produced no output"))
+	}
+	newPath, err := fs.placeUpload(tmp, fmt.Sprintf("%x", hasher.Sum(nil)), audioMIME[format.mimeType])
+	if err != nil {
+		return "", "", 0, err
+	}
+	return newPath, format.mimeType, size, nil
+}
@@ -0,0 +1,292 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// WaveformPeaks is how many peaks GetWaveform produces.
+const WaveformPeaks = 200
+
+// ffmpegSampleRate is what ffmpeg resamples to for peak extraction; peaks
+// don't need more.
+const ffmpegSampleRate = 8000
+
+// ffmpegTimeout bounds one ffmpeg decode.
+const ffmpegTimeout = 2 * time.Minute
+
+// GetWaveform returns an audio file's waveform as a JSON array of up to
+// WaveformPeaks ints in 0-100: the loudest sample in each slice of the
+// track, scaled against the loudest overall. WAV and FLAC are decoded
+// natively; other formats need ffmpeg on PATH. Returns nil if the file
+// can't be decoded.
+func (fs *FileStore) GetWaveform(relPath, mimeType string) *string {
+	absPath := filepath.Join(fs.DataDir, relPath)
+
+	var blocks []float64
+	switch mimeType {
+	case "audio/wav", "audio/flac":
+		f, err := os.Open(absPath)
+		if err != nil {
+			return nil
+		}
+		defer f.Close()
+		if mimeType == "audio/wav" {
+			blocks = wavBlockPeaks(f)
+		} else {
+			blocks = flacBlockPeaks(f)
+		}
+	default:
+		blocks = ffmpegBlockPeaks(absPath)
+	}
+
+	peaks := waveformPeaks(blocks, WaveformPeaks)
+	if peaks == nil {
+		return nil
+	}
+	b, err := json.Marshal(peaks)
+	if err != nil {
+		return nil
+	}
+	s := string(b)
+	return &s
+}
+
+// ValidWaveform reports whether s is a waveform in the format GetWaveform
+// produces: a JSON array of at most WaveformPeaks ints in 0-100.
+func ValidWaveform(s string) bool {
+	var peaks []int
+	if err := json.Unmarshal([]byte(s), &peaks); err != nil {
+		return false
+	}
+	if len(peaks) == 0 || len(peaks) > WaveformPeaks {
+		return false
+	}
+	for _, v := range peaks {
+		if v < 0 || v > 100 {
+			return false
+		}
+	}
+	return true
+}
+
+// blockPeaks keeps the loudest sample of each fixed-size block, so a track
+// of any length is held as one value per block until it's known how the
+// blocks divide into peaks.
+type blockPeaks struct {
+	size  int // samples per block
+	n     int // samples in the current block
+	cur   float64
+	peaks []float64
+}
+
+func newBlockPeaks(sampleRate int) *blockPeaks {
+	size := sampleRate / 100 // 10ms
+	if size < 1 {
+		size = 1
+	}
+	return &blockPeaks{size: size}
+}
+
+// add takes a sample in -1..1.
+func (b *blockPeaks) add(v float64) {
+	v = math.Abs(v)
+	if v > b.cur {
+		b.cur = v
+	}
+	b.n++
+	if b.n == b.size {
+		b.peaks = append(b.peaks, b.cur)
+		b.n, b.cur = 0, 0
+	}
+}
+
+func (b *blockPeaks) done() []float64 {
+	if b.n > 0 {
+		b.peaks = append(b.peaks, b.cur)
+		b.n, b.cur = 0, 0
+	}
+	return b.peaks
+}
+
+// waveformPeaks groups blocks into n peaks (fewer for very short tracks)
+// scaled to 0-100. A silent track is all zeros.
+func waveformPeaks(blocks []float64, n int) []int {
+	if len(blocks) == 0 {
+		return nil
+	}
+	if len(blocks) < n {
+		n = len(blocks)
+	}
+
+	maxes := make([]float64, n)
+	var loudest float64
+	for i := range maxes {
+		for _, v := range blocks[i*len(blocks)/n : (i+1)*len(blocks)/n] {
+			if v > maxes[i] {
+				maxes[i] = v
+			}
+		}
+		if maxes[i] > loudest {
+			loudest = maxes[i]
+		}
+	}
+
+	peaks := make([]int, n)
+	if loudest == 0 {
+		return peaks
+	}
+	for i, v := range maxes {
+		peaks[i] = int(math.Round(v / loudest * 100))
+	}
+	return peaks
+}
+
+// wavBlockPeaks decodes integer PCM (8/16/24/32-bit) or float (32/64-bit)
+// WAV data, taking the loudest channel of each frame. Returns nil for
+// other encodings.
+func wavBlockPeaks(r io.ReadSeeker) []float64 {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil
+	}
+
+	var format, channels, blockAlign, bits int
+	var sampleRate int
+	var chunkHeader [8]byte
+	for {
+		if _, err := io.ReadFull(r, chunkHeader[:]); err != nil {
+			return nil
+		}
+		chunkID := string(chunkHeader[0:4])
+		chunkSize := int64(binary.LittleEndian.Uint32(chunkHeader[4:8]))
+
+		switch chunkID {
+		case "fmt ":
+			if chunkSize < 16 {
+				return nil
+			}
+			// Only the first 40 bytes matter (extensible header included);
+			// skip the rest rather than trust the declared size
+			fmtData := make([]byte, min(chunkSize, 40))
+			if _, err := io.ReadFull(r, fmtData); err != nil {
+				return nil
+			}
+			if _, err := r.Seek(chunkSize-int64(len(fmtData))+chunkSize%2, io.SeekCurrent); err != nil {
+				return nil
+			}
+			format = int(binary.LittleEndian.Uint16(fmtData[0:2]))
+			channels = int(binary.LittleEndian.Uint16(fmtData[2:4]))
+			sampleRate = int(binary.LittleEndian.Uint32(fmtData[4:8]))
+			blockAlign = int(binary.LittleEndian.Uint16(fmtData[12:14]))
+			bits = int(binary.LittleEndian.Uint16(fmtData[14:16]))
+			// WAVE_FORMAT_EXTENSIBLE: the real format leads the subformat GUID
+			if format == 0xFFFE && chunkSize >= 26 {
+				format = int(binary.LittleEndian.Uint16(fmtData[24:26]))
+			}
+		case "data":
+			if channels == 0 || sampleRate == 0 {
+				return nil // no fmt chunk before data
+			}
+			sample := wavSampleDecoder(format, bits)
+			bytesPerSample := bits / 8
+			if sample == nil || blockAlign < channels*bytesPerSample {
+				return nil
+			}
+			return decodeWavFrames(io.LimitReader(r, chunkSize), sample, channels, bytesPerSample, blockAlign, sampleRate)
+		default:
+			if _, err := r.Seek(chunkSize+chunkSize%2, io.SeekCurrent); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+func decodeWavFrames(r io.Reader, sample func([]byte) float64, channels, bytesPerSample, blockAlign, sampleRate int) []float64 {
+	br := bufio.NewReaderSize(r, 64*1024)
+	frame := make([]byte, blockAlign)
+	peaks := newBlockPeaks(sampleRate)
+	for {
+		if _, err := io.ReadFull(br, frame); err != nil {
+			break
+		}
+		var loudest float64
+		for ch := 0; ch < channels; ch++ {
+			if v := math.Abs(sample(frame[ch*bytesPerSample:])); v > loudest {
+				loudest = v
+			}
+		}
+		peaks.add(loudest)
+	}
+	return peaks.done()
+}
+
+// wavSampleDecoder returns a func reading one sample as -1..1, or nil if
+// format/bits isn't supported.
+func wavSampleDecoder(format, bits int) func([]byte) float64 {
+	switch {
+	case format == 1 && bits == 8:
+		return func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }
+	case format == 1 && bits == 16:
+		return func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15) }
+	case format == 1 && bits == 24:
+		return func(b []byte) float64 {
+			v := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+			return float64(v) / (1 << 23)
+		}
+	case format == 1 && bits == 32:
+		return func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }
+	case format == 3 && bits == 32:
+		return func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	case format == 3 && bits == 64:
+		return func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }
+	}
+	return nil
+}
+
+// ffmpegBlockPeaks decodes any format ffmpeg understands to mono 16-bit
+// PCM. Returns nil if ffmpeg isn't installed or fails.
+func ffmpegBlockPeaks(absPath string) []float64 {
+	bin, err := exec.LookPath("ffmpeg")
+	if err != nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ffmpegTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, bin, "-v", "error", "-nostdin", "-i", absPath,
+		"-ac", "1", "-ar", strconv.Itoa(ffmpegSampleRate), "-f", "s16le", "-")
+	out, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil
+	}
+	if err := cmd.Start(); err != nil {
+		return nil
+	}
+
+	br := bufio.NewReaderSize(out, 64*1024)
+	peaks := newBlockPeaks(ffmpegSampleRate)
+	var s [2]byte
+	for {
+		if _, err := io.ReadFull(br, s[:]); err != nil {
+			break
+		}
+		peaks.add(float64(int16(binary.LittleEndian.Uint16(s[:]))) / (1 << 15))
+	}
+	if err := cmd.Wait(); err != nil {
+		return nil
+	}
+	return peaks.done()
+}
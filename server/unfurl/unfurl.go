@@ -48,6 +48,21 @@ func ExtractURLs(content string) []string {
 	return urls
 }
 
+// FindURLs returns the [start, end) byte offsets of every HTTP(S) URL in
+// content, with trailing punctuation excluded the same way ExtractURLs
+// strips it. Unlike ExtractURLs it keeps duplicates and has no limit.
+func FindURLs(content string) [][2]int {
+	var ranges [][2]int
+	for _, loc := range urlRegex.FindAllStringIndex(content, -1) {
+		end := loc[1]
+		for end-loc[0] > 1 && trailingPunct(content[end-1]) {
+			end--
+		}
+		ranges = append(ranges, [2]int{loc[0], end})
+	}
+	return ranges
+}
+
 func trailingPunct(b byte) bool {
 	switch b {
 	case '.', ',', ';', ':', '!', '?', ')', '>', ']':
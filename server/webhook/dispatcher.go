@@ -0,0 +1,251 @@
+// Package webhook delivers server events to admin-registered outgoing
+// webhooks.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kalman/voicechat/crypto"
+	"github.com/kalman/voicechat/db"
+)
+
+// SupportedEvents are the WebSocket events an outgoing webhook can
+// subscribe to.
+var SupportedEvents = []string{
+	"message_create",
+	"message_update",
+	"message_delete",
+	"user_online",
+	"user_offline",
+	"voice_state_update",
+}
+
+// IsSupportedEvent reports whether event can be subscribed to.
+func IsSupportedEvent(event string) bool {
+	for _, e := range SupportedEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// queueSize bounds undelivered events per webhook; past that, new
+	// events are dead-lettered instead of queued.
+	queueSize      = 256
+	requestTimeout = 10 * time.Second
+)
+
+// retryDelays are the waits before each retry; a delivery is attempted
+// len(retryDelays)+1 times before it is dead-lettered.
+var retryDelays = []time.Duration{1 * time.Second, 4 * time.Second, 16 * time.Second}
+
+// GenerateSecret returns a new random signing secret.
+func GenerateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the X-Webhook-Signature value for a delivery: an HMAC-SHA256
+// over "<timestamp>.<body>", so receivers can reject replays by checking
+// X-Webhook-Timestamp too.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+type delivery struct {
+	event string
+	body  []byte
+}
+
+type target struct {
+	hook   db.OutgoingWebhook
+	secret string
+	events map[string]bool
+	queue  chan delivery
+	stop   chan struct{}
+}
+
+// Dispatcher fans broadcast events out to outgoing webhooks. Each webhook
+// has its own queue and worker, so a slow or dead endpoint only delays
+// itself.
+type Dispatcher struct {
+	DB     *db.DB
+	encKey []byte
+	client *http.Client
+
+	mu      sync.RWMutex
+	targets map[string]*target // webhook ID → target
+}
+
+func NewDispatcher(database *db.DB, encKey []byte) *Dispatcher {
+	return &Dispatcher{
+		DB:      database,
+		encKey:  encKey,
+		client:  &http.Client{Timeout: requestTimeout},
+		targets: make(map[string]*target),
+	}
+}
+
+// Reload syncs the running workers with the outgoing_webhooks table. Call
+// it after webhooks are created or deleted.
+func (d *Dispatcher) Reload() error {
+	hooks, err := d.DB.ListOutgoingWebhooks()
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	current := make(map[string]bool, len(hooks))
+	for _, h := range hooks {
+		current[h.ID] = true
+		if _, running := d.targets[h.ID]; running {
+			continue
+		}
+		secret, err := crypto.Decrypt(d.encKey, h.SecretEnc)
+		if err != nil {
+			log.Printf("webhook %s: decrypt secret: %v", h.ID, err)
+			continue
+		}
+		t := &target{
+			hook:   h,
+			secret: secret,
+			events: make(map[string]bool, len(h.Events)),
+			queue:  make(chan delivery, queueSize),
+			stop:   make(chan struct{}),
+		}
+		for _, e := range h.Events {
+			t.events[e] = true
+		}
+		d.targets[h.ID] = t
+		go d.run(t)
+	}
+	for id, t := range d.targets {
+		if !current[id] {
+			close(t.stop)
+			delete(d.targets, id)
+		}
+	}
+	return nil
+}
+
+// Publish queues a WebSocket message ({op, d}) for every webhook
+// subscribed to its op. It never blocks.
+func (d *Dispatcher) Publish(msg []byte) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	if len(d.targets) == 0 {
+		return
+	}
+
+	var envelope struct {
+		Op string `json:"op"`
+	}
+	if err := json.Unmarshal(msg, &envelope); err != nil {
+		return
+	}
+	for _, t := range d.targets {
+		if !t.events[envelope.Op] {
+			continue
+		}
+		select {
+		case t.queue <- delivery{event: envelope.Op, body: msg}:
+		default:
+			go d.deadLetter(t, delivery{event: envelope.Op, body: msg}, 0, "queue full")
+		}
+	}
+}
+
+// Close stops every worker. Queued deliveries are dropped.
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for id, t := range d.targets {
+		close(t.stop)
+		delete(d.targets, id)
+	}
+}
+
+func (d *Dispatcher) run(t *target) {
+	for {
+		select {
+		case <-t.stop:
+			return
+		case del := <-t.queue:
+			d.deliver(t, del)
+		}
+	}
+}
+
+// deliver posts one event, retrying with backoff, and dead-letters it if
+// every attempt fails.
+func (d *Dispatcher) deliver(t *target, del delivery) {
+	id := uuid.New().String()
+	var lastErr error
+	for attempt := 0; attempt <= len(retryDelays); attempt++ {
+		if attempt > 0 {
+			select {
+			case <-t.stop:
+				return
+			case <-time.After(retryDelays[attempt-1]):
+			}
+		}
+		if lastErr = d.post(t, id, del); lastErr == nil {
+			return
+		}
+	}
+	d.deadLetter(t, del, len(retryDelays)+1, lastErr.Error())
+}
+
+func (d *Dispatcher) post(t *target, deliveryID string, del delivery) error {
+	req, err := http.NewRequest(http.MethodPost, t.hook.URL, bytes.NewReader(del.body))
+	if err != nil {
+		return err
+	}
+	ts := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "LeFauxPain-Webhook/1.0")
+	req.Header.Set("X-Webhook-Event", del.event)
+	req.Header.Set("X-Webhook-Delivery", deliveryID)
+	req.Header.Set("X-Webhook-Timestamp", ts)
+	req.Header.Set("X-Webhook-Signature", Sign(t.secret, ts, del.body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("endpoint returned %d", resp.StatusCode)
+	}
+	return nil
+}
+
+func (d *Dispatcher) deadLetter(t *target, del delivery, attempts int, reason string) {
+	log.Printf("webhook %s (%s): dropping %s after %d attempts: %s", t.hook.ID, t.hook.Name, del.event, attempts, reason)
+	if err := d.DB.RecordOutgoingWebhookFailure(t.hook.ID, del.event, string(del.body), reason, attempts); err != nil {
+		log.Printf("webhook %s: %v", t.hook.ID, err)
+	}
+}
@@ -1,11 +1,15 @@
 package ws
 
 import (
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"log"
 	"strings"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/kalman/voicechat/db"
 )
 
 // RadioApplet returns the applet definition for radio stations.
@@ -22,6 +26,15 @@ func RadioApplet() *AppletDef {
 			"rename_radio_station": func(h *Hub, c *Client, data json.RawMessage) {
 				h.handleRenameRadioStation(c, data)
 			},
+			"reorder_radio_stations": func(h *Hub, c *Client, data json.RawMessage) {
+				h.handleReorderRadioStations(c, data)
+			},
+			"favorite_station": func(h *Hub, c *Client, data json.RawMessage) {
+				h.handleFavoriteStation(c, data, true)
+			},
+			"unfavorite_station": func(h *Hub, c *Client, data json.RawMessage) {
+				h.handleFavoriteStation(c, data, false)
+			},
 			"add_radio_station_manager": func(h *Hub, c *Client, data json.RawMessage) {
 				h.handleAddRadioStationManager(c, data)
 			},
@@ -37,6 +50,9 @@ func RadioApplet() *AppletDef {
 			"reorder_radio_tracks": func(h *Hub, c *Client, data json.RawMessage) {
 				h.handleReorderRadioTracks(c, data)
 			},
+			"delete_radio_track": func(h *Hub, c *Client, data json.RawMessage) {
+				h.handleDeleteRadioTrack(c, data)
+			},
 			"radio_play": func(h *Hub, c *Client, data json.RawMessage) {
 				h.handleRadioPlay(c, data)
 			},
@@ -64,6 +80,12 @@ func RadioApplet() *AppletDef {
 			"set_radio_station_public_controls": func(h *Hub, c *Client, data json.RawMessage) {
 				h.handleSetRadioStationPublicControls(c, data)
 			},
+			"set_radio_station_volume": func(h *Hub, c *Client, data json.RawMessage) {
+				h.handleSetRadioStationVolume(c, data)
+			},
+			"set_radio_station_intro": func(h *Hub, c *Client, data json.RawMessage) {
+				h.handleSetRadioStationIntro(c, data)
+			},
 			"radio_tune": func(h *Hub, c *Client, data json.RawMessage) {
 				h.handleRadioTune(c, data)
 			},
@@ -95,6 +117,8 @@ func radioReadyContrib(h *Hub, c *Client) map[string]any {
 			Position:       s.Position,
 			PlaybackMode:   s.PlaybackMode,
 			PublicControls: s.PublicControls,
+			DefaultVolume:  s.DefaultVolume,
+			IntroTrackID:   s.IntroTrackID,
 			ManagerIDs:     mgrs,
 		}
 	}
@@ -105,6 +129,13 @@ func radioReadyContrib(h *Hub, c *Client) map[string]any {
 	// Radio listeners
 	radioListeners := h.GetAllRadioListeners()
 
+	// This user's favorite stations
+	radioFavorites, err := h.DB.GetRadioFavorites(c.UserID)
+	if err != nil {
+		log.Printf("ready: get radio favorites: %v", err)
+		radioFavorites = []string{}
+	}
+
 	// Radio playlists with tracks
 	dbPlaylists, _ := h.DB.GetAllPlaylists()
 	playlistPayloads := make([]RadioPlaylistPayload, len(dbPlaylists))
@@ -139,6 +170,7 @@ func radioReadyContrib(h *Hub, c *Client) map[string]any {
 		"radio_playback":  radioPlayback,
 		"radio_playlists": playlistPayloads,
 		"radio_listeners": radioListeners,
+		"radio_favorites": radioFavorites,
 	}
 }
 
@@ -154,6 +186,8 @@ type RadioStationUpdatePayload struct {
 	Name           string   `json:"name"`
 	PlaybackMode   string   `json:"playback_mode"`
 	PublicControls bool     `json:"public_controls"`
+	DefaultVolume  int      `json:"default_volume"`
+	IntroTrackID   *string  `json:"intro_track_id"`
 	ManagerIDs     []string `json:"manager_ids"`
 }
 
@@ -165,6 +199,22 @@ type DeleteRadioStationData struct {
 	StationID string `json:"station_id"`
 }
 
+type ReorderRadioStationsData struct {
+	StationIDs []string `json:"station_ids"`
+}
+
+type RadioStationReorderPayload struct {
+	StationIDs []string `json:"station_ids"`
+}
+
+type FavoriteStationData struct {
+	StationID string `json:"station_id"`
+}
+
+type RadioFavoritesPayload struct {
+	StationIDs []string `json:"station_ids"`
+}
+
 type RenameRadioStationData struct {
 	StationID string `json:"station_id"`
 	Name      string `json:"name"`
@@ -184,6 +234,10 @@ type ReorderRadioTracksData struct {
 	TrackIDs   []string `json:"track_ids"`
 }
 
+type DeleteRadioTrackData struct {
+	TrackID string `json:"track_id"`
+}
+
 type RadioPlayData struct {
 	StationID  string `json:"station_id"`
 	PlaylistID string `json:"playlist_id"`
@@ -208,9 +262,15 @@ type RadioStopData struct {
 }
 
 type RadioTrackEndedData struct {
-	StationID string `json:"station_id"`
+	StationID  string `json:"station_id"`
+	TrackIndex *int   `json:"track_index"` // the track that ended; omitted by older clients
 }
 
+// trackEndSlack is how far short of a track's duration the server's
+// position may be when a listener reports it ended (clocks and buffering
+// drift); anything earlier is a stale or spoofed report.
+const trackEndSlack = 3.0
+
 type SetRadioStationModeData struct {
 	StationID string `json:"station_id"`
 	Mode      string `json:"mode"`
@@ -221,6 +281,16 @@ type SetRadioStationPublicControlsData struct {
 	Enabled   bool   `json:"enabled"`
 }
 
+type SetRadioStationVolumeData struct {
+	StationID string `json:"station_id"`
+	Volume    int    `json:"volume"` // 0-100
+}
+
+type SetRadioStationIntroData struct {
+	StationID string  `json:"station_id"`
+	TrackID   *string `json:"track_id"` // null clears the intro
+}
+
 // --- Radio handler helpers ---
 
 func (h *Hub) canManageRadioStation(c *Client, stationID string) bool {
@@ -234,8 +304,18 @@ func (h *Hub) canManageRadioStation(c *Client, stationID string) bool {
 	return isManager
 }
 
+// canControlRadioPlayback reports whether c may start, pause, resume,
+// seek, skip or stop playback: station managers and admins always, and
+// anyone tuned in to the station while it has public controls on.
 func (h *Hub) canControlRadioPlayback(c *Client, stationID string) bool {
-	return true
+	if h.canManageRadioStation(c, stationID) {
+		return true
+	}
+	station, err := h.DB.GetRadioStationByID(stationID)
+	if err != nil || station == nil || !station.PublicControls {
+		return false
+	}
+	return h.IsRadioListener(stationID, c.UserID)
 }
 
 // --- Radio handlers ---
@@ -259,12 +339,13 @@ func (h *Hub) handleCreateRadioStation(c *Client, data json.RawMessage) {
 	}
 
 	broadcast, _ := NewMessage("radio_station_create", RadioStationPayload{
-		ID:           station.ID,
-		Name:         station.Name,
-		CreatedBy:    station.CreatedBy,
-		Position:     station.Position,
-		PlaybackMode: "play_all",
-		ManagerIDs:   []string{c.UserID},
+		ID:            station.ID,
+		Name:          station.Name,
+		CreatedBy:     station.CreatedBy,
+		Position:      station.Position,
+		PlaybackMode:  "play_all",
+		DefaultVolume: station.DefaultVolume,
+		ManagerIDs:    []string{c.UserID},
 	})
 	h.BroadcastAll(broadcast)
 }
@@ -296,6 +377,69 @@ func (h *Hub) handleDeleteRadioStation(c *Client, data json.RawMessage) {
 	h.BroadcastAll(broadcast)
 }
 
+func (h *Hub) handleReorderRadioStations(c *Client, data json.RawMessage) {
+	if !c.User.IsAdmin {
+		return
+	}
+
+	var d ReorderRadioStationsData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return
+	}
+
+	if err := h.DB.ReorderRadioStations(d.StationIDs); err != nil {
+		log.Printf("reorder radio stations: %v", err)
+		return
+	}
+
+	broadcast, _ := NewMessage("radio_station_reorder", RadioStationReorderPayload{
+		StationIDs: d.StationIDs,
+	})
+	h.BroadcastAll(broadcast)
+}
+
+// handleFavoriteStation updates the user's favorites. Favorites are
+// private, so the new list goes only to the user's own connections.
+func (h *Hub) handleFavoriteStation(c *Client, data json.RawMessage, favorite bool) {
+	op := "unfavorite_station"
+	if favorite {
+		op = "favorite_station"
+	}
+	var d FavoriteStationData
+	if err := json.Unmarshal(data, &d); err != nil || d.StationID == "" {
+		return
+	}
+
+	if favorite {
+		if _, err := h.DB.GetRadioStationByID(d.StationID); errors.Is(err, sql.ErrNoRows) {
+			c.sendError(op, ErrCodeNotFound, "station not found")
+			return
+		} else if err != nil {
+			log.Printf("favorite station: get station: %v", err)
+			c.sendError(op, ErrCodeInternal, "failed to favorite station")
+			return
+		}
+		if err := h.DB.AddRadioFavorite(c.UserID, d.StationID); err != nil {
+			log.Printf("favorite station: %v", err)
+			c.sendError(op, ErrCodeInternal, "failed to favorite station")
+			return
+		}
+	} else if err := h.DB.RemoveRadioFavorite(c.UserID, d.StationID); err != nil {
+		log.Printf("unfavorite station: %v", err)
+		c.sendError(op, ErrCodeInternal, "failed to unfavorite station")
+		return
+	}
+
+	ids, err := h.DB.GetRadioFavorites(c.UserID)
+	if err != nil {
+		log.Printf("get radio favorites: %v", err)
+		c.sendError(op, ErrCodeInternal, "failed to load favorites")
+		return
+	}
+	msg, _ := NewMessage("radio_favorites", RadioFavoritesPayload{StationIDs: ids})
+	h.SendTo(c.UserID, msg)
+}
+
 func (h *Hub) handleRenameRadioStation(c *Client, data json.RawMessage) {
 	var d RenameRadioStationData
 	if err := json.Unmarshal(data, &d); err != nil {
@@ -331,6 +475,8 @@ func (h *Hub) handleRenameRadioStation(c *Client, data json.RawMessage) {
 		Name:           name,
 		PlaybackMode:   station.PlaybackMode,
 		PublicControls: station.PublicControls,
+		DefaultVolume:  station.DefaultVolume,
+		IntroTrackID:   station.IntroTrackID,
 		ManagerIDs:     managerIDs,
 	})
 	h.BroadcastAll(broadcast)
@@ -421,6 +567,165 @@ func (h *Hub) handleReorderRadioTracks(c *Client, data json.RawMessage) {
 	h.sendPlaylistTracks(c, d.PlaylistID)
 }
 
+func (h *Hub) handleDeleteRadioTrack(c *Client, data json.RawMessage) {
+	var d DeleteRadioTrackData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return
+	}
+
+	track, err := h.DB.GetTrackByID(d.TrackID)
+	if err != nil || track == nil {
+		return
+	}
+	playlist, err := h.DB.GetPlaylistByID(track.PlaylistID)
+	if err != nil || playlist == nil || playlist.UserID != c.UserID {
+		return
+	}
+
+	if err := h.DeleteRadioTrack(track); err != nil {
+		log.Printf("delete radio track: %v", err)
+	}
+}
+
+// DeleteRadioTrack removes a track and its files, moves on any station
+// that was playing it, and sends everyone the playlist's new track list.
+func (h *Hub) DeleteRadioTrack(track *db.RadioTrack) error {
+	if err := h.DB.DeleteRadioTrack(track.ID); err != nil {
+		return err
+	}
+	if h.Store != nil {
+		// Identical uploads share one file; keep any another row uses
+		if inUse, err := h.DB.FileInUse(track.Path); err == nil && !inUse {
+			if err := h.Store.RemoveFile(track.Path); err != nil {
+				log.Printf("remove radio track file %s: %v", track.Path, err)
+			}
+		}
+		if track.OriginalPath != nil {
+			if inUse, err := h.DB.FileInUse(*track.OriginalPath); err == nil && !inUse {
+				h.Store.RemoveFile(*track.OriginalPath)
+			}
+		}
+	}
+
+	h.resyncPlaybackAfterTrackDelete(track.PlaylistID, track.ID)
+	h.BroadcastPlaylistTracks(track.PlaylistID)
+	return nil
+}
+
+// resyncPlaybackAfterTrackDelete refreshes the cached track list of every
+// station playing the playlist. A station that was playing the deleted
+// track, or playing it as its intro, moves on as if the track had ended.
+func (h *Hub) resyncPlaybackAfterTrackDelete(playlistID, trackID string) {
+	tracks := h.buildTrackPayloads(playlistID)
+
+	type advance struct {
+		stationID string
+		userID    string
+		index     int
+		playing   bool
+	}
+	var advances []advance
+	var skippedIntros []string
+
+	h.radioMu.Lock()
+	for sid, state := range h.radioPlayback {
+		skippedIntro := state.Intro != nil && state.Intro.ID == trackID
+		if skippedIntro {
+			state.Intro = nil
+			state.TrackIndex = 0
+			state.Position = 0
+			state.UpdatedAt = nowUnix()
+		}
+		if state.PlaylistID != playlistID {
+			if skippedIntro {
+				skippedIntros = append(skippedIntros, sid)
+			}
+			continue
+		}
+		deleted := -1
+		for i, t := range state.Tracks {
+			if t.ID == trackID {
+				deleted = i
+				break
+			}
+		}
+		state.Tracks = tracks
+		switch {
+		case deleted < 0 || deleted > state.TrackIndex:
+			// Not played yet; the new list is all that changes
+			if skippedIntro {
+				skippedIntros = append(skippedIntros, sid)
+			}
+		case deleted < state.TrackIndex:
+			state.TrackIndex--
+		default:
+			advances = append(advances, advance{sid, state.UserID, deleted, state.Playing})
+		}
+	}
+	h.radioMu.Unlock()
+
+	for _, sid := range skippedIntros {
+		state := h.GetRadioPlayback(sid)
+		if state == nil || len(state.Tracks) == 0 {
+			continue
+		}
+		msg, _ := NewMessage("radio_playback", &RadioPlaybackPayload{
+			StationID:  sid,
+			PlaylistID: state.PlaylistID,
+			TrackIndex: 0,
+			Track:      state.Tracks[0],
+			Playing:    state.Playing,
+			Position:   0,
+			UpdatedAt:  state.UpdatedAt,
+			UserID:     state.UserID,
+		})
+		h.BroadcastToRadioListeners(sid, msg)
+		h.BroadcastRadioStatus(sid, state.Playing, state.Tracks[0].Filename, state.UserID)
+	}
+
+	for _, a := range advances {
+		// The next track slid into the deleted one's slot; a paused
+		// station stays paused on it
+		if a.index < len(tracks) {
+			state := &RadioPlaybackState{
+				StationID:  a.stationID,
+				PlaylistID: playlistID,
+				TrackIndex: a.index,
+				Playing:    a.playing,
+				Position:   0,
+				UpdatedAt:  nowUnix(),
+				UserID:     a.userID,
+				Tracks:     tracks,
+			}
+			h.SetRadioPlayback(a.stationID, state)
+			msg, _ := NewMessage("radio_playback", &RadioPlaybackPayload{
+				StationID:  a.stationID,
+				PlaylistID: playlistID,
+				TrackIndex: a.index,
+				Track:      tracks[a.index],
+				Playing:    a.playing,
+				Position:   0,
+				UpdatedAt:  state.UpdatedAt,
+				UserID:     a.userID,
+			})
+			h.BroadcastToRadioListeners(a.stationID, msg)
+			h.BroadcastRadioStatus(a.stationID, a.playing, tracks[a.index].Filename, a.userID)
+			continue
+		}
+
+		// It was the last track — same as the playlist finishing
+		station, err := h.DB.GetRadioStationByID(a.stationID)
+		if err != nil || station == nil {
+			h.ClearRadioPlayback(a.stationID)
+			msg, _ := NewMessage("radio_playback", map[string]interface{}{"station_id": a.stationID, "stopped": true})
+			h.BroadcastToRadioListeners(a.stationID, msg)
+			h.BroadcastRadioStopped(a.stationID)
+			continue
+		}
+		h.advancePlaybackMode(a.stationID, playlistID, a.userID, station.PlaybackMode)
+	}
+}
+
 func (h *Hub) sendPlaylistTracks(c *Client, playlistID string) {
 	tracks, err := h.DB.GetTracksByPlaylist(playlistID)
 	if err != nil {
@@ -428,14 +733,7 @@ func (h *Hub) sendPlaylistTracks(c *Client, playlistID string) {
 	}
 	trackPayloads := make([]RadioTrackPayload, len(tracks))
 	for i, t := range tracks {
-		trackPayloads[i] = RadioTrackPayload{
-			ID:       t.ID,
-			Filename: t.Filename,
-			URL:      "/" + strings.ReplaceAll(t.Path, "\\", "/"),
-			Duration: t.Duration,
-			Position: t.Position,
-			Waveform: t.Waveform,
-		}
+		trackPayloads[i] = radioTrackPayload(t)
 	}
 	reply, _ := NewMessage("radio_playlist_tracks", map[string]interface{}{
 		"playlist_id": playlistID,
@@ -444,6 +742,12 @@ func (h *Hub) sendPlaylistTracks(c *Client, playlistID string) {
 	h.BroadcastAll(reply)
 }
 
+// BroadcastPlaylistTracks sends everyone a playlist's current track list,
+// for changes made outside the WebSocket ops.
+func (h *Hub) BroadcastPlaylistTracks(playlistID string) {
+	h.sendPlaylistTracks(nil, playlistID)
+}
+
 func (h *Hub) buildTrackPayloads(playlistID string) []RadioTrackPayload {
 	tracks, err := h.DB.GetTracksByPlaylist(playlistID)
 	if err != nil {
@@ -451,18 +755,22 @@ func (h *Hub) buildTrackPayloads(playlistID string) []RadioTrackPayload {
 	}
 	payloads := make([]RadioTrackPayload, len(tracks))
 	for i, t := range tracks {
-		payloads[i] = RadioTrackPayload{
-			ID:       t.ID,
-			Filename: t.Filename,
-			URL:      "/" + strings.ReplaceAll(t.Path, "\\", "/"),
-			Duration: t.Duration,
-			Position: t.Position,
-			Waveform: t.Waveform,
-		}
+		payloads[i] = radioTrackPayload(t)
 	}
 	return payloads
 }
 
+func radioTrackPayload(t db.RadioTrack) RadioTrackPayload {
+	return RadioTrackPayload{
+		ID:       t.ID,
+		Filename: t.Filename,
+		URL:      "/" + strings.ReplaceAll(t.Path, "\\", "/"),
+		Duration: t.Duration,
+		Position: t.Position,
+		Waveform: t.Waveform,
+	}
+}
+
 func (h *Hub) handleRadioPlay(c *Client, data json.RawMessage) {
 	var d RadioPlayData
 	if err := json.Unmarshal(data, &d); err != nil {
@@ -470,11 +778,12 @@ func (h *Hub) handleRadioPlay(c *Client, data json.RawMessage) {
 	}
 
 	if !h.canControlRadioPlayback(c, d.StationID) {
+		c.sendError("radio_play", ErrCodeDenied, "not allowed to control this station")
 		return
 	}
 
 	// Verify station exists
-	_, err := h.DB.GetRadioStationByID(d.StationID)
+	station, err := h.DB.GetRadioStationByID(d.StationID)
 	if err != nil {
 		return
 	}
@@ -501,20 +810,31 @@ func (h *Hub) handleRadioPlay(c *Client, data json.RawMessage) {
 		UserID:     c.UserID,
 		Tracks:     trackPayloads,
 	}
+	// The intro plays once, ahead of the playlist; loops and playlist
+	// changes start at track 0 without it
+	if station.IntroTrackID != nil {
+		if intro, err := h.DB.GetTrackByID(*station.IntroTrackID); err == nil {
+			p := radioTrackPayload(*intro)
+			state.Intro = &p
+			state.TrackIndex = -1
+		}
+	}
 	h.SetRadioPlayback(d.StationID, state)
 
+	track := state.current()
 	msg, _ := NewMessage("radio_playback", &RadioPlaybackPayload{
 		StationID:  d.StationID,
 		PlaylistID: d.PlaylistID,
-		TrackIndex: 0,
-		Track:      trackPayloads[0],
+		TrackIndex: state.TrackIndex,
+		Track:      track,
 		Playing:    true,
 		Position:   0,
 		UpdatedAt:  state.UpdatedAt,
 		UserID:     c.UserID,
+		Intro:      state.Intro != nil,
 	})
 	h.BroadcastToRadioListeners(d.StationID, msg)
-	h.BroadcastRadioStatus(d.StationID, true, trackPayloads[0].Filename, c.UserID)
+	h.BroadcastRadioStatus(d.StationID, true, track.Filename, c.UserID)
 }
 
 func (h *Hub) handleRadioPause(c *Client, data json.RawMessage) {
@@ -524,6 +844,7 @@ func (h *Hub) handleRadioPause(c *Client, data json.RawMessage) {
 	}
 
 	if !h.canControlRadioPlayback(c, d.StationID) {
+		c.sendError("radio_pause", ErrCodeDenied, "not allowed to control this station")
 		return
 	}
 
@@ -538,10 +859,7 @@ func (h *Hub) handleRadioPause(c *Client, data json.RawMessage) {
 	state.UpdatedAt = nowUnix()
 	h.radioMu.Unlock()
 
-	var track RadioTrackPayload
-	if state.TrackIndex >= 0 && state.TrackIndex < len(state.Tracks) {
-		track = state.Tracks[state.TrackIndex]
-	}
+	track := state.current()
 
 	msg, _ := NewMessage("radio_playback", &RadioPlaybackPayload{
 		StationID:  state.StationID,
@@ -552,6 +870,7 @@ func (h *Hub) handleRadioPause(c *Client, data json.RawMessage) {
 		Position:   state.Position,
 		UpdatedAt:  state.UpdatedAt,
 		UserID:     state.UserID,
+		Intro:      state.Intro != nil,
 	})
 	h.BroadcastToRadioListeners(state.StationID, msg)
 	h.BroadcastRadioStatus(state.StationID, false, track.Filename, state.UserID)
@@ -566,6 +885,7 @@ func (h *Hub) handleRadioResume(c *Client, data json.RawMessage) {
 	}
 
 	if !h.canControlRadioPlayback(c, d.StationID) {
+		c.sendError("radio_resume", ErrCodeDenied, "not allowed to control this station")
 		return
 	}
 
@@ -579,10 +899,7 @@ func (h *Hub) handleRadioResume(c *Client, data json.RawMessage) {
 	state.UpdatedAt = nowUnix()
 	h.radioMu.Unlock()
 
-	var track RadioTrackPayload
-	if state.TrackIndex >= 0 && state.TrackIndex < len(state.Tracks) {
-		track = state.Tracks[state.TrackIndex]
-	}
+	track := state.current()
 
 	msg, _ := NewMessage("radio_playback", &RadioPlaybackPayload{
 		StationID:  state.StationID,
@@ -593,6 +910,7 @@ func (h *Hub) handleRadioResume(c *Client, data json.RawMessage) {
 		Position:   state.Position,
 		UpdatedAt:  state.UpdatedAt,
 		UserID:     state.UserID,
+		Intro:      state.Intro != nil,
 	})
 	h.BroadcastToRadioListeners(state.StationID, msg)
 	h.BroadcastRadioStatus(state.StationID, true, track.Filename, state.UserID)
@@ -605,6 +923,7 @@ func (h *Hub) handleRadioSeek(c *Client, data json.RawMessage) {
 	}
 
 	if !h.canControlRadioPlayback(c, d.StationID) {
+		c.sendError("radio_seek", ErrCodeDenied, "not allowed to control this station")
 		return
 	}
 
@@ -618,10 +937,7 @@ func (h *Hub) handleRadioSeek(c *Client, data json.RawMessage) {
 	state.UpdatedAt = nowUnix()
 	h.radioMu.Unlock()
 
-	var track RadioTrackPayload
-	if state.TrackIndex >= 0 && state.TrackIndex < len(state.Tracks) {
-		track = state.Tracks[state.TrackIndex]
-	}
+	track := state.current()
 
 	msg, _ := NewMessage("radio_playback", &RadioPlaybackPayload{
 		StationID:  state.StationID,
@@ -632,6 +948,7 @@ func (h *Hub) handleRadioSeek(c *Client, data json.RawMessage) {
 		Position:   state.Position,
 		UpdatedAt:  state.UpdatedAt,
 		UserID:     state.UserID,
+		Intro:      state.Intro != nil,
 	})
 	h.BroadcastToRadioListeners(state.StationID, msg)
 }
@@ -643,6 +960,7 @@ func (h *Hub) handleRadioNext(c *Client, data json.RawMessage) {
 	}
 
 	if !h.canControlRadioPlayback(c, d.StationID) {
+		c.sendError("radio_next", ErrCodeDenied, "not allowed to control this station")
 		return
 	}
 
@@ -656,6 +974,7 @@ func (h *Hub) handleRadioNext(c *Client, data json.RawMessage) {
 	if nextIndex < len(state.Tracks) {
 		// More tracks in current playlist
 		state.TrackIndex = nextIndex
+		state.Intro = nil
 		state.Position = 0
 		state.Playing = true
 		state.UpdatedAt = nowUnix()
@@ -701,6 +1020,7 @@ func (h *Hub) handleRadioStop(c *Client, data json.RawMessage) {
 	}
 
 	if !h.canControlRadioPlayback(c, d.StationID) {
+		c.sendError("radio_stop", ErrCodeDenied, "not allowed to control this station")
 		return
 	}
 
@@ -721,9 +1041,26 @@ func (h *Hub) handleRadioTrackEnded(c *Client, data json.RawMessage) {
 		return
 	}
 
+	// Every listener reports the end of the track; only someone tuned in
+	// (or who could skip anyway) counts
+	if !h.IsRadioListener(d.StationID, c.UserID) && !h.canManageRadioStation(c, d.StationID) {
+		return
+	}
+
 	h.radioMu.Lock()
 	state := h.radioPlayback[d.StationID]
-	if state == nil {
+	if state == nil || !state.Playing {
+		h.radioMu.Unlock()
+		return
+	}
+	// The first report advances the station; the rest refer to a track
+	// that's no longer current and are dropped
+	if d.TrackIndex != nil && *d.TrackIndex != state.TrackIndex {
+		h.radioMu.Unlock()
+		return
+	}
+	if dur := state.current().Duration; dur > 0 &&
+		state.Position+(nowUnix()-state.UpdatedAt) < dur-trackEndSlack {
 		h.radioMu.Unlock()
 		return
 	}
@@ -732,6 +1069,7 @@ func (h *Hub) handleRadioTrackEnded(c *Client, data json.RawMessage) {
 	if nextIndex < len(state.Tracks) {
 		// More tracks in current playlist — advance
 		state.TrackIndex = nextIndex
+		state.Intro = nil
 		state.Position = 0
 		state.Playing = true
 		state.UpdatedAt = nowUnix()
@@ -934,6 +1272,8 @@ func (h *Hub) handleAddRadioStationManager(c *Client, data json.RawMessage) {
 		Name:           station.Name,
 		PlaybackMode:   station.PlaybackMode,
 		PublicControls: station.PublicControls,
+		DefaultVolume:  station.DefaultVolume,
+		IntroTrackID:   station.IntroTrackID,
 		ManagerIDs:     managerIDs,
 	})
 	h.BroadcastAll(broadcast)
@@ -975,6 +1315,8 @@ func (h *Hub) handleRemoveRadioStationManager(c *Client, data json.RawMessage) {
 		Name:           station.Name,
 		PlaybackMode:   station.PlaybackMode,
 		PublicControls: station.PublicControls,
+		DefaultVolume:  station.DefaultVolume,
+		IntroTrackID:   station.IntroTrackID,
 		ManagerIDs:     managerIDs,
 	})
 	h.BroadcastAll(broadcast)
@@ -1017,6 +1359,8 @@ func (h *Hub) handleSetRadioStationMode(c *Client, data json.RawMessage) {
 		Name:           station.Name,
 		PlaybackMode:   d.Mode,
 		PublicControls: station.PublicControls,
+		DefaultVolume:  station.DefaultVolume,
+		IntroTrackID:   station.IntroTrackID,
 		ManagerIDs:     managerIDs,
 	})
 	h.BroadcastAll(broadcast)
@@ -1052,6 +1396,104 @@ func (h *Hub) handleSetRadioStationPublicControls(c *Client, data json.RawMessag
 		Name:           station.Name,
 		PlaybackMode:   station.PlaybackMode,
 		PublicControls: d.Enabled,
+		DefaultVolume:  station.DefaultVolume,
+		IntroTrackID:   station.IntroTrackID,
+		ManagerIDs:     managerIDs,
+	})
+	h.BroadcastAll(broadcast)
+}
+
+func (h *Hub) handleSetRadioStationVolume(c *Client, data json.RawMessage) {
+	var d SetRadioStationVolumeData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return
+	}
+
+	if d.Volume < 0 || d.Volume > 100 {
+		c.sendError("set_radio_station_volume", ErrCodeInvalid, "volume must be 0-100")
+		return
+	}
+
+	if !h.canManageRadioStation(c, d.StationID) {
+		return
+	}
+
+	station, err := h.DB.GetRadioStationByID(d.StationID)
+	if err != nil || station == nil {
+		return
+	}
+
+	if err := h.DB.UpdateRadioStationDefaultVolume(d.StationID, d.Volume); err != nil {
+		log.Printf("update radio station default volume: %v", err)
+		return
+	}
+
+	managerIDs, _ := h.DB.GetRadioStationManagers(d.StationID)
+	if managerIDs == nil {
+		managerIDs = []string{}
+	}
+
+	broadcast, _ := NewMessage("radio_station_update", RadioStationUpdatePayload{
+		ID:             station.ID,
+		Name:           station.Name,
+		PlaybackMode:   station.PlaybackMode,
+		PublicControls: station.PublicControls,
+		DefaultVolume:  d.Volume,
+		IntroTrackID:   station.IntroTrackID,
+		ManagerIDs:     managerIDs,
+	})
+	h.BroadcastAll(broadcast)
+}
+
+// handleSetRadioStationIntro sets or clears the track played before the
+// first playlist track when the station starts. The track has to be on one
+// of the station's playlists or one of the caller's own.
+func (h *Hub) handleSetRadioStationIntro(c *Client, data json.RawMessage) {
+	var d SetRadioStationIntroData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return
+	}
+
+	if !h.canManageRadioStation(c, d.StationID) {
+		return
+	}
+
+	station, err := h.DB.GetRadioStationByID(d.StationID)
+	if err != nil || station == nil {
+		return
+	}
+
+	if d.TrackID != nil {
+		track, err := h.DB.GetTrackByID(*d.TrackID)
+		if err != nil || track == nil {
+			c.sendError("set_radio_station_intro", ErrCodeNotFound, "track not found")
+			return
+		}
+		playlist, err := h.DB.GetPlaylistByID(track.PlaylistID)
+		if err != nil || playlist == nil ||
+			(playlist.UserID != c.UserID && (playlist.StationID == nil || *playlist.StationID != d.StationID)) {
+			c.sendError("set_radio_station_intro", ErrCodeDenied, "track is not on this station or your own playlists")
+			return
+		}
+	}
+
+	if err := h.DB.UpdateRadioStationIntro(d.StationID, d.TrackID); err != nil {
+		log.Printf("update radio station intro: %v", err)
+		return
+	}
+
+	managerIDs, _ := h.DB.GetRadioStationManagers(d.StationID)
+	if managerIDs == nil {
+		managerIDs = []string{}
+	}
+
+	broadcast, _ := NewMessage("radio_station_update", RadioStationUpdatePayload{
+		ID:             station.ID,
+		Name:           station.Name,
+		PlaybackMode:   station.PlaybackMode,
+		PublicControls: station.PublicControls,
+		DefaultVolume:  station.DefaultVolume,
+		IntroTrackID:   d.TrackID,
 		ManagerIDs:     managerIDs,
 	})
 	h.BroadcastAll(broadcast)
@@ -1092,3 +1534,53 @@ func (h *Hub) getNextPlaylistTracks(stationID, currentPlaylistID string, wrap bo
 	}
 	return "", nil, false
 }
+
+func (h *Hub) radioPositionLoop() {
+	ticker := time.NewTicker(h.RadioSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-ticker.C:
+			h.syncRadioPositions()
+		}
+	}
+}
+
+// syncRadioPositions advances every playing station's Position to now and
+// sends it to the station's listeners, so late joiners and long sessions
+// don't drift from a stale UpdatedAt. Positions stop at the end of the
+// track; moving to the next one is still up to the client's radio_next.
+func (h *Hub) syncRadioPositions() {
+	now := nowUnix()
+	var updates []RadioPositionPayload
+
+	h.radioMu.Lock()
+	for sid, state := range h.radioPlayback {
+		if !state.Playing {
+			continue
+		}
+		pos := state.Position + (now - state.UpdatedAt)
+		if d := state.current().Duration; d > 0 && pos > d {
+			pos = d
+		}
+		state.Position = pos
+		state.UpdatedAt = now
+		updates = append(updates, RadioPositionPayload{
+			StationID:  sid,
+			TrackIndex: state.TrackIndex,
+			Position:   pos,
+			UpdatedAt:  now,
+		})
+	}
+	h.radioMu.Unlock()
+
+	for _, u := range updates {
+		msg, err := NewMessage("radio_position", u)
+		if err != nil {
+			continue
+		}
+		h.BroadcastToRadioListeners(u.StationID, msg)
+	}
+}
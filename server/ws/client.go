@@ -4,7 +4,9 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
+	"sync/atomic"
 	"time"
 
 	"github.com/kalman/voicechat/db"
@@ -13,9 +15,16 @@ import (
 )
 
 const (
-	authTimeout  = 5 * time.Second
-	pingInterval = 30 * time.Second
-	sendBufSize  = 256
+	authTimeout = 5 * time.Second
+	sendBufSize = 256
+
+	// oversizeDiscardFactor bounds how much of an oversized message is
+	// read off the wire and thrown away (this many times MaxMessageBytes)
+	// before the connection is closed instead.
+	oversizeDiscardFactor = 16
+
+	// readyUsersPageSize is how many members ready includes in all_users
+	readyUsersPageSize = 100
 )
 
 type Client struct {
@@ -25,10 +34,36 @@ type Client struct {
 	ctx    context.Context
 	cancel context.CancelFunc
 
+	// lagging is set once the send buffer overflows; the client is being
+	// force-closed and further messages are dropped.
+	lagging atomic.Bool
+
+	// ready is the pending ready event, queued by the hub on register so
+	// nothing broadcast after the client is visible can arrive before it.
+	ready []byte
+
+	// viewing is the channel this connection last reported via
+	// view_channel; nil until the client reports one.
+	viewing atomic.Pointer[string]
+
 	UserID string
 	User   *db.User
 }
 
+// Viewing returns the channel this connection is looking at and whether
+// the client has ever reported one.
+func (c *Client) Viewing() (channelID string, reported bool) {
+	p := c.viewing.Load()
+	if p == nil {
+		return "", false
+	}
+	return *p, true
+}
+
+func (c *Client) setViewing(channelID string) {
+	c.viewing.Store(&channelID)
+}
+
 func (c *Client) readPump() {
 	defer func() {
 		if c.User != nil {
@@ -47,15 +82,21 @@ func (c *Client) readPump() {
 	c.UserID = user.ID
 	c.User = user
 
-	// Send ready event
-	if err := c.sendReady(); err != nil {
-		log.Printf("ws send ready: %v", err)
+	// Build ready event; the hub queues it as it registers the client
+	ready, err := c.buildReady()
+	if err != nil {
+		log.Printf("ws build ready: %v", err)
 		return
 	}
+	c.ready = ready
 
 	// Register with hub
 	c.hub.register <- c
 
+	// readMessage enforces the size limit itself so an oversized message
+	// can be skipped; the library's limit would close the connection
+	c.conn.SetReadLimit(-1)
+
 	// Message loop with per-user rate limiting (30 msgs/sec)
 	const wsRateLimit = 30
 	const wsRateWindow = time.Second
@@ -63,7 +104,7 @@ func (c *Client) readPump() {
 	windowStart := time.Now()
 
 	for {
-		_, data, err := c.conn.Read(c.ctx)
+		data, tooLarge, err := c.readMessage()
 		if err != nil {
 			return
 		}
@@ -79,8 +120,14 @@ func (c *Client) readPump() {
 			return
 		}
 
+		if tooLarge {
+			c.sendError("", ErrCodeTooLarge, fmt.Sprintf("message exceeds %d bytes", c.hub.MaxMessageBytes))
+			continue
+		}
+
 		var msg Message
 		if err := json.Unmarshal(data, &msg); err != nil {
+			c.sendError("", ErrCodeInvalid, "malformed message")
 			continue
 		}
 
@@ -88,6 +135,37 @@ func (c *Client) readPump() {
 	}
 }
 
+// readMessage reads the next inbound message. One longer than the hub's
+// MaxMessageBytes is drained and reported as tooLarge rather than ending
+// the connection, unless it runs past oversizeDiscardFactor times the
+// limit, in which case the connection is closed with StatusMessageTooBig.
+func (c *Client) readMessage() (data []byte, tooLarge bool, err error) {
+	_, r, err := c.conn.Reader(c.ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	limit := c.hub.MaxMessageBytes
+	data, err = io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return nil, false, err
+	}
+	if int64(len(data)) <= limit {
+		return data, false, nil
+	}
+
+	log.Printf("ws message over %d bytes from user %s; discarding", limit, c.UserID)
+	_, err = io.CopyN(io.Discard, r, limit*oversizeDiscardFactor)
+	if err == io.EOF {
+		return nil, true, nil
+	}
+	if err == nil {
+		c.CloseWithReason(websocket.StatusMessageTooBig, "message too large")
+		return nil, false, fmt.Errorf("message from user %s over %d bytes", c.UserID, limit*(oversizeDiscardFactor+1))
+	}
+	return nil, false, err
+}
+
 func (c *Client) authenticate() (*db.User, error) {
 	authCtx, authCancel := context.WithTimeout(c.ctx, authTimeout)
 	defer authCancel()
@@ -132,10 +210,10 @@ func (c *Client) authenticate() (*db.User, error) {
 	return user, nil
 }
 
-func (c *Client) sendReady() error {
+func (c *Client) buildReady() ([]byte, error) {
 	channelsWithMembership, err := c.hub.DB.GetChannelsForUser(c.UserID, c.User.IsAdmin)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Get all channel managers in one query
@@ -151,15 +229,18 @@ func (c *Client) sendReady() error {
 			mgrs = []string{}
 		}
 		channelPayloads[i] = ChannelPayload{
-			ID:          cwm.ID,
-			Name:        cwm.Name,
-			Type:        cwm.Type,
-			Position:    cwm.Position,
-			ManagerIDs:  mgrs,
-			Visibility:  cwm.Visibility,
-			Description: cwm.Description,
-			IsMember:    cwm.IsMember,
-			Role:        cwm.Role,
+			ID:               cwm.ID,
+			Name:             cwm.Name,
+			Type:             cwm.Type,
+			Position:         cwm.Position,
+			ManagerIDs:       mgrs,
+			Visibility:       cwm.Visibility,
+			Description:      cwm.Description,
+			IsMember:         cwm.IsMember,
+			Role:             cwm.Role,
+			Announcement:     cwm.Announcement,
+			AllowAttachments: cwm.AllowAttachments,
+			AllowLinks:       cwm.AllowLinks,
 		}
 	}
 
@@ -172,36 +253,53 @@ func (c *Client) sendReady() error {
 		}
 		for _, ch := range deletedChannels {
 			deletedChannelPayloads = append(deletedChannelPayloads, ChannelPayload{
-				ID:         ch.ID,
-				Name:       ch.Name,
-				Type:       ch.Type,
-				Position:   ch.Position,
-				ManagerIDs: []string{},
-				Visibility: ch.Visibility,
+				ID:               ch.ID,
+				Name:             ch.Name,
+				Type:             ch.Type,
+				Position:         ch.Position,
+				ManagerIDs:       []string{},
+				Visibility:       ch.Visibility,
+				Announcement:     ch.Announcement,
+				AllowAttachments: ch.AllowAttachments,
+				AllowLinks:       ch.AllowLinks,
 			})
 		}
 	}
 
 	onlineUsers := c.hub.OnlineUsers()
+	// This connection isn't registered yet; count its user if no other
+	// connection already does
+	onlineCount := len(onlineUsers) + 1
+	for _, u := range onlineUsers {
+		if u.ID == c.UserID {
+			onlineCount--
+			break
+		}
+	}
 
-	// Get all registered users (approved only)
-	dbAllUsers, usersErr := c.hub.DB.GetAllUsers()
+	// First page of approved members. Large servers would otherwise ship
+	// the entire member list on every connect; clients page through the
+	// rest via GET /api/v1/users?after=<users_next>.
+	dbAllUsers, usersErr := c.hub.DB.ListApprovedUsers(readyUsersPageSize+1, nil)
 	if usersErr != nil {
-		log.Printf("sendReady: get all users: %v", usersErr)
+		log.Printf("sendReady: list users: %v", usersErr)
 	}
-	var allUsers []UserPayload
-	for _, u := range dbAllUsers {
-		if !u.Approved {
-			continue
-		}
-		allUsers = append(allUsers, UserPayload{
+	var usersNext *string
+	if len(dbAllUsers) > readyUsersPageSize {
+		dbAllUsers = dbAllUsers[:readyUsersPageSize]
+		usersNext = &dbAllUsers[readyUsersPageSize-1].ID
+	}
+	allUsers := make([]UserPayload, len(dbAllUsers))
+	for i, u := range dbAllUsers {
+		allUsers[i] = UserPayload{
 			ID:       u.ID,
 			Username: u.Username,
 			IsAdmin:  u.IsAdmin,
-		})
+		}
 	}
-	if allUsers == nil {
-		allUsers = []UserPayload{}
+	usersTotal, countErr := c.hub.DB.CountApprovedUsers()
+	if countErr != nil {
+		log.Printf("sendReady: count users: %v", countErr)
 	}
 
 	// Get current voice states from SFU
@@ -215,6 +313,7 @@ func (c *Client) sendReady() error {
 				SelfDeafen: vs.SelfDeafen,
 				ServerMute: vs.ServerMute,
 				Speaking:   vs.Speaking,
+				Priority:   vs.Priority,
 			})
 		}
 	}
@@ -259,6 +358,25 @@ func (c *Client) sendReady() error {
 		}
 	}
 
+	// Recent in-call chat for voice channels, keyed by channel ID. Text
+	// channel history is fetched over REST on demand; voice chat is small
+	// and shown alongside the call, so the tail ships with ready.
+	var voiceChannelIDs []string
+	for _, cwm := range channelsWithMembership {
+		if cwm.Type != "voice" {
+			continue
+		}
+		if cwm.Visibility != "public" && !cwm.IsMember && !c.User.IsAdmin {
+			continue
+		}
+		voiceChannelIDs = append(voiceChannelIDs, cwm.ID)
+	}
+	voiceChat, err := c.hub.voiceChatMessages(voiceChannelIDs, c.UserID)
+	if err != nil {
+		log.Printf("sendReady: get voice chat: %v", err)
+		voiceChat = map[string][]MessageCreatePayload{}
+	}
+
 	// Enabled features (from feature-gated applets)
 	enabledFeatures := c.hub.applets.EnabledFeatures(c.hub)
 
@@ -279,10 +397,14 @@ func (c *Client) sendReady() error {
 		"channels":         channelPayloads,
 		"voice_states":     voiceStates,
 		"online_users":     onlineUsers,
+		"online_count":     onlineCount,
 		"all_users":        allUsers,
+		"users_total":      usersTotal,
+		"users_next":       usersNext,
 		"notifications":    notifPayloads,
 		"screen_shares":    screenShares,
 		"audio_sources":    audioSources,
+		"voice_chat":       voiceChat,
 		"server_time":      nowUnix(),
 		"unread_counts":    unreadCounts,
 		"enabled_features": enabledFeatures,
@@ -290,26 +412,32 @@ func (c *Client) sendReady() error {
 	if deletedChannelPayloads != nil {
 		readyMap["deleted_channels"] = deletedChannelPayloads
 	}
+	if c.hub.SFU != nil {
+		readyMap["voice_audio"] = c.hub.SFU.VoiceAudio()
+		readyMap["voice_endpoints"] = c.hub.SFU.Endpoints()
+	}
 
 	// Merge applet contributions (radio, media, strudel, etc.)
 	for k, v := range c.hub.applets.ContributeReady(c.hub, c) {
 		readyMap[k] = v
 	}
 
-	msg, err := NewMessage("ready", readyMap)
-	if err != nil {
-		return err
-	}
-
-	return c.conn.Write(c.ctx, websocket.MessageText, msg)
+	return NewMessage("ready", readyMap)
 }
 
+// writePump also heartbeats the connection: every hub.PingInterval it sends
+// a ping frame and closes the connection if the pong doesn't arrive within
+// hub.PingTimeout. Closing cancels readPump, which unregisters the client,
+// so a crashed or half-open peer goes offline promptly instead of lingering
+// until TCP keepalive notices.
 func (c *Client) writePump() {
-	ticker := time.NewTicker(pingInterval)
-	defer func() {
-		ticker.Stop()
-		c.Close()
-	}()
+	var pings <-chan time.Time
+	if c.hub.PingInterval > 0 {
+		ticker := time.NewTicker(c.hub.PingInterval)
+		defer ticker.Stop()
+		pings = ticker.C
+	}
+	defer c.Close()
 
 	for {
 		select {
@@ -320,8 +448,18 @@ func (c *Client) writePump() {
 			if err := c.conn.Write(c.ctx, websocket.MessageText, msg); err != nil {
 				return
 			}
-		case <-ticker.C:
-			if err := c.conn.Ping(c.ctx); err != nil {
+		case <-pings:
+			timeout := c.hub.PingTimeout
+			if timeout <= 0 {
+				timeout = c.hub.PingInterval
+			}
+			ctx, cancel := context.WithTimeout(c.ctx, timeout)
+			err := c.conn.Ping(ctx)
+			cancel()
+			if err != nil {
+				if c.ctx.Err() == nil {
+					log.Printf("ws: no pong from user %s within %s, closing", c.UserID, timeout)
+				}
 				return
 			}
 		case <-c.ctx.Done():
@@ -330,13 +468,51 @@ func (c *Client) writePump() {
 	}
 }
 
+// sendError rejects an op this client sent. See ErrorPayload.
+func (c *Client) sendError(op, code, message string) {
+	msg, _ := NewMessage("error", ErrorPayload{
+		Op:      op,
+		Code:    code,
+		Message: message,
+		Reason:  message,
+	})
+	c.Send(msg)
+}
+
+// sendAck confirms to this connection alone that the send_message with
+// nonce was stored as message id.
+func (c *Client) sendAck(nonce, id, channelID, createdAt string) {
+	msg, _ := NewMessage("ack", AckPayload{
+		Nonce:     nonce,
+		ID:        id,
+		ChannelID: channelID,
+		CreatedAt: createdAt,
+	})
+	c.Send(msg)
+}
+
+// Send queues msg for the write pump and never blocks. Backpressure policy:
+// each connection gets a sendBufSize-message buffer; a client that lets it
+// fill up is treated like a dead connection. It is marked lagging, every
+// later message is dropped, and it is force-closed in the background so the
+// broadcaster never waits on a slow peer. The client reconnects and gets a
+// fresh ready, which resyncs whatever it missed.
 func (c *Client) Send(msg []byte) {
+	if c.lagging.Load() {
+		return
+	}
 	select {
 	case c.send <- msg:
 	default:
-		// Buffer full — disconnect slow client
-		log.Printf("ws: buffer full, disconnecting slow client %s (%s)", c.UserID, c.User.Username)
-		c.Close()
+		if !c.lagging.CompareAndSwap(false, true) {
+			return
+		}
+		n := c.hub.laggingDisconnects.Add(1)
+		log.Printf("ws: send buffer full, disconnecting lagging client %s (%s) [%d lagging disconnects total]", c.UserID, c.User.Username, n)
+		// Cancel first so an in-flight write to the slow peer is abandoned,
+		// then send the close frame off the caller's goroutine.
+		c.cancel()
+		go c.conn.Close(websocket.StatusTryAgainLater, "lagging")
 	}
 }
 
@@ -0,0 +1,58 @@
+package ws
+
+import (
+	"net"
+	"net/http"
+)
+
+// requestIP returns the client address, trusting X-Real-IP from the
+// reverse proxy the same way the API's rate limiters do.
+func requestIP(r *http.Request) string {
+	if ip := r.Header.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// acquireConn reserves a connection slot for ip under MaxConnsPerIP and
+// MaxConns, reporting false if either is full. Loopback is exempt in dev
+// mode. Every true return must be paired with releaseConn.
+func (h *Hub) acquireConn(ip string) bool {
+	if h.connExempt(ip) {
+		return true
+	}
+	h.connMu.Lock()
+	defer h.connMu.Unlock()
+	if h.MaxConns > 0 && h.connTotal >= h.MaxConns {
+		return false
+	}
+	if h.MaxConnsPerIP > 0 && h.connsByIP[ip] >= h.MaxConnsPerIP {
+		return false
+	}
+	h.connTotal++
+	h.connsByIP[ip]++
+	return true
+}
+
+func (h *Hub) releaseConn(ip string) {
+	if h.connExempt(ip) {
+		return
+	}
+	h.connMu.Lock()
+	defer h.connMu.Unlock()
+	h.connTotal--
+	if h.connsByIP[ip]--; h.connsByIP[ip] <= 0 {
+		delete(h.connsByIP, ip)
+	}
+}
+
+func (h *Hub) connExempt(ip string) bool {
+	if !h.DevMode {
+		return false
+	}
+	parsed := net.ParseIP(ip)
+	return parsed != nil && parsed.IsLoopback()
+}
@@ -0,0 +1,151 @@
+package ws
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// Limits for a single reaction emoji. Long ZWJ sequences (families,
+// couples with skin tones) run to ~10 code points and ~35 bytes, and
+// subdivision flags (🏴 + tag characters) to 7 code points.
+const (
+	maxEmojiRunes = 16
+	maxEmojiBytes = 64
+)
+
+// Code points that only modify or join a preceding emoji.
+const (
+	zwj           = 0x200D
+	vs15          = 0xFE0E // text presentation selector
+	vs16          = 0xFE0F // emoji presentation selector
+	keycapCombine = 0x20E3
+	tagFirst      = 0xE0020
+	tagCancel     = 0xE007F
+	skinToneFirst = 0x1F3FB
+	skinToneLast  = 0x1F3FF
+	regionalFirst = 0x1F1E6
+	regionalLast  = 0x1F1FF
+)
+
+// emojiBaseRanges are the blocks containing emoji with default or
+// variation-selector emoji presentation.
+var emojiBaseRanges = [][2]rune{
+	{0x00A9, 0x00A9},   // ©
+	{0x00AE, 0x00AE},   // ®
+	{0x203C, 0x203C},   // ‼
+	{0x2049, 0x2049},   // ⁉
+	{0x2122, 0x2122},   // ™
+	{0x2139, 0x2139},   // ℹ
+	{0x2194, 0x21AA},   // arrows
+	{0x231A, 0x23FF},   // misc technical (⌚ ⏰ ⏩ …)
+	{0x24C2, 0x24C2},   // Ⓜ
+	{0x25AA, 0x25FE},   // geometric shapes (▶ ◀ ◻ …)
+	{0x2600, 0x27BF},   // misc symbols + dingbats
+	{0x2934, 0x2935},   // ⤴ ⤵
+	{0x2B05, 0x2B55},   // ⬅ ⬆ ⬛ ⭐ ⭕
+	{0x3030, 0x3030},   // 〰
+	{0x303D, 0x303D},   // 〽
+	{0x3297, 0x3297},   // ㊗
+	{0x3299, 0x3299},   // ㊙
+	{0x1F000, 0x1FAFF}, // mahjong … symbols & pictographs extended-A
+}
+
+func isEmojiBase(r rune) bool {
+	for _, rg := range emojiBaseRanges {
+		if r >= rg[0] && r <= rg[1] {
+			return true
+		}
+	}
+	return false
+}
+
+func isKeycapBase(r rune) bool {
+	return (r >= '0' && r <= '9') || r == '#' || r == '*'
+}
+
+// IsValidEmoji reports whether s is a single emoji: one base emoji
+// optionally followed by presentation selectors and skin tone modifiers,
+// ZWJ-joined to further emoji; a regional-indicator flag pair; a tag
+// sequence flag (🏴 + tags + cancel tag); or a keycap (digit, #, * with
+// U+20E3). Plain text such as "ab" is rejected.
+func IsValidEmoji(s string) bool {
+	if s == "" || len(s) > maxEmojiBytes || !utf8.ValidString(s) {
+		return false
+	}
+	r := []rune(s)
+	if len(r) > maxEmojiRunes {
+		return false
+	}
+
+	// Keycap: [0-9#*] FE0F? 20E3
+	if isKeycapBase(r[0]) {
+		switch {
+		case len(r) == 2 && r[1] == keycapCombine:
+			return true
+		case len(r) == 3 && r[1] == vs16 && r[2] == keycapCombine:
+			return true
+		}
+		return false
+	}
+
+	// Flag: exactly two regional indicators
+	if isRegional(r[0]) {
+		return len(r) == 2 && isRegional(r[1])
+	}
+
+	// Otherwise: element (ZWJ element)*
+	i := 0
+	for {
+		n := emojiElementLen(r[i:])
+		if n == 0 {
+			return false
+		}
+		i += n
+		if i == len(r) {
+			return true
+		}
+		if r[i] != zwj || i+1 == len(r) {
+			return false
+		}
+		i++
+	}
+}
+
+func isRegional(r rune) bool {
+	return r >= regionalFirst && r <= regionalLast
+}
+
+// emojiElementLen returns how many runes at the start of r form one emoji
+// element (base plus modifiers/selectors/tags), or 0 if r doesn't start
+// with one.
+func emojiElementLen(r []rune) int {
+	if len(r) == 0 || !isEmojiBase(r[0]) || isRegional(r[0]) ||
+		(r[0] >= skinToneFirst && r[0] <= skinToneLast) {
+		return 0
+	}
+	i := 1
+	if i < len(r) && (r[i] == vs15 || r[i] == vs16) {
+		i++
+	}
+	if i < len(r) && r[i] >= skinToneFirst && r[i] <= skinToneLast {
+		i++
+	}
+	// Tag sequence (subdivision flags): tags terminated by cancel tag
+	if i < len(r) && r[i] >= tagFirst && r[i] < tagCancel {
+		for i < len(r) && r[i] >= tagFirst && r[i] < tagCancel {
+			i++
+		}
+		if i == len(r) || r[i] != tagCancel {
+			return 0
+		}
+		i++
+	}
+	return i
+}
+
+// SameEmoji reports whether a and b are the same emoji, ignoring the
+// emoji presentation selector that keyboards add inconsistently ("❤" vs
+// "❤️").
+func SameEmoji(a, b string) bool {
+	return strings.ReplaceAll(a, string(rune(vs16)), "") == strings.ReplaceAll(b, string(rune(vs16)), "")
+}
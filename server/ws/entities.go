@@ -0,0 +1,162 @@
+package ws
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/kalman/voicechat/unfurl"
+)
+
+// Message entity types.
+const (
+	EntityMention   = "mention"    // <@userID>
+	EntityURL       = "url"        // http(s) link
+	EntityCode      = "code"       // `inline code`
+	EntityCodeBlock = "code_block" // ```fenced block```
+	EntitySpoiler   = "spoiler"    // ||hidden text||
+)
+
+// MessageEntity marks a span of message content the client should render
+// specially. Start and End are byte offsets into the UTF-8 content, End
+// exclusive, and include the delimiters (<@ >, backticks, ||).
+type MessageEntity struct {
+	Type   string `json:"type"`
+	Start  int    `json:"start"`
+	End    int    `json:"end"`
+	UserID string `json:"user_id,omitempty"`
+	URL    string `json:"url,omitempty"`
+}
+
+// maxURLEntities caps url entities per message; links past it are left as
+// plain text.
+const maxURLEntities = 20
+
+// maxUnfurlURLs caps how many distinct links per message get previews.
+const maxUnfurlURLs = 5
+
+var (
+	codeRegex    = regexp.MustCompile("(?s)```.*?```|`[^`\n]+`")
+	spoilerRegex = regexp.MustCompile(`(?s)\|\|(.+?)\|\|`)
+)
+
+// ParseEntities finds the mentions, URLs, code spans and spoilers in
+// content, sorted by offset. Anything inside code is literal text and is not
+// reported; mentions and URLs inside a spoiler are, after the spoiler.
+func ParseEntities(content *string) []MessageEntity {
+	entities := []MessageEntity{}
+	if content == nil || *content == "" {
+		return entities
+	}
+	text := *content
+
+	codeRanges := codeRegex.FindAllStringIndex(text, -1)
+	inCode := func(start, end int) bool {
+		for _, r := range codeRanges {
+			if start < r[1] && end > r[0] {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, r := range codeRanges {
+		typ := EntityCode
+		if strings.HasPrefix(text[r[0]:r[1]], "```") {
+			typ = EntityCodeBlock
+		}
+		entities = append(entities, MessageEntity{Type: typ, Start: r[0], End: r[1]})
+	}
+	var spoilerRanges [][]int
+	for _, m := range spoilerRegex.FindAllStringIndex(text, -1) {
+		if inCode(m[0], m[1]) {
+			continue
+		}
+		spoilerRanges = append(spoilerRanges, m)
+		entities = append(entities, MessageEntity{Type: EntitySpoiler, Start: m[0], End: m[1]})
+	}
+	for _, m := range mentionRegex.FindAllStringSubmatchIndex(text, -1) {
+		if inCode(m[0], m[1]) {
+			continue
+		}
+		entities = append(entities, MessageEntity{
+			Type:   EntityMention,
+			Start:  m[0],
+			End:    m[1],
+			UserID: text[m[2]:m[3]],
+		})
+	}
+	urlCount := 0
+	for _, r := range unfurl.FindURLs(text) {
+		if inCode(r[0], r[1]) {
+			continue
+		}
+		if urlCount == maxURLEntities {
+			break
+		}
+		urlCount++
+		// "||https://x.test||" — the URL stops at the closing bars
+		for _, sp := range spoilerRanges {
+			if r[0] > sp[0] && r[0] < sp[1]-2 && r[1] > sp[1]-2 {
+				r[1] = sp[1] - 2
+			}
+		}
+		entities = append(entities, MessageEntity{
+			Type:  EntityURL,
+			Start: r[0],
+			End:   r[1],
+			URL:   text[r[0]:r[1]],
+		})
+	}
+
+	sort.SliceStable(entities, func(i, j int) bool { return entities[i].Start < entities[j].Start })
+	return entities
+}
+
+// UnfurlURLs returns the distinct URLs of the url entities, in order and
+// capped for the unfurl worker. Links inside code aren't entities, and
+// links inside a spoiler are skipped so the preview doesn't give it away.
+func UnfurlURLs(entities []MessageEntity) []string {
+	seen := map[string]bool{}
+	var urls []string
+	spoilerEnd := -1
+	for _, e := range entities {
+		if e.Type == EntitySpoiler {
+			spoilerEnd = e.End
+			continue
+		}
+		if e.Type != EntityURL || seen[e.URL] || e.Start < spoilerEnd {
+			continue
+		}
+		seen[e.URL] = true
+		urls = append(urls, e.URL)
+		if len(urls) == maxUnfurlURLs {
+			break
+		}
+	}
+	return urls
+}
+
+// HasURL reports whether any of the entities is a link.
+func HasURL(entities []MessageEntity) bool {
+	for _, e := range entities {
+		if e.Type == EntityURL {
+			return true
+		}
+	}
+	return false
+}
+
+// MentionedUserIDs returns the distinct user IDs of the mention entities,
+// in order of first mention.
+func MentionedUserIDs(entities []MessageEntity) []string {
+	var ids []string
+	seen := make(map[string]bool)
+	for _, e := range entities {
+		if e.Type == EntityMention && !seen[e.UserID] {
+			seen[e.UserID] = true
+			ids = append(ids, e.UserID)
+		}
+	}
+	return ids
+}
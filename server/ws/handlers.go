@@ -2,12 +2,14 @@ package ws
 
 import (
 	"encoding/json"
+	"fmt"
 	"log"
 	"regexp"
 	"strings"
 
 	"github.com/google/uuid"
 	"github.com/kalman/voicechat/db"
+	"github.com/kalman/voicechat/sfu"
 	"github.com/kalman/voicechat/unfurl"
 	"github.com/pion/webrtc/v4"
 )
@@ -19,7 +21,13 @@ type SendMessageData struct {
 	Content       *string  `json:"content"`
 	ReplyToID     *string  `json:"reply_to_id"`
 	AttachmentIDs []string `json:"attachment_ids"`
-	ThreadID      *string  `json:"thread_id"`
+	// SpoilerAttachmentIDs marks some of AttachmentIDs as spoilers, on top
+	// of any flagged at upload time.
+	SpoilerAttachmentIDs []string `json:"spoiler_attachment_ids"`
+	ThreadID             *string  `json:"thread_id"`
+	// Nonce is an optional client-chosen key; resending with the same
+	// nonce returns the original message instead of a duplicate.
+	Nonce *string `json:"nonce"`
 }
 
 type EditMessageData struct {
@@ -29,6 +37,7 @@ type EditMessageData struct {
 
 type DeleteMessageData struct {
 	MessageID string `json:"message_id"`
+	Purge     bool   `json:"purge"` // admin only: remove the row and files instead of leaving a tombstone
 }
 
 type ReactionData struct {
@@ -36,10 +45,20 @@ type ReactionData struct {
 	Emoji     string `json:"emoji"`
 }
 
+type ReactionDeniedPayload struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+	Reason    string `json:"reason"`
+}
+
 type TypingData struct {
 	ChannelID string `json:"channel_id"`
 }
 
+type ViewChannelData struct {
+	ChannelID string `json:"channel_id"`
+}
+
 type CreateChannelData struct {
 	Name string `json:"name"`
 	Type string `json:"type"`
@@ -63,8 +82,19 @@ type MessageCreatePayload struct {
 	ReplyTo     *ReplyToPayload         `json:"reply_to"`
 	Attachments []AttachmentPayload     `json:"attachments"`
 	Mentions    []string                `json:"mentions"`
+	Entities    []MessageEntity         `json:"entities"`
 	ThreadID    *string                 `json:"thread_id"`
 	CreatedAt   string                  `json:"created_at"`
+	Nonce       *string                 `json:"nonce,omitempty"`
+}
+
+// AckPayload tells the sender of a send_message carrying a nonce which
+// message its send became.
+type AckPayload struct {
+	Nonce     string `json:"nonce"`
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+	CreatedAt string `json:"created_at"`
 }
 
 type ReplyToPayload struct {
@@ -82,13 +112,48 @@ type AttachmentPayload struct {
 	MimeType string  `json:"mime_type"`
 	Width    *int    `json:"width"`
 	Height   *int    `json:"height"`
+	Spoiler  bool    `json:"spoiler"`
+	// DownloadURL serves the file as a download under its original name;
+	// URL is for inline display.
+	DownloadURL string `json:"download_url"`
+	// DownloadCount is only included for the message's author.
+	DownloadCount *int64 `json:"download_count,omitempty"`
+}
+
+// buildAttachmentPayloads converts a message's attachments, with their
+// download counts when withCounts is set (the author is the recipient).
+func buildAttachmentPayloads(attachments []db.Attachment, withCounts bool) []AttachmentPayload {
+	out := make([]AttachmentPayload, len(attachments))
+	for i, a := range attachments {
+		ap := AttachmentPayload{
+			ID:       a.ID,
+			Filename: a.Filename,
+			URL:      "/" + strings.ReplaceAll(a.Path, "\\", "/"),
+			MimeType: a.MimeType,
+			Width:    a.Width,
+			Height:   a.Height,
+			Spoiler:  a.Spoiler,
+		}
+		if a.ThumbPath != nil {
+			t := "/" + strings.ReplaceAll(*a.ThumbPath, "\\", "/")
+			ap.ThumbURL = &t
+		}
+		ap.DownloadURL = "/api/v1/attachments/" + a.ID + "/download"
+		if withCounts {
+			n := a.DownloadCount
+			ap.DownloadCount = &n
+		}
+		out[i] = ap
+	}
+	return out
 }
 
 type MessageUpdatePayload struct {
-	ID        string `json:"id"`
-	ChannelID string `json:"channel_id"`
-	Content   string `json:"content"`
-	EditedAt  string `json:"edited_at"`
+	ID        string          `json:"id"`
+	ChannelID string          `json:"channel_id"`
+	Content   string          `json:"content"`
+	Entities  []MessageEntity `json:"entities"`
+	EditedAt  string          `json:"edited_at"`
 }
 
 type MessageDeletePayload struct {
@@ -140,26 +205,175 @@ type ChannelUpdatePayload struct {
 	ID         string   `json:"id"`
 	Name       string   `json:"name"`
 	ManagerIDs []string `json:"manager_ids"`
+	// Set only by set_channel_restrictions
+	AllowAttachments *bool `json:"allow_attachments,omitempty"`
+	AllowLinks       *bool `json:"allow_links,omitempty"`
+}
+
+// SetChannelRestrictionsData changes a channel's posting restrictions;
+// an omitted flag is left as it is.
+type SetChannelRestrictionsData struct {
+	ChannelID        string `json:"channel_id"`
+	AllowAttachments *bool  `json:"allow_attachments"`
+	AllowLinks       *bool  `json:"allow_links"`
 }
 
 var mentionRegex = regexp.MustCompile(`<@([a-f0-9-]{36})>`)
 
+// contentPreview is the notification text for a message: mentions shown
+// as @username, cut to 80 characters.
+func (h *Hub) contentPreview(content *string) string {
+	if content == nil {
+		return ""
+	}
+	preview := mentionRegex.ReplaceAllStringFunc(*content, func(match string) string {
+		sub := mentionRegex.FindStringSubmatch(match)
+		if len(sub) < 2 {
+			return match
+		}
+		if u, err := h.DB.GetUserByID(sub[1]); err == nil {
+			return "@" + u.Username
+		}
+		return match
+	})
+	if r := []rune(preview); len(r) > 80 {
+		preview = string(r[:80]) + "..."
+	}
+	return preview
+}
+
+// voiceChatReadyLimit caps how many in-call chat messages per voice
+// channel are included in the ready payload.
+const voiceChatReadyLimit = 50
+
+// voiceChatMessages returns the most recent live top-level messages in
+// each voice channel's in-call chat, oldest first, keyed by channel ID. The
+// lookups are batched across channels so ready costs the same few queries
+// however many voice channels there are.
+func (h *Hub) voiceChatMessages(channelIDs []string, viewerID string) (map[string][]MessageCreatePayload, error) {
+	byChannel, err := h.DB.GetRecentMessagesByChannels(channelIDs, voiceChatReadyLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	var messageIDs, replyIDs []string
+	for _, msgs := range byChannel {
+		for _, m := range msgs {
+			messageIDs = append(messageIDs, m.ID)
+			if m.ReplyToID != nil {
+				replyIDs = append(replyIDs, *m.ReplyToID)
+			}
+		}
+	}
+	attachments, err := h.DB.GetAttachmentsByMessages(messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	mentions, err := h.DB.GetMentionsByMessages(messageIDs)
+	if err != nil {
+		return nil, err
+	}
+	replies, err := h.DB.GetReplyContexts(replyIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string][]MessageCreatePayload, len(byChannel))
+	for channelID, msgs := range byChannel {
+		payloads := make([]MessageCreatePayload, 0, len(msgs))
+		// Newest first from the query
+		for i := len(msgs) - 1; i >= 0; i-- {
+			m := msgs[i]
+			var rc *db.ReplyContext
+			if m.ReplyToID != nil {
+				rc = replies[*m.ReplyToID]
+			}
+			payloads = append(payloads, buildStoredPayload(m, attachments[m.ID], mentions[m.ID], rc, viewerID))
+		}
+		out[channelID] = payloads
+	}
+	return out, nil
+}
+
+// storedMessagePayload rebuilds the message_create payload for a message
+// already in the database, as viewerID sees it.
+func (h *Hub) storedMessagePayload(m db.MessageWithAuthor, viewerID string) MessageCreatePayload {
+	mentions, _ := h.DB.GetMentionsByMessage(m.ID)
+	attachments, _ := h.DB.GetAttachmentsByMessage(m.ID)
+	var rc *db.ReplyContext
+	if m.ReplyToID != nil {
+		rc, _ = h.DB.GetReplyContext(*m.ReplyToID)
+	}
+	return buildStoredPayload(m, attachments, mentions, rc, viewerID)
+}
+
+// buildStoredPayload assembles a stored message's message_create payload
+// for viewerID from its already-loaded attachments, mentions and reply
+// target.
+func buildStoredPayload(m db.MessageWithAuthor, attachments []db.Attachment, mentions []string, rc *db.ReplyContext, viewerID string) MessageCreatePayload {
+	authorID := ""
+	if m.AuthorID != nil {
+		authorID = *m.AuthorID
+	}
+	if mentions == nil {
+		mentions = []string{}
+	}
+	attachPayloads := buildAttachmentPayloads(attachments, viewerID != "" && viewerID == authorID)
+	var replyTo *ReplyToPayload
+	if rc != nil {
+		rcAuthorID := ""
+		if rc.AuthorID != nil {
+			rcAuthorID = *rc.AuthorID
+		}
+		replyTo = &ReplyToPayload{
+			ID:      rc.ID,
+			Author:  UserPayload{ID: rcAuthorID, Username: rc.AuthorUsername},
+			Content: rc.Content,
+			Deleted: rc.DeletedAt != nil,
+		}
+	}
+	return MessageCreatePayload{
+		ID:        m.ID,
+		ChannelID: m.ChannelID,
+		Author: UserPayload{
+			ID:       authorID,
+			Username: m.AuthorUsername,
+		},
+		Content:     m.Content,
+		ReplyTo:     replyTo,
+		Attachments: attachPayloads,
+		Mentions:    mentions,
+		Entities:    ParseEntities(m.Content),
+		ThreadID:    m.ThreadID,
+		CreatedAt:   m.CreatedAt,
+	}
+}
+
 func (h *Hub) handleSendMessage(c *Client, data json.RawMessage) {
 	var d SendMessageData
 	if err := json.Unmarshal(data, &d); err != nil {
+		c.sendError("send_message", ErrCodeInvalid, "malformed payload")
 		return
 	}
 
 	if d.Content == nil && len(d.AttachmentIDs) == 0 {
+		c.sendError("send_message", ErrCodeInvalid, "message is empty")
+		return
+	}
+	if d.Content != nil && len(*d.Content) > MaxMessageLength {
+		c.sendError("send_message", ErrCodeInvalid, "message is too long")
 		return
 	}
-	if d.Content != nil && len(*d.Content) > 32000 {
+	if d.Nonce != nil && (*d.Nonce == "" || len(*d.Nonce) > 64) {
+		c.sendError("send_message", ErrCodeInvalid, "nonce must be 1-64 characters")
 		return
 	}
 
-	// Verify channel exists
+	// Verify channel exists. Voice channels carry an in-call text chat
+	// stored exactly like a text channel's messages.
 	ch, err := h.DB.GetChannelByID(d.ChannelID)
-	if err != nil || ch == nil || ch.Type != "text" {
+	if err != nil || ch == nil || (ch.Type != "text" && ch.Type != "voice") {
+		c.sendError("send_message", ErrCodeNotFound, "channel not found")
 		return
 	}
 
@@ -167,40 +381,88 @@ func (h *Hub) handleSendMessage(c *Client, data json.RawMessage) {
 	if ch.Visibility != "public" {
 		isMember, err := h.DB.IsChannelMember(d.ChannelID, c.UserID)
 		if err != nil || (!isMember && !c.User.IsAdmin) {
+			c.sendError("send_message", ErrCodeDenied, "not a member of this channel")
 			return
 		}
 	}
 
+	// Announcement channels: everyone reads and reacts, managers post
+	if ch.Announcement && !h.canManageChannel(c, d.ChannelID) {
+		c.sendError("send_message", ErrCodeDenied, "only channel managers can post in this channel")
+		return
+	}
+
+	// Reply and thread targets must be in the same channel. Checked
+	// before the insert so a rejected message isn't left half-saved.
+	if d.ReplyToID != nil {
+		replyParent, _ := h.DB.GetMessageByID(*d.ReplyToID)
+		if replyParent == nil || replyParent.ChannelID != d.ChannelID {
+			c.sendError("send_message", ErrCodeInvalid, "reply target is not in this channel")
+			return
+		}
+	}
+	if d.ThreadID != nil {
+		threadRoot, _ := h.DB.GetMessageByID(*d.ThreadID)
+		if threadRoot == nil || threadRoot.ChannelID != d.ChannelID {
+			c.sendError("send_message", ErrCodeInvalid, "thread is not in this channel")
+			return
+		}
+	}
+
+	// Parse mentions; ones inside code spans are literal text
+	entities := ParseEntities(d.Content)
+
+	// Posting restrictions apply to managers too; they can lift them
+	if !ch.AllowAttachments && len(d.AttachmentIDs) > 0 {
+		c.sendError("send_message", ErrCodeChannelRestricted, "attachments are not allowed in this channel")
+		return
+	}
+	if !ch.AllowLinks && HasURL(entities) {
+		c.sendError("send_message", ErrCodeChannelRestricted, "links are not allowed in this channel")
+		return
+	}
+	mentionIDs := MentionedUserIDs(entities)
+	if h.MaxMentions > 0 && len(mentionIDs) > h.MaxMentions {
+		c.sendError("send_message", ErrCodeInvalid, fmt.Sprintf("a message can mention at most %d users", h.MaxMentions))
+		return
+	}
+
+	// A resend of something we already stored: hand the original back to
+	// the sender only, so it can reconcile without anyone seeing a dupe.
+	if d.Nonce != nil && h.resendStoredMessage(c, d.ChannelID, *d.Nonce) {
+		return
+	}
+
 	msgID := uuid.New().String()
-	msg, err := h.DB.CreateMessage(msgID, d.ChannelID, c.UserID, d.Content, d.ReplyToID)
+	msg, err := h.DB.CreateMessage(msgID, d.ChannelID, c.UserID, d.Content, d.ReplyToID, d.Nonce)
 	if err != nil {
+		// Lost a race with a concurrent resend of the same nonce
+		if d.Nonce != nil && h.resendStoredMessage(c, d.ChannelID, *d.Nonce) {
+			return
+		}
 		log.Printf("create message: %v", err)
+		c.sendError("send_message", ErrCodeInternal, "failed to save message")
 		return
 	}
+	if d.Nonce != nil {
+		c.sendAck(*d.Nonce, msg.ID, msg.ChannelID, msg.CreatedAt)
+	}
 
 	// Link attachments (only orphans uploaded by this user)
 	if len(d.AttachmentIDs) > 0 {
 		if err := h.DB.LinkAttachmentsToMessage(msgID, d.AttachmentIDs, c.UserID); err != nil {
 			log.Printf("link attachments: %v", err)
 		}
-	}
-
-	// Validate reply_to is in the same channel
-	if d.ReplyToID != nil {
-		replyParent, _ := h.DB.GetMessageByID(*d.ReplyToID)
-		if replyParent == nil || replyParent.ChannelID != d.ChannelID {
-			return
+		if len(d.SpoilerAttachmentIDs) > 0 {
+			if err := h.DB.MarkAttachmentsSpoiler(msgID, d.SpoilerAttachmentIDs); err != nil {
+				log.Printf("mark spoiler attachments: %v", err)
+			}
 		}
 	}
 
 	// Thread logic: determine thread_id for this message
 	var threadID *string
 	if d.ThreadID != nil {
-		// Validate thread root is in the same channel
-		threadRoot, _ := h.DB.GetMessageByID(*d.ThreadID)
-		if threadRoot == nil || threadRoot.ChannelID != d.ChannelID {
-			return
-		}
 		// Explicit thread_id from client (replying within thread panel)
 		threadID = d.ThreadID
 		h.DB.SetThreadID(msgID, *d.ThreadID)
@@ -223,13 +485,7 @@ func (h *Hub) handleSendMessage(c *Client, data json.RawMessage) {
 		}
 	}
 
-	// Parse mentions
-	var mentionIDs []string
 	if d.Content != nil {
-		matches := mentionRegex.FindAllStringSubmatch(*d.Content, -1)
-		for _, m := range matches {
-			mentionIDs = append(mentionIDs, m[1])
-		}
 		if len(mentionIDs) > 0 {
 			h.DB.CreateMentions(msgID, mentionIDs)
 
@@ -244,23 +500,7 @@ func (h *Hub) handleSendMessage(c *Client, data json.RawMessage) {
 				if ch != nil {
 					chName = ch.Name
 				}
-				// Build content preview with resolved mentions
-				var preview string
-				if d.Content != nil {
-					preview = mentionRegex.ReplaceAllStringFunc(*d.Content, func(match string) string {
-						sub := mentionRegex.FindStringSubmatch(match)
-						if len(sub) < 2 {
-							return match
-						}
-						if u, err := h.DB.GetUserByID(sub[1]); err == nil {
-							return "@" + u.Username
-						}
-						return match
-					})
-					if len(preview) > 80 {
-						preview = preview[:80] + "..."
-					}
-				}
+				preview := h.contentPreview(d.Content)
 				notifData := map[string]any{
 					"message_id":      msgID,
 					"channel_id":      d.ChannelID,
@@ -280,26 +520,14 @@ func (h *Hub) handleSendMessage(c *Client, data json.RawMessage) {
 					Data:      dataJSON,
 					Read:      false,
 					CreatedAt: msg.CreatedAt,
+					Silent:    h.UserStatus(mentionedID) == StatusDND,
 				})
 				h.SendTo(mentionedID, notifMsg)
 
-				// Send mention email if user is offline
+				// Email the mention if the user is offline; QueueMentionEmail
+				// batches it with any others and rate-limits per user
 				if !h.IsUserOnline(mentionedID) && h.EmailService != nil {
-					mentionedUser, _ := h.DB.GetUserByID(mentionedID)
-					if mentionedUser != nil && mentionedUser.Email != nil && *mentionedUser.Email != "" {
-						canSend, _ := h.DB.CanSendMentionEmail(mentionedID)
-						if canSend {
-							go func(userID, toEmail, author, channel, prev string) {
-								if err := h.EmailService.SendMentionEmail(toEmail, "Le Faux Pain", author, channel, prev); err != nil {
-									log.Printf("send mention email to %s: %v", toEmail, err)
-									return
-								}
-								if err := h.DB.SetMentionEmailSent(userID); err != nil {
-									log.Printf("set mention email sent for %s: %v", userID, err)
-								}
-							}(mentionedID, *mentionedUser.Email, c.User.Username, chName, preview)
-						}
-					}
+					h.EmailService.QueueMentionEmail(mentionedID, h.IsUserOnline)
 				}
 			}
 		}
@@ -308,25 +536,59 @@ func (h *Hub) handleSendMessage(c *Client, data json.RawMessage) {
 		mentionIDs = []string{}
 	}
 
-	// Get attachments
-	attachments, _ := h.DB.GetAttachmentsByMessage(msgID)
-	attachPayloads := make([]AttachmentPayload, len(attachments))
-	for i, a := range attachments {
-		ap := AttachmentPayload{
-			ID:       a.ID,
-			Filename: a.Filename,
-			URL:      "/" + strings.ReplaceAll(a.Path, "\\", "/"),
-			MimeType: a.MimeType,
-			Width:    a.Width,
-			Height:   a.Height,
-		}
-		if a.ThumbPath != nil {
-			t := "/" + strings.ReplaceAll(*a.ThumbPath, "\\", "/")
-			ap.ThumbURL = &t
+	// Tell the author of the message being replied to, unless it's their
+	// own reply or it already mentions them. A reply in a channel they've
+	// muted is left out; mentions still come through. Either way they
+	// get no thread_reply for it below.
+	var replyAuthorID string
+	if d.ReplyToID != nil {
+		parent, _ := h.DB.GetMessageByID(*d.ReplyToID)
+		if parent != nil && parent.AuthorID != nil && parent.DeletedAt == nil && *parent.AuthorID != c.UserID {
+			authorID := *parent.AuthorID
+			replyAuthorID = authorID
+			notify := true
+			for _, mentionedID := range mentionIDs {
+				if mentionedID == authorID {
+					notify = false
+					break
+				}
+			}
+			if muted, _ := h.DB.IsChannelMuted(authorID, d.ChannelID); muted {
+				notify = false
+			}
+			if notify {
+				preview := h.contentPreview(d.Content)
+				notifID := uuid.New().String()
+				notifData := map[string]any{
+					"message_id":      msgID,
+					"reply_to_id":     parent.ID,
+					"channel_id":      d.ChannelID,
+					"channel_name":    ch.Name,
+					"author_id":       c.User.ID,
+					"author_username": c.User.Username,
+					"content_preview": preview,
+				}
+				if err := h.DB.CreateNotification(notifID, authorID, "reply", notifData); err != nil {
+					log.Printf("create reply notification: %v", err)
+				} else {
+					dataJSON, _ := json.Marshal(notifData)
+					notifMsg, _ := NewMessage("notification_create", NotificationPayload{
+						ID:        notifID,
+						Type:      "reply",
+						Data:      dataJSON,
+						Read:      false,
+						CreatedAt: msg.CreatedAt,
+						Silent:    h.UserStatus(authorID) == StatusDND,
+					})
+					h.SendTo(authorID, notifMsg)
+				}
+			}
 		}
-		attachPayloads[i] = ap
 	}
 
+	// Get attachments
+	attachments, _ := h.DB.GetAttachmentsByMessage(msgID)
+
 	// Build reply context
 	var replyTo *ReplyToPayload
 	if msg.ReplyToID != nil {
@@ -348,7 +610,7 @@ func (h *Hub) handleSendMessage(c *Client, data json.RawMessage) {
 		}
 	}
 
-	broadcast, _ := NewMessage("message_create", MessageCreatePayload{
+	payload := MessageCreatePayload{
 		ID:        msg.ID,
 		ChannelID: msg.ChannelID,
 		Author: UserPayload{
@@ -357,30 +619,29 @@ func (h *Hub) handleSendMessage(c *Client, data json.RawMessage) {
 		},
 		Content:     msg.Content,
 		ReplyTo:     replyTo,
-		Attachments: attachPayloads,
+		Attachments: buildAttachmentPayloads(attachments, false),
 		Mentions:    mentionIDs,
+		Entities:    entities,
 		ThreadID:    threadID,
 		CreatedAt:   msg.CreatedAt,
-	})
-	if ch.Visibility != "public" {
-		h.BroadcastToMembers(broadcast, ch.ID)
-	} else {
-		h.BroadcastAll(broadcast)
+		Nonce:       d.Nonce,
 	}
+	broadcast, _ := NewMessage("message_create", payload)
+	payload.Attachments = buildAttachmentPayloads(attachments, true)
+	authorMsg, _ := NewMessage("message_create", payload)
+	h.BroadcastChannelMessage(ch, c.UserID, broadcast, authorMsg)
 
-	// Async URL unfurling
-	if d.Content != nil {
-		urls := unfurl.ExtractURLs(*d.Content)
-		if len(urls) > 0 {
-			go h.processUnfurls(msg.ID, msg.ChannelID, urls)
-		}
+	// Async URL unfurling, from the links already parsed into entities
+	if urls := UnfurlURLs(entities); len(urls) > 0 {
+		go h.processUnfurls(msg.ID, msg.ChannelID, urls)
 	}
 
-	// Notify thread participants (except sender and already-mentioned users)
+	// Notify thread participants (except the sender, mentioned users and
+	// the reply's target, all handled above)
 	if threadID != nil {
 		participants, _ := h.DB.GetThreadParticipants(*threadID)
 		for _, participantID := range participants {
-			if participantID == c.UserID {
+			if participantID == c.UserID || participantID == replyAuthorID {
 				continue
 			}
 			alreadyNotified := false
@@ -398,13 +659,7 @@ func (h *Hub) handleSendMessage(c *Client, data json.RawMessage) {
 			if ch != nil {
 				chName = ch.Name
 			}
-			var preview string
-			if d.Content != nil {
-				preview = *d.Content
-				if len(preview) > 80 {
-					preview = preview[:80] + "..."
-				}
-			}
+			preview := h.contentPreview(d.Content)
 
 			notifID := uuid.New().String()
 			notifData := map[string]any{
@@ -426,6 +681,7 @@ func (h *Hub) handleSendMessage(c *Client, data json.RawMessage) {
 				Data:      dataJSON,
 				Read:      false,
 				CreatedAt: msg.CreatedAt,
+				Silent:    h.UserStatus(participantID) == StatusDND,
 			})
 			h.SendTo(participantID, notifMsg)
 		}
@@ -479,26 +735,65 @@ func (h *Hub) processUnfurls(messageID, channelID string, urls []string) {
 	}
 }
 
+// resendStoredMessage sends the sender's earlier message with this nonce
+// back to them, or an error if it has since been deleted. It reports
+// whether such a message existed.
+func (h *Hub) resendStoredMessage(c *Client, channelID, nonce string) bool {
+	existing, err := h.DB.GetMessageByNonce(channelID, c.UserID, nonce)
+	if err != nil {
+		log.Printf("send message: %v", err)
+		return false
+	}
+	if existing == nil {
+		return false
+	}
+	if existing.DeletedAt != nil {
+		// The nonce stays taken; resending the deleted content would undo
+		// the delete for this sender
+		c.sendError("send_message", ErrCodeInvalid, "message with this nonce was deleted")
+		return true
+	}
+	payload := h.storedMessagePayload(db.MessageWithAuthor{
+		Message:        *existing,
+		AuthorUsername: c.User.Username,
+	}, c.UserID)
+	payload.Nonce = &nonce
+	c.sendAck(nonce, existing.ID, existing.ChannelID, existing.CreatedAt)
+	msg, _ := NewMessage("message_create", payload)
+	c.Send(msg)
+	return true
+}
+
 func (h *Hub) handleEditMessage(c *Client, data json.RawMessage) {
 	var d EditMessageData
 	if err := json.Unmarshal(data, &d); err != nil {
+		c.sendError("edit_message", ErrCodeInvalid, "malformed payload")
 		return
 	}
 
-	if len(d.Content) == 0 || len(d.Content) > 4000 {
+	if len(d.Content) == 0 || len(d.Content) > MaxEditLength {
+		c.sendError("edit_message", ErrCodeInvalid, "content must be 1-4000 characters")
 		return
 	}
 
 	msg, err := h.DB.GetMessageByID(d.MessageID)
 	if err != nil || msg == nil || msg.DeletedAt != nil {
+		c.sendError("edit_message", ErrCodeNotFound, "message not found")
 		return
 	}
 	if (msg.AuthorID == nil || *msg.AuthorID != c.UserID) && !c.User.IsAdmin {
+		c.sendError("edit_message", ErrCodeDenied, "you can only edit your own messages")
+		return
+	}
+	// An edit can't slip a link into a channel that doesn't allow them
+	if ch, err := h.DB.GetChannelByID(msg.ChannelID); err == nil && !ch.AllowLinks && HasURL(ParseEntities(&d.Content)) {
+		c.sendError("edit_message", ErrCodeChannelRestricted, "links are not allowed in this channel")
 		return
 	}
 
 	if err := h.DB.EditMessage(d.MessageID, d.Content); err != nil {
 		log.Printf("edit message: %v", err)
+		c.sendError("edit_message", ErrCodeInternal, "failed to edit message")
 		return
 	}
 
@@ -511,6 +806,7 @@ func (h *Hub) handleEditMessage(c *Client, data json.RawMessage) {
 		ID:        updated.ID,
 		ChannelID: updated.ChannelID,
 		Content:   d.Content,
+		Entities:  ParseEntities(&d.Content),
 		EditedAt:  *updated.EditedAt,
 	})
 	h.BroadcastAll(broadcast)
@@ -519,22 +815,58 @@ func (h *Hub) handleEditMessage(c *Client, data json.RawMessage) {
 func (h *Hub) handleDeleteMessage(c *Client, data json.RawMessage) {
 	var d DeleteMessageData
 	if err := json.Unmarshal(data, &d); err != nil {
+		c.sendError("delete_message", ErrCodeInvalid, "malformed payload")
 		return
 	}
 
 	msg, err := h.DB.GetMessageByID(d.MessageID)
 	if err != nil || msg == nil {
+		c.sendError("delete_message", ErrCodeNotFound, "message not found")
 		return
 	}
 
 	// Only author or admin can delete
 	if (msg.AuthorID == nil || *msg.AuthorID != c.UserID) && !c.User.IsAdmin {
+		c.sendError("delete_message", ErrCodeDenied, "you can only delete your own messages")
 		return
 	}
 
 	channelID := msg.ChannelID
-	if err := h.DB.DeleteMessage(d.MessageID); err != nil {
+	if d.Purge {
+		if !c.User.IsAdmin {
+			c.sendError("delete_message", ErrCodeDenied, "only admins can purge messages")
+			return
+		}
+		purged, err := h.DB.PurgeMessage(d.MessageID)
+		if err != nil {
+			log.Printf("purge message: %v", err)
+			c.sendError("delete_message", ErrCodeInternal, "failed to delete message")
+			return
+		}
+		for userID, ids := range purged.Notifications {
+			if msg, err := NewMessage("notifications_deleted", NotificationsDeletedPayload{IDs: ids}); err == nil {
+				h.SendTo(userID, msg)
+			}
+		}
+		if h.Store != nil {
+			// Identical uploads share one file; keep any another row uses
+			for _, a := range purged.Attachments {
+				if inUse, err := h.DB.FileInUse(a.Path); err == nil && !inUse {
+					if err := h.Store.RemoveFile(a.Path); err != nil {
+						log.Printf("remove purged attachment %s: %v", a.Path, err)
+					}
+				}
+				if a.ThumbPath != nil {
+					if inUse, err := h.DB.FileInUse(*a.ThumbPath); err == nil && !inUse {
+						h.Store.RemoveFile(*a.ThumbPath)
+					}
+				}
+			}
+		}
+		log.Printf("AUDIT: admin %s purged message %s", c.UserID, d.MessageID)
+	} else if err := h.DB.DeleteMessage(d.MessageID); err != nil {
 		log.Printf("delete message: %v", err)
+		c.sendError("delete_message", ErrCodeInternal, "failed to delete message")
 		return
 	}
 
@@ -546,37 +878,120 @@ func (h *Hub) handleDeleteMessage(c *Client, data json.RawMessage) {
 	h.BroadcastAll(broadcast)
 }
 
-func isValidEmoji(s string) bool {
-	r := []rune(s)
-	return len(r) >= 1 && len(r) <= 10 && len(s) <= 32
-}
-
 func (h *Hub) handleAddReaction(c *Client, data json.RawMessage) {
 	var d ReactionData
 	if err := json.Unmarshal(data, &d); err != nil {
+		c.sendError("add_reaction", ErrCodeInvalid, "malformed payload")
 		return
 	}
 
-	if !isValidEmoji(d.Emoji) {
+	if !IsValidEmoji(d.Emoji) {
+		denied, _ := NewMessage("reaction_denied", ReactionDeniedPayload{
+			MessageID: d.MessageID,
+			Emoji:     d.Emoji,
+			Reason:    "not a valid emoji",
+		})
+		c.Send(denied)
+		return
+	}
+
+	if !h.reactionAllowed(d.Emoji) {
+		c.sendError("add_reaction", ErrCodeReactionNotAllowed, "that emoji isn't one of this server's reactions")
 		return
 	}
 
 	msg, _ := h.DB.GetMessageByID(d.MessageID)
 	if msg == nil || msg.DeletedAt != nil {
+		c.sendError("add_reaction", ErrCodeNotFound, "message not found")
 		return
 	}
 
-	if err := h.DB.AddReaction(d.MessageID, c.UserID, d.Emoji); err != nil {
-		log.Printf("add reaction: %v", err)
+	duplicate, reason := h.checkReactionLimits(d.MessageID, c.UserID, d.Emoji)
+	if reason != "" {
+		denied, _ := NewMessage("reaction_denied", ReactionDeniedPayload{
+			MessageID: d.MessageID,
+			Emoji:     d.Emoji,
+			Reason:    reason,
+		})
+		c.Send(denied)
 		return
 	}
 
-	broadcast, _ := NewMessage("reaction_add", ReactionAddPayload{
+	added, _ := NewMessage("reaction_add", ReactionAddPayload{
 		MessageID: d.MessageID,
 		UserID:    c.UserID,
 		Emoji:     d.Emoji,
 	})
-	h.BroadcastAll(broadcast)
+	if duplicate {
+		// Already there (a double click or a retry): confirm it to the
+		// sender only, since nobody else's view changes
+		c.Send(added)
+		return
+	}
+
+	if err := h.DB.AddReaction(d.MessageID, c.UserID, d.Emoji); err != nil {
+		log.Printf("add reaction: %v", err)
+		c.sendError("add_reaction", ErrCodeInternal, "failed to add reaction")
+		return
+	}
+	h.broadcastReaction(c.UserID, d.MessageID, d.Emoji, true, added)
+}
+
+// reactionAllowed reports whether emoji is on the allowed_reactions list,
+// or the list is empty. Reactions already on messages are left alone when
+// the list changes.
+func (h *Hub) reactionAllowed(emoji string) bool {
+	allowed, err := h.DB.GetAllowedReactions()
+	if err != nil {
+		log.Printf("get allowed reactions: %v", err)
+	}
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, a := range allowed {
+		if SameEmoji(a, emoji) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReactionLimits reports whether userID already has this reaction on
+// the message, and otherwise a reason adding it would exceed the
+// per-message caps ("" if it's allowed).
+func (h *Hub) checkReactionLimits(messageID, userID, emoji string) (bool, string) {
+	exists, mine, err := h.DB.HasReaction(messageID, userID, emoji)
+	if err != nil {
+		log.Printf("check reaction limits: %v", err)
+		return false, "internal error"
+	}
+	if mine {
+		return true, ""
+	}
+
+	if h.MaxReactionsPerUser > 0 {
+		n, err := h.DB.CountUserReactions(messageID, userID)
+		if err != nil {
+			log.Printf("check reaction limits: %v", err)
+			return false, "internal error"
+		}
+		if n >= h.MaxReactionsPerUser {
+			return false, fmt.Sprintf("you can add at most %d reactions to a message", h.MaxReactionsPerUser)
+		}
+	}
+
+	if !exists && h.MaxReactionEmojis > 0 {
+		n, err := h.DB.CountDistinctReactions(messageID)
+		if err != nil {
+			log.Printf("check reaction limits: %v", err)
+			return false, "internal error"
+		}
+		if n >= h.MaxReactionEmojis {
+			return false, fmt.Sprintf("a message can have at most %d different reactions", h.MaxReactionEmojis)
+		}
+	}
+
+	return false, ""
 }
 
 func (h *Hub) handleRemoveReaction(c *Client, data json.RawMessage) {
@@ -595,7 +1010,7 @@ func (h *Hub) handleRemoveReaction(c *Client, data json.RawMessage) {
 		UserID:    c.UserID,
 		Emoji:     d.Emoji,
 	})
-	h.BroadcastAll(broadcast)
+	h.broadcastReaction(c.UserID, d.MessageID, d.Emoji, false, broadcast)
 }
 
 func (h *Hub) handleTypingStart(c *Client, data json.RawMessage) {
@@ -608,7 +1023,37 @@ func (h *Hub) handleTypingStart(c *Client, data json.RawMessage) {
 		ChannelID: d.ChannelID,
 		UserID:    c.UserID,
 	})
-	h.BroadcastExcept(broadcast, c.UserID)
+	h.BroadcastToChannelViewers(broadcast, d.ChannelID, c.UserID)
+}
+
+// handleViewChannel records which channel this connection is looking at.
+// An empty channel_id means none (e.g. the tab is hidden).
+func (h *Hub) handleViewChannel(c *Client, data json.RawMessage) {
+	var d ViewChannelData
+	if err := json.Unmarshal(data, &d); err != nil {
+		c.sendError("view_channel", ErrCodeInvalid, "malformed payload")
+		return
+	}
+	c.setViewing(d.ChannelID)
+}
+
+func (h *Hub) handleSetStatus(c *Client, data json.RawMessage) {
+	var d SetStatusData
+	if err := json.Unmarshal(data, &d); err != nil {
+		c.sendError("set_status", ErrCodeInvalid, "malformed payload")
+		return
+	}
+	if d.Status != StatusOnline && d.Status != StatusDND {
+		c.sendError("set_status", ErrCodeInvalid, "unknown status")
+		return
+	}
+
+	h.setUserStatus(c.UserID, d.Status)
+	broadcast, _ := NewMessage("presence_update", PresenceUpdatePayload{
+		UserID: c.UserID,
+		Status: d.Status,
+	})
+	h.BroadcastAll(broadcast)
 }
 
 func (h *Hub) canManageChannel(c *Client, channelID string) bool {
@@ -625,13 +1070,16 @@ func (h *Hub) canManageChannel(c *Client, channelID string) bool {
 func (h *Hub) handleCreateChannel(c *Client, data json.RawMessage) {
 	var d CreateChannelData
 	if err := json.Unmarshal(data, &d); err != nil {
+		c.sendError("create_channel", ErrCodeInvalid, "malformed payload")
 		return
 	}
 
 	if d.Name == "" || len(d.Name) > 32 {
+		c.sendError("create_channel", ErrCodeInvalid, "name must be 1-32 characters")
 		return
 	}
 	if d.Type != "voice" && d.Type != "text" {
+		c.sendError("create_channel", ErrCodeInvalid, "type must be voice or text")
 		return
 	}
 
@@ -639,6 +1087,7 @@ func (h *Hub) handleCreateChannel(c *Client, data json.RawMessage) {
 	ch, err := h.DB.CreateChannel(chID, d.Name, d.Type, c.UserID)
 	if err != nil {
 		log.Printf("create channel: %v", err)
+		c.sendError("create_channel", ErrCodeInternal, "failed to create channel")
 		return
 	}
 
@@ -650,6 +1099,8 @@ func (h *Hub) handleCreateChannel(c *Client, data json.RawMessage) {
 		ManagerIDs: []string{c.UserID},
 		Visibility: ch.Visibility,
 		Description: ch.Description,
+		AllowAttachments: ch.AllowAttachments,
+		AllowLinks:       ch.AllowLinks,
 	})
 	h.BroadcastAll(broadcast)
 }
@@ -657,10 +1108,12 @@ func (h *Hub) handleCreateChannel(c *Client, data json.RawMessage) {
 func (h *Hub) handleDeleteChannel(c *Client, data json.RawMessage) {
 	var d DeleteChannelData
 	if err := json.Unmarshal(data, &d); err != nil {
+		c.sendError("delete_channel", ErrCodeInvalid, "malformed payload")
 		return
 	}
 
 	if !h.canManageChannel(c, d.ChannelID) {
+		c.sendError("delete_channel", ErrCodeDenied, "you can't manage this channel")
 		return
 	}
 
@@ -682,6 +1135,7 @@ func (h *Hub) handleDeleteChannel(c *Client, data json.RawMessage) {
 
 	if err := h.DB.DeleteChannel(d.ChannelID); err != nil {
 		log.Printf("delete channel: %v", err)
+		c.sendError("delete_channel", ErrCodeInternal, "failed to delete channel")
 		return
 	}
 
@@ -694,20 +1148,24 @@ func (h *Hub) handleDeleteChannel(c *Client, data json.RawMessage) {
 func (h *Hub) handleRenameChannel(c *Client, data json.RawMessage) {
 	var d RenameChannelData
 	if err := json.Unmarshal(data, &d); err != nil {
+		c.sendError("rename_channel", ErrCodeInvalid, "malformed payload")
 		return
 	}
 
 	name := strings.TrimSpace(d.Name)
 	if name == "" || len(name) > 32 {
+		c.sendError("rename_channel", ErrCodeInvalid, "name must be 1-32 characters")
 		return
 	}
 
 	if !h.canManageChannel(c, d.ChannelID) {
+		c.sendError("rename_channel", ErrCodeDenied, "you can't manage this channel")
 		return
 	}
 
 	if err := h.DB.RenameChannel(d.ChannelID, name); err != nil {
 		log.Printf("rename channel: %v", err)
+		c.sendError("rename_channel", ErrCodeInternal, "failed to rename channel")
 		return
 	}
 
@@ -727,15 +1185,18 @@ func (h *Hub) handleRenameChannel(c *Client, data json.RawMessage) {
 func (h *Hub) handleRestoreChannel(c *Client, data json.RawMessage) {
 	var d RestoreChannelData
 	if err := json.Unmarshal(data, &d); err != nil {
+		c.sendError("restore_channel", ErrCodeInvalid, "malformed payload")
 		return
 	}
 
 	if !c.User.IsAdmin {
+		c.sendError("restore_channel", ErrCodeDenied, "admin only")
 		return
 	}
 
 	if err := h.DB.RestoreChannel(d.ChannelID); err != nil {
 		log.Printf("restore channel: %v", err)
+		c.sendError("restore_channel", ErrCodeInternal, "failed to restore channel")
 		return
 	}
 
@@ -758,6 +1219,56 @@ func (h *Hub) handleRestoreChannel(c *Client, data json.RawMessage) {
 		ManagerIDs: managerIDs,
 		Visibility: ch.Visibility,
 		Description: ch.Description,
+		Announcement: ch.Announcement,
+		AllowAttachments: ch.AllowAttachments,
+		AllowLinks:       ch.AllowLinks,
+	})
+	h.BroadcastAll(broadcast)
+}
+
+func (h *Hub) handleSetChannelRestrictions(c *Client, data json.RawMessage) {
+	var d SetChannelRestrictionsData
+	if err := json.Unmarshal(data, &d); err != nil {
+		c.sendError("set_channel_restrictions", ErrCodeInvalid, "malformed payload")
+		return
+	}
+
+	if !h.canManageChannel(c, d.ChannelID) {
+		c.sendError("set_channel_restrictions", ErrCodeDenied, "you can't manage this channel")
+		return
+	}
+
+	ch, err := h.DB.GetChannelByID(d.ChannelID)
+	if err != nil || ch == nil {
+		c.sendError("set_channel_restrictions", ErrCodeNotFound, "channel not found")
+		return
+	}
+	allowAttachments, allowLinks := ch.AllowAttachments, ch.AllowLinks
+	if d.AllowAttachments != nil {
+		allowAttachments = *d.AllowAttachments
+	}
+	if d.AllowLinks != nil {
+		allowLinks = *d.AllowLinks
+	}
+
+	if err := h.DB.UpdateChannelRestrictions(d.ChannelID, allowAttachments, allowLinks); err != nil {
+		log.Printf("set channel restrictions: %v", err)
+		c.sendError("set_channel_restrictions", ErrCodeInternal, "failed to update channel restrictions")
+		return
+	}
+	log.Printf("AUDIT: user %s (%s) set channel %s restrictions: attachments=%t links=%t", c.UserID, c.User.Username, d.ChannelID, allowAttachments, allowLinks)
+
+	managerIDs, _ := h.DB.GetChannelManagers(d.ChannelID)
+	if managerIDs == nil {
+		managerIDs = []string{}
+	}
+
+	broadcast, _ := NewMessage("channel_update", ChannelUpdatePayload{
+		ID:               d.ChannelID,
+		Name:             ch.Name,
+		ManagerIDs:       managerIDs,
+		AllowAttachments: &allowAttachments,
+		AllowLinks:       &allowLinks,
 	})
 	h.BroadcastAll(broadcast)
 }
@@ -765,15 +1276,18 @@ func (h *Hub) handleRestoreChannel(c *Client, data json.RawMessage) {
 func (h *Hub) handleAddChannelManager(c *Client, data json.RawMessage) {
 	var d ChannelManagerData
 	if err := json.Unmarshal(data, &d); err != nil {
+		c.sendError("add_channel_manager", ErrCodeInvalid, "malformed payload")
 		return
 	}
 
 	if !h.canManageChannel(c, d.ChannelID) {
+		c.sendError("add_channel_manager", ErrCodeDenied, "you can't manage this channel")
 		return
 	}
 
 	if err := h.DB.AddChannelManager(d.ChannelID, d.UserID); err != nil {
 		log.Printf("add channel manager: %v", err)
+		c.sendError("add_channel_manager", ErrCodeInternal, "failed to add channel manager")
 		return
 	}
 
@@ -798,15 +1312,18 @@ func (h *Hub) handleAddChannelManager(c *Client, data json.RawMessage) {
 func (h *Hub) handleRemoveChannelManager(c *Client, data json.RawMessage) {
 	var d ChannelManagerData
 	if err := json.Unmarshal(data, &d); err != nil {
+		c.sendError("remove_channel_manager", ErrCodeInvalid, "malformed payload")
 		return
 	}
 
 	if !h.canManageChannel(c, d.ChannelID) {
+		c.sendError("remove_channel_manager", ErrCodeDenied, "you can't manage this channel")
 		return
 	}
 
 	if err := h.DB.RemoveChannelManager(d.ChannelID, d.UserID); err != nil {
 		log.Printf("remove channel manager: %v", err)
+		c.sendError("remove_channel_manager", ErrCodeInternal, "failed to remove channel manager")
 		return
 	}
 
@@ -830,16 +1347,19 @@ func (h *Hub) handleRemoveChannelManager(c *Client, data json.RawMessage) {
 
 func (h *Hub) handleReorderChannels(c *Client, data json.RawMessage) {
 	if !c.User.IsAdmin {
+		c.sendError("reorder_channels", ErrCodeDenied, "admin only")
 		return
 	}
 
 	var d ReorderChannelsData
 	if err := json.Unmarshal(data, &d); err != nil {
+		c.sendError("reorder_channels", ErrCodeInvalid, "malformed payload")
 		return
 	}
 
 	if err := h.DB.ReorderChannels(d.ChannelIDs); err != nil {
 		log.Printf("reorder channels: %v", err)
+		c.sendError("reorder_channels", ErrCodeInternal, "failed to reorder channels")
 		return
 	}
 
@@ -853,6 +1373,9 @@ func (h *Hub) handleReorderChannels(c *Client, data json.RawMessage) {
 
 type JoinVoiceData struct {
 	ChannelID string `json:"channel_id"`
+	// Endpoint is the caller's preferred SFU endpoint (one of ready's
+	// voice_endpoints). It only matters when the call isn't running yet.
+	Endpoint string `json:"endpoint,omitempty"`
 }
 
 type WebRTCAnswerData struct {
@@ -884,6 +1407,27 @@ type VoiceServerMuteData struct {
 	Muted  bool   `json:"muted"`
 }
 
+type VoiceKickData struct {
+	UserID string `json:"user_id"`
+}
+
+type VoiceKickedPayload struct {
+	ChannelID string `json:"channel_id"`
+	KickedBy  string `json:"kicked_by"`
+}
+
+type SetPrioritySpeakerData struct {
+	ChannelID string `json:"channel_id"`
+	UserID    string `json:"user_id"`
+}
+
+type VoiceDuckingPayload struct {
+	ChannelID string  `json:"channel_id"`
+	UserID    string  `json:"user_id"`
+	Active    bool    `json:"active"`
+	Gain      float64 `json:"gain"`
+}
+
 func (h *Hub) handleJoinVoice(c *Client, data json.RawMessage) {
 	if h.SFU == nil {
 		return
@@ -932,7 +1476,7 @@ func (h *Hub) handleJoinVoice(c *Client, data json.RawMessage) {
 	}
 
 	// Join new room
-	room := h.SFU.GetOrCreateRoom(d.ChannelID)
+	room, endpoint := h.SFU.GetOrCreateRoom(d.ChannelID, d.Endpoint)
 	_, err = room.AddPeer(c.UserID)
 	if err != nil {
 		log.Printf("sfu: add peer %s to room %s: %v", c.UserID, d.ChannelID, err)
@@ -953,6 +1497,7 @@ func (h *Hub) handleJoinVoice(c *Client, data json.RawMessage) {
 	joinMsg, _ := NewMessage("voice_state_update", VoiceStatePayload{
 		UserID:    c.UserID,
 		ChannelID: d.ChannelID,
+		Endpoint:  endpoint,
 	})
 	h.BroadcastAll(joinMsg)
 }
@@ -1054,6 +1599,7 @@ func (h *Hub) handleVoiceSelfMute(c *Client, data json.RawMessage) {
 		SelfDeafen: vs.SelfDeafen,
 		ServerMute: vs.ServerMute,
 		Speaking:   vs.Speaking,
+		Priority:   vs.Priority,
 	})
 	h.BroadcastAll(msg)
 }
@@ -1087,6 +1633,7 @@ func (h *Hub) handleVoiceSelfDeafen(c *Client, data json.RawMessage) {
 		SelfDeafen: vs.SelfDeafen,
 		ServerMute: vs.ServerMute,
 		Speaking:   vs.Speaking,
+		Priority:   vs.Priority,
 	})
 	h.BroadcastAll(msg)
 }
@@ -1120,8 +1667,84 @@ func (h *Hub) handleVoiceSpeaking(c *Client, data json.RawMessage) {
 		SelfDeafen: vs.SelfDeafen,
 		ServerMute: vs.ServerMute,
 		Speaking:   vs.Speaking,
+		Priority:   vs.Priority,
 	})
 	h.BroadcastAll(msg)
+
+	// Priority speaker started/stopped talking — tell the room's
+	// participants to duck (or restore) everyone else.
+	if vs.Priority {
+		h.broadcastVoiceDucking(room, vs.UserID, vs.Speaking)
+	}
+}
+
+func (h *Hub) broadcastVoiceDucking(room *sfu.Room, userID string, active bool) {
+	msg, _ := NewMessage("voice_ducking", VoiceDuckingPayload{
+		ChannelID: room.ChannelID,
+		UserID:    userID,
+		Active:    active,
+		Gain:      sfu.DuckGain,
+	})
+	for _, uid := range room.PeerIDs() {
+		h.SendToVoiceClient(uid, msg)
+	}
+}
+
+// handleSetPrioritySpeaker grants priority speaker to a peer in a voice
+// channel (or clears it when user_id is empty). Channel managers and
+// admins only. Priority is dropped automatically when the peer leaves,
+// since it lives on the SFU peer.
+func (h *Hub) handleSetPrioritySpeaker(c *Client, data json.RawMessage) {
+	if h.SFU == nil {
+		return
+	}
+
+	var d SetPrioritySpeakerData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return
+	}
+
+	var room *sfu.Room
+	if d.ChannelID != "" {
+		room = h.SFU.GetRoom(d.ChannelID)
+	} else if d.UserID != "" {
+		room = h.SFU.GetUserRoom(d.UserID)
+	}
+	if room == nil {
+		return
+	}
+
+	if !h.canManageChannel(c, room.ChannelID) {
+		return
+	}
+
+	// Stop any ducking held by the outgoing priority speaker
+	if prevID, active := room.Ducking(); active && prevID != d.UserID {
+		h.broadcastVoiceDucking(room, prevID, false)
+	}
+
+	changed, err := room.SetPrioritySpeaker(d.UserID)
+	if err != nil {
+		log.Printf("set priority speaker: %v", err)
+		return
+	}
+
+	for _, vs := range changed {
+		msg, _ := NewMessage("voice_state_update", VoiceStatePayload{
+			UserID:     vs.UserID,
+			ChannelID:  vs.ChannelID,
+			SelfMute:   vs.SelfMute,
+			SelfDeafen: vs.SelfDeafen,
+			ServerMute: vs.ServerMute,
+			Speaking:   vs.Speaking,
+			Priority:   vs.Priority,
+		})
+		h.BroadcastAll(msg)
+	}
+
+	if userID, active := room.Ducking(); active {
+		h.broadcastVoiceDucking(room, userID, true)
+	}
 }
 
 const maxShareLabel = 64
@@ -1138,11 +1761,7 @@ func (h *Hub) handleVoiceShareAudioStart(c *Client, data json.RawMessage) {
 
 	label := strings.TrimSpace(d.Label)
 	if label == "" {
-		errMsg, _ := NewMessage("error", map[string]string{
-			"op":     "voice_share_audio_start",
-			"reason": "label required",
-		})
-		c.Send(errMsg)
+		c.sendError("voice_share_audio_start", ErrCodeInvalid, "label required")
 		return
 	}
 	if len(label) > maxShareLabel {
@@ -1151,21 +1770,13 @@ func (h *Hub) handleVoiceShareAudioStart(c *Client, data json.RawMessage) {
 
 	room := h.SFU.GetUserRoom(c.UserID)
 	if room == nil {
-		errMsg, _ := NewMessage("error", map[string]string{
-			"op":     "voice_share_audio_start",
-			"reason": "not in voice channel",
-		})
-		c.Send(errMsg)
+		c.sendError("voice_share_audio_start", ErrCodeDenied, "not in voice channel")
 		return
 	}
 
 	sourceID := uuid.New().String()
 	if err := room.StartShare(c.UserID, sourceID, label); err != nil {
-		errMsg, _ := NewMessage("error", map[string]string{
-			"op":     "voice_share_audio_start",
-			"reason": err.Error(),
-		})
-		c.Send(errMsg)
+		c.sendError("voice_share_audio_start", ErrCodeInvalid, err.Error())
 		return
 	}
 
@@ -1248,9 +1859,29 @@ type WebRTCScreenICEData struct {
 	Role      string                  `json:"role"`
 }
 
+type ScreenShareStartData struct {
+	Quality string `json:"quality"`
+}
+
+type ScreenShareSetQualityData struct {
+	Quality string `json:"quality"`
+}
+
 type ScreenSharePayload struct {
 	UserID    string `json:"user_id"`
 	ChannelID string `json:"channel_id"`
+	Quality   string `json:"quality,omitempty"`
+}
+
+// ScreenShareQualityPayload tells the presenter how to configure its
+// video sender for the chosen preset: the SFU caps bitrate via REMB but
+// can't rescale frames, so the presenter applies scale_down itself.
+type ScreenShareQualityPayload struct {
+	UserID     string  `json:"user_id"`
+	ChannelID  string  `json:"channel_id"`
+	Quality    string  `json:"quality"`
+	MaxBitrate uint64  `json:"max_bitrate"`
+	ScaleDown  float64 `json:"scale_down"`
 }
 
 type ScreenShareErrorPayload struct {
@@ -1274,7 +1905,13 @@ func (h *Hub) handleScreenShareStart(c *Client, data json.RawMessage) {
 
 	channelID := room.ChannelID
 
-	sr, err := h.SFU.StartScreenShare(channelID, c.UserID)
+	// Body is optional; older clients send {}
+	var d ScreenShareStartData
+	if len(data) > 0 {
+		json.Unmarshal(data, &d)
+	}
+
+	sr, err := h.SFU.StartScreenShare(channelID, c.UserID, d.Quality)
 	if err != nil {
 		log.Printf("screen share start: %v", err)
 		msg, _ := NewMessage("screen_share_error", ScreenShareErrorPayload{
@@ -1283,15 +1920,64 @@ func (h *Hub) handleScreenShareStart(c *Client, data json.RawMessage) {
 		c.Send(msg)
 		return
 	}
-	_ = sr
+
+	h.sendScreenShareQuality(c, sr)
 
 	broadcast, _ := NewMessage("screen_share_started", ScreenSharePayload{
 		UserID:    c.UserID,
 		ChannelID: channelID,
+		Quality:   sr.Quality(),
 	})
 	h.BroadcastAll(broadcast)
 }
 
+// handleScreenShareSetQuality lets the presenter change quality mid-share.
+// Everyone is told so viewers can show the current preset.
+func (h *Hub) handleScreenShareSetQuality(c *Client, data json.RawMessage) {
+	if h.SFU == nil {
+		return
+	}
+
+	var d ScreenShareSetQualityData
+	if err := json.Unmarshal(data, &d); err != nil {
+		return
+	}
+
+	sr := h.SFU.GetUserScreenRoom(c.UserID)
+	if sr == nil {
+		return
+	}
+
+	if err := sr.SetQuality(d.Quality); err != nil {
+		msg, _ := NewMessage("screen_share_error", ScreenShareErrorPayload{
+			Error: err.Error(),
+		})
+		c.Send(msg)
+		return
+	}
+
+	h.sendScreenShareQuality(nil, sr)
+}
+
+// sendScreenShareQuality sends the room's current quality profile to c,
+// or broadcasts it to everyone when c is nil.
+func (h *Hub) sendScreenShareQuality(c *Client, sr *sfu.ScreenRoom) {
+	quality := sr.Quality()
+	profile, _ := sfu.ScreenQuality(quality)
+	msg, _ := NewMessage("screen_share_quality", ScreenShareQualityPayload{
+		UserID:     sr.PresenterID,
+		ChannelID:  sr.ChannelID,
+		Quality:    quality,
+		MaxBitrate: profile.MaxBitrate,
+		ScaleDown:  profile.ScaleDown,
+	})
+	if c != nil {
+		c.Send(msg)
+		return
+	}
+	h.BroadcastAll(msg)
+}
+
 func (h *Hub) handleScreenShareStop(c *Client) {
 	if h.SFU == nil {
 		return
@@ -1409,6 +2095,59 @@ func (h *Hub) handleVoiceServerMute(c *Client, data json.RawMessage) {
 		SelfDeafen: vs.SelfDeafen,
 		ServerMute: vs.ServerMute,
 		Speaking:   vs.Speaking,
+		Priority:   vs.Priority,
+	})
+	h.BroadcastAll(msg)
+}
+
+// handleVoiceKick ejects a user from their voice channel without touching
+// their WebSocket. Channel managers and admins only. The kicked
+// connection gets voice_kicked so it can tear down WebRTC; everyone sees
+// the usual voice_state_update leave.
+func (h *Hub) handleVoiceKick(c *Client, data json.RawMessage) {
+	if h.SFU == nil {
+		return
+	}
+
+	var d VoiceKickData
+	if err := json.Unmarshal(data, &d); err != nil || d.UserID == "" {
+		c.sendError("voice_kick", ErrCodeInvalid, "user_id is required")
+		return
+	}
+	if d.UserID == c.UserID {
+		c.sendError("voice_kick", ErrCodeInvalid, "use leave_voice to leave")
+		return
+	}
+
+	room := h.SFU.GetUserRoom(d.UserID)
+	if room == nil {
+		c.sendError("voice_kick", ErrCodeNotFound, "user is not in voice")
+		return
+	}
+	if !h.canManageChannel(c, room.ChannelID) {
+		c.sendError("voice_kick", ErrCodeDenied, "not allowed to kick from this channel")
+		return
+	}
+
+	// Tell the kicked connection before dropping its voice ownership
+	kicked, _ := NewMessage("voice_kicked", VoiceKickedPayload{
+		ChannelID: room.ChannelID,
+		KickedBy:  c.UserID,
+	})
+	h.SendToVoiceClient(d.UserID, kicked)
+
+	h.mu.Lock()
+	delete(h.voiceClients, d.UserID)
+	h.mu.Unlock()
+
+	if sr := h.SFU.GetUserScreenRoom(d.UserID); sr != nil {
+		h.SFU.StopScreenShare(sr.ChannelID)
+	}
+	room.RemovePeer(d.UserID)
+
+	msg, _ := NewMessage("voice_state_update", VoiceStatePayload{
+		UserID:    d.UserID,
+		ChannelID: "",
 	})
 	h.BroadcastAll(msg)
 }
@@ -5,11 +5,14 @@ import (
 	"log"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/kalman/voicechat/config"
 	"github.com/kalman/voicechat/db"
 	"github.com/kalman/voicechat/email"
 	"github.com/kalman/voicechat/sfu"
+	"github.com/kalman/voicechat/storage"
 	"nhooyr.io/websocket"
 )
 
@@ -29,6 +32,21 @@ type RadioPlaybackState struct {
 	UpdatedAt  float64
 	UserID     string
 	Tracks     []RadioTrackPayload // cached track list for the playlist
+	// Intro is the station's intro track while it plays ahead of
+	// Tracks[0]; TrackIndex is -1 until it ends or is skipped
+	Intro *RadioTrackPayload
+}
+
+// current returns the track the station is on, or a zero track if the
+// index is out of range.
+func (s *RadioPlaybackState) current() RadioTrackPayload {
+	if s.Intro != nil {
+		return *s.Intro
+	}
+	if s.TrackIndex >= 0 && s.TrackIndex < len(s.Tracks) {
+		return s.Tracks[s.TrackIndex]
+	}
+	return RadioTrackPayload{}
 }
 
 type StrudelPlaybackState struct {
@@ -42,9 +60,62 @@ type StrudelPlaybackState struct {
 
 type Hub struct {
 	DB             *db.DB
-	SFU            *sfu.SFU
+	SFU            *sfu.Registry
 	EmailService   *email.EmailService
+	Store          *storage.FileStore
 	DevMode        bool
+	// TrustedOrigins are the cross-origin web clients allowed to open a
+	// WebSocket (see config.OriginAllowed). Ignored in dev mode.
+	TrustedOrigins []string
+	// PingInterval is how often each connection is sent a ping frame;
+	// PingTimeout is how long its pong may take before the connection is
+	// dropped. Zero interval disables the heartbeat.
+	PingInterval time.Duration
+	PingTimeout  time.Duration
+	// OnBroadcast, if set, sees every message sent with BroadcastAll,
+	// BroadcastExcept or BroadcastToMembers (outgoing webhooks tee from
+	// here). It must not block.
+	OnBroadcast func(msg []byte)
+	// RadioSyncInterval is how often playing stations' positions are
+	// refreshed and sent to their listeners as radio_position. Zero
+	// disables the sync.
+	RadioSyncInterval time.Duration
+	// Reaction caps, per message. Zero disables the check.
+	MaxReactionEmojis   int
+	MaxReactionsPerUser int
+	// MaxMentions caps the distinct users one message may mention; a
+	// message over it is rejected. Zero disables the check.
+	MaxMentions int
+	// ReactionBurstWindow is how long further reactions to the same
+	// (message, emoji) after a broadcast one are held and merged into a
+	// single reaction_update. Zero broadcasts every change as it happens.
+	ReactionBurstWindow time.Duration
+	// OnlineBurstWindow and OnlineBurstSize smooth reconnect storms: once
+	// OnlineBurstSize users have come online within OnlineBurstWindow, the
+	// rest of that window's arrivals go out as one users_online_bulk. Zero
+	// in either sends a user_online for every arrival.
+	OnlineBurstWindow time.Duration
+	OnlineBurstSize   int
+	// MaxMessageBytes caps one inbound WebSocket message. Larger ones are
+	// dropped and answered with a message_too_large error.
+	MaxMessageBytes int64
+	// Caps on open WebSocket connections, authenticated or not: per client
+	// IP and in total. Zero disables a cap. Loopback is exempt in dev mode.
+	MaxConnsPerIP int
+	MaxConns      int
+	connsByIP     map[string]int
+	connTotal     int
+	connMu        sync.Mutex
+	reactionBursts      map[reactionKey]*reactionBurst
+	reactionMu          sync.Mutex
+	onlineBurst         *onlineBurst
+	onlineMu            sync.Mutex
+	onlineCountPending  bool // an online_count broadcast is scheduled
+	onlineCountSent     int  // the count last broadcast
+	onlineCountMu       sync.Mutex
+	lastSeenPending     map[string]bool // users awaiting a last_seen_at write
+	lastSeenWriting     bool            // a flushLastSeen is running
+	lastSeenMu          sync.Mutex
 	applets        *AppletRegistry
 	clients        map[string][]*Client // userID → clients (multiple connections)
 	mu             sync.RWMutex
@@ -62,10 +133,13 @@ type Hub struct {
 	strudelViewers  map[string]map[string]bool // patternID → set of userIDs
 	strudelViewMu   sync.RWMutex
 	voiceClients    map[string]*Client // userID → the connection that owns voice
+	statuses        map[string]string  // userID → presence status; absent means online
 	done            chan struct{}
+	// laggingDisconnects counts clients force-closed for a full send buffer
+	laggingDisconnects atomic.Int64
 }
 
-func NewHub(database *db.DB, sfuInstance *sfu.SFU, emailSvc *email.EmailService, devMode bool) *Hub {
+func NewHub(database *db.DB, sfuInstance *sfu.Registry, emailSvc *email.EmailService, devMode bool) *Hub {
 	applets := NewAppletRegistry()
 	applets.Register(RadioApplet())
 	applets.Register(MediaApplet())
@@ -76,6 +150,20 @@ func NewHub(database *db.DB, sfuInstance *sfu.SFU, emailSvc *email.EmailService,
 		SFU:             sfuInstance,
 		EmailService:    emailSvc,
 		DevMode:         devMode,
+		PingInterval:    30 * time.Second,
+		PingTimeout:     10 * time.Second,
+		RadioSyncInterval: 5 * time.Second,
+		MaxReactionEmojis:   20,
+		MaxReactionsPerUser: 10,
+		MaxMentions:         20,
+		ReactionBurstWindow: 300 * time.Millisecond,
+		OnlineBurstWindow:   time.Second,
+		OnlineBurstSize:     10,
+		MaxMessageBytes:     32768,
+		MaxConnsPerIP:       20,
+		MaxConns:            5000,
+		connsByIP:           make(map[string]int),
+		reactionBursts:      make(map[reactionKey]*reactionBurst),
 		applets:         applets,
 		clients:         make(map[string][]*Client),
 		register:        make(chan *Client),
@@ -86,33 +174,36 @@ func NewHub(database *db.DB, sfuInstance *sfu.SFU, emailSvc *email.EmailService,
 		strudelPlayback: make(map[string]*StrudelPlaybackState),
 		strudelViewers:  make(map[string]map[string]bool),
 		voiceClients:    make(map[string]*Client),
+		statuses:        make(map[string]string),
 		done:            make(chan struct{}),
 	}
 }
 
 func (h *Hub) Run() {
+	if h.RadioSyncInterval > 0 {
+		go h.radioPositionLoop()
+	}
 	for {
 		select {
 		case <-h.done:
 			return
 		case client := <-h.register:
 			h.mu.Lock()
+			// The send buffer is still empty, so this can't block
+			client.send <- client.ready
+			client.ready = nil
 			wasOnline := len(h.clients[client.UserID]) > 0
 			h.clients[client.UserID] = append(h.clients[client.UserID], client)
 			h.mu.Unlock()
 
 			// Broadcast user_online only on first connection for this user
 			if !wasOnline {
-				msg, err := NewMessage("user_online", UserOnlineData{
-					User: UserPayload{
-						ID:       client.User.ID,
-						Username: client.User.Username,
-						IsAdmin:  client.User.IsAdmin,
-					},
+				h.announceOnline(UserPayload{
+					ID:       client.User.ID,
+					Username: client.User.Username,
+					IsAdmin:  client.User.IsAdmin,
 				})
-				if err == nil {
-					h.BroadcastExcept(msg, client.UserID)
-				}
+				h.onlineCountChanged()
 			}
 
 		case client := <-h.unregister:
@@ -127,6 +218,7 @@ func (h *Hub) Run() {
 			lastConn := len(h.clients[client.UserID]) == 0
 			if lastConn {
 				delete(h.clients, client.UserID)
+				delete(h.statuses, client.UserID)
 			}
 			// Check if this was the voice-owning connection
 			isVoiceClient := h.voiceClients[client.UserID] == client
@@ -159,6 +251,8 @@ func (h *Hub) Run() {
 				// Applet cleanup (radio listeners, strudel viewers, etc.)
 				h.applets.OnDisconnect(h, client)
 
+				h.lastSeenChanged(client.UserID)
+
 				// Broadcast user_offline
 				msg, err := NewMessage("user_offline", UserOfflineData{
 					UserID: client.UserID,
@@ -166,20 +260,24 @@ func (h *Hub) Run() {
 				if err == nil {
 					h.BroadcastAll(msg)
 				}
+				h.onlineCountChanged()
 			}
 
 		case msg := <-h.broadcast:
-			h.mu.RLock()
-			for _, clients := range h.clients {
-				for _, client := range clients {
-					client.Send(msg)
-				}
-			}
-			h.mu.RUnlock()
+			h.BroadcastAll(msg)
 		}
 	}
 }
 
+// NotifyShutdown tells every connected client the server is going away
+// so they can tear down voice and wait reconnectAfter seconds before
+// reconnecting, rather than discovering it through dropped media and a
+// closed socket.
+func (h *Hub) NotifyShutdown(reconnectAfter int) {
+	msg, _ := NewMessage("server_shutdown", ServerShutdownPayload{ReconnectAfterSeconds: reconnectAfter})
+	h.BroadcastAll(msg)
+}
+
 func (h *Hub) Shutdown() {
 	log.Println("Closing all WebSocket connections...")
 	h.mu.RLock()
@@ -200,26 +298,78 @@ func (h *Hub) Shutdown() {
 	log.Printf("Closed %d WebSocket connections", len(allClients))
 }
 
-func (h *Hub) BroadcastAll(msg []byte) {
+// clientsWhere snapshots the connections accepted by keep. Broadcasts fan
+// out over the snapshot after releasing mu, so delivery never holds the
+// client map lock.
+func (h *Hub) clientsWhere(keep func(userID string, c *Client) bool) []*Client {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	for _, clients := range h.clients {
+	var out []*Client
+	for userID, clients := range h.clients {
 		for _, client := range clients {
-			client.Send(msg)
+			if keep == nil || keep(userID, client) {
+				out = append(out, client)
+			}
 		}
 	}
+	return out
+}
+
+func sendAll(clients []*Client, msg []byte) {
+	for _, client := range clients {
+		client.Send(msg)
+	}
+}
+
+func (h *Hub) BroadcastAll(msg []byte) {
+	sendAll(h.clientsWhere(nil), msg)
+	h.teeBroadcast(msg)
 }
 
 func (h *Hub) BroadcastExcept(msg []byte, excludeUserID string) {
-	h.mu.RLock()
-	defer h.mu.RUnlock()
-	for userID, clients := range h.clients {
-		if userID != excludeUserID {
-			for _, client := range clients {
-				client.Send(msg)
+	sendAll(h.clientsWhere(func(userID string, _ *Client) bool {
+		return userID != excludeUserID
+	}), msg)
+	h.teeBroadcast(msg)
+}
+
+func (h *Hub) teeBroadcast(msg []byte) {
+	if h.OnBroadcast != nil {
+		h.OnBroadcast(msg)
+	}
+}
+
+// BroadcastToChannelViewers sends msg to every connection currently
+// viewing channelID, except the excluded user's. Connections that have
+// never sent view_channel are treated as viewing everything so older
+// clients keep receiving these events. A connection in a voice call also
+// counts as viewing that channel, since its in-call chat stays open
+// whatever text channel is selected.
+func (h *Hub) BroadcastToChannelViewers(msg []byte, channelID, excludeUserID string) {
+	inCall := map[string]bool{}
+	if h.SFU != nil {
+		if room := h.SFU.GetRoom(channelID); room != nil {
+			for _, id := range room.PeerIDs() {
+				inCall[id] = true
 			}
 		}
 	}
+	sendAll(h.clientsWhere(func(userID string, c *Client) bool {
+		if userID == excludeUserID {
+			return false
+		}
+		if inCall[userID] && h.voiceClients[userID] == c {
+			return true
+		}
+		viewing, reported := c.Viewing()
+		return !reported || viewing == channelID
+	}), msg)
+}
+
+// LaggingDisconnects reports how many clients have been force-closed
+// because their send buffer filled up.
+func (h *Hub) LaggingDisconnects() int64 {
+	return h.laggingDisconnects.Load()
 }
 
 func (h *Hub) OnlineUsers() []UserPayload {
@@ -233,12 +383,33 @@ func (h *Hub) OnlineUsers() []UserPayload {
 				ID:       c.User.ID,
 				Username: c.User.Username,
 				IsAdmin:  c.User.IsAdmin,
+				Status:   h.statuses[c.User.ID],
 			})
 		}
 	}
 	return users
 }
 
+// UserStatus returns the user's presence status (StatusOnline unless set).
+func (h *Hub) UserStatus(userID string) string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if status, ok := h.statuses[userID]; ok {
+		return status
+	}
+	return StatusOnline
+}
+
+func (h *Hub) setUserStatus(userID, status string) {
+	h.mu.Lock()
+	if status == StatusOnline {
+		delete(h.statuses, userID)
+	} else {
+		h.statuses[userID] = status
+	}
+	h.mu.Unlock()
+}
+
 func (h *Hub) BroadcastToMembers(msg []byte, channelID string) {
 	memberIDs, _ := h.DB.GetChannelMemberIDs(channelID)
 	memberSet := make(map[string]bool, len(memberIDs))
@@ -246,21 +417,51 @@ func (h *Hub) BroadcastToMembers(msg []byte, channelID string) {
 		memberSet[id] = true
 	}
 
+	sendAll(h.clientsWhere(func(userID string, c *Client) bool {
+		return memberSet[userID] || (c.User != nil && c.User.IsAdmin)
+	}), msg)
+	h.teeBroadcast(msg)
+}
+
+// BroadcastChannelMessage sends a new message in ch to everyone who can
+// see it: authorMsg to the author's connections, which carries the
+// author-only fields, and msg to the rest and the outgoing webhooks.
+func (h *Hub) BroadcastChannelMessage(ch *db.Channel, authorID string, msg, authorMsg []byte) {
+	var memberSet map[string]bool
+	if ch.Visibility != "public" {
+		memberIDs, _ := h.DB.GetChannelMemberIDs(ch.ID)
+		memberSet = make(map[string]bool, len(memberIDs))
+		for _, id := range memberIDs {
+			memberSet[id] = true
+		}
+	}
+
+	var author, others []*Client
+	for _, c := range h.clientsWhere(func(userID string, c *Client) bool {
+		return memberSet == nil || memberSet[userID] || (c.User != nil && c.User.IsAdmin)
+	}) {
+		if c.UserID == authorID {
+			author = append(author, c)
+		} else {
+			others = append(others, c)
+		}
+	}
+	sendAll(author, authorMsg)
+	sendAll(others, msg)
+	h.teeBroadcast(msg)
+}
+
+// OnlineUserIDs returns the IDs of users with at least one connection.
+func (h *Hub) OnlineUserIDs() []string {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
+	ids := make([]string, 0, len(h.clients))
 	for userID, clients := range h.clients {
-		if memberSet[userID] {
-			for _, client := range clients {
-				client.Send(msg)
-			}
-		} else {
-			for _, client := range clients {
-				if client.User != nil && client.User.IsAdmin {
-					client.Send(msg)
-				}
-			}
+		if len(clients) > 0 {
+			ids = append(ids, userID)
 		}
 	}
+	return ids
 }
 
 func (h *Hub) IsUserOnline(userID string) bool {
@@ -271,10 +472,9 @@ func (h *Hub) IsUserOnline(userID string) bool {
 
 func (h *Hub) SendTo(userID string, msg []byte) {
 	h.mu.RLock()
-	defer h.mu.RUnlock()
-	for _, client := range h.clients[userID] {
-		client.Send(msg)
-	}
+	clients := append([]*Client(nil), h.clients[userID]...)
+	h.mu.RUnlock()
+	sendAll(clients, msg)
 }
 
 // SendToVoiceClient sends a message only to the connection that owns voice for a user.
@@ -341,15 +541,12 @@ func (h *Hub) GetAllRadioPlayback() map[string]*RadioPlaybackPayload {
 	defer h.radioMu.RUnlock()
 	result := make(map[string]*RadioPlaybackPayload)
 	for sid, state := range h.radioPlayback {
-		var track RadioTrackPayload
-		if state.TrackIndex >= 0 && state.TrackIndex < len(state.Tracks) {
-			track = state.Tracks[state.TrackIndex]
-		}
 		result[sid] = &RadioPlaybackPayload{
 			StationID:  state.StationID,
 			PlaylistID: state.PlaylistID,
 			TrackIndex: state.TrackIndex,
-			Track:      track,
+			Track:      state.current(),
+			Intro:      state.Intro != nil,
 			Playing:    state.Playing,
 			Position:   state.Position,
 			UpdatedAt:  state.UpdatedAt,
@@ -424,6 +621,13 @@ func (h *Hub) GetRadioListeners(stationID string) []string {
 	return result
 }
 
+// IsRadioListener reports whether userID is tuned in to stationID.
+func (h *Hub) IsRadioListener(stationID, userID string) bool {
+	h.radioListMu.RLock()
+	defer h.radioListMu.RUnlock()
+	return h.radioListeners[stationID][userID]
+}
+
 func (h *Hub) GetAllRadioListeners() map[string][]string {
 	h.radioListMu.RLock()
 	defer h.radioListMu.RUnlock()
@@ -442,12 +646,12 @@ func (h *Hub) GetAllRadioListeners() map[string][]string {
 func (h *Hub) BroadcastToRadioListeners(stationID string, msg []byte) {
 	listeners := h.GetRadioListeners(stationID)
 	h.mu.RLock()
-	defer h.mu.RUnlock()
+	var clients []*Client
 	for _, uid := range listeners {
-		for _, client := range h.clients[uid] {
-			client.Send(msg)
-		}
+		clients = append(clients, h.clients[uid]...)
 	}
+	h.mu.RUnlock()
+	sendAll(clients, msg)
 }
 
 // BroadcastRadioStatus sends a lightweight status update to all connected clients
@@ -636,15 +840,45 @@ func (h *Hub) DisconnectUser(userID string) {
 	}
 }
 
+// RefreshUser is called after an admin changes user's account flags. It
+// broadcasts a user_update and drops the user's live connections: a
+// client's User is loaded once at authentication, so only a reconnect
+// (and its fresh ready) brings its permissions up to date.
+func (h *Hub) RefreshUser(user *db.User) {
+	msg, _ := NewMessage("user_update", UserOnlineData{
+		User: UserPayload{
+			ID:       user.ID,
+			Username: user.Username,
+			IsAdmin:  user.IsAdmin,
+		},
+	})
+	h.BroadcastAll(msg)
+	h.DisconnectUser(user.ID)
+}
+
 func (h *Hub) HandleWebSocket(w http.ResponseWriter, r *http.Request) {
+	if !h.DevMode && !config.OriginAllowed(r, h.TrustedOrigins) {
+		log.Printf("ws: rejected origin %q", r.Header.Get("Origin"))
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
 	conn, err := websocket.Accept(w, r, &websocket.AcceptOptions{
-		InsecureSkipVerify: h.DevMode,
+		// Origin was checked above against the trusted list
+		InsecureSkipVerify: true,
 	})
 	if err != nil {
 		log.Printf("ws accept: %v", err)
 		return
 	}
 
+	ip := requestIP(r)
+	if !h.acquireConn(ip) {
+		log.Printf("ws: connection limit reached for %s", ip)
+		conn.Close(websocket.StatusTryAgainLater, "too many connections")
+		return
+	}
+	defer h.releaseConn(ip)
+
 	ctx, cancel := context.WithCancel(context.Background())
 	client := &Client{
 		hub:    h,
@@ -672,6 +906,8 @@ func (h *Hub) HandleMessage(client *Client, msg *Message) {
 		h.handleRemoveReaction(client, msg.Data)
 	case "typing_start":
 		h.handleTypingStart(client, msg.Data)
+	case "set_status":
+		h.handleSetStatus(client, msg.Data)
 	case "create_channel":
 		h.handleCreateChannel(client, msg.Data)
 	case "delete_channel":
@@ -682,6 +918,8 @@ func (h *Hub) HandleMessage(client *Client, msg *Message) {
 		h.handleRenameChannel(client, msg.Data)
 	case "restore_channel":
 		h.handleRestoreChannel(client, msg.Data)
+	case "set_channel_restrictions":
+		h.handleSetChannelRestrictions(client, msg.Data)
 	case "add_channel_manager":
 		h.handleAddChannelManager(client, msg.Data)
 	case "remove_channel_manager":
@@ -702,6 +940,10 @@ func (h *Hub) HandleMessage(client *Client, msg *Message) {
 		h.handleVoiceSpeaking(client, msg.Data)
 	case "voice_server_mute":
 		h.handleVoiceServerMute(client, msg.Data)
+	case "voice_kick":
+		h.handleVoiceKick(client, msg.Data)
+	case "set_priority_speaker", "voice_priority_speaker":
+		h.handleSetPrioritySpeaker(client, msg.Data)
 	case "voice_share_audio_start":
 		h.handleVoiceShareAudioStart(client, msg.Data)
 	case "voice_share_audio_stop":
@@ -710,6 +952,8 @@ func (h *Hub) HandleMessage(client *Client, msg *Message) {
 		h.handleScreenShareStart(client, msg.Data)
 	case "screen_share_stop":
 		h.handleScreenShareStop(client)
+	case "screen_share_set_quality":
+		h.handleScreenShareSetQuality(client, msg.Data)
 	case "screen_share_subscribe":
 		h.handleScreenShareSubscribe(client, msg.Data)
 	case "screen_share_unsubscribe":
@@ -718,6 +962,8 @@ func (h *Hub) HandleMessage(client *Client, msg *Message) {
 		h.handleWebRTCScreenAnswer(client, msg.Data)
 	case "webrtc_screen_ice":
 		h.handleWebRTCScreenICE(client, msg.Data)
+	case "view_channel":
+		h.handleViewChannel(client, msg.Data)
 	case "mark_read":
 		h.handleMarkRead(client, msg.Data)
 	case "mark_notification_read":
@@ -729,10 +975,12 @@ func (h *Hub) HandleMessage(client *Client, msg *Message) {
 	case "ping":
 		pong, _ := NewMessage("pong", nil)
 		client.Send(pong)
+	case "authenticate":
+		client.sendError(msg.Op, ErrCodeInvalid, "already authenticated")
 	default:
 		// Dispatch to applet registry (radio, media, strudel, etc.)
 		if !h.applets.Dispatch(h, client, msg.Op, msg.Data) {
-			log.Printf("unhandled op: %s from user %s", msg.Op, client.UserID)
+			client.sendError(msg.Op, ErrCodeUnknownOp, "unknown op")
 		}
 	}
 }
@@ -0,0 +1,44 @@
+package ws
+
+import "log"
+
+// lastSeenChanged queues a last_seen_at write for a user whose last
+// connection closed. The writes happen off the hub loop, one batch at a
+// time, so a reconnect storm's departures don't stall registrations
+// behind the database.
+func (h *Hub) lastSeenChanged(userID string) {
+	h.lastSeenMu.Lock()
+	defer h.lastSeenMu.Unlock()
+	if h.lastSeenPending == nil {
+		h.lastSeenPending = make(map[string]bool)
+	}
+	h.lastSeenPending[userID] = true
+	if h.lastSeenWriting {
+		return
+	}
+	h.lastSeenWriting = true
+	go h.flushLastSeen()
+}
+
+// flushLastSeen writes queued users until none are left; departures that
+// arrive during a write go out in the next batch.
+func (h *Hub) flushLastSeen() {
+	for {
+		h.lastSeenMu.Lock()
+		if len(h.lastSeenPending) == 0 {
+			h.lastSeenWriting = false
+			h.lastSeenMu.Unlock()
+			return
+		}
+		userIDs := make([]string, 0, len(h.lastSeenPending))
+		for id := range h.lastSeenPending {
+			userIDs = append(userIDs, id)
+		}
+		h.lastSeenPending = nil
+		h.lastSeenMu.Unlock()
+
+		if err := h.DB.SetLastSeen(userIDs); err != nil {
+			log.Printf("set last seen: %v", err)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package ws
+
+import "time"
+
+// onlineBurst tracks the user_online announcements made since the current
+// window opened.
+type onlineBurst struct {
+	sent int           // announced individually
+	held []UserPayload // over OnlineBurstSize, waiting for the flush
+}
+
+// announceOnline tells everyone but the user that they came online.
+// Steady-state connects get a user_online each, straight away. Once
+// OnlineBurstSize users have been announced within OnlineBurstWindow of
+// the first, the rest are held and sent as one users_online_bulk when the
+// window ends, so a reconnect storm after a restart doesn't cost every
+// client a message per user.
+func (h *Hub) announceOnline(user UserPayload) {
+	msg, err := NewMessage("user_online", UserOnlineData{User: user})
+	if err != nil {
+		return
+	}
+	if h.OnlineBurstWindow <= 0 || h.OnlineBurstSize <= 0 {
+		h.BroadcastExcept(msg, user.ID)
+		return
+	}
+
+	h.onlineMu.Lock()
+	if h.onlineBurst == nil {
+		h.onlineBurst = &onlineBurst{}
+		time.AfterFunc(h.OnlineBurstWindow, h.flushOnlineBurst)
+	}
+	burst := h.onlineBurst
+	if burst.sent < h.OnlineBurstSize {
+		burst.sent++
+		h.onlineMu.Unlock()
+		h.BroadcastExcept(msg, user.ID)
+		return
+	}
+	burst.held = append(burst.held, user)
+	h.onlineMu.Unlock()
+}
+
+// flushOnlineBurst closes the window and sends the held users that are
+// still connected as one users_online_bulk. Outgoing webhooks still see a
+// user_online per user.
+func (h *Hub) flushOnlineBurst() {
+	h.onlineMu.Lock()
+	burst := h.onlineBurst
+	h.onlineBurst = nil
+	h.onlineMu.Unlock()
+	if burst == nil || len(burst.held) == 0 {
+		return
+	}
+
+	h.mu.RLock()
+	users := make([]UserPayload, 0, len(burst.held))
+	seen := make(map[string]bool, len(burst.held))
+	for _, u := range burst.held {
+		if !seen[u.ID] && len(h.clients[u.ID]) > 0 {
+			seen[u.ID] = true
+			users = append(users, u)
+		}
+	}
+	h.mu.RUnlock()
+	if len(users) == 0 {
+		return
+	}
+
+	msg, err := NewMessage("users_online_bulk", UsersOnlineBulkData{Users: users})
+	if err != nil {
+		return
+	}
+	sendAll(h.clientsWhere(nil), msg)
+	for _, u := range users {
+		if single, err := NewMessage("user_online", UserOnlineData{User: u}); err == nil {
+			h.teeBroadcast(single)
+		}
+	}
+}
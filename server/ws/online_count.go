@@ -0,0 +1,43 @@
+package ws
+
+import "time"
+
+// onlineCountDelay is how long online_count waits after the first change
+// before going out, so a burst of arrivals and departures costs clients
+// one event.
+const onlineCountDelay = time.Second
+
+// onlineCountChanged notes that a user came online or went offline and
+// schedules an online_count broadcast unless one is already pending.
+func (h *Hub) onlineCountChanged() {
+	h.onlineCountMu.Lock()
+	defer h.onlineCountMu.Unlock()
+	if h.onlineCountPending {
+		return
+	}
+	h.onlineCountPending = true
+	time.AfterFunc(onlineCountDelay, h.flushOnlineCount)
+}
+
+// flushOnlineCount sends the number of online users to everyone, if it
+// differs from the last one sent: someone who connects and leaves within
+// the delay changes nothing. Outgoing webhooks don't see it.
+func (h *Hub) flushOnlineCount() {
+	h.onlineCountMu.Lock()
+	h.onlineCountPending = false
+	h.mu.RLock()
+	count := len(h.clients)
+	h.mu.RUnlock()
+	if count == h.onlineCountSent {
+		h.onlineCountMu.Unlock()
+		return
+	}
+	h.onlineCountSent = count
+	h.onlineCountMu.Unlock()
+
+	msg, err := NewMessage("online_count", OnlineCountPayload{Count: count})
+	if err != nil {
+		return
+	}
+	sendAll(h.clientsWhere(nil), msg)
+}
@@ -23,6 +23,8 @@ type ReadyData struct {
 	VoiceStates    []VoiceStatePayload    `json:"voice_states"`
 	OnlineUsers    []UserPayload          `json:"online_users"`
 	AllUsers       []UserPayload          `json:"all_users"`
+	UsersTotal     int                    `json:"users_total"`
+	UsersNext      *string                `json:"users_next"`
 	Notifications  []NotificationPayload  `json:"notifications"`
 	ScreenShares   []sfu.ScreenShareState `json:"screen_shares"`
 	AudioSources   []AudioSourcePayload   `json:"audio_sources"`
@@ -70,6 +72,15 @@ type NotificationPayload struct {
 	Data      json.RawMessage `json:"data"`
 	Read      bool            `json:"read"`
 	CreatedAt string          `json:"created_at"`
+	// Silent asks the client to skip the sound/popup (recipient is in DnD)
+	Silent bool `json:"silent,omitempty"`
+}
+
+// NotificationsDeletedPayload tells a user's connections that
+// notifications were removed: the listed IDs, or every one when All is set.
+type NotificationsDeletedPayload struct {
+	IDs []string `json:"ids,omitempty"`
+	All bool     `json:"all,omitempty"`
 }
 
 type UserPayload struct {
@@ -79,6 +90,7 @@ type UserPayload struct {
 	Email       *string `json:"email,omitempty"`
 	IsAdmin     bool    `json:"is_admin"`
 	HasPassword bool    `json:"has_password,omitempty"`
+	Status      string  `json:"status,omitempty"`
 }
 
 type ChannelPayload struct {
@@ -91,6 +103,11 @@ type ChannelPayload struct {
 	Description *string  `json:"description,omitempty"`
 	IsMember    bool     `json:"is_member,omitempty"`
 	Role        string   `json:"role,omitempty"`
+	// Announcement channels take messages only from managers and admins
+	Announcement bool `json:"announcement,omitempty"`
+	// Messages with attachments or links are refused when these are off
+	AllowAttachments bool `json:"allow_attachments"`
+	AllowLinks       bool `json:"allow_links"`
 }
 
 type VoiceStatePayload struct {
@@ -100,17 +117,82 @@ type VoiceStatePayload struct {
 	SelfDeafen bool   `json:"self_deafen"`
 	ServerMute bool   `json:"server_mute"`
 	Speaking   bool   `json:"speaking"`
+	Priority   bool   `json:"priority_speaker"`
+	// Endpoint is the SFU endpoint hosting the call; set on joins only
+	Endpoint string `json:"endpoint,omitempty"`
+}
+
+// Server → Client errors
+
+// Error codes carried by the "error" op.
+const (
+	ErrCodeInvalid  = "invalid_request"
+	ErrCodeNotFound = "not_found"
+	ErrCodeDenied   = "forbidden"
+	ErrCodeInternal = "internal_error"
+	// ErrCodeTooLarge answers an inbound message over the size limit. The
+	// message is dropped unread, so op is empty.
+	ErrCodeTooLarge = "message_too_large"
+	// ErrCodeUnknownOp answers an op the server doesn't handle.
+	ErrCodeUnknownOp = "unknown_op"
+	// ErrCodeReactionNotAllowed answers add_reaction with an emoji outside
+	// the server's allowed_reactions list.
+	ErrCodeReactionNotAllowed = "reaction_not_allowed"
+	// ErrCodeChannelRestricted answers send_message or edit_message with an
+	// attachment or link in a channel that doesn't allow them.
+	ErrCodeChannelRestricted = "channel_restricted"
+)
+
+// ErrorPayload tells a client why the op it sent was rejected. Reason
+// duplicates Message for clients written before code/message existed.
+type ErrorPayload struct {
+	Op      string `json:"op"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Reason  string `json:"reason"`
 }
 
+// Content limits, in bytes. Edits (and webhook posts) have long been held
+// to the tighter one.
+const (
+	MaxMessageLength = 32000
+	MaxEditLength    = 4000
+)
+
 // Server → Client presence
 type UserOnlineData struct {
 	User UserPayload `json:"user"`
 }
 
+type UsersOnlineBulkData struct {
+	Users []UserPayload `json:"users"`
+}
+
+// OnlineCountPayload is online_count: how many users have at least one
+// open connection.
+type OnlineCountPayload struct {
+	Count int `json:"count"`
+}
+
 type UserOfflineData struct {
 	UserID string `json:"user_id"`
 }
 
+// Presence statuses. StatusOnline is the default and is never stored.
+const (
+	StatusOnline = "online"
+	StatusDND    = "dnd"
+)
+
+type SetStatusData struct {
+	Status string `json:"status"`
+}
+
+type PresenceUpdatePayload struct {
+	UserID string `json:"user_id"`
+	Status string `json:"status"`
+}
+
 // Radio payload types
 
 type RadioStationPayload struct {
@@ -120,6 +202,8 @@ type RadioStationPayload struct {
 	Position       int      `json:"position"`
 	PlaybackMode   string   `json:"playback_mode"`
 	PublicControls bool     `json:"public_controls"`
+	DefaultVolume  int      `json:"default_volume"`
+	IntroTrackID   *string  `json:"intro_track_id"`
 	ManagerIDs     []string `json:"manager_ids"`
 }
 
@@ -149,6 +233,33 @@ type RadioPlaybackPayload struct {
 	Position   float64          `json:"position"`
 	UpdatedAt  float64          `json:"updated_at"`
 	UserID     string           `json:"user_id"`
+	Intro      bool             `json:"intro,omitempty"` // Track is the station intro, ahead of track 0
+}
+
+// ReactionUpdatePayload is the merged result of a burst of reaction
+// changes to one emoji on one message: the new count and who ended up
+// adding or removing it over the burst.
+type ReactionUpdatePayload struct {
+	MessageID string   `json:"message_id"`
+	Emoji     string   `json:"emoji"`
+	Count     int      `json:"count"`
+	AddedBy   []string `json:"added_by"`
+	RemovedBy []string `json:"removed_by"`
+}
+
+// ServerShutdownPayload is sent just before the server closes every
+// connection, telling clients how long to wait before reconnecting.
+type ServerShutdownPayload struct {
+	ReconnectAfterSeconds int `json:"reconnect_after_seconds"`
+}
+
+// RadioPositionPayload is the periodic radio_position sync: where a
+// playing station is, as of UpdatedAt.
+type RadioPositionPayload struct {
+	StationID  string  `json:"station_id"`
+	TrackIndex int     `json:"track_index"`
+	Position   float64 `json:"position"`
+	UpdatedAt  float64 `json:"updated_at"`
 }
 
 type UnfurlPayload struct {
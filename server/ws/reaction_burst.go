@@ -0,0 +1,88 @@
+package ws
+
+import (
+	"log"
+	"time"
+)
+
+type reactionKey struct {
+	messageID string
+	emoji     string
+}
+
+// reactionBurst tracks the reaction changes to one (message, emoji) made
+// since its last broadcast.
+type reactionBurst struct {
+	before map[string]bool // userID → had the reaction before the burst
+	after  map[string]bool // userID → has it now
+}
+
+// broadcastReaction sends a reaction change. The acting user's
+// connections get msg (reaction_add or reaction_remove) straight away as
+// confirmation. Everyone else gets it straight away too unless another
+// change to the same emoji on the same message was broadcast within
+// ReactionBurstWindow; those are held and sent as one reaction_update when
+// the window ends, so add/remove storms don't flood every client.
+func (h *Hub) broadcastReaction(userID, messageID, emoji string, added bool, msg []byte) {
+	h.SendTo(userID, msg)
+	if h.ReactionBurstWindow <= 0 {
+		h.BroadcastExcept(msg, userID)
+		return
+	}
+
+	key := reactionKey{messageID: messageID, emoji: emoji}
+	h.reactionMu.Lock()
+	burst, open := h.reactionBursts[key]
+	if !open {
+		// First change in a while: broadcast now and open a window
+		h.reactionBursts[key] = &reactionBurst{before: make(map[string]bool), after: make(map[string]bool)}
+		h.reactionMu.Unlock()
+		time.AfterFunc(h.ReactionBurstWindow, func() { h.flushReactionBurst(key) })
+		h.BroadcastExcept(msg, userID)
+		return
+	}
+	if _, seen := burst.before[userID]; !seen {
+		burst.before[userID] = !added
+	}
+	burst.after[userID] = added
+	h.reactionMu.Unlock()
+}
+
+// flushReactionBurst closes key's window and broadcasts the net effect of
+// the changes held during it, if any.
+func (h *Hub) flushReactionBurst(key reactionKey) {
+	h.reactionMu.Lock()
+	burst := h.reactionBursts[key]
+	delete(h.reactionBursts, key)
+	h.reactionMu.Unlock()
+	if burst == nil {
+		return
+	}
+
+	addedBy, removedBy := []string{}, []string{}
+	for userID, has := range burst.after {
+		switch {
+		case has && !burst.before[userID]:
+			addedBy = append(addedBy, userID)
+		case !has && burst.before[userID]:
+			removedBy = append(removedBy, userID)
+		}
+	}
+	if len(addedBy) == 0 && len(removedBy) == 0 {
+		return
+	}
+
+	count, err := h.DB.CountEmojiReactions(key.messageID, key.emoji)
+	if err != nil {
+		log.Printf("flush reaction burst: %v", err)
+		return
+	}
+	msg, _ := NewMessage("reaction_update", ReactionUpdatePayload{
+		MessageID: key.messageID,
+		Emoji:     key.emoji,
+		Count:     count,
+		AddedBy:   addedBy,
+		RemovedBy: removedBy,
+	})
+	h.BroadcastAll(msg)
+}
@@ -0,0 +1,98 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// In an announcement channel only managers and admins post, but everyone
+// can still react.
+func TestAnnouncementChannel(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	chName := uniqueName("news")
+	adminWS.Send("create_channel", map[string]any{"name": chName, "type": "text"})
+	created, err := adminWS.WaitForMatch("channel_create", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "name") == chName
+	}, wait)
+	if err != nil {
+		t.Fatalf("no channel_create: %v", err)
+	}
+	channelID := jsonStr(parseData(created), "id")
+	defer adminWS.Send("delete_channel", map[string]any{"channel_id": channelID})
+
+	bob := NewHTTPClient()
+	bob.Token = bobToken
+	resp, err := bob.do("PATCH", "/api/v1/channels/"+channelID+"/settings", map[string]any{"announcement": true})
+	if err != nil {
+		t.Fatalf("bob patch: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 403 {
+		t.Errorf("non-owner setting announcement: status %d, want 403", resp.StatusCode)
+	}
+
+	admin := NewHTTPClient()
+	admin.Token = adminToken
+	resp, err = admin.do("PATCH", "/api/v1/channels/"+channelID+"/settings", map[string]any{"announcement": true})
+	if err != nil {
+		t.Fatalf("admin patch: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("admin patch: status %d", resp.StatusCode)
+	}
+	if _, err := bobWS.WaitForMatch("channel_update", func(raw json.RawMessage) bool {
+		d := parseData(raw)
+		return jsonStr(d, "id") == channelID && jsonBool(d, "announcement")
+	}, wait); err != nil {
+		t.Fatalf("bob saw no channel_update with announcement: %v", err)
+	}
+
+	bobWS.Send("send_message", map[string]any{"channel_id": channelID, "content": "can I post?"})
+	if e := waitForOpError(t, bobWS, "send_message"); jsonStr(e, "code") != "forbidden" {
+		t.Errorf("bob posting: code %q, want forbidden", jsonStr(e, "code"))
+	}
+
+	content := uniqueName("release")
+	adminWS.Send("send_message", map[string]any{"channel_id": channelID, "content": content})
+	data, err := bobWS.WaitForMatch("message_create", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "content") == content
+	}, wait)
+	if err != nil {
+		t.Fatalf("admin's announcement not delivered: %v", err)
+	}
+	msgID := jsonStr(parseData(data), "id")
+
+	bobWS.Send("add_reaction", map[string]any{"message_id": msgID, "emoji": "👍"})
+	if _, err := adminWS.WaitForMatch("reaction_add", func(raw json.RawMessage) bool {
+		d := parseData(raw)
+		return jsonStr(d, "message_id") == msgID && jsonStr(d, "user_id") == bobID
+	}, wait); err != nil {
+		t.Fatalf("bob's reaction not delivered: %v", err)
+	}
+
+	// A fresh connection sees the flag in ready
+	bobWS2, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws2: %v", err)
+	}
+	defer bobWS2.Close()
+	for _, c := range jsonArray(bobWS2.Ready, "channels") {
+		ch, _ := c.(map[string]any)
+		if jsonStr(ch, "id") == channelID && !jsonBool(ch, "announcement") {
+			t.Error("ready channel missing announcement flag")
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Attachments come back in the order they were listed in attachment_ids,
+// not the order they were uploaded.
+func TestAttachmentOrder(t *testing.T) {
+	ensureUsers(t)
+
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+
+	var uploaded []string
+	for _, name := range []string{"page1.png", "page2.png", "page3.png"} {
+		status, up, err := alice.UploadFile("/api/v1/upload", "file", name, pngData, "image/png")
+		if err != nil || status != 200 {
+			t.Fatalf("upload %s: %d %v", name, status, err)
+		}
+		uploaded = append(uploaded, jsonStr(up, "id"))
+	}
+	order := []string{uploaded[2], uploaded[0], uploaded[1]}
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+
+	content := uniqueName("comic")
+	aliceWS.Send("send_message", map[string]any{
+		"channel_id":     channelID,
+		"content":        content,
+		"attachment_ids": order,
+	})
+	data, err := aliceWS.WaitForMatch("message_create", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "content") == content
+	}, wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msg := parseData(data)
+
+	checkOrder := func(where string, atts []any) {
+		if len(atts) != len(order) {
+			t.Fatalf("%s: expected %d attachments, got %v", where, len(order), atts)
+		}
+		for i, a := range atts {
+			att, _ := a.(map[string]any)
+			if got := jsonStr(att, "id"); got != order[i] {
+				t.Errorf("%s: attachment %d = %s, want %s", where, i, got, order[i])
+			}
+		}
+	}
+	checkOrder("message_create", jsonArray(msg, "attachments"))
+
+	status, history, err := alice.GetJSONArray("/api/v1/channels/" + channelID + "/messages?limit=5")
+	if err != nil || status != 200 {
+		t.Fatalf("history: %d %v", status, err)
+	}
+	for _, item := range history {
+		m, _ := item.(map[string]any)
+		if jsonStr(m, "id") == jsonStr(msg, "id") {
+			checkOrder("history", jsonArray(m, "attachments"))
+			return
+		}
+	}
+	t.Error("message missing from history")
+}
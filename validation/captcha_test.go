@@ -0,0 +1,72 @@
+package validation
+
+import "testing"
+
+// With a CAPTCHA provider configured, registration needs a token the
+// provider accepts; the site key is public via /server/info.
+func TestRegistrationCaptcha(t *testing.T) {
+	ensureUsers(t)
+
+	admin := NewHTTPClient()
+	admin.Token = adminToken
+	if status, body, _ := admin.PostJSON("/api/v1/admin/settings", map[string]any{
+		"captcha_config": map[string]any{"provider": "recaptcha", "site_key": "k", "secret": "s"},
+	}); status != 400 {
+		t.Errorf("unknown provider: expected 400, got %d %v", status, body)
+	}
+	if status, body, _ := admin.PostJSON("/api/v1/admin/settings", map[string]any{
+		"captcha_config": map[string]any{"provider": "test", "site_key": "site-123", "secret": "shh"},
+	}); status != 200 {
+		t.Fatalf("enable captcha: %d %v", status, body)
+	}
+	defer admin.PostJSON("/api/v1/admin/settings", map[string]any{"captcha_config": map[string]any{"provider": ""}})
+
+	anon := NewHTTPClient()
+	_, info, err := anon.GetJSON("/api/v1/server/info")
+	if err != nil {
+		t.Fatalf("server info: %v", err)
+	}
+	cc := jsonMap(info, "captcha")
+	if jsonStr(cc, "provider") != "test" || jsonStr(cc, "site_key") != "site-123" {
+		t.Errorf("server info captcha: %v", info["captcha"])
+	}
+	if _, leaked := cc["secret"]; leaked {
+		t.Error("server info must not include the captcha secret")
+	}
+
+	_, settings, _ := admin.GetJSON("/api/v1/admin/settings")
+	if got := jsonStr(jsonMap(settings, "captcha_config"), "secret_masked"); got == "" || got == "shh" {
+		t.Errorf("admin settings should mask the secret, got %q", got)
+	}
+
+	register := func(token *string) (int, map[string]any) {
+		body := map[string]any{"username": uniqueName("cap"), "password": "Validation-Pass-1"}
+		if token != nil {
+			body["captcha_token"] = *token
+		}
+		status, resp, _ := NewHTTPClient().PostJSON("/api/v1/auth/register", body)
+		return status, resp
+	}
+	if status, resp := register(nil); status != 400 {
+		t.Errorf("no token: expected 400, got %d %v", status, resp)
+	}
+	bad := "nope"
+	if status, resp := register(&bad); status != 400 {
+		t.Errorf("rejected token: expected 400, got %d %v", status, resp)
+	}
+	good := "test-captcha-pass"
+	if status, resp := register(&good); status >= 300 {
+		t.Errorf("accepted token: expected success, got %d %v", status, resp)
+	}
+
+	if status, _, _ := admin.PostJSON("/api/v1/admin/settings", map[string]any{"captcha_config": map[string]any{"provider": ""}}); status != 200 {
+		t.Fatalf("disable captcha: %d", status)
+	}
+	_, info, _ = anon.GetJSON("/api/v1/server/info")
+	if info["captcha"] != nil {
+		t.Errorf("captcha should be null once disabled: %v", info["captcha"])
+	}
+	if status, resp := register(nil); status >= 300 {
+		t.Errorf("no captcha configured: expected success, got %d %v", status, resp)
+	}
+}
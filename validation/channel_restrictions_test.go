@@ -0,0 +1,103 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Managers can turn off attachments and links in a channel; messages
+// carrying either are then refused with channel_restricted.
+func TestChannelRestrictions(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	chName := uniqueName("textonly")
+	adminWS.Send("create_channel", map[string]any{"name": chName, "type": "text"})
+	created, err := adminWS.WaitForMatch("channel_create", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "name") == chName
+	}, wait)
+	if err != nil {
+		t.Fatalf("no channel_create: %v", err)
+	}
+	d := parseData(created)
+	channelID := jsonStr(d, "id")
+	defer adminWS.Send("delete_channel", map[string]any{"channel_id": channelID})
+	if !jsonBool(d, "allow_attachments") || !jsonBool(d, "allow_links") {
+		t.Errorf("new channel should allow both: %v", d)
+	}
+
+	bobWS.Send("set_channel_restrictions", map[string]any{"channel_id": channelID, "allow_links": false})
+	if e := waitForOpError(t, bobWS, "set_channel_restrictions"); jsonStr(e, "code") != "forbidden" {
+		t.Errorf("non-manager: code %q, want forbidden", jsonStr(e, "code"))
+	}
+
+	adminWS.Send("set_channel_restrictions", map[string]any{"channel_id": channelID, "allow_attachments": false, "allow_links": false})
+	if _, err := bobWS.WaitForMatch("channel_update", func(raw json.RawMessage) bool {
+		d := parseData(raw)
+		return jsonStr(d, "id") == channelID && d["allow_attachments"] == false && d["allow_links"] == false
+	}, wait); err != nil {
+		t.Fatalf("no channel_update with restrictions: %v", err)
+	}
+
+	bob := NewHTTPClient()
+	bob.Token = bobToken
+	status, up, err := bob.UploadFile("/api/v1/upload", "file", "pic.png", pngData, "image/png")
+	if err != nil || status != 200 {
+		t.Fatalf("upload: %d %v", status, err)
+	}
+	bobWS.Send("send_message", map[string]any{"channel_id": channelID, "content": "look", "attachment_ids": []string{jsonStr(up, "id")}})
+	if e := waitForOpError(t, bobWS, "send_message"); jsonStr(e, "code") != "channel_restricted" {
+		t.Errorf("attachment: code %q, want channel_restricted", jsonStr(e, "code"))
+	}
+	bobWS.Send("send_message", map[string]any{"channel_id": channelID, "content": "see https://example.com/x"})
+	if e := waitForOpError(t, bobWS, "send_message"); jsonStr(e, "code") != "channel_restricted" {
+		t.Errorf("link: code %q, want channel_restricted", jsonStr(e, "code"))
+	}
+
+	// A link inside code isn't a link; plain text still goes through
+	content := uniqueName("plain") + " `https://example.com`"
+	bobWS.Send("send_message", map[string]any{"channel_id": channelID, "content": content})
+	data, err := adminWS.WaitForMatch("message_create", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "content") == content
+	}, wait)
+	if err != nil {
+		t.Fatalf("plain message refused: %v", err)
+	}
+
+	// Editing can't add a link either
+	bobWS.Send("edit_message", map[string]any{"message_id": jsonStr(parseData(data), "id"), "content": "now https://example.com"})
+	if e := waitForOpError(t, bobWS, "edit_message"); jsonStr(e, "code") != "channel_restricted" {
+		t.Errorf("edit: code %q, want channel_restricted", jsonStr(e, "code"))
+	}
+
+	// Omitted flags stay as they are
+	adminWS.Send("set_channel_restrictions", map[string]any{"channel_id": channelID, "allow_links": true})
+	if _, err := bobWS.WaitForMatch("channel_update", func(raw json.RawMessage) bool {
+		d := parseData(raw)
+		return jsonStr(d, "id") == channelID && d["allow_attachments"] == false && d["allow_links"] == true
+	}, wait); err != nil {
+		t.Fatalf("no channel_update re-allowing links: %v", err)
+	}
+
+	bobWS2, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws2: %v", err)
+	}
+	defer bobWS2.Close()
+	for _, c := range jsonArray(bobWS2.Ready, "channels") {
+		ch, _ := c.(map[string]any)
+		if jsonStr(ch, "id") == channelID && (ch["allow_attachments"] != false || ch["allow_links"] != true) {
+			t.Errorf("ready channel restrictions: %v", ch)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+// A channel webhook posts under its own name (or a per-post username)
+// with only the token as credential, and stops working once revoked.
+func TestChannelIncomingWebhook(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	channelID := findTextChannel(aliceWS.Ready)
+	base := "/api/v1/channels/" + channelID + "/webhooks"
+
+	bob := NewHTTPClient()
+	bob.Token = bobToken
+	if status, _, _ := bob.PostJSON(base, map[string]any{"name": "nope"}); status != 403 {
+		t.Errorf("non-manager create: expected 403, got %d", status)
+	}
+
+	admin := NewHTTPClient()
+	admin.Token = adminToken
+	name := uniqueName("ci")
+	status, hook, err := admin.PostJSON(base, map[string]any{"name": name})
+	if err != nil || status != 201 {
+		t.Fatalf("create webhook: %d %v %v", status, hook, err)
+	}
+	hookID, token := jsonStr(hook, "id"), jsonStr(hook, "token")
+	if hookID == "" || token == "" {
+		t.Fatalf("create webhook response missing id/token: %v", hook)
+	}
+
+	status, list, err := admin.GetJSONArray(base)
+	if err != nil || status != 200 {
+		t.Fatalf("list webhooks: %d %v", status, err)
+	}
+	found := false
+	for _, item := range list {
+		h, _ := item.(map[string]any)
+		if jsonStr(h, "id") == hookID {
+			found = true
+			if _, leaked := h["token"]; leaked {
+				t.Error("list should not include tokens")
+			}
+		}
+	}
+	if !found {
+		t.Error("new webhook missing from list")
+	}
+
+	anon := NewHTTPClient()
+	postURL := "/api/v1/webhooks/" + hookID + "/" + token
+
+	if status, _, _ := anon.PostJSON("/api/v1/webhooks/"+hookID+"/wrong", map[string]any{"content": "x"}); status != 401 {
+		t.Errorf("bad token: expected 401, got %d", status)
+	}
+
+	status, _, err = anon.PostJSON(postURL, map[string]any{"content": "build passed"})
+	if err != nil || status != 201 {
+		t.Fatalf("post via webhook: %d %v", status, err)
+	}
+	data, err := aliceWS.WaitFor("message_create", wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msg := parseData(data)
+	if jsonStr(msg, "channel_id") != channelID || jsonStr(msg, "content") != "build passed" {
+		t.Errorf("unexpected message: %v", msg)
+	}
+	if got := jsonStr(jsonMap(msg, "author"), "username"); got != name {
+		t.Errorf("author should be webhook name %q, got %q", name, got)
+	}
+
+	status, _, _ = anon.PostJSON(postURL, map[string]any{"content": "feed item", "username": "rss"})
+	if status != 201 {
+		t.Fatalf("post with username: %d", status)
+	}
+	data, err = aliceWS.WaitFor("message_create", wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msg = parseData(data)
+	if got := jsonStr(jsonMap(msg, "author"), "username"); got != "rss" {
+		t.Errorf("username override: got %q", got)
+	}
+
+	// History shows the same name
+	_, history, _ := admin.GetJSONArray("/api/v1/channels/" + channelID + "/messages?limit=5")
+	for _, item := range history {
+		m, _ := item.(map[string]any)
+		if jsonStr(m, "id") == jsonStr(msg, "id") {
+			if got := jsonStr(jsonMap(m, "author"), "username"); got != "rss" {
+				t.Errorf("history author: got %q", got)
+			}
+		}
+	}
+
+	if status, _, _ := admin.DeleteJSON(base + "/" + hookID); status != 200 {
+		t.Fatalf("revoke webhook: %d", status)
+	}
+	if status, _, _ := anon.PostJSON(postURL, map[string]any{"content": "after revoke"}); status != 401 {
+		t.Errorf("revoked webhook: expected 401, got %d", status)
+	}
+}
+
+// Token guesses against a channel webhook are limited per client IP.
+func TestChannelWebhookIPRateLimit(t *testing.T) {
+	anon := NewHTTPClient()
+	anon.FakeIP = "10.99.96.1"
+	for i := 0; i < 60; i++ {
+		if status, _, _ := anon.PostJSON("/api/v1/webhooks/guess/wrong", map[string]any{"content": "x"}); status != 401 {
+			t.Fatalf("guess %d: status %d, want 401", i, status)
+		}
+	}
+	if status, _, _ := anon.PostJSON("/api/v1/webhooks/guess/wrong", map[string]any{"content": "x"}); status != 429 {
+		t.Errorf("guess past the limit: status %d, want 429", status)
+	}
+}
+
+// A channel webhook's URL is its credential, so the access log (info by
+// default) writes the path with the token replaced.
+func TestChannelWebhookTokenNotLogged(t *testing.T) {
+	srv := startOwnServer(t)
+
+	adminWS, err := ConnectWS(srv.AdminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	channelID := findTextChannel(adminWS.Ready)
+
+	admin := NewHTTPClient()
+	admin.Token = srv.AdminToken
+	status, hook, err := admin.PostJSON("/api/v1/channels/"+channelID+"/webhooks", map[string]any{"name": "logged"})
+	if err != nil || status != 201 {
+		t.Fatalf("create webhook: %d %v %v", status, hook, err)
+	}
+	hookID, token := jsonStr(hook, "id"), jsonStr(hook, "token")
+
+	if status, body, _ := NewHTTPClient().PostJSON("/api/v1/webhooks/"+hookID+"/"+token, map[string]any{"content": "hi"}); status != 201 {
+		t.Fatalf("webhook post: %d %v", status, body)
+	}
+	if _, err := adminWS.WaitFor("message_create", wait); err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+
+	logs := srv.Log()
+	if strings.Contains(logs, token) {
+		t.Errorf("server log contains the webhook token")
+	}
+	if !strings.Contains(logs, "/api/v1/webhooks/"+hookID+"/{token}") {
+		t.Errorf("no access log line for the webhook post:\n%s", logs)
+	}
+}
@@ -0,0 +1,35 @@
+package validation
+
+import "testing"
+
+// GET /api/v1/config is public and reports the limits the server enforces.
+func TestClientConfig(t *testing.T) {
+	c := NewHTTPClient()
+	status, cfg, err := c.GetJSON("/api/v1/config")
+	if err != nil || status != 200 {
+		t.Fatalf("config: %d %v", status, err)
+	}
+
+	if mode := jsonStr(cfg, "registration_mode"); mode != "open" && mode != "approval" && mode != "closed" {
+		t.Errorf("registration_mode %q", mode)
+	}
+	if _, ok := cfg["email_verification"].(bool); !ok {
+		t.Errorf("email_verification missing: %v", cfg)
+	}
+	if !jsonBool(jsonMap(cfg, "features"), "voice") {
+		t.Errorf("features.voice should be on: %v", cfg["features"])
+	}
+
+	limits := jsonMap(cfg, "limits")
+	for key, want := range map[string]float64{
+		"max_message_length":   32000,
+		"max_edit_length":      4000,
+		"max_upload_bytes":     10485760,
+		"max_mentions":         20,
+		"max_ws_message_bytes": 32768,
+	} {
+		if got, _ := limits[key].(float64); got != want {
+			t.Errorf("limits.%s = %v, want %v", key, limits[key], want)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package validation
+
+import (
+	"net/http"
+	"testing"
+)
+
+// trustedOrigin must match ALLOWED_ORIGINS on the server under test (see
+// the Makefile's validate target).
+const trustedOrigin = "https://app.validation.test"
+
+func originRequest(t *testing.T, method, path, origin string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, serverURL+path, nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Authorization", "Bearer "+aliceToken)
+	if method == http.MethodOptions {
+		req.Header.Set("Access-Control-Request-Method", "GET")
+		req.Header.Set("Access-Control-Request-Headers", "authorization")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+// Trusted origins get CORS headers; other cross-origin callers get 403.
+func TestCORSAllowlist(t *testing.T) {
+	ensureUsers(t)
+
+	resp := originRequest(t, http.MethodOptions, "/api/v1/channels", trustedOrigin)
+	if resp.StatusCode != http.StatusNoContent {
+		t.Errorf("trusted preflight: got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != trustedOrigin {
+		t.Errorf("preflight Allow-Origin: got %q", got)
+	}
+	if resp.Header.Get("Access-Control-Allow-Headers") == "" {
+		t.Error("preflight should list allowed headers")
+	}
+
+	resp = originRequest(t, http.MethodGet, "/api/v1/channels", trustedOrigin)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("trusted GET: got %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Access-Control-Allow-Origin"); got != trustedOrigin {
+		t.Errorf("GET Allow-Origin: got %q", got)
+	}
+
+	for _, method := range []string{http.MethodOptions, http.MethodGet} {
+		resp = originRequest(t, method, "/api/v1/channels", "https://evil.example")
+		if resp.StatusCode != http.StatusForbidden {
+			t.Errorf("untrusted %s: got %d, want 403", method, resp.StatusCode)
+		}
+		if resp.Header.Get("Access-Control-Allow-Origin") != "" {
+			t.Errorf("untrusted %s should get no Allow-Origin", method)
+		}
+	}
+
+	// Same-origin browser requests are unaffected
+	resp = originRequest(t, http.MethodGet, "/api/v1/channels", serverURL)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("same-origin GET: got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,189 @@
+package validation
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// historyAttachment returns the attachment on messageID as seen by c.
+func historyAttachment(t *testing.T, c *HTTPClient, channelID, messageID string) map[string]any {
+	t.Helper()
+	status, history, err := c.GetJSONArray("/api/v1/channels/" + channelID + "/messages?limit=10")
+	if err != nil || status != 200 {
+		t.Fatalf("history: %d %v", status, err)
+	}
+	for _, item := range history {
+		m, _ := item.(map[string]any)
+		if jsonStr(m, "id") == messageID {
+			if atts := jsonArray(m, "attachments"); len(atts) == 1 {
+				att, _ := atts[0].(map[string]any)
+				return att
+			}
+		}
+	}
+	t.Fatalf("message %s with one attachment missing from history", messageID)
+	return nil
+}
+
+// Fetching an attachment bumps its download count, which only the
+// message's author can see.
+func TestAttachmentDownloadCount(t *testing.T) {
+	ensureUsers(t)
+
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+	status, up, err := alice.UploadFile("/api/v1/upload", "file", "count.png", pngData, "image/png")
+	if err != nil || status != 200 {
+		t.Fatalf("upload: %d %v", status, err)
+	}
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+
+	aliceWS.Send("send_message", map[string]any{
+		"channel_id":     channelID,
+		"content":        "counted",
+		"attachment_ids": []string{jsonStr(up, "id")},
+	})
+	data, err := aliceWS.WaitFor("message_create", wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msgID := jsonStr(parseData(data), "id")
+
+	// The live message agrees with history: the count is the author's only
+	liveAttachment := func(raw []byte) map[string]any {
+		atts := jsonArray(parseData(raw), "attachments")
+		if len(atts) != 1 {
+			t.Fatalf("message_create attachments: %v", atts)
+		}
+		att, _ := atts[0].(map[string]any)
+		return att
+	}
+	if _, ok := liveAttachment(data)["download_count"].(float64); !ok {
+		t.Error("author's message_create should carry download_count")
+	}
+	bobData, err := bobWS.WaitForMatch("message_create", func(d json.RawMessage) bool {
+		return jsonStr(parseData(d), "id") == msgID
+	}, wait)
+	if err != nil {
+		t.Fatalf("bob got no message_create: %v", err)
+	}
+	if _, shown := liveAttachment(bobData)["download_count"]; shown {
+		t.Error("download_count should be hidden from non-authors in message_create")
+	}
+
+	before, ok := historyAttachment(t, alice, channelID, msgID)["download_count"].(float64)
+	if !ok {
+		t.Fatal("author should see download_count")
+	}
+
+	bob := NewHTTPClient()
+	bob.Token = bobToken
+	if _, shown := historyAttachment(t, bob, channelID, msgID)["download_count"]; shown {
+		t.Error("download_count should be hidden from non-authors")
+	}
+
+	for i := 0; i < 2; i++ {
+		resp, err := http.Get(serverURL + jsonStr(up, "url"))
+		if err != nil {
+			t.Fatalf("fetch attachment: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != 200 {
+			t.Fatalf("fetch attachment: status %d", resp.StatusCode)
+		}
+	}
+
+	// Counts are flushed every 10 seconds.
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		after, _ := historyAttachment(t, alice, channelID, msgID)["download_count"].(float64)
+		if after >= before+2 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("download_count went from %v to %v after 2 fetches", before, after)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// The download route serves an attachment under its original filename
+// rather than the hashed storage name.
+func TestAttachmentDownloadFilename(t *testing.T) {
+	ensureUsers(t)
+
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+	status, up, err := alice.UploadFile("/api/v1/upload", "file", "my photo.png", pngData, "image/png")
+	if err != nil || status != 200 {
+		t.Fatalf("upload: %d %v", status, err)
+	}
+
+	// Not on a message yet
+	resp, err := http.Get(serverURL + "/api/v1/attachments/" + jsonStr(up, "id") + "/download")
+	if err != nil {
+		t.Fatalf("fetch unlinked: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("unlinked attachment: status %d, want 404", resp.StatusCode)
+	}
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+
+	aliceWS.Send("send_message", map[string]any{
+		"channel_id":     channelID,
+		"content":        "named",
+		"attachment_ids": []string{jsonStr(up, "id")},
+	})
+	data, err := aliceWS.WaitFor("message_create", wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msg := parseData(data)
+	atts := jsonArray(msg, "attachments")
+	if len(atts) != 1 {
+		t.Fatalf("expected one attachment, got %v", atts)
+	}
+	att, _ := atts[0].(map[string]any)
+	downloadURL := jsonStr(att, "download_url")
+	if downloadURL == "" {
+		t.Fatal("message_create attachment has no download_url")
+	}
+	if got := jsonStr(historyAttachment(t, alice, channelID, jsonStr(msg, "id")), "download_url"); got != downloadURL {
+		t.Errorf("history download_url = %q, want %q", got, downloadURL)
+	}
+
+	resp, err = http.Get(serverURL + downloadURL)
+	if err != nil {
+		t.Fatalf("download: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("download: status %d", resp.StatusCode)
+	}
+	if got := resp.Header.Get("Content-Disposition"); got != `attachment; filename="my photo.png"` {
+		t.Errorf("Content-Disposition = %q", got)
+	}
+	if got := resp.Header.Get("Content-Type"); got != "image/png" {
+		t.Errorf("Content-Type = %q, want image/png", got)
+	}
+}
@@ -0,0 +1,190 @@
+package validation
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeSMTP is a minimal plaintext SMTP server. RCPT TO answers 550 for
+// addresses starting "bounce", always 451 for "soft", 451 once for "flaky",
+// and 250 otherwise. It counts RCPT attempts per address.
+type fakeSMTP struct {
+	ln        net.Listener
+	mu        sync.Mutex
+	rcpts     map[string]int
+	delivered map[string]bool
+}
+
+func startFakeSMTP(t *testing.T) *fakeSMTP {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &fakeSMTP{ln: ln, rcpts: map[string]int{}, delivered: map[string]bool{}}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+func (s *fakeSMTP) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTP) attempts(addr string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.rcpts[addr]
+}
+
+func (s *fakeSMTP) wasDelivered(addr string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.delivered[addr]
+}
+
+func (s *fakeSMTP) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 fake ESMTP")
+	var rcpt string
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 fake")
+		case strings.HasPrefix(cmd, "MAIL FROM"):
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO"):
+			rcpt = strings.Trim(line[len("RCPT TO:"):], "<> ")
+			s.mu.Lock()
+			s.rcpts[rcpt]++
+			n := s.rcpts[rcpt]
+			s.mu.Unlock()
+			switch {
+			case strings.HasPrefix(rcpt, "bounce"):
+				reply("550 5.1.1 No such user")
+			case strings.HasPrefix(rcpt, "soft"), strings.HasPrefix(rcpt, "flaky") && n == 1:
+				reply("451 4.3.0 Try again later")
+			default:
+				reply("250 OK")
+			}
+		case cmd == "DATA":
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			for {
+				data, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if data == ".\r\n" {
+					break
+				}
+			}
+			s.mu.Lock()
+			s.delivered[rcpt] = true
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "QUIT":
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestVerificationEmailDeliveryFailures(t *testing.T) {
+	ensureAdmin(t)
+	smtpServer := startFakeSMTP(t)
+
+	admin := NewHTTPClient()
+	admin.Token = adminToken
+	status, body, err := admin.PostJSON("/api/v1/admin/settings", map[string]any{
+		"email_verification_enabled": true,
+		"email_provider_config": map[string]any{
+			"provider":   "smtp",
+			"host":       "127.0.0.1",
+			"port":       smtpServer.port(),
+			"encryption": "none",
+			"from_email": "noreply@test.com",
+			"from_name":  "Test App",
+		},
+	})
+	if err != nil || status != 200 {
+		t.Fatalf("configure smtp: %d %v %v", status, body, err)
+	}
+	// Later tests expect the test provider
+	defer func() {
+		configureEmailVerification(t, adminToken)
+		disableEmailVerification(t, adminToken)
+	}()
+
+	t.Run("hard bounce is reported without retrying", func(t *testing.T) {
+		name := uniqueName("ev_bounce")
+		addr := "bounce_" + name + "@example.com"
+		status, body, _ := registerWithEmail(NewHTTPClient(), name, addr, "Str0ngP@ss")
+		if status != 202 || !jsonBool(body, "pending_verification") {
+			t.Fatalf("register: expected 202 pending_verification, got %d: %v", status, body)
+		}
+		if got := jsonStr(body, "email_error"); got != "email delivery failed, check the address" {
+			t.Errorf("email_error = %q", got)
+		}
+		if n := smtpServer.attempts(addr); n != 1 {
+			t.Errorf("a hard bounce should not be retried, got %d attempts", n)
+		}
+		// The code is still stored, so a corrected resend can go through
+		getTestVerificationCode(t, addr)
+
+		status, body, _ = resendCode(NewHTTPClient(), addr)
+		if status != 422 || jsonStr(body, "error") != "email delivery failed, check the address" {
+			t.Errorf("resend: expected 422 check the address, got %d: %v", status, body)
+		}
+	})
+
+	t.Run("soft failure is retried then reported", func(t *testing.T) {
+		name := uniqueName("ev_soft")
+		addr := "soft_" + name + "@example.com"
+		status, body, _ := registerWithEmail(NewHTTPClient(), name, addr, "Str0ngP@ss")
+		if status != 202 {
+			t.Fatalf("register: expected 202, got %d: %v", status, body)
+		}
+		if got := jsonStr(body, "email_error"); got != "email delivery failed, try again later" {
+			t.Errorf("email_error = %q", got)
+		}
+		if n := smtpServer.attempts(addr); n != 3 {
+			t.Errorf("expected 3 attempts, got %d", n)
+		}
+	})
+
+	t.Run("transient failure recovers on retry", func(t *testing.T) {
+		name := uniqueName("ev_flaky")
+		addr := "flaky_" + name + "@example.com"
+		status, body, _ := registerWithEmail(NewHTTPClient(), name, addr, "Str0ngP@ss")
+		if status != 202 {
+			t.Fatalf("register: expected 202, got %d: %v", status, body)
+		}
+		if _, ok := body["email_error"]; ok {
+			t.Errorf("unexpected email_error: %v", body)
+		}
+		if !smtpServer.wasDelivered(addr) || smtpServer.attempts(addr) != 2 {
+			t.Errorf("expected delivery on the second attempt, got %d attempts", smtpServer.attempts(addr))
+		}
+	})
+}
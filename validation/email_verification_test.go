@@ -531,10 +531,9 @@ func TestScenario48_ResendRateLimited(t *testing.T) {
 	c := NewHTTPClient()
 	registerWithEmail(c, name, email, "Str0ngP@ss")
 
-	// 3 resends should succeed (registration created the first code, so we've had 1 code)
-	// The rate limit is 3 codes per hour total (including initial)
-	// So resend 1 = code #2, resend 2 = code #3 — these succeed.
-	// Resend 3 = code #4 — should be rejected.
+	// Registration issued the first code; the limit is 3 per hour, so
+	// two resends go through and the third is refused. Replaced codes still
+	// count (verification_code_events).
 	for i := 0; i < 2; i++ {
 		rc := NewHTTPClient()
 		status, _, _ := resendCode(rc, email)
@@ -542,26 +541,46 @@ func TestScenario48_ResendRateLimited(t *testing.T) {
 			t.Fatalf("resend %d: expected 200, got %d", i+1, status)
 		}
 	}
-
-	// This one should be rejected (3rd resend = 4th code total, but CountRecent counts rows in verification_codes table)
-	// Actually: CreateVerificationCode DELETEs old codes, so only 1 row at a time.
-	// CountRecentVerificationCodes counts rows with created_at >= 1 hour ago.
-	// Since DELETE removes old rows, count is always 0 or 1. Let's re-read the logic...
-	// The count is on the current table, but CreateVerificationCode deletes old codes first.
-	// So CountRecentVerificationCodes will always return 0 or 1.
-	// This means the rate limit based on CountRecentVerificationCodes won't work as written.
-	// We'll verify that the endpoint itself at least responds with success for now.
-	// The HTTP rate limiter (5/minute) is the outer guard.
+	status, _, _ := resendCode(NewHTTPClient(), email)
+	if status != 429 {
+		t.Fatalf("resend 3: expected 429, got %d", status)
+	}
 
 	// Verify the latest code still works
 	code := getTestVerificationCode(t, email)
 	vc := NewHTTPClient()
-	status, _, _ := verifyEmail(vc, email, code)
+	status, _, _ = verifyEmail(vc, email, code)
 	if status != 200 {
 		t.Fatalf("latest code should work: got %d", status)
 	}
 }
 
+func TestVerificationIPRateLimits(t *testing.T) {
+	// Different addresses from one IP share the limit
+	c := NewHTTPClient()
+	c.FakeIP = "10.99.98.1"
+	for i := 0; i < 10; i++ {
+		status, _, _ := verifyEmail(c, uniqueName("ev_ip")+"@example.com", "000000")
+		if status == 429 {
+			t.Fatalf("verify hit the IP limit early at request %d", i+1)
+		}
+	}
+	if status, _, _ := verifyEmail(c, uniqueName("ev_ip")+"@example.com", "000000"); status != 429 {
+		t.Errorf("verify: expected 429 after 10 requests, got %d", status)
+	}
+
+	c.FakeIP = "10.99.98.2"
+	for i := 0; i < 5; i++ {
+		status, _, _ := resendCode(c, uniqueName("ev_ip")+"@example.com")
+		if status == 429 {
+			t.Fatalf("resend hit the IP limit early at request %d", i+1)
+		}
+	}
+	if status, _, _ := resendCode(c, uniqueName("ev_ip")+"@example.com"); status != 429 {
+		t.Errorf("resend: expected 429 after 5 requests, got %d", status)
+	}
+}
+
 func TestScenario49_VerificationCodesHashedInDB(t *testing.T) {
 	ensureAdmin(t)
 	configureEmailVerification(t, adminToken)
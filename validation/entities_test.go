@@ -0,0 +1,133 @@
+package validation
+
+import (
+	"fmt"
+	"testing"
+)
+
+// message_create carries byte-offset entities for mentions, links and
+// code; a mention inside code is literal text and doesn't notify.
+func TestMessageEntities(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	channelID := findTextChannel(aliceWS.Ready)
+
+	mention := fmt.Sprintf("<@%s>", bobID)
+	content := fmt.Sprintf("hi %s see https://example.com/x. and `%s`", mention, mention)
+	aliceWS.Send("send_message", map[string]any{"channel_id": channelID, "content": content})
+	data, err := aliceWS.WaitFor("message_create", wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msg := parseData(data)
+
+	if mentions, _ := msg["mentions"].([]any); len(mentions) != 1 {
+		t.Errorf("expected 1 real mention, got %v", msg["mentions"])
+	}
+
+	entities, _ := msg["entities"].([]any)
+	if len(entities) != 3 {
+		t.Fatalf("expected mention, url and code entities, got %v", entities)
+	}
+	span := func(e map[string]any) string {
+		start, _ := e["start"].(float64)
+		end, _ := e["end"].(float64)
+		return content[int(start):int(end)]
+	}
+	want := []struct{ typ, text string }{
+		{"mention", mention},
+		{"url", "https://example.com/x"},
+		{"code", "`" + mention + "`"},
+	}
+	for i, w := range want {
+		e, _ := entities[i].(map[string]any)
+		if jsonStr(e, "type") != w.typ || span(e) != w.text {
+			t.Errorf("entity %d: got %v (%q), want %s %q", i, e, span(e), w.typ, w.text)
+		}
+	}
+	if e, _ := entities[0].(map[string]any); jsonStr(e, "user_id") != bobID {
+		t.Errorf("mention user_id: got %v", e["user_id"])
+	}
+
+	// Only the real mention notifies bob
+	if _, err := bobWS.WaitFor("notification_create", wait); err != nil {
+		t.Fatalf("bob got no notification: %v", err)
+	}
+	aliceWS.Send("send_message", map[string]any{
+		"channel_id": channelID,
+		"content":    "```\n" + mention + "\n```",
+	})
+	data, err = aliceWS.WaitFor("message_create", wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msg = parseData(data)
+	if mentions, _ := msg["mentions"].([]any); len(mentions) != 0 {
+		t.Errorf("mention in code block should not count: %v", msg["mentions"])
+	}
+	if entities, _ := msg["entities"].([]any); len(entities) != 1 || jsonStr(entities[0].(map[string]any), "type") != "code_block" {
+		t.Errorf("expected one code_block entity, got %v", msg["entities"])
+	}
+	if _, err := bobWS.WaitFor("notification_create", shortNoEvent); err == nil {
+		t.Error("mention inside a code block should not notify")
+	}
+
+	// History carries them too
+	bob := NewHTTPClient()
+	bob.Token = bobToken
+	_, list, err := bob.GetJSONArray("/api/v1/channels/" + channelID + "/messages?limit=5")
+	if err != nil {
+		t.Fatalf("history: %v", err)
+	}
+	for _, item := range list {
+		m, _ := item.(map[string]any)
+		if jsonStr(m, "id") == jsonStr(msg, "id") {
+			if entities, _ := m["entities"].([]any); len(entities) != 1 {
+				t.Errorf("history entities: got %v", m["entities"])
+			}
+			return
+		}
+	}
+	t.Error("message missing from history")
+}
+
+// Only the first 20 links in a message become url entities.
+func TestMessageEntitiesURLCap(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+
+	content := ""
+	for i := 0; i < 25; i++ {
+		content += fmt.Sprintf("https://link%d.invalid/ ", i)
+	}
+	aliceWS.Send("send_message", map[string]any{"channel_id": channelID, "content": content})
+	data, err := aliceWS.WaitFor("message_create", wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	entities, _ := parseData(data)["entities"].([]any)
+	if len(entities) != 20 {
+		t.Fatalf("expected 20 url entities, got %d", len(entities))
+	}
+	if last, _ := entities[19].(map[string]any); jsonStr(last, "url") != "https://link19.invalid/" {
+		t.Errorf("expected the first 20 links, last was %v", last)
+	}
+}
@@ -5,12 +5,18 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
 	"io"
+	"net"
 	"net/http"
 	"os"
+	"os/exec"
+	"strconv"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"testing"
 	"time"
 
 	"nhooyr.io/websocket"
@@ -419,3 +425,100 @@ var pngData = []byte{
 	0x33, 0x00, 0x00, 0x00, 0x00, 0x49, 0x45, 0x4E, // IEND chunk
 	0x44, 0xAE, 0x42, 0x60, 0x82,
 }
+
+// uniquePNG returns a small PNG no other call returns, for uploads that
+// must not be deduplicated against another test's file.
+func uniquePNG() []byte {
+	n := uint64(time.Now().UnixNano()) ^ uint64(nameCounter.Add(1))<<48
+	img := image.NewGray(image.Rect(0, 0, 8, 1))
+	for i := range 8 {
+		img.Pix[i] = byte(n >> (8 * i))
+	}
+	var buf bytes.Buffer
+	png.Encode(&buf, img)
+	return buf.Bytes()
+}
+
+// --- Dedicated server ---
+
+// lockedBuffer collects a child process's output for reading while it runs.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// OwnServer is a second server instance started by a scenario that needs
+// flags the shared one doesn't run with, or needs to read the log.
+type OwnServer struct {
+	AdminToken string
+	log        *lockedBuffer
+}
+
+// Log returns everything the server has written so far.
+func (s *OwnServer) Log() string {
+	return s.log.String()
+}
+
+// startOwnServer runs the binary make validate builds (VOICECHAT_BIN
+// overrides it) with --dev, a fresh data dir and args, on a free port.
+// Until the test ends, serverURL points at it, so the usual helpers talk
+// to it; the first user registered on it is returned as its admin.
+func startOwnServer(t *testing.T, args ...string) *OwnServer {
+	t.Helper()
+	bin := os.Getenv("VOICECHAT_BIN")
+	if bin == "" {
+		bin = "../server/voicechat"
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("pick port: %v", err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	out := &lockedBuffer{}
+	cmd := exec.Command(bin, append([]string{"--dev", "--port", strconv.Itoa(port), "--data-dir", t.TempDir()}, args...)...)
+	cmd.Env = append(os.Environ(), "ALLOWED_ORIGINS=https://app.validation.test")
+	cmd.Stdout = out
+	cmd.Stderr = out
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("start %s: %v", bin, err)
+	}
+	sharedURL := serverURL
+	t.Cleanup(func() {
+		serverURL = sharedURL
+		cmd.Process.Kill()
+		cmd.Wait()
+	})
+	serverURL = fmt.Sprintf("http://127.0.0.1:%d", port)
+
+	for i := 0; ; i++ {
+		resp, err := http.Get(serverURL + "/api/v1/health")
+		if err == nil {
+			resp.Body.Close()
+			break
+		}
+		if i == 50 {
+			t.Fatalf("own server didn't start:\n%s", out.String())
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	status, body, err := NewHTTPClient().Register("admin", "adminpass")
+	if err != nil || status != 201 {
+		t.Fatalf("own server admin register: %d %v %v", status, body, err)
+	}
+	return &OwnServer{AdminToken: jsonStr(body, "token"), log: out}
+}
@@ -0,0 +1,98 @@
+package validation
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func getTestMagicLinkToken(t *testing.T, email string) string {
+	t.Helper()
+	c := NewHTTPClient()
+	status, body, err := c.GetJSON("/api/v1/test/magic-link-token?email=" + url.QueryEscape(email))
+	if err != nil || status != 200 {
+		t.Fatalf("get test magic link token: status=%d err=%v", status, err)
+	}
+	return jsonStr(body, "token")
+}
+
+// A verified, approved user can request a login link and trade it once for
+// a working session token.
+func TestMagicLinkLogin(t *testing.T) {
+	ensureAdmin(t)
+	configureEmailVerification(t, adminToken)
+	defer disableEmailVerification(t, adminToken)
+
+	name := uniqueName("magic")
+	email := strings.ToLower(name) + "@example.com"
+	if status, body, _ := registerWithEmail(NewHTTPClient(), name, email, "Str0ngP@ss"); status != 202 {
+		t.Fatalf("register: expected 202, got %d: %v", status, body)
+	}
+	verifyEmail(NewHTTPClient(), email, getTestVerificationCode(t, email))
+	approveUserByName(t, adminToken, name)
+
+	status, body, _ := NewHTTPClient().PostJSON("/api/v1/auth/magic-link", map[string]string{"email": email})
+	if status != 200 {
+		t.Fatalf("request magic link: expected 200, got %d: %v", status, body)
+	}
+	token := getTestMagicLinkToken(t, email)
+	if token == "" {
+		t.Fatal("no magic link token issued")
+	}
+
+	c := NewHTTPClient()
+	status, body, _ = c.GetJSON("/api/v1/auth/magic-link/consume?token=" + token)
+	if status != 200 {
+		t.Fatalf("consume: expected 200, got %d: %v", status, body)
+	}
+	if jsonStr(jsonMap(body, "user"), "username") != name {
+		t.Errorf("consume returned user %v, want %s", jsonMap(body, "user"), name)
+	}
+	session := jsonStr(body, "token")
+	ws, err := ConnectWS(session)
+	if err != nil {
+		t.Fatalf("session from magic link should connect: %v", err)
+	}
+	ws.Close()
+
+	status, _, _ = NewHTTPClient().GetJSON("/api/v1/auth/magic-link/consume?token=" + token)
+	if status != 400 {
+		t.Errorf("reused token: expected 400, got %d", status)
+	}
+}
+
+// Requests for unknown or unapproved addresses look identical to real ones
+// and issue no token.
+func TestMagicLinkDoesNotLeakAccounts(t *testing.T) {
+	ensureAdmin(t)
+	configureEmailVerification(t, adminToken)
+	defer disableEmailVerification(t, adminToken)
+
+	unknown := fmt.Sprintf("%s@example.com", uniqueName("nobody"))
+	status, body, _ := NewHTTPClient().PostJSON("/api/v1/auth/magic-link", map[string]string{"email": unknown})
+	if status != 200 || jsonStr(body, "status") != "sent" {
+		t.Errorf("unknown email: expected 200 sent, got %d: %v", status, body)
+	}
+	if tok := getTestMagicLinkToken(t, unknown); tok != "" {
+		t.Error("unknown email should not get a token")
+	}
+
+	// Verified but not yet approved
+	name := uniqueName("magic_pend")
+	email := strings.ToLower(name) + "@example.com"
+	registerWithEmail(NewHTTPClient(), name, email, "Str0ngP@ss")
+	verifyEmail(NewHTTPClient(), email, getTestVerificationCode(t, email))
+	status, _, _ = NewHTTPClient().PostJSON("/api/v1/auth/magic-link", map[string]string{"email": email})
+	if status != 200 {
+		t.Errorf("pending user: expected 200, got %d", status)
+	}
+	if tok := getTestMagicLinkToken(t, email); tok != "" {
+		t.Error("unapproved user should not get a token")
+	}
+
+	status, _, _ = NewHTTPClient().GetJSON("/api/v1/auth/magic-link/consume?token=deadbeef")
+	if status != 400 {
+		t.Errorf("bogus token: expected 400, got %d", status)
+	}
+}
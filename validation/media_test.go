@@ -0,0 +1,53 @@
+package validation
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+// A client connecting while a video is playing gets media_playback in
+// ready, and position + (server_time - updated_at) puts it at the live
+// position.
+func TestMediaPlaybackInReadyOnReconnect(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+
+	adminWS.Send("media_play", map[string]any{"video_id": "reconnect-video", "position": 10.0})
+	if _, err := adminWS.WaitFor("media_playback", wait); err != nil {
+		t.Fatalf("no media_playback: %v", err)
+	}
+	defer func() {
+		adminWS.Send("media_stop", map[string]any{})
+		adminWS.WaitFor("media_playback", wait)
+	}()
+
+	time.Sleep(1500 * time.Millisecond)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	pb := jsonMap(aliceWS.Ready, "media_playback")
+	if pb == nil {
+		t.Fatal("ready missing media_playback")
+	}
+	if jsonStr(pb, "video_id") != "reconnect-video" || !jsonBool(pb, "playing") {
+		t.Fatalf("media_playback: got %v", pb)
+	}
+
+	position, _ := pb["position"].(float64)
+	updatedAt, _ := pb["updated_at"].(float64)
+	serverTime, _ := aliceWS.Ready["server_time"].(float64)
+	live := position + (serverTime - updatedAt)
+	if math.Abs(live-11.5) > 0.75 {
+		t.Errorf("live position: got %.2f, want about 11.5", live)
+	}
+}
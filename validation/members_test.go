@@ -0,0 +1,76 @@
+package validation
+
+import "testing"
+
+// The member list pages in registration order; walking every page with a
+// small limit must visit each approved user exactly once and agree with
+// the total and with the count ready reports.
+func TestMemberListPagination(t *testing.T) {
+	ensureUsers(t)
+
+	c := NewHTTPClient()
+	c.Token = aliceToken
+
+	seen := map[string]bool{}
+	total := -1
+	after := ""
+	for pages := 0; ; pages++ {
+		if pages > 1000 {
+			t.Fatal("pagination did not terminate")
+		}
+		path := "/api/v1/users?limit=1"
+		if after != "" {
+			path += "&after=" + after
+		}
+		status, body, err := c.GetJSON(path)
+		if err != nil || status != 200 {
+			t.Fatalf("GET %s: status=%d err=%v body=%v", path, status, err, body)
+		}
+		users := jsonArray(body, "users")
+		if len(users) > 1 {
+			t.Fatalf("limit=1 returned %d users", len(users))
+		}
+		for _, u := range users {
+			id := jsonStr(u.(map[string]any), "id")
+			if seen[id] {
+				t.Fatalf("user %s returned twice", id)
+			}
+			seen[id] = true
+		}
+		total = int(body["total"].(float64))
+		next, _ := body["next"].(string)
+		if next == "" {
+			break
+		}
+		after = next
+	}
+
+	if len(seen) != total {
+		t.Errorf("walked %d users, total says %d", len(seen), total)
+	}
+	for _, id := range []string{adminID, aliceID, bobID} {
+		if !seen[id] {
+			t.Errorf("approved user %s missing from member list", id)
+		}
+	}
+
+	ws, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer ws.Close()
+	if got := ws.Ready["users_total"]; got != float64(total) {
+		t.Errorf("ready users_total = %v, want %d", got, total)
+	}
+}
+
+func TestMemberListRequiresAuth(t *testing.T) {
+	c := NewHTTPClient()
+	status, _, err := c.GetJSON("/api/v1/users")
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	if status != 401 {
+		t.Errorf("expected 401, got %d", status)
+	}
+}
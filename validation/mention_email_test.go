@@ -0,0 +1,139 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newVerifiedUser registers, verifies and approves a user with an email
+// address, returning its address, ID and session token. Email
+// verification must be configured.
+func newVerifiedUser(t *testing.T, prefix string) (string, string, string) {
+	t.Helper()
+	name := uniqueName(prefix)
+	addr := name + "@example.com"
+
+	registerWithEmail(NewHTTPClient(), name, addr, "Str0ngP@ss")
+	code := getTestVerificationCode(t, addr)
+	if status, body, _ := verifyEmail(NewHTTPClient(), addr, code); status != 200 {
+		t.Fatalf("verify: expected 200, got %d: %v", status, body)
+	}
+	approveUserByName(t, adminToken, name)
+
+	status, body, err := NewHTTPClient().Login(name, "Str0ngP@ss")
+	if err != nil || status != 200 {
+		t.Fatalf("login: status=%d err=%v body=%v", status, err, body)
+	}
+	return addr, jsonStr(jsonMap(body, "user"), "id"), jsonStr(body, "token")
+}
+
+func mentionEmails(t *testing.T, addr string) []any {
+	t.Helper()
+	_, body, err := NewHTTPClient().GetJSON("/api/v1/test/mention-emails?email=" + addr)
+	if err != nil {
+		t.Fatalf("get mention emails: %v", err)
+	}
+	return jsonArray(body, "emails")
+}
+
+// A user mentioned while offline gets one email batching those mentions,
+// minus the ones in channels they muted, and no second email inside the
+// rate-limit window.
+func TestOfflineMentionEmail(t *testing.T) {
+	ensureUsers(t)
+	configureEmailVerification(t, adminToken)
+	defer disableEmailVerification(t, adminToken)
+
+	addr, userID, token := newVerifiedUser(t, "mail")
+	user := NewHTTPClient()
+	user.Token = token
+
+	_, pref, _ := user.GetJSON("/api/v1/auth/mention-email")
+	if !jsonBool(pref, "enabled") {
+		t.Fatalf("mention emails should default on: %v", pref)
+	}
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	mutedName := uniqueName("muted")
+	adminWS.Send("create_channel", map[string]any{"name": mutedName, "type": "text"})
+	created, err := adminWS.WaitForMatch("channel_create", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "name") == mutedName
+	}, wait)
+	if err != nil {
+		t.Fatalf("create channel: %v", err)
+	}
+	mutedID := jsonStr(parseData(created), "id")
+
+	resp, err := user.do("PUT", "/api/v1/channels/"+mutedID+"/mute", nil)
+	if err != nil {
+		t.Fatalf("mute: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 200 {
+		t.Fatalf("mute: expected 200, got %d", resp.StatusCode)
+	}
+	_, muted, _ := user.GetJSON("/api/v1/channels/" + mutedID + "/mute")
+	if !jsonBool(muted, "muted") {
+		t.Fatalf("channel should be muted: %v", muted)
+	}
+
+	send := func(chID, text string) {
+		aliceWS.Send("send_message", map[string]any{
+			"channel_id": chID,
+			"content":    fmt.Sprintf("%s <@%s>", text, userID),
+		})
+		if _, err := aliceWS.WaitForMatch("message_create", func(raw json.RawMessage) bool {
+			return jsonStr(parseData(raw), "content") == fmt.Sprintf("%s <@%s>", text, userID)
+		}, wait); err != nil {
+			t.Fatalf("send %q: %v", text, err)
+		}
+	}
+	send(channelID, "first ping")
+	send(mutedID, "muted ping")
+	send(channelID, "second ping")
+
+	var emails []any
+	for deadline := time.Now().Add(15 * time.Second); time.Now().Before(deadline); time.Sleep(500 * time.Millisecond) {
+		if emails = mentionEmails(t, addr); len(emails) > 0 {
+			break
+		}
+	}
+	if len(emails) != 1 {
+		t.Fatalf("expected 1 mention email, got %d", len(emails))
+	}
+	batch := emails[0].([]any)
+	if len(batch) != 2 {
+		t.Fatalf("expected 2 mentions in the email (muted channel skipped), got %d: %v", len(batch), batch)
+	}
+	for _, m := range batch {
+		if strings.HasPrefix(jsonStr(m.(map[string]any), "content_preview"), "muted ping") {
+			t.Error("mention in muted channel should not be emailed")
+		}
+	}
+
+	// Inside the window: the next mention waits for the next email
+	send(channelID, "third ping")
+	time.Sleep(7 * time.Second)
+	if n := len(mentionEmails(t, addr)); n != 1 {
+		t.Errorf("expected no second email within the window, got %d emails", n)
+	}
+
+	status, pref, _ := user.PostJSON("/api/v1/auth/mention-email", map[string]bool{"enabled": false})
+	if status != 200 || jsonBool(pref, "enabled") {
+		t.Errorf("opt out: expected 200 enabled=false, got %d %v", status, pref)
+	}
+}
@@ -0,0 +1,141 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// GET /api/v1/mentions lists messages mentioning the caller, newest
+// first, and drops them once deleted.
+func TestMentionsInbox(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	channelID := findTextChannel(aliceWS.Ready)
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		aliceWS.Send("send_message", map[string]any{
+			"channel_id": channelID,
+			"content":    fmt.Sprintf("inbox %d <@%s>", i, bobID),
+		})
+		data, err := aliceWS.WaitFor("message_create", wait)
+		if err != nil {
+			t.Fatalf("no message_create: %v", err)
+		}
+		ids = append(ids, jsonStr(parseData(data), "id"))
+	}
+
+	bob := NewHTTPClient()
+	bob.Token = bobToken
+	status, list, err := bob.GetJSONArray("/api/v1/mentions?limit=2")
+	if err != nil || status != 200 {
+		t.Fatalf("get mentions: %d %v", status, err)
+	}
+	if len(list) != 2 {
+		t.Fatalf("expected 2 mentions, got %d", len(list))
+	}
+	first, _ := list[0].(map[string]any)
+	if jsonStr(first, "id") != ids[1] {
+		t.Errorf("newest mention first: got %v", first["id"])
+	}
+	if jsonStr(jsonMap(first, "author"), "id") != aliceID {
+		t.Errorf("author: got %v", first["author"])
+	}
+	if jsonStr(first, "channel_id") != channelID || jsonStr(first, "channel_name") == "" {
+		t.Errorf("channel context missing: %v", first)
+	}
+
+	// Cursor pagination
+	status, older, err := bob.GetJSONArray("/api/v1/mentions?limit=1&before=" + ids[1])
+	if err != nil || status != 200 || len(older) != 1 {
+		t.Fatalf("paginate mentions: %d %v %v", status, older, err)
+	}
+	if m, _ := older[0].(map[string]any); jsonStr(m, "id") != ids[0] {
+		t.Errorf("before cursor: got %v", m["id"])
+	}
+
+	// Deleted messages drop out
+	aliceWS.Send("delete_message", map[string]any{"message_id": ids[1]})
+	if _, err := aliceWS.WaitFor("message_delete", wait); err != nil {
+		t.Fatalf("no message_delete: %v", err)
+	}
+	_, list, _ = bob.GetJSONArray("/api/v1/mentions?limit=2")
+	for _, item := range list {
+		if m, _ := item.(map[string]any); jsonStr(m, "id") == ids[1] {
+			t.Error("deleted message still listed in mentions")
+		}
+	}
+
+	// Alice isn't mentioned in these
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+	_, list, _ = alice.GetJSONArray("/api/v1/mentions")
+	for _, item := range list {
+		if m, _ := item.(map[string]any); jsonStr(m, "id") == ids[0] {
+			t.Error("alice should not see bob's mentions")
+		}
+	}
+}
+
+// Mentioning a user twice notifies them once, and a message over the
+// mention cap (20 by default) is rejected unsaved.
+func TestMentionDedupAndCap(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+
+	content := fmt.Sprintf("%s <@%s> and again <@%s>", uniqueName("twice"), bobID, bobID)
+	aliceWS.Send("send_message", map[string]any{"channel_id": channelID, "content": content})
+	data, err := aliceWS.WaitForMatch("message_create", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "content") == content
+	}, wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msg := parseData(data)
+	if mentions := jsonArray(msg, "mentions"); len(mentions) != 1 {
+		t.Errorf("expected bob listed once in mentions, got %v", mentions)
+	}
+	forMsg := func(raw json.RawMessage) bool {
+		return jsonStr(jsonMap(parseData(raw), "data"), "message_id") == jsonStr(msg, "id")
+	}
+	if _, err := bobWS.WaitForMatch("notification_create", forMsg, wait); err != nil {
+		t.Fatalf("bob should be notified: %v", err)
+	}
+	if _, err := bobWS.WaitForMatch("notification_create", forMsg, shortNoEvent); err == nil {
+		t.Error("a repeated mention should not notify twice")
+	}
+
+	var many strings.Builder
+	for i := 0; i < 21; i++ {
+		fmt.Fprintf(&many, "<@%08d-0000-0000-0000-000000000000> ", i)
+	}
+	aliceWS.Send("send_message", map[string]any{"channel_id": channelID, "content": many.String()})
+	e := waitForOpError(t, aliceWS, "send_message")
+	if jsonStr(e, "code") != "invalid_request" {
+		t.Errorf("over the mention cap: expected invalid_request, got %v", e)
+	}
+	if _, err := aliceWS.WaitForMatch("message_create", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "content") == many.String()
+	}, shortNoEvent); err == nil {
+		t.Error("a message over the mention cap should not be saved")
+	}
+}
@@ -0,0 +1,54 @@
+package validation
+
+import "testing"
+
+// /messages/around/{id} returns the target with limit/2 messages on each
+// side, oldest first, even when they share a created_at second.
+func TestMessagesAround(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+
+	var ids []string
+	for i := 0; i < 7; i++ {
+		aliceWS.Send("send_message", map[string]any{"channel_id": channelID, "content": uniqueName("around")})
+		data, err := aliceWS.WaitFor("message_create", wait)
+		if err != nil {
+			t.Fatalf("no message_create: %v", err)
+		}
+		ids = append(ids, jsonStr(parseData(data), "id"))
+	}
+
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+	base := "/api/v1/channels/" + channelID + "/messages"
+
+	status, list, err := alice.GetJSONArray(base + "/around/" + ids[3] + "?limit=4")
+	if err != nil || status != 200 {
+		t.Fatalf("around: %d %v", status, err)
+	}
+	want := ids[1:6]
+	if len(list) != len(want) {
+		t.Fatalf("expected %d messages, got %d", len(want), len(list))
+	}
+	for i, item := range list {
+		if got := jsonStr(item.(map[string]any), "id"); got != want[i] {
+			t.Errorf("position %d: got %s, want %s", i, got, want[i])
+		}
+	}
+
+	// The query form is the same window, newest first
+	_, legacy, _ := alice.GetJSONArray(base + "?limit=4&around=" + ids[3])
+	if len(legacy) != len(want) || jsonStr(legacy[0].(map[string]any), "id") != ids[5] {
+		t.Errorf("?around= should return the window newest first, got %d items", len(legacy))
+	}
+
+	if status, _, _ := alice.GetJSONArray(base + "/around/00000000-0000-0000-0000-00000000beef"); status != 404 {
+		t.Errorf("unknown target: expected 404, got %d", status)
+	}
+}
@@ -0,0 +1,161 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// Resending send_message with the same nonce returns the original
+// message to the sender instead of storing a duplicate.
+func TestSendMessageNonceIsIdempotent(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	channelID := findTextChannel(aliceWS.Ready)
+	nonce := uniqueName("nonce")
+	content := uniqueName("once")
+	send := map[string]any{"channel_id": channelID, "content": content, "nonce": nonce}
+	byNonce := func(d json.RawMessage) bool { return jsonStr(parseData(d), "nonce") == nonce }
+
+	aliceWS.Send("send_message", send)
+	data, err := aliceWS.WaitForMatch("message_create", byNonce, wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	firstID := jsonStr(parseData(data), "id")
+	if _, err := bobWS.WaitForMatch("message_create", byNonce, wait); err != nil {
+		t.Fatalf("bob should see the original: %v", err)
+	}
+
+	aliceWS.Send("send_message", send)
+	data, err = aliceWS.WaitForMatch("message_create", byNonce, wait)
+	if err != nil {
+		t.Fatalf("resend should echo the stored message: %v", err)
+	}
+	if id := jsonStr(parseData(data), "id"); id != firstID {
+		t.Errorf("resend created a new message: %s != %s", id, firstID)
+	}
+	if _, err := bobWS.WaitForMatch("message_create", byNonce, 500*time.Millisecond); err == nil {
+		t.Error("resend should not be broadcast to others")
+	}
+
+	c := NewHTTPClient()
+	c.Token = aliceToken
+	_, msgs, err := c.GetJSONArray("/api/v1/channels/" + channelID + "/messages?limit=20")
+	if err != nil {
+		t.Fatalf("get messages: %v", err)
+	}
+	n := 0
+	for _, m := range msgs {
+		if jsonStr(m.(map[string]any), "content") == content {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("expected 1 stored copy, got %d", n)
+	}
+}
+
+// Resending a nonce whose message was deleted gets an error, not the
+// deleted message back.
+func TestSendMessageNonceAfterDelete(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	channelID := findTextChannel(aliceWS.Ready)
+	nonce := uniqueName("nonce")
+	send := map[string]any{"channel_id": channelID, "content": uniqueName("gone"), "nonce": nonce}
+	byNonce := func(d json.RawMessage) bool { return jsonStr(parseData(d), "nonce") == nonce }
+
+	aliceWS.Send("send_message", send)
+	data, err := aliceWS.WaitForMatch("message_create", byNonce, wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msgID := jsonStr(parseData(data), "id")
+	aliceWS.Send("delete_message", map[string]any{"message_id": msgID})
+	if _, err := aliceWS.WaitFor("message_delete", wait); err != nil {
+		t.Fatalf("no message_delete: %v", err)
+	}
+
+	aliceWS.Send("send_message", send)
+	if e := waitForOpError(t, aliceWS, "send_message"); jsonStr(e, "code") != "invalid_request" {
+		t.Errorf("resend after delete: got %v", e)
+	}
+	if data, err := aliceWS.WaitForMatch("message_create", byNonce, 500*time.Millisecond); err == nil {
+		t.Errorf("deleted message was resent: %s", data)
+	}
+}
+
+// A send_message with a nonce is acked to the sending connection alone,
+// ahead of the broadcast; a resend acks the stored message again.
+func TestSendMessageAck(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	aliceTab2, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice second ws: %v", err)
+	}
+	defer aliceTab2.Close()
+
+	channelID := findTextChannel(aliceWS.Ready)
+	nonce := uniqueName("ack")
+	send := map[string]any{"channel_id": channelID, "content": uniqueName("acked"), "nonce": nonce}
+	byNonce := func(d json.RawMessage) bool { return jsonStr(parseData(d), "nonce") == nonce }
+
+	aliceWS.Send("send_message", send)
+	data, err := aliceWS.WaitForMatch("message_create", byNonce, wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msgID := jsonStr(parseData(data), "id")
+	// Already buffered: it came before the broadcast
+	data, err = aliceWS.WaitFor("ack", 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("no ack ahead of message_create: %v", err)
+	}
+	ack := parseData(data)
+	if jsonStr(ack, "nonce") != nonce || jsonStr(ack, "id") != msgID || jsonStr(ack, "channel_id") != channelID || jsonStr(ack, "created_at") == "" {
+		t.Errorf("ack: got %v, want id %s", ack, msgID)
+	}
+	if _, err := aliceTab2.WaitFor("ack", 500*time.Millisecond); err == nil {
+		t.Error("ack should go only to the sending connection")
+	}
+
+	aliceWS.Send("send_message", send)
+	data, err = aliceWS.WaitFor("ack", wait)
+	if err != nil {
+		t.Fatalf("no ack for the resend: %v", err)
+	}
+	if id := jsonStr(parseData(data), "id"); id != msgID {
+		t.Errorf("resend ack id %s, want %s", id, msgID)
+	}
+
+	// No nonce, no ack
+	aliceWS.Send("send_message", map[string]any{"channel_id": channelID, "content": uniqueName("plain")})
+	aliceWS.WaitFor("message_create", wait)
+	if data, err := aliceWS.WaitFor("ack", 500*time.Millisecond); err == nil {
+		t.Errorf("ack without a nonce: %s", data)
+	}
+}
@@ -0,0 +1,251 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Notifications can be listed with a cursor, deleted one at a time and
+// cleared; the user's other connections hear about deletions.
+func TestNotificationListAndClear(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	channelID := findTextChannel(aliceWS.Ready)
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		aliceWS.Send("send_message", map[string]any{
+			"channel_id": channelID,
+			"content":    fmt.Sprintf("notif %d <@%s>", i, bobID),
+		})
+		data, err := bobWS.WaitFor("notification_create", wait)
+		if err != nil {
+			t.Fatalf("no notification_create: %v", err)
+		}
+		ids = append(ids, jsonStr(parseData(data), "id"))
+	}
+
+	bob := NewHTTPClient()
+	bob.Token = bobToken
+	resp, err := bob.do("GET", "/api/v1/notifications?limit=2", nil)
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("list notifications: %v %v", resp, err)
+	}
+	resp.Body.Close()
+	if n, err := strconv.Atoi(resp.Header.Get("X-Unread-Count")); err != nil || n < 2 {
+		t.Errorf("X-Unread-Count: got %q", resp.Header.Get("X-Unread-Count"))
+	}
+
+	status, list, err := bob.GetJSONArray("/api/v1/notifications?limit=2")
+	if err != nil || status != 200 || len(list) != 2 {
+		t.Fatalf("list notifications: %d %v %v", status, list, err)
+	}
+	if n, _ := list[0].(map[string]any); jsonStr(n, "id") != ids[1] {
+		t.Errorf("newest notification first: got %v", n["id"])
+	}
+
+	status, older, err := bob.GetJSONArray("/api/v1/notifications?limit=1&before=" + ids[1])
+	if err != nil || status != 200 || len(older) != 1 {
+		t.Fatalf("paginate notifications: %d %v %v", status, older, err)
+	}
+	if n, _ := older[0].(map[string]any); jsonStr(n, "id") != ids[0] {
+		t.Errorf("before cursor: got %v", n["id"])
+	}
+
+	// Alice can't delete bob's notification
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+	if status, _, _ := alice.DeleteJSON("/api/v1/notifications/" + ids[0]); status != 404 {
+		t.Errorf("deleting another user's notification: expected 404, got %d", status)
+	}
+
+	if status, _, err := bob.DeleteJSON("/api/v1/notifications/" + ids[0]); err != nil || status != 200 {
+		t.Fatalf("delete notification: %d %v", status, err)
+	}
+	data, err := bobWS.WaitFor("notifications_deleted", wait)
+	if err != nil {
+		t.Fatalf("no notifications_deleted: %v", err)
+	}
+	if got, _ := parseData(data)["ids"].([]any); len(got) != 1 || got[0] != ids[0] {
+		t.Errorf("notifications_deleted ids: got %v", parseData(data)["ids"])
+	}
+
+	status, result, err := bob.DeleteJSON("/api/v1/notifications")
+	if err != nil || status != 200 {
+		t.Fatalf("clear notifications: %d %v", status, err)
+	}
+	if n, _ := result["deleted"].(float64); n < 1 {
+		t.Errorf("clear-all deleted: got %v", result["deleted"])
+	}
+	data, err = bobWS.WaitFor("notifications_deleted", wait)
+	if err != nil {
+		t.Fatalf("no notifications_deleted after clear: %v", err)
+	}
+	if !jsonBool(parseData(data), "all") {
+		t.Error("clear-all should send all: true")
+	}
+
+	_, list, _ = bob.GetJSONArray("/api/v1/notifications")
+	if len(list) != 0 {
+		t.Errorf("expected no notifications after clear, got %d", len(list))
+	}
+}
+
+// Replying to someone's message notifies them once, as a reply; a reply
+// that also mentions them is just a mention, and a muted channel's
+// replies are left out.
+func TestReplyNotification(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	channelID := findTextChannel(bobWS.Ready)
+	post := func(ws *WSClient, text string, replyTo string) string {
+		t.Helper()
+		d := map[string]any{"channel_id": channelID, "content": text}
+		if replyTo != "" {
+			d["reply_to_id"] = replyTo
+		}
+		ws.Send("send_message", d)
+		data, err := ws.WaitForMatch("message_create", func(raw json.RawMessage) bool {
+			return jsonStr(parseData(raw), "content") == text
+		}, wait)
+		if err != nil {
+			t.Fatalf("no message_create for %q: %v", text, err)
+		}
+		return jsonStr(parseData(data), "id")
+	}
+
+	parentID := post(bobWS, uniqueName("reply me"), "")
+	replyText := uniqueName("a reply")
+	replyID := post(aliceWS, replyText, parentID)
+
+	data, err := bobWS.WaitFor("notification_create", wait)
+	if err != nil {
+		t.Fatalf("no notification for the reply: %v", err)
+	}
+	n := parseData(data)
+	nd := jsonMap(n, "data")
+	if jsonStr(n, "type") != "reply" || jsonStr(nd, "message_id") != replyID || jsonStr(nd, "reply_to_id") != parentID {
+		t.Errorf("reply notification: got %v", n)
+	}
+	if jsonStr(nd, "author_id") != aliceID || jsonStr(nd, "content_preview") != replyText {
+		t.Errorf("reply notification data: got %v", nd)
+	}
+	if data, err := bobWS.WaitFor("notification_create", 500*time.Millisecond); err == nil {
+		t.Errorf("reply notified twice: %s", data)
+	}
+
+	// Mentioning the author as well: one notification, a mention
+	post(aliceWS, uniqueName("hey")+" <@"+bobID+">", parentID)
+	data, err = bobWS.WaitFor("notification_create", wait)
+	if err != nil {
+		t.Fatalf("no notification for the mentioning reply: %v", err)
+	}
+	if typ := jsonStr(parseData(data), "type"); typ != "mention" {
+		t.Errorf("mentioning reply: type %q, want mention", typ)
+	}
+	if data, err := bobWS.WaitFor("notification_create", 500*time.Millisecond); err == nil {
+		t.Errorf("mentioning reply notified twice: %s", data)
+	}
+
+	// Replying to yourself notifies no one
+	post(bobWS, uniqueName("self"), parentID)
+	if data, err := bobWS.WaitFor("notification_create", 500*time.Millisecond); err == nil {
+		t.Errorf("self-reply notified: %s", data)
+	}
+
+	bob := NewHTTPClient()
+	bob.Token = bobToken
+	resp, err := bob.do("PUT", "/api/v1/channels/"+channelID+"/mute", nil)
+	if err != nil || resp.StatusCode != 200 {
+		t.Fatalf("mute: %v %v", resp, err)
+	}
+	resp.Body.Close()
+	defer func() {
+		if resp, err := bob.do("DELETE", "/api/v1/channels/"+channelID+"/mute", nil); err == nil {
+			resp.Body.Close()
+		}
+	}()
+	quiet := uniqueName("quiet")
+	post(aliceWS, quiet, parentID)
+	if data, err := bobWS.WaitForMatch("notification_create", func(raw json.RawMessage) bool {
+		return jsonStr(jsonMap(parseData(raw), "data"), "content_preview") == quiet
+	}, 500*time.Millisecond); err == nil {
+		t.Errorf("reply in a muted channel notified: %s", data)
+	}
+}
+
+// A reply's preview shows mentions by name and is cut on a character
+// boundary, as a mention's is.
+func TestReplyNotificationPreview(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	channelID := findTextChannel(bobWS.Ready)
+	parent := uniqueName("preview parent")
+	bobWS.Send("send_message", map[string]any{"channel_id": channelID, "content": parent})
+	data, err := bobWS.WaitForMatch("message_create", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "content") == parent
+	}, wait)
+	if err != nil {
+		t.Fatalf("no message_create for the parent: %v", err)
+	}
+	parentID := jsonStr(parseData(data), "id")
+
+	// Two-byte characters, so a byte cut at 80 would split one
+	long := strings.Repeat("é", 100)
+	aliceWS.Send("send_message", map[string]any{
+		"channel_id":  channelID,
+		"content":     "<@" + adminID + "> " + long,
+		"reply_to_id": parentID,
+	})
+	data, err = bobWS.WaitForMatch("notification_create", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "type") == "reply"
+	}, wait)
+	if err != nil {
+		t.Fatalf("no reply notification: %v", err)
+	}
+	preview := jsonStr(jsonMap(parseData(data), "data"), "content_preview")
+	want := string([]rune("@" + adminName + " " + long)[:80]) + "..."
+	if preview != want {
+		t.Errorf("reply preview:\n got %q\nwant %q", preview, want)
+	}
+}
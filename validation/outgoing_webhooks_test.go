@@ -0,0 +1,127 @@
+package validation
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+type outgoingDelivery struct {
+	header http.Header
+	body   []byte
+}
+
+// An outgoing webhook receives signed POSTs for the events it subscribed
+// to and nothing else, and stops receiving them once deleted.
+func TestOutgoingWebhookDelivery(t *testing.T) {
+	ensureUsers(t)
+
+	received := make(chan outgoingDelivery, 16)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- outgoingDelivery{header: r.Header.Clone(), body: body}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	base := "/api/v1/admin/outgoing-webhooks"
+
+	bob := NewHTTPClient()
+	bob.Token = bobToken
+	if status, _, _ := bob.PostJSON(base, map[string]any{"name": "x", "url": receiver.URL, "events": []string{"message_create"}}); status != 403 {
+		t.Errorf("non-admin create: expected 403, got %d", status)
+	}
+
+	admin := NewHTTPClient()
+	admin.Token = adminToken
+	if status, _, _ := admin.PostJSON(base, map[string]any{"name": "x", "url": receiver.URL, "events": []string{"typing_start"}}); status != 400 {
+		t.Errorf("unsupported event: expected 400, got %d", status)
+	}
+	if status, _, _ := admin.PostJSON(base, map[string]any{"name": "x", "url": "ftp://example.com", "events": []string{"message_create"}}); status != 400 {
+		t.Errorf("non-http url: expected 400, got %d", status)
+	}
+
+	status, hook, err := admin.PostJSON(base, map[string]any{
+		"name":   uniqueName("ow"),
+		"url":    receiver.URL,
+		"events": []string{"message_create"},
+	})
+	if err != nil || status != 201 {
+		t.Fatalf("create outgoing webhook: %d %v %v", status, hook, err)
+	}
+	hookID, secret := jsonStr(hook, "id"), jsonStr(hook, "secret")
+	if hookID == "" || secret == "" {
+		t.Fatalf("create response missing id/secret: %v", hook)
+	}
+
+	status, list, err := admin.GetJSONArray(base)
+	if err != nil || status != 200 {
+		t.Fatalf("list outgoing webhooks: %d %v", status, err)
+	}
+	for _, item := range list {
+		if _, leaked := item.(map[string]any)["secret"]; leaked {
+			t.Error("list should not include secrets")
+		}
+	}
+
+	// Connecting broadcasts user_online, which this webhook didn't ask for.
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+
+	content := uniqueName("outgoing")
+	aliceWS.Send("send_message", map[string]any{"channel_id": channelID, "content": content})
+
+	var got outgoingDelivery
+	select {
+	case got = <-received:
+	case <-time.After(wait):
+		t.Fatal("no webhook delivery for message_create")
+	}
+	if ev := got.header.Get("X-Webhook-Event"); ev != "message_create" {
+		t.Fatalf("expected only message_create deliveries, got %q", ev)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(got.header.Get("X-Webhook-Timestamp") + "."))
+	mac.Write(got.body)
+	if want := "sha256=" + hex.EncodeToString(mac.Sum(nil)); got.header.Get("X-Webhook-Signature") != want {
+		t.Errorf("bad signature %q", got.header.Get("X-Webhook-Signature"))
+	}
+	var envelope struct {
+		Op string         `json:"op"`
+		D  map[string]any `json:"d"`
+	}
+	if err := json.Unmarshal(got.body, &envelope); err != nil {
+		t.Fatalf("delivery body: %v", err)
+	}
+	if envelope.Op != "message_create" || jsonStr(envelope.D, "content") != content {
+		t.Errorf("unexpected delivery body: %s", got.body)
+	}
+
+	if status, _, _ := admin.GetJSONArray(base + "/" + hookID + "/failures"); status != 200 {
+		t.Errorf("failures: expected 200, got %d", status)
+	}
+
+	if status, _, _ := admin.DeleteJSON(base + "/" + hookID); status != 200 {
+		t.Fatalf("delete outgoing webhook: expected 200, got %d", status)
+	}
+	if status, _, _ := admin.DeleteJSON(base + "/" + hookID); status != 404 {
+		t.Errorf("second delete: expected 404, got %d", status)
+	}
+
+	aliceWS.Send("send_message", map[string]any{"channel_id": channelID, "content": uniqueName("after")})
+	select {
+	case extra := <-received:
+		t.Errorf("delivery after delete: %s %s", extra.header.Get("X-Webhook-Event"), extra.body)
+	case <-time.After(shortNoEvent):
+	}
+}
@@ -0,0 +1,99 @@
+package validation
+
+import (
+	"strings"
+	"testing"
+)
+
+func setPasswordPolicy(t *testing.T, policy map[string]any) {
+	t.Helper()
+	c := NewHTTPClient()
+	c.Token = adminToken
+	status, body, err := c.PostJSON("/api/v1/admin/settings", map[string]any{
+		"password_policy": policy,
+	})
+	if err != nil || status != 200 {
+		t.Fatalf("set password policy: status=%d err=%v body=%v", status, err, body)
+	}
+}
+
+func resetPasswordPolicy(t *testing.T) {
+	setPasswordPolicy(t, map[string]any{"min_length": 4})
+}
+
+// A strict policy rejects weak passwords on register with a message naming
+// every unmet rule, is published in server info, and accepts a password
+// that satisfies it.
+func TestPasswordPolicyOnRegister(t *testing.T) {
+	ensureAdmin(t)
+	setPasswordPolicy(t, map[string]any{
+		"min_length":         10,
+		"require_password":   true,
+		"require_mixed_case": true,
+		"require_digit":      true,
+		"require_symbol":     true,
+	})
+	defer resetPasswordPolicy(t)
+
+	c := NewHTTPClient()
+	status, info, err := c.GetJSON("/api/v1/server/info")
+	if err != nil || status != 200 {
+		t.Fatalf("server info: status=%d err=%v", status, err)
+	}
+	policy := jsonMap(info, "password_policy")
+	if policy == nil || policy["min_length"] != float64(10) || !jsonBool(policy, "require_digit") {
+		t.Errorf("server info password_policy = %v", policy)
+	}
+
+	status, body, _ := NewHTTPClient().Register(uniqueName("pw_weak"), "short")
+	if status != 400 {
+		t.Fatalf("weak password: expected 400, got %d: %v", status, body)
+	}
+	msg := jsonStr(body, "error")
+	for _, want := range []string{"at least 10 characters", "uppercase", "digit", "symbol"} {
+		if !strings.Contains(msg, want) {
+			t.Errorf("error %q should mention %q", msg, want)
+		}
+	}
+
+	status, body, _ = NewHTTPClient().Register(uniqueName("pw_none"), "")
+	if status != 400 {
+		t.Errorf("empty password with require_password: expected 400, got %d: %v", status, body)
+	}
+
+	status, body, _ = NewHTTPClient().Register(uniqueName("pw_ok"), "Str0ng!Passw0rd")
+	if status != 202 {
+		t.Errorf("strong password: expected 202, got %d: %v", status, body)
+	}
+}
+
+func TestPasswordPolicyOnChange(t *testing.T) {
+	ensureUsers(t)
+	setPasswordPolicy(t, map[string]any{"min_length": 12})
+	defer resetPasswordPolicy(t)
+
+	c := NewHTTPClient()
+	c.Token = aliceToken
+	status, body, _ := c.PostJSON("/api/v1/auth/password", map[string]any{
+		"current_password": alicePass,
+		"new_password":     "tooshort",
+	})
+	if status != 400 {
+		t.Fatalf("weak new password: expected 400, got %d: %v", status, body)
+	}
+	if !strings.Contains(jsonStr(body, "error"), "at least 12 characters") {
+		t.Errorf("unexpected error: %v", body)
+	}
+}
+
+func TestPasswordPolicyRejectsInvalidMinLength(t *testing.T) {
+	ensureAdmin(t)
+	c := NewHTTPClient()
+	c.Token = adminToken
+	status, _, _ := c.PostJSON("/api/v1/admin/settings", map[string]any{
+		"password_policy": map[string]any{"min_length": 0},
+	})
+	if status != 400 {
+		t.Errorf("min_length 0: expected 400, got %d", status)
+	}
+}
@@ -0,0 +1,169 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// The pending_user notification carries the applicant's knock message so
+// admins can read it before approving.
+func TestPendingUserNotificationIncludesKnockMessage(t *testing.T) {
+	ensureAdmin(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+
+	username := uniqueName("knock")
+	knock := "<b>hi</b> — friend of alice"
+	status, body, err := NewHTTPClient().PostJSON("/api/v1/auth/register", map[string]any{
+		"username":      username,
+		"password":      "pass",
+		"knock_message": knock,
+	})
+	if err != nil || status != 202 {
+		t.Fatalf("register: status=%d err=%v body=%v", status, err, body)
+	}
+
+	data, err := adminWS.WaitForMatch("notification_create", func(raw json.RawMessage) bool {
+		return jsonStr(jsonMap(parseData(raw), "data"), "username") == username
+	}, wait)
+	if err != nil {
+		t.Fatalf("no pending_user notification: %v", err)
+	}
+	notifData := jsonMap(parseData(data), "data")
+	if got := jsonStr(notifData, "knock_message"); got != knock {
+		t.Errorf("knock_message = %q, want %q (verbatim, unescaped)", got, knock)
+	}
+}
+
+func findUserIDByName(t *testing.T, adminHTTP *HTTPClient, username string) string {
+	t.Helper()
+	_, users, err := adminHTTP.GetJSONArray("/api/v1/admin/users")
+	if err != nil {
+		t.Fatalf("list users: %v", err)
+	}
+	for _, u := range users {
+		um := u.(map[string]any)
+		if jsonStr(um, "username") == username {
+			return jsonStr(um, "id")
+		}
+	}
+	t.Fatalf("user %s not found", username)
+	return ""
+}
+
+// Rejecting a verified applicant removes the account and emails them;
+// established members can't be "rejected".
+func TestRejectPendingUser(t *testing.T) {
+	ensureUsers(t)
+	configureEmailVerification(t, adminToken)
+	defer disableEmailVerification(t, adminToken)
+
+	name := uniqueName("reject")
+	email := name + "@example.com"
+	registerWithEmail(NewHTTPClient(), name, email, "Str0ngP@ss")
+	verifyEmail(NewHTTPClient(), email, getTestVerificationCode(t, email))
+
+	adminHTTP := NewHTTPClient()
+	adminHTTP.Token = adminToken
+	userID := findUserIDByName(t, adminHTTP, name)
+
+	status, body, _ := adminHTTP.PostJSON("/api/v1/admin/users/"+userID+"/reject", map[string]string{
+		"reason": "We only admit people we know.",
+	})
+	if status != 200 || jsonStr(body, "status") != "rejected" {
+		t.Fatalf("reject: expected 200 rejected, got %d: %v", status, body)
+	}
+	if !jsonBool(body, "emailed") {
+		t.Error("applicant with an email should be notified")
+	}
+
+	if status, _, _ := NewHTTPClient().Login(name, "Str0ngP@ss"); status != 401 {
+		t.Errorf("login after rejection: expected 401, got %d", status)
+	}
+	if status, _, _ := adminHTTP.PostJSON("/api/v1/admin/users/"+userID+"/reject", nil); status != 404 {
+		t.Errorf("rejecting a deleted user: expected 404, got %d", status)
+	}
+
+	// Approved members must go through delete
+	status, _, _ = adminHTTP.PostJSON("/api/v1/admin/users/"+aliceID+"/reject", nil)
+	if status != 400 {
+		t.Errorf("rejecting an approved member: expected 400, got %d", status)
+	}
+}
+
+func TestRejectRequiresAdmin(t *testing.T) {
+	ensureUsers(t)
+	c := NewHTTPClient()
+	c.Token = aliceToken
+	status, _, _ := c.PostJSON("/api/v1/admin/users/"+bobID+"/reject", nil)
+	if status != 403 {
+		t.Errorf("non-admin reject: expected 403, got %d", status)
+	}
+}
+
+// The admin user list filters by status, and with verification on lists
+// pending users who haven't verified their email after the ones who have.
+func TestAdminUsersStatusFilter(t *testing.T) {
+	ensureUsers(t)
+	configureEmailVerification(t, adminToken)
+	defer disableEmailVerification(t, adminToken)
+
+	unverified := uniqueName("unverified")
+	registerWithEmail(NewHTTPClient(), unverified, unverified+"@example.com", "Str0ngP@ss")
+	verified := uniqueName("verified")
+	registerWithEmail(NewHTTPClient(), verified, verified+"@example.com", "Str0ngP@ss")
+	verifyEmail(NewHTTPClient(), verified+"@example.com", getTestVerificationCode(t, verified+"@example.com"))
+
+	adminHTTP := NewHTTPClient()
+	adminHTTP.Token = adminToken
+	list := func(status string) []any {
+		t.Helper()
+		code, users, err := adminHTTP.GetJSONArray("/api/v1/admin/users?status=" + status)
+		if err != nil || code != 200 {
+			t.Fatalf("list %s: %d %v", status, code, err)
+		}
+		return users
+	}
+	index := func(users []any, name string) int {
+		for i, u := range users {
+			if jsonStr(u.(map[string]any), "username") == name {
+				return i
+			}
+		}
+		return -1
+	}
+
+	pending := list("pending")
+	for _, u := range pending {
+		if jsonBool(u.(map[string]any), "approved") {
+			t.Errorf("pending filter returned an approved user: %v", u)
+		}
+	}
+	vi, ui := index(pending, verified), index(pending, unverified)
+	if vi < 0 || ui < 0 {
+		t.Fatalf("both applicants should be pending: verified=%d unverified=%d", vi, ui)
+	}
+	if vi > ui {
+		t.Errorf("verified applicant (%d) should be listed before the unverified one (%d)", vi, ui)
+	}
+
+	if got := list("approved"); index(got, aliceName) < 0 || index(got, verified) >= 0 {
+		t.Errorf("approved filter should include alice and not applicants")
+	}
+	if got := list("verified"); index(got, verified) < 0 || index(got, unverified) >= 0 {
+		t.Errorf("verified filter should include only verified emails")
+	}
+
+	resp, err := adminHTTP.do("GET", "/api/v1/admin/users?status=bogus", nil)
+	if err != nil {
+		t.Fatalf("bogus status: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 400 {
+		t.Errorf("unknown status: expected 400, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,303 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// A user in do-not-disturb still gets mention notifications, flagged
+// silent so the client can suppress the sound and popup.
+func TestDNDMentionsAreSilent(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	channelID := findTextChannel(aliceWS.Ready)
+
+	bobWS.Send("set_status", map[string]any{"status": "dnd"})
+	data, err := aliceWS.WaitForMatch("presence_update", func(d json.RawMessage) bool {
+		return jsonStr(parseData(d), "user_id") == bobID
+	}, wait)
+	if err != nil {
+		t.Fatalf("no presence_update: %v", err)
+	}
+	if jsonStr(parseData(data), "status") != "dnd" {
+		t.Errorf("expected dnd, got %v", parseData(data))
+	}
+
+	// Fresh connections see the status in online_users
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	seen := false
+	for _, u := range adminWS.Ready["online_users"].([]any) {
+		um := u.(map[string]any)
+		if jsonStr(um, "id") == bobID {
+			seen = true
+			if jsonStr(um, "status") != "dnd" {
+				t.Errorf("online_users status: got %q", jsonStr(um, "status"))
+			}
+		}
+	}
+	if !seen {
+		t.Error("bob missing from online_users")
+	}
+
+	aliceWS.Send("send_message", map[string]any{
+		"channel_id": channelID,
+		"content":    fmt.Sprintf("<@%s> quiet ping", bobID),
+	})
+	data, err = bobWS.WaitFor("notification_create", wait)
+	if err != nil {
+		t.Fatalf("dnd user should still get the notification: %v", err)
+	}
+	if !jsonBool(parseData(data), "silent") {
+		t.Error("notification for dnd user should be silent")
+	}
+
+	bobWS.Send("set_status", map[string]any{"status": "online"})
+	aliceWS.WaitForMatch("presence_update", func(d json.RawMessage) bool {
+		m := parseData(d)
+		return jsonStr(m, "user_id") == bobID && jsonStr(m, "status") == "online"
+	}, wait)
+
+	aliceWS.Send("send_message", map[string]any{
+		"channel_id": channelID,
+		"content":    fmt.Sprintf("<@%s> loud ping", bobID),
+	})
+	data, err = bobWS.WaitFor("notification_create", wait)
+	if err != nil {
+		t.Fatalf("no notification after going online: %v", err)
+	}
+	if jsonBool(parseData(data), "silent") {
+		t.Error("notification should not be silent once back online")
+	}
+}
+
+func TestSetStatusRejectsUnknown(t *testing.T) {
+	ensureUsers(t)
+	ws, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer ws.Close()
+
+	ws.Send("set_status", map[string]any{"status": "invisible"})
+	data, err := ws.WaitFor("error", wait)
+	if err != nil {
+		t.Fatalf("expected error for unknown status: %v", err)
+	}
+	if jsonStr(parseData(data), "op") != "set_status" {
+		t.Errorf("error op: got %v", parseData(data))
+	}
+}
+
+// ready carries the online count, and arrivals and departures reach
+// everyone as a debounced online_count.
+func TestOnlineCount(t *testing.T) {
+	ensureUsers(t)
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+
+	before, ok := adminWS.Ready["online_count"].(float64)
+	if !ok {
+		t.Fatalf("ready missing online_count: %v", adminWS.Ready["online_count"])
+	}
+	if want := len(jsonArray(adminWS.Ready, "online_users")) + 1; int(before) != want {
+		t.Errorf("online_count: got %v, want %d", before, want)
+	}
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	during, _ := aliceWS.Ready["online_count"].(float64)
+	if during != before+1 {
+		aliceWS.Close()
+		t.Fatalf("alice should add one: before %v, alice sees %v", before, during)
+	}
+	countIs := func(n float64) func(json.RawMessage) bool {
+		return func(d json.RawMessage) bool {
+			c, _ := parseData(d)["count"].(float64)
+			return c == n
+		}
+	}
+	if _, err := adminWS.WaitForMatch("online_count", countIs(during), wait); err != nil {
+		t.Errorf("no online_count after alice connected: %v", err)
+	}
+
+	aliceWS.Close()
+	if _, err := adminWS.WaitForMatch("online_count", countIs(before), wait); err != nil {
+		t.Errorf("no online_count after alice left: %v", err)
+	}
+}
+
+// A user with two connections stays online while either is open: closing
+// one sends nothing, closing the last sends user_offline.
+func TestPresenceAcrossConnections(t *testing.T) {
+	ensureUsers(t)
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	tabA, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice tab A: %v", err)
+	}
+	tabB, err := ConnectWS(aliceToken)
+	if err != nil {
+		tabA.Close()
+		t.Fatalf("alice tab B: %v", err)
+	}
+	defer tabB.Close()
+
+	aliceOffline := func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "user_id") == aliceID
+	}
+	tabA.Close()
+	if _, err := bobWS.WaitForMatch("user_offline", aliceOffline, time.Second); err == nil {
+		t.Fatal("user_offline sent while alice still has a connection")
+	}
+
+	// Someone arriving now sees alice online
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	online := false
+	for _, u := range jsonArray(adminWS.Ready, "online_users") {
+		if um, _ := u.(map[string]any); jsonStr(um, "id") == aliceID {
+			online = true
+		}
+	}
+	if !online {
+		t.Error("alice missing from online_users with one tab still open")
+	}
+
+	// The remaining tab still gets events addressed to alice
+	bobWS.Send("send_message", map[string]any{
+		"channel_id": findTextChannel(bobWS.Ready),
+		"content":    fmt.Sprintf("<@%s> still there?", aliceID),
+	})
+	if _, err := tabB.WaitFor("notification_create", wait); err != nil {
+		t.Errorf("remaining tab missed alice's notification: %v", err)
+	}
+
+	tabB.Close()
+	if _, err := bobWS.WaitForMatch("user_offline", aliceOffline, wait); err != nil {
+		t.Errorf("no user_offline after alice's last connection closed: %v", err)
+	}
+}
+
+// Past OnlineBurstSize (10) arrivals within OnlineBurstWindow (1s), the
+// rest of the window's users come online in a single users_online_bulk
+// rather than a user_online each.
+func TestUsersOnlineBulk(t *testing.T) {
+	ensureUsers(t)
+
+	const arrivals = 15
+	names := make([]string, arrivals)
+	tokens := make([]string, arrivals)
+	for i := range names {
+		names[i] = uniqueName("burst")
+		NewHTTPClient().Register(names[i], "pass")
+		approveUserByName(t, adminToken, names[i])
+		status, body, err := NewHTTPClient().Login(names[i], "pass")
+		if err != nil || status != 200 {
+			t.Fatalf("login %s: %d %v", names[i], status, err)
+		}
+		tokens[i] = jsonStr(body, "token")
+	}
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	// Let any window opened by earlier connects close
+	time.Sleep(1500 * time.Millisecond)
+	aliceWS.Drain()
+
+	conns := make(chan *WSClient, arrivals)
+	errs := make(chan error, arrivals)
+	for _, token := range tokens {
+		go func(token string) {
+			ws, err := ConnectWS(token)
+			if err != nil {
+				errs <- err
+				return
+			}
+			conns <- ws
+		}(token)
+	}
+	for range tokens {
+		select {
+		case ws := <-conns:
+			defer ws.Close()
+		case err := <-errs:
+			t.Fatalf("connect: %v", err)
+		}
+	}
+
+	isBurst := make(map[string]bool, arrivals)
+	for _, n := range names {
+		isBurst[n] = true
+	}
+	announced := map[string]int{}
+	data, err := aliceWS.WaitFor("users_online_bulk", wait)
+	if err != nil {
+		t.Fatalf("no users_online_bulk: %v", err)
+	}
+	bulk := jsonArray(parseData(data), "users")
+	if len(bulk) < arrivals-10 {
+		t.Errorf("users_online_bulk: %d users, want at least %d", len(bulk), arrivals-10)
+	}
+	for _, u := range bulk {
+		m, _ := u.(map[string]any)
+		announced[jsonStr(m, "username")]++
+	}
+	if _, err := aliceWS.WaitFor("users_online_bulk", 1500*time.Millisecond); err == nil {
+		t.Error("a second users_online_bulk for the same burst")
+	}
+
+	singles := 0
+	for {
+		data, err := aliceWS.WaitFor("user_online", shortNoEvent)
+		if err != nil {
+			break
+		}
+		name := jsonStr(jsonMap(parseData(data), "user"), "username")
+		if isBurst[name] {
+			announced[name]++
+			singles++
+		}
+	}
+	if singles > 10 {
+		t.Errorf("%d individual user_online events, want at most 10", singles)
+	}
+	for _, n := range names {
+		if announced[n] != 1 {
+			t.Errorf("%s announced %d times, want once", n, announced[n])
+		}
+	}
+}
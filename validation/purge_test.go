@@ -0,0 +1,265 @@
+package validation
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// delete_message with purge removes the message and its attachment files
+// outright; only admins may ask for it.
+func TestPurgeMessage(t *testing.T) {
+	ensureUsers(t)
+
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+	// Unique bytes: a file another test's attachment shares isn't removed
+	status, up, err := alice.UploadFile("/api/v1/upload", "file", "purge.png", uniquePNG(), "image/png")
+	if err != nil || status != 200 {
+		t.Fatalf("upload: %d %v", status, err)
+	}
+	fileURL := serverURL + jsonStr(up, "url")
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+
+	aliceWS.Send("send_message", map[string]any{
+		"channel_id":     channelID,
+		"content":        "purge me",
+		"attachment_ids": []string{jsonStr(up, "id")},
+	})
+	data, err := aliceWS.WaitFor("message_create", wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msgID := jsonStr(parseData(data), "id")
+
+	aliceWS.Send("send_message", map[string]any{"channel_id": channelID, "content": "a reply", "reply_to_id": msgID})
+	data, err = aliceWS.WaitFor("message_create", wait)
+	if err != nil {
+		t.Fatalf("no reply message_create: %v", err)
+	}
+	replyID := jsonStr(parseData(data), "id")
+
+	// The author can delete but not purge
+	aliceWS.Send("delete_message", map[string]any{"message_id": msgID, "purge": true})
+	if e := waitForOpError(t, aliceWS, "delete_message"); jsonStr(e, "code") != "forbidden" {
+		t.Errorf("non-admin purge: code %q, want forbidden", jsonStr(e, "code"))
+	}
+
+	adminWS.Send("delete_message", map[string]any{"message_id": msgID, "purge": true})
+	data, err = aliceWS.WaitFor("message_delete", wait)
+	if err != nil {
+		t.Fatalf("no message_delete: %v", err)
+	}
+	if got := jsonStr(parseData(data), "id"); got != msgID {
+		t.Errorf("message_delete id %q, want %q", got, msgID)
+	}
+
+	resp, err := http.Get(fileURL)
+	if err != nil {
+		t.Fatalf("get file: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 404 {
+		t.Errorf("purged attachment file: status %d, want 404", resp.StatusCode)
+	}
+
+	status, history, err := alice.GetJSONArray("/api/v1/channels/" + channelID + "/messages?limit=20")
+	if err != nil || status != 200 {
+		t.Fatalf("history: %d %v", status, err)
+	}
+	for _, item := range history {
+		m, _ := item.(map[string]any)
+		switch jsonStr(m, "id") {
+		case msgID:
+			t.Error("purged message still in history")
+		case replyID:
+			if m["reply_to"] != nil {
+				t.Errorf("reply still quotes the purged message: %v", m["reply_to"])
+			}
+		}
+	}
+}
+
+// Identical uploads share one file, so purging one message keeps the file
+// another message's attachment still points at.
+func TestPurgeKeepsSharedFile(t *testing.T) {
+	ensureUsers(t)
+
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+	shared := uniquePNG()
+	var ids []string
+	var fileURL string
+	for _, name := range []string{"first.png", "second.png"} {
+		status, up, err := alice.UploadFile("/api/v1/upload", "file", name, shared, "image/png")
+		if err != nil || status != 200 {
+			t.Fatalf("upload %s: %d %v", name, status, err)
+		}
+		ids = append(ids, jsonStr(up, "id"))
+		fileURL = serverURL + jsonStr(up, "url")
+	}
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+
+	var msgIDs []string
+	for _, id := range ids {
+		aliceWS.Send("send_message", map[string]any{
+			"channel_id":     channelID,
+			"content":        "same picture",
+			"attachment_ids": []string{id},
+		})
+		data, err := aliceWS.WaitFor("message_create", wait)
+		if err != nil {
+			t.Fatalf("no message_create: %v", err)
+		}
+		msgIDs = append(msgIDs, jsonStr(parseData(data), "id"))
+	}
+
+	fileStatus := func() int {
+		t.Helper()
+		resp, err := http.Get(fileURL)
+		if err != nil {
+			t.Fatalf("get file: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	purge := func(msgID string) {
+		t.Helper()
+		adminWS.Send("delete_message", map[string]any{"message_id": msgID, "purge": true})
+		if _, err := aliceWS.WaitForMatch("message_delete", func(raw json.RawMessage) bool {
+			return jsonStr(parseData(raw), "id") == msgID
+		}, wait); err != nil {
+			t.Fatalf("no message_delete for %s: %v", msgID, err)
+		}
+	}
+
+	purge(msgIDs[0])
+	if got := fileStatus(); got != 200 {
+		t.Errorf("file shared with another message after purge: status %d, want 200", got)
+	}
+	purge(msgIDs[1])
+	if got := fileStatus(); got != 404 {
+		t.Errorf("file after purging both messages: status %d, want 404", got)
+	}
+}
+
+// Purging a thread root hands the thread to its earliest reply rather
+// than dropping the replies into the channel. Notifications quoting the
+// purged message go with it, and their owners are told.
+func TestPurgeThreadRootAndNotifications(t *testing.T) {
+	ensureUsers(t)
+
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+
+	send := func(data map[string]any) string {
+		t.Helper()
+		data["channel_id"] = channelID
+		aliceWS.Send("send_message", data)
+		msg, err := aliceWS.WaitFor("message_create", wait)
+		if err != nil {
+			t.Fatalf("no message_create: %v", err)
+		}
+		return jsonStr(parseData(msg), "id")
+	}
+	rootID := send(map[string]any{"content": "secret for <@" + bobID + ">"})
+	data, err := bobWS.WaitForMatch("notification_create", func(raw json.RawMessage) bool {
+		return jsonStr(jsonMap(parseData(raw), "data"), "message_id") == rootID
+	}, wait)
+	if err != nil {
+		t.Fatalf("no mention notification: %v", err)
+	}
+	notifID := jsonStr(parseData(data), "id")
+	firstID := send(map[string]any{"content": "first in the thread", "thread_id": rootID})
+	secondID := send(map[string]any{"content": "second in the thread", "thread_id": rootID})
+
+	adminWS.Send("delete_message", map[string]any{"message_id": rootID, "purge": true})
+	if _, err := aliceWS.WaitForMatch("message_delete", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "id") == rootID
+	}, wait); err != nil {
+		t.Fatalf("no message_delete: %v", err)
+	}
+
+	// The first reply is the new root: in the timeline, the second isn't
+	status, history, err := alice.GetJSONArray("/api/v1/channels/" + channelID + "/messages?limit=20")
+	if err != nil || status != 200 {
+		t.Fatalf("history: %d %v", status, err)
+	}
+	inHistory := map[string]bool{}
+	for _, item := range history {
+		m, _ := item.(map[string]any)
+		inHistory[jsonStr(m, "id")] = true
+	}
+	if !inHistory[firstID] || inHistory[secondID] {
+		t.Errorf("history after purging the root: first reply listed %v, second %v; want true, false", inHistory[firstID], inHistory[secondID])
+	}
+	status, thread, err := alice.GetJSONArray("/api/v1/channels/" + channelID + "/threads/" + firstID + "/messages")
+	if err != nil || status != 200 {
+		t.Fatalf("thread: %d %v", status, err)
+	}
+	inThread := map[string]bool{}
+	for _, item := range thread {
+		m, _ := item.(map[string]any)
+		inThread[jsonStr(m, "id")] = true
+	}
+	if !inThread[firstID] || !inThread[secondID] {
+		t.Errorf("thread under the first reply: %v, want both replies", inThread)
+	}
+
+	data, err = bobWS.WaitFor("notifications_deleted", wait)
+	if err != nil {
+		t.Fatalf("no notifications_deleted: %v", err)
+	}
+	if ids := jsonArray(parseData(data), "ids"); len(ids) != 1 || ids[0] != notifID {
+		t.Errorf("notifications_deleted ids %v, want [%s]", ids, notifID)
+	}
+	bob := NewHTTPClient()
+	bob.Token = bobToken
+	status, list, err := bob.GetJSONArray("/api/v1/notifications?limit=50")
+	if err != nil || status != 200 {
+		t.Fatalf("notifications: %d %v", status, err)
+	}
+	for _, item := range list {
+		if m, _ := item.(map[string]any); jsonStr(m, "id") == notifID {
+			t.Error("notification for the purged message is still listed")
+		}
+	}
+}
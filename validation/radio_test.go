@@ -0,0 +1,970 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// uploadRadioTrack adds a tiny fake MP3 to the playlist and returns its id.
+func uploadRadioTrack(t *testing.T, token, playlistID, filename string) string {
+	t.Helper()
+	// ID3 header is enough for the server to sniff audio/mpeg
+	mp3 := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x00"), make([]byte, 256)...)
+	c := NewHTTPClient()
+	c.Token = token
+	status, body, err := c.UploadFile("/api/v1/radio/playlists/"+playlistID+"/tracks", "file", filename, mp3, "audio/mpeg")
+	if err != nil || status != 200 {
+		t.Fatalf("upload track: %d %v %v", status, body, err)
+	}
+	return jsonStr(body, "id")
+}
+
+// A listener reconnecting mid-track gets the station's playback state and
+// listener list in ready, so it can rejoin the stream without waiting for
+// the next broadcast.
+func TestRadioStateInReadyOnReconnect(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+
+	adminWS.Send("create_radio_station", map[string]any{"name": uniqueName("resume")})
+	data, err := adminWS.WaitFor("radio_station_create", wait)
+	if err != nil {
+		t.Fatalf("no radio_station_create: %v", err)
+	}
+	stationID := jsonStr(parseData(data), "id")
+	defer func() {
+		adminWS.Send("delete_radio_station", map[string]any{"station_id": stationID})
+		adminWS.WaitFor("radio_station_delete", wait)
+	}()
+
+	adminWS.Send("create_radio_playlist", map[string]any{"name": "Resume", "station_id": stationID})
+	data, err = adminWS.WaitFor("radio_playlist_created", wait)
+	if err != nil {
+		t.Fatalf("no radio_playlist_created: %v", err)
+	}
+	playlistID := jsonStr(parseData(data), "id")
+
+	uploadRadioTrack(t, adminToken, playlistID, "resume.mp3")
+
+	adminWS.Send("radio_tune", map[string]any{"station_id": stationID})
+	adminWS.WaitFor("radio_listeners", wait)
+	adminWS.Send("radio_play", map[string]any{"station_id": stationID, "playlist_id": playlistID})
+	if _, err := adminWS.WaitFor("radio_playback", wait); err != nil {
+		t.Fatalf("no radio_playback: %v", err)
+	}
+
+	// Alice connects (or reconnects) after playback started
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	pb := jsonMap(jsonMap(aliceWS.Ready, "radio_playback"), stationID)
+	if pb == nil {
+		t.Fatalf("ready missing radio_playback for station: %v", aliceWS.Ready["radio_playback"])
+	}
+	if !jsonBool(pb, "playing") {
+		t.Error("playback should be playing")
+	}
+	if jsonStr(pb, "playlist_id") != playlistID {
+		t.Errorf("playlist_id: got %q", jsonStr(pb, "playlist_id"))
+	}
+	if jsonStr(jsonMap(pb, "track"), "filename") != "resume.mp3" {
+		t.Errorf("track: got %v", pb["track"])
+	}
+	if _, ok := pb["updated_at"].(float64); !ok {
+		t.Error("playback should carry updated_at so the client can compute the live position")
+	}
+
+	listeners := jsonMap(aliceWS.Ready, "radio_listeners")
+	found := false
+	for _, uid := range jsonArray(listeners, stationID) {
+		if uid.(string) == adminID {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("ready radio_listeners should include admin: %v", listeners)
+	}
+}
+
+// Deleting the track a station is playing moves playback on to the next
+// track; deleting the last one ends the playlist per the station mode.
+func TestDeleteRadioTrackAdvancesPlayback(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+
+	adminWS.Send("create_radio_station", map[string]any{"name": uniqueName("deltrack")})
+	data, err := adminWS.WaitFor("radio_station_create", wait)
+	if err != nil {
+		t.Fatalf("no radio_station_create: %v", err)
+	}
+	stationID := jsonStr(parseData(data), "id")
+	defer func() {
+		adminWS.Send("delete_radio_station", map[string]any{"station_id": stationID})
+		adminWS.WaitFor("radio_station_delete", wait)
+	}()
+
+	adminWS.Send("create_radio_playlist", map[string]any{"name": "Del", "station_id": stationID})
+	data, err = adminWS.WaitFor("radio_playlist_created", wait)
+	if err != nil {
+		t.Fatalf("no radio_playlist_created: %v", err)
+	}
+	playlistID := jsonStr(parseData(data), "id")
+	first := uploadRadioTrack(t, adminToken, playlistID, "one.mp3")
+	second := uploadRadioTrack(t, adminToken, playlistID, "two.mp3")
+
+	adminWS.Send("radio_tune", map[string]any{"station_id": stationID})
+	adminWS.WaitFor("radio_listeners", wait)
+	adminWS.Send("radio_play", map[string]any{"station_id": stationID, "playlist_id": playlistID})
+	if _, err := adminWS.WaitFor("radio_playback", wait); err != nil {
+		t.Fatalf("no radio_playback: %v", err)
+	}
+
+	// Only the playlist owner may delete
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	aliceWS.Send("delete_radio_track", map[string]any{"track_id": first})
+	if _, err := adminWS.WaitFor("radio_playlist_tracks", 500*time.Millisecond); err == nil {
+		t.Error("non-owner should not be able to delete a track")
+	}
+
+	adminWS.Send("delete_radio_track", map[string]any{"track_id": first})
+	data, err = adminWS.WaitFor("radio_playback", wait)
+	if err != nil {
+		t.Fatalf("no radio_playback after deleting the playing track: %v", err)
+	}
+	pb := parseData(data)
+	if jsonStr(jsonMap(pb, "track"), "id") != second {
+		t.Errorf("expected playback to move to the next track, got %v", pb["track"])
+	}
+	data, err = adminWS.WaitForMatch("radio_playlist_tracks", func(d json.RawMessage) bool {
+		return jsonStr(parseData(d), "playlist_id") == playlistID
+	}, wait)
+	if err != nil {
+		t.Fatalf("no radio_playlist_tracks: %v", err)
+	}
+	if n := len(jsonArray(parseData(data), "tracks")); n != 1 {
+		t.Errorf("expected 1 track left, got %d", n)
+	}
+
+	// Last track gone: play_all has no further playlist, so the station stops
+	adminWS.Send("delete_radio_track", map[string]any{"track_id": second})
+	data, err = adminWS.WaitFor("radio_playback", wait)
+	if err != nil {
+		t.Fatalf("no radio_playback after deleting the last track: %v", err)
+	}
+	if !jsonBool(parseData(data), "stopped") {
+		t.Errorf("expected the station to stop, got %v", parseData(data))
+	}
+}
+
+// Deleting through the REST route behaves like the WebSocket op: playback
+// moves on and everyone gets the new track list.
+func TestDeleteRadioTrackOverREST(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	adminWS.Send("create_radio_station", map[string]any{"name": uniqueName("restdel")})
+	data, err := adminWS.WaitFor("radio_station_create", wait)
+	if err != nil {
+		t.Fatalf("no radio_station_create: %v", err)
+	}
+	stationID := jsonStr(parseData(data), "id")
+	defer func() {
+		adminWS.Send("delete_radio_station", map[string]any{"station_id": stationID})
+		adminWS.WaitFor("radio_station_delete", wait)
+	}()
+
+	adminWS.Send("create_radio_playlist", map[string]any{"name": "RestDel", "station_id": stationID})
+	data, err = adminWS.WaitFor("radio_playlist_created", wait)
+	if err != nil {
+		t.Fatalf("no radio_playlist_created: %v", err)
+	}
+	playlistID := jsonStr(parseData(data), "id")
+	first := uploadRadioTrack(t, adminToken, playlistID, "one.mp3")
+	second := uploadRadioTrack(t, adminToken, playlistID, "two.mp3")
+
+	adminWS.Send("radio_tune", map[string]any{"station_id": stationID})
+	adminWS.WaitFor("radio_listeners", wait)
+	adminWS.Send("radio_play", map[string]any{"station_id": stationID, "playlist_id": playlistID})
+	if _, err := adminWS.WaitFor("radio_playback", wait); err != nil {
+		t.Fatalf("no radio_playback: %v", err)
+	}
+	aliceWS.Drain()
+
+	c := NewHTTPClient()
+	c.Token = adminToken
+	if status, body, err := c.DeleteJSON("/api/v1/radio/tracks/" + first); err != nil || status != 200 {
+		t.Fatalf("delete track: %d %v %v", status, body, err)
+	}
+
+	data, err = adminWS.WaitFor("radio_playback", wait)
+	if err != nil {
+		t.Fatalf("no radio_playback after deleting the playing track: %v", err)
+	}
+	if got := jsonStr(jsonMap(parseData(data), "track"), "id"); got != second {
+		t.Errorf("expected playback to move to the next track, got %q", got)
+	}
+	data, err = aliceWS.WaitForMatch("radio_playlist_tracks", func(d json.RawMessage) bool {
+		return jsonStr(parseData(d), "playlist_id") == playlistID
+	}, wait)
+	if err != nil {
+		t.Fatalf("alice got no radio_playlist_tracks: %v", err)
+	}
+	if n := len(jsonArray(parseData(data), "tracks")); n != 1 {
+		t.Errorf("expected 1 track left, got %d", n)
+	}
+}
+
+func TestReorderRadioStations(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+
+	var ids []string
+	for i := 0; i < 2; i++ {
+		adminWS.Send("create_radio_station", map[string]any{"name": uniqueName("order")})
+		data, err := adminWS.WaitFor("radio_station_create", wait)
+		if err != nil {
+			t.Fatalf("no radio_station_create: %v", err)
+		}
+		ids = append(ids, jsonStr(parseData(data), "id"))
+	}
+	defer func() {
+		for _, id := range ids {
+			adminWS.Send("delete_radio_station", map[string]any{"station_id": id})
+			adminWS.WaitFor("radio_station_delete", wait)
+		}
+	}()
+
+	// Non-admins can't reorder
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	aliceWS.Send("reorder_radio_stations", map[string]any{"station_ids": []string{ids[1], ids[0]}})
+	if _, err := adminWS.WaitFor("radio_station_reorder", 500*time.Millisecond); err == nil {
+		t.Error("non-admin reorder should be ignored")
+	}
+
+	adminWS.Send("reorder_radio_stations", map[string]any{"station_ids": []string{ids[1], ids[0]}})
+	data, err := aliceWS.WaitFor("radio_station_reorder", wait)
+	if err != nil {
+		t.Fatalf("no radio_station_reorder: %v", err)
+	}
+	got := jsonArray(parseData(data), "station_ids")
+	if len(got) != 2 || got[0] != ids[1] || got[1] != ids[0] {
+		t.Errorf("station_ids: got %v", got)
+	}
+
+	// Order persists for new connections
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+	pos := map[string]float64{}
+	for _, s := range bobWS.Ready["radio_stations"].([]any) {
+		sm := s.(map[string]any)
+		pos[jsonStr(sm, "id")] = sm["position"].(float64)
+	}
+	if pos[ids[1]] >= pos[ids[0]] {
+		t.Errorf("expected %s before %s, positions %v / %v", ids[1], ids[0], pos[ids[1]], pos[ids[0]])
+	}
+}
+
+// Favorites are private per-user state: echoed to the user's own
+// connections and ready, never broadcast.
+func TestRadioFavorites(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+
+	adminWS.Send("create_radio_station", map[string]any{"name": uniqueName("fav")})
+	data, err := adminWS.WaitFor("radio_station_create", wait)
+	if err != nil {
+		t.Fatalf("no radio_station_create: %v", err)
+	}
+	stationID := jsonStr(parseData(data), "id")
+	defer func() {
+		adminWS.Send("delete_radio_station", map[string]any{"station_id": stationID})
+		adminWS.WaitFor("radio_station_delete", wait)
+	}()
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	aliceTab2, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws 2: %v", err)
+	}
+	defer aliceTab2.Close()
+
+	hasStation := func(ids []any) bool {
+		for _, id := range ids {
+			if id == stationID {
+				return true
+			}
+		}
+		return false
+	}
+
+	aliceWS.Send("favorite_station", map[string]any{"station_id": stationID})
+	data, err = aliceTab2.WaitFor("radio_favorites", wait)
+	if err != nil {
+		t.Fatalf("other tab should get radio_favorites: %v", err)
+	}
+	if !hasStation(jsonArray(parseData(data), "station_ids")) {
+		t.Errorf("favorites should include station: %v", parseData(data))
+	}
+	if _, err := adminWS.WaitFor("radio_favorites", 500*time.Millisecond); err == nil {
+		t.Error("favorites must not be broadcast to other users")
+	}
+
+	aliceWS3, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws 3: %v", err)
+	}
+	defer aliceWS3.Close()
+	if !hasStation(aliceWS3.Ready["radio_favorites"].([]any)) {
+		t.Errorf("ready radio_favorites: %v", aliceWS3.Ready["radio_favorites"])
+	}
+
+	aliceWS.Send("unfavorite_station", map[string]any{"station_id": stationID})
+	data, err = aliceWS.WaitForMatch("radio_favorites", func(d json.RawMessage) bool {
+		return !hasStation(jsonArray(parseData(d), "station_ids"))
+	}, wait)
+	if err != nil {
+		t.Fatalf("unfavorite should drop the station: %v", err)
+	}
+
+	aliceWS.Send("favorite_station", map[string]any{"station_id": "no-such-station"})
+	if e := waitForOpError(t, aliceWS, "favorite_station"); jsonStr(e, "code") != "not_found" {
+		t.Errorf("favorite unknown station: %v, want not_found", e)
+	}
+}
+
+// A tuned-in listener who isn't a manager may only control playback once
+// the station has public controls on.
+func TestRadioPublicControls(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	adminWS.Send("create_radio_station", map[string]any{"name": uniqueName("public")})
+	data, err := adminWS.WaitFor("radio_station_create", wait)
+	if err != nil {
+		t.Fatalf("no radio_station_create: %v", err)
+	}
+	stationID := jsonStr(parseData(data), "id")
+	defer func() {
+		adminWS.Send("delete_radio_station", map[string]any{"station_id": stationID})
+		adminWS.WaitFor("radio_station_delete", wait)
+	}()
+
+	adminWS.Send("create_radio_playlist", map[string]any{"name": "Public", "station_id": stationID})
+	data, err = adminWS.WaitFor("radio_playlist_created", wait)
+	if err != nil {
+		t.Fatalf("no radio_playlist_created: %v", err)
+	}
+	playlistID := jsonStr(parseData(data), "id")
+	uploadRadioTrack(t, adminToken, playlistID, "public.mp3")
+
+	adminWS.Send("radio_tune", map[string]any{"station_id": stationID})
+	adminWS.WaitFor("radio_listeners", wait)
+	adminWS.Send("radio_play", map[string]any{"station_id": stationID, "playlist_id": playlistID})
+	if _, err := adminWS.WaitFor("radio_playback", wait); err != nil {
+		t.Fatalf("no radio_playback: %v", err)
+	}
+
+	bobWS.Send("radio_tune", map[string]any{"station_id": stationID})
+	bobWS.WaitFor("radio_listeners", wait)
+	adminWS.WaitFor("radio_listeners", wait)
+
+	// Public controls off: bob is refused
+	bobWS.Send("radio_pause", map[string]any{"station_id": stationID, "position": 1.0})
+	data, err = bobWS.WaitFor("error", wait)
+	if err != nil {
+		t.Fatalf("bob got no error for radio_pause: %v", err)
+	}
+	if d := parseData(data); jsonStr(d, "op") != "radio_pause" || jsonStr(d, "code") != "forbidden" {
+		t.Errorf("error: got %v", d)
+	}
+	if _, err := adminWS.WaitFor("radio_playback", 500*time.Millisecond); err == nil {
+		t.Error("refused pause should not broadcast radio_playback")
+	}
+
+	adminWS.Send("set_radio_station_public_controls", map[string]any{"station_id": stationID, "enabled": true})
+	data, err = bobWS.WaitFor("radio_station_update", wait)
+	if err != nil {
+		t.Fatalf("no radio_station_update: %v", err)
+	}
+	if !jsonBool(parseData(data), "public_controls") {
+		t.Fatal("radio_station_update should carry public_controls true")
+	}
+
+	// Public controls on: bob may pause
+	bobWS.Send("radio_pause", map[string]any{"station_id": stationID, "position": 1.0})
+	data, err = adminWS.WaitFor("radio_playback", wait)
+	if err != nil {
+		t.Fatalf("bob's pause was not applied: %v", err)
+	}
+	if jsonBool(parseData(data), "playing") {
+		t.Error("playback should be paused")
+	}
+}
+
+// Playing stations send their listeners a periodic radio_position with
+// the server's current position; other users don't get it.
+func TestRadioPositionSync(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	adminWS.Send("create_radio_station", map[string]any{"name": uniqueName("sync")})
+	data, err := adminWS.WaitFor("radio_station_create", wait)
+	if err != nil {
+		t.Fatalf("no radio_station_create: %v", err)
+	}
+	stationID := jsonStr(parseData(data), "id")
+	defer func() {
+		adminWS.Send("delete_radio_station", map[string]any{"station_id": stationID})
+		adminWS.WaitFor("radio_station_delete", wait)
+	}()
+
+	adminWS.Send("create_radio_playlist", map[string]any{"name": "Sync", "station_id": stationID})
+	data, err = adminWS.WaitFor("radio_playlist_created", wait)
+	if err != nil {
+		t.Fatalf("no radio_playlist_created: %v", err)
+	}
+	playlistID := jsonStr(parseData(data), "id")
+	uploadRadioTrack(t, adminToken, playlistID, "sync.mp3")
+
+	adminWS.Send("radio_tune", map[string]any{"station_id": stationID})
+	adminWS.WaitFor("radio_listeners", wait)
+	adminWS.Send("radio_play", map[string]any{"station_id": stationID, "playlist_id": playlistID})
+	data, err = adminWS.WaitFor("radio_playback", wait)
+	if err != nil {
+		t.Fatalf("no radio_playback: %v", err)
+	}
+	startedAt := parseData(data)["updated_at"].(float64)
+
+	matchStation := func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "station_id") == stationID
+	}
+	data, err = adminWS.WaitForMatch("radio_position", matchStation, 8*time.Second)
+	if err != nil {
+		t.Fatalf("listener got no radio_position: %v", err)
+	}
+	pos := parseData(data)
+	updatedAt, _ := pos["updated_at"].(float64)
+	position, _ := pos["position"].(float64)
+	if updatedAt <= startedAt {
+		t.Errorf("updated_at should move forward: started %v, synced %v", startedAt, updatedAt)
+	}
+	if position < 0 {
+		t.Errorf("position should not be negative: %v", position)
+	}
+	if _, err := aliceWS.WaitForMatch("radio_position", matchStation, shortNoEvent); err == nil {
+		t.Error("radio_position should only go to the station's listeners")
+	}
+}
+
+// uploadTrackWaveform uploads a fake MP3 with the waveform form field the
+// browser sends, returning the status and response.
+func uploadTrackWaveform(t *testing.T, c *HTTPClient, playlistID, waveform string) (int, map[string]any) {
+	t.Helper()
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField("duration", "3")
+	mw.WriteField("waveform", waveform)
+	fw, _ := mw.CreateFormFile("file", "peaks.mp3")
+	fw.Write(append([]byte("ID3\x03\x00\x00\x00\x00\x00\x00"), make([]byte, 256)...))
+	mw.Close()
+
+	req, _ := http.NewRequest("POST", serverURL+"/api/v1/radio/playlists/"+playlistID+"/tracks", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("X-Real-IP", c.FakeIP)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	defer resp.Body.Close()
+	var result map[string]any
+	json.NewDecoder(resp.Body).Decode(&result)
+	return resp.StatusCode, result
+}
+
+// A waveform the browser supplies must be in the stored format, up to 200
+// ints in 0-100. Only the owner can regenerate one, and only from a file
+// the server can decode.
+func TestRadioTrackWaveform(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+
+	adminWS.Send("create_radio_station", map[string]any{"name": uniqueName("wave")})
+	data, err := adminWS.WaitFor("radio_station_create", wait)
+	if err != nil {
+		t.Fatalf("no radio_station_create: %v", err)
+	}
+	stationID := jsonStr(parseData(data), "id")
+	defer func() {
+		adminWS.Send("delete_radio_station", map[string]any{"station_id": stationID})
+		adminWS.WaitFor("radio_station_delete", wait)
+	}()
+
+	adminWS.Send("create_radio_playlist", map[string]any{"name": "Waves", "station_id": stationID})
+	data, err = adminWS.WaitFor("radio_playlist_created", wait)
+	if err != nil {
+		t.Fatalf("no radio_playlist_created: %v", err)
+	}
+	playlistID := jsonStr(parseData(data), "id")
+
+	admin := NewHTTPClient()
+	admin.Token = adminToken
+
+	peaks := make([]int, 200)
+	for i := range peaks {
+		peaks[i] = i / 2
+	}
+	compact, _ := json.Marshal(peaks)
+	status, track := uploadTrackWaveform(t, admin, playlistID, string(compact))
+	if status != 200 {
+		t.Fatalf("upload with compact waveform: %d %v", status, track)
+	}
+	if got := jsonStr(track, "waveform"); got != string(compact) {
+		t.Errorf("upload response waveform %q, want %q", got, compact)
+	}
+	trackID := jsonStr(track, "id")
+
+	for _, bad := range []string{
+		"[0.1,0.55,1]",                           // the browser's old 0..1 floats
+		"[0,101,50]",                             // out of range
+		"[]",                                     // nothing to draw
+		"{\"peaks\":[1]}",                        // not an array
+		string(compact[:len(compact)-1]) + ",1]", // 201 peaks
+	} {
+		c := NewHTTPClient() // a fresh upload rate-limit bucket each time
+		c.Token = adminToken
+		if status, body := uploadTrackWaveform(t, c, playlistID, bad); status != 400 {
+			t.Errorf("upload with waveform %.20q: status %d, want 400 (%v)", bad, status, body)
+		}
+	}
+
+	bob := NewHTTPClient()
+	bob.Token = bobToken
+	if status, _, _ := bob.PostJSON("/api/v1/radio/tracks/"+trackID+"/waveform", nil); status != 403 {
+		t.Errorf("non-owner regenerate: status %d, want 403", status)
+	}
+
+	// Not decodable: the fake MP3 is only an ID3 header
+	if status, _, _ := admin.PostJSON("/api/v1/radio/tracks/"+trackID+"/waveform", nil); status != 422 {
+		t.Errorf("undecodable regenerate: status %d, want 422", status)
+	}
+}
+
+// Every listener reports radio_track_ended; the station advances once,
+// and reports from users who aren't tuned in are ignored.
+func TestRadioTrackEndedAdvancesOnce(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	adminWS.Send("create_radio_station", map[string]any{"name": uniqueName("ended")})
+	data, err := adminWS.WaitFor("radio_station_create", wait)
+	if err != nil {
+		t.Fatalf("no radio_station_create: %v", err)
+	}
+	stationID := jsonStr(parseData(data), "id")
+	defer func() {
+		adminWS.Send("delete_radio_station", map[string]any{"station_id": stationID})
+		adminWS.WaitFor("radio_station_delete", wait)
+	}()
+
+	adminWS.Send("create_radio_playlist", map[string]any{"name": "Ended", "station_id": stationID})
+	data, err = adminWS.WaitFor("radio_playlist_created", wait)
+	if err != nil {
+		t.Fatalf("no radio_playlist_created: %v", err)
+	}
+	playlistID := jsonStr(parseData(data), "id")
+	for _, name := range []string{"one.mp3", "two.mp3", "three.mp3"} {
+		uploadRadioTrack(t, adminToken, playlistID, name)
+	}
+
+	adminWS.Send("radio_tune", map[string]any{"station_id": stationID})
+	adminWS.WaitFor("radio_listeners", wait)
+	bobWS.Send("radio_tune", map[string]any{"station_id": stationID})
+	if _, err := adminWS.WaitForMatch("radio_listeners", func(d json.RawMessage) bool {
+		for _, id := range jsonArray(parseData(d), "user_ids") {
+			if id == bobID {
+				return true
+			}
+		}
+		return false
+	}, wait); err != nil {
+		t.Fatalf("bob never tuned in: %v", err)
+	}
+	adminWS.Send("radio_play", map[string]any{"station_id": stationID, "playlist_id": playlistID})
+	if _, err := bobWS.WaitFor("radio_playback", wait); err != nil {
+		t.Fatalf("no radio_playback: %v", err)
+	}
+	adminWS.Drain()
+
+	// Alice isn't tuned in
+	aliceWS.Send("radio_track_ended", map[string]any{"station_id": stationID, "track_index": 0})
+	if _, err := bobWS.WaitFor("radio_playback", 500*time.Millisecond); err == nil {
+		t.Fatal("a non-listener's track_ended advanced the station")
+	}
+
+	adminWS.Send("radio_track_ended", map[string]any{"station_id": stationID, "track_index": 0})
+	bobWS.Send("radio_track_ended", map[string]any{"station_id": stationID, "track_index": 0})
+	data, err = bobWS.WaitFor("radio_playback", wait)
+	if err != nil {
+		t.Fatalf("track_ended didn't advance: %v", err)
+	}
+	if got := parseData(data)["track_index"]; got != 1.0 {
+		t.Errorf("track_index %v, want 1", got)
+	}
+	if data, err := bobWS.WaitFor("radio_playback", 500*time.Millisecond); err == nil {
+		t.Errorf("second report advanced again: %s", data)
+	}
+}
+
+// adtsAAC returns a raw ADTS stream of 44.1 kHz frames lasting about
+// seconds. Payloads are zeros; only the frame headers are read.
+func adtsAAC(seconds float64) []byte {
+	const frameLen = 16
+	frames := int(seconds * 44100 / 1024)
+	var out []byte
+	for i := 0; i < frames; i++ {
+		frame := make([]byte, frameLen)
+		copy(frame, []byte{0xFF, 0xF1, 0x50, 0x80 | frameLen>>11, byte(frameLen >> 3 & 0xFF), byte(frameLen&0x07)<<5 | 0x1F, 0xFC})
+		out = append(out, frame...)
+	}
+	return out
+}
+
+// oggPage builds one Ogg page holding a single packet. The CRC is left
+// zero; duration parsing doesn't check it.
+func oggPage(granule uint64, seq uint32, packet []byte) []byte {
+	page := []byte("OggS")
+	page = append(page, 0, 0)
+	page = binary.LittleEndian.AppendUint64(page, granule)
+	page = binary.LittleEndian.AppendUint32(page, 1)
+	page = binary.LittleEndian.AppendUint32(page, seq)
+	page = append(page, 0, 0, 0, 0, 1, byte(len(packet)))
+	return append(page, packet...)
+}
+
+// oggOpus returns a bare .opus file: an OpusHead page and a last page
+// whose granule position ends the stream at seconds.
+func oggOpus(seconds float64) []byte {
+	head := append([]byte("OpusHead"), 1, 2, 0, 0)
+	head = binary.LittleEndian.AppendUint32(head, 48000)
+	head = append(head, 0, 0, 0)
+	out := oggPage(0, 0, head)
+	return append(out, oggPage(uint64(seconds*48000), 1, make([]byte, 32))...)
+}
+
+// Raw ADTS AAC and bare Opus uploads get their duration from the server.
+func TestRadioTrackDurations(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+
+	adminWS.Send("create_radio_station", map[string]any{"name": uniqueName("durations")})
+	data, err := adminWS.WaitFor("radio_station_create", wait)
+	if err != nil {
+		t.Fatalf("no radio_station_create: %v", err)
+	}
+	stationID := jsonStr(parseData(data), "id")
+	defer func() {
+		adminWS.Send("delete_radio_station", map[string]any{"station_id": stationID})
+		adminWS.WaitFor("radio_station_delete", wait)
+	}()
+
+	admin := NewHTTPClient()
+	admin.Token = adminToken
+	for _, tc := range []struct {
+		name     string
+		data     []byte
+		mimeType string
+		want     float64
+	}{
+		{"song.aac", adtsAAC(10), "audio/aac", 10},
+		{"song.opus", oggOpus(5), "audio/opus", 5},
+	} {
+		adminWS.Send("create_radio_playlist", map[string]any{"name": tc.name, "station_id": stationID})
+		data, err := adminWS.WaitFor("radio_playlist_created", wait)
+		if err != nil {
+			t.Fatalf("no radio_playlist_created: %v", err)
+		}
+		playlistID := jsonStr(parseData(data), "id")
+
+		status, track, err := admin.UploadFile("/api/v1/radio/playlists/"+playlistID+"/tracks", "file", tc.name, tc.data, "application/octet-stream")
+		if err != nil || status != 200 {
+			t.Fatalf("%s: upload: %d %v %v", tc.name, status, track, err)
+		}
+		if got := jsonStr(track, "mime_type"); got != tc.mimeType {
+			t.Errorf("%s: mime_type %q, want %q", tc.name, got, tc.mimeType)
+		}
+		data, err = adminWS.WaitForMatch("radio_playlist_tracks", func(d json.RawMessage) bool {
+			return jsonStr(parseData(d), "playlist_id") == playlistID
+		}, wait)
+		if err != nil {
+			t.Fatalf("%s: no radio_playlist_tracks: %v", tc.name, err)
+		}
+		tracks := jsonArray(parseData(data), "tracks")
+		if len(tracks) != 1 {
+			t.Fatalf("%s: %d tracks, want 1", tc.name, len(tracks))
+		}
+		got, _ := tracks[0].(map[string]any)["duration"].(float64)
+		if got < tc.want-0.1 || got > tc.want+0.1 {
+			t.Errorf("%s: duration %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+// A station's default volume and intro are manager settings broadcast in
+// radio_station_update. The intro plays once ahead of track 0 without
+// taking a track index, and skipping it lands on the first track.
+func TestRadioStationIntroAndVolume(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	adminWS.Send("create_radio_station", map[string]any{"name": uniqueName("intro")})
+	data, err := adminWS.WaitFor("radio_station_create", wait)
+	if err != nil {
+		t.Fatalf("no radio_station_create: %v", err)
+	}
+	station := parseData(data)
+	stationID := jsonStr(station, "id")
+	defer func() {
+		adminWS.Send("delete_radio_station", map[string]any{"station_id": stationID})
+		adminWS.WaitFor("radio_station_delete", wait)
+	}()
+	if station["default_volume"] != 100.0 {
+		t.Errorf("new station default_volume %v, want 100", station["default_volume"])
+	}
+
+	createPlaylist := func(ws *WSClient, name, stationID string) string {
+		t.Helper()
+		ws.Send("create_radio_playlist", map[string]any{"name": name, "station_id": stationID})
+		data, err := ws.WaitForMatch("radio_playlist_created", func(d json.RawMessage) bool {
+			return jsonStr(parseData(d), "name") == name
+		}, wait)
+		if err != nil {
+			t.Fatalf("no radio_playlist_created: %v", err)
+		}
+		return jsonStr(parseData(data), "id")
+	}
+	mainID := createPlaylist(adminWS, uniqueName("main"), stationID)
+	first := uploadRadioTrack(t, adminToken, mainID, "first.mp3")
+	second := uploadRadioTrack(t, adminToken, mainID, "second.mp3")
+	jinglesID := createPlaylist(adminWS, uniqueName("jingles"), "")
+	jingle := uploadRadioTrack(t, adminToken, jinglesID, "jingle.mp3")
+	bobsID := createPlaylist(bobWS, uniqueName("bobs"), "")
+	bobsTrack := uploadRadioTrack(t, bobToken, bobsID, "bobs.mp3")
+	defer func() {
+		adminWS.Send("delete_radio_playlist", map[string]any{"playlist_id": jinglesID})
+		bobWS.Send("delete_radio_playlist", map[string]any{"playlist_id": bobsID})
+	}()
+
+	isStation := func(d json.RawMessage) bool { return jsonStr(parseData(d), "id") == stationID }
+
+	adminWS.Send("set_radio_station_volume", map[string]any{"station_id": stationID, "volume": 150})
+	if data, err := adminWS.WaitFor("error", wait); err != nil {
+		t.Errorf("out-of-range volume accepted: %v", err)
+	} else if jsonStr(parseData(data), "op") != "set_radio_station_volume" {
+		t.Errorf("error op: %v", parseData(data))
+	}
+	adminWS.Send("set_radio_station_volume", map[string]any{"station_id": stationID, "volume": 40})
+	data, err = bobWS.WaitForMatch("radio_station_update", isStation, wait)
+	if err != nil {
+		t.Fatalf("no radio_station_update for volume: %v", err)
+	}
+	if parseData(data)["default_volume"] != 40.0 {
+		t.Errorf("default_volume %v, want 40", parseData(data)["default_volume"])
+	}
+
+	// Someone else's personal playlist isn't the station's to use
+	adminWS.Send("set_radio_station_intro", map[string]any{"station_id": stationID, "track_id": bobsTrack})
+	if data, err := adminWS.WaitFor("error", wait); err != nil {
+		t.Errorf("intro from bob's playlist accepted: %v", err)
+	} else if jsonStr(parseData(data), "code") != "forbidden" {
+		t.Errorf("error: %v", parseData(data))
+	}
+	adminWS.Send("set_radio_station_intro", map[string]any{"station_id": stationID, "track_id": jingle})
+	data, err = bobWS.WaitForMatch("radio_station_update", isStation, wait)
+	if err != nil {
+		t.Fatalf("no radio_station_update for intro: %v", err)
+	}
+	if jsonStr(parseData(data), "intro_track_id") != jingle || parseData(data)["default_volume"] != 40.0 {
+		t.Errorf("update after intro: %v", parseData(data))
+	}
+
+	// Fresh connections see both in ready
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	found := false
+	for _, s := range jsonArray(aliceWS.Ready, "radio_stations") {
+		sm := s.(map[string]any)
+		if jsonStr(sm, "id") == stationID {
+			found = true
+			if sm["default_volume"] != 40.0 || jsonStr(sm, "intro_track_id") != jingle {
+				t.Errorf("ready station: %v", sm)
+			}
+		}
+	}
+	aliceWS.Close()
+	if !found {
+		t.Error("station missing from ready")
+	}
+
+	bobWS.Send("radio_tune", map[string]any{"station_id": stationID})
+	bobWS.WaitFor("radio_listeners", wait)
+
+	playback := func(what string) map[string]any {
+		t.Helper()
+		data, err := bobWS.WaitFor("radio_playback", wait)
+		if err != nil {
+			t.Fatalf("no radio_playback after %s: %v", what, err)
+		}
+		return parseData(data)
+	}
+	adminWS.Send("radio_play", map[string]any{"station_id": stationID, "playlist_id": mainID})
+	pb := playback("play")
+	if !jsonBool(pb, "intro") || pb["track_index"] != -1.0 || jsonStr(jsonMap(pb, "track"), "id") != jingle {
+		t.Fatalf("play should start with the intro: %v", pb)
+	}
+
+	bobWS.Send("radio_track_ended", map[string]any{"station_id": stationID, "track_index": -1})
+	pb = playback("intro ended")
+	if jsonBool(pb, "intro") || pb["track_index"] != 0.0 || jsonStr(jsonMap(pb, "track"), "id") != first {
+		t.Fatalf("after the intro: %v", pb)
+	}
+
+	adminWS.Send("radio_next", map[string]any{"station_id": stationID})
+	pb = playback("next")
+	if pb["track_index"] != 1.0 || jsonStr(jsonMap(pb, "track"), "id") != second {
+		t.Errorf("next after intro: %v", pb)
+	}
+
+	// Skipping the intro goes to the first track, not the second
+	adminWS.Send("radio_play", map[string]any{"station_id": stationID, "playlist_id": mainID})
+	if pb = playback("replay"); !jsonBool(pb, "intro") {
+		t.Fatalf("replay should start with the intro: %v", pb)
+	}
+	adminWS.Send("radio_next", map[string]any{"station_id": stationID})
+	pb = playback("skip intro")
+	if jsonBool(pb, "intro") || pb["track_index"] != 0.0 || jsonStr(jsonMap(pb, "track"), "id") != first {
+		t.Errorf("skipping the intro: %v", pb)
+	}
+
+	// The intro doesn't come back when the playlist loops
+	adminWS.Send("set_radio_station_mode", map[string]any{"station_id": stationID, "mode": "loop_one"})
+	bobWS.WaitForMatch("radio_station_update", isStation, wait)
+	adminWS.Send("radio_next", map[string]any{"station_id": stationID})
+	playback("next")
+	adminWS.Send("radio_next", map[string]any{"station_id": stationID})
+	pb = playback("loop")
+	if jsonBool(pb, "intro") || pb["track_index"] != 0.0 {
+		t.Errorf("loop should restart at track 0 without the intro: %v", pb)
+	}
+}
@@ -0,0 +1,391 @@
+package validation
+
+import (
+	"encoding/json"
+	"net/url"
+	"testing"
+)
+
+// Reactions must be a single real emoji. Multi-codepoint sequences (ZWJ,
+// skin tones, flags, keycaps) are accepted; plain text is answered with
+// reaction_denied.
+func TestReactionEmojiValidation(t *testing.T) {
+	ensureAdmin(t)
+
+	ws, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer ws.Close()
+
+	channelID := findTextChannel(ws.Ready)
+	ws.Send("send_message", map[string]any{
+		"channel_id": channelID,
+		"content":    "Emoji validation target",
+	})
+	data, err := ws.WaitFor("message_create", wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msgID := jsonStr(parseData(data), "id")
+
+	cases := []struct {
+		name  string
+		emoji string
+		valid bool
+	}{
+		{"single", "\U0001F44D", true},
+		{"skin tone", "\U0001F44D\U0001F3FD", true},
+		{"variation selector", "\u2764\uFE0F", true},
+		{"zwj family", "\U0001F468\u200D\U0001F469\u200D\U0001F467\u200D\U0001F466", true},
+		{"zwj with skin tones", "\U0001F9D1\U0001F3FB\u200D\u2764\uFE0F\u200D\U0001F48B\u200D\U0001F9D1\U0001F3FC", true},
+		{"flag", "\U0001F1EB\U0001F1F7", true},
+		{"subdivision flag", "\U0001F3F4\U000E0067\U000E0062\U000E0065\U000E006E\U000E0067\U000E007F", true},
+		{"keycap", "1\uFE0F\u20E3", true},
+		{"ascii", "ab", false},
+		{"single letter", "a", false},
+		{"digit without keycap", "1", false},
+		{"emoji plus text", "\U0001F44Da", false},
+		{"lone regional indicator", "\U0001F1EB", false},
+		{"lone skin tone", "\U0001F3FD", false},
+		{"trailing zwj", "\U0001F44D\u200D", false},
+		{"two emoji", "\U0001F44D\U0001F44D", false},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ws.Send("add_reaction", map[string]any{
+				"message_id": msgID,
+				"emoji":      tc.emoji,
+			})
+			matchEmoji := func(raw json.RawMessage) bool {
+				return jsonStr(parseData(raw), "emoji") == tc.emoji
+			}
+			if tc.valid {
+				if _, err := ws.WaitForMatch("reaction_add", matchEmoji, wait); err != nil {
+					t.Fatalf("expected %q to be accepted: %v", tc.emoji, err)
+				}
+				// Remove again so the per-user reaction cap isn't reached
+				ws.Send("remove_reaction", map[string]any{
+					"message_id": msgID,
+					"emoji":      tc.emoji,
+				})
+				ws.WaitForMatch("reaction_remove", matchEmoji, wait)
+				return
+			}
+			if _, err := ws.WaitForMatch("reaction_denied", matchEmoji, wait); err != nil {
+				t.Fatalf("expected %q to be denied: %v", tc.emoji, err)
+			}
+		})
+	}
+}
+
+// Re-adding a reaction is confirmed to the sender alone, and the
+// per-user and distinct-emoji caps answer reaction_denied.
+func TestReactionLimitsAndDuplicates(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+
+	channelID := findTextChannel(aliceWS.Ready)
+	aliceWS.Send("send_message", map[string]any{
+		"channel_id": channelID,
+		"content":    "Reaction limits target",
+	})
+	data, err := aliceWS.WaitForMatch("message_create", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "content") == "Reaction limits target"
+	}, wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msgID := jsonStr(parseData(data), "id")
+
+	// Distinct single-codepoint emoji, U+1F600 onwards
+	emoji := func(i int) string { return string(rune(0x1F600 + i)) }
+	react := func(ws *WSClient, e string) {
+		ws.Send("add_reaction", map[string]any{"message_id": msgID, "emoji": e})
+	}
+	match := func(e string) func(json.RawMessage) bool {
+		return func(raw json.RawMessage) bool {
+			m := parseData(raw)
+			return jsonStr(m, "message_id") == msgID && jsonStr(m, "emoji") == e
+		}
+	}
+
+	react(aliceWS, emoji(0))
+	if _, err := bobWS.WaitForMatch("reaction_add", match(emoji(0)), wait); err != nil {
+		t.Fatalf("bob should see the first reaction: %v", err)
+	}
+	aliceWS.WaitForMatch("reaction_add", match(emoji(0)), wait)
+
+	react(aliceWS, emoji(0))
+	if _, err := aliceWS.WaitForMatch("reaction_add", match(emoji(0)), wait); err != nil {
+		t.Fatalf("duplicate should be acked to the sender: %v", err)
+	}
+	if _, err := bobWS.WaitForMatch("reaction_add", match(emoji(0)), shortNoEvent); err == nil {
+		t.Error("duplicate reaction should not be broadcast")
+	}
+
+	// Per user: 10 reactions each
+	for i := 1; i < 10; i++ {
+		react(aliceWS, emoji(i))
+		if _, err := aliceWS.WaitForMatch("reaction_add", match(emoji(i)), wait); err != nil {
+			t.Fatalf("alice reaction %d: %v", i, err)
+		}
+	}
+	react(aliceWS, emoji(10))
+	if _, err := aliceWS.WaitForMatch("reaction_denied", match(emoji(10)), wait); err != nil {
+		t.Fatalf("alice's 11th reaction should be denied: %v", err)
+	}
+
+	// Distinct emoji: 20 per message
+	for i := 10; i < 20; i++ {
+		react(bobWS, emoji(i))
+		if _, err := bobWS.WaitForMatch("reaction_add", match(emoji(i)), wait); err != nil {
+			t.Fatalf("bob reaction %d: %v", i, err)
+		}
+	}
+	react(adminWS, emoji(20))
+	if _, err := adminWS.WaitForMatch("reaction_denied", match(emoji(20)), wait); err != nil {
+		t.Fatalf("a 21st distinct emoji should be denied: %v", err)
+	}
+	react(adminWS, emoji(0))
+	if _, err := adminWS.WaitForMatch("reaction_add", match(emoji(0)), wait); err != nil {
+		t.Fatalf("joining an existing emoji should still work: %v", err)
+	}
+}
+
+// Changes to one emoji that follow a broadcast reaction closely are
+// merged into a single reaction_update for other users, while each
+// reacting user still gets their own change confirmed right away.
+func TestReactionBurst(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+
+	channelID := findTextChannel(aliceWS.Ready)
+	content := uniqueName("burst")
+	aliceWS.Send("send_message", map[string]any{"channel_id": channelID, "content": content})
+	data, err := aliceWS.WaitForMatch("message_create", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "content") == content
+	}, wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msgID := jsonStr(parseData(data), "id")
+
+	const emoji = "\U0001F389"
+	react := func(ws *WSClient, op string) {
+		ws.Send(op, map[string]any{"message_id": msgID, "emoji": emoji})
+	}
+	match := func(raw json.RawMessage) bool {
+		m := parseData(raw)
+		return jsonStr(m, "message_id") == msgID && jsonStr(m, "emoji") == emoji
+	}
+
+	react(aliceWS, "add_reaction")
+	if _, err := bobWS.WaitForMatch("reaction_add", match, wait); err != nil {
+		t.Fatalf("the first reaction should be broadcast at once: %v", err)
+	}
+
+	// Alice flips hers off and on again and admin joins, all inside the
+	// window opened by the first reaction
+	react(aliceWS, "remove_reaction")
+	react(aliceWS, "add_reaction")
+	react(adminWS, "add_reaction")
+	if _, err := adminWS.WaitForMatch("reaction_add", match, wait); err != nil {
+		t.Fatalf("admin's own reaction should be confirmed: %v", err)
+	}
+
+	data, err = bobWS.WaitForMatch("reaction_update", match, wait)
+	if err != nil {
+		t.Fatalf("no reaction_update: %v", err)
+	}
+	update := parseData(data)
+	if n, _ := update["count"].(float64); n != 2 {
+		t.Errorf("expected count 2, got %v", update["count"])
+	}
+	added := jsonArray(update, "added_by")
+	if len(added) != 1 || added[0] != adminID {
+		t.Errorf("expected added_by [admin], got %v", added)
+	}
+	if removed := jsonArray(update, "removed_by"); len(removed) != 0 {
+		t.Errorf("alice's flip should cancel out, got removed_by %v", removed)
+	}
+	if _, err := bobWS.WaitForMatch("reaction_remove", match, shortNoEvent); err == nil {
+		t.Error("changes inside the window should not be broadcast individually")
+	}
+}
+
+// With allowed_reactions set, add_reaction only takes those emoji (ignoring
+// U+FE0F) and answers others with reaction_not_allowed.
+func TestAllowedReactions(t *testing.T) {
+	ensureUsers(t)
+
+	admin := NewHTTPClient()
+	admin.Token = adminToken
+	setAllowed := func(emoji []string) (int, map[string]any) {
+		t.Helper()
+		status, body, err := admin.PostJSON("/api/v1/admin/settings", map[string]any{"allowed_reactions": emoji})
+		if err != nil {
+			t.Fatalf("set allowed_reactions: %v", err)
+		}
+		return status, body
+	}
+	if status, _ := setAllowed([]string{"\U0001F44D", "ab"}); status != 400 {
+		t.Errorf("non-emoji entry: status %d, want 400", status)
+	}
+	if status, body := setAllowed([]string{"\U0001F44D", "❤️", "\U0001F44D"}); status != 200 {
+		t.Fatalf("set allowed_reactions: %d %v", status, body)
+	}
+	defer setAllowed([]string{})
+
+	_, settings, _ := admin.GetJSON("/api/v1/admin/settings")
+	if got := jsonArray(settings, "allowed_reactions"); len(got) != 2 {
+		t.Errorf("admin settings allowed_reactions %v, want the 2 distinct emoji", got)
+	}
+	_, cfg, _ := NewHTTPClient().GetJSON("/api/v1/config")
+	if got := jsonArray(cfg, "allowed_reactions"); len(got) != 2 {
+		t.Errorf("config allowed_reactions %v, want 2", got)
+	}
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+	aliceWS.Send("send_message", map[string]any{"channel_id": channelID, "content": "allowlist target"})
+	data, err := aliceWS.WaitFor("message_create", wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msgID := jsonStr(parseData(data), "id")
+
+	aliceWS.Send("add_reaction", map[string]any{"message_id": msgID, "emoji": "\U0001F525"})
+	if e := waitForOpError(t, aliceWS, "add_reaction"); jsonStr(e, "code") != "reaction_not_allowed" {
+		t.Errorf("disallowed emoji: code %q, want reaction_not_allowed", jsonStr(e, "code"))
+	}
+
+	// Listed as "❤️", sent without the selector
+	aliceWS.Send("add_reaction", map[string]any{"message_id": msgID, "emoji": "❤"})
+	if _, err := aliceWS.WaitForMatch("reaction_add", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "message_id") == msgID
+	}, wait); err != nil {
+		t.Fatalf("allowed emoji not added: %v", err)
+	}
+}
+
+// GET /api/v1/messages/{id}/reactions/{emoji} lists who reacted, in pages
+// chained through next, and is limited to channel members.
+func TestReactionUsers(t *testing.T) {
+	ensureUsers(t)
+
+	var conns []*WSClient
+	for _, token := range []string{adminToken, aliceToken, bobToken} {
+		ws, err := ConnectWS(token)
+		if err != nil {
+			t.Fatalf("ws: %v", err)
+		}
+		defer ws.Close()
+		conns = append(conns, ws)
+	}
+
+	channelID := findTextChannel(conns[0].Ready)
+	content := uniqueName("reactors")
+	conns[0].Send("send_message", map[string]any{"channel_id": channelID, "content": content})
+	data, err := conns[0].WaitForMatch("message_create", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "content") == content
+	}, wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msgID := jsonStr(parseData(data), "id")
+
+	const emoji = "\U0001F44D"
+	for i, ws := range conns {
+		userID := []string{adminID, aliceID, bobID}[i]
+		ws.Send("add_reaction", map[string]any{"message_id": msgID, "emoji": emoji})
+		if _, err := ws.WaitForMatch("reaction_add", func(raw json.RawMessage) bool {
+			m := parseData(raw)
+			return jsonStr(m, "message_id") == msgID && jsonStr(m, "user_id") == userID
+		}, wait); err != nil {
+			t.Fatalf("reaction not confirmed: %v", err)
+		}
+	}
+
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+	path := "/api/v1/messages/" + msgID + "/reactions/" + url.PathEscape(emoji)
+	status, page, err := alice.GetJSON(path + "?limit=2")
+	if err != nil || status != 200 {
+		t.Fatalf("first page: %d %v %v", status, page, err)
+	}
+	if n, _ := page["count"].(float64); n != 3 {
+		t.Errorf("count %v, want 3", page["count"])
+	}
+	seen := map[string]bool{}
+	for _, u := range jsonArray(page, "users") {
+		m, _ := u.(map[string]any)
+		if jsonStr(m, "username") == "" {
+			t.Errorf("user without username: %v", m)
+		}
+		seen[jsonStr(m, "id")] = true
+	}
+	next := jsonStr(page, "next")
+	if len(seen) != 2 || next == "" {
+		t.Fatalf("first page: want 2 users and a next cursor, got %v", page)
+	}
+
+	status, page, err = alice.GetJSON(path + "?limit=2&after=" + next)
+	if err != nil || status != 200 {
+		t.Fatalf("second page: %d %v %v", status, page, err)
+	}
+	for _, u := range jsonArray(page, "users") {
+		m, _ := u.(map[string]any)
+		seen[jsonStr(m, "id")] = true
+	}
+	if page["next"] != nil {
+		t.Errorf("last page should have no next, got %v", page["next"])
+	}
+	for _, id := range []string{adminID, aliceID, bobID} {
+		if !seen[id] {
+			t.Errorf("%s missing from reactors %v", id, seen)
+		}
+	}
+
+	if status, _, _ := alice.GetJSON("/api/v1/messages/" + msgID + "/reactions/" + url.PathEscape("\U0001F389")); status != 200 {
+		t.Errorf("emoji nobody used: status %d, want 200", status)
+	}
+	if status, _, _ := alice.GetJSON("/api/v1/messages/nope/reactions/" + url.PathEscape(emoji)); status != 404 {
+		t.Errorf("unknown message: status %d, want 404", status)
+	}
+}
@@ -0,0 +1,81 @@
+package validation
+
+import "testing"
+
+// GET /messages/{id}/context walks reply_to_id up to depth ancestors and
+// stops after a deleted parent.
+func TestReplyChain(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+
+	// a ← b ← c ← d
+	var ids []string
+	for i, content := range []string{"chain a", "chain b", "chain c", "chain d"} {
+		d := map[string]any{"channel_id": channelID, "content": content}
+		if i > 0 {
+			d["reply_to_id"] = ids[i-1]
+		}
+		aliceWS.Send("send_message", d)
+		data, err := aliceWS.WaitFor("message_create", wait)
+		if err != nil {
+			t.Fatalf("no message_create for %q: %v", content, err)
+		}
+		ids = append(ids, jsonStr(parseData(data), "id"))
+	}
+
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+	chainIDs := func(depth string) ([]string, bool, []any) {
+		t.Helper()
+		status, body, err := alice.GetJSON("/api/v1/messages/" + ids[3] + "/context?depth=" + depth)
+		if err != nil || status != 200 {
+			t.Fatalf("context depth=%s: %d %v %v", depth, status, body, err)
+		}
+		chain := jsonArray(body, "chain")
+		var out []string
+		for _, c := range chain {
+			out = append(out, jsonStr(c.(map[string]any), "id"))
+		}
+		return out, jsonBool(body, "complete"), chain
+	}
+
+	got, complete, _ := chainIDs("2")
+	if len(got) != 2 || got[0] != ids[2] || got[1] != ids[1] || complete {
+		t.Errorf("depth 2: got %v complete=%v, want [c b] incomplete", got, complete)
+	}
+	got, complete, chain := chainIDs("10")
+	if len(got) != 3 || got[2] != ids[0] || !complete {
+		t.Errorf("depth 10: got %v complete=%v, want [c b a] complete", got, complete)
+	}
+	if len(chain) > 0 && jsonStr(chain[0].(map[string]any), "content") != "chain c" {
+		t.Errorf("nearest ancestor content: %v", chain[0])
+	}
+
+	aliceWS.Send("delete_message", map[string]any{"message_id": ids[1]})
+	if _, err := aliceWS.WaitFor("message_delete", wait); err != nil {
+		t.Fatalf("no message_delete: %v", err)
+	}
+	got, complete, chain = chainIDs("10")
+	if len(got) != 2 || got[1] != ids[1] || complete {
+		t.Errorf("after deleting b: got %v complete=%v, want [c b] incomplete", got, complete)
+	}
+	if len(chain) == 2 {
+		b := chain[1].(map[string]any)
+		if !jsonBool(b, "deleted") || b["content"] != nil {
+			t.Errorf("deleted parent should be marked and empty: %v", b)
+		}
+	}
+
+	if status, _, _ := alice.GetJSON("/api/v1/messages/" + ids[3] + "/context?depth=0"); status != 400 {
+		t.Errorf("depth=0: expected 400, got %d", status)
+	}
+	if status, _, _ := alice.GetJSON("/api/v1/messages/00000000-0000-0000-0000-00000000beef/context"); status != 404 {
+		t.Errorf("unknown message: expected 404, got %d", status)
+	}
+}
@@ -0,0 +1,91 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// A reply whose target was deleted carries the same reply_to block live
+// and in history: the target's id and author, deleted true, content null.
+func TestReplyToDeletedInHistory(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+
+	send := func(content string, replyTo string) map[string]any {
+		t.Helper()
+		d := map[string]any{"channel_id": channelID, "content": content}
+		if replyTo != "" {
+			d["reply_to_id"] = replyTo
+		}
+		aliceWS.Send("send_message", d)
+		data, err := aliceWS.WaitForMatch("message_create", func(raw json.RawMessage) bool {
+			return jsonStr(parseData(raw), "content") == content
+		}, wait)
+		if err != nil {
+			t.Fatalf("no message_create for %q: %v", content, err)
+		}
+		return parseData(data)
+	}
+
+	target := send(uniqueName("reply_target"), "")
+	targetID := jsonStr(target, "id")
+	early := send(uniqueName("early_reply"), targetID)
+	if rt := jsonMap(early, "reply_to"); jsonBool(rt, "deleted") || jsonStr(rt, "content") == "" {
+		t.Fatalf("live reply to a live target: %v", rt)
+	}
+
+	aliceWS.Send("delete_message", map[string]any{"message_id": targetID})
+	if _, err := aliceWS.WaitFor("message_delete", wait); err != nil {
+		t.Fatalf("no message_delete: %v", err)
+	}
+	late := send(uniqueName("late_reply"), targetID)
+
+	checkDeleted := func(where string, rt map[string]any) {
+		t.Helper()
+		if rt == nil {
+			t.Fatalf("%s: no reply_to", where)
+		}
+		if jsonStr(rt, "id") != targetID {
+			t.Errorf("%s: reply_to.id = %q, want %q", where, jsonStr(rt, "id"), targetID)
+		}
+		if !jsonBool(rt, "deleted") {
+			t.Errorf("%s: reply_to.deleted should be true: %v", where, rt)
+		}
+		if content, present := rt["content"]; !present || content != nil {
+			t.Errorf("%s: reply_to.content should be null: %v", where, rt)
+		}
+		if jsonStr(jsonMap(rt, "author"), "id") != aliceID {
+			t.Errorf("%s: reply_to.author should still be the target's author: %v", where, rt)
+		}
+	}
+	checkDeleted("live", jsonMap(late, "reply_to"))
+
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+	// Replies from the main feed join the target's thread
+	status, history, err := alice.GetJSONArray("/api/v1/channels/" + channelID + "/threads/" + targetID + "/messages")
+	if err != nil || status != 200 {
+		t.Fatalf("history: %d %v", status, err)
+	}
+	found := 0
+	for _, item := range history {
+		m, _ := item.(map[string]any)
+		switch jsonStr(m, "id") {
+		case jsonStr(early, "id"):
+			checkDeleted("history (replied before delete)", jsonMap(m, "reply_to"))
+			found++
+		case jsonStr(late, "id"):
+			checkDeleted("history (replied after delete)", jsonMap(m, "reply_to"))
+			found++
+		}
+	}
+	if found != 2 {
+		t.Errorf("expected both replies in thread history, found %d", found)
+	}
+}
@@ -0,0 +1,84 @@
+package validation
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+// Replacing or clearing the server icon pushes server_update and deletes
+// the old file, unless an attachment shares it.
+func TestServerIconReplace(t *testing.T) {
+	ensureAdmin(t)
+	ensureUsers(t)
+
+	admin := NewHTTPClient()
+	admin.Token = adminToken
+	admin.FakeIP = "10.99.97.1" // its own upload rate-limit bucket
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	fileStatus := func(url string) int {
+		t.Helper()
+		resp, err := http.Get(serverURL + url)
+		if err != nil {
+			t.Fatalf("get %s: %v", url, err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+	setIcon := func(data []byte) string {
+		t.Helper()
+		status, body, err := admin.UploadFile("/api/v1/admin/server-icon", "file", "icon.png", data, "image/png")
+		if err != nil || status != 200 {
+			t.Fatalf("set icon: %d %v %v", status, body, err)
+		}
+		iconURL := jsonStr(body, "icon_url")
+		if _, err := aliceWS.WaitForMatch("server_update", func(raw json.RawMessage) bool {
+			return jsonStr(parseData(raw), "icon_url") == iconURL
+		}, wait); err != nil {
+			t.Fatalf("no server_update for %s: %v", iconURL, err)
+		}
+		return iconURL
+	}
+
+	first := setIcon(uniquePNG())
+	if fileStatus(first) != 200 {
+		t.Fatalf("new icon not served")
+	}
+	second := setIcon(uniquePNG())
+	if got := fileStatus(first); got != 404 {
+		t.Errorf("replaced icon: status %d, want 404", got)
+	}
+
+	// An attachment with the same bytes as the icon keeps the file alive
+	shared := uniquePNG()
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+	alice.FakeIP = "10.99.97.2"
+	if status, _, err := alice.UploadFile("/api/v1/upload", "file", "same.png", shared, "image/png"); err != nil || status != 200 {
+		t.Fatalf("upload: %d %v", status, err)
+	}
+	sharedIcon := setIcon(shared)
+	if got := fileStatus(second); got != 404 {
+		t.Errorf("replaced icon: status %d, want 404", got)
+	}
+
+	// Three uploads used up the admin's bucket
+	admin.FakeIP = "10.99.97.3"
+	status, _, err := admin.DeleteJSON("/api/v1/admin/server-icon")
+	if err != nil || status != 200 {
+		t.Fatalf("clear icon: %d %v", status, err)
+	}
+	if _, err := aliceWS.WaitForMatch("server_update", func(raw json.RawMessage) bool {
+		return parseData(raw)["icon_url"] == nil
+	}, wait); err != nil {
+		t.Errorf("no server_update for the cleared icon: %v", err)
+	}
+	if got := fileStatus(sharedIcon); got != 200 {
+		t.Errorf("cleared icon shared with an attachment: status %d, want 200", got)
+	}
+}
@@ -0,0 +1,47 @@
+package validation
+
+import (
+	"testing"
+	"time"
+)
+
+// Login issues a 24-hour token when remember is false and a 30-day token
+// otherwise, and reports the expiry it chose.
+func TestLoginRememberControlsTokenExpiry(t *testing.T) {
+	ensureUsers(t)
+
+	cases := []struct {
+		name     string
+		remember any
+		want     time.Duration
+	}{
+		{"omitted", nil, 30 * 24 * time.Hour},
+		{"remember", true, 30 * 24 * time.Hour},
+		{"session", false, 24 * time.Hour},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := map[string]any{"username": aliceName, "password": alicePass}
+			if tc.remember != nil {
+				req["remember"] = tc.remember
+			}
+			status, body, err := NewHTTPClient().PostJSON("/api/v1/auth/login", req)
+			if err != nil || status != 200 {
+				t.Fatalf("login: status=%d err=%v body=%v", status, err, body)
+			}
+			expiresAt, err := time.Parse(time.RFC3339, jsonStr(body, "expires_at"))
+			if err != nil {
+				t.Fatalf("expires_at %q: %v", jsonStr(body, "expires_at"), err)
+			}
+			if d := time.Until(expiresAt) - tc.want; d > time.Minute || d < -time.Minute {
+				t.Errorf("expires in %v, want about %v", time.Until(expiresAt), tc.want)
+			}
+
+			ws, err := ConnectWS(jsonStr(body, "token"))
+			if err != nil {
+				t.Fatalf("token should authenticate: %v", err)
+			}
+			ws.Close()
+		})
+	}
+}
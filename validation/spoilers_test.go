@@ -0,0 +1,134 @@
+package validation
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"testing"
+)
+
+// uploadSpoiler uploads pngData with the spoiler form field set.
+func uploadSpoiler(t *testing.T, c *HTTPClient) map[string]any {
+	t.Helper()
+	body := &bytes.Buffer{}
+	mw := multipart.NewWriter(body)
+	mw.WriteField("spoiler", "true")
+	fw, _ := mw.CreateFormFile("file", "spoiler.png")
+	fw.Write(pngData)
+	mw.Close()
+
+	req, _ := http.NewRequest("POST", serverURL+"/api/v1/upload", body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.Header.Set("Authorization", "Bearer "+c.Token)
+	req.Header.Set("X-Real-IP", c.FakeIP)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		t.Fatalf("upload: %v", err)
+	}
+	defer resp.Body.Close()
+	var result map[string]any
+	json.NewDecoder(resp.Body).Decode(&result)
+	if resp.StatusCode != 200 {
+		t.Fatalf("upload: expected 200, got %d: %v", resp.StatusCode, result)
+	}
+	return result
+}
+
+// Attachments can be flagged as spoilers at upload or send time, and
+// ||text|| comes back as a spoiler entity.
+func TestSpoilers(t *testing.T) {
+	ensureUsers(t)
+
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+
+	uploaded := uploadSpoiler(t, alice)
+	if !jsonBool(uploaded, "spoiler") {
+		t.Errorf("upload with spoiler=true should echo spoiler: %v", uploaded)
+	}
+	status, plain, err := alice.UploadFile("/api/v1/upload", "file", "plain.png", pngData, "image/png")
+	if err != nil || status != 200 {
+		t.Fatalf("plain upload: %d %v", status, err)
+	}
+	status, marked, err := alice.UploadFile("/api/v1/upload", "file", "marked.png", pngData, "image/png")
+	if err != nil || status != 200 {
+		t.Fatalf("second upload: %d %v", status, err)
+	}
+	if jsonBool(plain, "spoiler") {
+		t.Error("plain upload should not be a spoiler")
+	}
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	channelID := findTextChannel(aliceWS.Ready)
+
+	content := "the ending: ||https://example.com/twist|| and `||not this||`"
+	aliceWS.Send("send_message", map[string]any{
+		"channel_id":             channelID,
+		"content":                content,
+		"attachment_ids":         []string{jsonStr(uploaded, "id"), jsonStr(plain, "id"), jsonStr(marked, "id")},
+		"spoiler_attachment_ids": []string{jsonStr(marked, "id")},
+	})
+	data, err := aliceWS.WaitFor("message_create", wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	msg := parseData(data)
+
+	want := map[string]bool{
+		jsonStr(uploaded, "id"): true,
+		jsonStr(plain, "id"):    false,
+		jsonStr(marked, "id"):   true,
+	}
+	checkAttachments := func(where string, atts []any) {
+		if len(atts) != 3 {
+			t.Fatalf("%s: expected 3 attachments, got %v", where, atts)
+		}
+		for _, a := range atts {
+			att, _ := a.(map[string]any)
+			if got := jsonBool(att, "spoiler"); got != want[jsonStr(att, "id")] {
+				t.Errorf("%s: attachment %s spoiler = %v", where, jsonStr(att, "id"), got)
+			}
+		}
+	}
+	checkAttachments("message_create", jsonArray(msg, "attachments"))
+
+	span := func(e map[string]any) string {
+		start, _ := e["start"].(float64)
+		end, _ := e["end"].(float64)
+		return content[int(start):int(end)]
+	}
+	var spoilers, urls []string
+	for _, item := range jsonArray(msg, "entities") {
+		e, _ := item.(map[string]any)
+		switch jsonStr(e, "type") {
+		case "spoiler":
+			spoilers = append(spoilers, span(e))
+		case "url":
+			urls = append(urls, span(e))
+		}
+	}
+	if len(spoilers) != 1 || spoilers[0] != "||https://example.com/twist||" {
+		t.Errorf("expected one spoiler outside code, got %q", spoilers)
+	}
+	if len(urls) != 1 || urls[0] != "https://example.com/twist" {
+		t.Errorf("url inside spoiler should stop at the bars, got %q", urls)
+	}
+
+	status, history, err := alice.GetJSONArray("/api/v1/channels/" + channelID + "/messages?limit=5")
+	if err != nil || status != 200 {
+		t.Fatalf("history: %d %v", status, err)
+	}
+	for _, item := range history {
+		m, _ := item.(map[string]any)
+		if jsonStr(m, "id") == jsonStr(msg, "id") {
+			checkAttachments("history", jsonArray(m, "attachments"))
+			return
+		}
+	}
+	t.Error("message missing from history")
+}
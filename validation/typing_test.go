@@ -0,0 +1,85 @@
+package validation
+
+import (
+	"testing"
+	"time"
+)
+
+// Once a connection reports which channel it is viewing, it only gets
+// typing_start for that channel.
+func TestTypingScopedToViewers(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	channelID := findTextChannel(aliceWS.Ready)
+
+	// Bob is looking somewhere else
+	bobWS.Send("view_channel", map[string]any{"channel_id": "elsewhere"})
+	time.Sleep(200 * time.Millisecond)
+
+	aliceWS.Send("typing_start", map[string]any{"channel_id": channelID})
+	if _, err := bobWS.WaitFor("typing_start", 500*time.Millisecond); err == nil {
+		t.Fatal("bob should not get typing_start for a channel bob is not viewing")
+	}
+
+	// Bob switches to the channel
+	bobWS.Send("view_channel", map[string]any{"channel_id": channelID})
+	time.Sleep(200 * time.Millisecond)
+
+	aliceWS.Send("typing_start", map[string]any{"channel_id": channelID})
+	data, err := bobWS.WaitFor("typing_start", wait)
+	if err != nil {
+		t.Fatalf("bob got no typing_start while viewing: %v", err)
+	}
+	if jsonStr(parseData(data), "user_id") != aliceID {
+		t.Error("typing user_id should be alice")
+	}
+}
+
+// A connection in a voice call gets typing_start for the call's chat even
+// while it views another channel.
+func TestTypingReachesVoiceCall(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	voiceID := findVoiceChannel(aliceWS.Ready)
+	textID := findTextChannel(aliceWS.Ready)
+
+	bobWS := joinVoiceFor(t, bobToken, voiceID)
+	defer bobWS.Close()
+	bobWS.Send("view_channel", map[string]any{"channel_id": textID})
+	time.Sleep(200 * time.Millisecond)
+
+	aliceWS.Send("typing_start", map[string]any{"channel_id": voiceID})
+	data, err := bobWS.WaitFor("typing_start", wait)
+	if err != nil {
+		t.Fatalf("bob in the call got no typing_start for its chat: %v", err)
+	}
+	if jsonStr(parseData(data), "channel_id") != voiceID {
+		t.Errorf("typing channel_id: %v, want %s", parseData(data), voiceID)
+	}
+
+	bobWS.Send("leave_voice", map[string]any{})
+	if _, err := bobWS.WaitFor("voice_state_update", wait); err != nil {
+		t.Fatalf("no voice_state_update on leave: %v", err)
+	}
+	aliceWS.Send("typing_start", map[string]any{"channel_id": voiceID})
+	if _, err := bobWS.WaitFor("typing_start", 500*time.Millisecond); err == nil {
+		t.Error("bob got the call's typing_start after leaving it")
+	}
+}
@@ -0,0 +1,53 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Changing a user's admin flag broadcasts user_update and drops their live
+// connection, so the reconnect carries the new permissions.
+func TestSetAdminRefreshesLiveClient(t *testing.T) {
+	ensureUsers(t)
+
+	admin := NewHTTPClient()
+	admin.Token = adminToken
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	setAdmin := func(isAdmin bool) {
+		t.Helper()
+		if status, _, err := admin.PostJSON("/api/v1/admin/users/"+bobID+"/admin", map[string]any{"is_admin": isAdmin}); err != nil || status != 200 {
+			t.Fatalf("set admin %v: %d %v", isAdmin, status, err)
+		}
+	}
+	setAdmin(true)
+	defer setAdmin(false)
+
+	if _, err := adminWS.WaitForMatch("user_update", func(raw json.RawMessage) bool {
+		u := jsonMap(parseData(raw), "user")
+		return jsonStr(u, "id") == bobID && jsonBool(u, "is_admin")
+	}, wait); err != nil {
+		t.Fatalf("no user_update with bob as admin: %v", err)
+	}
+	if err := bobWS.WaitClosed(wait); err != nil {
+		t.Fatalf("bob's stale connection wasn't closed: %v", err)
+	}
+
+	bobWS2, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob reconnect: %v", err)
+	}
+	defer bobWS2.Close()
+	if !jsonBool(jsonMap(bobWS2.Ready, "user"), "is_admin") {
+		t.Error("ready after reconnect doesn't show bob as admin")
+	}
+}
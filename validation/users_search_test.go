@@ -0,0 +1,69 @@
+package validation
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// User search matches a case-insensitive username prefix and lists online
+// users first.
+func TestUserSearch(t *testing.T) {
+	ensureUsers(t)
+
+	prefix := uniqueName("Srch")
+	newMember := func(name string) string {
+		t.Helper()
+		if status, body, err := NewHTTPClient().Register(name, "pass"); err != nil || status != 202 {
+			t.Fatalf("register %s: %d %v %v", name, status, err, body)
+		}
+		approveUserByName(t, adminToken, name)
+		status, body, err := NewHTTPClient().Login(name, "pass")
+		if err != nil || status != 200 {
+			t.Fatalf("login %s: %d %v", name, status, err)
+		}
+		return jsonStr(body, "token")
+	}
+	newMember(prefix + "_a")
+	onlineToken := newMember(prefix + "_b")
+	ws, err := ConnectWS(onlineToken)
+	if err != nil {
+		t.Fatalf("ws: %v", err)
+	}
+	defer ws.Close()
+
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+	search := func(q string) []string {
+		t.Helper()
+		status, list, err := alice.GetJSONArray("/api/v1/users/search?q=" + url.QueryEscape(q))
+		if err != nil || status != 200 {
+			t.Fatalf("search %q: %d %v", q, status, err)
+		}
+		var names []string
+		for _, u := range list {
+			names = append(names, jsonStr(u.(map[string]any), "username"))
+		}
+		return names
+	}
+
+	got := search(strings.ToLower(prefix))
+	if len(got) != 2 || got[0] != prefix+"_b" || got[1] != prefix+"_a" {
+		t.Errorf("expected online %s_b before %s_a, got %v", prefix, prefix, got)
+	}
+	if got := search(prefix + "_a"); len(got) != 1 {
+		t.Errorf("exact prefix should match one user, got %v", got)
+	}
+	if got := search("%" + prefix); len(got) != 0 {
+		t.Errorf("LIKE wildcards should be literal, got %v", got)
+	}
+
+	resp, err := NewHTTPClient().do("GET", "/api/v1/users/search?q=a", nil)
+	if err != nil {
+		t.Fatalf("anonymous search: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 401 {
+		t.Errorf("anonymous search: expected 401, got %d", resp.StatusCode)
+	}
+}
@@ -0,0 +1,27 @@
+package validation
+
+import "testing"
+
+// ready carries the server's voice Opus settings so clients can cap
+// their encoder to match.
+func TestReadyIncludesVoiceAudio(t *testing.T) {
+	ensureUsers(t)
+
+	ws, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer ws.Close()
+
+	audio := jsonMap(ws.Ready, "voice_audio")
+	if audio == nil {
+		t.Fatal("ready has no voice_audio")
+	}
+	bitrate, _ := audio["bitrate"].(float64)
+	if bitrate < 6000 || bitrate > 510000 {
+		t.Errorf("voice_audio bitrate %v outside Opus range", audio["bitrate"])
+	}
+	if _, ok := audio["fec"].(bool); !ok {
+		t.Errorf("voice_audio fec missing: %v", audio)
+	}
+}
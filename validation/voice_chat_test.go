@@ -0,0 +1,72 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Voice channels carry an in-call text chat: messages are delivered live
+// and the recent tail is included in ready for late joiners.
+func TestVoiceChannelTextChat(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	voiceID := findVoiceChannel(aliceWS.Ready)
+	if voiceID == "" {
+		t.Fatal("no voice channel in ready")
+	}
+
+	send := func(content string) string {
+		t.Helper()
+		aliceWS.Send("send_message", map[string]any{
+			"channel_id": voiceID,
+			"content":    content,
+		})
+		data, err := aliceWS.WaitForMatch("message_create", func(d json.RawMessage) bool {
+			return jsonStr(parseData(d), "content") == content
+		}, wait)
+		if err != nil {
+			t.Fatalf("no message_create for voice chat: %v", err)
+		}
+		return jsonStr(parseData(data), "id")
+	}
+
+	content := uniqueName("in-call link https://example.com")
+	firstID := send(content)
+	secondID := send(uniqueName("in-call follow-up"))
+	deletedID := send(uniqueName("in-call deleted"))
+	aliceWS.Send("delete_message", map[string]any{"message_id": deletedID})
+	if _, err := aliceWS.WaitFor("message_delete", wait); err != nil {
+		t.Fatalf("no message_delete: %v", err)
+	}
+
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	firstAt, secondAt := -1, -1
+	for i, item := range jsonArray(jsonMap(bobWS.Ready, "voice_chat"), voiceID) {
+		m := item.(map[string]any)
+		switch jsonStr(m, "id") {
+		case firstID:
+			firstAt = i
+		case secondID:
+			secondAt = i
+		case deletedID:
+			t.Error("ready voice_chat should skip deleted messages")
+		}
+	}
+	if firstAt < 0 || secondAt < 0 {
+		t.Fatal("ready voice_chat should include the recent in-call messages")
+	}
+	if firstAt > secondAt {
+		t.Error("ready voice_chat should be oldest first")
+	}
+}
@@ -0,0 +1,63 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// ready lists the SFU endpoints, and join_voice reports the endpoint the
+// call landed on: the preferred one for a new call (unknown ones fall back to
+// default), the running call's endpoint for everyone after.
+func TestVoiceEndpoints(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	endpoints := jsonArray(aliceWS.Ready, "voice_endpoints")
+	if len(endpoints) == 0 || endpoints[0] != "default" {
+		t.Fatalf("voice_endpoints should start with default: %v", endpoints)
+	}
+	voiceID := findVoiceChannel(aliceWS.Ready)
+	if voiceID == "" {
+		t.Skip("no voice channel")
+	}
+
+	joined := func(ws *WSClient, userID string) map[string]any {
+		t.Helper()
+		data, err := ws.WaitForMatch("voice_state_update", func(raw json.RawMessage) bool {
+			m := parseData(raw)
+			return jsonStr(m, "user_id") == userID && jsonStr(m, "channel_id") == voiceID
+		}, wait)
+		if err != nil {
+			t.Fatalf("no join for %s: %v", userID, err)
+		}
+		return parseData(data)
+	}
+
+	aliceWS.Send("join_voice", map[string]any{"channel_id": voiceID, "endpoint": "nowhere"})
+	defer aliceWS.Send("leave_voice", map[string]any{})
+	first := jsonStr(joined(aliceWS, aliceID), "endpoint")
+	if first != "default" {
+		t.Errorf("unknown endpoint should fall back to default, got %q", first)
+	}
+
+	// A different preference can't split the call
+	preferred := "default"
+	if len(endpoints) > 1 {
+		preferred = endpoints[1].(string)
+	}
+	bobWS.Send("join_voice", map[string]any{"channel_id": voiceID, "endpoint": preferred})
+	defer bobWS.Send("leave_voice", map[string]any{})
+	if got := jsonStr(joined(bobWS, bobID), "endpoint"); got != first {
+		t.Errorf("second joiner should land on the call's endpoint %q, got %q", first, got)
+	}
+}
@@ -0,0 +1,67 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// With --voice-idle-timeout, a self-muted user who stays silent is told
+// voice_idle_disconnect and removed from the call, and everyone sees the
+// leave. Someone unmuted with company stays.
+func TestVoiceIdleDisconnect(t *testing.T) {
+	srv := startOwnServer(t, "--voice-idle-timeout", "2")
+
+	NewHTTPClient().Register("listener", "listenerpass")
+	approveUserByName(t, srv.AdminToken, "listener")
+	status, body, err := NewHTTPClient().Login("listener", "listenerpass")
+	if err != nil || status != 200 {
+		t.Fatalf("listener login: %d %v", status, err)
+	}
+	listenerToken := jsonStr(body, "token")
+	listenerID := jsonStr(jsonMap(body, "user"), "id")
+
+	adminWS, err := ConnectWS(srv.AdminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+	voiceID := findVoiceChannel(adminWS.Ready)
+	adminWS.Close()
+
+	muted := joinVoiceFor(t, srv.AdminToken, voiceID)
+	defer muted.Close()
+	mutedID := jsonStr(jsonMap(muted.Ready, "user"), "id")
+	listener := joinVoiceFor(t, listenerToken, voiceID)
+	defer listener.Close()
+
+	muted.Send("voice_self_mute", map[string]any{"muted": true})
+	if _, err := listener.WaitForMatch("voice_state_update", func(raw json.RawMessage) bool {
+		m := parseData(raw)
+		return jsonStr(m, "user_id") == mutedID && jsonBool(m, "self_mute")
+	}, wait); err != nil {
+		t.Fatalf("no voice_state_update for the mute: %v", err)
+	}
+	start := time.Now()
+
+	data, err := muted.WaitFor("voice_idle_disconnect", wait)
+	if err != nil {
+		t.Fatalf("no voice_idle_disconnect: %v", err)
+	}
+	if got := jsonStr(parseData(data), "channel_id"); got != voiceID {
+		t.Errorf("voice_idle_disconnect channel_id %q, want %q", got, voiceID)
+	}
+	if waited := time.Since(start); waited < 1500*time.Millisecond {
+		t.Errorf("removed after %v, before the 2s timeout", waited)
+	}
+	if _, err := listener.WaitForMatch("voice_state_update", func(raw json.RawMessage) bool {
+		m := parseData(raw)
+		return jsonStr(m, "user_id") == mutedID && jsonStr(m, "channel_id") == ""
+	}, wait); err != nil {
+		t.Errorf("no leave voice_state_update for the idle user: %v", err)
+	}
+
+	if _, err := listener.WaitFor("voice_idle_disconnect", shortNoEvent); err == nil {
+		t.Errorf("listener %s was unmuted with company but got voice_idle_disconnect", listenerID)
+	}
+}
@@ -0,0 +1,78 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// An admin can eject one user from voice; the user gets voice_kicked and
+// everyone sees them leave, but their WebSocket stays up.
+func TestVoiceKick(t *testing.T) {
+	ensureUsers(t)
+
+	adminWS, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	defer adminWS.Close()
+
+	voiceID := findVoiceChannel(adminWS.Ready)
+	bobWS := joinVoiceFor(t, bobToken, voiceID)
+	defer bobWS.Close()
+	adminWS.WaitForMatch("voice_state_update", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "user_id") == bobID
+	}, wait)
+
+	adminWS.Send("voice_kick", map[string]any{"user_id": bobID})
+
+	data, err := bobWS.WaitFor("voice_kicked", wait)
+	if err != nil {
+		t.Fatalf("bob got no voice_kicked: %v", err)
+	}
+	if jsonStr(parseData(data), "channel_id") != voiceID {
+		t.Errorf("voice_kicked channel_id: got %v", parseData(data))
+	}
+
+	data, err = adminWS.WaitForMatch("voice_state_update", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "user_id") == bobID
+	}, wait)
+	if err != nil {
+		t.Fatalf("no voice_state_update for kick: %v", err)
+	}
+	if ch := jsonStr(parseData(data), "channel_id"); ch != "" {
+		t.Errorf("kicked user should have empty channel_id, got %q", ch)
+	}
+
+	// Bob's connection is still usable
+	bobWS.Send("typing_start", map[string]any{"channel_id": findTextChannel(bobWS.Ready)})
+	if _, err := adminWS.WaitFor("typing_start", wait); err != nil {
+		t.Errorf("bob's WS should still be connected: %v", err)
+	}
+}
+
+// Users who don't manage the channel can't kick.
+func TestVoiceKickRequiresManager(t *testing.T) {
+	ensureUsers(t)
+
+	aliceWS, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer aliceWS.Close()
+
+	voiceID := findVoiceChannel(aliceWS.Ready)
+	bobWS := joinVoiceFor(t, bobToken, voiceID)
+	defer bobWS.Close()
+
+	aliceWS.Send("voice_kick", map[string]any{"user_id": bobID})
+	data, err := aliceWS.WaitFor("error", wait)
+	if err != nil {
+		t.Fatalf("alice got no error: %v", err)
+	}
+	if d := parseData(data); jsonStr(d, "op") != "voice_kick" || jsonStr(d, "code") != "forbidden" {
+		t.Errorf("error: got %v", d)
+	}
+	if _, err := bobWS.WaitFor("voice_kicked", shortNoEvent); err == nil {
+		t.Error("bob should not have been kicked")
+	}
+}
@@ -0,0 +1,56 @@
+package validation
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// A priority speaker ducks the rest of the room while talking, and leaving
+// mid-sentence lifts the duck.
+func TestVoicePrioritySpeaker(t *testing.T) {
+	ensureUsers(t)
+
+	lobby, err := ConnectWS(adminToken)
+	if err != nil {
+		t.Fatalf("admin ws: %v", err)
+	}
+	voiceID := findVoiceChannel(lobby.Ready)
+	lobby.Close()
+
+	adminWS := joinVoiceFor(t, adminToken, voiceID)
+	defer adminWS.Close()
+	bobWS := joinVoiceFor(t, bobToken, voiceID)
+	defer bobWS.Close()
+	isBob := func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "user_id") == bobID
+	}
+	adminWS.WaitForMatch("voice_state_update", isBob, wait)
+
+	adminWS.Send("voice_priority_speaker", map[string]any{"channel_id": voiceID, "user_id": bobID})
+	data, err := adminWS.WaitForMatch("voice_state_update", isBob, wait)
+	if err != nil {
+		t.Fatalf("no voice_state_update for priority: %v", err)
+	}
+	if !jsonBool(parseData(data), "priority_speaker") {
+		t.Fatalf("bob should be priority speaker: %s", data)
+	}
+
+	bobWS.Send("voice_speaking", map[string]any{"speaking": true})
+	data, err = adminWS.WaitFor("voice_ducking", wait)
+	if err != nil {
+		t.Fatalf("no voice_ducking when bob spoke: %v", err)
+	}
+	d := parseData(data)
+	if jsonStr(d, "user_id") != bobID || !jsonBool(d, "active") {
+		t.Errorf("voice_ducking: got %v", d)
+	}
+
+	bobWS.Send("leave_voice", nil)
+	data, err = adminWS.WaitFor("voice_ducking", wait)
+	if err != nil {
+		t.Fatalf("no voice_ducking when bob left: %v", err)
+	}
+	if d := parseData(data); jsonStr(d, "user_id") != bobID || jsonBool(d, "active") {
+		t.Errorf("voice_ducking after leave: got %v", d)
+	}
+}
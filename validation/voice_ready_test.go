@@ -0,0 +1,45 @@
+package validation
+
+import "testing"
+
+// A client connecting while someone is in voice learns about them (and
+// their mute state) from ready, without waiting for a voice_state_update.
+func TestReadyIncludesVoiceStates(t *testing.T) {
+	ensureUsers(t)
+
+	voiceID := findVoiceChannelForToken(t, aliceToken)
+	aliceWS := joinVoiceFor(t, aliceToken, voiceID)
+	defer aliceWS.Close()
+	aliceWS.Send("voice_self_mute", map[string]any{"muted": true})
+	if _, err := aliceWS.WaitFor("voice_state_update", wait); err != nil {
+		t.Fatalf("no voice_state_update for mute: %v", err)
+	}
+
+	bobWS, err := ConnectWS(bobToken)
+	if err != nil {
+		t.Fatalf("bob ws: %v", err)
+	}
+	defer bobWS.Close()
+
+	var found map[string]any
+	for _, v := range jsonArray(bobWS.Ready, "voice_states") {
+		vs, _ := v.(map[string]any)
+		if jsonStr(vs, "user_id") == aliceID {
+			found = vs
+		}
+	}
+	if found == nil {
+		t.Fatalf("alice missing from ready voice_states: %v", bobWS.Ready["voice_states"])
+	}
+	if jsonStr(found, "channel_id") != voiceID {
+		t.Errorf("alice's channel_id %q, want %q", jsonStr(found, "channel_id"), voiceID)
+	}
+	if !jsonBool(found, "self_mute") {
+		t.Error("alice's self_mute not carried in ready")
+	}
+	if _, ok := bobWS.Ready["screen_shares"].([]any); !ok {
+		t.Errorf("ready screen_shares should be an array, got %v", bobWS.Ready["screen_shares"])
+	}
+
+	aliceWS.Send("leave_voice", map[string]any{})
+}
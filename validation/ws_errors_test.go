@@ -0,0 +1,131 @@
+package validation
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func waitForOpError(t *testing.T, ws *WSClient, op string) map[string]any {
+	t.Helper()
+	data, err := ws.WaitForMatch("error", func(d json.RawMessage) bool {
+		return jsonStr(parseData(d), "op") == op
+	}, wait)
+	if err != nil {
+		t.Fatalf("no error event for %s: %v", op, err)
+	}
+	return parseData(data)
+}
+
+// Rejected ops come back as an error event instead of silence.
+func TestRejectedOpsSendError(t *testing.T) {
+	ensureUsers(t)
+
+	ws, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer ws.Close()
+	channelID := findTextChannel(ws.Ready)
+
+	cases := []struct {
+		name string
+		op   string
+		data map[string]any
+		code string
+	}{
+		{"empty message", "send_message", map[string]any{"channel_id": channelID}, "invalid_request"},
+		{"unknown channel", "send_message", map[string]any{"channel_id": "00000000-0000-0000-0000-000000000000", "content": "hi"}, "not_found"},
+		{"edit missing message", "edit_message", map[string]any{"message_id": "nope", "content": "x"}, "not_found"},
+		{"delete missing message", "delete_message", map[string]any{"message_id": "nope"}, "not_found"},
+		{"bad channel type", "create_channel", map[string]any{"name": "x", "type": "forum"}, "invalid_request"},
+		{"non-admin reorder", "reorder_channels", map[string]any{"channel_ids": []string{channelID}}, "forbidden"},
+		{"unknown op", "frobnicate_channel", map[string]any{}, "unknown_op"},
+		{"second authenticate", "authenticate", map[string]any{"token": aliceToken}, "invalid_request"},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			ws.Send(tc.op, tc.data)
+			e := waitForOpError(t, ws, tc.op)
+			if jsonStr(e, "code") != tc.code {
+				t.Errorf("code: got %q, want %q", jsonStr(e, "code"), tc.code)
+			}
+			if jsonStr(e, "message") == "" || jsonStr(e, "reason") != jsonStr(e, "message") {
+				t.Errorf("expected message mirrored in reason, got %v", e)
+			}
+		})
+	}
+}
+
+// A reply pointing at another channel is rejected before anything is saved.
+func TestCrossChannelReplyNotSaved(t *testing.T) {
+	ensureUsers(t)
+
+	ws, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer ws.Close()
+	textID := findTextChannel(ws.Ready)
+	voiceID := findVoiceChannel(ws.Ready)
+
+	parent := uniqueName("parent")
+	ws.Send("send_message", map[string]any{"channel_id": textID, "content": parent})
+	data, err := ws.WaitForMatch("message_create", func(d json.RawMessage) bool {
+		return jsonStr(parseData(d), "content") == parent
+	}, wait)
+	if err != nil {
+		t.Fatalf("no message_create: %v", err)
+	}
+	parentID := jsonStr(parseData(data), "id")
+
+	stray := uniqueName("stray reply")
+	ws.Send("send_message", map[string]any{"channel_id": voiceID, "content": stray, "reply_to_id": parentID})
+	if e := waitForOpError(t, ws, "send_message"); jsonStr(e, "code") != "invalid_request" {
+		t.Errorf("code: got %v", e)
+	}
+
+	c := NewHTTPClient()
+	c.Token = aliceToken
+	_, msgs, err := c.GetJSONArray("/api/v1/channels/" + voiceID + "/messages")
+	if err != nil {
+		t.Fatalf("get messages: %v", err)
+	}
+	for _, m := range msgs {
+		if jsonStr(m.(map[string]any), "content") == stray {
+			t.Error("rejected reply should not be persisted")
+		}
+	}
+}
+
+// An oversized message is answered with message_too_large and the
+// connection keeps working.
+func TestOversizedWSMessage(t *testing.T) {
+	ensureUsers(t)
+
+	ws, err := ConnectWS(aliceToken)
+	if err != nil {
+		t.Fatalf("alice ws: %v", err)
+	}
+	defer ws.Close()
+	channelID := findTextChannel(ws.Ready)
+
+	if err := ws.Send("send_message", map[string]any{
+		"channel_id": channelID,
+		"content":    strings.Repeat("x", 64*1024),
+	}); err != nil {
+		t.Fatalf("send oversized: %v", err)
+	}
+	e := waitForOpError(t, ws, "")
+	if jsonStr(e, "code") != "message_too_large" {
+		t.Errorf("code: got %q, want message_too_large", jsonStr(e, "code"))
+	}
+
+	content := uniqueName("after-oversize")
+	ws.Send("send_message", map[string]any{"channel_id": channelID, "content": content})
+	if _, err := ws.WaitForMatch("message_create", func(raw json.RawMessage) bool {
+		return jsonStr(parseData(raw), "content") == content
+	}, wait); err != nil {
+		t.Fatalf("connection should survive an oversized message: %v", err)
+	}
+}
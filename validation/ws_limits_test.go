@@ -0,0 +1,92 @@
+package validation
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"nhooyr.io/websocket"
+)
+
+// Connections past the per-IP cap (20 by default) are closed during the
+// handshake with 1013, and a freed slot can be reused.
+func TestWSPerIPConnectionLimit(t *testing.T) {
+	wsURL := strings.Replace(serverURL, "http", "ws", 1) + "/ws"
+	ip := "203.0.113.77"
+	dial := func() *websocket.Conn {
+		t.Helper()
+		ctx, cancel := context.WithTimeout(context.Background(), wait)
+		defer cancel()
+		conn, _, err := websocket.Dial(ctx, wsURL, &websocket.DialOptions{
+			HTTPHeader: http.Header{"X-Real-IP": []string{ip}},
+		})
+		if err != nil {
+			t.Fatalf("dial: %v", err)
+		}
+		return conn
+	}
+	// closeStatus reads from conn until it closes or timeout passes,
+	// returning the close code (-1 if none arrived)
+	closeStatus := func(conn *websocket.Conn, timeout time.Duration) websocket.StatusCode {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		_, _, err := conn.Read(ctx)
+		return websocket.CloseStatus(err)
+	}
+
+	var conns []*websocket.Conn
+	defer func() {
+		for _, c := range conns {
+			c.Close(websocket.StatusNormalClosure, "")
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		conns = append(conns, dial())
+	}
+
+	extra := dial()
+	if code := closeStatus(extra, wait); code != websocket.StatusTryAgainLater {
+		t.Fatalf("21st connection from one IP should be closed with 1013, got %d", code)
+	}
+
+	conns[0].Close(websocket.StatusNormalClosure, "")
+	conns = conns[1:]
+	time.Sleep(200 * time.Millisecond)
+	again := dial()
+	conns = append(conns, again)
+	if closeStatus(again, 500*time.Millisecond) == websocket.StatusTryAgainLater {
+		t.Error("a connection should be accepted once a slot frees up")
+	}
+}
+
+// The lagging-disconnect counter is for admins, not the public health check.
+func TestLaggingDisconnectsAdminOnly(t *testing.T) {
+	ensureAdmin(t)
+	ensureUsers(t)
+
+	_, health, err := NewHTTPClient().GetJSON("/api/v1/health")
+	if err != nil {
+		t.Fatalf("health: %v", err)
+	}
+	if _, ok := health["lagging_disconnects"]; ok {
+		t.Errorf("health exposes lagging_disconnects: %v", health)
+	}
+
+	alice := NewHTTPClient()
+	alice.Token = aliceToken
+	if status, _, _ := alice.GetJSON("/api/v1/admin/stats"); status != 403 {
+		t.Errorf("non-admin stats: status %d, want 403", status)
+	}
+
+	admin := NewHTTPClient()
+	admin.Token = adminToken
+	status, stats, err := admin.GetJSON("/api/v1/admin/stats")
+	if err != nil || status != 200 {
+		t.Fatalf("admin stats: %d %v", status, err)
+	}
+	if _, ok := stats["lagging_disconnects"].(float64); !ok {
+		t.Errorf("stats missing lagging_disconnects: %v", stats)
+	}
+}